@@ -0,0 +1,90 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"pgmanager/internal/api"
+)
+
+func accessGrant(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	b, err := mgr.GrantAccess(ctx, args[0], args[1], args[2])
+	if err != nil {
+		return err
+	}
+	return render(api.NewAccessResponse(*b), []string{b.Subject}, func(bool) {
+		notify("Granted %s the %s role on project '%s'\n", b.Subject, b.Role, args[0])
+	})
+}
+
+func accessRevoke(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := mgr.RevokeAccess(ctx, args[0], args[1]); err != nil {
+		return err
+	}
+	notify("Revoked the role of %s on project '%s'\n", args[1], args[0])
+	return nil
+}
+
+func accessList(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var projectName string
+	if len(args) > 0 {
+		projectName = args[0]
+	}
+	bindings, err := mgr.ListAccess(ctx, projectName)
+	if err != nil {
+		return err
+	}
+
+	response := make([]api.AccessResponse, len(bindings))
+	names := make([]string, len(bindings))
+	for i, b := range bindings {
+		response[i] = api.NewAccessResponse(b)
+		names[i] = b.ProjectName + "/" + b.Subject
+	}
+
+	return render(response, names, func(wide bool) {
+		if len(bindings) == 0 {
+			notify("No roles granted\n")
+			return
+		}
+
+		header := fmt.Sprintf("%-20s %-30s %-12s", "PROJECT", "SUBJECT", "ROLE")
+		width := 64
+		if wide {
+			header += fmt.Sprintf(" %s", "GRANTED")
+			width += 18
+		}
+		fmt.Println(header)
+		fmt.Println(strings.Repeat("-", width))
+		for _, b := range bindings {
+			line := fmt.Sprintf("%-20s %-30s %-12s", b.ProjectName, truncate(b.Subject, 30), b.Role)
+			if wide {
+				line += fmt.Sprintf(" %s", b.CreatedAt.Local().Format("2006-01-02 15:04"))
+			}
+			fmt.Println(line)
+		}
+	})
+}
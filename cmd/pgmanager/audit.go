@@ -0,0 +1,72 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"pgmanager/internal/api"
+	"pgmanager/internal/meta"
+)
+
+// auditList prints audit events, newest first
+func auditList(filter meta.AuditFilter, since, until string) error {
+	var err error
+	if filter.Since, err = api.ParseSince(since); err != nil {
+		return err
+	}
+	if filter.Until, err = api.ParseSince(until); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	events, err := mgr.ListAudit(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	response := make([]api.AuditEventResponse, len(events))
+	names := make([]string, len(events))
+	for i, e := range events {
+		response[i] = api.NewAuditEventResponse(e)
+		names[i] = fmt.Sprintf("%d", e.ID)
+	}
+
+	return render(response, names, func(wide bool) {
+		if len(events) == 0 {
+			notify("No audit events found\n")
+			return
+		}
+
+		header := fmt.Sprintf("%-8s %-17s %-24s %-10s %-22s %-28s %-10s", "ID", "TIME", "ACTOR", "SOURCE", "ACTION", "TARGET", "OUTCOME")
+		width := 125
+		if wide {
+			header += fmt.Sprintf(" %-20s %s", "REQUEST", "ERROR")
+			width += 50
+		}
+		fmt.Println(header)
+		fmt.Println(strings.Repeat("-", width))
+		for _, e := range events {
+			target := e.Target
+			if target == "" {
+				target = e.Project
+			}
+			line := fmt.Sprintf("%-8d %-17s %-24s %-10s %-22s %-28s %-10s",
+				e.ID, e.CreatedAt.Local().Format("2006-01-02 15:04"), truncate(e.Actor, 24), e.Source,
+				e.Action, truncate(target, 28), e.Outcome)
+			if wide {
+				line += fmt.Sprintf(" %-20s %s", truncate(e.RequestID, 20), e.Error)
+			}
+			fmt.Println(line)
+		}
+		if len(events) == filter.Limit {
+			notify("\nShowing the newest %d events; use --before %d for older ones\n", len(events), events[len(events)-1].ID)
+		}
+	})
+}
@@ -0,0 +1,229 @@
+package main
+
+import (
+	"bufio"
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/exec"
+	"os/signal"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+	"pgmanager/internal/client"
+	"pgmanager/internal/db"
+	"pgmanager/internal/export"
+	"pgmanager/internal/project"
+)
+
+// defaultClient is started by "db connect" unless client.command is configured
+const defaultClient = "psql"
+
+func dbConnect(args, clientArgs []string, client string, usePassFile, builtin bool) error {
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	env, prNumber, err := parseEnvArgs(args)
+	if err != nil {
+		return err
+	}
+
+	info, err := databaseCredentials(ctx, mgr, args[0], env, prNumber)
+	if err != nil {
+		return err
+	}
+	// The metadata store is not needed while the session is open
+	store.Close()
+
+	if builtin {
+		return runShell(ctx, info)
+	}
+
+	if client == "" {
+		client = cfg.Client.Command
+	}
+	if client == "" {
+		client = defaultClient
+	}
+	fields := strings.Fields(client)
+	path, err := exec.LookPath(fields[0])
+	if err != nil {
+		if fields[0] != defaultClient {
+			return fmt.Errorf("client '%s' not found", fields[0])
+		}
+		fmt.Fprintln(os.Stderr, "psql not found, using the built-in shell")
+		return runShell(ctx, info)
+	}
+
+	return runClient(path, append(fields[1:], clientArgs...), info, usePassFile)
+}
+
+// databaseCredentials returns a database including its password. A pgmanager
+// server only hands out credentials through its env endpoint.
+func databaseCredentials(ctx context.Context, svc project.Service, projectName, env string, prNumber *int) (*project.DatabaseInfo, error) {
+	if c, ok := svc.(*client.Client); ok {
+		return c.Credentials(ctx, projectName, env, prNumber)
+	}
+	return svc.GetDatabase(ctx, projectName, env, prNumber)
+}
+
+// runClient runs an interactive client connected to the database. The connection
+// details are passed in the standard libpq environment variables, and the password
+// either in PGPASSWORD or in a temporary pgpass file, so it never appears on the
+// command line.
+func runClient(path string, args []string, info *project.DatabaseInfo, usePassFile bool) error {
+	env := make([]string, 0, len(os.Environ())+6)
+	for _, kv := range os.Environ() {
+		// Drop settings that would override the ones below
+		if !strings.HasPrefix(kv, "PGPASSWORD=") && !strings.HasPrefix(kv, "PGPASSFILE=") {
+			env = append(env, kv)
+		}
+	}
+	env = append(env,
+		"PGHOST="+info.Host,
+		fmt.Sprintf("PGPORT=%d", info.Port),
+		"PGDATABASE="+info.DatabaseName,
+		"PGUSER="+info.UserName,
+		"PGSSLMODE="+info.SSLMode,
+	)
+
+	if usePassFile {
+		f, err := os.CreateTemp("", "pgmanager-*.pgpass")
+		if err != nil {
+			return fmt.Errorf("failed to create pgpass file: %w", err)
+		}
+		defer os.Remove(f.Name())
+
+		// CreateTemp creates the file with mode 0600, which libpq requires
+		_, err = f.WriteString(export.PgpassLine(info.Connection()))
+		if closeErr := f.Close(); err == nil {
+			err = closeErr
+		}
+		if err != nil {
+			return fmt.Errorf("failed to write pgpass file: %w", err)
+		}
+		env = append(env, "PGPASSFILE="+f.Name())
+	} else {
+		env = append(env, "PGPASSWORD="+info.Password)
+	}
+
+	cmd := exec.Command(path, args...)
+	cmd.Stdin = os.Stdin
+	cmd.Stdout = os.Stdout
+	cmd.Stderr = os.Stderr
+	cmd.Env = env
+
+	// Ctrl-C is meant for the client; keep running so the pgpass file gets removed
+	interrupts := make(chan os.Signal, 1)
+	signal.Notify(interrupts, os.Interrupt)
+	defer signal.Stop(interrupts)
+
+	if err := cmd.Run(); err != nil {
+		var exitErr *exec.ExitError
+		if errors.As(err, &exitErr) {
+			return fmt.Errorf("%s exited with status %d", path, exitErr.ExitCode())
+		}
+		return fmt.Errorf("failed to start %s: %w", path, err)
+	}
+	return nil
+}
+
+// listTablesSQL backs the \dt shell command
+const listTablesSQL = `
+	SELECT n.nspname AS schema, c.relname AS name,
+		CASE c.relkind WHEN 'r' THEN 'table' WHEN 'p' THEN 'partitioned table'
+			WHEN 'v' THEN 'view' WHEN 'm' THEN 'materialized view' END AS type
+	FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+	WHERE c.relkind IN ('r', 'p', 'v', 'm')
+		AND n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname NOT LIKE 'pg_toast%'
+	ORDER BY 1, 2`
+
+// runShell is a minimal line-oriented SQL shell for systems without psql. Input is
+// collected until a line ends with a semicolon and then run as one script.
+func runShell(ctx context.Context, info *project.DatabaseInfo) error {
+	conn, err := pgx.Connect(ctx, info.ConnString)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer func() { conn.Close(context.Background()) }()
+
+	fmt.Printf("Connected to %s as %s. Type \\? for help, \\q to quit.\n", info.DatabaseName, info.UserName)
+
+	// run fails only when the connection is lost for good
+	run := func(script string) error {
+		// Ctrl-C cancels the running statement instead of leaving the shell
+		queryCtx, stop := signal.NotifyContext(ctx, os.Interrupt)
+		defer stop()
+
+		results, err := db.Query(queryCtx, conn, script, db.QueryOptions{})
+		for _, result := range results {
+			printQueryResult(result, "table")
+			fmt.Println()
+		}
+		if err != nil {
+			fmt.Fprintf(os.Stderr, "ERROR: %v\n", err)
+		}
+
+		// Cancelling a statement may close the connection
+		if conn.IsClosed() {
+			reconnected, err := pgx.Connect(ctx, info.ConnString)
+			if err != nil {
+				return fmt.Errorf("failed to reconnect: %w", err)
+			}
+			conn = reconnected
+		}
+		return nil
+	}
+
+	scanner := bufio.NewScanner(os.Stdin)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	var pending strings.Builder
+	prompt := func() {
+		if pending.Len() == 0 {
+			fmt.Printf("%s=> ", info.DatabaseName)
+		} else {
+			fmt.Printf("%s-> ", info.DatabaseName)
+		}
+	}
+
+	for prompt(); scanner.Scan(); prompt() {
+		line := scanner.Text()
+		trimmed := strings.TrimSpace(line)
+
+		if pending.Len() == 0 && strings.HasPrefix(trimmed, `\`) {
+			switch trimmed {
+			case `\q`:
+				return nil
+			case `\dt`:
+				if err := run(listTablesSQL); err != nil {
+					return err
+				}
+			case `\?`:
+				fmt.Println(`  \dt   list tables and views`)
+				fmt.Println(`  \q    quit`)
+				fmt.Println("  End a statement with ; to run it.")
+			default:
+				fmt.Fprintf(os.Stderr, "unknown command %s, try \\?\n", trimmed)
+			}
+			continue
+		}
+
+		pending.WriteString(line)
+		pending.WriteString("\n")
+		if strings.HasSuffix(trimmed, ";") {
+			script := pending.String()
+			pending.Reset()
+			if err := run(script); err != nil {
+				return err
+			}
+		}
+	}
+
+	fmt.Println()
+	return scanner.Err()
+}
@@ -0,0 +1,182 @@
+package main
+
+import (
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"pgmanager/internal/config"
+	"pgmanager/internal/project"
+)
+
+// selectedContext returns the context in effect, or nil when --config is given
+// or no context applies
+func selectedContext() (*config.Context, error) {
+	if cfgFile != "" {
+		if contextName != "" {
+			return nil, usageError{fmt.Errorf("specify either --config or --context")}
+		}
+		return nil, nil
+	}
+	return config.SelectContext(contextName)
+}
+
+// useDefaultProject lets commands whose first argument is a project omit it when
+// the context in effect sets a project. The project is filled in when no arguments
+// are given to a command that requires a project, or when the first argument is
+// an environment.
+func useDefaultProject(cmd *cobra.Command) {
+	for _, sub := range cmd.Commands() {
+		useDefaultProject(sub)
+	}
+
+	fields := strings.Fields(cmd.Use)
+	if len(fields) < 2 || cmd.RunE == nil {
+		return
+	}
+	required := fields[1] == "<project>"
+	if !required && fields[1] != "[project]" {
+		return
+	}
+
+	withProject := func(args []string) []string {
+		ctx, err := selectedContext()
+		if err != nil || ctx == nil || ctx.Project == "" {
+			return args
+		}
+		if (len(args) == 0 && required) || (len(args) > 0 && isEnvArg(args[0])) {
+			return append([]string{ctx.Project}, args...)
+		}
+		return args
+	}
+
+	validate, run := cmd.Args, cmd.RunE
+	cmd.Args = func(cmd *cobra.Command, args []string) error {
+		if validate == nil {
+			return nil
+		}
+		return validate(cmd, withProject(args))
+	}
+	cmd.RunE = func(cmd *cobra.Command, args []string) error {
+		return run(cmd, withProject(args))
+	}
+}
+
+// isEnvArg reports whether an argument is an environment rather than a project
+func isEnvArg(arg string) bool {
+	env, _, err := project.ParseEnv(arg)
+	return err == nil && project.ValidateEnv(env) == nil
+}
+
+func contextList(cmd *cobra.Command, args []string) error {
+	contexts, err := config.LoadContexts()
+	if err != nil {
+		return err
+	}
+
+	names := make([]string, len(contexts.Contexts))
+	for i, c := range contexts.Contexts {
+		names[i] = c.Name
+	}
+
+	// Tokens stay out of structured output
+	type contextResponse struct {
+		Name    string `json:"name"`
+		Current bool   `json:"current"`
+		Config  string `json:"config,omitempty"`
+		Server  string `json:"server,omitempty"`
+		Project string `json:"project,omitempty"`
+	}
+	response := make([]contextResponse, len(contexts.Contexts))
+	for i, c := range contexts.Contexts {
+		response[i] = contextResponse{
+			Name:    c.Name,
+			Current: c.Name == contexts.Current,
+			Config:  c.Config,
+			Server:  c.Server,
+			Project: c.Project,
+		}
+	}
+
+	return render(response, names, func(bool) {
+		if len(contexts.Contexts) == 0 {
+			notify("No contexts found\n")
+			return
+		}
+
+		fmt.Printf("%-2s %-20s %-8s %-45s %s\n", "", "NAME", "TYPE", "TARGET", "PROJECT")
+		fmt.Println(strings.Repeat("-", 94))
+		for _, c := range contexts.Contexts {
+			marker := ""
+			if c.Name == contexts.Current {
+				marker = "*"
+			}
+			kind, target := "direct", c.Config
+			if c.Remote() {
+				kind, target = "remote", c.Server
+			}
+			fmt.Printf("%-2s %-20s %-8s %-45s %s\n", marker, c.Name, kind, truncate(target, 45), c.Project)
+		}
+	})
+}
+
+func contextUse(cmd *cobra.Command, args []string) error {
+	contexts, err := config.LoadContexts()
+	if err != nil {
+		return err
+	}
+	if err := contexts.Use(args[0]); err != nil {
+		return err
+	}
+	if err := contexts.Save(); err != nil {
+		return err
+	}
+
+	notify("Switched to context '%s'\n", args[0])
+	return nil
+}
+
+func contextAdd(ctx config.Context) error {
+	contexts, err := config.LoadContexts()
+	if err != nil {
+		return err
+	}
+	if err := contexts.Add(ctx); err != nil {
+		return err
+	}
+	if err := contexts.Save(); err != nil {
+		return err
+	}
+
+	notify("Context '%s' added; switch to it with 'pgmanager context use %s'\n", ctx.Name, ctx.Name)
+	return nil
+}
+
+func contextRemove(cmd *cobra.Command, args []string) error {
+	contexts, err := config.LoadContexts()
+	if err != nil {
+		return err
+	}
+	if err := contexts.Remove(args[0]); err != nil {
+		return err
+	}
+	if err := contexts.Save(); err != nil {
+		return err
+	}
+
+	notify("Context '%s' removed\n", args[0])
+	return nil
+}
+
+// contextCurrent prints only the name of the context in effect, and nothing when
+// there is none, so it can be used in a shell prompt
+func contextCurrent(cmd *cobra.Command, args []string) error {
+	ctx, err := selectedContext()
+	if err != nil {
+		return err
+	}
+	if ctx != nil {
+		fmt.Println(ctx.Name)
+	}
+	return nil
+}
@@ -0,0 +1,201 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"strconv"
+	"strings"
+	"time"
+
+	"pgmanager/internal/api"
+	"pgmanager/internal/meta"
+	"pgmanager/internal/project"
+)
+
+// jobPollInterval is how often 'job show --wait' polls a job
+const jobPollInterval = time.Second
+
+// errJobMigrationsDir is returned when --dir is given with --wait=false
+var errJobMigrationsDir = errors.New("--dir cannot be used with --wait=false; jobs use the server's configured migrations directory")
+
+// startJob starts an operation as a job on the server without waiting for it
+func startJob(req project.JobRequest) error {
+	if cfg.Remote.Server == "" {
+		return fmt.Errorf("--wait=false needs a pgmanager server, since jobs run in 'serve'")
+	}
+
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	job, err := mgr.StartJob(ctx, req)
+	if err != nil {
+		return err
+	}
+
+	return render(api.NewJobResponse(*job, nil), []string{strconv.FormatInt(job.ID, 10)}, func(bool) {
+		fmt.Printf("Started %s job %d\n", job.Kind, job.ID)
+		fmt.Printf("Follow it with: pgmanager job show %d --wait\n", job.ID)
+	})
+}
+
+// jobList prints jobs, newest first
+func jobList(filter meta.JobFilter) error {
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	jobs, err := mgr.ListJobs(ctx, filter)
+	if err != nil {
+		return err
+	}
+
+	response := make([]api.JobResponse, len(jobs))
+	names := make([]string, len(jobs))
+	for i, j := range jobs {
+		response[i] = api.NewJobResponse(j, nil)
+		names[i] = strconv.FormatInt(j.ID, 10)
+	}
+
+	return render(response, names, func(wide bool) {
+		if len(jobs) == 0 {
+			notify("No jobs found\n")
+			return
+		}
+
+		header := fmt.Sprintf("%-8s %-17s %-22s %-28s %-10s %-9s", "ID", "CREATED", "KIND", "TARGET", "STATUS", "PROGRESS")
+		width := 99
+		if wide {
+			header += fmt.Sprintf(" %-24s %s", "ACTOR", "ERROR")
+			width += 40
+		}
+		fmt.Println(header)
+		fmt.Println(strings.Repeat("-", width))
+		for _, j := range jobs {
+			line := fmt.Sprintf("%-8d %-17s %-22s %-28s %-10s %-9s",
+				j.ID, j.CreatedAt.Local().Format("2006-01-02 15:04"), j.Kind, truncate(jobTarget(j), 28), j.Status, jobProgress(j))
+			if wide {
+				line += fmt.Sprintf(" %-24s %s", truncate(j.Actor, 24), j.Error)
+			}
+			fmt.Println(line)
+		}
+	})
+}
+
+// jobShow prints a job and its log. With wait, it follows the job until it
+// finishes, printing log lines as they come, and fails if the job did.
+func jobShow(arg string, wait bool) error {
+	id, err := parseJobID(arg)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var info *project.JobInfo
+	if wait {
+		printed := 0
+		info, err = project.WaitJob(ctx, mgr, id, jobPollInterval, func(update *project.JobInfo) {
+			for _, l := range update.Logs[min(printed, len(update.Logs)):] {
+				notify("%s %s\n", l.Time.Local().Format("15:04:05"), l.Message)
+			}
+			printed = len(update.Logs)
+		})
+	} else {
+		info, err = mgr.GetJob(ctx, id)
+	}
+	if err != nil {
+		return err
+	}
+
+	err = render(api.NewJobResponse(info.Job, info.Logs), []string{arg}, func(bool) {
+		if wait {
+			fmt.Println()
+		}
+		fmt.Printf("Job:       %d\n", info.ID)
+		fmt.Printf("Kind:      %s\n", info.Kind)
+		if target := jobTarget(info.Job); target != "" {
+			fmt.Printf("Target:    %s\n", target)
+		}
+		fmt.Printf("Status:    %s\n", info.Status)
+		fmt.Printf("Progress:  %s\n", jobProgress(info.Job))
+		fmt.Printf("Actor:     %s\n", info.Actor)
+		fmt.Printf("Created:   %s\n", info.CreatedAt.Local().Format("2006-01-02 15:04:05"))
+		fmt.Printf("Started:   %s\n", formatOptionalTime(info.StartedAt))
+		fmt.Printf("Finished:  %s\n", formatOptionalTime(info.FinishedAt))
+		if info.Error != "" {
+			fmt.Printf("Error:     %s\n", info.Error)
+		}
+		if !wait && len(info.Logs) > 0 {
+			fmt.Println("\nLog:")
+			for _, l := range info.Logs {
+				fmt.Printf("  %s %s\n", l.Time.Local().Format("15:04:05"), l.Message)
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	if wait && info.Status != project.JobSucceeded {
+		return fmt.Errorf("job %d %s", info.ID, info.Status)
+	}
+	return nil
+}
+
+// jobCancel cancels a queued or running job
+func jobCancel(arg string) error {
+	id, err := parseJobID(arg)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := mgr.CancelJob(ctx, id); err != nil {
+		return err
+	}
+
+	notify("Canceled job %d\n", id)
+	return nil
+}
+
+func parseJobID(arg string) (int64, error) {
+	id, err := strconv.ParseInt(arg, 10, 64)
+	if err != nil || id <= 0 {
+		return 0, fmt.Errorf("invalid job ID: %s", arg)
+	}
+	return id, nil
+}
+
+// jobTarget returns what a job operates on
+func jobTarget(j meta.Job) string {
+	if j.Target != "" {
+		return j.Target
+	}
+	return j.Project
+}
+
+// jobProgress formats how many of a job's steps are done
+func jobProgress(j meta.Job) string {
+	if j.Total == 0 {
+		return "-"
+	}
+	return fmt.Sprintf("%d/%d", j.Done, j.Total)
+}
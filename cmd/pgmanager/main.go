@@ -2,7 +2,10 @@ package main
 
 import (
 	"context"
+	"encoding/csv"
+	"encoding/json"
 	"fmt"
+	"io"
 	"os"
 	"strconv"
 	"strings"
@@ -10,7 +13,11 @@ import (
 
 	"github.com/spf13/cobra"
 	"pgmanager/internal/api"
+	"pgmanager/internal/client"
 	"pgmanager/internal/config"
+	"pgmanager/internal/db"
+	"pgmanager/internal/export"
+	"pgmanager/internal/manifest"
 	"pgmanager/internal/meta"
 	"pgmanager/internal/project"
 	"pgmanager/internal/tui"
@@ -22,6 +29,10 @@ var (
 
 	cfgFile string
 	cfg     *config.Config
+
+	contextName  string
+	remoteServer string
+	remoteToken  string
 )
 
 func main() {
@@ -30,30 +41,65 @@ func main() {
 		Short: "PostgreSQL Database Manager",
 		Long:  "A tool for managing PostgreSQL databases with project-based organization",
 		PersistentPreRunE: func(cmd *cobra.Command, args []string) error {
+			if err := validateOutput(); err != nil {
+				return err
+			}
+
 			// Skip config loading for help commands
 			if cmd.Name() == "help" || cmd.Name() == "version" || cmd.Name() == "init" {
 				return nil
 			}
+			// Context commands only use the contexts file
+			if cmd.HasParent() && cmd.Parent().Name() == "context" {
+				return nil
+			}
 
 			var err error
+			selected, err := selectedContext()
+			if err != nil {
+				return err
+			}
 			if cfgFile != "" {
 				cfg, err = config.Load(cfgFile)
+			} else if selected != nil {
+				cfg, err = config.LoadContext(selected)
 			} else {
 				// Auto-discover config file
 				path, discoverErr := config.Discover()
-				if discoverErr != nil {
+				switch {
+				case discoverErr == nil:
+					cfg, err = config.Load(path)
+				case remoteServer != "" || os.Getenv("PGMANAGER_SERVER") != "":
+					// A remote CLI needs no config file
+					cfg = config.Default()
+					cfg.Remote.FromEnv()
+				default:
 					return discoverErr
 				}
-				cfg, err = config.Load(path)
 			}
 			if err != nil {
 				return fmt.Errorf("failed to load config: %w", err)
 			}
+
+			if remoteServer != "" {
+				cfg.Remote.Server = remoteServer
+			}
+			if remoteToken != "" {
+				cfg.Remote.Token = remoteToken
+			}
 			return nil
 		},
 	}
 
 	rootCmd.PersistentFlags().StringVarP(&cfgFile, "config", "c", "", "config file path (default: auto-discover pgmanager.yaml)")
+	rootCmd.PersistentFlags().StringVar(&contextName, "context", "", "context to use (default: current context, $PGMANAGER_CONTEXT)")
+	rootCmd.PersistentFlags().StringVar(&remoteServer, "remote", "", "pgmanager server to run commands through (default: remote.server, $PGMANAGER_SERVER)")
+	rootCmd.PersistentFlags().StringVar(&remoteToken, "token", "", "API token for the pgmanager server (default: remote.token, $PGMANAGER_TOKEN)")
+	rootCmd.PersistentFlags().StringVarP(&outputFormat, "output", "o", outputTable, "output format: "+strings.Join(outputFormats, ", "))
+	rootCmd.PersistentFlags().BoolVarP(&quiet, "quiet", "q", false, "only print requested data and errors")
+	rootCmd.SetFlagErrorFunc(func(cmd *cobra.Command, err error) error {
+		return usageError{err}
+	})
 
 	// Project commands
 	projectCmd := &cobra.Command{
@@ -89,13 +135,17 @@ func main() {
 		Short: "Manage databases",
 	}
 
+	var createServer string
 	dbCreateCmd := &cobra.Command{
 		Use:   "create <project> <env> [pr-number]",
 		Short: "Create a database for a project",
 		Long:  "Create a database. env can be: prod, dev, staging, or pr\nFor PR databases, provide the PR number as the third argument.",
 		Args:  cobra.RangeArgs(2, 3),
-		RunE:  dbCreate,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbCreate(args, createServer)
+		},
 	}
+	dbCreateCmd.Flags().StringVar(&createServer, "server", "", "Server to create the database on (default: placement rules)")
 
 	dbDeleteCmd := &cobra.Command{
 		Use:   "delete <project> <env> [pr-number]",
@@ -118,7 +168,235 @@ func main() {
 		RunE:  dbInfo,
 	}
 
-	dbCmd.AddCommand(dbCreateCmd, dbDeleteCmd, dbListCmd, dbInfoCmd)
+	dbSessionsCmd := &cobra.Command{
+		Use:   "sessions <project> <env> [pr-number]",
+		Short: "List sessions connected to a database",
+		Args:  cobra.RangeArgs(2, 3),
+		RunE:  dbSessions,
+	}
+
+	var killPID int
+	var killAll bool
+	dbKillCmd := &cobra.Command{
+		Use:   "kill <project> <env> [pr-number]",
+		Short: "Terminate sessions connected to a database",
+		Long:  "Terminate a single session with --pid, or every session with --all.",
+		Args:  cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbKill(args, killPID, killAll)
+		},
+	}
+	dbKillCmd.Flags().IntVar(&killPID, "pid", 0, "Terminate the session with this process ID")
+	dbKillCmd.Flags().BoolVar(&killAll, "all", false, "Terminate all sessions")
+
+	// With a pgmanager server, long operations run as jobs that outlive the request
+	var wait bool
+
+	var moveTo string
+	var moveDropSource, moveAbort bool
+	dbMoveCmd := &cobra.Command{
+		Use:   "move <project> <env> [pr-number]",
+		Short: "Move a database to another server",
+		Long: `Copy a database to another server, verify row counts and switch it over.
+
+The source database does not accept new connections while the move runs.
+If a move fails, run the same command again to resume it, or use --abort
+to drop the partial copy and unlock the source.`,
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbMove(args, moveTo, moveDropSource, moveAbort, wait)
+		},
+	}
+	dbMoveCmd.Flags().StringVar(&moveTo, "to", "", "Target server")
+	dbMoveCmd.Flags().BoolVar(&moveDropSource, "drop-source", false, "Drop the source database after switching")
+	dbMoveCmd.Flags().BoolVar(&moveAbort, "abort", false, "Abort an in-progress move")
+
+	var resetOpts project.ResetOptions
+	dbResetCmd := &cobra.Command{
+		Use:   "reset <project> <env> [pr-number]",
+		Short: "Empty a database, keeping its user and password",
+		Long: `Drop and recreate a database, keeping its user and password, then run the
+project's init scripts, automatic migrations and seeds again. Open sessions are terminated unless
+--keep-database is used, which drops the schemas inside the database instead.`,
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbReset(args, resetOpts)
+		},
+	}
+	dbResetCmd.Flags().BoolVar(&resetOpts.KeepDatabase, "keep-database", false, "Drop all schemas instead of recreating the database")
+	dbResetCmd.Flags().BoolVar(&resetOpts.SkipSeed, "no-seed", false, "Do not run the project's init scripts, migrations and seeds")
+
+	var migrateDir string
+	var migrateSteps int
+	dbMigrateCmd := &cobra.Command{
+		Use:   "migrate <project> <env> [pr-number]",
+		Short: "Apply pending migrations to a database",
+		Long: `Apply pending migrations to a database as its owner.
+
+Migrations are files named <version>_<name>.up.sql, with optional
+<version>_<name>.down.sql files to revert them. Applied versions are recorded
+in the pgmanager_migrations table of the database. Without --dir the
+project's configured migrations directory is used.`,
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbMigrate(args, migrateDir, wait)
+		},
+	}
+	dbMigrateCmd.PersistentFlags().StringVar(&migrateDir, "dir", "", "Migrations directory")
+
+	dbMigrateStatusCmd := &cobra.Command{
+		Use:   "status <project> <env> [pr-number]",
+		Short: "Show applied and pending migrations",
+		Args:  cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbMigrateStatus(args, migrateDir)
+		},
+	}
+
+	dbMigrateDownCmd := &cobra.Command{
+		Use:   "down <project> <env> [pr-number]",
+		Short: "Revert the most recently applied migrations",
+		Args:  cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbMigrateDown(args, migrateDir, migrateSteps, wait)
+		},
+	}
+	dbMigrateDownCmd.Flags().IntVar(&migrateSteps, "steps", 1, "Number of migrations to revert")
+
+	dbMigrateCmd.AddCommand(dbMigrateStatusCmd, dbMigrateDownCmd)
+
+	var dumpOutput string
+	dbDumpCmd := &cobra.Command{
+		Use:   "dump <project> <env> [pr-number]",
+		Short: "Dump a database's schema and data to a file",
+		Args:  cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbDump(args, dumpOutput)
+		},
+	}
+	dbDumpCmd.Flags().StringVarP(&dumpOutput, "output", "o", "", "Output file, or - for stdout (required)")
+	dbDumpCmd.MarkFlagRequired("output")
+
+	var restoreInput string
+	dbRestoreCmd := &cobra.Command{
+		Use:   "restore <project> <env> [pr-number]",
+		Short: "Restore a dump into a database",
+		Long: `Restore a dump taken with "db dump" into a database of any project or environment.
+The database is created if it does not exist; an existing database must be empty.`,
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbRestore(args, restoreInput, wait)
+		},
+	}
+	dbRestoreCmd.Flags().StringVarP(&restoreInput, "input", "i", "", "Dump file, or - for stdin (required)")
+	dbRestoreCmd.MarkFlagRequired("input")
+
+	var diffJSON, diffSQL bool
+	dbDiffCmd := &cobra.Command{
+		Use:   "diff <project> <from-env> <to-env>",
+		Short: "Compare the schemas of two environments",
+		Long: `Compare the schemas of two environments of a project and list the objects
+added, removed or changed in <to-env> relative to <from-env>. PR environments
+are written as pr_<number>.
+
+With --sql a best-effort migration script that turns the schema of <from-env>
+into that of <to-env> is printed instead. Review it before running it: changes
+that cannot be expressed safely are left as comments.`,
+		Args: cobra.ExactArgs(3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbDiff(args, diffJSON, diffSQL)
+		},
+	}
+	dbDiffCmd.Flags().BoolVar(&diffJSON, "json", false, "Output the differences as JSON")
+	dbDiffCmd.Flags().BoolVar(&diffSQL, "sql", false, "Output a migration script")
+	dbDiffCmd.MarkFlagsMutuallyExclusive("json", "sql")
+
+	var execCommand, execFile, execFormat string
+	var execReadOnly bool
+	dbExecCmd := &cobra.Command{
+		Use:   "exec <project> <env> [pr-number]",
+		Short: "Run SQL against a database",
+		Long: `Run SQL against a database using its stored credentials and print the results.
+
+The SQL is given with -e or read from a file with -f (- for stdin) and may contain
+several statements. With --read-only every statement runs in a read-only transaction.`,
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return dbExec(args, execCommand, execFile, execFormat, execReadOnly)
+		},
+	}
+	dbExecCmd.Flags().StringVarP(&execCommand, "command", "e", "", "SQL to run")
+	dbExecCmd.Flags().StringVarP(&execFile, "file", "f", "", "File containing the SQL to run, or - for stdin")
+	dbExecCmd.Flags().StringVar(&execFormat, "format", "table", "Output format: table, csv or json")
+	dbExecCmd.Flags().BoolVar(&execReadOnly, "read-only", false, "Run in a read-only transaction")
+	dbExecCmd.MarkFlagsMutuallyExclusive("command", "file")
+	dbExecCmd.MarkFlagsOneRequired("command", "file")
+
+	var connectClient string
+	var connectPassFile, connectBuiltin bool
+	dbConnectCmd := &cobra.Command{
+		Use:   "connect <project> <env> [pr-number] [-- client-args...]",
+		Short: "Open an interactive session on a database",
+		Long: `Open psql, or the client set in client.command, connected to a database with its
+stored credentials. The password is passed in PGPASSWORD, or with --pgpass in a
+temporary pgpass file that is removed when the client exits; it is never put on
+the command line. Arguments after -- are passed to the client.
+
+If psql is not installed, a minimal built-in SQL shell is used instead.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+				args = args[:dash]
+			}
+			return cobra.RangeArgs(2, 3)(cmd, args)
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			var clientArgs []string
+			if dash := cmd.ArgsLenAtDash(); dash >= 0 {
+				args, clientArgs = args[:dash], args[dash:]
+			}
+			return dbConnect(args, clientArgs, connectClient, connectPassFile, connectBuiltin)
+		},
+	}
+	dbConnectCmd.Flags().StringVar(&connectClient, "client", "", "Client to run instead of psql")
+	dbConnectCmd.Flags().BoolVar(&connectPassFile, "pgpass", false, "Pass the password in a temporary pgpass file instead of PGPASSWORD")
+	dbConnectCmd.Flags().BoolVar(&connectBuiltin, "builtin", false, "Use the built-in SQL shell")
+
+	var envOpts export.Options
+	var envVars []string
+	var envWrite string
+	dbEnvCmd := &cobra.Command{
+		Use:   "env <project> <env> [pr-number]",
+		Short: "Print a database's connection details for applications",
+		Long: `Print a database's connection details as DATABASE_URL, PGHOST, PGPORT,
+PGDATABASE, PGUSER, PGPASSWORD and PGSSLMODE in one of these formats:
+
+  dotenv      KEY=value lines
+  pgpass      a ~/.pgpass entry
+  json, yaml  an object of variables
+  k8s-secret  a Kubernetes Secret (--name sets its name)
+  compose     a docker-compose environment block (--name sets the service)
+
+Variables can be prefixed with --prefix and renamed with --var, e.g.
+--var DATABASE_URL=DB_URL. With --write the output goes to a file readable
+only by its owner.`,
+		Args: cobra.RangeArgs(2, 3),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			names, err := export.ParseNames(envVars)
+			if err != nil {
+				return err
+			}
+			envOpts.Names = names
+			return dbEnv(args, envOpts, envWrite)
+		},
+	}
+	dbEnvCmd.Flags().StringVar(&envOpts.Format, "format", "dotenv", "Output format: "+strings.Join(export.Formats, ", "))
+	dbEnvCmd.Flags().StringVar(&envOpts.Prefix, "prefix", "", "Prefix for every variable name")
+	dbEnvCmd.Flags().StringArrayVar(&envVars, "var", nil, "Rename a variable, as NAME=NEW_NAME (repeatable)")
+	dbEnvCmd.Flags().StringVar(&envOpts.Name, "name", "", "Secret name (k8s-secret) or service name (compose)")
+	dbEnvCmd.Flags().StringVarP(&envWrite, "write", "w", "", "Write to a file with mode 0600 instead of stdout")
+
+	dbCmd.AddCommand(dbCreateCmd, dbDeleteCmd, dbListCmd, dbInfoCmd, dbSessionsCmd, dbKillCmd, dbMoveCmd,
+		dbResetCmd, dbMigrateCmd, dbDumpCmd, dbRestoreCmd, dbDiffCmd, dbExecCmd, dbConnectCmd, dbEnvCmd)
 
 	// Cleanup command
 	var olderThan string
@@ -126,11 +404,82 @@ func main() {
 		Use:   "cleanup",
 		Short: "Clean up old PR databases",
 		RunE: func(cmd *cobra.Command, args []string) error {
-			return cleanup(olderThan)
+			return cleanup(olderThan, wait)
 		},
 	}
 	cleanupCmd.Flags().StringVar(&olderThan, "older-than", "7d", "Delete PR databases older than this duration (e.g., 7d, 24h)")
 
+	// Manifest commands
+	var manifestFile string
+	var prune bool
+	planCmd := &cobra.Command{
+		Use:   "plan",
+		Short: "Show the changes needed to match a project manifest",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return planManifest(manifestFile, prune)
+		},
+	}
+	applyCmd := &cobra.Command{
+		Use:   "apply",
+		Short: "Create and update projects and databases to match a project manifest",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return applyManifest(manifestFile, prune)
+		},
+	}
+	for _, c := range []*cobra.Command{planCmd, applyCmd} {
+		c.Flags().StringVarP(&manifestFile, "file", "f", manifest.DefaultFile, "Manifest file")
+		c.Flags().BoolVar(&prune, "prune", false, "Delete projects, databases and roles missing from the manifest")
+	}
+
+	// Backup commands
+	backupCmd := &cobra.Command{
+		Use:   "backup",
+		Short: "Manage database backups",
+	}
+
+	backupListCmd := &cobra.Command{
+		Use:   "list [project] [env] [pr-number]",
+		Short: "List backups, optionally of one database",
+		Args:  cobra.MaximumNArgs(3),
+		RunE:  backupList,
+	}
+
+	backupRunCmd := &cobra.Command{
+		Use:   "run [project env [pr-number]]",
+		Short: "Back up one database, or every scheduled environment",
+		Long: `Back up a single database, or with no arguments back up every database of
+the environments with a backup schedule and prune backups outside retention.`,
+		Args: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 || len(args) > 3 {
+				return fmt.Errorf("expected no arguments or <project> <env> [pr-number]")
+			}
+			return nil
+		},
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return backupRun(args, wait)
+		},
+	}
+
+	backupRestoreCmd := &cobra.Command{
+		Use:   "restore <backup-id> <project> <env> [pr-number]",
+		Short: "Restore a backup into a database",
+		Long: `Restore a backup into a database of any project or environment.
+The database is created if it does not exist; an existing database must be empty.`,
+		Args: cobra.RangeArgs(3, 4),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return backupRestore(args, wait)
+		},
+	}
+
+	// Apply always waits, since the role passwords it creates are only shown once
+	for _, c := range []*cobra.Command{dbMoveCmd, dbMigrateCmd, dbMigrateDownCmd, dbRestoreCmd, cleanupCmd, backupRunCmd, backupRestoreCmd} {
+		c.Flags().BoolVar(&wait, "wait", true, "Wait for the operation to finish; --wait=false starts it as a job on the server and prints its ID")
+	}
+
+	backupCmd.AddCommand(backupListCmd, backupRunCmd, backupRestoreCmd)
+
 	// Serve command
 	var port int
 	serveCmd := &cobra.Command{
@@ -165,10 +514,259 @@ func main() {
 		RunE:  runInit,
 	}
 
-	rootCmd.AddCommand(projectCmd, dbCmd, cleanupCmd, serveCmd, tuiCmd, versionCmd, initCmd)
+	// Token commands
+	tokenCmd := &cobra.Command{
+		Use:   "token",
+		Short: "Manage API tokens",
+	}
+
+	var tokenScopes, tokenProjects []string
+	var tokenExpires string
+	tokenCreateCmd := &cobra.Command{
+		Use:   "create <name>",
+		Short: "Create an API token",
+		Long: `Create an API token for the server. The token is printed once and only its
+hash is stored. Scopes are read, create, delete and admin; admin grants all.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return tokenCreate(args[0], tokenScopes, tokenProjects, tokenExpires)
+		},
+	}
+	tokenCreateCmd.Flags().StringSliceVar(&tokenScopes, "scope", []string{"read"}, "Scopes to grant (read, create, delete, admin)")
+	tokenCreateCmd.Flags().StringSliceVar(&tokenProjects, "project", nil, "Limit the token to these projects")
+	tokenCreateCmd.Flags().StringVar(&tokenExpires, "expires", "", "Expire the token after this duration (e.g., 90d); never by default")
+
+	tokenListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List API tokens",
+		Args:  cobra.NoArgs,
+		RunE:  tokenList,
+	}
+
+	tokenRevokeCmd := &cobra.Command{
+		Use:   "revoke <name>",
+		Short: "Revoke an API token",
+		Args:  cobra.ExactArgs(1),
+		RunE:  tokenRevoke,
+	}
+
+	tokenCmd.AddCommand(tokenCreateCmd, tokenListCmd, tokenRevokeCmd)
+
+	// Access commands
+	accessCmd := &cobra.Command{
+		Use:   "access",
+		Short: "Manage project roles of tokens and users",
+	}
+
+	accessGrantCmd := &cobra.Command{
+		Use:   "grant <project> <subject> <role>",
+		Short: "Grant a token or user a role on a project",
+		Long: `Grant a subject, such as a token name, a role on a project, replacing the role
+it had. Roles are viewer, developer, maintainer and admin. Once bound to a role,
+a subject can only reach the projects it has a role on.`,
+		Args: cobra.ExactArgs(3),
+		RunE: accessGrant,
+	}
+
+	accessRevokeCmd := &cobra.Command{
+		Use:   "revoke <project> <subject>",
+		Short: "Remove the role of a token or user on a project",
+		Args:  cobra.ExactArgs(2),
+		RunE:  accessRevoke,
+	}
+
+	accessListCmd := &cobra.Command{
+		Use:   "list [project]",
+		Short: "List roles, optionally of one project",
+		Args:  cobra.MaximumNArgs(1),
+		RunE:  accessList,
+	}
+
+	accessCmd.AddCommand(accessGrantCmd, accessRevokeCmd, accessListCmd)
+
+	// Audit commands
+	auditCmd := &cobra.Command{
+		Use:   "audit",
+		Short: "Inspect the log of mutating operations",
+	}
+
+	var auditFilter meta.AuditFilter
+	var auditSince, auditUntil string
+	auditListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List audit events, newest first",
+		Long: `List who created, deleted, reset or otherwise changed what, from where and with
+which outcome. Times are RFC 3339 or durations before now, such as 24h or 7d.`,
+		Args: cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return auditList(auditFilter, auditSince, auditUntil)
+		},
+	}
+	auditListCmd.Flags().StringVar(&auditFilter.Project, "project", "", "Only events of this project")
+	auditListCmd.Flags().StringVar(&auditFilter.Actor, "actor", "", "Only events of this token, user or scheduler")
+	auditListCmd.Flags().StringVar(&auditFilter.Action, "action", "", "Only this action (e.g., database.delete) or kind of action (e.g., database)")
+	auditListCmd.Flags().StringVar(&auditSince, "since", "", "Only events since this time (e.g., 7d or 2024-05-01T00:00:00Z)")
+	auditListCmd.Flags().StringVar(&auditUntil, "until", "", "Only events before this time")
+	auditListCmd.Flags().Int64Var(&auditFilter.BeforeID, "before", 0, "Only events older than this event ID, to page through results")
+	auditListCmd.Flags().IntVar(&auditFilter.Limit, "limit", 50, "Maximum number of events")
+
+	auditCmd.AddCommand(auditListCmd)
+
+	// Job commands
+	jobCmd := &cobra.Command{
+		Use:   "job",
+		Short: "Follow and cancel operations running in the background on the server",
+	}
+
+	var jobFilter meta.JobFilter
+	jobListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List jobs, newest first",
+		Args:  cobra.NoArgs,
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return jobList(jobFilter)
+		},
+	}
+	jobListCmd.Flags().StringVar(&jobFilter.Project, "project", "", "Only jobs of this project")
+	jobListCmd.Flags().StringVar(&jobFilter.Status, "status", "", "Only jobs with this status (queued, running, succeeded, failed, canceled)")
+	jobListCmd.Flags().IntVar(&jobFilter.Limit, "limit", 50, "Maximum number of jobs")
+
+	var jobWait bool
+	jobShowCmd := &cobra.Command{
+		Use:   "show <id>",
+		Short: "Show a job and its log",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return jobShow(args[0], jobWait)
+		},
+	}
+	jobShowCmd.Flags().BoolVar(&jobWait, "wait", false, "Follow the job until it finishes and fail if it does not succeed")
+
+	jobCancelCmd := &cobra.Command{
+		Use:   "cancel <id>",
+		Short: "Cancel a queued or running job",
+		Long: `Cancel a queued or running job. A running job stops at the next database it
+would process; the work it finished is kept.`,
+		Args: cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			return jobCancel(args[0])
+		},
+	}
+
+	jobCmd.AddCommand(jobListCmd, jobShowCmd, jobCancelCmd)
+
+	// Webhook commands
+	webhookCmd := &cobra.Command{
+		Use:   "webhook",
+		Short: "Manage webhooks notified of lifecycle events",
+	}
+
+	var webhookOpts project.WebhookOptions
+	webhookAddCmd := &cobra.Command{
+		Use:   "add <name> <url>",
+		Short: "Subscribe a URL to lifecycle events",
+		Long: `Subscribe a URL to project and database lifecycle events. 'serve' POSTs each
+event as JSON signed with HMAC-SHA256 in the X-Pgmanager-Signature-256 header,
+retrying failed deliveries with exponential backoff. Events are project.created,
+project.deleted, database.created, database.deleted and database.expiring.`,
+		Args: cobra.ExactArgs(2),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			webhookOpts.Name, webhookOpts.URL = args[0], args[1]
+			return webhookAdd(webhookOpts)
+		},
+	}
+	webhookAddCmd.Flags().StringSliceVar(&webhookOpts.Events, "event", nil, "Only deliver these events; all by default")
+	webhookAddCmd.Flags().StringSliceVar(&webhookOpts.Projects, "project", nil, "Only deliver events of these projects; all by default")
+	webhookAddCmd.Flags().StringVar(&webhookOpts.Secret, "secret", "", "Secret signing the payloads; generated by default")
+
+	var webhookLimit int
+	webhookListCmd := &cobra.Command{
+		Use:   "list [name]",
+		Short: "List webhooks, or the recent deliveries of one",
+		Args:  cobra.MaximumNArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			if len(args) == 1 {
+				return webhookDeliveries(args[0], webhookLimit)
+			}
+			return webhookList()
+		},
+	}
+	webhookListCmd.Flags().IntVar(&webhookLimit, "limit", 20, "Maximum number of deliveries")
+
+	webhookTestCmd := &cobra.Command{
+		Use:   "test <name>",
+		Short: "Send a ping event to a webhook",
+		Args:  cobra.ExactArgs(1),
+		RunE:  webhookTest,
+	}
+
+	webhookRemoveCmd := &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Remove a webhook and its deliveries",
+		Args:  cobra.ExactArgs(1),
+		RunE:  webhookRemove,
+	}
+
+	webhookCmd.AddCommand(webhookAddCmd, webhookListCmd, webhookTestCmd, webhookRemoveCmd)
+
+	// Context commands
+	contextCmd := &cobra.Command{
+		Use:   "context",
+		Short: "Manage named contexts for switching between installations",
+	}
+
+	contextListCmd := &cobra.Command{
+		Use:   "list",
+		Short: "List contexts",
+		Args:  cobra.NoArgs,
+		RunE:  contextList,
+	}
+
+	contextUseCmd := &cobra.Command{
+		Use:   "use <name>",
+		Short: "Make a context the current one",
+		Args:  cobra.ExactArgs(1),
+		RunE:  contextUse,
+	}
+
+	var newContext config.Context
+	contextAddCmd := &cobra.Command{
+		Use:   "add <name>",
+		Short: "Add a context for a config file (--config) or a pgmanager server (--server)",
+		Args:  cobra.ExactArgs(1),
+		RunE: func(cmd *cobra.Command, args []string) error {
+			newContext.Name = args[0]
+			return contextAdd(newContext)
+		},
+	}
+	contextAddCmd.Flags().StringVar(&newContext.Config, "config", "", "Config file for direct access to PostgreSQL")
+	contextAddCmd.Flags().StringVar(&newContext.Server, "server", "", "pgmanager server URL")
+	contextAddCmd.Flags().StringVar(&newContext.Token, "token", "", "API token for the server")
+	contextAddCmd.Flags().StringVar(&newContext.Project, "project", "", "Project used when a command's project argument is omitted")
+	contextAddCmd.MarkFlagsMutuallyExclusive("config", "server")
+
+	contextRemoveCmd := &cobra.Command{
+		Use:   "remove <name>",
+		Short: "Remove a context",
+		Args:  cobra.ExactArgs(1),
+		RunE:  contextRemove,
+	}
+
+	contextCurrentCmd := &cobra.Command{
+		Use:   "current",
+		Short: "Print the name of the context in use, for shell prompts",
+		Args:  cobra.NoArgs,
+		RunE:  contextCurrent,
+	}
+
+	contextCmd.AddCommand(contextListCmd, contextUseCmd, contextAddCmd, contextRemoveCmd, contextCurrentCmd)
 
+	rootCmd.AddCommand(projectCmd, dbCmd, cleanupCmd, planCmd, applyCmd, backupCmd, tokenCmd, accessCmd, auditCmd, jobCmd, webhookCmd, contextCmd, serveCmd, tuiCmd, versionCmd, initCmd)
+
+	useDefaultProject(rootCmd)
+	markUsageErrors(rootCmd)
 	if err := rootCmd.Execute(); err != nil {
-		os.Exit(1)
+		os.Exit(exitCode(err))
 	}
 }
 
@@ -180,7 +778,14 @@ func getStore(ctx context.Context) (meta.Store, error) {
 	return store, nil
 }
 
-func getManager(ctx context.Context) (*project.Manager, meta.Store, error) {
+// getManager returns the service commands run against: a client of the pgmanager
+// server in remote mode, otherwise a manager connected to PostgreSQL
+func getManager(ctx context.Context) (project.Service, io.Closer, error) {
+	if cfg.Remote.Server != "" {
+		c := client.New(cfg.Remote.Server, cfg.Remote.Token)
+		return c, c, nil
+	}
+
 	store, err := getStore(ctx)
 	if err != nil {
 		return nil, nil, err
@@ -198,12 +803,13 @@ func projectCreate(cmd *cobra.Command, args []string) error {
 	}
 	defer store.Close()
 
-	if err := mgr.CreateProject(ctx, args[0]); err != nil {
+	p, err := mgr.CreateProject(ctx, args[0])
+	if err != nil {
 		return err
 	}
-
-	fmt.Printf("Project '%s' created successfully\n", args[0])
-	return nil
+	return render(api.NewProjectResponse(*p), []string{p.Name}, func(bool) {
+		notify("Project '%s' created successfully\n", p.Name)
+	})
 }
 
 func projectList(cmd *cobra.Command, args []string) error {
@@ -219,18 +825,25 @@ func projectList(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	if len(projects) == 0 {
-		fmt.Println("No projects found")
-		return nil
+	response := make([]api.ProjectResponse, len(projects))
+	names := make([]string, len(projects))
+	for i, p := range projects {
+		response[i] = api.NewProjectResponse(p)
+		names[i] = p.Name
 	}
 
-	fmt.Printf("%-20s %-20s\n", "NAME", "CREATED")
-	fmt.Println(strings.Repeat("-", 42))
-	for _, p := range projects {
-		fmt.Printf("%-20s %-20s\n", p.Name, p.CreatedAt.Format("2006-01-02 15:04"))
-	}
+	return render(response, names, func(bool) {
+		if len(projects) == 0 {
+			notify("No projects found\n")
+			return
+		}
 
-	return nil
+		fmt.Printf("%-20s %-20s\n", "NAME", "CREATED")
+		fmt.Println(strings.Repeat("-", 42))
+		for _, p := range projects {
+			fmt.Printf("%-20s %-20s\n", p.Name, p.CreatedAt.Format("2006-01-02 15:04"))
+		}
+	})
 }
 
 func projectDelete(cmd *cobra.Command, args []string) error {
@@ -245,11 +858,11 @@ func projectDelete(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	fmt.Printf("Project '%s' deleted successfully\n", args[0])
+	notify("Project '%s' deleted successfully\n", args[0])
 	return nil
 }
 
-func dbCreate(cmd *cobra.Command, args []string) error {
+func dbCreate(args []string, server string) error {
 	ctx := context.Background()
 	mgr, store, err := getManager(ctx)
 	if err != nil {
@@ -258,34 +871,26 @@ func dbCreate(cmd *cobra.Command, args []string) error {
 	defer store.Close()
 
 	projectName := args[0]
-	env := args[1]
-
-	var prNumber *int
-	if env == "pr" {
-		if len(args) < 3 {
-			return fmt.Errorf("PR number is required for PR databases")
-		}
-		num, err := strconv.Atoi(args[2])
-		if err != nil {
-			return fmt.Errorf("invalid PR number: %s", args[2])
-		}
-		prNumber = &num
+	env, prNumber, err := parseEnvArgs(args)
+	if err != nil {
+		return err
 	}
 
-	info, err := mgr.CreateDatabase(ctx, projectName, env, prNumber)
+	info, err := mgr.CreateDatabase(ctx, projectName, env, prNumber, server)
 	if err != nil {
 		return err
 	}
 
-	fmt.Printf("Database created successfully\n")
-	fmt.Printf("  Database: %s\n", info.DatabaseName)
-	fmt.Printf("  User:     %s\n", info.UserName)
-	fmt.Printf("  Password: %s\n", info.Password)
-	fmt.Printf("  Host:     %s\n", info.Host)
-	fmt.Printf("  Port:     %d\n", info.Port)
-	fmt.Printf("\nConnection string:\n  %s\n", info.ConnString)
-
-	return nil
+	return render(api.NewDatabaseResponse(info), []string{info.DatabaseName}, func(bool) {
+		notify("Database created successfully\n")
+		fmt.Printf("  Database: %s\n", info.DatabaseName)
+		fmt.Printf("  User:     %s\n", info.UserName)
+		fmt.Printf("  Password: %s\n", info.Password)
+		fmt.Printf("  Server:   %s\n", info.Server)
+		fmt.Printf("  Host:     %s\n", info.Host)
+		fmt.Printf("  Port:     %d\n", info.Port)
+		fmt.Printf("\nConnection string:\n  %s\n", info.ConnString)
+	})
 }
 
 func dbDelete(cmd *cobra.Command, args []string) error {
@@ -297,25 +902,16 @@ func dbDelete(cmd *cobra.Command, args []string) error {
 	defer store.Close()
 
 	projectName := args[0]
-	env := args[1]
-
-	var prNumber *int
-	if env == "pr" {
-		if len(args) < 3 {
-			return fmt.Errorf("PR number is required for PR databases")
-		}
-		num, err := strconv.Atoi(args[2])
-		if err != nil {
-			return fmt.Errorf("invalid PR number: %s", args[2])
-		}
-		prNumber = &num
+	env, prNumber, err := parseEnvArgs(args)
+	if err != nil {
+		return err
 	}
 
 	if err := mgr.DeleteDatabase(ctx, projectName, env, prNumber); err != nil {
 		return err
 	}
 
-	fmt.Println("Database deleted successfully")
+	notify("Database deleted successfully\n")
 	return nil
 }
 
@@ -337,23 +933,41 @@ func dbList(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	if len(databases) == 0 {
-		fmt.Println("No databases found")
-		return nil
+	response := make([]api.DatabaseInfoResponse, len(databases))
+	names := make([]string, len(databases))
+	for i := range databases {
+		response[i] = api.NewDatabaseInfoResponse(&databases[i])
+		names[i] = databases[i].DatabaseName
 	}
 
-	fmt.Printf("%-15s %-10s %-25s %-20s\n", "PROJECT", "ENV", "DATABASE", "CREATED")
-	fmt.Println(strings.Repeat("-", 72))
-	for _, db := range databases {
-		envStr := db.Env
-		if db.PRNumber != nil {
-			envStr = fmt.Sprintf("pr_%d", *db.PRNumber)
+	return render(response, names, func(wide bool) {
+		if len(databases) == 0 {
+			notify("No databases found\n")
+			return
 		}
-		fmt.Printf("%-15s %-10s %-25s %-20s\n",
-			db.Project, envStr, db.DatabaseName, db.CreatedAt.Format("2006-01-02 15:04"))
-	}
 
-	return nil
+		header := fmt.Sprintf("%-15s %-10s %-25s %-12s %-20s", "PROJECT", "ENV", "DATABASE", "SERVER", "CREATED")
+		width := 85
+		if wide {
+			header += fmt.Sprintf(" %-30s %-25s %-20s %-20s", "USER", "HOST", "EXPIRES", "LAST ACTIVITY")
+			width += 98
+		}
+		fmt.Println(header)
+		fmt.Println(strings.Repeat("-", width))
+		for _, db := range databases {
+			envStr := db.Env
+			if db.PRNumber != nil {
+				envStr = fmt.Sprintf("pr_%d", *db.PRNumber)
+			}
+			line := fmt.Sprintf("%-15s %-10s %-25s %-12s %-20s",
+				db.Project, envStr, db.DatabaseName, db.Server, db.CreatedAt.Format("2006-01-02 15:04"))
+			if wide {
+				line += fmt.Sprintf(" %-30s %-25s %-20s %-20s", db.UserName, fmt.Sprintf("%s:%d", db.Host, db.Port),
+					formatOptionalTime(db.ExpiresAt), formatOptionalTime(db.LastActivity))
+			}
+			fmt.Println(strings.TrimRight(line, " "))
+		}
+	})
 }
 
 func dbInfo(cmd *cobra.Command, args []string) error {
@@ -365,18 +979,9 @@ func dbInfo(cmd *cobra.Command, args []string) error {
 	defer store.Close()
 
 	projectName := args[0]
-	env := args[1]
-
-	var prNumber *int
-	if env == "pr" {
-		if len(args) < 3 {
-			return fmt.Errorf("PR number is required for PR databases")
-		}
-		num, err := strconv.Atoi(args[2])
-		if err != nil {
-			return fmt.Errorf("invalid PR number: %s", args[2])
-		}
-		prNumber = &num
+	env, prNumber, err := parseEnvArgs(args)
+	if err != nil {
+		return err
 	}
 
 	info, err := mgr.GetDatabase(ctx, projectName, env, prNumber)
@@ -384,20 +989,28 @@ func dbInfo(cmd *cobra.Command, args []string) error {
 		return err
 	}
 
-	fmt.Printf("Database: %s\n", info.DatabaseName)
-	fmt.Printf("User:     %s\n", info.UserName)
-	fmt.Printf("Host:     %s\n", info.Host)
-	fmt.Printf("Port:     %d\n", info.Port)
-	fmt.Printf("Created:  %s\n", info.CreatedAt.Format("2006-01-02 15:04:05"))
-	if info.ExpiresAt != nil {
-		fmt.Printf("Expires:  %s\n", info.ExpiresAt.Format("2006-01-02 15:04:05"))
-	}
-	fmt.Println("\nNote: Password and connection string are only shown when the database is created.")
-
-	return nil
+	return render(api.NewDatabaseInfoResponse(info), []string{info.DatabaseName}, func(bool) {
+		fmt.Printf("Database: %s\n", info.DatabaseName)
+		fmt.Printf("User:     %s\n", info.UserName)
+		fmt.Printf("Server:   %s\n", info.Server)
+		fmt.Printf("Host:     %s\n", info.Host)
+		fmt.Printf("Port:     %d\n", info.Port)
+		fmt.Printf("Created:  %s\n", info.CreatedAt.Format("2006-01-02 15:04:05"))
+		if info.ExpiresAt != nil {
+			fmt.Printf("Expires:  %s\n", info.ExpiresAt.Format("2006-01-02 15:04:05"))
+		}
+		if info.LastActivity != nil {
+			fmt.Printf("Active:   %s\n", info.LastActivity.Format("2006-01-02 15:04:05"))
+		}
+		if info.Protected {
+			fmt.Printf("Protected: yes\n")
+		}
+		notify("\nNote: Password and connection string are only shown when the database is created.\n")
+		notify("Use 'pgmanager db connect' to open a session with the stored credentials.\n")
+	})
 }
 
-func cleanup(olderThan string) error {
+func dbSessions(cmd *cobra.Command, args []string) error {
 	ctx := context.Background()
 	mgr, store, err := getManager(ctx)
 	if err != nil {
@@ -405,54 +1018,839 @@ func cleanup(olderThan string) error {
 	}
 	defer store.Close()
 
-	duration, err := parseDuration(olderThan)
+	projectName := args[0]
+	env, prNumber, err := parseEnvArgs(args)
 	if err != nil {
-		return fmt.Errorf("invalid duration: %w", err)
+		return err
 	}
 
-	deleted, err := mgr.Cleanup(ctx, duration)
+	sessions, err := mgr.ListSessions(ctx, projectName, env, prNumber)
 	if err != nil {
 		return err
 	}
 
-	if len(deleted) == 0 {
-		fmt.Println("No databases to clean up")
-	} else {
-		fmt.Printf("Deleted %d database(s):\n", len(deleted))
-		for _, name := range deleted {
-			fmt.Printf("  - %s\n", name)
-		}
+	response := make([]api.SessionResponse, len(sessions))
+	pids := make([]string, len(sessions))
+	for i, sess := range sessions {
+		response[i] = api.NewSessionResponse(sess)
+		pids[i] = strconv.Itoa(sess.PID)
 	}
 
-	return nil
+	return render(response, pids, func(wide bool) {
+		if len(sessions) == 0 {
+			notify("No sessions found\n")
+			return
+		}
+
+		fmt.Printf("%-8s %-20s %-16s %-20s %-20s %s\n", "PID", "USER", "CLIENT", "STATE", "QUERY START", "QUERY")
+		fmt.Println(strings.Repeat("-", 120))
+		for _, s := range sessions {
+			queryStart := ""
+			if s.QueryStart != nil {
+				queryStart = s.QueryStart.Format("2006-01-02 15:04:05")
+			}
+			query := s.Query
+			if !wide {
+				query = truncate(query, 40)
+			}
+			fmt.Printf("%-8d %-20s %-16s %-20s %-20s %s\n",
+				s.PID, s.User, s.ClientAddr, s.State, queryStart, query)
+		}
+	})
 }
 
-func serve(port int) error {
+func dbKill(args []string, pid int, all bool) error {
+	if (pid == 0 && !all) || (pid != 0 && all) {
+		return fmt.Errorf("specify either --pid or --all")
+	}
+
 	ctx := context.Background()
-	store, err := getStore(ctx)
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	projectName := args[0]
+	env, prNumber, err := parseEnvArgs(args)
 	if err != nil {
 		return err
 	}
 
-	mgr := project.NewManager(cfg, store)
-	server := api.NewServer(cfg, mgr, port)
+	n, err := mgr.KillSessions(ctx, projectName, env, prNumber, pid)
+	if err != nil {
+		return err
+	}
 
-	fmt.Printf("Starting API server on port %d\n", port)
-	return server.Start()
+	fmt.Printf("Terminated %d session(s)\n", n)
+	return nil
 }
 
-func runTUI(cmd *cobra.Command, args []string) error {
+func dbReset(args []string, opts project.ResetOptions) error {
 	ctx := context.Background()
-	store, err := getStore(ctx)
+	mgr, store, err := getManager(ctx)
 	if err != nil {
 		return err
 	}
 	defer store.Close()
 
+	projectName := args[0]
+	env, prNumber, err := parseEnvArgs(args)
+	if err != nil {
+		return err
+	}
+
+	if err := mgr.ResetDatabase(ctx, projectName, env, prNumber, opts); err != nil {
+		return err
+	}
+
+	notify("Database reset successfully\n")
+	return nil
+}
+
+func dbMigrate(args []string, dir string, wait bool) error {
+	env, prNumber, err := parseEnvArgs(args)
+	if err != nil {
+		return err
+	}
+	if !wait {
+		if dir != "" {
+			return errJobMigrationsDir
+		}
+		return startJob(project.JobRequest{Kind: project.JobMigrate, Project: args[0], Env: env, PRNumber: prNumber})
+	}
+
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	applied, err := mgr.Migrate(ctx, args[0], env, prNumber, dir)
+	for _, m := range applied {
+		fmt.Printf("Applied %d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(applied) == 0 {
+		fmt.Println("No pending migrations")
+	}
+	return nil
+}
+
+func dbMigrateStatus(args []string, dir string) error {
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	env, prNumber, err := parseEnvArgs(args)
+	if err != nil {
+		return err
+	}
+
+	statuses, err := mgr.MigrationStatus(ctx, args[0], env, prNumber, dir)
+	if err != nil {
+		return err
+	}
+
+	if len(statuses) == 0 {
+		fmt.Println("No migrations found")
+		return nil
+	}
+
+	fmt.Printf("%-10s %-35s %-20s\n", "VERSION", "NAME", "APPLIED")
+	fmt.Println(strings.Repeat("-", 67))
+	for _, s := range statuses {
+		applied := "pending"
+		if s.AppliedAt != nil {
+			applied = s.AppliedAt.Local().Format("2006-01-02 15:04")
+		}
+		if s.Missing {
+			applied += " (file missing)"
+		}
+		fmt.Printf("%-10d %-35s %-20s\n", s.Version, truncate(s.Name, 35), applied)
+	}
+
+	return nil
+}
+
+func dbMigrateDown(args []string, dir string, steps int, wait bool) error {
+	env, prNumber, err := parseEnvArgs(args)
+	if err != nil {
+		return err
+	}
+	if !wait {
+		if dir != "" {
+			return errJobMigrationsDir
+		}
+		return startJob(project.JobRequest{Kind: project.JobMigrateDown, Project: args[0], Env: env, PRNumber: prNumber, Steps: steps})
+	}
+
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	reverted, err := mgr.MigrateDown(ctx, args[0], env, prNumber, dir, steps)
+	for _, m := range reverted {
+		fmt.Printf("Reverted %d_%s\n", m.Version, m.Name)
+	}
+	if err != nil {
+		return err
+	}
+
+	if len(reverted) == 0 {
+		fmt.Println("No applied migrations")
+	}
+	return nil
+}
+
+func dbDump(args []string, output string) error {
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	projectName := args[0]
+	env, prNumber, err := parseEnvArgs(args)
+	if err != nil {
+		return err
+	}
+
+	out := os.Stdout
+	if output != "-" {
+		f, err := os.Create(output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %w", output, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	stats, err := mgr.DumpDatabase(ctx, projectName, env, prNumber, out)
+	if err != nil {
+		if output != "-" {
+			os.Remove(output)
+		}
+		return err
+	}
+	if out != os.Stdout {
+		if err := out.Close(); err != nil {
+			return fmt.Errorf("failed to write %s: %w", output, err)
+		}
+	}
+
+	fmt.Fprintf(os.Stderr, "Dumped %d table(s), %d row(s)\n", stats.Tables, stats.Rows)
+	return nil
+}
+
+func dbRestore(args []string, input string, wait bool) error {
+	projectName := args[0]
+	env, prNumber, err := parseEnvArgs(args)
+	if err != nil {
+		return err
+	}
+
+	in := os.Stdin
+	if input != "-" {
+		f, err := os.Open(input)
+		if err != nil {
+			return fmt.Errorf("failed to open %s: %w", input, err)
+		}
+		defer f.Close()
+		in = f
+	}
+	if !wait {
+		return startJob(project.JobRequest{Kind: project.JobRestore, Project: projectName, Env: env, PRNumber: prNumber, Dump: in})
+	}
+
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	result, err := mgr.RestoreDatabase(ctx, projectName, env, prNumber, in)
+	if err != nil {
+		return err
+	}
+
+	if result.Created {
+		fmt.Printf("Created database %s\n", result.DatabaseName)
+	}
+	fmt.Printf("Restored %d table(s), %d row(s) from %s into %s\n", result.Tables, result.Rows, result.Source, result.DatabaseName)
+	return nil
+}
+
+func dbDiff(args []string, asJSON, asSQL bool) error {
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	fromEnv, fromPR, err := project.ParseEnv(args[1])
+	if err != nil {
+		return err
+	}
+	toEnv, toPR, err := project.ParseEnv(args[2])
+	if err != nil {
+		return err
+	}
+
+	diff, err := mgr.DiffDatabases(ctx, args[0], fromEnv, fromPR, toEnv, toPR)
+	if err != nil {
+		return err
+	}
+
+	switch {
+	case asJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(diff)
+	case asSQL:
+		fmt.Print(diff.SQL())
+	case diff.Empty():
+		fmt.Println("Schemas are identical")
+	default:
+		fmt.Print(diff.Text())
+	}
+	return nil
+}
+
+func dbExec(args []string, command, file, format string, readOnly bool) error {
+	if format != "table" && format != "csv" && format != "json" {
+		return fmt.Errorf("invalid format '%s', must be one of: table, csv, json", format)
+	}
+
+	script := command
+	if file != "" {
+		var data []byte
+		var err error
+		if file == "-" {
+			data, err = io.ReadAll(os.Stdin)
+		} else {
+			data, err = os.ReadFile(file)
+		}
+		if err != nil {
+			return fmt.Errorf("failed to read SQL: %w", err)
+		}
+		script = string(data)
+	}
+
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	env, prNumber, err := parseEnvArgs(args)
+	if err != nil {
+		return err
+	}
+
+	results, err := mgr.QueryDatabase(ctx, args[0], env, prNumber, script, db.QueryOptions{ReadOnly: readOnly})
+	// Print what completed before a failing statement
+	if format == "json" {
+		if results == nil {
+			results = []db.QueryResult{}
+		}
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		if encErr := enc.Encode(results); encErr != nil {
+			return encErr
+		}
+	} else {
+		for i, result := range results {
+			if i > 0 && format == "table" {
+				fmt.Println()
+			}
+			if err := printQueryResult(result, format); err != nil {
+				return err
+			}
+		}
+	}
+	return err
+}
+
+// printQueryResult prints the rows of a statement as an aligned table or as CSV.
+// Statements without rows print their command tag in table format.
+func printQueryResult(result db.QueryResult, format string) error {
+	if result.Columns == nil {
+		if format == "table" {
+			fmt.Println(result.Command)
+		}
+		return nil
+	}
+
+	rows := make([][]string, len(result.Rows))
+	for i, row := range result.Rows {
+		rows[i] = make([]string, len(row))
+		for j, v := range row {
+			rows[i][j] = formatValue(v, format)
+		}
+	}
+
+	if format == "csv" {
+		w := csv.NewWriter(os.Stdout)
+		w.Write(result.Columns)
+		w.WriteAll(rows)
+		return w.Error()
+	}
+
+	widths := make([]int, len(result.Columns))
+	for i, c := range result.Columns {
+		widths[i] = len(c)
+	}
+	for _, row := range rows {
+		for i, v := range row {
+			widths[i] = max(widths[i], len(v))
+		}
+	}
+	printRow := func(values []string) {
+		cells := make([]string, len(values))
+		for i, v := range values {
+			cells[i] = fmt.Sprintf("%-*s", widths[i], v)
+		}
+		fmt.Println(strings.TrimRight(strings.Join(cells, " | "), " "))
+	}
+	separators := make([]string, len(widths))
+	for i, w := range widths {
+		separators[i] = strings.Repeat("-", w)
+	}
+
+	printRow(result.Columns)
+	fmt.Println(strings.Join(separators, "-+-"))
+	for _, row := range rows {
+		printRow(row)
+	}
+	fmt.Printf("(%d rows", len(rows))
+	if result.Truncated {
+		fmt.Print(", truncated")
+	}
+	fmt.Println(")")
+	return nil
+}
+
+// formatValue renders a query value for table or CSV output. NULL is shown as
+// "NULL" in tables and as an empty field in CSV.
+func formatValue(v any, format string) string {
+	switch v := v.(type) {
+	case nil:
+		if format == "csv" {
+			return ""
+		}
+		return "NULL"
+	case json.RawMessage:
+		return string(v)
+	case map[string]any, []any:
+		// JSON values decoded from a remote server's response
+		out, _ := json.Marshal(v)
+		return string(out)
+	default:
+		return fmt.Sprint(v)
+	}
+}
+
+func dbEnv(args []string, opts export.Options, path string) error {
+	if err := opts.Validate(); err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	env, prNumber, err := parseEnvArgs(args)
+	if err != nil {
+		return err
+	}
+
+	info, err := databaseCredentials(ctx, mgr, args[0], env, prNumber)
+	if err != nil {
+		return err
+	}
+
+	out, err := export.Render(info.Connection(), opts)
+	if err != nil {
+		return err
+	}
+
+	if path == "" {
+		_, err = os.Stdout.Write(out)
+		return err
+	}
+
+	f, err := os.OpenFile(path, os.O_WRONLY|os.O_CREATE|os.O_TRUNC, 0600)
+	if err != nil {
+		return err
+	}
+	// OpenFile keeps the mode of an existing file
+	if err := f.Chmod(0600); err != nil {
+		f.Close()
+		return err
+	}
+	if _, err := f.Write(out); err != nil {
+		f.Close()
+		return err
+	}
+	if err := f.Close(); err != nil {
+		return err
+	}
+
+	fmt.Fprintf(os.Stderr, "Wrote %s\n", path)
+	return nil
+}
+
+func backupList(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	var projectName, env string
+	var prNumber *int
+	if len(args) == 1 {
+		return fmt.Errorf("specify both project and env")
+	}
+	if len(args) >= 2 {
+		projectName = args[0]
+		if env, prNumber, err = parseEnvArgs(args); err != nil {
+			return err
+		}
+	}
+
+	backups, err := mgr.ListBackups(ctx, projectName, env, prNumber)
+	if err != nil {
+		return err
+	}
+
+	response := make([]api.BackupResponse, len(backups))
+	ids := make([]string, len(backups))
+	for i, b := range backups {
+		response[i] = api.NewBackupResponse(b)
+		ids[i] = strconv.FormatInt(b.ID, 10)
+	}
+
+	return render(response, ids, func(wide bool) {
+		if len(backups) == 0 {
+			notify("No backups found\n")
+			return
+		}
+
+		header := fmt.Sprintf("%-6s %-25s %-10s %-20s %-10s %-10s", "ID", "DATABASE", "ENV", "CREATED", "SIZE", "ROWS")
+		width := 86
+		if wide {
+			header += fmt.Sprintf(" %-8s %-10s %s", "TABLES", "TARGET", "KEY")
+			width += 60
+		}
+		fmt.Println(header)
+		fmt.Println(strings.Repeat("-", width))
+		for _, b := range backups {
+			line := fmt.Sprintf("%-6d %-25s %-10s %-20s %-10s %-10d",
+				b.ID, b.DatabaseName, b.Env, b.CreatedAt.Local().Format("2006-01-02 15:04"), formatSize(b.Size), b.Rows)
+			if wide {
+				line += fmt.Sprintf(" %-8d %-10s %s", b.Tables, b.Target, b.Key)
+			}
+			fmt.Println(line)
+		}
+	})
+}
+
+func backupRun(args []string, wait bool) error {
+	if !wait {
+		req := project.JobRequest{Kind: project.JobBackupRun, Force: true}
+		if len(args) > 0 {
+			env, prNumber, err := parseEnvArgs(args)
+			if err != nil {
+				return err
+			}
+			req = project.JobRequest{Kind: project.JobBackupCreate, Project: args[0], Env: env, PRNumber: prNumber}
+		}
+		return startJob(req)
+	}
+
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if len(args) > 0 {
+		env, prNumber, err := parseEnvArgs(args)
+		if err != nil {
+			return err
+		}
+		b, err := mgr.BackupDatabase(ctx, args[0], env, prNumber)
+		if err != nil {
+			return err
+		}
+		fmt.Printf("Backup %d: %s (%d tables, %d rows, %s)\n", b.ID, b.Key, b.Tables, b.Rows, formatSize(b.Size))
+		return nil
+	}
+
+	result, err := mgr.RunBackups(ctx, true)
+	if err != nil {
+		return err
+	}
+
+	for _, b := range result.Created {
+		fmt.Printf("Backup %d: %s (%d tables, %d rows, %s)\n", b.ID, b.Key, b.Tables, b.Rows, formatSize(b.Size))
+	}
+	for _, b := range result.Pruned {
+		fmt.Printf("Pruned backup %d: %s\n", b.ID, b.Key)
+	}
+	for _, f := range result.Failed {
+		fmt.Printf("Failed: %s\n", f.Error)
+	}
+	if len(result.Failed) > 0 {
+		return fmt.Errorf("%d backup(s) failed", len(result.Failed))
+	}
+	return nil
+}
+
+func backupRestore(args []string, wait bool) error {
+	id, err := strconv.ParseInt(args[0], 10, 64)
+	if err != nil {
+		return fmt.Errorf("invalid backup ID: %s", args[0])
+	}
+	if !wait {
+		env, prNumber, err := parseEnvArgs(args[1:])
+		if err != nil {
+			return err
+		}
+		return startJob(project.JobRequest{Kind: project.JobBackupRestore, BackupID: id, Project: args[1], Env: env, PRNumber: prNumber})
+	}
+
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	env, prNumber, err := parseEnvArgs(args[1:])
+	if err != nil {
+		return err
+	}
+
+	result, err := mgr.RestoreBackup(ctx, id, args[1], env, prNumber)
+	if err != nil {
+		return err
+	}
+
+	if result.Created {
+		fmt.Printf("Created database %s\n", result.DatabaseName)
+	}
+	fmt.Printf("Restored %d table(s), %d row(s) from backup %d into %s\n", result.Tables, result.Rows, id, result.DatabaseName)
+	return nil
+}
+
+// formatSize formats a byte count for display
+func formatSize(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return fmt.Sprintf("%d B", n)
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func dbMove(args []string, target string, dropSource, abort, wait bool) error {
+	if target == "" && !abort {
+		return fmt.Errorf("specify the target server with --to")
+	}
+	if !wait && !abort {
+		env, prNumber, err := parseEnvArgs(args)
+		if err != nil {
+			return err
+		}
+		return startJob(project.JobRequest{Kind: project.JobMove, Project: args[0], Env: env, PRNumber: prNumber, Server: target, DropSource: dropSource})
+	}
+
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	projectName := args[0]
+	env, prNumber, err := parseEnvArgs(args)
+	if err != nil {
+		return err
+	}
+
+	if abort {
+		if err := mgr.AbortMove(ctx, projectName, env, prNumber); err != nil {
+			return err
+		}
+		notify("Move aborted\n")
+		return nil
+	}
+
+	err = mgr.MoveDatabase(ctx, projectName, env, prNumber, target, dropSource, func(p project.MoveProgress) {
+		switch {
+		case p.Message != "":
+			// Relayed from the log of the move job on a server
+			fmt.Println(p.Message)
+		case p.Table == "":
+			fmt.Printf("==> %s\n", p.Phase)
+		case p.Phase == "copy":
+			fmt.Printf("    [%d/%d] %s: %d rows copied\n", p.TablesDone, p.TablesTotal, p.Table, p.Rows)
+		default:
+			fmt.Printf("    [%d/%d] %s: %d rows verified\n", p.TablesDone, p.TablesTotal, p.Table, p.Rows)
+		}
+	})
+	if err != nil {
+		return err
+	}
+
+	fmt.Printf("Moved to server '%s'\n", target)
+	if !dropSource {
+		fmt.Println("The source database is kept but no longer accepts connections")
+	}
+	return nil
+}
+
+// formatOptionalTime formats a time for tables, or returns "-" when it is not set
+func formatOptionalTime(t *time.Time) string {
+	if t == nil {
+		return "-"
+	}
+	return t.Format("2006-01-02 15:04")
+}
+
+// truncate shortens s to at most n characters on a single line
+func truncate(s string, n int) string {
+	s = strings.Join(strings.Fields(s), " ")
+	if len(s) <= n {
+		return s
+	}
+	return s[:n-3] + "..."
+}
+
+func cleanup(olderThan string, wait bool) error {
+	duration, err := parseDuration(olderThan)
+	if err != nil {
+		return fmt.Errorf("invalid duration: %w", err)
+	}
+	if !wait {
+		return startJob(project.JobRequest{Kind: project.JobCleanup, OlderThan: duration})
+	}
+
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	result, err := mgr.Cleanup(ctx, duration)
+	if err != nil {
+		return err
+	}
+
+	return render(api.NewCleanupResponse(result), result.Deleted, func(bool) {
+		if len(result.Deleted) == 0 {
+			notify("No databases to clean up\n")
+		} else {
+			fmt.Printf("Deleted %d database(s):\n", len(result.Deleted))
+			for _, name := range result.Deleted {
+				fmt.Printf("  - %s\n", name)
+			}
+		}
+
+		if len(result.Warnings) > 0 {
+			fmt.Printf("\n%d idle database(s):\n", len(result.Warnings))
+			for _, w := range result.Warnings {
+				fmt.Printf("  - %s (idle %s, last activity %s)\n",
+					w.DatabaseName, w.IdleFor, w.LastActivity.Format("2006-01-02 15:04"))
+			}
+		}
+	})
+}
+
+func serve(port int) error {
+	if cfg.Remote.Server != "" {
+		return fmt.Errorf("serve connects to PostgreSQL directly and cannot run in remote mode")
+	}
+
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	store, err := getStore(ctx)
+	if err != nil {
+		return err
+	}
+
 	mgr := project.NewManager(cfg, store)
+	if err := mgr.StartJobs(ctx, cfg.Jobs.Workers); err != nil {
+		return err
+	}
+	server := api.NewServer(cfg, mgr, port)
+
+	if cfg.Cleanup.ActivitySample > 0 {
+		go mgr.RunActivitySampler(ctx, cfg.Cleanup.ActivitySample)
+	}
+	if len(cfg.Backups.Schedules) > 0 {
+		go mgr.RunBackupScheduler(ctx, time.Minute)
+	}
+	go mgr.RunWebhooks(ctx, 5*time.Second)
+
+	fmt.Printf("Starting API server on port %d\n", port)
+	return server.Start()
+}
+
+func runTUI(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
 	return tui.Run(mgr)
 }
 
+// parseEnvArgs reads the <env> [pr-number] positional arguments following the project name
+func parseEnvArgs(args []string) (string, *int, error) {
+	env := args[1]
+	if env != "pr" {
+		return env, nil, nil
+	}
+	if len(args) < 3 {
+		return "", nil, fmt.Errorf("PR number is required for PR databases")
+	}
+	num, err := strconv.Atoi(args[2])
+	if err != nil {
+		return "", nil, fmt.Errorf("invalid PR number: %s", args[2])
+	}
+	return env, &num, nil
+}
+
 // parseDuration parses a duration string like "7d", "24h", "1w"
 func parseDuration(s string) (time.Duration, error) {
 	if len(s) < 2 {
@@ -493,6 +1891,17 @@ postgres:
   database: postgres
   ssl_mode: disable  # disable, require, verify-ca, verify-full
 
+# Additional servers for managed databases (the postgres block is "default")
+# servers:
+#   ephemeral:
+#     host: pg-ephemeral.internal
+#     user: postgres
+#     password: ""
+#
+# placement:           # First match wins; unmatched databases go to "default"
+#   - env: pr
+#     server: ephemeral
+
 # API server config (for 'pgmanager serve')
 api:
   port: 8080
@@ -502,6 +1911,52 @@ api:
 # Cleanup settings
 cleanup:
   default_ttl: 168h   # 7 days for PR databases
+  activity_sample: 5m # How often 'serve' records database activity
+  # rules:            # Act on databases idle (no sessions or transactions) for a while
+  #   - env: pr
+  #     idle_for: 72h
+  #     action: drop
+  #   - env: staging
+  #     idle_for: 720h
+  #     action: warn
+
+# projects:            # Scripts run when a project's databases are created or reset
+#   myapp:
+#     init: [./sql/init.sql]   # As the admin user, e.g. CREATE EXTENSION
+#     seeds: [./sql/seed.sql]  # As the database owner
+#     migrations: ./migrations # Used by 'db migrate' when --dir is not given
+#     auto_migrate: [pr, dev]  # Migrate new and reset databases of these environments
+
+# backups:
+#   dir: ./backups      # Local directory for backup archives
+#   schedules:          # 'serve' backs up each environment daily at 'at' (UTC)
+#     - env: prod
+#       at: "02:00"
+#       keep_daily: 7
+#       keep_weekly: 4
+
+# webhooks:             # Delivery of events to 'pgmanager webhook add' subscriptions by 'serve'
+#   max_attempts: 8
+#   expiry_notice: 24h  # Send database.expiring this long before a database expires
+
+# jobs:                 # Long operations started through 'serve' run as jobs
+#   workers: 4
+
+# integrations:         # Create and drop PR databases from pull request webhooks received by 'serve'
+#   github:
+#     secret: ""        # or PGMANAGER_GITHUB_WEBHOOK_SECRET
+#     repositories:
+#       acme/api: myapp
+#   gitlab:
+#     token: ""         # or PGMANAGER_GITLAB_WEBHOOK_TOKEN
+#     projects:
+#       acme/backend/api: myapp
+# client:
+#   command: psql       # Client started by 'db connect', e.g. "pgcli --less-chatty"
+
+# remote:               # Run commands through a pgmanager server instead of PostgreSQL
+#   server: https://pgm.internal
+#   token: your-secret-token
 `
 
 	// Check if config already exists
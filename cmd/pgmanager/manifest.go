@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+
+	"pgmanager/internal/api"
+	"pgmanager/internal/manifest"
+	"pgmanager/internal/project"
+)
+
+// planManifest shows the changes apply would make for a manifest file
+func planManifest(file string, prune bool) error {
+	mf, err := manifest.Load(file)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	plan, err := mgr.Plan(ctx, mf, prune)
+	if err != nil {
+		return err
+	}
+
+	return render(api.NewPlanResponse(plan), changeNames(plan.Changes), func(bool) {
+		if plan.Empty() {
+			notify("No changes; the manifest is up to date\n")
+		} else {
+			fmt.Printf("Plan: %d change(s)\n", len(plan.Changes))
+			for _, change := range plan.Changes {
+				fmt.Printf("  %s\n", change)
+			}
+		}
+		printWarnings(plan.Warnings)
+	})
+}
+
+// applyManifest applies a manifest file. Credentials of the databases and roles
+// it creates are printed once and cannot be shown again for roles.
+func applyManifest(file string, prune bool) error {
+	mf, err := manifest.Load(file)
+	if err != nil {
+		return err
+	}
+
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	result, applyErr := mgr.Apply(ctx, mf, prune)
+	if result == nil {
+		return applyErr
+	}
+
+	response := api.NewApplyResponse(result)
+	if applyErr != nil {
+		response.Error = applyErr.Error()
+	}
+	err = render(response, changeNames(result.Applied), func(bool) {
+		if len(result.Applied) == 0 && applyErr == nil {
+			notify("No changes; the manifest is up to date\n")
+			return
+		}
+		fmt.Printf("Applied %d change(s):\n", len(result.Applied))
+		for _, change := range result.Applied {
+			fmt.Printf("  %s\n", change)
+		}
+
+		if len(result.Credentials) > 0 {
+			fmt.Printf("\nCredentials of new databases and roles (shown only once):\n")
+			for _, c := range result.Credentials {
+				fmt.Printf("  %s\n", c.User)
+				fmt.Printf("    Password:   %s\n", c.Password)
+				if c.ConnString != "" {
+					fmt.Printf("    Connection: %s\n", c.ConnString)
+				}
+			}
+		}
+	})
+	if err != nil {
+		return err
+	}
+	return applyErr
+}
+
+// changeNames returns the names of changes for --output name
+func changeNames(changes []project.PlanChange) []string {
+	names := make([]string, len(changes))
+	for i, c := range changes {
+		names[i] = c.Name
+	}
+	return names
+}
+
+// printWarnings lists the differences a plan leaves alone
+func printWarnings(warnings []string) {
+	if len(warnings) == 0 {
+		return
+	}
+	fmt.Printf("\nWarnings:\n")
+	for _, w := range warnings {
+		fmt.Printf("  ! %s\n", w)
+	}
+}
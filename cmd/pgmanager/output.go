@@ -0,0 +1,178 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"os"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"gopkg.in/yaml.v3"
+	"pgmanager/internal/auth"
+	"pgmanager/internal/client"
+)
+
+// Output formats selected with --output
+const (
+	outputTable = "table"
+	outputWide  = "wide" // Table with additional columns
+	outputJSON  = "json" // Same structures as the REST API
+	outputYAML  = "yaml"
+	outputName  = "name" // One name per line, for piping into other commands
+)
+
+var outputFormats = []string{outputTable, outputWide, outputJSON, outputYAML, outputName}
+
+var (
+	outputFormat string
+	quiet        bool
+)
+
+// Exit codes. Scripts can tell a missing object from a conflict or a failure
+// without parsing messages.
+const (
+	exitError    = 1 // Server, connection or unexpected error
+	exitUsage    = 2 // Invalid arguments or flags
+	exitNotFound = 3 // The project, database or backup does not exist
+	exitConflict = 4 // The object already exists or is in use
+	exitDenied   = 5 // The caller lacks the scope or role the operation needs
+)
+
+// usageError marks errors caused by invalid command line arguments
+type usageError struct {
+	error
+}
+
+// exitCode maps an error to the process exit code
+func exitCode(err error) int {
+	var usage usageError
+	if errors.As(err, &usage) {
+		return exitUsage
+	}
+
+	// In remote mode the server's status code decides
+	var apiErr *client.Error
+	if errors.As(err, &apiErr) {
+		switch apiErr.StatusCode {
+		case http.StatusBadRequest:
+			return exitUsage
+		case http.StatusForbidden:
+			return exitDenied
+		case http.StatusNotFound:
+			return exitNotFound
+		case http.StatusConflict:
+			return exitConflict
+		default:
+			return exitError
+		}
+	}
+
+	if errors.Is(err, auth.ErrPermissionDenied) {
+		return exitDenied
+	}
+
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "not found"):
+		return exitNotFound
+	case strings.Contains(msg, "already exists"), strings.Contains(msg, "in progress"),
+		strings.Contains(msg, "is protected"):
+		return exitConflict
+	case strings.HasPrefix(msg, "invalid "), strings.HasPrefix(msg, "unknown command"),
+		strings.HasPrefix(msg, "specify "), strings.Contains(msg, "is required"):
+		return exitUsage
+	}
+	return exitError
+}
+
+// markUsageErrors makes argument validation errors of cmd and its subcommands usage errors
+func markUsageErrors(cmd *cobra.Command) {
+	if validate := cmd.Args; validate != nil {
+		cmd.Args = func(cmd *cobra.Command, args []string) error {
+			if err := validate(cmd, args); err != nil {
+				return usageError{err}
+			}
+			return nil
+		}
+	}
+	for _, sub := range cmd.Commands() {
+		markUsageErrors(sub)
+	}
+}
+
+// validateOutput checks the --output flag
+func validateOutput() error {
+	for _, f := range outputFormats {
+		if outputFormat == f {
+			return nil
+		}
+	}
+	return usageError{fmt.Errorf("invalid output format '%s', must be one of: %s", outputFormat, strings.Join(outputFormats, ", "))}
+}
+
+// structured reports whether the output is meant for programs rather than people
+func structured() bool {
+	return outputFormat != outputTable && outputFormat != outputWide
+}
+
+// notify prints a message for people: it is suppressed by --quiet and when the
+// output is meant for programs
+func notify(format string, args ...any) {
+	if quiet || structured() {
+		return
+	}
+	fmt.Printf(format, args...)
+}
+
+// render prints data in the selected output format. table prints the human
+// readable form and receives whether wide output was requested; names are
+// printed one per line for --output name.
+func render(data any, names []string, table func(wide bool)) error {
+	switch outputFormat {
+	case outputJSON:
+		enc := json.NewEncoder(os.Stdout)
+		enc.SetIndent("", "  ")
+		return enc.Encode(data)
+	case outputYAML:
+		out, err := toYAML(data)
+		if err != nil {
+			return err
+		}
+		_, err = os.Stdout.Write(out)
+		return err
+	case outputName:
+		for _, name := range names {
+			fmt.Println(name)
+		}
+		return nil
+	default:
+		table(outputFormat == outputWide)
+		return nil
+	}
+}
+
+// toYAML renders data as YAML with the field names and order of its JSON form
+func toYAML(data any) ([]byte, error) {
+	raw, err := json.Marshal(data)
+	if err != nil {
+		return nil, err
+	}
+	// JSON is valid YAML, so the parsed tree keeps the JSON field order
+	var node yaml.Node
+	if err := yaml.Unmarshal(raw, &node); err != nil {
+		return nil, err
+	}
+	blockStyle(&node)
+	return yaml.Marshal(&node)
+}
+
+// blockStyle clears the flow and quoting styles taken from the JSON source. Strings
+// keep their !!str tag, so values that would read as another type stay quoted.
+func blockStyle(node *yaml.Node) {
+	node.Style = 0
+	for _, child := range node.Content {
+		blockStyle(child)
+	}
+}
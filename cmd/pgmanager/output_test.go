@@ -0,0 +1,143 @@
+package main
+
+import (
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"testing"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/client"
+)
+
+func TestExitCode(t *testing.T) {
+	tests := []struct {
+		name string
+		err  error
+		want int
+	}{
+		{"usage error", usageError{errors.New("accepts 1 arg(s), received 0")}, exitUsage},
+		{"wrapped usage error", fmt.Errorf("context: %w", usageError{errors.New("bad")}), exitUsage},
+		{"bad request", &client.Error{StatusCode: http.StatusBadRequest, Message: "invalid duration format"}, exitUsage},
+		{"not found", &client.Error{StatusCode: http.StatusNotFound, Message: "project not found"}, exitNotFound},
+		{"conflict", &client.Error{StatusCode: http.StatusConflict, Message: "database already exists"}, exitConflict},
+		{"status decides over message", &client.Error{StatusCode: http.StatusInternalServerError, Message: "backup not found"}, exitError},
+		{"forbidden", &client.Error{StatusCode: http.StatusForbidden, Message: "permission denied"}, exitDenied},
+		{"permission denied", fmt.Errorf("%w: 'ci' lacks the 'delete' scope on project 'myapp'", auth.ErrPermissionDenied), exitDenied},
+		{"missing object", errors.New("project 'myapp' not found"), exitNotFound},
+		{"existing object", errors.New("database myapp_dev already exists"), exitConflict},
+		{"move in progress", errors.New("a move of myapp_dev is in progress"), exitConflict},
+		{"protected database", errors.New("database myapp_prod is protected"), exitConflict},
+		{"invalid argument", errors.New("invalid PR number: abc"), exitUsage},
+		{"unknown command", errors.New(`unknown command "foo" for "pgmanager"`), exitUsage},
+		{"missing flag", errors.New("specify either --config or --context"), exitUsage},
+		{"required flag", errors.New("--to is required"), exitUsage},
+		{"other failure", errors.New("failed to connect: connection refused"), exitError},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := exitCode(tt.err); got != tt.want {
+				t.Errorf("exitCode(%v) = %d, want %d", tt.err, got, tt.want)
+			}
+		})
+	}
+}
+
+// captureStdout returns what f prints to standard output
+func captureStdout(t *testing.T, f func()) string {
+	t.Helper()
+	r, w, err := os.Pipe()
+	if err != nil {
+		t.Fatal(err)
+	}
+	stdout := os.Stdout
+	os.Stdout = w
+	defer func() { os.Stdout = stdout }()
+
+	done := make(chan string)
+	go func() {
+		out, _ := io.ReadAll(r)
+		done <- string(out)
+	}()
+	f()
+	w.Close()
+	return <-done
+}
+
+func TestRender(t *testing.T) {
+	type item struct {
+		Name    string  `json:"name"`
+		Version string  `json:"version"`
+		Size    int64   `json:"size"`
+		Expires *string `json:"expires"`
+	}
+	data := []item{{Name: "myapp_dev", Version: "16", Size: 1024}}
+
+	tests := []struct {
+		format string
+		want   string
+	}{
+		{outputTable, "table\n"},
+		{outputWide, "wide\n"},
+		{outputName, "myapp_dev\n"},
+		{outputJSON, `[
+  {
+    "name": "myapp_dev",
+    "version": "16",
+    "size": 1024,
+    "expires": null
+  }
+]
+`},
+		// Field order follows the JSON form, and strings that read as numbers stay quoted
+		{outputYAML, `- name: myapp_dev
+  version: "16"
+  size: 1024
+  expires: null
+`},
+	}
+
+	defer func(format string) { outputFormat = format }(outputFormat)
+	for _, tt := range tests {
+		t.Run(tt.format, func(t *testing.T) {
+			outputFormat = tt.format
+			var err error
+			got := captureStdout(t, func() {
+				err = render(data, []string{"myapp_dev"}, func(wide bool) {
+					if wide {
+						fmt.Println("wide")
+					} else {
+						fmt.Println("table")
+					}
+				})
+			})
+			if err != nil {
+				t.Fatalf("render() error = %v", err)
+			}
+			if got != tt.want {
+				t.Errorf("render() printed:\n%s\nwant:\n%s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestToYAMLEmpty(t *testing.T) {
+	for _, tt := range []struct {
+		data any
+		want string
+	}{
+		{[]string{}, "[]\n"},
+		{map[string]any{}, "{}\n"},
+	} {
+		out, err := toYAML(tt.data)
+		if err != nil {
+			t.Fatalf("toYAML(%v) error = %v", tt.data, err)
+		}
+		if string(out) != tt.want {
+			t.Errorf("toYAML(%v) = %q, want %q", tt.data, out, tt.want)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"pgmanager/internal/api"
+	"pgmanager/internal/project"
+)
+
+// tokenCreate creates an API token and prints its secret, which cannot be shown again
+func tokenCreate(name string, scopes, projects []string, expires string) error {
+	opts := project.TokenOptions{Name: name, Scopes: scopes, Projects: projects}
+	if expires != "" {
+		ttl, err := parseDuration(expires)
+		if err != nil || ttl <= 0 {
+			return fmt.Errorf("invalid expiry: %s", expires)
+		}
+		opts.TTL = ttl
+	}
+
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	token, secret, err := mgr.CreateToken(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	response := api.NewTokenResponse(*token)
+	response.Secret = secret
+	return render(response, []string{token.Name}, func(bool) {
+		fmt.Printf("Created token %s with scopes %s\n", token.Name, strings.Join(token.Scopes, ", "))
+		if len(token.Projects) > 0 {
+			fmt.Printf("Projects: %s\n", strings.Join(token.Projects, ", "))
+		}
+		if token.ExpiresAt != nil {
+			fmt.Printf("Expires: %s\n", formatOptionalTime(token.ExpiresAt))
+		}
+		fmt.Printf("\n%s\n\nStore the token now; it cannot be shown again.\n", secret)
+	})
+}
+
+func tokenList(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	tokens, err := mgr.ListTokens(ctx)
+	if err != nil {
+		return err
+	}
+
+	response := make([]api.TokenResponse, len(tokens))
+	names := make([]string, len(tokens))
+	for i, t := range tokens {
+		response[i] = api.NewTokenResponse(t)
+		names[i] = t.Name
+	}
+
+	return render(response, names, func(wide bool) {
+		if len(tokens) == 0 {
+			notify("No tokens found\n")
+			return
+		}
+
+		header := fmt.Sprintf("%-20s %-25s %-20s %-17s", "NAME", "SCOPES", "PROJECTS", "EXPIRES")
+		width := 85
+		if wide {
+			header += fmt.Sprintf(" %-17s %s", "CREATED", "LAST USED")
+			width += 36
+		}
+		fmt.Println(header)
+		fmt.Println(strings.Repeat("-", width))
+		for _, t := range tokens {
+			projects := "*"
+			if len(t.Projects) > 0 {
+				projects = strings.Join(t.Projects, ",")
+			}
+			line := fmt.Sprintf("%-20s %-25s %-20s %-17s",
+				t.Name, strings.Join(t.Scopes, ","), truncate(projects, 20), formatOptionalTime(t.ExpiresAt))
+			if wide {
+				line += fmt.Sprintf(" %-17s %s", t.CreatedAt.Local().Format("2006-01-02 15:04"), formatOptionalTime(t.LastUsedAt))
+			}
+			fmt.Println(line)
+		}
+	})
+}
+
+func tokenRevoke(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := mgr.RevokeToken(ctx, args[0]); err != nil {
+		return err
+	}
+
+	notify("Revoked token %s\n", args[0])
+	return nil
+}
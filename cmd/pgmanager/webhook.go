@@ -0,0 +1,181 @@
+package main
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/spf13/cobra"
+	"pgmanager/internal/api"
+	"pgmanager/internal/project"
+)
+
+// webhookAdd creates a webhook and prints its secret, which is not shown again
+func webhookAdd(opts project.WebhookOptions) error {
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	webhook, err := mgr.CreateWebhook(ctx, opts)
+	if err != nil {
+		return err
+	}
+
+	response := api.NewWebhookResponse(*webhook)
+	response.Secret = webhook.Secret
+	return render(response, []string{webhook.Name}, func(bool) {
+		fmt.Printf("Created webhook %s for %s\n", webhook.Name, webhook.URL)
+		fmt.Printf("Events: %s\n", listOrAll(webhook.Events))
+		fmt.Printf("Projects: %s\n", listOrAll(webhook.Projects))
+		if opts.Secret == "" {
+			fmt.Printf("\n%s\n\nVerify the X-Pgmanager-Signature-256 header of deliveries with this secret.\n", webhook.Secret)
+		}
+	})
+}
+
+// webhookList prints all webhooks
+func webhookList() error {
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	webhooks, err := mgr.ListWebhooks(ctx)
+	if err != nil {
+		return err
+	}
+
+	response := make([]api.WebhookResponse, len(webhooks))
+	names := make([]string, len(webhooks))
+	for i, w := range webhooks {
+		response[i] = api.NewWebhookResponse(w)
+		names[i] = w.Name
+	}
+
+	return render(response, names, func(wide bool) {
+		if len(webhooks) == 0 {
+			notify("No webhooks found\n")
+			return
+		}
+
+		header := fmt.Sprintf("%-20s %-40s %-30s %-20s", "NAME", "URL", "EVENTS", "PROJECTS")
+		width := 113
+		if wide {
+			header += fmt.Sprintf(" %s", "CREATED")
+			width += 17
+		}
+		fmt.Println(header)
+		fmt.Println(strings.Repeat("-", width))
+		for _, w := range webhooks {
+			line := fmt.Sprintf("%-20s %-40s %-30s %-20s",
+				w.Name, truncate(w.URL, 40), truncate(listOrAll(w.Events), 30), truncate(listOrAll(w.Projects), 20))
+			if wide {
+				line += fmt.Sprintf(" %s", w.CreatedAt.Local().Format("2006-01-02 15:04"))
+			}
+			fmt.Println(line)
+		}
+	})
+}
+
+// webhookDeliveries prints the recent deliveries of a webhook, newest first
+func webhookDeliveries(name string, limit int) error {
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	deliveries, err := mgr.ListWebhookDeliveries(ctx, name, limit)
+	if err != nil {
+		return err
+	}
+
+	response := make([]api.WebhookDeliveryResponse, len(deliveries))
+	names := make([]string, len(deliveries))
+	for i, d := range deliveries {
+		response[i] = api.NewWebhookDeliveryResponse(d)
+		names[i] = fmt.Sprintf("%d", d.ID)
+	}
+
+	return render(response, names, func(wide bool) {
+		if len(deliveries) == 0 {
+			notify("No deliveries found for webhook %s\n", name)
+			return
+		}
+
+		header := fmt.Sprintf("%-8s %-17s %-18s %-10s %-8s %-6s", "ID", "CREATED", "EVENT", "STATUS", "ATTEMPTS", "CODE")
+		width := 72
+		if wide {
+			header += fmt.Sprintf(" %-17s %s", "NEXT ATTEMPT", "ERROR")
+			width += 40
+		}
+		fmt.Println(header)
+		fmt.Println(strings.Repeat("-", width))
+		for _, d := range deliveries {
+			code := "-"
+			if d.ResponseCode != 0 {
+				code = fmt.Sprintf("%d", d.ResponseCode)
+			}
+			line := fmt.Sprintf("%-8d %-17s %-18s %-10s %-8d %-6s",
+				d.ID, d.CreatedAt.Local().Format("2006-01-02 15:04"), d.Event, d.Status, d.Attempts, code)
+			if wide {
+				next := "-"
+				if d.Status == project.DeliveryPending {
+					next = d.NextAttemptAt.Local().Format("2006-01-02 15:04")
+				}
+				line += fmt.Sprintf(" %-17s %s", next, d.Error)
+			}
+			fmt.Println(line)
+		}
+	})
+}
+
+func webhookTest(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	delivery, err := mgr.TestWebhook(ctx, args[0])
+	if err != nil {
+		return err
+	}
+	if delivery.Status != project.DeliverySucceeded {
+		return fmt.Errorf("ping to webhook %s failed: %s", args[0], delivery.Error)
+	}
+
+	notify("Webhook %s accepted the ping with status %d\n", args[0], delivery.ResponseCode)
+	return nil
+}
+
+func webhookRemove(cmd *cobra.Command, args []string) error {
+	ctx := context.Background()
+	mgr, store, err := getManager(ctx)
+	if err != nil {
+		return err
+	}
+	defer store.Close()
+
+	if err := mgr.DeleteWebhook(ctx, args[0]); err != nil {
+		return err
+	}
+
+	notify("Removed webhook %s\n", args[0])
+	return nil
+}
+
+// listOrAll joins a filter list, or returns "*" for an empty one
+func listOrAll(values []string) string {
+	if len(values) == 0 {
+		return "*"
+	}
+	return strings.Join(values, ",")
+}
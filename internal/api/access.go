@@ -0,0 +1,97 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"pgmanager/internal/meta"
+)
+
+// GrantAccessRequest sets the role of a subject on a project
+type GrantAccessRequest struct {
+	Role string `json:"role"`
+}
+
+// AccessResponse describes the role of a subject on a project
+type AccessResponse struct {
+	Project   string `json:"project"`
+	Subject   string `json:"subject"`
+	Role      string `json:"role"`
+	CreatedAt string `json:"created_at"`
+}
+
+// NewAccessResponse describes an access binding
+func NewAccessResponse(b meta.AccessBinding) AccessResponse {
+	return AccessResponse{
+		Project:   b.ProjectName,
+		Subject:   b.Subject,
+		Role:      b.Role,
+		CreatedAt: b.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// listAccess lists the bindings of the project in the path, or of every
+// project the caller can see
+func (s *Server) listAccess(w http.ResponseWriter, r *http.Request) {
+	bindings, err := s.mgr.ListAccess(r.Context(), chi.URLParam(r, "name"))
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeInternalError(w, "listAccess", err)
+		return
+	}
+
+	response := make([]AccessResponse, len(bindings))
+	for i, b := range bindings {
+		response[i] = NewAccessResponse(b)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) grantAccess(w http.ResponseWriter, r *http.Request) {
+	projectName, subject := chi.URLParam(r, "name"), chi.URLParam(r, "subject")
+
+	var req GrantAccessRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	b, err := s.mgr.GrantAccess(r.Context(), projectName, subject, req.Role)
+	if err != nil {
+		msg := err.Error()
+		switch {
+		case strings.Contains(msg, "not found"):
+			writeError(w, http.StatusNotFound, msg)
+		case strings.HasPrefix(msg, "invalid"):
+			writeError(w, http.StatusBadRequest, msg)
+		default:
+			writeInternalError(w, "grantAccess", err)
+		}
+		return
+	}
+
+	audit(r, "access", "granted %s the %s role on %s", subject, b.Role, projectName)
+	writeJSON(w, http.StatusOK, NewAccessResponse(*b))
+}
+
+func (s *Server) revokeAccess(w http.ResponseWriter, r *http.Request) {
+	projectName, subject := chi.URLParam(r, "name"), chi.URLParam(r, "subject")
+
+	if err := s.mgr.RevokeAccess(r.Context(), projectName, subject); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeInternalError(w, "revokeAccess", err)
+		return
+	}
+
+	audit(r, "access", "revoked the role of %s on %s", subject, projectName)
+	w.WriteHeader(http.StatusNoContent)
+}
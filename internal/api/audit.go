@@ -0,0 +1,108 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/meta"
+)
+
+// AuditEventResponse describes an audit event
+type AuditEventResponse struct {
+	ID        int64  `json:"id"`
+	Time      string `json:"time"`
+	Actor     string `json:"actor"`
+	Source    string `json:"source"`
+	RequestID string `json:"request_id,omitempty"`
+	Action    string `json:"action"`
+	Project   string `json:"project,omitempty"`
+	Target    string `json:"target,omitempty"`
+	Outcome   string `json:"outcome"`
+	Error     string `json:"error,omitempty"`
+	Detail    string `json:"detail,omitempty"`
+}
+
+// NewAuditEventResponse describes an audit event
+func NewAuditEventResponse(e meta.AuditEvent) AuditEventResponse {
+	return AuditEventResponse{
+		ID:        e.ID,
+		Time:      e.CreatedAt.Format(time.RFC3339),
+		Actor:     e.Actor,
+		Source:    e.Source,
+		RequestID: e.RequestID,
+		Action:    e.Action,
+		Project:   e.Project,
+		Target:    e.Target,
+		Outcome:   e.Outcome,
+		Error:     e.Error,
+		Detail:    e.Detail,
+	}
+}
+
+// ParseSince parses the start of a time range: an RFC 3339 time, or a
+// duration such as "24h" or "7d" before now
+func ParseSince(s string) (time.Time, error) {
+	if s == "" {
+		return time.Time{}, nil
+	}
+	if t, err := time.Parse(time.RFC3339, s); err == nil {
+		return t, nil
+	}
+	d, err := parseDuration(s)
+	if err != nil || d <= 0 {
+		return time.Time{}, fmt.Errorf("invalid time '%s', use RFC 3339 or a duration like 24h or 7d", s)
+	}
+	return time.Now().Add(-d), nil
+}
+
+// listAudit lists audit events, newest first. Pages continue with before set
+// to the ID of the last event returned.
+func (s *Server) listAudit(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := meta.AuditFilter{
+		Project: q.Get("project"),
+		Actor:   q.Get("actor"),
+		Action:  q.Get("action"),
+	}
+
+	var err error
+	if filter.Since, err = ParseSince(q.Get("since")); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if filter.Until, err = ParseSince(q.Get("until")); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	if v := q.Get("before"); v != "" {
+		if filter.BeforeID, err = strconv.ParseInt(v, 10, 64); err != nil || filter.BeforeID <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid before: must be an event ID")
+			return
+		}
+	}
+	if v := q.Get("limit"); v != "" {
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit: must be a positive number")
+			return
+		}
+	}
+
+	if filter.Project != "" && !requireProject(w, r, auth.ScopeRead, filter.Project) {
+		return
+	}
+
+	events, err := s.mgr.ListAudit(r.Context(), filter)
+	if err != nil {
+		writeInternalError(w, "listAudit", err)
+		return
+	}
+
+	response := make([]AuditEventResponse, len(events))
+	for i, e := range events {
+		response[i] = NewAuditEventResponse(e)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
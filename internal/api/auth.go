@@ -2,11 +2,22 @@ package api
 
 import (
 	"crypto/subtle"
+	"fmt"
+	"log"
 	"net/http"
 	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"pgmanager/internal/auth"
 )
 
-// authMiddleware validates the Bearer token in the Authorization header
+// authMiddleware resolves the Bearer token in the Authorization header to a
+// principal and stores it in the request context. The token is either api.token,
+// which grants every scope, one of the tokens in the metadata store or, with
+// api.oidc, an ID token of the identity provider. Requests of the web UI carry
+// the ID token in the session cookie instead. Without api.token and with
+// api.require_token off, requests without a token are served as the anonymous
+// principal.
 func (s *Server) authMiddleware(next http.Handler) http.Handler {
 	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
 		// Skip auth for health check
@@ -17,7 +28,22 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 
 		// Get the Authorization header
 		authHeader := r.Header.Get("Authorization")
+		if authHeader == "" && s.oidc != nil {
+			if cookie, err := r.Cookie(sessionCookie); err == nil {
+				principal, err := s.authenticateUser(r.Context(), cookie.Value)
+				if err != nil {
+					writeAuthError(w, err)
+					return
+				}
+				next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
+				return
+			}
+		}
 		if authHeader == "" {
+			if s.cfg.API.Token == "" && !s.cfg.API.RequireToken {
+				next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), auth.Anonymous)))
+				return
+			}
 			writeError(w, http.StatusUnauthorized, "missing authorization header")
 			return
 		}
@@ -30,30 +56,96 @@ func (s *Server) authMiddleware(next http.Handler) http.Handler {
 
 		// Extract and validate token
 		token := strings.TrimPrefix(authHeader, "Bearer ")
-		valid, tokenNotConfigured := validateToken(token, s.cfg.API.Token, s.cfg.API.RequireToken)
-		if tokenNotConfigured {
-			writeError(w, http.StatusServiceUnavailable, "API token not configured")
-			return
-		}
-		if !valid {
-			writeError(w, http.StatusUnauthorized, "invalid token")
-			return
+		principal := auth.ConfigToken
+		if s.oidc != nil && isJWT(token) {
+			var err error
+			principal, err = s.authenticateUser(r.Context(), token)
+			if err != nil {
+				writeAuthError(w, err)
+				return
+			}
+		} else if !validateToken(token, s.cfg.API.Token) {
+			var err error
+			principal, err = s.mgr.Authenticate(r.Context(), token)
+			if err != nil {
+				writeInternalError(w, "authenticate", err)
+				return
+			}
+			if principal == nil {
+				writeError(w, http.StatusUnauthorized, "invalid token")
+				return
+			}
 		}
 
-		next.ServeHTTP(w, r)
+		next.ServeHTTP(w, r.WithContext(auth.WithPrincipal(r.Context(), principal)))
 	})
 }
 
-// validateToken performs constant-time comparison of tokens to prevent timing attacks
-// Returns: (valid bool, tokenRequired bool)
-func validateToken(provided, expected string, requireToken bool) (bool, bool) {
+// validateToken performs constant-time comparison of tokens to prevent timing attacks.
+// An empty expected token matches nothing.
+func validateToken(provided, expected string) bool {
 	if expected == "" {
-		if requireToken {
-			// Token is required but not configured - reject all requests
-			return false, true
-		}
-		// No token configured and not required - allow all requests
-		return true, false
+		return false
+	}
+	return subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) == 1
+}
+
+// principal returns the caller of a request
+func principal(r *http.Request) *auth.Principal {
+	if p := auth.FromContext(r.Context()); p != nil {
+		return p
+	}
+	return auth.Anonymous
+}
+
+// require rejects requests whose principal lacks scope or, on routes of a
+// project, a role on that project granting scope
+func (s *Server) require(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			p := principal(r)
+			if !p.Can(scope) {
+				writeError(w, http.StatusForbidden, fmt.Sprintf("token '%s' lacks the '%s' scope", p.Name, scope))
+				return
+			}
+			if name := chi.URLParam(r, "name"); name != "" && !requireProject(w, r, scope, name) {
+				return
+			}
+			next.ServeHTTP(w, r)
+		})
+	}
+}
+
+// requireAll is require for operations that span every project, which tokens
+// limited to some projects cannot perform
+func (s *Server) requireAll(scope string) func(http.Handler) http.Handler {
+	return func(next http.Handler) http.Handler {
+		return s.require(scope)(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+			if p := principal(r); !p.CanOnAll(scope) {
+				writeError(w, http.StatusForbidden, fmt.Sprintf("token '%s' lacks the '%s' scope on every project", p.Name, scope))
+				return
+			}
+			next.ServeHTTP(w, r)
+		}))
 	}
-	return subtle.ConstantTimeCompare([]byte(provided), []byte(expected)) == 1, false
+}
+
+// requireProject checks that the principal has scope on a project, such as
+// one named in a request body
+func requireProject(w http.ResponseWriter, r *http.Request, scope, name string) bool {
+	p := principal(r)
+	switch {
+	case !p.CanAccessProject(name):
+		writeError(w, http.StatusForbidden, fmt.Sprintf("token '%s' cannot access project '%s'", p.Name, name))
+		return false
+	case !p.CanOnProject(scope, name):
+		writeError(w, http.StatusForbidden, fmt.Sprintf("the role of token '%s' on project '%s' does not grant the '%s' scope", p.Name, name, scope))
+		return false
+	}
+	return true
+}
+
+// audit logs a sensitive operation along with its caller
+func audit(r *http.Request, operation, format string, args ...any) {
+	log.Printf("AUDIT [%s] from=%s token=%s %s", operation, r.RemoteAddr, principal(r).Name, fmt.Sprintf(format, args...))
 }
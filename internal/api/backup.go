@@ -0,0 +1,141 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"pgmanager/internal/auth"
+	"pgmanager/internal/meta"
+	"pgmanager/internal/project"
+)
+
+// BackupResponse describes a stored backup
+type BackupResponse struct {
+	ID           int64  `json:"id"`
+	DatabaseName string `json:"database_name"`
+	Env          string `json:"env"`
+	Target       string `json:"target"`
+	Key          string `json:"key"`
+	Size         int64  `json:"size"`
+	Tables       int    `json:"tables"`
+	Rows         int64  `json:"rows"`
+	CreatedAt    string `json:"created_at"`
+}
+
+// BackupRunResponse reports the outcome of a run over all scheduled environments
+type BackupRunResponse struct {
+	Created []BackupResponse        `json:"created"`
+	Pruned  []BackupResponse        `json:"pruned"`
+	Failed  []BackupFailureResponse `json:"failed,omitempty"`
+}
+
+// BackupFailureResponse reports a database that could not be backed up
+type BackupFailureResponse struct {
+	DatabaseName string `json:"database_name"`
+	Error        string `json:"error"`
+}
+
+// RestoreBackupRequest selects the database a backup is restored into
+type RestoreBackupRequest struct {
+	Project  string `json:"project"`
+	Env      string `json:"env"`
+	PRNumber *int   `json:"number,omitempty"`
+}
+
+func backupResponses(backups []meta.Backup) []BackupResponse {
+	response := make([]BackupResponse, len(backups))
+	for i, b := range backups {
+		response[i] = NewBackupResponse(b)
+	}
+	return response
+}
+
+func (s *Server) listAllBackups(w http.ResponseWriter, r *http.Request) {
+	backups, err := s.mgr.ListBackups(r.Context(), "", "", nil)
+	if err != nil {
+		writeInternalError(w, "listAllBackups", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, backupResponses(backups))
+}
+
+func (s *Server) listBackups(w http.ResponseWriter, r *http.Request) {
+	projectName := chi.URLParam(r, "name")
+	env, prNumber, ok := parseEnvParam(w, r)
+	if !ok {
+		return
+	}
+
+	backups, err := s.mgr.ListBackups(r.Context(), projectName, env, prNumber)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	writeJSON(w, http.StatusOK, backupResponses(backups))
+}
+
+func (s *Server) createBackup(w http.ResponseWriter, r *http.Request) {
+	projectName := chi.URLParam(r, "name")
+	env, prNumber, ok := parseEnvParam(w, r)
+	if !ok {
+		return
+	}
+
+	req := project.JobRequest{Kind: project.JobBackupCreate, Project: projectName, Env: env, PRNumber: prNumber}
+	s.startJob(w, r, "createBackup", req, writeBackupError)
+}
+
+func (s *Server) runBackups(w http.ResponseWriter, r *http.Request) {
+	// Unless force=false is given, every scheduled database is backed up regardless of its last backup
+	force := r.URL.Query().Get("force") != "false"
+
+	s.startJob(w, r, "runBackups", project.JobRequest{Kind: project.JobBackupRun, Force: force}, writeBackupError)
+}
+
+func (s *Server) restoreBackup(w http.ResponseWriter, r *http.Request) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid backup ID")
+		return
+	}
+
+	var req RestoreBackupRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Project == "" || req.Env == "" {
+		writeError(w, http.StatusBadRequest, "project and env are required")
+		return
+	}
+	if !requireProject(w, r, auth.ScopeCreate, req.Project) {
+		return
+	}
+	if req.PRNumber != nil && (*req.PRNumber <= 0 || *req.PRNumber > MaxPRNumber) {
+		writeError(w, http.StatusBadRequest, "invalid PR number")
+		return
+	}
+
+	job := project.JobRequest{Kind: project.JobBackupRestore, Project: req.Project, Env: req.Env, PRNumber: req.PRNumber, BackupID: id}
+	s.startJob(w, r, "restoreBackup", job, writeBackupError)
+}
+
+// writeBackupError reports a backup or restore that cannot be started
+func writeBackupError(w http.ResponseWriter, context string, err error) {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "not found"):
+		writeError(w, http.StatusNotFound, msg)
+	case strings.Contains(msg, "not configured"), strings.Contains(msg, "no backup"):
+		writeError(w, http.StatusConflict, msg)
+	case strings.Contains(msg, "invalid"):
+		writeError(w, http.StatusBadRequest, msg)
+	default:
+		writeInternalError(w, context, err)
+	}
+}
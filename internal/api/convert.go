@@ -0,0 +1,138 @@
+package api
+
+import (
+	"time"
+
+	"pgmanager/internal/db"
+	"pgmanager/internal/meta"
+	"pgmanager/internal/project"
+)
+
+// The functions below build the response types from manager results. The CLI uses
+// them too, so its structured output matches the API.
+
+// NewProjectResponse describes a project
+func NewProjectResponse(p meta.Project) ProjectResponse {
+	return ProjectResponse{
+		Name:      p.Name,
+		CreatedAt: p.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// NewDatabaseResponse describes a newly created database, including its credentials
+func NewDatabaseResponse(info *project.DatabaseInfo) DatabaseResponse {
+	return DatabaseResponse{
+		Project:      info.Project,
+		Env:          info.Env,
+		PRNumber:     info.PRNumber,
+		DatabaseName: info.DatabaseName,
+		UserName:     info.UserName,
+		Password:     info.Password,
+		Server:       info.Server,
+		Host:         info.Host,
+		Port:         info.Port,
+		ConnString:   info.ConnString,
+		CreatedAt:    info.CreatedAt.Format(time.RFC3339),
+		ExpiresAt:    formatTime(info.ExpiresAt),
+	}
+}
+
+// NewDatabaseInfoResponse describes a database without its credentials
+func NewDatabaseInfoResponse(info *project.DatabaseInfo) DatabaseInfoResponse {
+	return DatabaseInfoResponse{
+		Project:      info.Project,
+		Env:          info.Env,
+		PRNumber:     info.PRNumber,
+		DatabaseName: info.DatabaseName,
+		UserName:     info.UserName,
+		Server:       info.Server,
+		Host:         info.Host,
+		Port:         info.Port,
+		CreatedAt:    info.CreatedAt.Format(time.RFC3339),
+		ExpiresAt:    formatTime(info.ExpiresAt),
+		LastActivity: formatTime(info.LastActivity),
+		Protected:    info.Protected,
+	}
+}
+
+// NewSessionResponse describes a session connected to a database
+func NewSessionResponse(sess db.Session) SessionResponse {
+	return SessionResponse{
+		PID:        sess.PID,
+		User:       sess.User,
+		ClientAddr: sess.ClientAddr,
+		State:      sess.State,
+		QueryStart: formatTime(sess.QueryStart),
+		Query:      sess.Query,
+	}
+}
+
+// NewCleanupResponse describes the outcome of a cleanup run
+func NewCleanupResponse(result *project.CleanupResult) CleanupResponse {
+	warnings := make([]IdleWarningResponse, len(result.Warnings))
+	for i, idle := range result.Warnings {
+		warnings[i] = IdleWarningResponse{
+			DatabaseName: idle.DatabaseName,
+			Env:          idle.Env,
+			LastActivity: idle.LastActivity.Format(time.RFC3339),
+			IdleFor:      idle.IdleFor.String(),
+		}
+	}
+
+	deleted := result.Deleted
+	if deleted == nil {
+		deleted = []string{}
+	}
+	return CleanupResponse{
+		Deleted:  deleted,
+		Count:    len(result.Deleted),
+		Warnings: warnings,
+	}
+}
+
+// NewBackupResponse describes a stored backup
+func NewBackupResponse(b meta.Backup) BackupResponse {
+	return BackupResponse{
+		ID:           b.ID,
+		DatabaseName: b.DatabaseName,
+		Env:          b.Env,
+		Target:       b.Target,
+		Key:          b.Key,
+		Size:         b.Size,
+		Tables:       b.Tables,
+		Rows:         b.Rows,
+		CreatedAt:    b.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// NewBackupRunResponse reports the outcome of a backup run
+func NewBackupRunResponse(result *project.BackupRunResult) BackupRunResponse {
+	response := BackupRunResponse{
+		Created: backupResponses(result.Created),
+		Pruned:  backupResponses(result.Pruned),
+	}
+	for _, f := range result.Failed {
+		response.Failed = append(response.Failed, BackupFailureResponse{DatabaseName: f.DatabaseName, Error: f.Error})
+	}
+	return response
+}
+
+// NewRestoreResponse reports the outcome of a restore
+func NewRestoreResponse(result *project.RestoreResult) RestoreResponse {
+	return RestoreResponse{
+		DatabaseName: result.DatabaseName,
+		Source:       result.Source,
+		Created:      result.Created,
+		Tables:       result.Tables,
+		Rows:         result.Rows,
+	}
+}
+
+// formatTime formats an optional time as RFC 3339
+func formatTime(t *time.Time) *string {
+	if t == nil {
+		return nil
+	}
+	s := t.Format(time.RFC3339)
+	return &s
+}
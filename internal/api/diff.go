@@ -0,0 +1,57 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+)
+
+// diffDatabases compares the schemas of two environments. The format query
+// parameter selects JSON (the default), a text report, or the migration script.
+func (s *Server) diffDatabases(w http.ResponseWriter, r *http.Request) {
+	projectName := chi.URLParam(r, "name")
+	query := r.URL.Query()
+	if query.Get("from") == "" || query.Get("to") == "" {
+		writeError(w, http.StatusBadRequest, "from and to are required")
+		return
+	}
+	format := query.Get("format")
+	if format != "" && format != "json" && format != "text" && format != "sql" {
+		writeError(w, http.StatusBadRequest, "format must be json, text or sql")
+		return
+	}
+
+	fromEnv, fromPR, ok := parseEnvValue(w, query.Get("from"))
+	if !ok {
+		return
+	}
+	toEnv, toPR, ok := parseEnvValue(w, query.Get("to"))
+	if !ok {
+		return
+	}
+
+	diff, err := s.mgr.DiffDatabases(r.Context(), projectName, fromEnv, fromPR, toEnv, toPR)
+	if err != nil {
+		switch {
+		case strings.Contains(err.Error(), "not found"):
+			writeError(w, http.StatusNotFound, err.Error())
+		case strings.Contains(err.Error(), "invalid environment"):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeInternalError(w, "diffDatabases", err)
+		}
+		return
+	}
+
+	switch format {
+	case "text":
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+		w.Write([]byte(diff.Text()))
+	case "sql":
+		w.Header().Set("Content-Type", "application/sql; charset=utf-8")
+		w.Write([]byte(diff.SQL()))
+	default:
+		writeJSON(w, http.StatusOK, diff)
+	}
+}
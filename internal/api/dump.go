@@ -0,0 +1,111 @@
+package api
+
+import (
+	"errors"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"pgmanager/internal/db"
+	"pgmanager/internal/project"
+)
+
+// RestoreResponse reports the outcome of a restore
+type RestoreResponse struct {
+	DatabaseName string `json:"database_name"`
+	Source       string `json:"source"`
+	Created      bool   `json:"created"`
+	Tables       int    `json:"tables"`
+	Rows         int64  `json:"rows"`
+}
+
+// dumpWriter sets the download headers on the first write, so errors that occur
+// before any data is produced can still be reported as a JSON error response
+type dumpWriter struct {
+	w        http.ResponseWriter
+	filename string
+	started  bool
+}
+
+// Trailers sent after a dump, reporting what it contains
+const (
+	TrailerDumpTables = "X-Dump-Tables"
+	TrailerDumpRows   = "X-Dump-Rows"
+)
+
+func (d *dumpWriter) Write(p []byte) (int, error) {
+	if !d.started {
+		d.w.Header().Set("Content-Type", "application/gzip")
+		d.w.Header().Set("Content-Disposition", fmt.Sprintf("attachment; filename=%q", d.filename))
+		d.w.Header().Set("Trailer", TrailerDumpTables+", "+TrailerDumpRows)
+		d.w.WriteHeader(http.StatusOK)
+		d.started = true
+	}
+	return d.w.Write(p)
+}
+
+// disableDeadlines lifts the server's read and write timeouts for a streaming request
+func disableDeadlines(w http.ResponseWriter) {
+	rc := http.NewResponseController(w)
+	_ = rc.SetReadDeadline(time.Time{})
+	_ = rc.SetWriteDeadline(time.Time{})
+}
+
+func (s *Server) dumpDatabase(w http.ResponseWriter, r *http.Request) {
+	projectName := chi.URLParam(r, "name")
+	env, prNumber, ok := parseEnvParam(w, r)
+	if !ok {
+		return
+	}
+
+	disableDeadlines(w)
+	out := &dumpWriter{w: w, filename: fmt.Sprintf("%s_%s.dump.gz", projectName, chi.URLParam(r, "env"))}
+	stats, err := s.mgr.DumpDatabase(r.Context(), projectName, env, prNumber, out)
+	if err != nil {
+		if out.started {
+			// Too late for an error response; the truncated gzip stream fails to decode
+			log.Printf("ERROR [dumpDatabase]: %v", err)
+			return
+		}
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeInternalError(w, "dumpDatabase", err)
+		return
+	}
+
+	w.Header().Set(TrailerDumpTables, strconv.Itoa(stats.Tables))
+	w.Header().Set(TrailerDumpRows, strconv.FormatInt(stats.Rows, 10))
+}
+
+// restoreDatabase starts a restore job for an uploaded dump. The upload is read
+// in full before the response, so it is not cut off by the server's timeouts.
+func (s *Server) restoreDatabase(w http.ResponseWriter, r *http.Request) {
+	projectName := chi.URLParam(r, "name")
+	env, prNumber, ok := parseEnvParam(w, r)
+	if !ok {
+		return
+	}
+
+	disableDeadlines(w)
+	req := project.JobRequest{Kind: project.JobRestore, Project: projectName, Env: env, PRNumber: prNumber, Dump: r.Body}
+	s.startJob(w, r, "restoreDatabase", req, writeRestoreError)
+}
+
+// writeRestoreError reports a restore that cannot be started
+func writeRestoreError(w http.ResponseWriter, context string, err error) {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "not found"):
+		writeError(w, http.StatusNotFound, msg)
+	case errors.Is(err, db.ErrInvalidDump), strings.Contains(msg, "invalid environment"):
+		writeError(w, http.StatusBadRequest, msg)
+	default:
+		writeInternalError(w, context, err)
+	}
+}
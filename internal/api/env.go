@@ -0,0 +1,73 @@
+package api
+
+import (
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"pgmanager/internal/export"
+)
+
+// databaseEnv renders a database's connection details, including its password, in
+// one of the export formats. The query parameters mirror the flags of "db env":
+// format (default dotenv), prefix, var (NAME=NEW_NAME, repeatable) and name.
+func (s *Server) databaseEnv(w http.ResponseWriter, r *http.Request) {
+	if !principal(r).Authenticated() {
+		writeError(w, http.StatusForbidden, "credentials are only served to callers with an API token")
+		return
+	}
+
+	projectName := chi.URLParam(r, "name")
+	env, prNumber, ok := parseEnvParam(w, r)
+	if !ok {
+		return
+	}
+
+	query := r.URL.Query()
+	names, err := export.ParseNames(query["var"])
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	opts := export.Options{
+		Format: query.Get("format"),
+		Prefix: query.Get("prefix"),
+		Names:  names,
+		Name:   query.Get("name"),
+	}
+	if opts.Format == "" {
+		opts.Format = "dotenv"
+	}
+	if err := opts.Validate(); err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	info, err := s.mgr.GetDatabase(r.Context(), projectName, env, prNumber)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, "database not found")
+			return
+		}
+		writeInternalError(w, "databaseEnv", err)
+		return
+	}
+
+	out, err := export.Render(info.Connection(), opts)
+	if err != nil {
+		writeInternalError(w, "databaseEnv", err)
+		return
+	}
+
+	audit(r, "env", "database=%s format=%s", info.DatabaseName, opts.Format)
+
+	switch opts.Format {
+	case "json":
+		w.Header().Set("Content-Type", "application/json")
+	case "yaml", "k8s-secret", "compose":
+		w.Header().Set("Content-Type", "application/yaml")
+	default:
+		w.Header().Set("Content-Type", "text/plain; charset=utf-8")
+	}
+	w.Write(out)
+}
@@ -0,0 +1,116 @@
+package api
+
+import (
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/events"
+)
+
+const (
+	// eventHeartbeat is how often an idle event stream gets a comment, so that
+	// proxies and load balancers keep it open
+	eventHeartbeat = 25 * time.Second
+
+	// eventRetry is how long clients wait before reconnecting to a closed stream
+	eventRetry = 3 * time.Second
+
+	// EventReset tells a client that it missed events, because they are no
+	// longer in the server's log or the server restarted, so it should reload
+	// what it shows
+	EventReset = "reset"
+)
+
+// streamEvents streams lifecycle events as server-sent events. Each event has
+// the ID of its bus message, its name as the event type and the webhook
+// payload as data. Clients resume after the ID in the Last-Event-ID header,
+// or the last_event_id parameter where headers cannot be set, and only receive
+// events of projects they can read.
+func (s *Server) streamEvents(w http.ResponseWriter, r *http.Request) {
+	projectFilter := r.URL.Query().Get("project")
+	if projectFilter != "" && !requireProject(w, r, auth.ScopeRead, projectFilter) {
+		return
+	}
+
+	lastID := r.Header.Get("Last-Event-ID")
+	if lastID == "" {
+		lastID = r.URL.Query().Get("last_event_id")
+	}
+
+	var backlog []events.Message
+	var sub *events.Subscription
+	complete := true
+	if lastID != "" {
+		id, err := strconv.ParseInt(lastID, 10, 64)
+		if err != nil || id < 0 {
+			writeError(w, http.StatusBadRequest, "invalid Last-Event-ID: must be an event ID")
+			return
+		}
+		backlog, sub, complete = s.mgr.Events().Resume(id)
+	} else {
+		sub = s.mgr.Events().Subscribe()
+	}
+	defer sub.Close()
+
+	p := principal(r)
+	visible := func(msg events.Message) bool {
+		if projectFilter != "" && msg.Project != projectFilter {
+			return false
+		}
+		return p.CanOnProject(auth.ScopeRead, msg.Project)
+	}
+
+	disableDeadlines(w)
+	rc := http.NewResponseController(w)
+	w.Header().Set("Content-Type", "text/event-stream")
+	w.Header().Set("Cache-Control", "no-cache")
+	w.Header().Set("X-Accel-Buffering", "no") // Keep nginx from buffering the stream
+	w.WriteHeader(http.StatusOK)
+
+	fmt.Fprintf(w, "retry: %d\n\n", eventRetry.Milliseconds())
+	if !complete {
+		fmt.Fprintf(w, "event: %s\ndata: {}\n\n", EventReset)
+	}
+	for _, msg := range backlog {
+		if visible(msg) {
+			writeEvent(w, msg)
+		}
+	}
+	if err := rc.Flush(); err != nil {
+		return
+	}
+
+	heartbeat := time.NewTicker(eventHeartbeat)
+	defer heartbeat.Stop()
+	for {
+		select {
+		case <-r.Context().Done():
+			return
+		case <-s.shutdown:
+			return
+		case msg, ok := <-sub.C():
+			if !ok {
+				// Too far behind; the client reconnects and resumes from the log
+				return
+			}
+			if !visible(msg) {
+				continue
+			}
+			writeEvent(w, msg)
+		case <-heartbeat.C:
+			fmt.Fprint(w, ": keepalive\n\n")
+		}
+		if err := rc.Flush(); err != nil {
+			return
+		}
+	}
+}
+
+// writeEvent writes a bus message as a server-sent event. Payloads are
+// single-line JSON, so they fit in one data field.
+func writeEvent(w http.ResponseWriter, msg events.Message) {
+	fmt.Fprintf(w, "id: %d\nevent: %s\ndata: %s\n\n", msg.ID, msg.Event, msg.Data)
+}
@@ -0,0 +1,79 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+
+	"pgmanager/internal/project"
+	"pgmanager/internal/webhook"
+)
+
+// GitHub webhook headers
+const (
+	GitHubEventHeader     = "X-GitHub-Event"
+	GitHubDeliveryHeader  = "X-GitHub-Delivery"
+	GitHubSignatureHeader = "X-Hub-Signature-256"
+)
+
+// gitHubActions maps pull request actions to what they do to the PR database.
+// Other actions, such as labeled or edited, are ignored.
+var gitHubActions = map[string]string{
+	"opened":      project.PRActionCreate,
+	"reopened":    project.PRActionCreate,
+	"closed":      project.PRActionDelete,
+	"synchronize": project.PRActionExtend,
+}
+
+// gitHubPullRequestEvent holds the fields of a pull_request event we use
+type gitHubPullRequestEvent struct {
+	Action     string `json:"action"`
+	Number     int    `json:"number"`
+	Repository struct {
+		FullName string `json:"full_name"`
+	} `json:"repository"`
+}
+
+// githubWebhook receives pull request events from GitHub and creates, deletes
+// or extends the PR database of the repository's project accordingly
+func (s *Server) githubWebhook(w http.ResponseWriter, r *http.Request) {
+	body, ok := readEvent(w, r)
+	if !ok {
+		return
+	}
+
+	cfg := s.cfg.Integrations.GitHub
+	if !webhook.Verify(cfg.Secret, body, r.Header.Get(GitHubSignatureHeader)) {
+		writeError(w, http.StatusUnauthorized, "invalid signature")
+		return
+	}
+
+	resp := IntegrationResponse{Delivery: r.Header.Get(GitHubDeliveryHeader), Event: r.Header.Get(GitHubEventHeader)}
+	if resp.Delivery == "" {
+		writeError(w, http.StatusBadRequest, GitHubDeliveryHeader+" header is required")
+		return
+	}
+	if resp.Event != "pull_request" {
+		ignoreEvent(w, "github", resp, "not a pull_request event")
+		return
+	}
+
+	var event gitHubPullRequestEvent
+	if err := json.Unmarshal(body, &event); err != nil || event.Number <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid pull_request event")
+		return
+	}
+	resp.Event += "." + event.Action
+
+	resp.Project = cfg.Project(event.Repository.FullName)
+	if resp.Project == "" {
+		ignoreEvent(w, "github", resp, "repository "+event.Repository.FullName+" is not mapped to a project")
+		return
+	}
+	action, ok := gitHubActions[event.Action]
+	if !ok {
+		ignoreEvent(w, "github", resp, "action "+event.Action+" does not affect databases")
+		return
+	}
+
+	s.syncPullRequest(w, r, "github", resp, event.Number, action)
+}
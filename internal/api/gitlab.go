@@ -0,0 +1,92 @@
+package api
+
+import (
+	"crypto/subtle"
+	"encoding/json"
+	"net/http"
+
+	"pgmanager/internal/project"
+)
+
+// GitLab webhook headers. GitLab sends the same Idempotency-Key when it retries
+// a delivery; older versions only send X-Gitlab-Event-UUID.
+const (
+	GitLabEventHeader       = "X-Gitlab-Event"
+	GitLabTokenHeader       = "X-Gitlab-Token"
+	GitLabEventUUIDHeader   = "X-Gitlab-Event-UUID"
+	GitLabIdempotencyHeader = "Idempotency-Key"
+)
+
+// gitLabActions maps merge request actions to what they do to the PR database.
+// Other actions, such as approved or unapproved, are ignored.
+var gitLabActions = map[string]string{
+	"open":   project.PRActionCreate,
+	"reopen": project.PRActionCreate,
+	"close":  project.PRActionDelete,
+	"merge":  project.PRActionDelete,
+	"update": project.PRActionExtend,
+}
+
+// gitLabMergeRequestEvent holds the fields of a merge_request event we use
+type gitLabMergeRequestEvent struct {
+	ObjectKind string `json:"object_kind"`
+	Project    struct {
+		PathWithNamespace string `json:"path_with_namespace"`
+	} `json:"project"`
+	ObjectAttributes struct {
+		IID    int    `json:"iid"`
+		Action string `json:"action"`
+	} `json:"object_attributes"`
+}
+
+// gitlabWebhook receives merge request events from GitLab and creates, deletes
+// or extends the PR database of the project, keyed by the merge request IID
+func (s *Server) gitlabWebhook(w http.ResponseWriter, r *http.Request) {
+	cfg := s.cfg.Integrations.GitLab
+	if subtle.ConstantTimeCompare([]byte(r.Header.Get(GitLabTokenHeader)), []byte(cfg.Token)) != 1 {
+		writeError(w, http.StatusUnauthorized, "invalid token")
+		return
+	}
+
+	body, ok := readEvent(w, r)
+	if !ok {
+		return
+	}
+
+	resp := IntegrationResponse{Delivery: r.Header.Get(GitLabIdempotencyHeader), Event: r.Header.Get(GitLabEventHeader)}
+	if resp.Delivery == "" {
+		resp.Delivery = r.Header.Get(GitLabEventUUIDHeader)
+	}
+	if resp.Delivery == "" {
+		writeError(w, http.StatusBadRequest, GitLabEventUUIDHeader+" header is required")
+		return
+	}
+
+	var event gitLabMergeRequestEvent
+	if err := json.Unmarshal(body, &event); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid event")
+		return
+	}
+	if event.ObjectKind != "merge_request" {
+		ignoreEvent(w, "gitlab", resp, "not a merge_request event")
+		return
+	}
+	if event.ObjectAttributes.IID <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid merge_request event")
+		return
+	}
+	resp.Event = event.ObjectKind + "." + event.ObjectAttributes.Action
+
+	resp.Project = cfg.Project(event.Project.PathWithNamespace)
+	if resp.Project == "" {
+		ignoreEvent(w, "gitlab", resp, "project "+event.Project.PathWithNamespace+" is not mapped to a project")
+		return
+	}
+	action, ok := gitLabActions[event.ObjectAttributes.Action]
+	if !ok {
+		ignoreEvent(w, "gitlab", resp, "action "+event.ObjectAttributes.Action+" does not affect databases")
+		return
+	}
+
+	s.syncPullRequest(w, r, "gitlab", resp, event.ObjectAttributes.IID, action)
+}
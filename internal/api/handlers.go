@@ -2,13 +2,18 @@ package api
 
 import (
 	"encoding/json"
+	"errors"
 	"fmt"
+	"io"
 	"log"
 	"net/http"
 	"strconv"
+	"strings"
 	"time"
 
 	"github.com/go-chi/chi/v5"
+	"pgmanager/internal/auth"
+	"pgmanager/internal/project"
 )
 
 // MaxPRNumber is the maximum allowed PR number
@@ -20,8 +25,9 @@ type ErrorResponse struct {
 }
 
 type HealthResponse struct {
-	Status string `json:"status"`
-	Time   string `json:"time"`
+	Status   string `json:"status"`
+	Time     string `json:"time"`
+	LoginURL string `json:"login_url,omitempty"` // Set when users sign in with an identity provider
 }
 
 type ProjectResponse struct {
@@ -37,6 +43,7 @@ type DatabaseResponse struct {
 	DatabaseName string  `json:"database_name"`
 	UserName     string  `json:"user_name"`
 	Password     string  `json:"password"`
+	Server       string  `json:"server"`
 	Host         string  `json:"host"`
 	Port         int     `json:"port"`
 	ConnString   string  `json:"connection_string"`
@@ -51,10 +58,13 @@ type DatabaseInfoResponse struct {
 	PRNumber     *int    `json:"pr_number,omitempty"`
 	DatabaseName string  `json:"database_name"`
 	UserName     string  `json:"user_name"`
+	Server       string  `json:"server"`
 	Host         string  `json:"host"`
 	Port         int     `json:"port"`
 	CreatedAt    string  `json:"created_at"`
 	ExpiresAt    *string `json:"expires_at,omitempty"`
+	LastActivity *string `json:"last_activity,omitempty"`
+	Protected    bool    `json:"protected,omitempty"`
 }
 
 type CreateProjectRequest struct {
@@ -64,6 +74,27 @@ type CreateProjectRequest struct {
 type CreateDatabaseRequest struct {
 	Env      string `json:"env"`
 	PRNumber *int   `json:"number,omitempty"`
+	Server   string `json:"server,omitempty"` // Overrides the configured placement rules
+}
+
+// SessionResponse describes a session connected to a database
+type SessionResponse struct {
+	PID        int     `json:"pid"`
+	User       string  `json:"user"`
+	ClientAddr string  `json:"client_addr"`
+	State      string  `json:"state"`
+	QueryStart *string `json:"query_start,omitempty"`
+	Query      string  `json:"query"`
+}
+
+// ResetDatabaseRequest controls how a database is reset. An empty body uses the defaults.
+type ResetDatabaseRequest struct {
+	KeepDatabase bool `json:"keep_database"` // Drop schemas instead of recreating the database
+	SkipSeed     bool `json:"skip_seed"`     // Do not run the project's init and seed scripts
+}
+
+type KillSessionsResponse struct {
+	Terminated int `json:"terminated"`
 }
 
 type CleanupRequest struct {
@@ -71,8 +102,17 @@ type CleanupRequest struct {
 }
 
 type CleanupResponse struct {
-	Deleted []string `json:"deleted"`
-	Count   int      `json:"count"`
+	Deleted  []string              `json:"deleted"`
+	Count    int                   `json:"count"`
+	Warnings []IdleWarningResponse `json:"warnings,omitempty"`
+}
+
+// IdleWarningResponse reports a database matched by a "warn" cleanup rule
+type IdleWarningResponse struct {
+	DatabaseName string `json:"database_name"`
+	Env          string `json:"env"`
+	LastActivity string `json:"last_activity"`
+	IdleFor      string `json:"idle_for"`
 }
 
 // Helper functions
@@ -86,18 +126,27 @@ func writeError(w http.ResponseWriter, status int, message string) {
 	writeJSON(w, status, ErrorResponse{Error: message})
 }
 
-// writeInternalError logs the full error and returns a generic message to the client
+// writeInternalError logs the full error and returns a generic message to the
+// client. Permission errors, which the routes normally catch first, are 403.
 func writeInternalError(w http.ResponseWriter, context string, err error) {
+	if errors.Is(err, auth.ErrPermissionDenied) {
+		writeError(w, http.StatusForbidden, err.Error())
+		return
+	}
 	log.Printf("ERROR [%s]: %v", context, err)
 	writeError(w, http.StatusInternalServerError, "internal server error")
 }
 
 // Handlers
 func (s *Server) healthHandler(w http.ResponseWriter, r *http.Request) {
-	writeJSON(w, http.StatusOK, HealthResponse{
+	response := HealthResponse{
 		Status: "ok",
 		Time:   time.Now().UTC().Format(time.RFC3339),
-	})
+	}
+	if s.oidc != nil {
+		response.LoginURL = "/auth/login"
+	}
+	writeJSON(w, http.StatusOK, response)
 }
 
 func (s *Server) listProjects(w http.ResponseWriter, r *http.Request) {
@@ -109,10 +158,7 @@ func (s *Server) listProjects(w http.ResponseWriter, r *http.Request) {
 
 	response := make([]ProjectResponse, len(projects))
 	for i, p := range projects {
-		response[i] = ProjectResponse{
-			Name:      p.Name,
-			CreatedAt: p.CreatedAt.Format(time.RFC3339),
-		}
+		response[i] = NewProjectResponse(p)
 	}
 
 	writeJSON(w, http.StatusOK, response)
@@ -129,16 +175,17 @@ func (s *Server) createProject(w http.ResponseWriter, r *http.Request) {
 		writeError(w, http.StatusBadRequest, "name is required")
 		return
 	}
+	if !requireProject(w, r, auth.ScopeCreate, req.Name) {
+		return
+	}
 
-	if err := s.mgr.CreateProject(r.Context(), req.Name); err != nil {
+	p, err := s.mgr.CreateProject(r.Context(), req.Name)
+	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	writeJSON(w, http.StatusCreated, ProjectResponse{
-		Name:      req.Name,
-		CreatedAt: time.Now().UTC().Format(time.RFC3339),
-	})
+	writeJSON(w, http.StatusCreated, NewProjectResponse(*p))
 }
 
 func (s *Server) deleteProject(w http.ResponseWriter, r *http.Request) {
@@ -150,6 +197,10 @@ func (s *Server) deleteProject(w http.ResponseWriter, r *http.Request) {
 			writeError(w, http.StatusNotFound, "project not found")
 			return
 		}
+		if strings.Contains(err.Error(), "is protected") {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
 		writeInternalError(w, "deleteProject", err)
 		return
 	}
@@ -173,24 +224,8 @@ func (s *Server) listDatabases(w http.ResponseWriter, r *http.Request) {
 
 	// Return DatabaseInfoResponse without password/connection string
 	response := make([]DatabaseInfoResponse, len(databases))
-	for i, db := range databases {
-		var expiresAt *string
-		if db.ExpiresAt != nil {
-			t := db.ExpiresAt.Format(time.RFC3339)
-			expiresAt = &t
-		}
-
-		response[i] = DatabaseInfoResponse{
-			Project:      db.Project,
-			Env:          db.Env,
-			PRNumber:     db.PRNumber,
-			DatabaseName: db.DatabaseName,
-			UserName:     db.UserName,
-			Host:         db.Host,
-			Port:         db.Port,
-			CreatedAt:    db.CreatedAt.Format(time.RFC3339),
-			ExpiresAt:    expiresAt,
-		}
+	for i := range databases {
+		response[i] = NewDatabaseInfoResponse(&databases[i])
 	}
 
 	writeJSON(w, http.StatusOK, response)
@@ -222,50 +257,20 @@ func (s *Server) createDatabase(w http.ResponseWriter, r *http.Request) {
 		}
 	}
 
-	info, err := s.mgr.CreateDatabase(r.Context(), projectName, req.Env, req.PRNumber)
+	info, err := s.mgr.CreateDatabase(r.Context(), projectName, req.Env, req.PRNumber, req.Server)
 	if err != nil {
 		writeError(w, http.StatusBadRequest, err.Error())
 		return
 	}
 
-	var expiresAt *string
-	if info.ExpiresAt != nil {
-		t := info.ExpiresAt.Format(time.RFC3339)
-		expiresAt = &t
-	}
-
-	writeJSON(w, http.StatusCreated, DatabaseResponse{
-		Project:      info.Project,
-		Env:          info.Env,
-		PRNumber:     info.PRNumber,
-		DatabaseName: info.DatabaseName,
-		UserName:     info.UserName,
-		Password:     info.Password,
-		Host:         info.Host,
-		Port:         info.Port,
-		ConnString:   info.ConnString,
-		CreatedAt:    info.CreatedAt.Format(time.RFC3339),
-		ExpiresAt:    expiresAt,
-	})
+	writeJSON(w, http.StatusCreated, NewDatabaseResponse(info))
 }
 
 func (s *Server) getDatabase(w http.ResponseWriter, r *http.Request) {
 	projectName := chi.URLParam(r, "name")
-	env := chi.URLParam(r, "env")
-
-	// Check if env contains PR number (format: pr_123)
-	var prNumber *int
-	if len(env) > 3 && env[:3] == "pr_" {
-		num, err := strconv.Atoi(env[3:])
-		if err == nil {
-			// Validate PR number bounds
-			if num <= 0 || num > MaxPRNumber {
-				writeError(w, http.StatusBadRequest, "invalid PR number")
-				return
-			}
-			prNumber = &num
-			env = "pr"
-		}
+	env, prNumber, ok := parseEnvParam(w, r)
+	if !ok {
+		return
 	}
 
 	info, err := s.mgr.GetDatabase(r.Context(), projectName, env, prNumber)
@@ -274,46 +279,22 @@ func (s *Server) getDatabase(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	var expiresAt *string
-	if info.ExpiresAt != nil {
-		t := info.ExpiresAt.Format(time.RFC3339)
-		expiresAt = &t
-	}
-
 	// Return DatabaseInfoResponse without password/connection string
-	writeJSON(w, http.StatusOK, DatabaseInfoResponse{
-		Project:      info.Project,
-		Env:          info.Env,
-		PRNumber:     info.PRNumber,
-		DatabaseName: info.DatabaseName,
-		UserName:     info.UserName,
-		Host:         info.Host,
-		Port:         info.Port,
-		CreatedAt:    info.CreatedAt.Format(time.RFC3339),
-		ExpiresAt:    expiresAt,
-	})
+	writeJSON(w, http.StatusOK, NewDatabaseInfoResponse(info))
 }
 
 func (s *Server) deleteDatabase(w http.ResponseWriter, r *http.Request) {
 	projectName := chi.URLParam(r, "name")
-	env := chi.URLParam(r, "env")
-
-	// Check if env contains PR number (format: pr_123)
-	var prNumber *int
-	if len(env) > 3 && env[:3] == "pr_" {
-		num, err := strconv.Atoi(env[3:])
-		if err == nil {
-			// Validate PR number bounds
-			if num <= 0 || num > MaxPRNumber {
-				writeError(w, http.StatusBadRequest, "invalid PR number")
-				return
-			}
-			prNumber = &num
-			env = "pr"
-		}
+	env, prNumber, ok := parseEnvParam(w, r)
+	if !ok {
+		return
 	}
 
 	if err := s.mgr.DeleteDatabase(r.Context(), projectName, env, prNumber); err != nil {
+		if strings.Contains(err.Error(), "is protected") {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
 		writeError(w, http.StatusNotFound, "database not found")
 		return
 	}
@@ -321,6 +302,92 @@ func (s *Server) deleteDatabase(w http.ResponseWriter, r *http.Request) {
 	w.WriteHeader(http.StatusNoContent)
 }
 
+func (s *Server) resetDatabase(w http.ResponseWriter, r *http.Request) {
+	projectName := chi.URLParam(r, "name")
+	env, prNumber, ok := parseEnvParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req ResetDatabaseRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	opts := project.ResetOptions{KeepDatabase: req.KeepDatabase, SkipSeed: req.SkipSeed}
+	if err := s.mgr.ResetDatabase(r.Context(), projectName, env, prNumber, opts); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, "database not found")
+			return
+		}
+		if strings.Contains(err.Error(), "is protected") {
+			writeError(w, http.StatusConflict, err.Error())
+			return
+		}
+		writeInternalError(w, "resetDatabase", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func (s *Server) listSessions(w http.ResponseWriter, r *http.Request) {
+	projectName := chi.URLParam(r, "name")
+	env, prNumber, ok := parseEnvParam(w, r)
+	if !ok {
+		return
+	}
+
+	sessions, err := s.mgr.ListSessions(r.Context(), projectName, env, prNumber)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, "database not found")
+			return
+		}
+		writeInternalError(w, "listSessions", err)
+		return
+	}
+
+	response := make([]SessionResponse, len(sessions))
+	for i, sess := range sessions {
+		response[i] = NewSessionResponse(sess)
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) killSessions(w http.ResponseWriter, r *http.Request) {
+	projectName := chi.URLParam(r, "name")
+	env, prNumber, ok := parseEnvParam(w, r)
+	if !ok {
+		return
+	}
+
+	// Without a pid every session on the database is terminated
+	pid := 0
+	if pidStr := chi.URLParam(r, "pid"); pidStr != "" {
+		num, err := strconv.Atoi(pidStr)
+		if err != nil || num <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid pid")
+			return
+		}
+		pid = num
+	}
+
+	n, err := s.mgr.KillSessions(r.Context(), projectName, env, prNumber, pid)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeInternalError(w, "killSessions", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, KillSessionsResponse{Terminated: n})
+}
+
 func (s *Server) cleanup(w http.ResponseWriter, r *http.Request) {
 	var req CleanupRequest
 	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
@@ -338,16 +405,29 @@ func (s *Server) cleanup(w http.ResponseWriter, r *http.Request) {
 		return
 	}
 
-	deleted, err := s.mgr.Cleanup(r.Context(), duration)
-	if err != nil {
-		writeInternalError(w, "cleanup", err)
-		return
-	}
+	s.startJob(w, r, "cleanup", project.JobRequest{Kind: project.JobCleanup, OlderThan: duration}, writeInternalError)
+}
+
+// parseEnvParam reads the {env} URL parameter, which may carry a PR number (format: pr_123).
+// It writes a 400 response and returns ok=false if the PR number is out of bounds.
+func parseEnvParam(w http.ResponseWriter, r *http.Request) (env string, prNumber *int, ok bool) {
+	return parseEnvValue(w, chi.URLParam(r, "env"))
+}
 
-	writeJSON(w, http.StatusOK, CleanupResponse{
-		Deleted: deleted,
-		Count:   len(deleted),
-	})
+// parseEnvValue parses an environment name that may be a PR environment (pr_123)
+func parseEnvValue(w http.ResponseWriter, env string) (string, *int, bool) {
+	if len(env) > 3 && env[:3] == "pr_" {
+		num, err := strconv.Atoi(env[3:])
+		if err == nil {
+			// Validate PR number bounds
+			if num <= 0 || num > MaxPRNumber {
+				writeError(w, http.StatusBadRequest, "invalid PR number")
+				return "", nil, false
+			}
+			return "pr", &num, true
+		}
+	}
+	return env, nil, true
 }
 
 // parseDuration parses a duration string like "7d", "24h", "1w"
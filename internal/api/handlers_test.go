@@ -1,15 +1,26 @@
 package api
 
 import (
+	"bufio"
 	"bytes"
+	"context"
 	"encoding/json"
+	"fmt"
 	"net/http"
 	"net/http/httptest"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
 	"testing"
+	"time"
 
 	"pgmanager/internal/config"
 	"pgmanager/internal/meta"
+	"pgmanager/internal/oidc/oidctest"
 	"pgmanager/internal/project"
+	"pgmanager/internal/webhook"
 )
 
 func setupTestServer(t *testing.T) (*Server, func()) {
@@ -33,7 +44,14 @@ func setupTestServer(t *testing.T) (*Server, func()) {
 	mgr := project.NewManager(cfg, store)
 	server := NewServer(cfg, mgr, cfg.API.Port)
 
+	// Long operations run as jobs, as they do in 'serve'
+	ctx, stop := context.WithCancel(context.Background())
+	if err := mgr.StartJobs(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
 	cleanup := func() {
+		stop()
 		store.Close()
 	}
 
@@ -278,3 +296,1222 @@ func TestParseDuration(t *testing.T) {
 		})
 	}
 }
+
+func TestSessionEndpoints(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		want   int
+	}{
+		{"list sessions unknown project", "GET", "/api/projects/nope/databases/dev/sessions", http.StatusNotFound},
+		{"kill sessions unknown project", "DELETE", "/api/projects/nope/databases/dev/sessions", http.StatusNotFound},
+		{"kill session invalid pid", "DELETE", "/api/projects/nope/databases/dev/sessions/abc", http.StatusBadRequest},
+		{"list sessions invalid PR number", "GET", "/api/projects/nope/databases/pr_0/sessions", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+
+			server.Router().ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDumpRestoreEndpoints(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+	if _, err := server.mgr.CreateProject(context.Background(), "myapp"); err != nil {
+		t.Fatal(err)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"dump unknown project", "GET", "/api/projects/nope/databases/dev/dump", "", http.StatusNotFound},
+		{"dump invalid PR number", "GET", "/api/projects/nope/databases/pr_0/dump", "", http.StatusBadRequest},
+		{"restore non-dump body", "POST", "/api/projects/myapp/databases/dev/restore", "not a dump", http.StatusBadRequest},
+		{"restore into unknown project", "POST", "/api/projects/nope/databases/dev/restore", "not a dump", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+
+			server.Router().ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestBackupEndpoints(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"list all backups", "GET", "/api/backups", "", http.StatusOK},
+		{"list database backups", "GET", "/api/projects/myapp/databases/prod/backups", "", http.StatusOK},
+		{"list backups invalid env", "GET", "/api/projects/myapp/databases/qa/backups", "", http.StatusBadRequest},
+		{"back up unknown project", "POST", "/api/projects/nope/databases/prod/backups", "", http.StatusNotFound},
+		{"run without schedules", "POST", "/api/backups/run", "", http.StatusConflict},
+		{"restore invalid id", "POST", "/api/backups/abc/restore", `{"project":"myapp","env":"dev"}`, http.StatusBadRequest},
+		{"restore missing env", "POST", "/api/backups/1/restore", `{"project":"myapp"}`, http.StatusBadRequest},
+		{"restore unknown backup", "POST", "/api/backups/1/restore", `{"project":"myapp","env":"dev"}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+
+			server.Router().ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestResetDatabaseEndpoint(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"unknown database", "", http.StatusNotFound},
+		{"unknown database with options", `{"keep_database": true, "skip_seed": true}`, http.StatusNotFound},
+		{"invalid body", `{"keep_database": "yes"}`, http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/projects/nope/databases/dev/reset", bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+
+			server.Router().ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestMigrationAndMoveEndpoints(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		body   string
+		want   int
+	}{
+		{"status without migrations directory", "GET", "/api/projects/nope/databases/dev/migrations", "", http.StatusBadRequest},
+		{"migrate without migrations directory", "POST", "/api/projects/nope/databases/dev/migrations/up", "", http.StatusBadRequest},
+		{"migrate down invalid body", "POST", "/api/projects/nope/databases/dev/migrations/down", `{"steps": "all"}`, http.StatusBadRequest},
+		{"move without target", "POST", "/api/projects/nope/databases/dev/move", `{}`, http.StatusBadRequest},
+		{"move unknown database", "POST", "/api/projects/nope/databases/dev/move", `{"target": "replica"}`, http.StatusNotFound},
+		{"abort unknown database", "DELETE", "/api/projects/nope/databases/dev/move", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+
+			server.Router().ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestManifestEndpoints(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	manifest := "projects:\n  myapp:\n    environments:\n      prod:\n        protected: true\n"
+
+	tests := []struct {
+		name string
+		path string
+		body string
+		want int
+	}{
+		{"plan", "/api/plan", manifest, http.StatusOK},
+		{"plan with prune", "/api/plan?prune=true", manifest, http.StatusOK},
+		{"invalid prune", "/api/plan?prune=maybe", manifest, http.StatusBadRequest},
+		{"unknown field", "/api/plan", "projects:\n  myapp:\n    envs: {}\n", http.StatusBadRequest},
+		{"invalid project name", "/api/plan", "projects:\n  MyApp: {}\n", http.StatusBadRequest},
+		{"apply invalid manifest", "/api/apply", "projects: [", http.StatusBadRequest},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", tt.path, bytes.NewBufferString(tt.body))
+			w := httptest.NewRecorder()
+
+			server.Router().ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	req := httptest.NewRequest("POST", "/api/plan", bytes.NewBufferString(manifest))
+	w := httptest.NewRecorder()
+	server.Router().ServeHTTP(w, req)
+
+	var plan PlanResponse
+	if err := json.NewDecoder(w.Body).Decode(&plan); err != nil {
+		t.Fatalf("failed to decode plan: %v", err)
+	}
+	if len(plan.Changes) != 3 || plan.Changes[0].Kind != "project" || plan.Changes[2].Detail != "protected, no ttl" {
+		t.Errorf("plan = %+v", plan)
+	}
+}
+
+func TestProtectedDatabaseEndpoints(t *testing.T) {
+	cfg := &config.Config{API: config.APIConfig{Port: 8080}}
+	store := meta.NewMockStore()
+	server := NewServer(cfg, project.NewManager(cfg, store), cfg.API.Port)
+
+	ctx := context.Background()
+	p, _ := store.CreateProject(ctx, "myapp")
+	store.CreateDatabase(ctx, p.ID, "myapp_prod", "myapp_prod_user", "pw", "prod", "default", nil, nil)
+	store.UpdateDatabasePolicy(ctx, "myapp_prod", true, nil)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+	}{
+		{"delete database", "DELETE", "/api/projects/myapp/databases/prod"},
+		{"reset database", "POST", "/api/projects/myapp/databases/prod/reset"},
+		{"delete project", "DELETE", "/api/projects/myapp"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest(tt.method, tt.path, nil)
+			w := httptest.NewRecorder()
+
+			server.Router().ServeHTTP(w, req)
+
+			if w.Code != http.StatusConflict {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, http.StatusConflict, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestDiffEndpoint(t *testing.T) {
+	server, cleanup := setupTestServer(t)
+	defer cleanup()
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"missing to", "?from=dev", http.StatusBadRequest},
+		{"invalid format", "?from=dev&to=prod&format=xml", http.StatusBadRequest},
+		{"invalid PR number", "?from=dev&to=pr_0", http.StatusBadRequest},
+		{"invalid environment", "?from=dev&to=qa", http.StatusBadRequest},
+		{"unknown project", "?from=dev&to=prod", http.StatusNotFound},
+		{"unknown project as sql", "?from=dev&to=pr_3&format=sql", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/projects/nope/diff"+tt.query, nil)
+			w := httptest.NewRecorder()
+
+			server.Router().ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestQueryEndpoint(t *testing.T) {
+	t.Run("requires a configured token", func(t *testing.T) {
+		server, cleanup := setupTestServer(t)
+		defer cleanup()
+
+		req := httptest.NewRequest("POST", "/api/projects/nope/databases/dev/query", bytes.NewBufferString(`{"sql": "SELECT 1"}`))
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+		}
+	})
+
+	cfg := &config.Config{API: config.APIConfig{Port: 8080, Token: "secret-token"}}
+	store := meta.NewMockStore()
+	defer store.Close()
+	server := NewServer(cfg, project.NewManager(cfg, store), cfg.API.Port)
+
+	tests := []struct {
+		name string
+		body string
+		want int
+	}{
+		{"invalid body", `{"sql": 1}`, http.StatusBadRequest},
+		{"empty sql", `{"sql": "  "}`, http.StatusBadRequest},
+		{"negative limit", `{"sql": "SELECT 1", "max_rows": -1}`, http.StatusBadRequest},
+		{"unknown database", `{"sql": "SELECT 1", "read_only": true}`, http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("POST", "/api/projects/nope/databases/dev/query", bytes.NewBufferString(tt.body))
+			req.Header.Set("Authorization", "Bearer secret-token")
+			w := httptest.NewRecorder()
+
+			server.Router().ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestQueryLimits(t *testing.T) {
+	rows, timeout, err := queryLimits(QueryRequest{})
+	if err != nil || rows != DefaultQueryRows || timeout != DefaultQueryTimeout {
+		t.Errorf("queryLimits(defaults) = %d, %s, %v", rows, timeout, err)
+	}
+	rows, timeout, err = queryLimits(QueryRequest{MaxRows: 1000000, Timeout: 3600})
+	if err != nil || rows != MaxQueryRows || timeout != MaxQueryTimeout {
+		t.Errorf("queryLimits(too large) = %d, %s, %v", rows, timeout, err)
+	}
+}
+
+func TestDatabaseEnvEndpoint(t *testing.T) {
+	t.Run("requires a configured token", func(t *testing.T) {
+		server, cleanup := setupTestServer(t)
+		defer cleanup()
+
+		req := httptest.NewRequest("GET", "/api/projects/nope/databases/dev/env", nil)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+
+		if w.Code != http.StatusForbidden {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusForbidden)
+		}
+	})
+
+	cfg := &config.Config{API: config.APIConfig{Port: 8080, Token: "secret-token"}}
+	store := meta.NewMockStore()
+	defer store.Close()
+	server := NewServer(cfg, project.NewManager(cfg, store), cfg.API.Port)
+
+	tests := []struct {
+		name  string
+		query string
+		want  int
+	}{
+		{"invalid format", "?format=toml", http.StatusBadRequest},
+		{"invalid rename", "?var=DATABASE_URL", http.StatusBadRequest},
+		{"invalid prefix", "?prefix=1X", http.StatusBadRequest},
+		{"unknown database", "?format=k8s-secret&var=DATABASE_URL=DB_URL", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			req := httptest.NewRequest("GET", "/api/projects/nope/databases/dev/env"+tt.query, nil)
+			req.Header.Set("Authorization", "Bearer secret-token")
+			w := httptest.NewRecorder()
+
+			server.Router().ServeHTTP(w, req)
+
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestTokenEndpoints(t *testing.T) {
+	cfg := &config.Config{API: config.APIConfig{Port: 8080, Token: "secret-token"}}
+	store := meta.NewMockStore()
+	defer store.Close()
+	server := NewServer(cfg, project.NewManager(cfg, store), cfg.API.Port)
+
+	ctx := context.Background()
+	store.CreateProject(ctx, "myapp")
+	store.CreateProject(ctx, "other")
+
+	send := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		return w
+	}
+	create := func(body string) string {
+		w := send("POST", "/api/tokens", "secret-token", body)
+		if w.Code != http.StatusCreated {
+			t.Fatalf("create token: status = %d, body: %s", w.Code, w.Body.String())
+		}
+		var resp TokenResponse
+		if err := json.NewDecoder(w.Body).Decode(&resp); err != nil {
+			t.Fatalf("failed to decode token: %v", err)
+		}
+		return resp.Secret
+	}
+
+	reader := create(`{"name": "reader", "scopes": ["read"]}`)
+	scoped := create(`{"name": "ci", "scopes": ["read,create,delete"], "projects": ["myapp"], "expires_in": "90d"}`)
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		want   int
+	}{
+		{"duplicate name", "POST", "/api/tokens", "secret-token", `{"name": "reader", "scopes": ["read"]}`, http.StatusConflict},
+		{"invalid scope", "POST", "/api/tokens", "secret-token", `{"name": "x", "scopes": ["write"]}`, http.StatusBadRequest},
+		{"invalid expiry", "POST", "/api/tokens", "secret-token", `{"name": "x", "scopes": ["read"], "expires_in": "soon"}`, http.StatusBadRequest},
+		{"read with read scope", "GET", "/api/projects/myapp/databases", reader, "", http.StatusOK},
+		{"delete with read scope", "DELETE", "/api/projects/myapp", reader, "", http.StatusForbidden},
+		{"tokens need admin", "GET", "/api/tokens", reader, "", http.StatusForbidden},
+		{"query needs admin", "POST", "/api/projects/myapp/databases/dev/query", reader, `{"sql": "SELECT 1"}`, http.StatusForbidden},
+		{"own project", "GET", "/api/projects/myapp/databases", scoped, "", http.StatusOK},
+		{"other project", "GET", "/api/projects/other/databases", scoped, "", http.StatusForbidden},
+		{"create other project", "POST", "/api/projects", scoped, `{"name": "third"}`, http.StatusForbidden},
+		{"restore into other project", "POST", "/api/backups/1/restore", scoped, `{"project": "other", "env": "dev"}`, http.StatusForbidden},
+		{"cleanup spans projects", "POST", "/api/cleanup", scoped, `{}`, http.StatusForbidden},
+		{"unknown token", "GET", "/api/projects", "pgm_unknown", "", http.StatusUnauthorized},
+		{"revoke unknown", "DELETE", "/api/tokens/nope", "secret-token", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(tt.method, tt.path, tt.token, tt.body)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("projects are filtered", func(t *testing.T) {
+		w := send("GET", "/api/projects", scoped, "")
+		var projects []ProjectResponse
+		if err := json.NewDecoder(w.Body).Decode(&projects); err != nil {
+			t.Fatalf("failed to decode projects: %v", err)
+		}
+		if len(projects) != 1 || projects[0].Name != "myapp" {
+			t.Errorf("projects = %+v, want only myapp", projects)
+		}
+	})
+
+	t.Run("list omits secrets", func(t *testing.T) {
+		w := send("GET", "/api/tokens", "secret-token", "")
+		if w.Code != http.StatusOK || bytes.Contains(w.Body.Bytes(), []byte(reader)) || bytes.Contains(w.Body.Bytes(), []byte(`"secret"`)) {
+			t.Errorf("status = %d, body: %s", w.Code, w.Body.String())
+		}
+	})
+
+	t.Run("revoked token", func(t *testing.T) {
+		if w := send("DELETE", "/api/tokens/reader", "secret-token", ""); w.Code != http.StatusNoContent {
+			t.Fatalf("revoke: status = %d, body: %s", w.Code, w.Body.String())
+		}
+		if w := send("GET", "/api/projects", reader, ""); w.Code != http.StatusUnauthorized {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusUnauthorized)
+		}
+	})
+}
+
+func TestAccessEndpoints(t *testing.T) {
+	cfg := &config.Config{API: config.APIConfig{Port: 8080, Token: "secret-token"}}
+	store := meta.NewMockStore()
+	defer store.Close()
+	mgr := project.NewManager(cfg, store)
+	server := NewServer(cfg, mgr, cfg.API.Port)
+
+	ctx := context.Background()
+	a, _ := store.CreateProject(ctx, "app_a")
+	store.CreateProject(ctx, "app_b")
+	store.CreateDatabase(ctx, a.ID, "app_a_dev", "app_a_dev_user", "pw", "dev", "default", nil, nil)
+	_, teamA, _ := mgr.CreateToken(ctx, project.TokenOptions{Name: "team-a", Scopes: []string{"admin"}})
+
+	send := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("PUT", "/api/projects/app_a/access/team-a", "secret-token", `{"role": "maintainer"}`); w.Code != http.StatusOK {
+		t.Fatalf("grant: status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		want   int
+	}{
+		{"invalid role", "PUT", "/api/projects/app_a/access/team-b", "secret-token", `{"role": "owner"}`, http.StatusBadRequest},
+		{"unknown project", "PUT", "/api/projects/nope/access/team-b", "secret-token", `{"role": "viewer"}`, http.StatusNotFound},
+		{"revoke unknown", "DELETE", "/api/projects/app_a/access/team-b", "secret-token", "", http.StatusNotFound},
+		{"own database", "GET", "/api/projects/app_a/databases", teamA, "", http.StatusOK},
+		{"other team's databases", "GET", "/api/projects/app_b/databases", teamA, "", http.StatusForbidden},
+		{"delete other team's project", "DELETE", "/api/projects/app_b", teamA, "", http.StatusForbidden},
+		{"query needs admin role", "POST", "/api/projects/app_a/databases/dev/query", teamA, `{"sql": "SELECT 1"}`, http.StatusForbidden},
+		{"grant needs admin role", "PUT", "/api/projects/app_a/access/team-b", teamA, `{"role": "admin"}`, http.StatusForbidden},
+		{"list roles of own project", "GET", "/api/projects/app_a/access", teamA, "", http.StatusOK},
+		{"tokens span projects", "GET", "/api/tokens", teamA, "", http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(tt.method, tt.path, tt.token, tt.body)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("lists are filtered", func(t *testing.T) {
+		var projects []ProjectResponse
+		json.NewDecoder(send("GET", "/api/projects", teamA, "").Body).Decode(&projects)
+		if len(projects) != 1 || projects[0].Name != "app_a" {
+			t.Errorf("projects = %+v, want only app_a", projects)
+		}
+
+		var bindings []AccessResponse
+		json.NewDecoder(send("GET", "/api/access", "secret-token", "").Body).Decode(&bindings)
+		if len(bindings) != 1 || bindings[0].Subject != "team-a" || bindings[0].Role != "maintainer" {
+			t.Errorf("bindings = %+v", bindings)
+		}
+	})
+
+	t.Run("revoke", func(t *testing.T) {
+		if w := send("DELETE", "/api/projects/app_a/access/team-a", "secret-token", ""); w.Code != http.StatusNoContent {
+			t.Fatalf("status = %d, body: %s", w.Code, w.Body.String())
+		}
+		// Without bindings only the token's scopes apply again
+		if w := send("GET", "/api/projects/app_b/databases", teamA, ""); w.Code != http.StatusOK {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+	})
+}
+
+func TestOIDCAuthentication(t *testing.T) {
+	iss := oidctest.NewIssuer("pgmanager", "client-secret")
+	defer iss.Close()
+
+	cfg := &config.Config{API: config.APIConfig{Port: 8080, Token: "secret-token", OIDC: config.OIDCConfig{
+		Issuer:       iss.URL,
+		ClientID:     "pgmanager",
+		ClientSecret: "client-secret",
+		RedirectURL:  "http://pgm.example.com/auth/callback",
+		GroupRoles: []config.GroupRole{
+			{Group: "dba", Role: "admin"},
+			{Group: "team-a", Project: "app_a", Role: "developer"},
+		},
+	}}}
+	store := meta.NewMockStore()
+	defer store.Close()
+	server := NewServer(cfg, project.NewManager(cfg, store), cfg.API.Port)
+
+	ctx := context.Background()
+	store.CreateProject(ctx, "app_a")
+	store.CreateProject(ctx, "app_b")
+
+	dba := iss.Token(map[string]any{"email": "dba@example.com", "email_verified": true, "groups": []string{"dba"}})
+	dev := iss.Token(map[string]any{"email": "dev@example.com", "email_verified": true, "groups": []string{"team-a"}})
+	outsider := iss.Token(map[string]any{"email": "someone@example.com", "email_verified": true})
+	wrongAudience := iss.Token(map[string]any{"email": "dev@example.com", "email_verified": true, "aud": "other"})
+	// Claims an address it does not own; it is known by its subject instead
+	impostor := iss.Token(map[string]any{"sub": "666", "email": "dev@example.com", "email_verified": false})
+
+	send := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		return w
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"group role on project", "GET", "/api/projects/app_a/databases", dev, http.StatusOK},
+		{"no role on other project", "GET", "/api/projects/app_b/databases", dev, http.StatusForbidden},
+		{"developer cannot delete", "DELETE", "/api/projects/app_a", dev, http.StatusForbidden},
+		{"admin group spans projects", "GET", "/api/tokens", dba, http.StatusOK},
+		{"developer cannot list tokens", "GET", "/api/tokens", dev, http.StatusForbidden},
+		{"user without groups", "GET", "/api/projects/app_a/databases", outsider, http.StatusForbidden},
+		{"wrong audience", "GET", "/api/projects", wrongAudience, http.StatusUnauthorized},
+		{"config token still works", "GET", "/api/tokens", "secret-token", http.StatusOK},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(tt.method, tt.path, tt.token)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+
+	t.Run("access bindings apply to users", func(t *testing.T) {
+		req := httptest.NewRequest("PUT", "/api/projects/app_b/access/user:dev@example.com", bytes.NewBufferString(`{"role": "viewer"}`))
+		req.Header.Set("Authorization", "Bearer secret-token")
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		if w.Code != http.StatusOK {
+			t.Fatalf("grant: status = %d, body: %s", w.Code, w.Body.String())
+		}
+		if w := send("GET", "/api/projects/app_b/databases", dev); w.Code != http.StatusOK {
+			t.Errorf("status = %d, want %d", w.Code, http.StatusOK)
+		}
+		if w := send("GET", "/api/projects/app_b/databases", impostor); w.Code != http.StatusForbidden {
+			t.Errorf("unverified e-mail: status = %d, want %d", w.Code, http.StatusForbidden)
+		}
+	})
+
+	t.Run("web login", func(t *testing.T) {
+		iss.SetClaims(map[string]any{"sub": "7", "email": "dev@example.com", "email_verified": true, "groups": []string{"team-a"}})
+
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, httptest.NewRequest("GET", "/auth/login", nil))
+		if w.Code != http.StatusFound {
+			t.Fatalf("login: status = %d", w.Code)
+		}
+		loginCookies := w.Result().Cookies()
+
+		// The stand-in issuer approves the login and redirects back with a code
+		client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+		resp, err := client.Get(w.Header().Get("Location"))
+		if err != nil {
+			t.Fatal(err)
+		}
+		resp.Body.Close()
+		callback, _ := url.Parse(resp.Header.Get("Location"))
+
+		// A forged state is rejected
+		forged := httptest.NewRequest("GET", "/auth/callback?code=x&state=forged", nil)
+		for _, c := range loginCookies {
+			forged.AddCookie(c)
+		}
+		w = httptest.NewRecorder()
+		server.Router().ServeHTTP(w, forged)
+		if w.Code != http.StatusBadRequest {
+			t.Errorf("forged state: status = %d, want %d", w.Code, http.StatusBadRequest)
+		}
+
+		req := httptest.NewRequest("GET", "/auth/callback?"+callback.RawQuery, nil)
+		for _, c := range loginCookies {
+			req.AddCookie(c)
+		}
+		w = httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		if w.Code != http.StatusFound {
+			t.Fatalf("callback: status = %d, body: %s", w.Code, w.Body.String())
+		}
+
+		var session *http.Cookie
+		for _, c := range w.Result().Cookies() {
+			if c.Name == sessionCookie {
+				session = c
+			}
+		}
+		if session == nil || !session.HttpOnly || session.SameSite != http.SameSiteStrictMode {
+			t.Fatalf("session cookie = %+v", session)
+		}
+
+		req = httptest.NewRequest("GET", "/api/me", nil)
+		req.AddCookie(session)
+		w = httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		var me MeResponse
+		json.NewDecoder(w.Body).Decode(&me)
+		if w.Code != http.StatusOK || me.Name != "user:dev@example.com" || me.Roles["app_a"] != "developer" {
+			t.Errorf("me: status = %d, response = %+v", w.Code, me)
+		}
+	})
+
+	t.Run("health advertises login", func(t *testing.T) {
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, httptest.NewRequest("GET", "/api/health", nil))
+		var health HealthResponse
+		json.NewDecoder(w.Body).Decode(&health)
+		if health.LoginURL != "/auth/login" {
+			t.Errorf("login_url = %q", health.LoginURL)
+		}
+	})
+}
+
+func TestAuditEndpoint(t *testing.T) {
+	cfg := &config.Config{API: config.APIConfig{Port: 8080, Token: "secret-token"}}
+	store := meta.NewMockStore()
+	defer store.Close()
+	mgr := project.NewManager(cfg, store)
+	server := NewServer(cfg, mgr, cfg.API.Port)
+
+	send := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		return w
+	}
+
+	created := send("POST", "/api/projects", "secret-token", `{"name": "app_a"}`)
+	if created.Code != http.StatusCreated {
+		t.Fatalf("create: status = %d, body: %s", created.Code, created.Body.String())
+	}
+	send("POST", "/api/projects", "secret-token", `{"name": "app_b"}`)
+	send("DELETE", "/api/projects/app_b", "secret-token", "")
+
+	var events []AuditEventResponse
+	w := send("GET", "/api/audit?project=app_a", "secret-token", "")
+	json.NewDecoder(w.Body).Decode(&events)
+	if w.Code != http.StatusOK || len(events) != 1 {
+		t.Fatalf("status = %d, events = %+v", w.Code, events)
+	}
+	e := events[0]
+	if e.Action != "project.create" || e.Actor != "api.token" || e.Source != "api" || e.Outcome != "succeeded" {
+		t.Errorf("event = %+v", e)
+	}
+	if e.RequestID == "" || e.RequestID != created.Header().Get("X-Request-Id") {
+		t.Errorf("request_id = %q, X-Request-Id = %q", e.RequestID, created.Header().Get("X-Request-Id"))
+	}
+
+	t.Run("pagination", func(t *testing.T) {
+		var first, second []AuditEventResponse
+		json.NewDecoder(send("GET", "/api/audit?limit=2", "secret-token", "").Body).Decode(&first)
+		if len(first) != 2 || first[0].Action != "project.delete" {
+			t.Fatalf("first page = %+v", first)
+		}
+		json.NewDecoder(send("GET", fmt.Sprintf("/api/audit?limit=2&before=%d", first[1].ID), "secret-token", "").Body).Decode(&second)
+		if len(second) != 1 || second[0].Target != "app_a" {
+			t.Errorf("second page = %+v", second)
+		}
+	})
+
+	_, teamA, _ := mgr.CreateToken(context.Background(), project.TokenOptions{Name: "team-a", Scopes: []string{"read"}, Projects: []string{"app_a"}})
+
+	tests := []struct {
+		name  string
+		path  string
+		token string
+		want  int
+	}{
+		{"since duration", "/api/audit?since=7d&action=project", "secret-token", http.StatusOK},
+		{"invalid since", "/api/audit?since=yesterday", "secret-token", http.StatusBadRequest},
+		{"invalid limit", "/api/audit?limit=-1", "secret-token", http.StatusBadRequest},
+		{"own project", "/api/audit?project=app_a", teamA, http.StatusOK},
+		{"other project", "/api/audit?project=app_b", teamA, http.StatusForbidden},
+		{"every project", "/api/audit", teamA, http.StatusForbidden},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := send("GET", tt.path, tt.token, ""); w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
+
+func TestWebhookEndpoints(t *testing.T) {
+	cfg := &config.Config{API: config.APIConfig{Port: 8080, Token: "secret-token"}}
+	store := meta.NewMockStore()
+	defer store.Close()
+	mgr := project.NewManager(cfg, store)
+	server := NewServer(cfg, mgr, cfg.API.Port)
+
+	endpoint := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusNoContent)
+	}))
+	defer endpoint.Close()
+
+	send := func(method, path, token, body string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, bytes.NewBufferString(body))
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		return w
+	}
+
+	w := send("POST", "/api/webhooks", "secret-token", fmt.Sprintf(`{"name": "bot", "url": %q, "events": ["database.created"]}`, endpoint.URL))
+	var created WebhookResponse
+	json.NewDecoder(w.Body).Decode(&created)
+	if w.Code != http.StatusCreated || created.Secret == "" || len(created.Events) != 1 {
+		t.Fatalf("create: status = %d, webhook = %+v", w.Code, created)
+	}
+
+	w = send("POST", "/api/webhooks/bot/test", "secret-token", "")
+	var ping WebhookDeliveryResponse
+	json.NewDecoder(w.Body).Decode(&ping)
+	if w.Code != http.StatusOK || ping.Event != "ping" || ping.Status != "succeeded" || ping.ResponseCode != http.StatusNoContent {
+		t.Errorf("test: status = %d, delivery = %+v", w.Code, ping)
+	}
+
+	var deliveries []WebhookDeliveryResponse
+	w = send("GET", "/api/webhooks/bot/deliveries", "secret-token", "")
+	json.NewDecoder(w.Body).Decode(&deliveries)
+	if w.Code != http.StatusOK || len(deliveries) != 1 || deliveries[0].ID != ping.ID {
+		t.Errorf("deliveries: status = %d, deliveries = %+v", w.Code, deliveries)
+	}
+
+	_, reader, _ := mgr.CreateToken(context.Background(), project.TokenOptions{Name: "reader", Scopes: []string{"read"}})
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		body   string
+		want   int
+	}{
+		{"duplicate name", "POST", "/api/webhooks", "secret-token", `{"name": "bot", "url": "https://example.com"}`, http.StatusConflict},
+		{"invalid url", "POST", "/api/webhooks", "secret-token", `{"name": "x", "url": "example.com"}`, http.StatusBadRequest},
+		{"invalid event", "POST", "/api/webhooks", "secret-token", `{"name": "x", "url": "https://example.com", "events": ["nope"]}`, http.StatusBadRequest},
+		{"list omits secrets", "GET", "/api/webhooks", "secret-token", "", http.StatusOK},
+		{"webhooks need admin", "GET", "/api/webhooks", reader, "", http.StatusForbidden},
+		{"test unknown", "POST", "/api/webhooks/nope/test", "secret-token", "", http.StatusNotFound},
+		{"deliveries of unknown", "GET", "/api/webhooks/nope/deliveries", "secret-token", "", http.StatusNotFound},
+		{"invalid limit", "GET", "/api/webhooks/bot/deliveries?limit=0", "secret-token", "", http.StatusBadRequest},
+		{"delete", "DELETE", "/api/webhooks/bot", "secret-token", "", http.StatusNoContent},
+		{"delete unknown", "DELETE", "/api/webhooks/bot", "secret-token", "", http.StatusNotFound},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			w := send(tt.method, tt.path, tt.token, tt.body)
+			if w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+			if tt.method == "GET" && bytes.Contains(w.Body.Bytes(), []byte(created.Secret)) {
+				t.Errorf("response contains the secret: %s", w.Body.String())
+			}
+		})
+	}
+}
+
+func TestGitHubIntegration(t *testing.T) {
+	cfg := &config.Config{
+		Postgres: config.PostgresConfig{Host: "localhost", Port: 1, User: "postgres", Password: "test", Database: "postgres"},
+		API:      config.APIConfig{Port: 8080, Token: "secret-token"},
+		Cleanup:  config.CleanupConfig{DefaultTTL: 72 * time.Hour},
+		Integrations: config.IntegrationsConfig{GitHub: config.GitHubConfig{
+			Secret:       "github-secret",
+			Repositories: map[string]string{"Acme/API": "api"},
+		}},
+	}
+	store := meta.NewMockStore()
+	defer store.Close()
+	mgr := project.NewManager(cfg, store)
+	server := NewServer(cfg, mgr, cfg.API.Port)
+
+	ctx := context.Background()
+	p, _ := store.CreateProject(ctx, "api")
+	number := 42
+	soon := time.Now().Add(time.Hour)
+	store.CreateDatabase(ctx, p.ID, "api_pr_42", "api_pr_42_user", "pw", "pr", "default", &number, &soon)
+
+	send := func(event, delivery, file, secret string) (int, IntegrationResponse) {
+		t.Helper()
+		body, err := os.ReadFile(filepath.Join("testdata", "github", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("POST", "/api/integrations/github", bytes.NewReader(body))
+		req.Header.Set(GitHubEventHeader, event)
+		req.Header.Set(GitHubDeliveryHeader, delivery)
+		req.Header.Set(GitHubSignatureHeader, webhook.Sign(secret, body))
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		var resp IntegrationResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	tests := []struct {
+		name        string
+		event       string
+		delivery    string
+		file        string
+		secret      string
+		wantCode    int
+		wantOutcome string
+	}{
+		{"bad signature", "pull_request", "d-1", "pull_request_opened.json", "wrong", http.StatusUnauthorized, ""},
+		{"ping", "ping", "d-2", "ping.json", "github-secret", http.StatusOK, OutcomeIgnored},
+		{"unmapped repository", "pull_request", "d-3", "pull_request_opened_unmapped.json", "github-secret", http.StatusOK, OutcomeIgnored},
+		{"irrelevant action", "pull_request", "d-4", "pull_request_labeled.json", "github-secret", http.StatusOK, OutcomeIgnored},
+		{"synchronize extends", "pull_request", "d-5", "pull_request_synchronize.json", "github-secret", http.StatusOK, project.PROutcomeExtended},
+		{"redelivery", "pull_request", "d-5", "pull_request_synchronize.json", "github-secret", http.StatusOK, OutcomeDuplicate},
+		{"opened with existing database", "pull_request", "d-6", "pull_request_opened.json", "github-secret", http.StatusOK, project.PROutcomeExists},
+		{"missing delivery", "pull_request", "", "pull_request_opened.json", "github-secret", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := send(tt.event, tt.delivery, tt.file, tt.secret)
+			if code != tt.wantCode || resp.Outcome != tt.wantOutcome {
+				t.Errorf("status = %d, outcome = %q, want %d, %q", code, resp.Outcome, tt.wantCode, tt.wantOutcome)
+			}
+		})
+	}
+
+	db, _ := store.GetDatabase(ctx, p.ID, "pr", &number)
+	if !db.ExpiresAt.After(time.Now().Add(71 * time.Hour)) {
+		t.Errorf("expires_at = %v, want about 72h from now", db.ExpiresAt)
+	}
+
+	// Closing a pull request without a database changes nothing
+	store.DeleteDatabase(ctx, "api_pr_42")
+	if code, resp := send("pull_request", "d-7", "pull_request_closed.json", "github-secret"); code != http.StatusOK || resp.Outcome != project.PROutcomeAbsent {
+		t.Errorf("closed: status = %d, outcome = %q", code, resp.Outcome)
+	}
+
+	// A failed delivery is released, so that GitHub's redelivery is processed again
+	for i := 0; i < 2; i++ {
+		if code, _ := send("pull_request", "d-8", "pull_request_opened.json", "github-secret"); code != http.StatusInternalServerError {
+			t.Errorf("opened without a server: status = %d, want %d", code, http.StatusInternalServerError)
+		}
+	}
+}
+
+func TestGitLabIntegration(t *testing.T) {
+	cfg := &config.Config{
+		Postgres: config.PostgresConfig{Host: "localhost", Port: 1, User: "postgres", Password: "test", Database: "postgres"},
+		API:      config.APIConfig{Port: 8080, Token: "secret-token"},
+		Cleanup:  config.CleanupConfig{DefaultTTL: 72 * time.Hour},
+		Integrations: config.IntegrationsConfig{GitLab: config.GitLabConfig{
+			Token:    "gitlab-token",
+			Projects: map[string]string{"acme/backend/api": "api"},
+		}},
+	}
+	store := meta.NewMockStore()
+	defer store.Close()
+	mgr := project.NewManager(cfg, store)
+	server := NewServer(cfg, mgr, cfg.API.Port)
+
+	ctx := context.Background()
+	p, _ := store.CreateProject(ctx, "api")
+	iid := 17
+	soon := time.Now().Add(time.Hour)
+	store.CreateDatabase(ctx, p.ID, "api_pr_17", "api_pr_17_user", "pw", "pr", "default", &iid, &soon)
+
+	send := func(event, uuid, file, token string) (int, IntegrationResponse) {
+		t.Helper()
+		body, err := os.ReadFile(filepath.Join("testdata", "gitlab", file))
+		if err != nil {
+			t.Fatal(err)
+		}
+		req := httptest.NewRequest("POST", "/api/integrations/gitlab", bytes.NewReader(body))
+		req.Header.Set(GitLabEventHeader, event)
+		req.Header.Set(GitLabEventUUIDHeader, uuid)
+		req.Header.Set(GitLabTokenHeader, token)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		var resp IntegrationResponse
+		json.NewDecoder(w.Body).Decode(&resp)
+		return w.Code, resp
+	}
+
+	tests := []struct {
+		name        string
+		event       string
+		uuid        string
+		file        string
+		token       string
+		wantCode    int
+		wantOutcome string
+	}{
+		{"bad token", "Merge Request Hook", "u-1", "merge_request_open.json", "wrong", http.StatusUnauthorized, ""},
+		{"missing token", "Merge Request Hook", "u-1", "merge_request_open.json", "", http.StatusUnauthorized, ""},
+		{"push", "Push Hook", "u-2", "push.json", "gitlab-token", http.StatusOK, OutcomeIgnored},
+		{"unmapped project", "Merge Request Hook", "u-3", "merge_request_open_unmapped.json", "gitlab-token", http.StatusOK, OutcomeIgnored},
+		{"irrelevant action", "Merge Request Hook", "u-4", "merge_request_approved.json", "gitlab-token", http.StatusOK, OutcomeIgnored},
+		{"update extends", "Merge Request Hook", "u-5", "merge_request_update.json", "gitlab-token", http.StatusOK, project.PROutcomeExtended},
+		{"redelivery", "Merge Request Hook", "u-5", "merge_request_update.json", "gitlab-token", http.StatusOK, OutcomeDuplicate},
+		{"open with existing database", "Merge Request Hook", "u-6", "merge_request_open.json", "gitlab-token", http.StatusOK, project.PROutcomeExists},
+		{"missing uuid", "Merge Request Hook", "", "merge_request_open.json", "gitlab-token", http.StatusBadRequest, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			code, resp := send(tt.event, tt.uuid, tt.file, tt.token)
+			if code != tt.wantCode || resp.Outcome != tt.wantOutcome {
+				t.Errorf("status = %d, outcome = %q, want %d, %q", code, resp.Outcome, tt.wantCode, tt.wantOutcome)
+			}
+		})
+	}
+
+	db, _ := store.GetDatabase(ctx, p.ID, "pr", &iid)
+	if !db.ExpiresAt.After(time.Now().Add(71 * time.Hour)) {
+		t.Errorf("expires_at = %v, want about 72h from now", db.ExpiresAt)
+	}
+
+	// Merging a merge request without a database changes nothing
+	store.DeleteDatabase(ctx, "api_pr_17")
+	if code, resp := send("Merge Request Hook", "u-7", "merge_request_merge.json", "gitlab-token"); code != http.StatusOK || resp.Outcome != project.PROutcomeAbsent {
+		t.Errorf("merge: status = %d, outcome = %q", code, resp.Outcome)
+	}
+
+	// The same delivery ID from GitHub is a different delivery
+	if ok, _ := mgr.ClaimDelivery(ctx, "github", "u-5"); !ok {
+		t.Error("deliveries of different sources should not collide")
+	}
+}
+
+// sseEvent is an event read from a server-sent event stream
+type sseEvent struct {
+	id, event, data string
+}
+
+// readEvents reads n events from a server-sent event stream, skipping
+// comments and the retry field
+func readEvents(t *testing.T, body *bufio.Reader, n int) []sseEvent {
+	t.Helper()
+	var events []sseEvent
+	var current sseEvent
+	for len(events) < n {
+		line, err := body.ReadString('\n')
+		if err != nil {
+			t.Fatalf("read stream: %v (events so far: %+v)", err, events)
+		}
+		line = strings.TrimSuffix(line, "\n")
+		switch {
+		case line == "":
+			if current != (sseEvent{}) {
+				events = append(events, current)
+			}
+			current = sseEvent{}
+		case strings.HasPrefix(line, "id: "):
+			current.id = strings.TrimPrefix(line, "id: ")
+		case strings.HasPrefix(line, "event: "):
+			current.event = strings.TrimPrefix(line, "event: ")
+		case strings.HasPrefix(line, "data: "):
+			current.data = strings.TrimPrefix(line, "data: ")
+		}
+	}
+	return events
+}
+
+func TestEventStream(t *testing.T) {
+	cfg := &config.Config{API: config.APIConfig{Port: 8080, Token: "secret-token"}}
+	store := meta.NewMockStore()
+	defer store.Close()
+	mgr := project.NewManager(cfg, store)
+	server := NewServer(cfg, mgr, cfg.API.Port)
+	srv := httptest.NewServer(server.Router())
+	defer srv.Close()
+
+	ctx := context.Background()
+	_, teamA, _ := mgr.CreateToken(ctx, project.TokenOptions{Name: "team-a", Scopes: []string{"read"}, Projects: []string{"app_a"}})
+
+	open := func(token, query, lastID string) *http.Response {
+		t.Helper()
+		req, _ := http.NewRequest("GET", srv.URL+"/api/events"+query, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		if lastID != "" {
+			req.Header.Set("Last-Event-ID", lastID)
+		}
+		resp, err := http.DefaultClient.Do(req)
+		if err != nil {
+			t.Fatal(err)
+		}
+		return resp
+	}
+
+	admin := open("secret-token", "", "")
+	defer admin.Body.Close()
+	if ct := admin.Header.Get("Content-Type"); admin.StatusCode != http.StatusOK || ct != "text/event-stream" {
+		t.Fatalf("status = %d, content type = %s", admin.StatusCode, ct)
+	}
+	restricted := open(teamA, "", "")
+	defer restricted.Body.Close()
+	adminEvents, restrictedEvents := bufio.NewReader(admin.Body), bufio.NewReader(restricted.Body)
+
+	// Streams subscribe before sending their headers, so both see what follows
+	for _, name := range []string{"app_b", "app_a"} {
+		if _, err := mgr.CreateProject(ctx, name); err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	got := readEvents(t, adminEvents, 2)
+	first, _ := strconv.ParseInt(got[0].id, 10, 64)
+	firstID, secondID := got[0].id, strconv.FormatInt(first+1, 10)
+	if got[0].event != project.EventProjectCreated || !strings.Contains(got[0].data, `"project":"app_b"`) || got[1].id != secondID {
+		t.Errorf("admin events = %+v", got)
+	}
+	got = readEvents(t, restrictedEvents, 1)
+	if got[0].id != secondID || !strings.Contains(got[0].data, `"project":"app_a"`) {
+		t.Errorf("restricted events = %+v, want only app_a", got)
+	}
+
+	// Resuming replays the events after the last one seen
+	resumed := open("secret-token", "", firstID)
+	defer resumed.Body.Close()
+	if got := readEvents(t, bufio.NewReader(resumed.Body), 1); got[0].id != secondID {
+		t.Errorf("resumed events = %+v", got)
+	}
+
+	// An ID from before a restart resets the client
+	reset := open("secret-token", "?project=app_a", "99")
+	defer reset.Body.Close()
+	got = readEvents(t, bufio.NewReader(reset.Body), 2)
+	if got[0].event != EventReset || got[1].id != secondID {
+		t.Errorf("events after an unknown ID = %+v", got)
+	}
+
+	for _, tt := range []struct {
+		name, token, query, lastID string
+		want                       int
+	}{
+		{"invalid id", "secret-token", "", "abc", http.StatusBadRequest},
+		{"project out of reach", teamA, "?project=app_b", "", http.StatusForbidden},
+		{"no token", "", "", "", http.StatusUnauthorized},
+	} {
+		t.Run(tt.name, func(t *testing.T) {
+			resp := open(tt.token, tt.query, tt.lastID)
+			resp.Body.Close()
+			if resp.StatusCode != tt.want {
+				t.Errorf("status = %d, want %d", resp.StatusCode, tt.want)
+			}
+		})
+	}
+}
+
+func TestJobEndpoints(t *testing.T) {
+	cfg := &config.Config{API: config.APIConfig{Port: 8080, Token: "secret-token"}}
+	store := meta.NewMockStore()
+	defer store.Close()
+	mgr := project.NewManager(cfg, store)
+	server := NewServer(cfg, mgr, cfg.API.Port)
+
+	send := func(method, path, token string) *httptest.ResponseRecorder {
+		req := httptest.NewRequest(method, path, nil)
+		req.Header.Set("Authorization", "Bearer "+token)
+		w := httptest.NewRecorder()
+		server.Router().ServeHTTP(w, req)
+		return w
+	}
+
+	if w := send("POST", "/api/cleanup", "secret-token"); w.Code != http.StatusServiceUnavailable {
+		t.Errorf("without workers: status = %d, body: %s", w.Code, w.Body.String())
+	}
+
+	ctx, stop := context.WithCancel(context.Background())
+	defer stop()
+	if err := mgr.StartJobs(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+
+	w := send("POST", "/api/cleanup", "secret-token")
+	var job JobResponse
+	json.NewDecoder(w.Body).Decode(&job)
+	if w.Code != http.StatusAccepted || job.Kind != project.JobCleanup || w.Header().Get("Location") != fmt.Sprintf("/api/jobs/%d", job.ID) {
+		t.Fatalf("status = %d, Location = %q, job = %+v", w.Code, w.Header().Get("Location"), job)
+	}
+
+	deadline := time.Now().Add(5 * time.Second)
+	for job.Status != project.JobSucceeded && time.Now().Before(deadline) {
+		time.Sleep(10 * time.Millisecond)
+		json.NewDecoder(send("GET", w.Header().Get("Location"), "secret-token").Body).Decode(&job)
+	}
+	var result CleanupResponse
+	if err := json.Unmarshal(job.Result, &result); err != nil || job.FinishedAt == nil || result.Deleted == nil {
+		t.Fatalf("job = %+v, result = %+v, %v", job, result, err)
+	}
+
+	var jobs []JobResponse
+	json.NewDecoder(send("GET", "/api/jobs?status=succeeded", "secret-token").Body).Decode(&jobs)
+	if len(jobs) != 1 || jobs[0].ID != job.ID {
+		t.Errorf("jobs = %+v", jobs)
+	}
+
+	_, teamA, _ := mgr.CreateToken(context.Background(), project.TokenOptions{Name: "team-a", Scopes: []string{"read", "create"}, Projects: []string{"app_a"}})
+	_, reader, _ := mgr.CreateToken(context.Background(), project.TokenOptions{Name: "reader", Scopes: []string{"read"}})
+	jobPath := fmt.Sprintf("/api/jobs/%d", job.ID)
+
+	// Results are only shown to callers who could have started the job
+	var read JobResponse
+	json.NewDecoder(send("GET", jobPath, reader).Body).Decode(&read)
+	if read.ID != job.ID || read.Result != nil {
+		t.Errorf("job read without the delete scope = %+v, want no result", read)
+	}
+
+	tests := []struct {
+		name   string
+		method string
+		path   string
+		token  string
+		want   int
+	}{
+		{"cancel finished", "DELETE", jobPath, "secret-token", http.StatusConflict},
+		{"invalid ID", "GET", "/api/jobs/abc", "secret-token", http.StatusBadRequest},
+		{"missing job", "GET", "/api/jobs/999", "secret-token", http.StatusNotFound},
+		{"job of every project", "GET", jobPath, teamA, http.StatusForbidden},
+		{"cancel job of every project", "DELETE", jobPath, teamA, http.StatusForbidden},
+		{"jobs of every project", "GET", "/api/jobs", teamA, http.StatusForbidden},
+		{"own project jobs", "GET", "/api/jobs?project=app_a", teamA, http.StatusOK},
+		{"cleanup without delete scope", "POST", "/api/cleanup", teamA, http.StatusForbidden},
+		{"backup run without schedules", "POST", "/api/backups/run", "secret-token", http.StatusConflict},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if w := send(tt.method, tt.path, tt.token); w.Code != tt.want {
+				t.Errorf("status = %d, want %d, body: %s", w.Code, tt.want, w.Body.String())
+			}
+		})
+	}
+}
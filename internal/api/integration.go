@@ -0,0 +1,92 @@
+package api
+
+import (
+	"context"
+	"io"
+	"log"
+	"net/http"
+
+	"pgmanager/internal/auth"
+)
+
+// MaxEventSize is the largest webhook payload accepted from a source code host
+const MaxEventSize = 5 << 20
+
+// Outcomes of events that do not touch a PR database, next to the
+// project.PROutcome values
+const (
+	OutcomeIgnored   = "ignored"   // The event is not about a mapped repository or a relevant action
+	OutcomeDuplicate = "duplicate" // The delivery was handled before
+)
+
+// IntegrationResponse describes what an event from a source code host did
+type IntegrationResponse struct {
+	Delivery  string  `json:"delivery"`
+	Event     string  `json:"event"`
+	Project   string  `json:"project,omitempty"`
+	Database  string  `json:"database,omitempty"`
+	Outcome   string  `json:"outcome"`
+	Reason    string  `json:"reason,omitempty"` // Why the event was ignored
+	ExpiresAt *string `json:"expires_at,omitempty"`
+}
+
+// readEvent reads the payload of a webhook from a source code host
+func readEvent(w http.ResponseWriter, r *http.Request) ([]byte, bool) {
+	body, err := io.ReadAll(io.LimitReader(r.Body, MaxEventSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return nil, false
+	}
+	if len(body) > MaxEventSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "payload is too large")
+		return nil, false
+	}
+	return body, true
+}
+
+// ignoreEvent acknowledges an event that does not touch a PR database
+func ignoreEvent(w http.ResponseWriter, source string, resp IntegrationResponse, reason string) {
+	resp.Outcome, resp.Reason = OutcomeIgnored, reason
+	log.Printf("INTEGRATION [%s] delivery=%s event=%s ignored: %s", source, resp.Delivery, resp.Event, reason)
+	writeJSON(w, http.StatusOK, resp)
+}
+
+// syncPullRequest applies an event about a pull or merge request to its PR
+// database. It runs as a principal limited to the mapped project, and each
+// delivery is applied once: redeliveries are acknowledged without effect
+// unless the first attempt failed.
+func (s *Server) syncPullRequest(w http.ResponseWriter, r *http.Request, source string, resp IntegrationResponse, number int, action string) {
+	// A host that gives up waiting must not abort a database half created
+	ctx := context.WithoutCancel(r.Context())
+
+	isNew, err := s.mgr.ClaimDelivery(ctx, source, resp.Delivery)
+	if err != nil {
+		writeInternalError(w, source, err)
+		return
+	}
+	if !isNew {
+		resp.Outcome = OutcomeDuplicate
+		log.Printf("INTEGRATION [%s] delivery=%s event=%s duplicate", source, resp.Delivery, resp.Event)
+		writeJSON(w, http.StatusOK, resp)
+		return
+	}
+
+	ctx = auth.WithPrincipal(ctx, &auth.Principal{
+		Name:     "integration:" + source,
+		Scopes:   []string{auth.ScopeCreate, auth.ScopeDelete},
+		Projects: []string{resp.Project},
+	})
+	result, err := s.mgr.SyncPullRequest(ctx, resp.Project, number, action)
+	if err != nil {
+		s.mgr.ReleaseDelivery(ctx, source, resp.Delivery)
+		log.Printf("INTEGRATION [%s] delivery=%s event=%s project=%s number=%d failed: %v",
+			source, resp.Delivery, resp.Event, resp.Project, number, err)
+		writeInternalError(w, source, err)
+		return
+	}
+
+	resp.Database, resp.Outcome, resp.ExpiresAt = result.DatabaseName, result.Outcome, formatTime(result.ExpiresAt)
+	log.Printf("INTEGRATION [%s] delivery=%s event=%s project=%s database=%s %s",
+		source, resp.Delivery, resp.Event, resp.Project, resp.Database, resp.Outcome)
+	writeJSON(w, http.StatusOK, resp)
+}
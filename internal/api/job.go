@@ -0,0 +1,230 @@
+package api
+
+import (
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"pgmanager/internal/auth"
+	"pgmanager/internal/meta"
+	"pgmanager/internal/migrate"
+	"pgmanager/internal/project"
+)
+
+// JobResponse describes a job. Result holds the response of its operation once
+// the job succeeded, or what an apply did before it failed.
+type JobResponse struct {
+	ID         int64            `json:"id"`
+	Kind       string           `json:"kind"`
+	Project    string           `json:"project,omitempty"`
+	Target     string           `json:"target,omitempty"`
+	Status     string           `json:"status"`
+	Done       int              `json:"done"`
+	Total      int              `json:"total"`
+	Error      string           `json:"error,omitempty"`
+	Result     json.RawMessage  `json:"result,omitempty"`
+	Actor      string           `json:"actor"`
+	CreatedAt  string           `json:"created_at"`
+	StartedAt  *string          `json:"started_at"`
+	FinishedAt *string          `json:"finished_at"`
+	Logs       []JobLogResponse `json:"logs,omitempty"`
+}
+
+// JobLogResponse is a line logged by a job
+type JobLogResponse struct {
+	Time    string `json:"time"`
+	Message string `json:"message"`
+}
+
+// NewJobResponse describes a job, converting its result to the response type
+// of its operation
+func NewJobResponse(j meta.Job, logs []meta.JobLog) JobResponse {
+	response := JobResponse{
+		ID:         j.ID,
+		Kind:       j.Kind,
+		Project:    j.Project,
+		Target:     j.Target,
+		Status:     j.Status,
+		Done:       j.Done,
+		Total:      j.Total,
+		Error:      j.Error,
+		Actor:      j.Actor,
+		CreatedAt:  j.CreatedAt.Format(time.RFC3339),
+		StartedAt:  formatTime(j.StartedAt),
+		FinishedAt: formatTime(j.FinishedAt),
+	}
+	for _, l := range logs {
+		response.Logs = append(response.Logs, JobLogResponse{Time: l.Time.Format(time.RFC3339), Message: l.Message})
+	}
+
+	if len(j.Result) > 0 {
+		result, err := jobResult(j.Kind, j.Result)
+		if err != nil {
+			log.Printf("ERROR [job %d]: failed to decode result: %v", j.ID, err)
+		} else if response.Result, err = json.Marshal(result); err != nil {
+			log.Printf("ERROR [job %d]: failed to encode result: %v", j.ID, err)
+		}
+	}
+	return response
+}
+
+// jobResult decodes the stored result of a job into its response type
+func jobResult(kind string, data []byte) (any, error) {
+	switch kind {
+	case project.JobCleanup:
+		var result project.CleanupResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+		return NewCleanupResponse(&result), nil
+	case project.JobBackupRun:
+		var result project.BackupRunResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+		return NewBackupRunResponse(&result), nil
+	case project.JobBackupCreate:
+		var result meta.Backup
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+		return NewBackupResponse(result), nil
+	case project.JobBackupRestore, project.JobRestore:
+		var result project.RestoreResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+		return NewRestoreResponse(&result), nil
+	case project.JobMigrate, project.JobMigrateDown:
+		var result []migrate.Migration
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+		return migrationResponses(result), nil
+	case project.JobApply:
+		var result project.ApplyResult
+		if err := json.Unmarshal(data, &result); err != nil {
+			return nil, err
+		}
+		return NewApplyResponse(&result), nil
+	}
+	return nil, fmt.Errorf("unknown job kind: %s", kind)
+}
+
+// startJob queues a long operation as a job and responds with 202 Accepted, the
+// job in the body and its URL in the Location header. Errors known before the
+// job runs are written by writeErr, as the operation reports them.
+func (s *Server) startJob(w http.ResponseWriter, r *http.Request, context string, req project.JobRequest,
+	writeErr func(w http.ResponseWriter, context string, err error)) {
+	job, err := s.mgr.StartJob(r.Context(), req)
+	if err != nil {
+		msg := err.Error()
+		switch {
+		case strings.Contains(msg, "queue is full"), strings.Contains(msg, "no job workers"):
+			writeError(w, http.StatusServiceUnavailable, msg)
+		case strings.HasPrefix(msg, "invalid job"):
+			writeError(w, http.StatusBadRequest, msg)
+		default:
+			writeErr(w, context, err)
+		}
+		return
+	}
+
+	audit(r, "job", "started %s job %d", job.Kind, job.ID)
+	w.Header().Set("Location", fmt.Sprintf("/api/jobs/%d", job.ID))
+	writeJSON(w, http.StatusAccepted, NewJobResponse(*job, nil))
+}
+
+// parseJobID reads the {id} URL parameter. It writes a 400 response and returns
+// ok=false if it is not a job ID.
+func parseJobID(w http.ResponseWriter, r *http.Request) (int64, bool) {
+	id, err := strconv.ParseInt(chi.URLParam(r, "id"), 10, 64)
+	if err != nil || id <= 0 {
+		writeError(w, http.StatusBadRequest, "invalid job ID")
+		return 0, false
+	}
+	return id, true
+}
+
+// listJobs lists jobs, newest first, optionally of one project or status
+func (s *Server) listJobs(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	filter := meta.JobFilter{Project: q.Get("project"), Status: q.Get("status")}
+	if v := q.Get("limit"); v != "" {
+		var err error
+		if filter.Limit, err = strconv.Atoi(v); err != nil || filter.Limit <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit: must be a positive number")
+			return
+		}
+	}
+	if filter.Project != "" && !requireProject(w, r, auth.ScopeRead, filter.Project) {
+		return
+	}
+
+	jobs, err := s.mgr.ListJobs(r.Context(), filter)
+	if err != nil {
+		writeInternalError(w, "listJobs", err)
+		return
+	}
+
+	response := make([]JobResponse, len(jobs))
+	for i, j := range jobs {
+		response[i] = NewJobResponse(j, nil)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+// getJob describes a job with its log
+func (s *Server) getJob(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseJobID(w, r)
+	if !ok {
+		return
+	}
+
+	info, err := s.mgr.GetJob(r.Context(), id)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeInternalError(w, "getJob", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, NewJobResponse(info.Job, info.Logs))
+}
+
+// cancelJob cancels a queued or running job. A running job stops at its next
+// cancellation point, so the response may still show it running.
+func (s *Server) cancelJob(w http.ResponseWriter, r *http.Request) {
+	id, ok := parseJobID(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.mgr.CancelJob(r.Context(), id); err != nil {
+		msg := err.Error()
+		switch {
+		case strings.Contains(msg, "not found"):
+			writeError(w, http.StatusNotFound, msg)
+		case strings.Contains(msg, "already"), strings.Contains(msg, "not running"), strings.Contains(msg, "no job workers"):
+			writeError(w, http.StatusConflict, msg)
+		default:
+			writeInternalError(w, "cancelJob", err)
+		}
+		return
+	}
+	audit(r, "job", "canceled job %d", id)
+
+	info, err := s.mgr.GetJob(r.Context(), id)
+	if err != nil {
+		writeInternalError(w, "cancelJob", err)
+		return
+	}
+	writeJSON(w, http.StatusAccepted, NewJobResponse(info.Job, info.Logs))
+}
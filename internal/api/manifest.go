@@ -0,0 +1,156 @@
+package api
+
+import (
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+
+	"pgmanager/internal/manifest"
+	"pgmanager/internal/project"
+)
+
+// MaxManifestSize limits the size of a manifest sent to plan or apply
+const MaxManifestSize = 1 << 20
+
+// PlanChangeResponse is a single change of a plan
+type PlanChangeResponse struct {
+	Action string `json:"action"`
+	Kind   string `json:"kind"`
+	Name   string `json:"name"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// PlanResponse lists the changes apply would make for a manifest
+type PlanResponse struct {
+	Changes  []PlanChangeResponse `json:"changes"`
+	Warnings []string             `json:"warnings,omitempty"`
+}
+
+// CredentialResponse is the login of a database or role created by apply
+type CredentialResponse struct {
+	Database   string `json:"database"`
+	User       string `json:"user"`
+	Password   string `json:"password"`
+	ConnString string `json:"connection_string,omitempty"`
+}
+
+// ApplyResponse lists the changes apply made. When a change failed, Applied and
+// Credentials hold what was done before it, since role passwords cannot be
+// retrieved later. The CLI sets Error then; the API reports it as the error
+// of the failed job.
+type ApplyResponse struct {
+	Applied     []PlanChangeResponse `json:"applied"`
+	Credentials []CredentialResponse `json:"credentials,omitempty"`
+	Error       string               `json:"error,omitempty"`
+}
+
+// readManifest reads a YAML manifest from the request body
+func readManifest(w http.ResponseWriter, r *http.Request) (*manifest.Manifest, bool) {
+	data, err := io.ReadAll(io.LimitReader(r.Body, MaxManifestSize+1))
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return nil, false
+	}
+	if len(data) > MaxManifestSize {
+		writeError(w, http.StatusRequestEntityTooLarge, "manifest is too large")
+		return nil, false
+	}
+
+	mf, err := manifest.Parse(data)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid manifest: "+err.Error())
+		return nil, false
+	}
+	return mf, true
+}
+
+// parsePrune reads the prune query parameter
+func parsePrune(w http.ResponseWriter, r *http.Request) (bool, bool) {
+	value := r.URL.Query().Get("prune")
+	if value == "" {
+		return false, true
+	}
+	prune, err := strconv.ParseBool(value)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "invalid prune value")
+		return false, false
+	}
+	return prune, true
+}
+
+func (s *Server) planManifest(w http.ResponseWriter, r *http.Request) {
+	mf, ok := readManifest(w, r)
+	if !ok {
+		return
+	}
+	prune, ok := parsePrune(w, r)
+	if !ok {
+		return
+	}
+
+	plan, err := s.mgr.Plan(r.Context(), mf, prune)
+	if err != nil {
+		writeManifestError(w, "planManifest", err)
+		return
+	}
+
+	writeJSON(w, http.StatusOK, NewPlanResponse(plan))
+}
+
+// applyManifest applies a manifest. Once changes have started, the response is
+// 200 even if one fails, so the credentials of what was created are not lost.
+func (s *Server) applyManifest(w http.ResponseWriter, r *http.Request) {
+	mf, ok := readManifest(w, r)
+	if !ok {
+		return
+	}
+	prune, ok := parsePrune(w, r)
+	if !ok {
+		return
+	}
+
+	s.startJob(w, r, "applyManifest", project.JobRequest{Kind: project.JobApply, Manifest: mf, Prune: prune}, writeManifestError)
+}
+
+// writeManifestError maps planning errors to status codes
+func writeManifestError(w http.ResponseWriter, context string, err error) {
+	if strings.HasPrefix(err.Error(), "invalid manifest") {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+	writeInternalError(w, context, err)
+}
+
+// NewPlanResponse describes a plan
+func NewPlanResponse(plan *project.Plan) PlanResponse {
+	return PlanResponse{
+		Changes:  newPlanChangeResponses(plan.Changes),
+		Warnings: plan.Warnings,
+	}
+}
+
+// NewApplyResponse describes the result of an apply
+func NewApplyResponse(result *project.ApplyResult) ApplyResponse {
+	response := ApplyResponse{
+		Applied:     newPlanChangeResponses(result.Applied),
+		Credentials: make([]CredentialResponse, len(result.Credentials)),
+	}
+	for i, c := range result.Credentials {
+		response.Credentials[i] = CredentialResponse{
+			Database:   c.Database,
+			User:       c.User,
+			Password:   c.Password,
+			ConnString: c.ConnString,
+		}
+	}
+	return response
+}
+
+func newPlanChangeResponses(changes []project.PlanChange) []PlanChangeResponse {
+	response := make([]PlanChangeResponse, len(changes))
+	for i, c := range changes {
+		response[i] = PlanChangeResponse{Action: c.Action, Kind: c.Kind, Name: c.Name, Detail: c.Detail}
+	}
+	return response
+}
@@ -6,7 +6,9 @@ import (
 	"sync"
 	"time"
 
+	"github.com/go-chi/chi/v5/middleware"
 	"golang.org/x/time/rate"
+	"pgmanager/internal/auth"
 )
 
 // RateLimiter implements a per-IP rate limiter
@@ -173,3 +175,17 @@ func corsMiddleware(allowedOrigins []string) func(http.Handler) http.Handler {
 		})
 	}
 }
+
+// originMiddleware marks operations as coming from the API, under the request
+// ID that middleware.RequestID assigned, so the audit log can tie events to
+// requests. The ID is returned in the X-Request-Id header.
+func originMiddleware(next http.Handler) http.Handler {
+	return http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		id := middleware.GetReqID(r.Context())
+		if id != "" {
+			w.Header().Set(middleware.RequestIDHeader, id)
+		}
+		ctx := auth.WithOrigin(r.Context(), auth.Origin{Source: auth.SourceAPI, RequestID: id})
+		next.ServeHTTP(w, r.WithContext(ctx))
+	})
+}
@@ -0,0 +1,113 @@
+package api
+
+import (
+	"encoding/json"
+	"io"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"pgmanager/internal/migrate"
+	"pgmanager/internal/project"
+)
+
+// MigrationResponse describes a migration that was applied or reverted
+type MigrationResponse struct {
+	Version int64  `json:"version"`
+	Name    string `json:"name"`
+}
+
+// MigrationStatusResponse describes a migration and whether it has been applied
+type MigrationStatusResponse struct {
+	Version   int64   `json:"version"`
+	Name      string  `json:"name"`
+	AppliedAt *string `json:"applied_at,omitempty"`
+	Missing   bool    `json:"missing,omitempty"`
+}
+
+// MigrateDownRequest sets how many migrations are reverted. An empty body reverts one.
+type MigrateDownRequest struct {
+	Steps int `json:"steps"`
+}
+
+func (s *Server) migrationStatus(w http.ResponseWriter, r *http.Request) {
+	projectName := chi.URLParam(r, "name")
+	env, prNumber, ok := parseEnvParam(w, r)
+	if !ok {
+		return
+	}
+
+	statuses, err := s.mgr.MigrationStatus(r.Context(), projectName, env, prNumber, "")
+	if err != nil {
+		writeMigrationError(w, "migrationStatus", err)
+		return
+	}
+
+	response := make([]MigrationStatusResponse, len(statuses))
+	for i, st := range statuses {
+		response[i] = MigrationStatusResponse{
+			Version:   st.Version,
+			Name:      st.Name,
+			AppliedAt: formatTime(st.AppliedAt),
+			Missing:   st.Missing,
+		}
+	}
+
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) migrateUp(w http.ResponseWriter, r *http.Request) {
+	projectName := chi.URLParam(r, "name")
+	env, prNumber, ok := parseEnvParam(w, r)
+	if !ok {
+		return
+	}
+
+	req := project.JobRequest{Kind: project.JobMigrate, Project: projectName, Env: env, PRNumber: prNumber}
+	s.startJob(w, r, "migrateUp", req, writeMigrationError)
+}
+
+func (s *Server) migrateDown(w http.ResponseWriter, r *http.Request) {
+	projectName := chi.URLParam(r, "name")
+	env, prNumber, ok := parseEnvParam(w, r)
+	if !ok {
+		return
+	}
+
+	var body MigrateDownRequest
+	if err := json.NewDecoder(r.Body).Decode(&body); err != nil && err != io.EOF {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if body.Steps == 0 {
+		body.Steps = 1
+	}
+
+	req := project.JobRequest{Kind: project.JobMigrateDown, Project: projectName, Env: env, PRNumber: prNumber, Steps: body.Steps}
+	s.startJob(w, r, "migrateDown", req, writeMigrationError)
+}
+
+func migrationResponses(migrations []migrate.Migration) []MigrationResponse {
+	response := make([]MigrationResponse, len(migrations))
+	for i, m := range migrations {
+		response[i] = MigrationResponse{Version: m.Version, Name: m.Name}
+	}
+	return response
+}
+
+// writeMigrationError reports a failed migration request. Errors of the migrations
+// themselves are returned to the caller, who needs them to fix the migration.
+func writeMigrationError(w http.ResponseWriter, context string, err error) {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "not found"):
+		writeError(w, http.StatusNotFound, msg)
+	case strings.Contains(msg, "no migrations directory"), strings.Contains(msg, "must be positive"),
+		strings.Contains(msg, "invalid environment"):
+		writeError(w, http.StatusBadRequest, msg)
+	case strings.Contains(msg, "migration"):
+		writeError(w, http.StatusUnprocessableEntity, msg)
+	default:
+		writeInternalError(w, context, err)
+	}
+}
@@ -0,0 +1,73 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+
+	"github.com/go-chi/chi/v5"
+	"pgmanager/internal/project"
+)
+
+// MoveRequest selects the server a database is moved to
+type MoveRequest struct {
+	Target     string `json:"target"`
+	DropSource bool   `json:"drop_source"`
+}
+
+func (s *Server) moveDatabase(w http.ResponseWriter, r *http.Request) {
+	projectName := chi.URLParam(r, "name")
+	env, prNumber, ok := parseEnvParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req MoveRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if req.Target == "" {
+		writeError(w, http.StatusBadRequest, "target is required")
+		return
+	}
+
+	job := project.JobRequest{
+		Kind:       project.JobMove,
+		Project:    projectName,
+		Env:        env,
+		PRNumber:   prNumber,
+		Server:     req.Target,
+		DropSource: req.DropSource,
+	}
+	s.startJob(w, r, "moveDatabase", job, writeMoveError)
+}
+
+func (s *Server) abortMove(w http.ResponseWriter, r *http.Request) {
+	projectName := chi.URLParam(r, "name")
+	env, prNumber, ok := parseEnvParam(w, r)
+	if !ok {
+		return
+	}
+
+	if err := s.mgr.AbortMove(r.Context(), projectName, env, prNumber); err != nil {
+		writeMoveError(w, "abortMove", err)
+		return
+	}
+
+	w.WriteHeader(http.StatusNoContent)
+}
+
+func writeMoveError(w http.ResponseWriter, context string, err error) {
+	msg := err.Error()
+	switch {
+	case strings.Contains(msg, "not found"), strings.Contains(msg, "no move in progress"):
+		writeError(w, http.StatusNotFound, msg)
+	case strings.Contains(msg, "already"):
+		writeError(w, http.StatusConflict, msg)
+	case strings.Contains(msg, "unknown server"), strings.Contains(msg, "invalid environment"):
+		writeError(w, http.StatusBadRequest, msg)
+	default:
+		writeInternalError(w, context, err)
+	}
+}
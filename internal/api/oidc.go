@@ -0,0 +1,167 @@
+package api
+
+import (
+	"context"
+	"crypto/subtle"
+	"fmt"
+	"log"
+	"net/http"
+	"strings"
+	"time"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/oidc"
+)
+
+const (
+	// sessionCookie holds the ID token of a user signed in to the web UI
+	sessionCookie = "pgmanager_session"
+
+	// loginCookie holds the state, nonce and PKCE verifier of a login in progress
+	loginCookie = "pgmanager_login"
+
+	// loginTimeout limits how long a user has to sign in at the identity provider
+	loginTimeout = 10 * time.Minute
+)
+
+// MeResponse describes the caller of a request
+type MeResponse struct {
+	Name        string            `json:"name"`
+	Scopes      []string          `json:"scopes"`
+	Projects    []string          `json:"projects,omitempty"`
+	Roles       map[string]string `json:"roles,omitempty"`
+	DefaultRole string            `json:"default_role,omitempty"`
+}
+
+// isJWT reports whether a Bearer token looks like a JWT rather than an API token
+func isJWT(token string) bool {
+	return strings.Count(token, ".") == 2
+}
+
+// authenticateUser verifies an ID token and returns the principal of its user
+func (s *Server) authenticateUser(ctx context.Context, token string) (*auth.Principal, error) {
+	claims, err := s.oidc.Verify(ctx, token)
+	if err != nil {
+		return nil, err
+	}
+	name := s.oidc.Username(claims)
+	if name == "" {
+		return nil, fmt.Errorf("invalid token: no username claim")
+	}
+	return s.mgr.UserPrincipal(ctx, name, s.oidc.Groups(claims))
+}
+
+// writeAuthError answers a request whose ID token was rejected
+func writeAuthError(w http.ResponseWriter, err error) {
+	if strings.HasPrefix(err.Error(), "invalid token") {
+		writeError(w, http.StatusUnauthorized, err.Error())
+		return
+	}
+	writeInternalError(w, "authenticate", err)
+}
+
+// secureCookies reports whether cookies must only be sent over HTTPS
+func (s *Server) secureCookies() bool {
+	return strings.HasPrefix(s.cfg.API.OIDC.RedirectURL, "https://")
+}
+
+// login starts the authorization code flow, sending the user to the identity
+// provider
+func (s *Server) login(w http.ResponseWriter, r *http.Request) {
+	state, nonce, verifier := oidc.RandomString(), oidc.RandomString(), oidc.RandomString()
+
+	url, err := s.oidc.AuthCodeURL(r.Context(), state, nonce, oidc.Challenge(verifier))
+	if err != nil {
+		writeInternalError(w, "login", err)
+		return
+	}
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     loginCookie,
+		Value:    state + "." + nonce + "." + verifier,
+		Path:     "/auth/",
+		MaxAge:   int(loginTimeout.Seconds()),
+		HttpOnly: true,
+		Secure:   s.secureCookies(),
+		SameSite: http.SameSiteLaxMode,
+	})
+	http.Redirect(w, r, url, http.StatusFound)
+}
+
+// callback completes a login: it redeems the authorization code for an ID
+// token and keeps the token in the session cookie
+func (s *Server) callback(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if e := q.Get("error"); e != "" {
+		writeError(w, http.StatusUnauthorized, fmt.Sprintf("login failed: %s %s", e, q.Get("error_description")))
+		return
+	}
+
+	cookie, err := r.Cookie(loginCookie)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, "login expired, please sign in again")
+		return
+	}
+	http.SetCookie(w, &http.Cookie{Name: loginCookie, Path: "/auth/", MaxAge: -1})
+
+	parts := strings.Split(cookie.Value, ".")
+	if len(parts) != 3 || subtle.ConstantTimeCompare([]byte(parts[0]), []byte(q.Get("state"))) != 1 {
+		writeError(w, http.StatusBadRequest, "invalid login state")
+		return
+	}
+	nonce, verifier := parts[1], parts[2]
+
+	token, err := s.oidc.Exchange(r.Context(), q.Get("code"), verifier)
+	if err != nil {
+		log.Printf("ERROR [callback]: %v", err)
+		writeError(w, http.StatusUnauthorized, "login failed")
+		return
+	}
+	claims, err := s.oidc.Verify(r.Context(), token)
+	if err != nil {
+		writeAuthError(w, err)
+		return
+	}
+	if subtle.ConstantTimeCompare([]byte(claims.String("nonce")), []byte(nonce)) != 1 {
+		writeError(w, http.StatusUnauthorized, "invalid token: nonce mismatch")
+		return
+	}
+	expires, _ := claims.Time("exp")
+
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Value:    token,
+		Path:     "/",
+		Expires:  expires,
+		HttpOnly: true,
+		Secure:   s.secureCookies(),
+		SameSite: http.SameSiteStrictMode,
+	})
+	log.Printf("AUDIT [login] from=%s user=%s", r.RemoteAddr, s.oidc.Username(claims))
+	http.Redirect(w, r, "/", http.StatusFound)
+}
+
+// logout clears the session cookie
+func (s *Server) logout(w http.ResponseWriter, r *http.Request) {
+	http.SetCookie(w, &http.Cookie{
+		Name:     sessionCookie,
+		Path:     "/",
+		MaxAge:   -1,
+		HttpOnly: true,
+		Secure:   s.secureCookies(),
+		SameSite: http.SameSiteStrictMode,
+	})
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// me describes the caller, so the web UI can show who is signed in
+func (s *Server) me(w http.ResponseWriter, r *http.Request) {
+	p := principal(r)
+	writeJSON(w, http.StatusOK, MeResponse{
+		Name:        p.Name,
+		Scopes:      p.Scopes,
+		Projects:    p.Projects,
+		Roles:       p.Roles,
+		DefaultRole: p.DefaultRole,
+	})
+}
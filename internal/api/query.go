@@ -0,0 +1,127 @@
+package api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"pgmanager/internal/db"
+)
+
+// Limits for ad-hoc queries. The maximum timeout stays below the 60 second request timeout.
+const (
+	DefaultQueryRows    = 1000
+	MaxQueryRows        = 10000
+	DefaultQueryTimeout = 30 * time.Second
+	MaxQueryTimeout     = 55 * time.Second
+)
+
+// QueryRequest is an ad-hoc SQL script to run against a database
+type QueryRequest struct {
+	SQL      string `json:"sql"`
+	ReadOnly bool   `json:"read_only"`
+	MaxRows  int    `json:"max_rows"` // Defaults to DefaultQueryRows, capped at MaxQueryRows
+	Timeout  int    `json:"timeout"`  // Seconds; defaults to DefaultQueryTimeout, capped at MaxQueryTimeout
+}
+
+// QueryResponse holds the result of each statement of the script
+type QueryResponse struct {
+	Results    []db.QueryResult `json:"results"`
+	DurationMs int64            `json:"duration_ms"`
+}
+
+// queryDatabase runs ad-hoc SQL as the database owner. Since this bypasses every other
+// safeguard of the API, it is only available to callers with an API token, and
+// every script is written to the log and the audit log together with the caller
+// and its outcome.
+func (s *Server) queryDatabase(w http.ResponseWriter, r *http.Request) {
+	if !principal(r).Authenticated() {
+		writeError(w, http.StatusForbidden, "queries require an API token")
+		return
+	}
+
+	projectName := chi.URLParam(r, "name")
+	env, prNumber, ok := parseEnvParam(w, r)
+	if !ok {
+		return
+	}
+
+	var req QueryRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+	if strings.TrimSpace(req.SQL) == "" {
+		writeError(w, http.StatusBadRequest, "sql is required")
+		return
+	}
+	maxRows, timeout, err := queryLimits(req)
+	if err != nil {
+		writeError(w, http.StatusBadRequest, err.Error())
+		return
+	}
+
+	audit(r, "query", "project=%s env=%s read_only=%t sql=%q",
+		projectName, chi.URLParam(r, "env"), req.ReadOnly, req.SQL)
+
+	ctx, cancel := context.WithTimeout(r.Context(), timeout)
+	defer cancel()
+
+	start := time.Now()
+	results, err := s.mgr.QueryDatabase(ctx, projectName, env, prNumber, req.SQL,
+		db.QueryOptions{ReadOnly: req.ReadOnly, MaxRows: maxRows})
+	elapsed := time.Since(start)
+	if err != nil {
+		audit(r, "query", "project=%s env=%s failed after %s: %v",
+			projectName, chi.URLParam(r, "env"), elapsed.Round(time.Millisecond), err)
+		switch {
+		case errors.Is(ctx.Err(), context.DeadlineExceeded):
+			writeError(w, http.StatusBadRequest, fmt.Sprintf("query exceeded the time limit of %s", timeout))
+		case strings.Contains(err.Error(), "not found"):
+			writeError(w, http.StatusNotFound, "database not found")
+		case db.IsQueryError(err), errors.Is(err, db.ErrReadOnlyScript), strings.Contains(err.Error(), "invalid environment"):
+			writeError(w, http.StatusBadRequest, err.Error())
+		default:
+			writeInternalError(w, "queryDatabase", err)
+		}
+		return
+	}
+
+	commands := make([]string, len(results))
+	for i, result := range results {
+		commands[i] = result.Command
+	}
+	audit(r, "query", "project=%s env=%s completed in %s: %s",
+		projectName, chi.URLParam(r, "env"), elapsed.Round(time.Millisecond), strings.Join(commands, ", "))
+
+	if results == nil {
+		results = []db.QueryResult{}
+	}
+	writeJSON(w, http.StatusOK, QueryResponse{Results: results, DurationMs: elapsed.Milliseconds()})
+}
+
+// queryLimits applies the defaults and caps to the limits requested
+func queryLimits(req QueryRequest) (int, time.Duration, error) {
+	if req.MaxRows < 0 || req.Timeout < 0 {
+		return 0, 0, fmt.Errorf("max_rows and timeout must not be negative")
+	}
+
+	maxRows := req.MaxRows
+	if maxRows == 0 {
+		maxRows = DefaultQueryRows
+	}
+	maxRows = min(maxRows, MaxQueryRows)
+
+	timeout := time.Duration(req.Timeout) * time.Second
+	if timeout == 0 {
+		timeout = DefaultQueryTimeout
+	}
+	timeout = min(timeout, MaxQueryTimeout)
+
+	return maxRows, timeout, nil
+}
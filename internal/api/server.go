@@ -12,7 +12,9 @@ import (
 
 	"github.com/go-chi/chi/v5"
 	"github.com/go-chi/chi/v5/middleware"
+	"pgmanager/internal/auth"
 	"pgmanager/internal/config"
+	"pgmanager/internal/oidc"
 	"pgmanager/internal/project"
 )
 
@@ -22,14 +24,22 @@ type Server struct {
 	mgr    *project.Manager
 	port   int
 	router *chi.Mux
+	oidc   *oidc.Provider // nil unless api.oidc is configured
+
+	// shutdown is closed when the server shuts down, ending event streams
+	shutdown chan struct{}
 }
 
 // NewServer creates a new API server
 func NewServer(cfg *config.Config, mgr *project.Manager, port int) *Server {
 	s := &Server{
-		cfg:  cfg,
-		mgr:  mgr,
-		port: port,
+		cfg:      cfg,
+		mgr:      mgr,
+		port:     port,
+		shutdown: make(chan struct{}),
+	}
+	if cfg.API.OIDC.Enabled() {
+		s.oidc = oidc.NewProvider(cfg.API.OIDC)
 	}
 	s.setupRoutes()
 	return s
@@ -43,7 +53,6 @@ func (s *Server) setupRoutes() {
 	r.Use(middleware.Recoverer)
 	r.Use(middleware.RequestID)
 	r.Use(middleware.RealIP)
-	r.Use(middleware.Timeout(60 * time.Second))
 
 	// Security middleware
 	r.Use(securityHeadersMiddleware)
@@ -60,26 +69,112 @@ func (s *Server) setupRoutes() {
 	// Health check (no auth required)
 	r.Get("/api/health", s.healthHandler)
 
-	// API routes with auth
-	r.Route("/api", func(r chi.Router) {
-		// Apply auth middleware if token is configured or required
-		if s.cfg.API.Token != "" || s.cfg.API.RequireToken {
-			r.Use(s.authMiddleware)
-		}
-
-		// Projects
-		r.Get("/projects", s.listProjects)
-		r.Post("/projects", s.createProject)
-		r.Delete("/projects/{name}", s.deleteProject)
+	// Web UI sign-in with the identity provider
+	if s.oidc != nil {
+		r.Get("/auth/login", s.login)
+		r.Get("/auth/callback", s.callback)
+		r.Post("/auth/logout", s.logout)
+	}
 
-		// Databases
-		r.Get("/projects/{name}/databases", s.listDatabases)
-		r.Post("/projects/{name}/databases", s.createDatabase)
-		r.Get("/projects/{name}/databases/{env}", s.getDatabase)
-		r.Delete("/projects/{name}/databases/{env}", s.deleteDatabase)
+	// Source code host webhooks, authenticated by their signature or token
+	if s.cfg.Integrations.GitHub.Enabled() {
+		r.With(originMiddleware).Post("/api/integrations/github", s.githubWebhook)
+	}
+	if s.cfg.Integrations.GitLab.Enabled() {
+		r.With(originMiddleware).Post("/api/integrations/gitlab", s.gitlabWebhook)
+	}
 
-		// Cleanup
-		r.Post("/cleanup", s.cleanup)
+	// API routes with auth. Each route requires a token scope and, on routes of a
+	// project, a role granting it to principals bound to roles; see auth.Scopes.
+	r.Route("/api", func(r chi.Router) {
+		r.Use(originMiddleware)
+		r.Use(s.authMiddleware)
+
+		read, create, del, admin := s.require(auth.ScopeRead), s.require(auth.ScopeCreate), s.require(auth.ScopeDelete), s.require(auth.ScopeAdmin)
+
+		// Dumps stream for as long as they need, and so do the uploads of restores,
+		// so they are exempt from the request timeout
+		r.With(admin).Get("/projects/{name}/databases/{env}/dump", s.dumpDatabase)
+		r.With(create).Post("/projects/{name}/databases/{env}/restore", s.restoreDatabase)
+
+		// Event streams stay open until the client leaves
+		r.With(read).Get("/events", s.streamEvents)
+
+		r.Group(func(r chi.Router) {
+			r.Use(middleware.Timeout(60 * time.Second))
+
+			// Caller
+			r.Get("/me", s.me)
+
+			// Projects
+			r.With(read).Get("/projects", s.listProjects)
+			r.With(create).Post("/projects", s.createProject)
+			r.With(del).Delete("/projects/{name}", s.deleteProject)
+
+			// Databases
+			r.With(read).Get("/projects/{name}/databases", s.listDatabases)
+			r.With(create).Post("/projects/{name}/databases", s.createDatabase)
+			r.With(read).Get("/projects/{name}/databases/{env}", s.getDatabase)
+			r.With(del).Delete("/projects/{name}/databases/{env}", s.deleteDatabase)
+			r.With(del).Post("/projects/{name}/databases/{env}/reset", s.resetDatabase)
+			r.With(admin).Get("/projects/{name}/databases/{env}/env", s.databaseEnv)
+			r.With(read).Get("/projects/{name}/databases/{env}/migrations", s.migrationStatus)
+			r.With(admin).Delete("/projects/{name}/databases/{env}/move", s.abortMove)
+
+			// Long operations, which run as jobs
+			r.With(create).Post("/projects/{name}/databases/{env}/backups", s.createBackup)
+			r.With(s.requireAll(auth.ScopeCreate)).Post("/backups/run", s.runBackups)
+			r.With(create).Post("/backups/{id}/restore", s.restoreBackup)
+			r.With(create).Post("/projects/{name}/databases/{env}/migrations/up", s.migrateUp)
+			r.With(del).Post("/projects/{name}/databases/{env}/migrations/down", s.migrateDown)
+			r.With(admin).Post("/projects/{name}/databases/{env}/move", s.moveDatabase)
+			r.With(s.requireAll(auth.ScopeAdmin)).Post("/apply", s.applyManifest)
+			r.With(s.requireAll(auth.ScopeDelete)).Post("/cleanup", s.cleanup)
+
+			// Ad-hoc SQL
+			r.With(admin).Post("/projects/{name}/databases/{env}/query", s.queryDatabase)
+
+			// Schema diff
+			r.With(read).Get("/projects/{name}/diff", s.diffDatabases)
+
+			// Sessions
+			r.With(read).Get("/projects/{name}/databases/{env}/sessions", s.listSessions)
+			r.With(del).Delete("/projects/{name}/databases/{env}/sessions", s.killSessions)
+			r.With(del).Delete("/projects/{name}/databases/{env}/sessions/{pid}", s.killSessions)
+
+			// Backups
+			r.With(read).Get("/backups", s.listAllBackups)
+			r.With(read).Get("/projects/{name}/databases/{env}/backups", s.listBackups)
+
+			// Manifests
+			r.With(s.requireAll(auth.ScopeRead)).Post("/plan", s.planManifest)
+
+			// Access
+			r.With(read).Get("/access", s.listAccess)
+			r.With(read).Get("/projects/{name}/access", s.listAccess)
+			r.With(admin).Put("/projects/{name}/access/{subject}", s.grantAccess)
+			r.With(admin).Delete("/projects/{name}/access/{subject}", s.revokeAccess)
+
+			// Audit log
+			r.With(read).Get("/audit", s.listAudit)
+
+			// Jobs; the manager checks the scope of each job's operation
+			r.With(read).Get("/jobs", s.listJobs)
+			r.With(read).Get("/jobs/{id}", s.getJob)
+			r.With(read).Delete("/jobs/{id}", s.cancelJob)
+
+			// Tokens
+			r.With(s.requireAll(auth.ScopeAdmin)).Get("/tokens", s.listTokens)
+			r.With(s.requireAll(auth.ScopeAdmin)).Post("/tokens", s.createToken)
+			r.With(s.requireAll(auth.ScopeAdmin)).Delete("/tokens/{token}", s.revokeToken)
+
+			// Webhooks
+			r.With(s.requireAll(auth.ScopeAdmin)).Get("/webhooks", s.listWebhooks)
+			r.With(s.requireAll(auth.ScopeAdmin)).Post("/webhooks", s.createWebhook)
+			r.With(s.requireAll(auth.ScopeAdmin)).Delete("/webhooks/{webhook}", s.deleteWebhook)
+			r.With(s.requireAll(auth.ScopeAdmin)).Post("/webhooks/{webhook}/test", s.testWebhook)
+			r.With(s.requireAll(auth.ScopeAdmin)).Get("/webhooks/{webhook}/deliveries", s.listWebhookDeliveries)
+		})
 	})
 
 	// Serve static files for web UI
@@ -101,6 +196,7 @@ func (s *Server) Start() error {
 		WriteTimeout: 15 * time.Second,
 		IdleTimeout:  60 * time.Second,
 	}
+	srv.RegisterOnShutdown(func() { close(s.shutdown) })
 
 	// Channel to listen for errors from ListenAndServe
 	serverErrors := make(chan error, 1)
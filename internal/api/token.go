@@ -0,0 +1,109 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"pgmanager/internal/meta"
+	"pgmanager/internal/project"
+)
+
+// CreateTokenRequest describes a new API token
+type CreateTokenRequest struct {
+	Name      string   `json:"name"`
+	Scopes    []string `json:"scopes"`
+	Projects  []string `json:"projects,omitempty"`
+	ExpiresIn string   `json:"expires_in,omitempty"` // Duration such as 90d or 720h; empty for no expiry
+}
+
+// TokenResponse describes an API token. Secret is only set when the token is created.
+type TokenResponse struct {
+	Name       string   `json:"name"`
+	Secret     string   `json:"secret,omitempty"`
+	Scopes     []string `json:"scopes"`
+	Projects   []string `json:"projects,omitempty"`
+	CreatedAt  string   `json:"created_at"`
+	ExpiresAt  *string  `json:"expires_at,omitempty"`
+	LastUsedAt *string  `json:"last_used_at,omitempty"`
+}
+
+// NewTokenResponse describes a token without its secret
+func NewTokenResponse(t meta.Token) TokenResponse {
+	return TokenResponse{
+		Name:       t.Name,
+		Scopes:     t.Scopes,
+		Projects:   t.Projects,
+		CreatedAt:  t.CreatedAt.Format(time.RFC3339),
+		ExpiresAt:  formatTime(t.ExpiresAt),
+		LastUsedAt: formatTime(t.LastUsedAt),
+	}
+}
+
+func (s *Server) listTokens(w http.ResponseWriter, r *http.Request) {
+	tokens, err := s.mgr.ListTokens(r.Context())
+	if err != nil {
+		writeInternalError(w, "listTokens", err)
+		return
+	}
+
+	response := make([]TokenResponse, len(tokens))
+	for i, t := range tokens {
+		response[i] = NewTokenResponse(t)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) createToken(w http.ResponseWriter, r *http.Request) {
+	var req CreateTokenRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	opts := project.TokenOptions{Name: req.Name, Scopes: req.Scopes, Projects: req.Projects}
+	if req.ExpiresIn != "" {
+		ttl, err := parseDuration(req.ExpiresIn)
+		if err != nil || ttl <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid expires_in duration")
+			return
+		}
+		opts.TTL = ttl
+	}
+
+	token, secret, err := s.mgr.CreateToken(r.Context(), opts)
+	if err != nil {
+		msg := err.Error()
+		switch {
+		case strings.Contains(msg, "already exists"):
+			writeError(w, http.StatusConflict, msg)
+		case strings.HasPrefix(msg, "invalid"), strings.Contains(msg, "required"):
+			writeError(w, http.StatusBadRequest, msg)
+		default:
+			writeInternalError(w, "createToken", err)
+		}
+		return
+	}
+
+	audit(r, "token", "created %s scopes=%s", token.Name, strings.Join(token.Scopes, ","))
+	response := NewTokenResponse(*token)
+	response.Secret = secret
+	writeJSON(w, http.StatusCreated, response)
+}
+
+func (s *Server) revokeToken(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "token")
+	if err := s.mgr.RevokeToken(r.Context(), name); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeInternalError(w, "revokeToken", err)
+		return
+	}
+
+	audit(r, "token", "revoked %s", name)
+	w.WriteHeader(http.StatusNoContent)
+}
@@ -0,0 +1,178 @@
+package api
+
+import (
+	"encoding/json"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/go-chi/chi/v5"
+	"pgmanager/internal/meta"
+	"pgmanager/internal/project"
+)
+
+// CreateWebhookRequest describes a new webhook
+type CreateWebhookRequest struct {
+	Name     string   `json:"name"`
+	URL      string   `json:"url"`
+	Secret   string   `json:"secret,omitempty"`   // Generated when empty
+	Events   []string `json:"events,omitempty"`   // Empty for every event
+	Projects []string `json:"projects,omitempty"` // Empty for every project
+}
+
+// WebhookResponse describes a webhook. Secret is only set when the webhook is created.
+type WebhookResponse struct {
+	Name      string   `json:"name"`
+	URL       string   `json:"url"`
+	Secret    string   `json:"secret,omitempty"`
+	Events    []string `json:"events,omitempty"`
+	Projects  []string `json:"projects,omitempty"`
+	CreatedAt string   `json:"created_at"`
+}
+
+// NewWebhookResponse describes a webhook without its secret
+func NewWebhookResponse(w meta.Webhook) WebhookResponse {
+	return WebhookResponse{
+		Name:      w.Name,
+		URL:       w.URL,
+		Events:    w.Events,
+		Projects:  w.Projects,
+		CreatedAt: w.CreatedAt.Format(time.RFC3339),
+	}
+}
+
+// WebhookDeliveryResponse describes a queued or past delivery of an event
+type WebhookDeliveryResponse struct {
+	ID            int64           `json:"id"`
+	Event         string          `json:"event"`
+	Status        string          `json:"status"`
+	Attempts      int             `json:"attempts"`
+	NextAttemptAt *string         `json:"next_attempt_at,omitempty"` // Only set for pending deliveries
+	ResponseCode  int             `json:"response_code,omitempty"`
+	Error         string          `json:"error,omitempty"`
+	Payload       json.RawMessage `json:"payload"`
+	CreatedAt     string          `json:"created_at"`
+	UpdatedAt     string          `json:"updated_at"`
+}
+
+// NewWebhookDeliveryResponse describes a webhook delivery
+func NewWebhookDeliveryResponse(d meta.WebhookDelivery) WebhookDeliveryResponse {
+	resp := WebhookDeliveryResponse{
+		ID:           d.ID,
+		Event:        d.Event,
+		Status:       d.Status,
+		Attempts:     d.Attempts,
+		ResponseCode: d.ResponseCode,
+		Error:        d.Error,
+		Payload:      d.Payload,
+		CreatedAt:    d.CreatedAt.Format(time.RFC3339),
+		UpdatedAt:    d.UpdatedAt.Format(time.RFC3339),
+	}
+	if d.Status == project.DeliveryPending {
+		resp.NextAttemptAt = formatTime(&d.NextAttemptAt)
+	}
+	return resp
+}
+
+func (s *Server) listWebhooks(w http.ResponseWriter, r *http.Request) {
+	webhooks, err := s.mgr.ListWebhooks(r.Context())
+	if err != nil {
+		writeInternalError(w, "listWebhooks", err)
+		return
+	}
+
+	response := make([]WebhookResponse, len(webhooks))
+	for i, wh := range webhooks {
+		response[i] = NewWebhookResponse(wh)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
+
+func (s *Server) createWebhook(w http.ResponseWriter, r *http.Request) {
+	var req CreateWebhookRequest
+	if err := json.NewDecoder(r.Body).Decode(&req); err != nil {
+		writeError(w, http.StatusBadRequest, "invalid request body")
+		return
+	}
+
+	opts := project.WebhookOptions{Name: req.Name, URL: req.URL, Secret: req.Secret, Events: req.Events, Projects: req.Projects}
+	webhook, err := s.mgr.CreateWebhook(r.Context(), opts)
+	if err != nil {
+		msg := err.Error()
+		switch {
+		case strings.Contains(msg, "already exists"):
+			writeError(w, http.StatusConflict, msg)
+		case strings.HasPrefix(msg, "invalid"):
+			writeError(w, http.StatusBadRequest, msg)
+		default:
+			writeInternalError(w, "createWebhook", err)
+		}
+		return
+	}
+
+	audit(r, "webhook", "created %s url=%s", webhook.Name, webhook.URL)
+	response := NewWebhookResponse(*webhook)
+	response.Secret = webhook.Secret
+	writeJSON(w, http.StatusCreated, response)
+}
+
+func (s *Server) deleteWebhook(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "webhook")
+	if err := s.mgr.DeleteWebhook(r.Context(), name); err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeInternalError(w, "deleteWebhook", err)
+		return
+	}
+
+	audit(r, "webhook", "deleted %s", name)
+	w.WriteHeader(http.StatusNoContent)
+}
+
+// testWebhook sends a ping to a webhook. The response describes the delivery
+// whether or not the endpoint accepted it.
+func (s *Server) testWebhook(w http.ResponseWriter, r *http.Request) {
+	name := chi.URLParam(r, "webhook")
+	delivery, err := s.mgr.TestWebhook(r.Context(), name)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeInternalError(w, "testWebhook", err)
+		return
+	}
+
+	audit(r, "webhook", "tested %s status=%s", name, delivery.Status)
+	writeJSON(w, http.StatusOK, NewWebhookDeliveryResponse(*delivery))
+}
+
+func (s *Server) listWebhookDeliveries(w http.ResponseWriter, r *http.Request) {
+	limit := 0
+	if v := r.URL.Query().Get("limit"); v != "" {
+		var err error
+		if limit, err = strconv.Atoi(v); err != nil || limit <= 0 {
+			writeError(w, http.StatusBadRequest, "invalid limit: must be a positive number")
+			return
+		}
+	}
+
+	deliveries, err := s.mgr.ListWebhookDeliveries(r.Context(), chi.URLParam(r, "webhook"), limit)
+	if err != nil {
+		if strings.Contains(err.Error(), "not found") {
+			writeError(w, http.StatusNotFound, err.Error())
+			return
+		}
+		writeInternalError(w, "listWebhookDeliveries", err)
+		return
+	}
+
+	response := make([]WebhookDeliveryResponse, len(deliveries))
+	for i, d := range deliveries {
+		response[i] = NewWebhookDeliveryResponse(d)
+	}
+	writeJSON(w, http.StatusOK, response)
+}
@@ -0,0 +1,218 @@
+// Package auth defines API tokens, the principals they authenticate and the
+// origin of the operations principals perform.
+package auth
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"slices"
+	"strings"
+)
+
+// Token scopes. Admin grants every other scope.
+const (
+	ScopeRead   = "read"   // List and inspect projects, databases, sessions and backups
+	ScopeCreate = "create" // Create projects and databases, migrate, back up and restore
+	ScopeDelete = "delete" // Delete and reset databases, terminate sessions, clean up
+	ScopeAdmin  = "admin"  // Run SQL, read credentials, move databases, apply manifests and manage tokens
+)
+
+// ErrPermissionDenied is wrapped by errors about principals that lack the
+// scope or role an operation needs
+var ErrPermissionDenied = errors.New("permission denied")
+
+// Scopes lists the valid scopes
+var Scopes = []string{ScopeRead, ScopeCreate, ScopeDelete, ScopeAdmin}
+
+// Project roles, from least to most privileged
+const (
+	RoleViewer     = "viewer"
+	RoleDeveloper  = "developer"
+	RoleMaintainer = "maintainer"
+	RoleAdmin      = "admin"
+)
+
+// Roles lists the valid roles
+var Roles = []string{RoleViewer, RoleDeveloper, RoleMaintainer, RoleAdmin}
+
+// RoleScopes lists the scopes each role grants on its project
+var RoleScopes = map[string][]string{
+	RoleViewer:     {ScopeRead},
+	RoleDeveloper:  {ScopeRead, ScopeCreate},
+	RoleMaintainer: {ScopeRead, ScopeCreate, ScopeDelete},
+	RoleAdmin:      {ScopeRead, ScopeCreate, ScopeDelete, ScopeAdmin},
+}
+
+// TokenPrefix starts every generated token, so leaked tokens are easy to search for
+const TokenPrefix = "pgm_"
+
+// Principal is the caller of an API request
+type Principal struct {
+	Name     string   // Token name, or a fixed name for the configured token and open access
+	Scopes   []string // Scopes granted
+	Projects []string // Projects the principal is limited to; empty for all
+
+	// Roles maps projects to the role the principal is bound to on them. A
+	// principal with any binding can only reach the projects it is bound to;
+	// nil means no bindings, so only Scopes and Projects apply.
+	Roles map[string]string
+
+	// DefaultRole is the role on projects missing from Roles, such as the role
+	// a signed-in user's groups grant on every project. Only used with Roles.
+	DefaultRole string
+}
+
+// Anonymous is the principal of requests to a server without authentication
+var Anonymous = &Principal{Name: "anonymous", Scopes: []string{ScopeAdmin}}
+
+// ConfigToken is the principal of requests made with api.token
+var ConfigToken = &Principal{Name: "api.token", Scopes: []string{ScopeAdmin}}
+
+// Can reports whether the principal has a scope
+func (p *Principal) Can(scope string) bool {
+	return slices.Contains(p.Scopes, ScopeAdmin) || slices.Contains(p.Scopes, scope)
+}
+
+// Role returns the role of the principal on a project, or "" if it has none
+func (p *Principal) Role(project string) string {
+	return HigherRole(p.Roles[project], p.DefaultRole)
+}
+
+// CanAccessProject reports whether the principal may work on a project
+func (p *Principal) CanAccessProject(name string) bool {
+	if len(p.Projects) > 0 && !slices.Contains(p.Projects, name) {
+		return false
+	}
+	return p.Roles == nil || p.Role(name) != ""
+}
+
+// CanOnProject reports whether the principal has a scope on a project: its
+// token must have the scope and, when bound to roles, its role on the project
+// must grant it too
+func (p *Principal) CanOnProject(scope, name string) bool {
+	if !p.Can(scope) || !p.CanAccessProject(name) {
+		return false
+	}
+	return p.Roles == nil || slices.Contains(RoleScopes[p.Role(name)], scope)
+}
+
+// CanOnAll reports whether the principal has a scope on every project, as
+// operations that span projects need
+func (p *Principal) CanOnAll(scope string) bool {
+	if !p.Can(scope) || len(p.Projects) > 0 {
+		return false
+	}
+	return p.Roles == nil || slices.Contains(RoleScopes[p.DefaultRole], scope)
+}
+
+// Restricted reports whether the principal is limited to some projects
+func (p *Principal) Restricted() bool {
+	return len(p.Projects) > 0 || (p.Roles != nil && p.DefaultRole == "")
+}
+
+// Authenticated reports whether the principal presented a credential
+func (p *Principal) Authenticated() bool {
+	return p != Anonymous
+}
+
+type principalKey struct{}
+
+// WithPrincipal returns a context carrying the principal
+func WithPrincipal(ctx context.Context, p *Principal) context.Context {
+	return context.WithValue(ctx, principalKey{}, p)
+}
+
+// FromContext returns the principal of a context, or nil if there is none
+func FromContext(ctx context.Context) *Principal {
+	p, _ := ctx.Value(principalKey{}).(*Principal)
+	return p
+}
+
+// Sources of operations, as recorded in the audit log
+const (
+	SourceCLI       = "cli"
+	SourceAPI       = "api"
+	SourceTUI       = "tui"
+	SourceScheduler = "scheduler"
+)
+
+// Origin tells where an operation came from
+type Origin struct {
+	Source    string // One of the Source constants
+	RequestID string // ID of the API request, if any
+}
+
+type originKey struct{}
+
+// WithOrigin returns a context carrying the origin of its operations
+func WithOrigin(ctx context.Context, o Origin) context.Context {
+	return context.WithValue(ctx, originKey{}, o)
+}
+
+// OriginFromContext returns the origin of a context. Contexts without one
+// belong to the local CLI.
+func OriginFromContext(ctx context.Context) Origin {
+	if o, ok := ctx.Value(originKey{}).(Origin); ok {
+		return o
+	}
+	return Origin{Source: SourceCLI}
+}
+
+// ValidateRole checks that role is one of Roles
+func ValidateRole(role string) error {
+	if !slices.Contains(Roles, role) {
+		return fmt.Errorf("invalid role '%s', must be one of: %s", role, strings.Join(Roles, ", "))
+	}
+	return nil
+}
+
+// HigherRole returns the more privileged of two roles; "" is below every role
+func HigherRole(a, b string) string {
+	if slices.Index(Roles, b) > slices.Index(Roles, a) {
+		return b
+	}
+	return a
+}
+
+// GenerateToken returns a new random token secret
+func GenerateToken() (string, error) {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate token: %w", err)
+	}
+	return TokenPrefix + hex.EncodeToString(b), nil
+}
+
+// HashToken returns the hash under which a token secret is stored. Tokens are
+// random, so a plain SHA-256 is enough.
+func HashToken(secret string) string {
+	sum := sha256.Sum256([]byte(secret))
+	return hex.EncodeToString(sum[:])
+}
+
+// ParseScopes validates a list of scopes, accepting comma separated values
+func ParseScopes(values []string) ([]string, error) {
+	var scopes []string
+	for _, value := range values {
+		for _, scope := range strings.Split(value, ",") {
+			scope = strings.TrimSpace(scope)
+			if scope == "" {
+				continue
+			}
+			if !slices.Contains(Scopes, scope) {
+				return nil, fmt.Errorf("invalid scope '%s', must be one of: %s", scope, strings.Join(Scopes, ", "))
+			}
+			if !slices.Contains(scopes, scope) {
+				scopes = append(scopes, scope)
+			}
+		}
+	}
+	if len(scopes) == 0 {
+		return nil, fmt.Errorf("at least one scope is required")
+	}
+	return scopes, nil
+}
@@ -0,0 +1,118 @@
+package auth
+
+import (
+	"context"
+	"strings"
+	"testing"
+)
+
+func TestParseScopes(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   []string
+		want    string
+		wantErr bool
+	}{
+		{"single", []string{"read"}, "read", false},
+		{"comma separated", []string{"read,create", "delete"}, "read,create,delete", false},
+		{"duplicates", []string{"read", " read "}, "read", false},
+		{"unknown", []string{"write"}, "", true},
+		{"empty", []string{""}, "", true},
+		{"none", nil, "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got, err := ParseScopes(tt.input)
+			if (err != nil) != tt.wantErr {
+				t.Fatalf("ParseScopes() error = %v, wantErr %v", err, tt.wantErr)
+			}
+			if strings.Join(got, ",") != tt.want {
+				t.Errorf("ParseScopes() = %v, want %s", got, tt.want)
+			}
+		})
+	}
+}
+
+func TestPrincipal(t *testing.T) {
+	p := &Principal{Name: "ci", Scopes: []string{ScopeRead, ScopeCreate}, Projects: []string{"myapp"}}
+	if !p.Can(ScopeRead) || !p.Can(ScopeCreate) || p.Can(ScopeDelete) || p.Can(ScopeAdmin) {
+		t.Errorf("Can() of %v is wrong", p.Scopes)
+	}
+	if !p.CanAccessProject("myapp") || p.CanAccessProject("other") || !p.Restricted() {
+		t.Errorf("project access of %v is wrong", p.Projects)
+	}
+	if !p.Authenticated() || Anonymous.Authenticated() {
+		t.Error("Authenticated() is wrong")
+	}
+
+	admin := &Principal{Name: "admin", Scopes: []string{ScopeAdmin}}
+	for _, scope := range Scopes {
+		if !admin.Can(scope) {
+			t.Errorf("admin cannot %s", scope)
+		}
+	}
+	if !admin.CanAccessProject("anything") || admin.Restricted() {
+		t.Error("unrestricted principal is restricted")
+	}
+
+	if FromContext(context.Background()) != nil {
+		t.Error("FromContext() of an empty context is not nil")
+	}
+	if FromContext(WithPrincipal(context.Background(), p)) != p {
+		t.Error("FromContext() did not return the stored principal")
+	}
+}
+
+func TestGenerateToken(t *testing.T) {
+	a, err := GenerateToken()
+	if err != nil {
+		t.Fatalf("GenerateToken() error = %v", err)
+	}
+	b, _ := GenerateToken()
+	if !strings.HasPrefix(a, TokenPrefix) || len(a) != len(TokenPrefix)+64 || a == b {
+		t.Errorf("GenerateToken() = %q, %q", a, b)
+	}
+	if HashToken(a) != HashToken(a) || HashToken(a) == HashToken(b) || HashToken(a) == a {
+		t.Error("HashToken() is not a stable hash")
+	}
+}
+
+func TestRoles(t *testing.T) {
+	p := &Principal{Name: "team-a", Scopes: []string{ScopeAdmin}, Roles: map[string]string{"app_a": RoleMaintainer, "shared": RoleViewer}}
+
+	tests := []struct {
+		scope   string
+		project string
+		want    bool
+	}{
+		{ScopeDelete, "app_a", true},
+		{ScopeAdmin, "app_a", false},
+		{ScopeRead, "shared", true},
+		{ScopeCreate, "shared", false},
+		{ScopeRead, "app_b", false},
+	}
+	for _, tt := range tests {
+		if got := p.CanOnProject(tt.scope, tt.project); got != tt.want {
+			t.Errorf("CanOnProject(%s, %s) = %v, want %v", tt.scope, tt.project, got, tt.want)
+		}
+	}
+	if !p.Restricted() || p.CanAccessProject("app_b") {
+		t.Error("principal with roles is not limited to its projects")
+	}
+
+	// Roles do not grant more than the token's scopes
+	reader := &Principal{Name: "reader", Scopes: []string{ScopeRead}, Roles: map[string]string{"app_a": RoleAdmin}}
+	if reader.CanOnProject(ScopeDelete, "app_a") || !reader.CanOnProject(ScopeRead, "app_a") {
+		t.Error("role granted more than the token's scopes")
+	}
+
+	if err := ValidateRole("owner"); err == nil {
+		t.Error("ValidateRole(owner) succeeded")
+	}
+	for _, role := range Roles {
+		if err := ValidateRole(role); err != nil || len(RoleScopes[role]) == 0 {
+			t.Errorf("role %s is not valid or grants nothing", role)
+		}
+	}
+}
@@ -0,0 +1,113 @@
+// Package backup provides the storage targets backups are written to.
+package backup
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"io/fs"
+	"os"
+	"path/filepath"
+	"strings"
+)
+
+// Target stores backup archives under keys. Implementations must be safe for
+// concurrent use.
+type Target interface {
+	// Name identifies the target in backup records
+	Name() string
+	// Write stores the contents of r under key and returns the number of bytes
+	// written. It fails if key already exists rather than overwriting it.
+	Write(ctx context.Context, key string, r io.Reader) (int64, error)
+	// Open returns a reader for the archive stored under key
+	Open(ctx context.Context, key string) (io.ReadCloser, error)
+	// Delete removes the archive stored under key. Deleting a missing key is not an error.
+	Delete(ctx context.Context, key string) error
+}
+
+// LocalTarget stores backups as files in a directory
+type LocalTarget struct {
+	dir string
+}
+
+// NewLocalTarget creates a target that stores backups under dir
+func NewLocalTarget(dir string) *LocalTarget {
+	return &LocalTarget{dir: dir}
+}
+
+// Name returns "local"
+func (t *LocalTarget) Name() string {
+	return "local"
+}
+
+// path resolves key to a file inside the target directory
+func (t *LocalTarget) path(key string) (string, error) {
+	p := filepath.Join(t.dir, filepath.FromSlash(key))
+	rel, err := filepath.Rel(t.dir, p)
+	if err != nil || rel == "." || strings.HasPrefix(rel, "..") {
+		return "", fmt.Errorf("invalid backup key '%s'", key)
+	}
+	return p, nil
+}
+
+// Write stores r in a file, writing to a temporary file first so a failed
+// backup never leaves a partial archive under key. The file is linked into
+// place, which unlike a rename fails if key exists.
+func (t *LocalTarget) Write(ctx context.Context, key string, r io.Reader) (int64, error) {
+	p, err := t.path(key)
+	if err != nil {
+		return 0, err
+	}
+	if err := os.MkdirAll(filepath.Dir(p), 0700); err != nil {
+		return 0, fmt.Errorf("failed to create backup directory: %w", err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(p), ".partial-*")
+	if err != nil {
+		return 0, fmt.Errorf("failed to create backup file: %w", err)
+	}
+	defer os.Remove(tmp.Name())
+
+	n, err := io.Copy(tmp, r)
+	if err != nil {
+		tmp.Close()
+		return 0, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := tmp.Close(); err != nil {
+		return 0, fmt.Errorf("failed to write backup: %w", err)
+	}
+	if err := os.Link(tmp.Name(), p); err != nil {
+		if errors.Is(err, fs.ErrExist) {
+			return 0, fmt.Errorf("backup '%s' already exists", key)
+		}
+		return 0, fmt.Errorf("failed to store backup: %w", err)
+	}
+
+	return n, nil
+}
+
+// Open opens the file stored under key
+func (t *LocalTarget) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	p, err := t.path(key)
+	if err != nil {
+		return nil, err
+	}
+	f, err := os.Open(p)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open backup: %w", err)
+	}
+	return f, nil
+}
+
+// Delete removes the file stored under key
+func (t *LocalTarget) Delete(ctx context.Context, key string) error {
+	p, err := t.path(key)
+	if err != nil {
+		return err
+	}
+	if err := os.Remove(p); err != nil && !os.IsNotExist(err) {
+		return fmt.Errorf("failed to delete backup: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,62 @@
+package backup
+
+import (
+	"context"
+	"io"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func TestLocalTarget(t *testing.T) {
+	ctx := context.Background()
+	dir := t.TempDir()
+	target := NewLocalTarget(dir)
+
+	n, err := target.Write(ctx, "myapp_prod/20240310T023000Z.dump.gz", strings.NewReader("archive"))
+	if err != nil {
+		t.Fatalf("Write() error = %v", err)
+	}
+	if n != 7 {
+		t.Errorf("Write() = %d bytes, want 7", n)
+	}
+
+	r, err := target.Open(ctx, "myapp_prod/20240310T023000Z.dump.gz")
+	if err != nil {
+		t.Fatalf("Open() error = %v", err)
+	}
+	data, _ := io.ReadAll(r)
+	r.Close()
+	if string(data) != "archive" {
+		t.Errorf("Open() contents = %q, want %q", data, "archive")
+	}
+
+	// An existing backup is never overwritten
+	if _, err := target.Write(ctx, "myapp_prod/20240310T023000Z.dump.gz", strings.NewReader("other")); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("Write() of an existing key error = %v", err)
+	}
+
+	// No temporary files are left behind
+	entries, _ := os.ReadDir(filepath.Join(dir, "myapp_prod"))
+	if len(entries) != 1 {
+		t.Errorf("backup directory has %d entries, want 1", len(entries))
+	}
+
+	if err := target.Delete(ctx, "myapp_prod/20240310T023000Z.dump.gz"); err != nil {
+		t.Fatalf("Delete() error = %v", err)
+	}
+	if err := target.Delete(ctx, "myapp_prod/20240310T023000Z.dump.gz"); err != nil {
+		t.Errorf("Delete() of a missing key error = %v, want nil", err)
+	}
+}
+
+func TestLocalTargetRejectsEscapingKeys(t *testing.T) {
+	target := NewLocalTarget(t.TempDir())
+
+	for _, key := range []string{"../outside.dump.gz", "a/../../outside", ""} {
+		if _, err := target.Write(context.Background(), key, strings.NewReader("x")); err == nil {
+			t.Errorf("Write(%q) should fail", key)
+		}
+	}
+}
@@ -0,0 +1,1050 @@
+// Package client is a Go client for the pgmanager REST API. Client implements
+// project.Service, so the CLI and the TUI can work through a pgmanager server
+// instead of connecting to PostgreSQL themselves.
+package client
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strconv"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+	"pgmanager/internal/api"
+	"pgmanager/internal/db"
+	"pgmanager/internal/export"
+	"pgmanager/internal/manifest"
+	"pgmanager/internal/meta"
+	"pgmanager/internal/migrate"
+	"pgmanager/internal/project"
+)
+
+// Client talks to a pgmanager server
+type Client struct {
+	baseURL string
+	token   string
+	http    *http.Client
+}
+
+var _ project.Service = (*Client)(nil)
+
+// New creates a client for the server at serverURL (e.g. https://pgm.internal).
+// The token is sent as a Bearer token when it is not empty.
+func New(serverURL, token string) *Client {
+	return &Client{
+		baseURL: strings.TrimRight(serverURL, "/") + "/api",
+		token:   token,
+		// No overall timeout: dumps and uploaded restores stream for as long as they need
+		http: &http.Client{},
+	}
+}
+
+// Error is an error response from the server
+type Error struct {
+	StatusCode int
+	Message    string
+}
+
+func (e *Error) Error() string {
+	return e.Message
+}
+
+// Close releases idle connections
+func (c *Client) Close() error {
+	c.http.CloseIdleConnections()
+	return nil
+}
+
+// send performs a request and returns the response if it succeeded. Error
+// responses are returned as *Error.
+func (c *Client) send(ctx context.Context, method, path string, query url.Values, header http.Header, body io.Reader, contentType string) (*http.Response, error) {
+	u := c.baseURL + path
+	if len(query) > 0 {
+		u += "?" + query.Encode()
+	}
+
+	req, err := http.NewRequestWithContext(ctx, method, u, body)
+	if err != nil {
+		return nil, err
+	}
+	for key, values := range header {
+		req.Header[key] = values
+	}
+	if contentType != "" {
+		req.Header.Set("Content-Type", contentType)
+	}
+	if c.token != "" {
+		req.Header.Set("Authorization", "Bearer "+c.token)
+	}
+
+	resp, err := c.http.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to reach pgmanager server: %w", err)
+	}
+	if resp.StatusCode >= 400 {
+		defer resp.Body.Close()
+		var errResp api.ErrorResponse
+		if err := json.NewDecoder(resp.Body).Decode(&errResp); err != nil || errResp.Error == "" {
+			errResp.Error = fmt.Sprintf("server returned %s", resp.Status)
+		}
+		return nil, &Error{StatusCode: resp.StatusCode, Message: errResp.Error}
+	}
+	return resp, nil
+}
+
+// do sends in as JSON (unless it is nil) and decodes the response into out (unless it is nil)
+func (c *Client) do(ctx context.Context, method, path string, query url.Values, in, out any) error {
+	resp, err := c.sendJSON(ctx, method, path, query, nil, in)
+	if err != nil {
+		return err
+	}
+	return decode(resp, out)
+}
+
+// sendJSON sends in as JSON, unless it is nil
+func (c *Client) sendJSON(ctx context.Context, method, path string, query url.Values, header http.Header, in any) (*http.Response, error) {
+	var body io.Reader
+	contentType := ""
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return nil, err
+		}
+		body = bytes.NewReader(data)
+		contentType = "application/json"
+	}
+	return c.send(ctx, method, path, query, header, body, contentType)
+}
+
+// decode decodes and closes a JSON response. A nil out discards it.
+func decode(resp *http.Response, out any) error {
+	defer resp.Body.Close()
+
+	if out == nil {
+		return nil
+	}
+	dec := json.NewDecoder(resp.Body)
+	// Query results keep integers exact
+	dec.UseNumber()
+	if err := dec.Decode(out); err != nil {
+		return fmt.Errorf("invalid response from server: %w", err)
+	}
+	return nil
+}
+
+// databasePath returns the API path of a database
+func databasePath(projectName, env string, prNumber *int) string {
+	if prNumber != nil {
+		env = fmt.Sprintf("%s_%d", env, *prNumber)
+	}
+	return "/projects/" + url.PathEscape(projectName) + "/databases/" + url.PathEscape(env)
+}
+
+// CreateProject creates a new project
+func (c *Client) CreateProject(ctx context.Context, name string) (*meta.Project, error) {
+	var resp api.ProjectResponse
+	if err := c.do(ctx, http.MethodPost, "/projects", nil, api.CreateProjectRequest{Name: name}, &resp); err != nil {
+		return nil, err
+	}
+	p := toProject(resp)
+	return &p, nil
+}
+
+// ListProjects returns all projects
+func (c *Client) ListProjects(ctx context.Context) ([]meta.Project, error) {
+	var resp []api.ProjectResponse
+	if err := c.do(ctx, http.MethodGet, "/projects", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	projects := make([]meta.Project, len(resp))
+	for i, p := range resp {
+		projects[i] = toProject(p)
+	}
+	return projects, nil
+}
+
+// DeleteProject deletes a project and all its databases
+func (c *Client) DeleteProject(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/projects/"+url.PathEscape(name), nil, nil, nil)
+}
+
+// CreateDatabase creates a database; the result includes its credentials
+func (c *Client) CreateDatabase(ctx context.Context, projectName, env string, prNumber *int, server string) (*project.DatabaseInfo, error) {
+	req := api.CreateDatabaseRequest{Env: env, PRNumber: prNumber, Server: server}
+	var resp api.DatabaseResponse
+	if err := c.do(ctx, http.MethodPost, "/projects/"+url.PathEscape(projectName)+"/databases", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return &project.DatabaseInfo{
+		Project:      resp.Project,
+		Env:          resp.Env,
+		PRNumber:     resp.PRNumber,
+		DatabaseName: resp.DatabaseName,
+		UserName:     resp.UserName,
+		Password:     resp.Password,
+		Server:       resp.Server,
+		Host:         resp.Host,
+		Port:         resp.Port,
+		ConnString:   resp.ConnString,
+		CreatedAt:    parseTime(resp.CreatedAt),
+		ExpiresAt:    parseOptionalTime(resp.ExpiresAt),
+	}, nil
+}
+
+// GetDatabase returns a database. The server does not return credentials here;
+// use Credentials for them.
+func (c *Client) GetDatabase(ctx context.Context, projectName, env string, prNumber *int) (*project.DatabaseInfo, error) {
+	var resp api.DatabaseInfoResponse
+	if err := c.do(ctx, http.MethodGet, databasePath(projectName, env, prNumber), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	info := toDatabaseInfo(resp)
+	return &info, nil
+}
+
+// Credentials returns a database including its password and connection string.
+// The server only serves credentials when it has an API token configured.
+func (c *Client) Credentials(ctx context.Context, projectName, env string, prNumber *int) (*project.DatabaseInfo, error) {
+	info, err := c.GetDatabase(ctx, projectName, env, prNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	var vars map[string]string
+	query := url.Values{"format": {"json"}}
+	if err := c.do(ctx, http.MethodGet, databasePath(projectName, env, prNumber)+"/env", query, nil, &vars); err != nil {
+		return nil, err
+	}
+	info.Host = vars[export.VarHost]
+	info.Port, _ = strconv.Atoi(vars[export.VarPort])
+	info.DatabaseName = vars[export.VarDatabase]
+	info.UserName = vars[export.VarUser]
+	info.Password = vars[export.VarPassword]
+	info.SSLMode = vars[export.VarSSLMode]
+	info.ConnString = vars[export.VarURL]
+	return info, nil
+}
+
+// ListDatabases returns the databases of a project
+func (c *Client) ListDatabases(ctx context.Context, projectName string) ([]project.DatabaseInfo, error) {
+	var resp []api.DatabaseInfoResponse
+	if err := c.do(ctx, http.MethodGet, "/projects/"+url.PathEscape(projectName)+"/databases", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	databases := make([]project.DatabaseInfo, len(resp))
+	for i, d := range resp {
+		databases[i] = toDatabaseInfo(d)
+	}
+	return databases, nil
+}
+
+// DeleteDatabase deletes a database
+func (c *Client) DeleteDatabase(ctx context.Context, projectName, env string, prNumber *int) error {
+	return c.do(ctx, http.MethodDelete, databasePath(projectName, env, prNumber), nil, nil, nil)
+}
+
+// ResetDatabase empties a database while keeping its credentials
+func (c *Client) ResetDatabase(ctx context.Context, projectName, env string, prNumber *int, opts project.ResetOptions) error {
+	req := api.ResetDatabaseRequest{KeepDatabase: opts.KeepDatabase, SkipSeed: opts.SkipSeed}
+	return c.do(ctx, http.MethodPost, databasePath(projectName, env, prNumber)+"/reset", nil, req, nil)
+}
+
+// ListSessions returns the sessions connected to a database
+func (c *Client) ListSessions(ctx context.Context, projectName, env string, prNumber *int) ([]db.Session, error) {
+	var resp []api.SessionResponse
+	if err := c.do(ctx, http.MethodGet, databasePath(projectName, env, prNumber)+"/sessions", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	sessions := make([]db.Session, len(resp))
+	for i, s := range resp {
+		sessions[i] = db.Session{
+			PID:        s.PID,
+			User:       s.User,
+			ClientAddr: s.ClientAddr,
+			State:      s.State,
+			QueryStart: parseOptionalTime(s.QueryStart),
+			Query:      s.Query,
+		}
+	}
+	return sessions, nil
+}
+
+// KillSessions terminates one session, or all sessions of a database when pid is 0
+func (c *Client) KillSessions(ctx context.Context, projectName, env string, prNumber *int, pid int) (int, error) {
+	path := databasePath(projectName, env, prNumber) + "/sessions"
+	if pid != 0 {
+		path += "/" + strconv.Itoa(pid)
+	}
+	var resp api.KillSessionsResponse
+	if err := c.do(ctx, http.MethodDelete, path, nil, nil, &resp); err != nil {
+		return 0, err
+	}
+	return resp.Terminated, nil
+}
+
+// errMigrationsDir is returned when a migrations directory is given; the server
+// only runs the migrations in the project's configured directory
+var errMigrationsDir = errors.New("migrations are read from the server's configured directory; a directory cannot be given in remote mode")
+
+// Migrate applies the pending migrations of a database
+func (c *Client) Migrate(ctx context.Context, projectName, env string, prNumber *int, dir string) ([]migrate.Migration, error) {
+	if dir != "" {
+		return nil, errMigrationsDir
+	}
+	var resp []api.MigrationResponse
+	req := project.JobRequest{Kind: project.JobMigrate, Project: projectName, Env: env, PRNumber: prNumber}
+	if err := c.doJob(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return toMigrations(resp), nil
+}
+
+// MigrateDown reverts up to steps of the most recently applied migrations
+func (c *Client) MigrateDown(ctx context.Context, projectName, env string, prNumber *int, dir string, steps int) ([]migrate.Migration, error) {
+	if dir != "" {
+		return nil, errMigrationsDir
+	}
+	if steps <= 0 {
+		return nil, fmt.Errorf("steps must be positive")
+	}
+	var resp []api.MigrationResponse
+	req := project.JobRequest{Kind: project.JobMigrateDown, Project: projectName, Env: env, PRNumber: prNumber, Steps: steps}
+	if err := c.doJob(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return toMigrations(resp), nil
+}
+
+// MigrationStatus reports which migrations have been applied to a database
+func (c *Client) MigrationStatus(ctx context.Context, projectName, env string, prNumber *int, dir string) ([]migrate.Status, error) {
+	if dir != "" {
+		return nil, errMigrationsDir
+	}
+	var resp []api.MigrationStatusResponse
+	if err := c.do(ctx, http.MethodGet, databasePath(projectName, env, prNumber)+"/migrations", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	statuses := make([]migrate.Status, len(resp))
+	for i, s := range resp {
+		statuses[i] = migrate.Status{
+			Version:   s.Version,
+			Name:      s.Name,
+			AppliedAt: parseOptionalTime(s.AppliedAt),
+			Missing:   s.Missing,
+		}
+	}
+	return statuses, nil
+}
+
+// DumpDatabase writes a dump of a database to w
+func (c *Client) DumpDatabase(ctx context.Context, projectName, env string, prNumber *int, w io.Writer) (*db.DumpStats, error) {
+	resp, err := c.send(ctx, http.MethodGet, databasePath(projectName, env, prNumber)+"/dump", nil, nil, nil, "")
+	if err != nil {
+		return nil, err
+	}
+	defer resp.Body.Close()
+
+	if _, err := io.Copy(w, resp.Body); err != nil {
+		return nil, fmt.Errorf("failed to download dump: %w", err)
+	}
+
+	// The trailers are only sent once the dump is complete
+	tables, err := strconv.Atoi(resp.Trailer.Get(api.TrailerDumpTables))
+	if err != nil {
+		return nil, fmt.Errorf("dump is incomplete, see the server log")
+	}
+	rows, _ := strconv.ParseInt(resp.Trailer.Get(api.TrailerDumpRows), 10, 64)
+	return &db.DumpStats{Tables: tables, Rows: rows}, nil
+}
+
+// RestoreDatabase restores a dump read from r into a database
+func (c *Client) RestoreDatabase(ctx context.Context, projectName, env string, prNumber *int, r io.Reader) (*project.RestoreResult, error) {
+	var resp api.RestoreResponse
+	req := project.JobRequest{Kind: project.JobRestore, Project: projectName, Env: env, PRNumber: prNumber, Dump: r}
+	if err := c.doJob(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return toRestoreResult(resp), nil
+}
+
+// DiffDatabases compares the schemas of two environments of a project
+func (c *Client) DiffDatabases(ctx context.Context, projectName, fromEnv string, fromPR *int, toEnv string, toPR *int) (*db.SchemaDiff, error) {
+	query := url.Values{"from": {envName(fromEnv, fromPR)}, "to": {envName(toEnv, toPR)}}
+	var diff db.SchemaDiff
+	if err := c.do(ctx, http.MethodGet, "/projects/"+url.PathEscape(projectName)+"/diff", query, nil, &diff); err != nil {
+		return nil, err
+	}
+	return &diff, nil
+}
+
+// QueryDatabase runs an SQL script against a database. The server limits the
+// number of rows and the run time.
+func (c *Client) QueryDatabase(ctx context.Context, projectName, env string, prNumber *int, script string, opts db.QueryOptions) ([]db.QueryResult, error) {
+	req := api.QueryRequest{SQL: script, ReadOnly: opts.ReadOnly, MaxRows: opts.MaxRows}
+	var resp api.QueryResponse
+	if err := c.do(ctx, http.MethodPost, databasePath(projectName, env, prNumber)+"/query", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	return resp.Results, nil
+}
+
+// MoveDatabase moves a database to another server, passing on the lines the
+// move job logs as progress
+func (c *Client) MoveDatabase(ctx context.Context, projectName, env string, prNumber *int, target string, dropSource bool,
+	progress func(project.MoveProgress)) error {
+	req := project.JobRequest{Kind: project.JobMove, Project: projectName, Env: env, PRNumber: prNumber, Server: target, DropSource: dropSource}
+	printed := 0
+	info, err := c.runJob(ctx, req, func(update *project.JobInfo) {
+		for _, l := range update.Logs[min(printed, len(update.Logs)):] {
+			if progress != nil {
+				progress(project.MoveProgress{Message: l.Message})
+			}
+		}
+		printed = len(update.Logs)
+	})
+	if err != nil {
+		return err
+	}
+	return jobError(&info.Job)
+}
+
+// AbortMove abandons an in-progress move
+func (c *Client) AbortMove(ctx context.Context, projectName, env string, prNumber *int) error {
+	return c.do(ctx, http.MethodDelete, databasePath(projectName, env, prNumber)+"/move", nil, nil, nil)
+}
+
+// BackupDatabase writes a backup of a database to the server's backup target
+func (c *Client) BackupDatabase(ctx context.Context, projectName, env string, prNumber *int) (*meta.Backup, error) {
+	var resp api.BackupResponse
+	req := project.JobRequest{Kind: project.JobBackupCreate, Project: projectName, Env: env, PRNumber: prNumber}
+	if err := c.doJob(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	b := toBackup(resp)
+	return &b, nil
+}
+
+// ListBackups returns the backups of a project environment. An empty project lists all backups.
+func (c *Client) ListBackups(ctx context.Context, projectName, env string, prNumber *int) ([]meta.Backup, error) {
+	path := "/backups"
+	if projectName != "" {
+		path = databasePath(projectName, env, prNumber) + "/backups"
+	}
+	var resp []api.BackupResponse
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	return toBackups(resp), nil
+}
+
+// RestoreBackup restores a backup into a database
+func (c *Client) RestoreBackup(ctx context.Context, id int64, projectName, env string, prNumber *int) (*project.RestoreResult, error) {
+	req := project.JobRequest{Kind: project.JobBackupRestore, BackupID: id, Project: projectName, Env: env, PRNumber: prNumber}
+	var resp api.RestoreResponse
+	if err := c.doJob(ctx, req, &resp); err != nil {
+		return nil, err
+	}
+	return toRestoreResult(resp), nil
+}
+
+// RunBackups backs up every environment with a backup schedule and prunes old backups
+func (c *Client) RunBackups(ctx context.Context, force bool) (*project.BackupRunResult, error) {
+	var resp api.BackupRunResponse
+	if err := c.doJob(ctx, project.JobRequest{Kind: project.JobBackupRun, Force: force}, &resp); err != nil {
+		return nil, err
+	}
+	result := &project.BackupRunResult{
+		Created: toBackups(resp.Created),
+		Pruned:  toBackups(resp.Pruned),
+	}
+	for _, f := range resp.Failed {
+		result.Failed = append(result.Failed, project.BackupFailure{DatabaseName: f.DatabaseName, Error: f.Error})
+	}
+	return result, nil
+}
+
+// Cleanup deletes PR databases older than olderThan and applies the cleanup rules
+func (c *Client) Cleanup(ctx context.Context, olderThan time.Duration) (*project.CleanupResult, error) {
+	var resp api.CleanupResponse
+	if err := c.doJob(ctx, project.JobRequest{Kind: project.JobCleanup, OlderThan: olderThan}, &resp); err != nil {
+		return nil, err
+	}
+	result := &project.CleanupResult{Deleted: resp.Deleted}
+	for _, w := range resp.Warnings {
+		idleFor, _ := time.ParseDuration(w.IdleFor)
+		result.Warnings = append(result.Warnings, project.IdleDatabase{
+			DatabaseName: w.DatabaseName,
+			Env:          w.Env,
+			LastActivity: parseTime(w.LastActivity),
+			IdleFor:      idleFor,
+		})
+	}
+	return result, nil
+}
+
+// doJob runs a long operation as a job on the server, waits for it to finish
+// and decodes its result into out
+func (c *Client) doJob(ctx context.Context, req project.JobRequest, out any) error {
+	info, err := c.runJob(ctx, req, nil)
+	if err != nil {
+		return err
+	}
+	if err := jobError(&info.Job); err != nil {
+		return err
+	}
+	return decodeResult(info, out)
+}
+
+// runJob starts a job on the server and waits for it to finish, calling
+// onUpdate, if set, with each state read. If ctx is done first, the job is
+// canceled.
+func (c *Client) runJob(ctx context.Context, req project.JobRequest, onUpdate func(*project.JobInfo)) (*project.JobInfo, error) {
+	job, err := c.StartJob(ctx, req)
+	if err != nil {
+		return nil, err
+	}
+
+	info, err := project.WaitJob(ctx, c, job.ID, jobPollInterval, onUpdate)
+	if err != nil {
+		if ctx.Err() != nil {
+			// Nobody is waiting for the result anymore
+			cancelCtx, cancel := context.WithTimeout(context.WithoutCancel(ctx), 10*time.Second)
+			defer cancel()
+			_ = c.CancelJob(cancelCtx, job.ID)
+		}
+		return nil, err
+	}
+	return info, nil
+}
+
+// decodeResult decodes the result of a finished job into out
+func decodeResult(info *project.JobInfo, out any) error {
+	if err := json.Unmarshal(info.Result, out); err != nil {
+		return fmt.Errorf("invalid response from server: %w", err)
+	}
+	return nil
+}
+
+// jobPollInterval is how often runJob polls the job it waits for
+const jobPollInterval = time.Second
+
+// jobError returns the error a finished job failed with, if any
+func jobError(job *meta.Job) error {
+	switch job.Status {
+	case project.JobFailed:
+		return errors.New(job.Error)
+	case project.JobCanceled:
+		return fmt.Errorf("job %d was canceled", job.ID)
+	}
+	return nil
+}
+
+// jobEndpoint returns the request that starts an operation as a job
+func jobEndpoint(req project.JobRequest) (path string, query url.Values, body io.Reader, contentType string, err error) {
+	var in any
+	switch req.Kind {
+	case project.JobCleanup:
+		path, in = "/cleanup", api.CleanupRequest{OlderThan: durationString(req.OlderThan)}
+	case project.JobBackupRun:
+		path, query = "/backups/run", url.Values{"force": {strconv.FormatBool(req.Force)}}
+	case project.JobBackupCreate:
+		path = databasePath(req.Project, req.Env, req.PRNumber) + "/backups"
+	case project.JobBackupRestore:
+		path = "/backups/" + strconv.FormatInt(req.BackupID, 10) + "/restore"
+		in = api.RestoreBackupRequest{Project: req.Project, Env: req.Env, PRNumber: req.PRNumber}
+	case project.JobRestore:
+		return databasePath(req.Project, req.Env, req.PRNumber) + "/restore", nil, req.Dump, "application/gzip", nil
+	case project.JobMove:
+		path = databasePath(req.Project, req.Env, req.PRNumber) + "/move"
+		in = api.MoveRequest{Target: req.Server, DropSource: req.DropSource}
+	case project.JobMigrate:
+		path = databasePath(req.Project, req.Env, req.PRNumber) + "/migrations/up"
+	case project.JobMigrateDown:
+		path = databasePath(req.Project, req.Env, req.PRNumber) + "/migrations/down"
+		in = api.MigrateDownRequest{Steps: req.Steps}
+	case project.JobApply:
+		data, err := yaml.Marshal(req.Manifest)
+		if err != nil {
+			return "", nil, nil, "", err
+		}
+		if req.Prune {
+			query = url.Values{"prune": {"true"}}
+		}
+		return "/apply", query, bytes.NewReader(data), "application/yaml", nil
+	default:
+		return "", nil, nil, "", fmt.Errorf("invalid job kind: %s", req.Kind)
+	}
+
+	if in != nil {
+		data, err := json.Marshal(in)
+		if err != nil {
+			return "", nil, nil, "", err
+		}
+		body, contentType = bytes.NewReader(data), "application/json"
+	}
+	return path, query, body, contentType, nil
+}
+
+// StartJob starts an operation as a job on the server and returns it without waiting
+func (c *Client) StartJob(ctx context.Context, req project.JobRequest) (*meta.Job, error) {
+	path, query, body, contentType, err := jobEndpoint(req)
+	if err != nil {
+		return nil, err
+	}
+	resp, err := c.send(ctx, http.MethodPost, path, query, nil, body, contentType)
+	if err != nil {
+		return nil, err
+	}
+	var job api.JobResponse
+	if err := decode(resp, &job); err != nil {
+		return nil, err
+	}
+	j := toJob(job)
+	return &j, nil
+}
+
+// GetJob returns a job and its log. The result of a succeeded job is the
+// response its operation returns from the API.
+func (c *Client) GetJob(ctx context.Context, id int64) (*project.JobInfo, error) {
+	var resp api.JobResponse
+	if err := c.do(ctx, http.MethodGet, "/jobs/"+strconv.FormatInt(id, 10), nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	info := &project.JobInfo{Job: toJob(resp)}
+	for _, l := range resp.Logs {
+		info.Logs = append(info.Logs, meta.JobLog{Time: parseTime(l.Time), Message: l.Message})
+	}
+	return info, nil
+}
+
+// ListJobs returns the jobs matching a filter, newest first
+func (c *Client) ListJobs(ctx context.Context, filter meta.JobFilter) ([]meta.Job, error) {
+	query := url.Values{}
+	if filter.Project != "" {
+		query.Set("project", filter.Project)
+	}
+	if filter.Status != "" {
+		query.Set("status", filter.Status)
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+	var resp []api.JobResponse
+	if err := c.do(ctx, http.MethodGet, "/jobs", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	jobs := make([]meta.Job, len(resp))
+	for i, j := range resp {
+		jobs[i] = toJob(j)
+	}
+	return jobs, nil
+}
+
+// CancelJob cancels a queued or running job
+func (c *Client) CancelJob(ctx context.Context, id int64) error {
+	return c.do(ctx, http.MethodDelete, "/jobs/"+strconv.FormatInt(id, 10), nil, nil, nil)
+}
+
+// Plan returns the changes the server would make to apply a manifest
+func (c *Client) Plan(ctx context.Context, mf *manifest.Manifest, prune bool) (*project.Plan, error) {
+	var resp api.PlanResponse
+	if err := c.sendManifest(ctx, "/plan", mf, prune, &resp); err != nil {
+		return nil, err
+	}
+	return &project.Plan{Changes: toPlanChanges(resp.Changes), Warnings: resp.Warnings}, nil
+}
+
+// Apply applies a manifest on the server. If a change fails, the result holds
+// the changes made before it along with the error.
+func (c *Client) Apply(ctx context.Context, mf *manifest.Manifest, prune bool) (*project.ApplyResult, error) {
+	info, err := c.runJob(ctx, project.JobRequest{Kind: project.JobApply, Manifest: mf, Prune: prune}, nil)
+	if err != nil {
+		return nil, err
+	}
+	if len(info.Result) == 0 {
+		return nil, jobError(&info.Job)
+	}
+	var resp api.ApplyResponse
+	if err := decodeResult(info, &resp); err != nil {
+		return nil, err
+	}
+
+	result := &project.ApplyResult{Applied: toPlanChanges(resp.Applied)}
+	for _, cred := range resp.Credentials {
+		result.Credentials = append(result.Credentials, project.Credential{
+			Database:   cred.Database,
+			User:       cred.User,
+			Password:   cred.Password,
+			ConnString: cred.ConnString,
+		})
+	}
+	return result, jobError(&info.Job)
+}
+
+// sendManifest posts a manifest as YAML and decodes the JSON response into out
+func (c *Client) sendManifest(ctx context.Context, path string, mf *manifest.Manifest, prune bool, out any) error {
+	data, err := yaml.Marshal(mf)
+	if err != nil {
+		return err
+	}
+	query := url.Values{}
+	if prune {
+		query.Set("prune", "true")
+	}
+
+	resp, err := c.send(ctx, http.MethodPost, path, query, nil, bytes.NewReader(data), "application/yaml")
+	if err != nil {
+		return err
+	}
+	defer resp.Body.Close()
+
+	if err := json.NewDecoder(resp.Body).Decode(out); err != nil {
+		return fmt.Errorf("invalid response from server: %w", err)
+	}
+	return nil
+}
+
+// CreateToken creates an API token and returns it along with its secret
+func (c *Client) CreateToken(ctx context.Context, opts project.TokenOptions) (*meta.Token, string, error) {
+	req := api.CreateTokenRequest{Name: opts.Name, Scopes: opts.Scopes, Projects: opts.Projects}
+	if opts.TTL > 0 {
+		req.ExpiresIn = durationString(opts.TTL)
+	}
+	var resp api.TokenResponse
+	if err := c.do(ctx, http.MethodPost, "/tokens", nil, req, &resp); err != nil {
+		return nil, "", err
+	}
+	token := toToken(resp)
+	return &token, resp.Secret, nil
+}
+
+// ListTokens returns all API tokens
+func (c *Client) ListTokens(ctx context.Context) ([]meta.Token, error) {
+	var resp []api.TokenResponse
+	if err := c.do(ctx, http.MethodGet, "/tokens", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	tokens := make([]meta.Token, len(resp))
+	for i, t := range resp {
+		tokens[i] = toToken(t)
+	}
+	return tokens, nil
+}
+
+// RevokeToken deletes an API token
+func (c *Client) RevokeToken(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/tokens/"+url.PathEscape(name), nil, nil, nil)
+}
+
+// GrantAccess sets the role of a subject on a project
+func (c *Client) GrantAccess(ctx context.Context, projectName, subject, role string) (*meta.AccessBinding, error) {
+	var resp api.AccessResponse
+	path := "/projects/" + url.PathEscape(projectName) + "/access/" + url.PathEscape(subject)
+	if err := c.do(ctx, http.MethodPut, path, nil, api.GrantAccessRequest{Role: role}, &resp); err != nil {
+		return nil, err
+	}
+	b := toAccessBinding(resp)
+	return &b, nil
+}
+
+// RevokeAccess removes the role of a subject on a project
+func (c *Client) RevokeAccess(ctx context.Context, projectName, subject string) error {
+	path := "/projects/" + url.PathEscape(projectName) + "/access/" + url.PathEscape(subject)
+	return c.do(ctx, http.MethodDelete, path, nil, nil, nil)
+}
+
+// ListAccess returns the access bindings of a project, or of all projects if projectName is empty
+func (c *Client) ListAccess(ctx context.Context, projectName string) ([]meta.AccessBinding, error) {
+	path := "/access"
+	if projectName != "" {
+		path = "/projects/" + url.PathEscape(projectName) + "/access"
+	}
+	var resp []api.AccessResponse
+	if err := c.do(ctx, http.MethodGet, path, nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	bindings := make([]meta.AccessBinding, len(resp))
+	for i, b := range resp {
+		bindings[i] = toAccessBinding(b)
+	}
+	return bindings, nil
+}
+
+// ListAudit returns the audit events matching a filter, newest first
+func (c *Client) ListAudit(ctx context.Context, filter meta.AuditFilter) ([]meta.AuditEvent, error) {
+	query := url.Values{}
+	if filter.Project != "" {
+		query.Set("project", filter.Project)
+	}
+	if filter.Actor != "" {
+		query.Set("actor", filter.Actor)
+	}
+	if filter.Action != "" {
+		query.Set("action", filter.Action)
+	}
+	if !filter.Since.IsZero() {
+		query.Set("since", filter.Since.Format(time.RFC3339))
+	}
+	if !filter.Until.IsZero() {
+		query.Set("until", filter.Until.Format(time.RFC3339))
+	}
+	if filter.BeforeID > 0 {
+		query.Set("before", strconv.FormatInt(filter.BeforeID, 10))
+	}
+	if filter.Limit > 0 {
+		query.Set("limit", strconv.Itoa(filter.Limit))
+	}
+
+	var resp []api.AuditEventResponse
+	if err := c.do(ctx, http.MethodGet, "/audit", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	events := make([]meta.AuditEvent, len(resp))
+	for i, e := range resp {
+		events[i] = meta.AuditEvent{
+			ID:        e.ID,
+			CreatedAt: parseTime(e.Time),
+			Actor:     e.Actor,
+			Source:    e.Source,
+			RequestID: e.RequestID,
+			Action:    e.Action,
+			Project:   e.Project,
+			Target:    e.Target,
+			Outcome:   e.Outcome,
+			Error:     e.Error,
+		}
+	}
+	return events, nil
+}
+
+// CreateWebhook subscribes a URL to lifecycle events
+func (c *Client) CreateWebhook(ctx context.Context, opts project.WebhookOptions) (*meta.Webhook, error) {
+	req := api.CreateWebhookRequest{Name: opts.Name, URL: opts.URL, Secret: opts.Secret, Events: opts.Events, Projects: opts.Projects}
+	var resp api.WebhookResponse
+	if err := c.do(ctx, http.MethodPost, "/webhooks", nil, req, &resp); err != nil {
+		return nil, err
+	}
+	w := toWebhook(resp)
+	return &w, nil
+}
+
+// ListWebhooks returns all webhooks
+func (c *Client) ListWebhooks(ctx context.Context) ([]meta.Webhook, error) {
+	var resp []api.WebhookResponse
+	if err := c.do(ctx, http.MethodGet, "/webhooks", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	webhooks := make([]meta.Webhook, len(resp))
+	for i, w := range resp {
+		webhooks[i] = toWebhook(w)
+	}
+	return webhooks, nil
+}
+
+// DeleteWebhook removes a webhook
+func (c *Client) DeleteWebhook(ctx context.Context, name string) error {
+	return c.do(ctx, http.MethodDelete, "/webhooks/"+url.PathEscape(name), nil, nil, nil)
+}
+
+// TestWebhook has the server send a ping to a webhook
+func (c *Client) TestWebhook(ctx context.Context, name string) (*meta.WebhookDelivery, error) {
+	var resp api.WebhookDeliveryResponse
+	if err := c.do(ctx, http.MethodPost, "/webhooks/"+url.PathEscape(name)+"/test", nil, nil, &resp); err != nil {
+		return nil, err
+	}
+	d := toWebhookDelivery(resp)
+	return &d, nil
+}
+
+// ListWebhookDeliveries returns the deliveries of a webhook, newest first
+func (c *Client) ListWebhookDeliveries(ctx context.Context, name string, limit int) ([]meta.WebhookDelivery, error) {
+	query := url.Values{}
+	if limit > 0 {
+		query.Set("limit", strconv.Itoa(limit))
+	}
+	var resp []api.WebhookDeliveryResponse
+	if err := c.do(ctx, http.MethodGet, "/webhooks/"+url.PathEscape(name)+"/deliveries", query, nil, &resp); err != nil {
+		return nil, err
+	}
+	deliveries := make([]meta.WebhookDelivery, len(resp))
+	for i, d := range resp {
+		deliveries[i] = toWebhookDelivery(d)
+	}
+	return deliveries, nil
+}
+
+// envName returns the API form of an environment (pr_42 for PR databases)
+func envName(env string, prNumber *int) string {
+	if prNumber != nil {
+		return fmt.Sprintf("%s_%d", env, *prNumber)
+	}
+	return env
+}
+
+// durationString formats a duration in the units the API accepts
+func durationString(d time.Duration) string {
+	switch {
+	case d%(24*time.Hour) == 0:
+		return fmt.Sprintf("%dd", d/(24*time.Hour))
+	case d%time.Hour == 0:
+		return fmt.Sprintf("%dh", d/time.Hour)
+	default:
+		return fmt.Sprintf("%ds", d/time.Second)
+	}
+}
+
+func parseTime(s string) time.Time {
+	t, _ := time.Parse(time.RFC3339, s)
+	return t
+}
+
+func parseOptionalTime(s *string) *time.Time {
+	if s == nil {
+		return nil
+	}
+	t := parseTime(*s)
+	return &t
+}
+
+func toJob(j api.JobResponse) meta.Job {
+	return meta.Job{
+		ID:         j.ID,
+		Kind:       j.Kind,
+		Project:    j.Project,
+		Target:     j.Target,
+		Status:     j.Status,
+		Done:       j.Done,
+		Total:      j.Total,
+		Error:      j.Error,
+		Result:     j.Result,
+		Actor:      j.Actor,
+		CreatedAt:  parseTime(j.CreatedAt),
+		StartedAt:  parseOptionalTime(j.StartedAt),
+		FinishedAt: parseOptionalTime(j.FinishedAt),
+	}
+}
+
+func toProject(p api.ProjectResponse) meta.Project {
+	return meta.Project{Name: p.Name, CreatedAt: parseTime(p.CreatedAt)}
+}
+
+func toDatabaseInfo(d api.DatabaseInfoResponse) project.DatabaseInfo {
+	return project.DatabaseInfo{
+		Project:      d.Project,
+		Env:          d.Env,
+		PRNumber:     d.PRNumber,
+		DatabaseName: d.DatabaseName,
+		UserName:     d.UserName,
+		Server:       d.Server,
+		Host:         d.Host,
+		Port:         d.Port,
+		CreatedAt:    parseTime(d.CreatedAt),
+		ExpiresAt:    parseOptionalTime(d.ExpiresAt),
+		LastActivity: parseOptionalTime(d.LastActivity),
+		Protected:    d.Protected,
+	}
+}
+
+func toPlanChanges(resp []api.PlanChangeResponse) []project.PlanChange {
+	changes := make([]project.PlanChange, len(resp))
+	for i, c := range resp {
+		changes[i] = project.PlanChange{Action: c.Action, Kind: c.Kind, Name: c.Name, Detail: c.Detail}
+	}
+	return changes
+}
+
+func toMigrations(resp []api.MigrationResponse) []migrate.Migration {
+	migrations := make([]migrate.Migration, len(resp))
+	for i, m := range resp {
+		migrations[i] = migrate.Migration{Version: m.Version, Name: m.Name}
+	}
+	return migrations
+}
+
+func toRestoreResult(r api.RestoreResponse) *project.RestoreResult {
+	return &project.RestoreResult{
+		DatabaseName: r.DatabaseName,
+		Source:       r.Source,
+		Created:      r.Created,
+		Tables:       r.Tables,
+		Rows:         r.Rows,
+	}
+}
+
+func toBackup(b api.BackupResponse) meta.Backup {
+	return meta.Backup{
+		ID:           b.ID,
+		DatabaseName: b.DatabaseName,
+		Env:          b.Env,
+		Target:       b.Target,
+		Key:          b.Key,
+		Size:         b.Size,
+		Tables:       b.Tables,
+		Rows:         b.Rows,
+		CreatedAt:    parseTime(b.CreatedAt),
+	}
+}
+
+func toBackups(resp []api.BackupResponse) []meta.Backup {
+	backups := make([]meta.Backup, len(resp))
+	for i, b := range resp {
+		backups[i] = toBackup(b)
+	}
+	return backups
+}
+
+func toToken(t api.TokenResponse) meta.Token {
+	return meta.Token{
+		Name:       t.Name,
+		Scopes:     t.Scopes,
+		Projects:   t.Projects,
+		CreatedAt:  parseTime(t.CreatedAt),
+		ExpiresAt:  parseOptionalTime(t.ExpiresAt),
+		LastUsedAt: parseOptionalTime(t.LastUsedAt),
+	}
+}
+
+func toAccessBinding(b api.AccessResponse) meta.AccessBinding {
+	return meta.AccessBinding{
+		ProjectName: b.Project,
+		Subject:     b.Subject,
+		Role:        b.Role,
+		CreatedAt:   parseTime(b.CreatedAt),
+	}
+}
+
+func toWebhook(w api.WebhookResponse) meta.Webhook {
+	return meta.Webhook{
+		Name:      w.Name,
+		URL:       w.URL,
+		Secret:    w.Secret,
+		Events:    w.Events,
+		Projects:  w.Projects,
+		CreatedAt: parseTime(w.CreatedAt),
+	}
+}
+
+func toWebhookDelivery(d api.WebhookDeliveryResponse) meta.WebhookDelivery {
+	delivery := meta.WebhookDelivery{
+		ID:           d.ID,
+		Event:        d.Event,
+		Payload:      d.Payload,
+		Status:       d.Status,
+		Attempts:     d.Attempts,
+		ResponseCode: d.ResponseCode,
+		Error:        d.Error,
+		CreatedAt:    parseTime(d.CreatedAt),
+		UpdatedAt:    parseTime(d.UpdatedAt),
+	}
+	if t := parseOptionalTime(d.NextAttemptAt); t != nil {
+		delivery.NextAttemptAt = *t
+	}
+	return delivery
+}
@@ -0,0 +1,177 @@
+package client
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+
+	"pgmanager/internal/api"
+	"pgmanager/internal/config"
+	"pgmanager/internal/manifest"
+	"pgmanager/internal/meta"
+	"pgmanager/internal/project"
+)
+
+// setupTestClient starts an API server backed by the mock store
+func setupTestClient(t *testing.T, token string) *Client {
+	t.Helper()
+
+	cfg := &config.Config{API: config.APIConfig{Port: 8080, Token: "secret-token"}}
+	mgr := project.NewManager(cfg, meta.NewMockStore())
+	ctx, stop := context.WithCancel(context.Background())
+	t.Cleanup(stop)
+	if err := mgr.StartJobs(ctx, 1); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(api.NewServer(cfg, mgr, cfg.API.Port).Router())
+	t.Cleanup(ts.Close)
+
+	c := New(ts.URL+"/", token)
+	t.Cleanup(func() { c.Close() })
+	return c
+}
+
+func TestClientProjects(t *testing.T) {
+	c := setupTestClient(t, "secret-token")
+	ctx := context.Background()
+
+	p, err := c.CreateProject(ctx, "myapp")
+	if err != nil {
+		t.Fatalf("CreateProject() error = %v", err)
+	}
+	if p.Name != "myapp" || p.CreatedAt.IsZero() {
+		t.Errorf("CreateProject() = %+v", p)
+	}
+
+	projects, err := c.ListProjects(ctx)
+	if err != nil {
+		t.Fatalf("ListProjects() error = %v", err)
+	}
+	if len(projects) != 1 || projects[0].Name != "myapp" {
+		t.Errorf("ListProjects() = %+v", projects)
+	}
+
+	if _, err := c.CreateProject(ctx, "myapp"); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("CreateProject() of an existing project error = %v", err)
+	}
+
+	if err := c.DeleteProject(ctx, "myapp"); err != nil {
+		t.Fatalf("DeleteProject() error = %v", err)
+	}
+}
+
+func TestClientErrors(t *testing.T) {
+	ctx := context.Background()
+
+	_, err := setupTestClient(t, "wrong-token").ListProjects(ctx)
+	var apiErr *Error
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusUnauthorized {
+		t.Errorf("ListProjects() with a wrong token error = %v, want 401", err)
+	}
+
+	c := setupTestClient(t, "secret-token")
+	prNumber := 42
+	_, err = c.GetDatabase(ctx, "nope", "pr", &prNumber)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("GetDatabase() of an unknown database error = %v, want 404", err)
+	}
+
+	if _, err := c.Migrate(ctx, "myapp", "dev", nil, "./migrations"); err != errMigrationsDir {
+		t.Errorf("Migrate() with a directory error = %v", err)
+	}
+}
+
+func TestClientPlan(t *testing.T) {
+	c := setupTestClient(t, "secret-token")
+
+	mf, err := manifest.Parse([]byte("projects:\n  myapp:\n    environments:\n      dev:\n        ttl: 72h\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan, err := c.Plan(context.Background(), mf, false)
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	if len(plan.Changes) != 3 || plan.Changes[2].Detail != "unprotected, ttl 72h0m0s" {
+		t.Errorf("Plan() = %+v", plan.Changes)
+	}
+}
+
+func TestDurationString(t *testing.T) {
+	tests := []struct {
+		d    time.Duration
+		want string
+	}{
+		{7 * 24 * time.Hour, "7d"},
+		{36 * time.Hour, "36h"},
+		{90 * time.Minute, "5400s"},
+	}
+
+	for _, tt := range tests {
+		if got := durationString(tt.d); got != tt.want {
+			t.Errorf("durationString(%v) = %q, want %q", tt.d, got, tt.want)
+		}
+	}
+}
+
+func TestClientJobs(t *testing.T) {
+	ctx := context.Background()
+	cfg := &config.Config{API: config.APIConfig{Port: 8080, Token: "secret-token"}}
+	mgr := project.NewManager(cfg, meta.NewMockStore())
+	jobsCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	if err := mgr.StartJobs(jobsCtx, 1); err != nil {
+		t.Fatal(err)
+	}
+	ts := httptest.NewServer(api.NewServer(cfg, mgr, cfg.API.Port).Router())
+	defer ts.Close()
+	c := New(ts.URL, "secret-token")
+	defer c.Close()
+
+	// Long operations run as jobs and return their result once done
+	result, err := c.Cleanup(ctx, time.Hour)
+	if err != nil || len(result.Deleted) != 0 {
+		t.Fatalf("Cleanup() = %+v, %v", result, err)
+	}
+	jobs, err := c.ListJobs(ctx, meta.JobFilter{})
+	if err != nil || len(jobs) != 1 || jobs[0].Kind != project.JobCleanup || jobs[0].Status != project.JobSucceeded {
+		t.Fatalf("ListJobs() = %+v, %v", jobs, err)
+	}
+
+	if _, err := c.RunBackups(ctx, true); err == nil || !strings.Contains(err.Error(), "no backup schedules") {
+		t.Errorf("RunBackups() error = %v, want no backup schedules", err)
+	}
+
+	mf, err := manifest.Parse([]byte("projects:\n  myapp: {}\n"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	applied, err := c.Apply(ctx, mf, false)
+	if err != nil || len(applied.Applied) != 1 || applied.Applied[0].Name != "myapp" {
+		t.Fatalf("Apply() = %+v, %v", applied, err)
+	}
+
+	// Errors known before a job runs are returned at once
+	var apiErr *Error
+	err = c.MoveDatabase(ctx, "myapp", "dev", nil, "replica", false, nil)
+	if !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusNotFound {
+		t.Errorf("MoveDatabase() of a missing database error = %v, want 404", err)
+	}
+
+	job, err := c.StartJob(ctx, project.JobRequest{Kind: project.JobCleanup, OlderThan: time.Hour})
+	if err != nil || job.ID == 0 || job.Kind != project.JobCleanup {
+		t.Fatalf("StartJob() = %+v, %v", job, err)
+	}
+	info, err := project.WaitJob(ctx, c, job.ID, 10*time.Millisecond, nil)
+	if err != nil || info.Status != project.JobSucceeded || len(info.Result) == 0 {
+		t.Fatalf("WaitJob() = %+v, %v", info, err)
+	}
+
+	if err := c.CancelJob(ctx, job.ID); !errors.As(err, &apiErr) || apiErr.StatusCode != http.StatusConflict {
+		t.Errorf("CancelJob() of a finished job error = %v, want 409", err)
+	}
+}
@@ -4,6 +4,8 @@ import (
 	"fmt"
 	"os"
 	"path/filepath"
+	"slices"
+	"sort"
 	"strconv"
 	"strings"
 	"time"
@@ -11,6 +13,14 @@ import (
 	"gopkg.in/yaml.v3"
 )
 
+// Envs are the environments a project can have databases in
+var Envs = []string{"prod", "dev", "staging", "pr"}
+
+// ValidEnv reports whether env is one of Envs
+func ValidEnv(env string) bool {
+	return slices.Contains(Envs, env)
+}
+
 // ConfigFileNames are the names to search for when auto-discovering config
 var ConfigFileNames = []string{
 	"pgmanager.yaml",
@@ -19,10 +29,50 @@ var ConfigFileNames = []string{
 	".pgmanager.yml",
 }
 
+// DefaultServer is the name of the server defined by the postgres block,
+// which also holds the metadata store
+const DefaultServer = "default"
+
 type Config struct {
-	Postgres PostgresConfig `yaml:"postgres"`
-	API      APIConfig      `yaml:"api"`
-	Cleanup  CleanupConfig  `yaml:"cleanup"`
+	Postgres     PostgresConfig            `yaml:"postgres"`
+	Servers      map[string]PostgresConfig `yaml:"servers"`   // Additional named servers for managed databases
+	Placement    []PlacementRule           `yaml:"placement"` // First matching rule picks the server for new databases
+	API          APIConfig                 `yaml:"api"`
+	Cleanup      CleanupConfig             `yaml:"cleanup"`
+	Backups      BackupConfig              `yaml:"backups"`
+	Webhooks     WebhookConfig             `yaml:"webhooks"`
+	Jobs         JobsConfig                `yaml:"jobs"`
+	Integrations IntegrationsConfig        `yaml:"integrations"`
+	Projects     map[string]ProjectConfig  `yaml:"projects"` // Per-project settings, keyed by project name
+	Client       ClientConfig              `yaml:"client"`
+	Remote       RemoteConfig              `yaml:"remote"`
+}
+
+// RemoteConfig points the CLI at a pgmanager server. When Server is set, commands
+// go through its REST API and no PostgreSQL credentials are needed locally.
+type RemoteConfig struct {
+	Server string `yaml:"server"` // Base URL, e.g. https://pgm.internal
+	Token  string `yaml:"token"`  // API token sent as a Bearer token
+}
+
+// ClientConfig selects the interactive client started by "db connect"
+type ClientConfig struct {
+	Command string `yaml:"command"` // Client and its arguments, e.g. "pgcli --less-chatty"; defaults to psql
+}
+
+// ProjectConfig holds settings applied to every database of a project
+type ProjectConfig struct {
+	Init        []string `yaml:"init"`         // SQL files run as the admin user when a database is created or reset
+	Seeds       []string `yaml:"seeds"`        // SQL files run as the database owner after Init and migrations
+	Migrations  string   `yaml:"migrations"`   // Directory of migration files
+	AutoMigrate []string `yaml:"auto_migrate"` // Environments migrated when a database is created or reset
+}
+
+// PlacementRule routes new databases to a named server. Empty fields match anything.
+type PlacementRule struct {
+	Project string `yaml:"project"`
+	Env     string `yaml:"env"`
+	Server  string `yaml:"server"`
 }
 
 type PostgresConfig struct {
@@ -35,24 +85,229 @@ type PostgresConfig struct {
 }
 
 type APIConfig struct {
-	Port           int      `yaml:"port"`
-	Token          string   `yaml:"token"`
-	RequireToken   bool     `yaml:"require_token"`   // If true, API requires authentication even if token is empty
-	AllowedOrigins []string `yaml:"allowed_origins"` // CORS allowed origins
+	Port           int        `yaml:"port"`
+	Token          string     `yaml:"token"`
+	RequireToken   bool       `yaml:"require_token"`   // If true, API requires authentication even if token is empty
+	AllowedOrigins []string   `yaml:"allowed_origins"` // CORS allowed origins
+	OIDC           OIDCConfig `yaml:"oidc"`
+}
+
+// OIDCConfig lets users sign in with an OpenID Connect identity provider. The API
+// accepts its ID tokens as Bearer tokens, and the web UI signs in with the
+// authorization code flow.
+type OIDCConfig struct {
+	Issuer        string      `yaml:"issuer"` // Enables OIDC when set
+	ClientID      string      `yaml:"client_id"`
+	ClientSecret  string      `yaml:"client_secret"`
+	RedirectURL   string      `yaml:"redirect_url"`   // Callback of the web UI login, e.g. https://pgm.internal/auth/callback
+	JWKS          string      `yaml:"jwks"`           // URL or file of the signing keys; discovered from the issuer by default
+	AuthURL       string      `yaml:"auth_url"`       // Authorization endpoint; discovered by default
+	TokenURL      string      `yaml:"token_url"`      // Token endpoint; discovered by default
+	Audience      string      `yaml:"audience"`       // Expected aud claim; defaults to client_id
+	Scopes        []string    `yaml:"scopes"`         // Requested at login; defaults to openid, email and profile
+	UsernameClaim string      `yaml:"username_claim"` // Claim naming the user; defaults to email if verified, else sub
+	GroupsClaim   string      `yaml:"groups_claim"`   // Claim listing the user's groups; defaults to groups
+	DefaultRole   string      `yaml:"default_role"`   // Role of every signed-in user on every project; none by default
+	GroupRoles    []GroupRole `yaml:"group_roles"`
+}
+
+// GroupRole grants the members of an identity provider group a role on a
+// project, or on every project when Project is empty
+type GroupRole struct {
+	Group   string `yaml:"group"`
+	Project string `yaml:"project"`
+	Role    string `yaml:"role"`
 }
 
+// Enabled reports whether OIDC sign-in is configured
+func (c *OIDCConfig) Enabled() bool {
+	return c.Issuer != ""
+}
+
+// Validate checks that an OIDC configuration is complete
+func (c *OIDCConfig) Validate() error {
+	if c.ClientID == "" {
+		return fmt.Errorf("api.oidc: client_id is required")
+	}
+	if c.DefaultRole != "" && !validRoles[c.DefaultRole] {
+		return fmt.Errorf("api.oidc: invalid default_role '%s'", c.DefaultRole)
+	}
+	for _, gr := range c.GroupRoles {
+		if gr.Group == "" {
+			return fmt.Errorf("api.oidc: group_roles entries need a group")
+		}
+		if !validRoles[gr.Role] {
+			return fmt.Errorf("api.oidc: invalid role '%s' for group '%s'", gr.Role, gr.Group)
+		}
+	}
+	return nil
+}
+
+// validRoles are the project roles, as defined by the auth package
+var validRoles = map[string]bool{"viewer": true, "developer": true, "maintainer": true, "admin": true}
+
 type CleanupConfig struct {
-	DefaultTTL time.Duration `yaml:"default_ttl"`
+	DefaultTTL     time.Duration `yaml:"default_ttl"`
+	ActivitySample time.Duration `yaml:"activity_sample"` // How often 'serve' samples database activity, 0 disables
+	Rules          []CleanupRule `yaml:"rules"`
+}
+
+// CleanupRule applies an action to databases of an environment that have been idle for a duration
+type CleanupRule struct {
+	Env     string        `yaml:"env"`
+	IdleFor time.Duration `yaml:"idle_for"`
+	Action  string        `yaml:"action"` // drop, warn
+}
+
+// Validate checks that a cleanup rule is complete
+func (r CleanupRule) Validate() error {
+	if r.Env == "" {
+		return fmt.Errorf("cleanup rule: env is required")
+	}
+	if !ValidEnv(r.Env) {
+		return fmt.Errorf("cleanup rule: env must be one of %s, got '%s'", strings.Join(Envs, ", "), r.Env)
+	}
+	if r.IdleFor <= 0 {
+		return fmt.Errorf("cleanup rule for %s: idle_for must be positive", r.Env)
+	}
+	if r.Action != "drop" && r.Action != "warn" {
+		return fmt.Errorf("cleanup rule for %s: action must be drop or warn, got '%s'", r.Env, r.Action)
+	}
+	return nil
+}
+
+// BackupConfig configures where backups are stored and when they are taken
+type BackupConfig struct {
+	Dir       string           `yaml:"dir"` // Local directory backups are written to
+	Schedules []BackupSchedule `yaml:"schedules"`
+}
+
+// BackupSchedule backs up every database of an environment once a day and prunes
+// backups outside the retention policy
+type BackupSchedule struct {
+	Env        string `yaml:"env"`
+	At         string `yaml:"at"`          // Time of day in UTC, HH:MM
+	KeepDaily  int    `yaml:"keep_daily"`  // Keep the newest backup of each of this many most recent days
+	KeepWeekly int    `yaml:"keep_weekly"` // Keep the newest backup of each of this many most recent weeks
+}
+
+// Validate checks that a backup schedule is complete
+func (s BackupSchedule) Validate() error {
+	if s.Env == "" {
+		return fmt.Errorf("backup schedule: env is required")
+	}
+	if !ValidEnv(s.Env) {
+		return fmt.Errorf("backup schedule: env must be one of %s, got '%s'", strings.Join(Envs, ", "), s.Env)
+	}
+	if _, err := time.Parse("15:04", s.At); err != nil {
+		return fmt.Errorf("backup schedule for %s: at must be a time of day as HH:MM, got '%s'", s.Env, s.At)
+	}
+	if s.KeepDaily < 0 || s.KeepWeekly < 0 || s.KeepDaily+s.KeepWeekly == 0 {
+		return fmt.Errorf("backup schedule for %s: keep_daily or keep_weekly must be positive", s.Env)
+	}
+	return nil
+}
+
+// LastRun returns the most recent scheduled time at or before now
+func (s BackupSchedule) LastRun(now time.Time) time.Time {
+	at, _ := time.Parse("15:04", s.At)
+	now = now.UTC()
+	run := time.Date(now.Year(), now.Month(), now.Day(), at.Hour(), at.Minute(), 0, 0, time.UTC)
+	if run.After(now) {
+		run = run.AddDate(0, 0, -1)
+	}
+	return run
+}
+
+// Schedule returns the backup schedule for an environment, or nil if it has none
+func (c *BackupConfig) Schedule(env string) *BackupSchedule {
+	for i := range c.Schedules {
+		if c.Schedules[i].Env == env {
+			return &c.Schedules[i]
+		}
+	}
+	return nil
+}
+
+// WebhookConfig tunes the delivery of lifecycle events to webhooks by 'serve'
+type WebhookConfig struct {
+	MaxAttempts  int           `yaml:"max_attempts"`  // Attempts before a delivery is given up
+	ExpiryNotice time.Duration `yaml:"expiry_notice"` // How long before a database expires database.expiring is sent; 0 disables it
+}
+
+// JobsConfig sizes the worker pool that runs long operations in the background for 'serve'
+type JobsConfig struct {
+	Workers int `yaml:"workers"` // Jobs run at once; others wait in the queue
+}
+
+// IntegrationsConfig lets source code hosts drive PR databases through webhooks
+type IntegrationsConfig struct {
+	GitHub GitHubConfig `yaml:"github"`
+	GitLab GitLabConfig `yaml:"gitlab"`
+}
+
+// GitHubConfig receives GitHub pull request events at /api/integrations/github
+type GitHubConfig struct {
+	Secret       string            `yaml:"secret"`       // Webhook secret; enables the receiver when set
+	Repositories map[string]string `yaml:"repositories"` // Maps repositories, e.g. acme/api, to projects
+}
+
+// Enabled reports whether the GitHub receiver is configured
+func (c *GitHubConfig) Enabled() bool {
+	return c.Secret != ""
+}
+
+// Project returns the project of a repository, or "" if it is not mapped.
+// Repository names are not case-sensitive.
+func (c *GitHubConfig) Project(repository string) string {
+	return lookupProject(c.Repositories, repository)
+}
+
+// GitLabConfig receives GitLab merge request events at /api/integrations/gitlab
+type GitLabConfig struct {
+	Token    string            `yaml:"token"`    // Secret token of the webhook; enables the receiver when set
+	Projects map[string]string `yaml:"projects"` // Maps project paths, e.g. acme/backend/api, to projects
+}
+
+// Enabled reports whether the GitLab receiver is configured
+func (c *GitLabConfig) Enabled() bool {
+	return c.Token != ""
+}
+
+// Project returns the pgmanager project of a GitLab project path, or "" if it
+// is not mapped. Paths are not case-sensitive.
+func (c *GitLabConfig) Project(path string) string {
+	return lookupProject(c.Projects, path)
+}
+
+// lookupProject finds the project mapped to name, ignoring case
+func lookupProject(mapping map[string]string, name string) string {
+	for key, project := range mapping {
+		if strings.EqualFold(key, name) {
+			return project
+		}
+	}
+	return ""
 }
 
 // Discover searches for a config file in standard locations
-// Search order: current directory, then home directory
+// Search order: current directory, the current context's config file, then home directory
 func Discover() (string, error) {
 	// Get current working directory
 	cwd, err := os.Getwd()
 	if err != nil {
 		return "", fmt.Errorf("failed to get working directory: %w", err)
 	}
+	if path := findConfig(cwd); path != "" {
+		return path, nil
+	}
+
+	// A direct current context names its config file
+	if contexts, err := LoadContexts(); err == nil {
+		if ctx := contexts.Get(contexts.Current); ctx != nil && !ctx.Remote() {
+			return ctx.Config, nil
+		}
+	}
 
 	// Get home directory
 	home, err := os.UserHomeDir()
@@ -61,27 +316,35 @@ func Discover() (string, error) {
 	}
 
 	// Search paths in order
-	searchDirs := []string{cwd}
+	var searchDirs []string
 	if home != "" {
 		searchDirs = append(searchDirs, home, filepath.Join(home, ".config", "pgmanager"))
 	}
 	searchDirs = append(searchDirs, "/etc/pgmanager")
 
 	for _, dir := range searchDirs {
-		for _, name := range ConfigFileNames {
-			path := filepath.Join(dir, name)
-			if _, err := os.Stat(path); err == nil {
-				return path, nil
-			}
-		}
-		// Also check for config.yaml in each directory
-		path := filepath.Join(dir, "config.yaml")
-		if _, err := os.Stat(path); err == nil {
+		if path := findConfig(dir); path != "" {
 			return path, nil
 		}
 	}
 
-	return "", fmt.Errorf("no config file found; create pgmanager.yaml in current directory or specify with --config")
+	return "", fmt.Errorf("no config file found; create pgmanager.yaml in current directory, specify with --config, or add a context")
+}
+
+// findConfig returns the config file in dir, or "" if there is none
+func findConfig(dir string) string {
+	for _, name := range ConfigFileNames {
+		path := filepath.Join(dir, name)
+		if _, err := os.Stat(path); err == nil {
+			return path
+		}
+	}
+	// Also check for config.yaml in each directory
+	path := filepath.Join(dir, "config.yaml")
+	if _, err := os.Stat(path); err == nil {
+		return path
+	}
+	return ""
 }
 
 func Load(path string) (*Config, error) {
@@ -103,7 +366,15 @@ func Load(path string) (*Config, error) {
 			RequireToken: true,
 		},
 		Cleanup: CleanupConfig{
-			DefaultTTL: 7 * 24 * time.Hour,
+			DefaultTTL:     7 * 24 * time.Hour,
+			ActivitySample: 5 * time.Minute,
+		},
+		Webhooks: WebhookConfig{
+			MaxAttempts:  8,
+			ExpiryNotice: 24 * time.Hour,
+		},
+		Jobs: JobsConfig{
+			Workers: 4,
 		},
 	}
 
@@ -146,10 +417,118 @@ func Load(path string) (*Config, error) {
 	if origins := os.Getenv("PGMANAGER_ALLOWED_ORIGINS"); origins != "" {
 		cfg.API.AllowedOrigins = splitAndTrim(origins, ",")
 	}
+	if secret := os.Getenv("PGMANAGER_OIDC_CLIENT_SECRET"); secret != "" {
+		cfg.API.OIDC.ClientSecret = secret
+	}
+	if secret := os.Getenv("PGMANAGER_GITHUB_WEBHOOK_SECRET"); secret != "" {
+		cfg.Integrations.GitHub.Secret = secret
+	}
+	if token := os.Getenv("PGMANAGER_GITLAB_WEBHOOK_TOKEN"); token != "" {
+		cfg.Integrations.GitLab.Token = token
+	}
+	cfg.Remote.FromEnv()
+
+	for name, server := range cfg.Servers {
+		if name == DefaultServer {
+			return nil, fmt.Errorf("server name '%s' is reserved for the postgres block", DefaultServer)
+		}
+		if server.Port == 0 {
+			server.Port = 5432
+		}
+		if server.User == "" {
+			server.User = "postgres"
+		}
+		if server.Database == "" {
+			server.Database = "postgres"
+		}
+		cfg.Servers[name] = server
+	}
+	for _, rule := range cfg.Placement {
+		if _, err := cfg.Server(rule.Server); err != nil {
+			return nil, fmt.Errorf("placement rule: %w", err)
+		}
+	}
+	if cfg.API.OIDC.Enabled() {
+		if err := cfg.API.OIDC.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	if cfg.Integrations.GitHub.Enabled() && len(cfg.Integrations.GitHub.Repositories) == 0 {
+		return nil, fmt.Errorf("integrations.github: repositories are required")
+	}
+	if cfg.Integrations.GitLab.Enabled() && len(cfg.Integrations.GitLab.Projects) == 0 {
+		return nil, fmt.Errorf("integrations.gitlab: projects are required")
+	}
+	if cfg.Webhooks.MaxAttempts < 1 {
+		return nil, fmt.Errorf("webhooks: max_attempts must be at least 1")
+	}
+	if cfg.Webhooks.ExpiryNotice < 0 {
+		return nil, fmt.Errorf("webhooks: expiry_notice must not be negative")
+	}
+	if cfg.Jobs.Workers < 1 {
+		return nil, fmt.Errorf("jobs: workers must be at least 1")
+	}
+	for _, rule := range cfg.Cleanup.Rules {
+		if err := rule.Validate(); err != nil {
+			return nil, err
+		}
+	}
+	// An environment has one schedule, or its databases would be backed up once
+	// per schedule and pruned by whichever retention policy ran last
+	scheduled := make(map[string]bool)
+	for _, schedule := range cfg.Backups.Schedules {
+		if err := schedule.Validate(); err != nil {
+			return nil, err
+		}
+		if scheduled[schedule.Env] {
+			return nil, fmt.Errorf("backup schedule for %s: only one schedule per env is allowed", schedule.Env)
+		}
+		scheduled[schedule.Env] = true
+		if cfg.Backups.Dir == "" {
+			return nil, fmt.Errorf("backup schedules require backups.dir")
+		}
+	}
 
 	return cfg, nil
 }
 
+// Server returns the connection settings of a named server. An empty name is the default server.
+func (c *Config) Server(name string) (*PostgresConfig, error) {
+	if name == "" || name == DefaultServer {
+		return &c.Postgres, nil
+	}
+	server, ok := c.Servers[name]
+	if !ok {
+		return nil, fmt.Errorf("unknown server '%s'", name)
+	}
+	return &server, nil
+}
+
+// ServerNames returns the default server followed by the named servers in sorted order
+func (c *Config) ServerNames() []string {
+	names := make([]string, 0, len(c.Servers)+1)
+	for name := range c.Servers {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return append([]string{DefaultServer}, names...)
+}
+
+// Project returns the settings of a project; projects without settings get the zero value
+func (c *Config) Project(name string) ProjectConfig {
+	return c.Projects[name]
+}
+
+// PlaceDatabase returns the server a new database for project/env should be created on
+func (c *Config) PlaceDatabase(project, env string) string {
+	for _, rule := range c.Placement {
+		if (rule.Project == "" || rule.Project == project) && (rule.Env == "" || rule.Env == env) {
+			return rule.Server
+		}
+	}
+	return DefaultServer
+}
+
 // splitAndTrim splits a string by separator and trims whitespace from each part
 func splitAndTrim(s, sep string) []string {
 	parts := strings.Split(s, sep)
@@ -162,6 +541,16 @@ func splitAndTrim(s, sep string) []string {
 	return result
 }
 
+// FromEnv overrides the remote settings with PGMANAGER_SERVER and PGMANAGER_TOKEN
+func (r *RemoteConfig) FromEnv() {
+	if server := os.Getenv("PGMANAGER_SERVER"); server != "" {
+		r.Server = server
+	}
+	if token := os.Getenv("PGMANAGER_TOKEN"); token != "" {
+		r.Token = token
+	}
+}
+
 // Default returns a default configuration without loading from file
 func Default() *Config {
 	return &Config{
@@ -177,7 +566,15 @@ func Default() *Config {
 			RequireToken: true,
 		},
 		Cleanup: CleanupConfig{
-			DefaultTTL: 7 * 24 * time.Hour,
+			DefaultTTL:     7 * 24 * time.Hour,
+			ActivitySample: 5 * time.Minute,
+		},
+		Webhooks: WebhookConfig{
+			MaxAttempts:  8,
+			ExpiryNotice: 24 * time.Hour,
+		},
+		Jobs: JobsConfig{
+			Workers: 4,
 		},
 	}
 }
@@ -0,0 +1,242 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeConfig(t *testing.T, content string) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "pgmanager.yaml")
+	if err := os.WriteFile(path, []byte(content), 0600); err != nil {
+		t.Fatalf("failed to write config: %v", err)
+	}
+	return path
+}
+
+func TestLoadServers(t *testing.T) {
+	path := writeConfig(t, `
+postgres:
+  host: pg-main
+servers:
+  ephemeral:
+    host: pg-ephemeral
+    password: secret
+placement:
+  - env: pr
+    server: ephemeral
+`)
+
+	cfg, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	server, err := cfg.Server("ephemeral")
+	if err != nil {
+		t.Fatalf("Server(ephemeral) error = %v", err)
+	}
+	if server.Host != "pg-ephemeral" || server.Port != 5432 || server.User != "postgres" {
+		t.Errorf("ephemeral server = %+v, want defaults applied", server)
+	}
+
+	names := cfg.ServerNames()
+	if len(names) != 2 || names[0] != DefaultServer || names[1] != "ephemeral" {
+		t.Errorf("ServerNames() = %v", names)
+	}
+
+	if _, err := cfg.Server("missing"); err == nil {
+		t.Error("Server(missing) should fail")
+	}
+}
+
+func TestLoadRejectsInvalidServers(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"reserved server name", "servers:\n  default:\n    host: pg\n"},
+		{"placement to unknown server", "placement:\n  - env: pr\n    server: nowhere\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(writeConfig(t, tt.content)); err == nil {
+				t.Error("Load() should fail")
+			}
+		})
+	}
+}
+
+func TestPlaceDatabase(t *testing.T) {
+	cfg := Default()
+	cfg.Servers = map[string]PostgresConfig{"ephemeral": {}, "billing": {}}
+	cfg.Placement = []PlacementRule{
+		{Project: "billing", Server: "billing"},
+		{Env: "pr", Server: "ephemeral"},
+	}
+
+	tests := []struct {
+		project string
+		env     string
+		want    string
+	}{
+		{"myapp", "pr", "ephemeral"},
+		{"myapp", "prod", DefaultServer},
+		{"billing", "pr", "billing"},
+		{"billing", "prod", "billing"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.project+"/"+tt.env, func(t *testing.T) {
+			if got := cfg.PlaceDatabase(tt.project, tt.env); got != tt.want {
+				t.Errorf("PlaceDatabase(%q, %q) = %q, want %q", tt.project, tt.env, got, tt.want)
+			}
+		})
+	}
+}
+
+func TestLoadRejectsInvalidBackupSchedules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"missing dir", "backups:\n  schedules:\n    - env: prod\n      at: \"02:00\"\n      keep_daily: 7\n"},
+		{"bad time", "backups:\n  dir: /tmp\n  schedules:\n    - env: prod\n      at: \"2am\"\n      keep_daily: 7\n"},
+		{"no retention", "backups:\n  dir: /tmp\n  schedules:\n    - env: prod\n      at: \"02:00\"\n"},
+		{"missing env", "backups:\n  dir: /tmp\n  schedules:\n    - at: \"02:00\"\n      keep_daily: 7\n"},
+		{"unknown env", "backups:\n  dir: /tmp\n  schedules:\n    - env: qa\n      at: \"02:00\"\n      keep_daily: 7\n"},
+		{"duplicate env", "backups:\n  dir: /tmp\n  schedules:\n    - env: prod\n      at: \"02:00\"\n      keep_daily: 7\n    - env: prod\n      at: \"14:00\"\n      keep_weekly: 4\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(writeConfig(t, tt.content)); err == nil {
+				t.Error("Load() should fail")
+			}
+		})
+	}
+}
+
+func TestLoadRejectsInvalidCleanupRules(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"unknown action", "cleanup:\n  rules:\n    - env: pr\n      idle_for: 1h\n      action: archive\n"},
+		{"no idle time", "cleanup:\n  rules:\n    - env: pr\n      action: drop\n"},
+		{"missing env", "cleanup:\n  rules:\n    - idle_for: 1h\n      action: warn\n"},
+		{"unknown env", "cleanup:\n  rules:\n    - env: production\n      idle_for: 1h\n      action: warn\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(writeConfig(t, tt.content)); err == nil {
+				t.Error("Load() should fail")
+			}
+		})
+	}
+}
+
+func TestLoadRejectsInvalidOIDC(t *testing.T) {
+	tests := []struct {
+		name    string
+		content string
+	}{
+		{"missing client", "api:\n  oidc:\n    issuer: https://idp.example.com\n"},
+		{"bad default role", "api:\n  oidc:\n    issuer: https://idp.example.com\n    client_id: pgm\n    default_role: owner\n"},
+		{"bad group role", "api:\n  oidc:\n    issuer: https://idp.example.com\n    client_id: pgm\n    group_roles:\n      - group: dba\n        role: root\n"},
+		{"missing group", "api:\n  oidc:\n    issuer: https://idp.example.com\n    client_id: pgm\n    group_roles:\n      - role: admin\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(writeConfig(t, tt.content)); err == nil {
+				t.Error("Load() should fail")
+			}
+		})
+	}
+
+	cfg, err := Load(writeConfig(t, "api:\n  oidc:\n    issuer: https://idp.example.com\n    client_id: pgm\n    group_roles:\n      - group: dba\n        role: admin\n"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if !cfg.API.OIDC.Enabled() || len(cfg.API.OIDC.GroupRoles) != 1 {
+		t.Errorf("OIDC = %+v", cfg.API.OIDC)
+	}
+}
+
+func TestLoadGitHubIntegration(t *testing.T) {
+	if _, err := Load(writeConfig(t, "integrations:\n  github:\n    secret: s3cret\n")); err == nil {
+		t.Error("Load() should fail without repositories")
+	}
+
+	t.Setenv("PGMANAGER_GITHUB_WEBHOOK_SECRET", "from-env")
+	cfg, err := Load(writeConfig(t, "integrations:\n  github:\n    repositories:\n      Acme/API: api\n"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	github := cfg.Integrations.GitHub
+	if !github.Enabled() || github.Secret != "from-env" {
+		t.Errorf("GitHub = %+v", github)
+	}
+	if got := github.Project("acme/api"); got != "api" {
+		t.Errorf("Project(acme/api) = %q, want api", got)
+	}
+	if got := github.Project("acme/web"); got != "" {
+		t.Errorf("Project(acme/web) = %q, want none", got)
+	}
+}
+
+func TestLoadGitLabIntegration(t *testing.T) {
+	if _, err := Load(writeConfig(t, "integrations:\n  gitlab:\n    token: s3cret\n")); err == nil {
+		t.Error("Load() should fail without projects")
+	}
+
+	t.Setenv("PGMANAGER_GITLAB_WEBHOOK_TOKEN", "from-env")
+	cfg, err := Load(writeConfig(t, "integrations:\n  gitlab:\n    projects:\n      acme/backend/api: api\n"))
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	gitlab := cfg.Integrations.GitLab
+	if !gitlab.Enabled() || gitlab.Token != "from-env" || cfg.Integrations.GitHub.Enabled() {
+		t.Errorf("Integrations = %+v", cfg.Integrations)
+	}
+	if got := gitlab.Project("Acme/Backend/API"); got != "api" {
+		t.Errorf("Project(Acme/Backend/API) = %q, want api", got)
+	}
+}
+
+func TestLoadJobs(t *testing.T) {
+	cfg, err := Load(writeConfig(t, "postgres:\n  host: localhost\n"))
+	if err != nil || cfg.Jobs.Workers != 4 {
+		t.Fatalf("Load() workers = %d, %v; want the default of 4", cfg.Jobs.Workers, err)
+	}
+	if _, err := Load(writeConfig(t, "jobs:\n  workers: 0\n")); err == nil {
+		t.Error("Load() should fail without workers")
+	}
+}
+
+func TestBackupScheduleLastRun(t *testing.T) {
+	schedule := BackupSchedule{Env: "prod", At: "02:30"}
+
+	tests := []struct {
+		name string
+		now  time.Time
+		want time.Time
+	}{
+		{"after today's run", time.Date(2024, 3, 10, 9, 0, 0, 0, time.UTC), time.Date(2024, 3, 10, 2, 30, 0, 0, time.UTC)},
+		{"before today's run", time.Date(2024, 3, 10, 1, 0, 0, 0, time.UTC), time.Date(2024, 3, 9, 2, 30, 0, 0, time.UTC)},
+		{"exactly at run", time.Date(2024, 3, 10, 2, 30, 0, 0, time.UTC), time.Date(2024, 3, 10, 2, 30, 0, 0, time.UTC)},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := schedule.LastRun(tt.now); !got.Equal(tt.want) {
+				t.Errorf("LastRun(%v) = %v, want %v", tt.now, got, tt.want)
+			}
+		})
+	}
+}
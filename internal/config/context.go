@@ -0,0 +1,205 @@
+package config
+
+import (
+	"fmt"
+	"os"
+	"path/filepath"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Context is a named pgmanager installation. A context either points at a config
+// file, for direct access to PostgreSQL, or at a pgmanager server.
+type Context struct {
+	Name    string `yaml:"name"`
+	Config  string `yaml:"config,omitempty"`  // Config file of a direct context
+	Server  string `yaml:"server,omitempty"`  // pgmanager server of a remote context
+	Token   string `yaml:"token,omitempty"`   // API token for Server
+	Project string `yaml:"project,omitempty"` // Project used when a command's project argument is omitted
+}
+
+// Remote reports whether the context goes through a pgmanager server
+func (c *Context) Remote() bool {
+	return c.Server != ""
+}
+
+// Validate checks a context before it is saved
+func (c *Context) Validate() error {
+	if c.Name == "" || strings.ContainsAny(c.Name, " \t\n/") {
+		return fmt.Errorf("invalid context name '%s'", c.Name)
+	}
+	if (c.Config == "") == (c.Server == "") {
+		return fmt.Errorf("context '%s' needs either a config file or a server", c.Name)
+	}
+	if c.Token != "" && c.Server == "" {
+		return fmt.Errorf("context '%s' has a token but no server", c.Name)
+	}
+	return nil
+}
+
+// Contexts is the user's list of contexts and the one currently in use
+type Contexts struct {
+	Current  string    `yaml:"current,omitempty"`
+	Contexts []Context `yaml:"contexts"`
+}
+
+// ContextsPath returns the location of the contexts file. PGMANAGER_CONTEXTS
+// overrides the default of ~/.config/pgmanager/contexts.yaml.
+func ContextsPath() (string, error) {
+	if path := os.Getenv("PGMANAGER_CONTEXTS"); path != "" {
+		return path, nil
+	}
+	home, err := os.UserHomeDir()
+	if err != nil {
+		return "", fmt.Errorf("failed to find home directory: %w", err)
+	}
+	return filepath.Join(home, ".config", "pgmanager", "contexts.yaml"), nil
+}
+
+// LoadContexts reads the contexts file. A missing file holds no contexts.
+func LoadContexts() (*Contexts, error) {
+	path, err := ContextsPath()
+	if err != nil {
+		return nil, err
+	}
+
+	data, err := os.ReadFile(path)
+	if os.IsNotExist(err) {
+		return &Contexts{}, nil
+	}
+	if err != nil {
+		return nil, err
+	}
+
+	var contexts Contexts
+	if err := yaml.Unmarshal(data, &contexts); err != nil {
+		return nil, fmt.Errorf("invalid contexts file %s: %w", path, err)
+	}
+	return &contexts, nil
+}
+
+// Save writes the contexts file. It may hold tokens, so only the user can read it.
+func (c *Contexts) Save() error {
+	path, err := ContextsPath()
+	if err != nil {
+		return err
+	}
+	if err := os.MkdirAll(filepath.Dir(path), 0700); err != nil {
+		return err
+	}
+
+	data, err := yaml.Marshal(c)
+	if err != nil {
+		return err
+	}
+	if err := os.WriteFile(path, data, 0600); err != nil {
+		return err
+	}
+	// WriteFile keeps the mode of an existing file
+	return os.Chmod(path, 0600)
+}
+
+// Get returns the named context, or nil if there is none
+func (c *Contexts) Get(name string) *Context {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == name {
+			return &c.Contexts[i]
+		}
+	}
+	return nil
+}
+
+// Add adds a new context. Relative config paths are made absolute, so the
+// context works from any directory.
+func (c *Contexts) Add(ctx Context) error {
+	if err := ctx.Validate(); err != nil {
+		return err
+	}
+	if c.Get(ctx.Name) != nil {
+		return fmt.Errorf("context '%s' already exists", ctx.Name)
+	}
+	if ctx.Config != "" {
+		path, err := filepath.Abs(ctx.Config)
+		if err != nil {
+			return err
+		}
+		if _, err := os.Stat(path); err != nil {
+			return fmt.Errorf("config file %s not found", path)
+		}
+		ctx.Config = path
+	}
+	c.Contexts = append(c.Contexts, ctx)
+	return nil
+}
+
+// Remove deletes a context. Removing the current context leaves none selected.
+func (c *Contexts) Remove(name string) error {
+	for i := range c.Contexts {
+		if c.Contexts[i].Name == name {
+			c.Contexts = append(c.Contexts[:i], c.Contexts[i+1:]...)
+			if c.Current == name {
+				c.Current = ""
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("context '%s' not found", name)
+}
+
+// Use makes a context the current one
+func (c *Contexts) Use(name string) error {
+	if c.Get(name) == nil {
+		return fmt.Errorf("context '%s' not found", name)
+	}
+	c.Current = name
+	return nil
+}
+
+// SelectContext returns the context in effect when no config file is given: the
+// named one (from --context or PGMANAGER_CONTEXT), otherwise the current context
+// unless a config file in the working directory takes precedence. It returns nil
+// when no context applies.
+func SelectContext(name string) (*Context, error) {
+	if name == "" {
+		name = os.Getenv("PGMANAGER_CONTEXT")
+	}
+
+	contexts, err := LoadContexts()
+	if err != nil {
+		return nil, err
+	}
+
+	if name != "" {
+		ctx := contexts.Get(name)
+		if ctx == nil {
+			return nil, fmt.Errorf("context '%s' not found", name)
+		}
+		return ctx, nil
+	}
+
+	if contexts.Current == "" {
+		return nil, nil
+	}
+	if cwd, err := os.Getwd(); err == nil && findConfig(cwd) != "" {
+		return nil, nil
+	}
+	ctx := contexts.Get(contexts.Current)
+	if ctx == nil {
+		return nil, fmt.Errorf("current context '%s' not found", contexts.Current)
+	}
+	return ctx, nil
+}
+
+// LoadContext loads the configuration of a context. A remote context needs no
+// config file; its server and token are used unless the environment overrides them.
+func LoadContext(ctx *Context) (*Config, error) {
+	if !ctx.Remote() {
+		return Load(ctx.Config)
+	}
+
+	cfg := Default()
+	cfg.Remote = RemoteConfig{Server: ctx.Server, Token: ctx.Token}
+	cfg.Remote.FromEnv()
+	return cfg, nil
+}
@@ -0,0 +1,154 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+// useContextsFile points the contexts file at a temporary directory
+func useContextsFile(t *testing.T) string {
+	t.Helper()
+	path := filepath.Join(t.TempDir(), "contexts.yaml")
+	t.Setenv("PGMANAGER_CONTEXTS", path)
+	t.Setenv("PGMANAGER_CONTEXT", "")
+	return path
+}
+
+// chdir changes the working directory for the duration of a test
+func chdir(t *testing.T, dir string) {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatal(err)
+	}
+	if err := os.Chdir(dir); err != nil {
+		t.Fatal(err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+}
+
+func TestContexts(t *testing.T) {
+	path := useContextsFile(t)
+	configPath := writeConfig(t, "postgres:\n  host: eu.internal\n")
+
+	contexts, err := LoadContexts()
+	if err != nil {
+		t.Fatalf("LoadContexts() without a file error = %v", err)
+	}
+	if err := contexts.Add(Context{Name: "eu", Config: configPath, Project: "myapp"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := contexts.Add(Context{Name: "us", Server: "https://pgm-us.internal", Token: "secret"}); err != nil {
+		t.Fatalf("Add() error = %v", err)
+	}
+	if err := contexts.Use("us"); err != nil {
+		t.Fatalf("Use() error = %v", err)
+	}
+	if err := contexts.Save(); err != nil {
+		t.Fatalf("Save() error = %v", err)
+	}
+
+	info, err := os.Stat(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if info.Mode().Perm() != 0600 {
+		t.Errorf("contexts file mode = %v, want 0600", info.Mode().Perm())
+	}
+
+	loaded, err := LoadContexts()
+	if err != nil {
+		t.Fatalf("LoadContexts() error = %v", err)
+	}
+	if loaded.Current != "us" || len(loaded.Contexts) != 2 || loaded.Get("eu").Project != "myapp" {
+		t.Errorf("LoadContexts() = %+v", loaded)
+	}
+
+	if err := loaded.Remove("us"); err != nil {
+		t.Fatalf("Remove() error = %v", err)
+	}
+	if loaded.Current != "" {
+		t.Errorf("removing the current context left Current = %q", loaded.Current)
+	}
+	if err := loaded.Remove("us"); err == nil {
+		t.Error("Remove() of a missing context should fail")
+	}
+}
+
+func TestContextValidate(t *testing.T) {
+	useContextsFile(t)
+	contexts := &Contexts{}
+
+	tests := []struct {
+		name string
+		ctx  Context
+	}{
+		{"no name", Context{Server: "https://pgm.internal"}},
+		{"name with space", Context{Name: "eu west", Server: "https://pgm.internal"}},
+		{"no target", Context{Name: "eu"}},
+		{"config and server", Context{Name: "eu", Config: "pgmanager.yaml", Server: "https://pgm.internal"}},
+		{"token without server", Context{Name: "eu", Config: "pgmanager.yaml", Token: "secret"}},
+		{"missing config file", Context{Name: "eu", Config: "/nonexistent/pgmanager.yaml"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := contexts.Add(tt.ctx); err == nil {
+				t.Error("Add() should fail")
+			}
+		})
+	}
+}
+
+func TestSelectContext(t *testing.T) {
+	useContextsFile(t)
+	configPath := writeConfig(t, "postgres:\n  host: eu.internal\n")
+	chdir(t, t.TempDir())
+
+	contexts := &Contexts{}
+	if err := contexts.Add(Context{Name: "eu", Config: configPath}); err != nil {
+		t.Fatal(err)
+	}
+	if err := contexts.Add(Context{Name: "us", Server: "https://pgm-us.internal", Token: "secret"}); err != nil {
+		t.Fatal(err)
+	}
+	contexts.Current = "eu"
+	if err := contexts.Save(); err != nil {
+		t.Fatal(err)
+	}
+
+	ctx, err := SelectContext("")
+	if err != nil || ctx == nil || ctx.Name != "eu" {
+		t.Fatalf("SelectContext() = %v, %v, want the current context", ctx, err)
+	}
+	if path, err := Discover(); err != nil || path != configPath {
+		t.Errorf("Discover() = %q, %v, want the current context's config file", path, err)
+	}
+
+	t.Setenv("PGMANAGER_CONTEXT", "us")
+	ctx, err = SelectContext("")
+	if err != nil || ctx == nil || ctx.Name != "us" {
+		t.Fatalf("SelectContext() = %v, %v, want the context from PGMANAGER_CONTEXT", ctx, err)
+	}
+	cfg, err := LoadContext(ctx)
+	if err != nil {
+		t.Fatalf("LoadContext() error = %v", err)
+	}
+	if cfg.Remote.Server != "https://pgm-us.internal" || cfg.Remote.Token != "secret" {
+		t.Errorf("LoadContext() remote = %+v", cfg.Remote)
+	}
+
+	if _, err := SelectContext("asia"); err == nil {
+		t.Error("SelectContext() of a missing context should fail")
+	}
+
+	// A config file in the working directory takes precedence over the current context
+	t.Setenv("PGMANAGER_CONTEXT", "")
+	if err := os.WriteFile("pgmanager.yaml", []byte("postgres:\n  host: localhost\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+	if ctx, err := SelectContext(""); err != nil || ctx != nil {
+		t.Errorf("SelectContext() = %v, %v, want no context", ctx, err)
+	}
+}
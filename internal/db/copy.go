@@ -0,0 +1,80 @@
+package db
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// errDestinationFailed stops the source side of CopyTable once the destination
+// has given up, so that its error can be told apart from a failure to read
+var errDestinationFailed = errors.New("destination failed")
+
+// CopyTable streams the rows of table from src to dst with COPY and returns the
+// number of rows written. The data never touches disk: COPY TO on src is piped
+// straight into COPY FROM on dst.
+func CopyTable(ctx context.Context, src, dst *pgx.Conn, table Table) (int64, error) {
+	cols := table.CopyColumns()
+	pr, pw := io.Pipe()
+
+	srcErr := make(chan error, 1)
+	go func() {
+		_, err := src.PgConn().CopyTo(ctx, pw, fmt.Sprintf("COPY %s (%s) TO STDOUT", table.QualifiedName(), cols))
+		pw.CloseWithError(err)
+		srcErr <- err
+	}()
+
+	tag, err := dst.PgConn().CopyFrom(ctx, pr, fmt.Sprintf("COPY %s (%s) FROM STDIN", table.QualifiedName(), cols))
+	// Unblock the source if the destination gave up early
+	pr.CloseWithError(errDestinationFailed)
+	if copyErr := <-srcErr; copyErr != nil && !errors.Is(copyErr, errDestinationFailed) {
+		return 0, fmt.Errorf("failed to read %s: %w", table.QualifiedName(), copyErr)
+	}
+	if err != nil {
+		return 0, fmt.Errorf("failed to write %s: %w", table.QualifiedName(), err)
+	}
+
+	return tag.RowsAffected(), nil
+}
+
+// CountRows returns the exact number of rows in table
+func CountRows(ctx context.Context, conn *pgx.Conn, table Table) (int64, error) {
+	var n int64
+	err := conn.QueryRow(ctx, fmt.Sprintf("SELECT count(*) FROM ONLY %s", table.QualifiedName())).Scan(&n)
+	if err != nil {
+		return 0, fmt.Errorf("failed to count rows in %s: %w", table.QualifiedName(), err)
+	}
+	return n, nil
+}
+
+// ApplyStatements runs stmts on conn in a single transaction, so a failure leaves
+// nothing half-applied
+func ApplyStatements(ctx context.Context, conn *pgx.Conn, stmts []string) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, stmt := range stmts {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return fmt.Errorf("failed to execute %q: %w", truncateStatement(stmt), err)
+		}
+	}
+
+	return tx.Commit(ctx)
+}
+
+// truncateStatement shortens a statement for use in error messages
+func truncateStatement(stmt string) string {
+	const max = 120
+	stmt = strings.Join(strings.Fields(stmt), " ")
+	if len(stmt) > max {
+		return stmt[:max] + "..."
+	}
+	return stmt
+}
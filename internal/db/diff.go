@@ -0,0 +1,473 @@
+package db
+
+import (
+	"fmt"
+	"slices"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Change actions reported by DiffSchemas
+const (
+	ChangeAdded   = "added"
+	ChangeRemoved = "removed"
+	ChangeChanged = "changed"
+)
+
+// SchemaDiff lists the differences between two schemas and a best-effort SQL
+// script that turns the first schema into the second
+type SchemaDiff struct {
+	Changes    []SchemaChange `json:"changes"`
+	Statements []string       `json:"statements,omitempty"`
+}
+
+// SchemaChange is an object that exists in only one schema or differs between them
+type SchemaChange struct {
+	Kind   string `json:"kind"` // schema, extension, enum, sequence, table, column, function, view, constraint, index, trigger
+	Name   string `json:"name"`
+	Action string `json:"action"`
+	Detail string `json:"detail,omitempty"`
+}
+
+// Empty reports whether the schemas are identical
+func (d *SchemaDiff) Empty() bool {
+	return len(d.Changes) == 0
+}
+
+// Text renders the changes one per line, prefixed with +, - or ~
+func (d *SchemaDiff) Text() string {
+	var b strings.Builder
+	for _, c := range d.Changes {
+		prefix := "~"
+		switch c.Action {
+		case ChangeAdded:
+			prefix = "+"
+		case ChangeRemoved:
+			prefix = "-"
+		}
+		fmt.Fprintf(&b, "%s %s %s", prefix, c.Kind, c.Name)
+		if c.Detail != "" {
+			fmt.Fprintf(&b, ": %s", c.Detail)
+		}
+		b.WriteString("\n")
+	}
+	return b.String()
+}
+
+// SQL renders the migration statements as a script
+func (d *SchemaDiff) SQL() string {
+	var b strings.Builder
+	for _, stmt := range d.Statements {
+		b.WriteString(strings.TrimRight(stmt, "; \n"))
+		b.WriteString(";\n")
+	}
+	return b.String()
+}
+
+// schemaDiffer accumulates changes and statements. Drops are collected separately
+// and emitted first, in reverse dependency order.
+type schemaDiffer struct {
+	changes []SchemaChange
+	drops   [][]string // Indexed by drop phase
+	creates []string
+}
+
+// Drop phases, in the order their statements are emitted
+const (
+	dropTriggers = iota
+	dropViews
+	dropForeignKeys
+	dropConstraints
+	dropIndexes
+	dropColumns
+	dropTables
+	dropFunctions
+	dropSequences
+	dropEnums
+	dropExtensions
+	dropSchemas
+	dropPhases
+)
+
+func (d *schemaDiffer) change(kind, name, action, detail string) {
+	d.changes = append(d.changes, SchemaChange{Kind: kind, Name: name, Action: action, Detail: detail})
+}
+
+func (d *schemaDiffer) drop(phase int, stmt string) {
+	d.drops[phase] = append(d.drops[phase], stmt)
+}
+
+func (d *schemaDiffer) create(stmt string) {
+	d.creates = append(d.creates, stmt)
+}
+
+// DiffSchemas compares two schemas. The statements of the result turn from into to;
+// changes that cannot be expressed safely are emitted as SQL comments.
+func DiffSchemas(from, to *Schema) *SchemaDiff {
+	d := &schemaDiffer{drops: make([][]string, dropPhases)}
+
+	// Schemas and extensions
+	added, removed, _ := diffObjects(from.Namespaces, to.Namespaces, func(ns string) string { return ns }, nil)
+	for _, ns := range added {
+		d.change("schema", ns, ChangeAdded, "")
+		d.create(fmt.Sprintf("CREATE SCHEMA %s", pgx.Identifier{ns}.Sanitize()))
+	}
+	for _, ns := range removed {
+		d.change("schema", ns, ChangeRemoved, "")
+		d.drop(dropSchemas, fmt.Sprintf("DROP SCHEMA %s", pgx.Identifier{ns}.Sanitize()))
+	}
+
+	exts, extsRemoved, extsChanged := diffObjects(from.Extensions, to.Extensions,
+		func(x Extension) string { return x.Name },
+		func(a, b Extension) bool { return a.Schema == b.Schema && a.Version == b.Version })
+	for _, x := range exts {
+		d.change("extension", x.Name, ChangeAdded, "")
+		d.create(fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s WITH SCHEMA %s",
+			pgx.Identifier{x.Name}.Sanitize(), pgx.Identifier{x.Schema}.Sanitize()))
+	}
+	for _, x := range extsRemoved {
+		d.change("extension", x.Name, ChangeRemoved, "")
+		d.drop(dropExtensions, fmt.Sprintf("DROP EXTENSION %s", pgx.Identifier{x.Name}.Sanitize()))
+	}
+	for _, p := range extsChanged {
+		a, b := p[0], p[1]
+		if a.Schema != b.Schema {
+			d.change("extension", b.Name, ChangeChanged, fmt.Sprintf("schema %s -> %s", a.Schema, b.Schema))
+			d.create(fmt.Sprintf("ALTER EXTENSION %s SET SCHEMA %s", pgx.Identifier{b.Name}.Sanitize(), pgx.Identifier{b.Schema}.Sanitize()))
+		}
+		if a.Version != b.Version {
+			d.change("extension", b.Name, ChangeChanged, fmt.Sprintf("version %s -> %s", a.Version, b.Version))
+			d.create(fmt.Sprintf("ALTER EXTENSION %s UPDATE TO %s", pgx.Identifier{b.Name}.Sanitize(), quoteLiteral(b.Version)))
+		}
+	}
+
+	// Enums
+	enums, enumsRemoved, enumsChanged := diffObjects(from.Enums, to.Enums,
+		func(e Enum) string { return pgx.Identifier{e.Schema, e.Name}.Sanitize() },
+		func(a, b Enum) bool { return slices.Equal(a.Labels, b.Labels) })
+	for _, e := range enums {
+		d.change("enum", e.Schema+"."+e.Name, ChangeAdded, "")
+		d.create(createEnumSQL(e))
+	}
+	for _, e := range enumsRemoved {
+		d.change("enum", e.Schema+"."+e.Name, ChangeRemoved, "")
+		d.drop(dropEnums, fmt.Sprintf("DROP TYPE %s", pgx.Identifier{e.Schema, e.Name}.Sanitize()))
+	}
+	for _, p := range enumsChanged {
+		a, b := p[0], p[1]
+		d.change("enum", b.Schema+"."+b.Name, ChangeChanged,
+			fmt.Sprintf("labels (%s) -> (%s)", strings.Join(a.Labels, ", "), strings.Join(b.Labels, ", ")))
+		d.create(alterEnumSQL(a, b))
+	}
+
+	// Sequences that back identity columns are covered by their column
+	isPlain := func(q Sequence) bool { return !q.Identity }
+	seqs, seqsRemoved, seqsChanged := diffObjects(filter(from.Sequences, isPlain), filter(to.Sequences, isPlain),
+		func(q Sequence) string { return pgx.Identifier{q.Schema, q.Name}.Sanitize() },
+		func(a, b Sequence) bool {
+			return a.DataType == b.DataType && a.Increment == b.Increment && a.Min == b.Min &&
+				a.Max == b.Max && a.Cache == b.Cache && a.Cycle == b.Cycle
+		})
+	for _, q := range seqs {
+		d.change("sequence", q.Schema+"."+q.Name, ChangeAdded, "")
+		d.create(createSequenceSQL(q))
+	}
+	for _, q := range seqsRemoved {
+		d.change("sequence", q.Schema+"."+q.Name, ChangeRemoved, "")
+		d.drop(dropSequences, fmt.Sprintf("DROP SEQUENCE %s", pgx.Identifier{q.Schema, q.Name}.Sanitize()))
+	}
+	for _, p := range seqsChanged {
+		b := p[1]
+		d.change("sequence", b.Schema+"."+b.Name, ChangeChanged, "options differ")
+		cycle := "NO CYCLE"
+		if b.Cycle {
+			cycle = "CYCLE"
+		}
+		d.create(fmt.Sprintf("ALTER SEQUENCE %s AS %s INCREMENT BY %d MINVALUE %d MAXVALUE %d CACHE %d %s",
+			pgx.Identifier{b.Schema, b.Name}.Sanitize(), b.DataType, b.Increment, b.Min, b.Max, b.Cache, cycle))
+	}
+
+	// Tables and columns
+	tables, tablesRemoved, tablesBoth := diffObjects(from.Tables, to.Tables,
+		func(t Table) string { return t.QualifiedName() }, nil)
+	for _, t := range tables {
+		d.change("table", t.Schema+"."+t.Name, ChangeAdded, "")
+		d.create(createTableSQL(t))
+	}
+	for _, t := range tablesRemoved {
+		d.change("table", t.Schema+"."+t.Name, ChangeRemoved, "")
+		d.drop(dropTables, fmt.Sprintf("DROP TABLE %s", t.QualifiedName()))
+	}
+	for _, p := range tablesBoth {
+		d.diffColumns(p[0], p[1])
+	}
+
+	// Functions
+	funcs, funcsRemoved, funcsChanged := diffObjects(from.Functions, to.Functions,
+		func(f Function) string {
+			return fmt.Sprintf("%s(%s)", pgx.Identifier{f.Schema, f.Name}.Sanitize(), f.Arguments)
+		},
+		func(a, b Function) bool { return a.Definition == b.Definition })
+	for _, f := range funcs {
+		d.change("function", fmt.Sprintf("%s.%s(%s)", f.Schema, f.Name, f.Arguments), ChangeAdded, "")
+		d.create(f.Definition)
+	}
+	for _, f := range funcsRemoved {
+		d.change("function", fmt.Sprintf("%s.%s(%s)", f.Schema, f.Name, f.Arguments), ChangeRemoved, "")
+		d.drop(dropFunctions, fmt.Sprintf("DROP ROUTINE %s(%s)", pgx.Identifier{f.Schema, f.Name}.Sanitize(), f.Arguments))
+	}
+	for _, p := range funcsChanged {
+		f := p[1]
+		d.change("function", fmt.Sprintf("%s.%s(%s)", f.Schema, f.Name, f.Arguments), ChangeChanged, "definition differs")
+		// pg_get_functiondef produces CREATE OR REPLACE
+		d.create(f.Definition)
+	}
+
+	// Defaults of new tables may call the functions created above
+	for _, t := range tables {
+		for _, c := range t.Columns {
+			if c.Default != "" {
+				d.create(fmt.Sprintf("ALTER TABLE ONLY %s ALTER COLUMN %s SET DEFAULT %s",
+					t.QualifiedName(), pgx.Identifier{c.Name}.Sanitize(), c.Default))
+			}
+		}
+	}
+
+	// Views
+	views, viewsRemoved, viewsChanged := diffObjects(from.Views, to.Views,
+		func(v View) string { return pgx.Identifier{v.Schema, v.Name}.Sanitize() },
+		func(a, b View) bool { return a.Materialized == b.Materialized && a.Definition == b.Definition })
+	for _, v := range views {
+		d.change(viewKind(v), v.Schema+"."+v.Name, ChangeAdded, "")
+		d.create(createViewSQL(v))
+	}
+	for _, v := range viewsRemoved {
+		d.change(viewKind(v), v.Schema+"."+v.Name, ChangeRemoved, "")
+		d.drop(dropViews, dropViewSQL(v))
+	}
+	for _, p := range viewsChanged {
+		a, b := p[0], p[1]
+		d.change(viewKind(b), b.Schema+"."+b.Name, ChangeChanged, "definition differs")
+		if !a.Materialized && !b.Materialized {
+			d.create("CREATE OR REPLACE " + strings.TrimPrefix(createViewSQL(b), "CREATE "))
+			continue
+		}
+		d.drop(dropViews, dropViewSQL(a))
+		d.create(createViewSQL(b))
+	}
+
+	// Constraints, indexes and triggers are replaced when their definition changes
+	constraintKey := func(c Constraint) string { return pgx.Identifier{c.Schema, c.Table, c.Name}.Sanitize() }
+	cons, consRemoved, consChanged := diffObjects(from.Constraints, to.Constraints, constraintKey,
+		func(a, b Constraint) bool { return a.Definition == b.Definition })
+	dropConstraint := func(c Constraint) {
+		phase := dropConstraints
+		if c.Type == "f" {
+			phase = dropForeignKeys
+		}
+		d.drop(phase, fmt.Sprintf("ALTER TABLE %s DROP CONSTRAINT %s",
+			pgx.Identifier{c.Schema, c.Table}.Sanitize(), pgx.Identifier{c.Name}.Sanitize()))
+	}
+	var newConstraints []Constraint
+	for _, c := range cons {
+		d.change("constraint", c.Schema+"."+c.Table+"."+c.Name, ChangeAdded, c.Definition)
+		newConstraints = append(newConstraints, c)
+	}
+	for _, c := range consRemoved {
+		d.change("constraint", c.Schema+"."+c.Table+"."+c.Name, ChangeRemoved, c.Definition)
+		dropConstraint(c)
+	}
+	for _, p := range consChanged {
+		a, b := p[0], p[1]
+		d.change("constraint", b.Schema+"."+b.Table+"."+b.Name, ChangeChanged, fmt.Sprintf("%s -> %s", a.Definition, b.Definition))
+		dropConstraint(a)
+		newConstraints = append(newConstraints, b)
+	}
+
+	idxs, idxsRemoved, idxsChanged := diffObjects(from.Indexes, to.Indexes,
+		func(i Index) string { return pgx.Identifier{i.Schema, i.Name}.Sanitize() },
+		func(a, b Index) bool { return a.Definition == b.Definition })
+	var newIndexes []Index
+	for _, i := range idxs {
+		d.change("index", i.Schema+"."+i.Name, ChangeAdded, "")
+		newIndexes = append(newIndexes, i)
+	}
+	for _, i := range idxsRemoved {
+		d.change("index", i.Schema+"."+i.Name, ChangeRemoved, "")
+		d.drop(dropIndexes, fmt.Sprintf("DROP INDEX %s", pgx.Identifier{i.Schema, i.Name}.Sanitize()))
+	}
+	for _, p := range idxsChanged {
+		a, b := p[0], p[1]
+		d.change("index", b.Schema+"."+b.Name, ChangeChanged, fmt.Sprintf("%s -> %s", a.Definition, b.Definition))
+		d.drop(dropIndexes, fmt.Sprintf("DROP INDEX %s", pgx.Identifier{a.Schema, a.Name}.Sanitize()))
+		newIndexes = append(newIndexes, b)
+	}
+
+	// Same order as PostDataStatements: unique constraints before the foreign keys that reference them
+	post := &Schema{Constraints: newConstraints, Indexes: newIndexes}
+	for _, stmt := range post.PostDataStatements() {
+		d.create(stmt)
+	}
+
+	trigs, trigsRemoved, trigsChanged := diffObjects(from.Triggers, to.Triggers,
+		func(t Trigger) string { return pgx.Identifier{t.Schema, t.Table, t.Name}.Sanitize() },
+		func(a, b Trigger) bool { return a.Definition == b.Definition })
+	dropTrigger := func(t Trigger) {
+		d.drop(dropTriggers, fmt.Sprintf("DROP TRIGGER %s ON %s",
+			pgx.Identifier{t.Name}.Sanitize(), pgx.Identifier{t.Schema, t.Table}.Sanitize()))
+	}
+	for _, t := range trigs {
+		d.change("trigger", t.Schema+"."+t.Table+"."+t.Name, ChangeAdded, "")
+		d.create(t.Definition)
+	}
+	for _, t := range trigsRemoved {
+		d.change("trigger", t.Schema+"."+t.Table+"."+t.Name, ChangeRemoved, "")
+		dropTrigger(t)
+	}
+	for _, p := range trigsChanged {
+		d.change("trigger", p[1].Schema+"."+p[1].Table+"."+p[1].Name, ChangeChanged, "definition differs")
+		dropTrigger(p[0])
+		d.create(p[1].Definition)
+	}
+
+	diff := &SchemaDiff{Changes: d.changes}
+	if diff.Changes == nil {
+		diff.Changes = []SchemaChange{}
+	}
+	for _, phase := range d.drops {
+		diff.Statements = append(diff.Statements, phase...)
+	}
+	diff.Statements = append(diff.Statements, d.creates...)
+	return diff
+}
+
+// diffColumns compares the columns of a table present in both schemas
+func (d *schemaDiffer) diffColumns(from, to Table) {
+	table := to.QualifiedName()
+	added, removed, both := diffObjects(from.Columns, to.Columns, func(c Column) string { return c.Name }, nil)
+
+	for _, c := range added {
+		d.change("column", to.Schema+"."+to.Name+"."+c.Name, ChangeAdded, c.Type)
+		def := columnSQL(c)
+		if c.Default != "" {
+			def += " DEFAULT " + c.Default
+		}
+		d.create(fmt.Sprintf("ALTER TABLE %s ADD COLUMN %s", table, def))
+	}
+	for _, c := range removed {
+		d.change("column", from.Schema+"."+from.Name+"."+c.Name, ChangeRemoved, "")
+		d.drop(dropColumns, fmt.Sprintf("ALTER TABLE %s DROP COLUMN %s", table, pgx.Identifier{c.Name}.Sanitize()))
+	}
+
+	for _, p := range both {
+		a, b := p[0], p[1]
+		name := to.Schema + "." + to.Name + "." + b.Name
+		col := pgx.Identifier{b.Name}.Sanitize()
+
+		if a.Type != b.Type {
+			d.change("column", name, ChangeChanged, fmt.Sprintf("type %s -> %s", a.Type, b.Type))
+			d.create(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s TYPE %s", table, col, b.Type))
+		}
+		if a.NotNull != b.NotNull {
+			detail, action := "now NOT NULL", "SET NOT NULL"
+			if !b.NotNull {
+				detail, action = "now nullable", "DROP NOT NULL"
+			}
+			d.change("column", name, ChangeChanged, detail)
+			d.create(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s %s", table, col, action))
+		}
+		if a.Default != b.Default {
+			d.change("column", name, ChangeChanged, fmt.Sprintf("default %s -> %s", orNone(a.Default), orNone(b.Default)))
+			if b.Default == "" {
+				d.create(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s DROP DEFAULT", table, col))
+			} else {
+				d.create(fmt.Sprintf("ALTER TABLE %s ALTER COLUMN %s SET DEFAULT %s", table, col, b.Default))
+			}
+		}
+		if a.Identity != b.Identity || a.Generated != b.Generated {
+			d.change("column", name, ChangeChanged, "identity or generation expression differs")
+			d.create(fmt.Sprintf("-- %s.%s: identity or generation expression differs, change it manually", table, col))
+		}
+	}
+}
+
+// diffObjects matches objects by key. It returns the objects only in to, the objects
+// only in from, and the pairs present in both; when equal is set, only pairs that
+// differ are returned.
+func diffObjects[T any](from, to []T, key func(T) string, equal func(a, b T) bool) (added, removed []T, changed [][2]T) {
+	fromByKey := make(map[string]T, len(from))
+	for _, o := range from {
+		fromByKey[key(o)] = o
+	}
+	toKeys := make(map[string]bool, len(to))
+	for _, o := range to {
+		k := key(o)
+		toKeys[k] = true
+		prev, ok := fromByKey[k]
+		switch {
+		case !ok:
+			added = append(added, o)
+		case equal == nil || !equal(prev, o):
+			changed = append(changed, [2]T{prev, o})
+		}
+	}
+	for _, o := range from {
+		if !toKeys[key(o)] {
+			removed = append(removed, o)
+		}
+	}
+	return added, removed, changed
+}
+
+func filter[T any](items []T, keep func(T) bool) []T {
+	var result []T
+	for _, item := range items {
+		if keep(item) {
+			result = append(result, item)
+		}
+	}
+	return result
+}
+
+// alterEnumSQL adds the labels of b missing from a. Labels cannot be removed or
+// reordered, so any other change becomes a comment.
+func alterEnumSQL(a, b Enum) string {
+	name := pgx.Identifier{b.Schema, b.Name}.Sanitize()
+	var stmts []string
+	for _, label := range b.Labels {
+		if !slices.Contains(a.Labels, label) {
+			stmts = append(stmts, fmt.Sprintf("ALTER TYPE %s ADD VALUE %s", name, quoteLiteral(label)))
+		}
+	}
+	for _, label := range a.Labels {
+		if !slices.Contains(b.Labels, label) {
+			return fmt.Sprintf("-- %s: label %s was removed, recreate the type manually", name, quoteLiteral(label))
+		}
+	}
+	if len(stmts) == 0 {
+		return fmt.Sprintf("-- %s: labels were reordered, recreate the type manually", name)
+	}
+	return strings.Join(stmts, ";\n")
+}
+
+func orNone(s string) string {
+	if s == "" {
+		return "none"
+	}
+	return s
+}
+
+func viewKind(v View) string {
+	if v.Materialized {
+		return "materialized view"
+	}
+	return "view"
+}
+
+func dropViewSQL(v View) string {
+	if v.Materialized {
+		return fmt.Sprintf("DROP MATERIALIZED VIEW %s", pgx.Identifier{v.Schema, v.Name}.Sanitize())
+	}
+	return fmt.Sprintf("DROP VIEW %s", pgx.Identifier{v.Schema, v.Name}.Sanitize())
+}
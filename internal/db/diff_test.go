@@ -0,0 +1,107 @@
+package db
+
+import (
+	"slices"
+	"strings"
+	"testing"
+)
+
+func TestDiffSchemas(t *testing.T) {
+	users := Table{Schema: "public", Name: "users", Columns: []Column{
+		{Name: "id", Type: "bigint", NotNull: true},
+		{Name: "email", Type: "character varying(100)"},
+		{Name: "legacy", Type: "text"},
+	}}
+	from := &Schema{
+		Namespaces: []string{"public"},
+		Enums:      []Enum{{Schema: "public", Name: "status", Labels: []string{"new", "done"}}},
+		Tables:     []Table{users, {Schema: "public", Name: "old", Columns: []Column{{Name: "id", Type: "integer"}}}},
+		Indexes:    []Index{{Schema: "public", Table: "users", Name: "users_email", Definition: "CREATE INDEX users_email ON public.users USING btree (email)"}},
+		Constraints: []Constraint{
+			{Schema: "public", Table: "users", Name: "users_pkey", Type: "p", Definition: "PRIMARY KEY (id)"},
+		},
+	}
+
+	to := &Schema{
+		Namespaces: []string{"public"},
+		Enums:      []Enum{{Schema: "public", Name: "status", Labels: []string{"new", "done", "failed"}}},
+		Tables: []Table{
+			{Schema: "public", Name: "users", Columns: []Column{
+				{Name: "id", Type: "bigint", NotNull: true},
+				{Name: "email", Type: "text", NotNull: true},
+				{Name: "created_at", Type: "timestamp with time zone", Default: "now()"},
+			}},
+			{Schema: "public", Name: "orders", Columns: []Column{{Name: "id", Type: "bigint", Default: "1"}}},
+		},
+		Indexes: []Index{{Schema: "public", Table: "users", Name: "users_email", Definition: "CREATE UNIQUE INDEX users_email ON public.users USING btree (email)"}},
+		Constraints: []Constraint{
+			{Schema: "public", Table: "users", Name: "users_pkey", Type: "p", Definition: "PRIMARY KEY (id)"},
+			{Schema: "public", Table: "orders", Name: "orders_user_fkey", Type: "f", Definition: "FOREIGN KEY (id) REFERENCES public.users(id)"},
+		},
+	}
+
+	diff := DiffSchemas(from, to)
+
+	var got []string
+	for _, c := range diff.Changes {
+		got = append(got, c.Action+" "+c.Kind+" "+c.Name)
+	}
+	for _, want := range []string{
+		"changed enum public.status",
+		"added table public.orders",
+		"removed table public.old",
+		"added column public.users.created_at",
+		"removed column public.users.legacy",
+		"changed column public.users.email",
+		"changed index public.users_email",
+		"added constraint public.orders.orders_user_fkey",
+	} {
+		if !slices.Contains(got, want) {
+			t.Errorf("missing change %q in %v", want, got)
+		}
+	}
+	if slices.Contains(got, "changed constraint public.users.users_pkey") {
+		t.Errorf("unchanged constraint reported: %v", got)
+	}
+
+	index := func(prefix string) int {
+		for i, s := range diff.Statements {
+			if strings.HasPrefix(s, prefix) {
+				return i
+			}
+		}
+		t.Fatalf("no statement starting with %q in %v", prefix, diff.Statements)
+		return -1
+	}
+	if index(`DROP INDEX "public"."users_email"`) > index(`CREATE UNIQUE INDEX users_email`) {
+		t.Errorf("changed index must be dropped before it is recreated: %v", diff.Statements)
+	}
+	if index(`DROP TABLE "public"."old"`) > index(`CREATE TABLE "public"."orders"`) {
+		t.Errorf("drops must come first: %v", diff.Statements)
+	}
+	if index(`CREATE TABLE "public"."orders"`) > index(`ALTER TABLE ONLY "public"."orders" ADD CONSTRAINT`) {
+		t.Errorf("constraints must be added after their table: %v", diff.Statements)
+	}
+	index(`ALTER TYPE "public"."status" ADD VALUE 'failed'`)
+	index(`ALTER TABLE "public"."users" ALTER COLUMN "email" TYPE text`)
+	index(`ALTER TABLE "public"."users" ALTER COLUMN "email" SET NOT NULL`)
+	index(`ALTER TABLE "public"."users" ADD COLUMN "created_at" timestamp with time zone DEFAULT now()`)
+	index(`ALTER TABLE ONLY "public"."orders" ALTER COLUMN "id" SET DEFAULT 1`)
+
+	if empty := DiffSchemas(to, to); !empty.Empty() || len(empty.Statements) != 0 {
+		t.Errorf("identical schemas produced %v", empty.Changes)
+	}
+}
+
+func TestAlterEnumSQL(t *testing.T) {
+	a := Enum{Schema: "public", Name: "mood", Labels: []string{"sad", "happy"}}
+
+	got := alterEnumSQL(a, Enum{Schema: "public", Name: "mood", Labels: []string{"happy", "sad"}})
+	if !strings.HasPrefix(got, "--") {
+		t.Errorf("reordered labels should be a comment, got %q", got)
+	}
+	got = alterEnumSQL(a, Enum{Schema: "public", Name: "mood", Labels: []string{"sad"}})
+	if !strings.Contains(got, "removed") {
+		t.Errorf("removed label should be a comment, got %q", got)
+	}
+}
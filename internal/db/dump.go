@@ -0,0 +1,221 @@
+package db
+
+import (
+	"bufio"
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// DumpFormat identifies pgmanager dump archives
+const DumpFormat = "pgmanager-dump"
+
+// DumpVersion is the version of the archive layout written by WriteDump
+const DumpVersion = 1
+
+// An archive is a header line holding a JSON DumpHeader, followed by one section
+// per table: a JSON dumpSection line, the table's rows in COPY text format, and
+// an end-of-data marker. Rows in COPY text format escape backslashes, so the
+// marker can never appear as a row. Callers usually wrap the archive in gzip.
+var endOfData = []byte("\\.\n")
+
+// ErrInvalidDump is wrapped by errors about archives that cannot be read, as
+// opposed to failures of the database they are restored into
+var ErrInvalidDump = errors.New("invalid dump")
+
+// DumpHeader describes the contents of a dump archive
+type DumpHeader struct {
+	Format    string    `json:"format"`
+	Version   int       `json:"version"`
+	Database  string    `json:"database"`
+	CreatedAt time.Time `json:"created_at"`
+	Schema    *Schema   `json:"schema"`
+}
+
+// dumpSection introduces the data of one table
+type dumpSection struct {
+	Table string `json:"table"`
+}
+
+// DumpStats summarises a dump or restore
+type DumpStats struct {
+	Tables int
+	Rows   int64
+}
+
+// WriteDump writes the schema and data of the database conn is connected to as
+// an archive. Everything is read from a single snapshot, so the dump is consistent
+// even while the database is in use.
+func WriteDump(ctx context.Context, conn *pgx.Conn, dbName string, w io.Writer) (*DumpStats, error) {
+	tx, err := conn.BeginTx(ctx, pgx.TxOptions{IsoLevel: pgx.RepeatableRead, AccessMode: pgx.ReadOnly})
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	schema, err := ReadSchema(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	enc := json.NewEncoder(w)
+	header := DumpHeader{
+		Format:    DumpFormat,
+		Version:   DumpVersion,
+		Database:  dbName,
+		CreatedAt: time.Now().UTC(),
+		Schema:    schema,
+	}
+	if err := enc.Encode(header); err != nil {
+		return nil, fmt.Errorf("failed to write header: %w", err)
+	}
+
+	stats := &DumpStats{}
+	for _, t := range schema.Tables {
+		if t.Partitioned {
+			return nil, fmt.Errorf("partitioned table %s is not supported", t.QualifiedName())
+		}
+		if err := enc.Encode(dumpSection{Table: t.QualifiedName()}); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", t.QualifiedName(), err)
+		}
+		tag, err := conn.PgConn().CopyTo(ctx, w, fmt.Sprintf("COPY %s (%s) TO STDOUT", t.QualifiedName(), t.CopyColumns()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to dump %s: %w", t.QualifiedName(), err)
+		}
+		if _, err := w.Write(endOfData); err != nil {
+			return nil, fmt.Errorf("failed to write %s: %w", t.QualifiedName(), err)
+		}
+		stats.Tables++
+		stats.Rows += tag.RowsAffected()
+	}
+
+	return stats, nil
+}
+
+// ReadDumpHeader reads and validates the header of an archive
+func ReadDumpHeader(r *bufio.Reader) (*DumpHeader, error) {
+	line, err := r.ReadBytes('\n')
+	if err != nil {
+		return nil, fmt.Errorf("%w: failed to read header: %w", ErrInvalidDump, err)
+	}
+
+	var header DumpHeader
+	if err := json.Unmarshal(line, &header); err != nil || header.Format != DumpFormat {
+		return nil, fmt.Errorf("%w: not a pgmanager dump", ErrInvalidDump)
+	}
+	if header.Version != DumpVersion {
+		return nil, fmt.Errorf("%w: unsupported version %d", ErrInvalidDump, header.Version)
+	}
+	if header.Schema == nil {
+		return nil, fmt.Errorf("%w: no schema", ErrInvalidDump)
+	}
+
+	return &header, nil
+}
+
+// RestoreDump loads the archive described by header into the empty database conn
+// is connected to, reading table data from br, which must be positioned just after
+// the header. Objects are created as owner. The restore runs in a single
+// transaction, so a failure leaves the database empty.
+func RestoreDump(ctx context.Context, conn *pgx.Conn, owner string, header *DumpHeader, br *bufio.Reader) (*DumpStats, error) {
+	schema := header.Schema
+
+	tables := make(map[string]Table, len(schema.Tables))
+	for _, t := range schema.Tables {
+		tables[t.QualifiedName()] = t
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	for _, stmt := range schema.PreDataStatements(owner) {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("failed to execute %q: %w", truncateStatement(stmt), err)
+		}
+	}
+
+	stats := &DumpStats{}
+	for {
+		line, err := br.ReadBytes('\n')
+		if err == io.EOF && len(line) == 0 {
+			break
+		}
+		if err != nil {
+			return nil, fmt.Errorf("%w: failed to read: %w", ErrInvalidDump, err)
+		}
+
+		var section dumpSection
+		if err := json.Unmarshal(line, &section); err != nil {
+			return nil, fmt.Errorf("%w: expected table section", ErrInvalidDump)
+		}
+		t, ok := tables[section.Table]
+		if !ok {
+			return nil, fmt.Errorf("%w: table %s is not in the schema", ErrInvalidDump, section.Table)
+		}
+
+		data := &sectionReader{r: br}
+		tag, err := conn.PgConn().CopyFrom(ctx, data, fmt.Sprintf("COPY %s (%s) FROM STDIN", t.QualifiedName(), t.CopyColumns()))
+		if err != nil {
+			return nil, fmt.Errorf("failed to restore %s: %w", t.QualifiedName(), err)
+		}
+		if !data.done {
+			return nil, fmt.Errorf("%w: data for %s is truncated", ErrInvalidDump, t.QualifiedName())
+		}
+		stats.Tables++
+		stats.Rows += tag.RowsAffected()
+	}
+
+	post := append(schema.PostDataStatements(), schema.SequenceValueStatements()...)
+	for _, stmt := range post {
+		if _, err := tx.Exec(ctx, stmt); err != nil {
+			return nil, fmt.Errorf("failed to execute %q: %w", truncateStatement(stmt), err)
+		}
+	}
+
+	if err := tx.Commit(ctx); err != nil {
+		return nil, fmt.Errorf("failed to commit restore: %w", err)
+	}
+	return stats, nil
+}
+
+// sectionReader yields the COPY rows of one table section and stops at the
+// end-of-data marker
+type sectionReader struct {
+	r    *bufio.Reader
+	buf  []byte
+	done bool
+}
+
+func (s *sectionReader) Read(p []byte) (int, error) {
+	for len(s.buf) == 0 {
+		if s.done {
+			return 0, io.EOF
+		}
+		line, err := s.r.ReadBytes('\n')
+		if err != nil {
+			if err == io.EOF {
+				// Truncated archive; the caller reports it since done is unset
+				return 0, io.EOF
+			}
+			return 0, err
+		}
+		if bytes.Equal(line, endOfData) {
+			s.done = true
+			return 0, io.EOF
+		}
+		s.buf = line
+	}
+
+	n := copy(p, s.buf)
+	s.buf = s.buf[n:]
+	return n, nil
+}
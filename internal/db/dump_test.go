@@ -0,0 +1,63 @@
+package db
+
+import (
+	"bufio"
+	"errors"
+	"io"
+	"strings"
+	"testing"
+)
+
+func TestReadDumpHeader(t *testing.T) {
+	tests := []struct {
+		name    string
+		input   string
+		wantErr bool
+	}{
+		{"valid", `{"format":"pgmanager-dump","version":1,"database":"myapp_dev","schema":{}}` + "\n", false},
+		{"not json", "PGDMP\n", true},
+		{"wrong format", `{"format":"other","version":1,"schema":{}}` + "\n", true},
+		{"future version", `{"format":"pgmanager-dump","version":2,"schema":{}}` + "\n", true},
+		{"missing schema", `{"format":"pgmanager-dump","version":1}` + "\n", true},
+		{"empty", "", true},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			_, err := ReadDumpHeader(bufio.NewReader(strings.NewReader(tt.input)))
+			if (err != nil) != tt.wantErr || (err != nil && !errors.Is(err, ErrInvalidDump)) {
+				t.Errorf("ReadDumpHeader() error = %v, wantErr %v", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestSectionReader(t *testing.T) {
+	br := bufio.NewReader(strings.NewReader("1\tfoo\\\\.\n2\tbar\n\\.\n{\"table\":\"next\"}\n"))
+
+	s := &sectionReader{r: br}
+	data, err := io.ReadAll(s)
+	if err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if got, want := string(data), "1\tfoo\\\\.\n2\tbar\n"; got != want {
+		t.Errorf("section data = %q, want %q", got, want)
+	}
+	if !s.done {
+		t.Error("section should be marked done at the end-of-data marker")
+	}
+
+	// The reader must stop at the marker and leave the next section unread
+	rest, _ := br.ReadString('\n')
+	if rest != "{\"table\":\"next\"}\n" {
+		t.Errorf("next line = %q, want the following section header", rest)
+	}
+
+	truncated := &sectionReader{r: bufio.NewReader(strings.NewReader("1\tfoo\n"))}
+	if _, err := io.ReadAll(truncated); err != nil {
+		t.Fatalf("ReadAll() error = %v", err)
+	}
+	if truncated.done {
+		t.Error("section without end-of-data marker should not be marked done")
+	}
+}
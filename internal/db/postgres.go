@@ -6,6 +6,7 @@ import (
 	"encoding/hex"
 	"fmt"
 	"strings"
+	"time"
 
 	"github.com/jackc/pgx/v5"
 	"pgmanager/internal/config"
@@ -23,12 +24,31 @@ func NewPostgresClient(cfg *config.PostgresConfig) *PostgresClient {
 
 // connect establishes a connection to the PostgreSQL server
 func (c *PostgresClient) connect(ctx context.Context) (*pgx.Conn, error) {
+	return c.ConnectDatabase(ctx, c.cfg.Database)
+}
+
+// ApplicationName identifies pgmanager's administrative sessions in pg_stat_activity
+const ApplicationName = "pgmanager"
+
+// ConnectDatabase connects to dbName on the server using the administrative credentials
+func (c *PostgresClient) ConnectDatabase(ctx context.Context, dbName string) (*pgx.Conn, error) {
+	sslMode := c.cfg.SSLMode
+	if sslMode == "" {
+		sslMode = "require"
+	}
+	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s application_name=%s",
+		c.cfg.Host, c.cfg.Port, c.cfg.User, c.cfg.Password, dbName, sslMode, ApplicationName)
+	return pgx.Connect(ctx, connStr)
+}
+
+// ConnectAs connects to dbName on the server as the given user instead of the administrative user
+func (c *PostgresClient) ConnectAs(ctx context.Context, dbName, userName, password string) (*pgx.Conn, error) {
 	sslMode := c.cfg.SSLMode
 	if sslMode == "" {
 		sslMode = "require"
 	}
 	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		c.cfg.Host, c.cfg.Port, c.cfg.User, c.cfg.Password, c.cfg.Database, sslMode)
+		c.cfg.Host, c.cfg.Port, userName, password, dbName, sslMode)
 	return pgx.Connect(ctx, connStr)
 }
 
@@ -70,7 +90,53 @@ func (c *PostgresClient) CreateDatabase(ctx context.Context, dbName, userName, p
 	return nil
 }
 
-// DropDatabase drops a database and its associated user
+// EnsureRole creates a login role with the given password, or resets the
+// password if the role already exists
+func (c *PostgresClient) EnsureRole(ctx context.Context, userName, password string) error {
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	var exists bool
+	if err := conn.QueryRow(ctx, "SELECT EXISTS(SELECT 1 FROM pg_roles WHERE rolname = $1)", userName).Scan(&exists); err != nil {
+		return fmt.Errorf("failed to check role: %w", err)
+	}
+
+	verb := "CREATE"
+	if exists {
+		verb = "ALTER"
+	}
+	roleSQL := fmt.Sprintf("%s USER %s WITH PASSWORD %s", verb,
+		pgx.Identifier{userName}.Sanitize(),
+		quoteLiteral(password))
+	if _, err := conn.Exec(ctx, roleSQL); err != nil {
+		return fmt.Errorf("failed to %s user: %w", strings.ToLower(verb), err)
+	}
+
+	return nil
+}
+
+// SetConnectionLimit sets the per-database connection limit; -1 removes the limit.
+// Superusers are not affected, so pgmanager can still work on a locked database.
+func (c *PostgresClient) SetConnectionLimit(ctx context.Context, dbName string, limit int) error {
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	limitSQL := fmt.Sprintf("ALTER DATABASE %s CONNECTION LIMIT %d",
+		pgx.Identifier{dbName}.Sanitize(), limit)
+	if _, err := conn.Exec(ctx, limitSQL); err != nil {
+		return fmt.Errorf("failed to set connection limit: %w", err)
+	}
+
+	return nil
+}
+
+// DropDatabase drops a database, its associated user and its managed access roles
 func (c *PostgresClient) DropDatabase(ctx context.Context, dbName, userName string) error {
 	conn, err := c.connect(ctx)
 	if err != nil {
@@ -79,12 +145,7 @@ func (c *PostgresClient) DropDatabase(ctx context.Context, dbName, userName stri
 	defer conn.Close(ctx)
 
 	// Terminate existing connections to the database
-	terminateSQL := fmt.Sprintf(`
-		SELECT pg_terminate_backend(pid)
-		FROM pg_stat_activity
-		WHERE datname = %s AND pid <> pg_backend_pid()`,
-		quoteLiteral(dbName))
-	if _, err := conn.Exec(ctx, terminateSQL); err != nil {
+	if _, err := terminateBackends(ctx, conn, dbName, 0); err != nil {
 		// Ignore errors here, the database might not exist
 	}
 
@@ -102,9 +163,173 @@ func (c *PostgresClient) DropDatabase(ctx context.Context, dbName, userName stri
 		return fmt.Errorf("failed to drop user: %w", err)
 	}
 
+	// Drop the access roles declared for the database by a manifest
+	return dropManagedRoles(ctx, conn, dbName)
+}
+
+// Session describes a backend connected to a database
+type Session struct {
+	PID        int
+	User       string
+	ClientAddr string
+	State      string
+	QueryStart *time.Time
+	Query      string
+}
+
+// maxSessionQueryLength limits how much query text ListSessions returns per session
+const maxSessionQueryLength = 1024
+
+// RecreateDatabase drops a database and creates it again, empty, with the same owner.
+// The owner role is left untouched.
+func (c *PostgresClient) RecreateDatabase(ctx context.Context, dbName, owner string) error {
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	if _, err := terminateBackends(ctx, conn, dbName, 0); err != nil {
+		return fmt.Errorf("failed to terminate sessions: %w", err)
+	}
+
+	dropDBSQL := fmt.Sprintf("DROP DATABASE IF EXISTS %s", pgx.Identifier{dbName}.Sanitize())
+	if _, err := conn.Exec(ctx, dropDBSQL); err != nil {
+		return fmt.Errorf("failed to drop database: %w", err)
+	}
+
+	createDBSQL := fmt.Sprintf("CREATE DATABASE %s OWNER %s",
+		pgx.Identifier{dbName}.Sanitize(),
+		pgx.Identifier{owner}.Sanitize())
+	if _, err := conn.Exec(ctx, createDBSQL); err != nil {
+		return fmt.Errorf("failed to create database: %w", err)
+	}
+
+	grantSQL := fmt.Sprintf("GRANT ALL PRIVILEGES ON DATABASE %s TO %s",
+		pgx.Identifier{dbName}.Sanitize(),
+		pgx.Identifier{owner}.Sanitize())
+	if _, err := conn.Exec(ctx, grantSQL); err != nil {
+		return fmt.Errorf("failed to grant privileges: %w", err)
+	}
+
 	return nil
 }
 
+// DropSchemas drops every user schema in a database, along with everything in them,
+// and creates an empty public schema owned by owner. The database itself, its
+// settings and open sessions are kept.
+func (c *PostgresClient) DropSchemas(ctx context.Context, dbName, owner string) error {
+	conn, err := c.ConnectDatabase(ctx, dbName)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	rows, err := conn.Query(ctx, "SELECT n.nspname FROM pg_namespace n WHERE "+userObjects)
+	if err != nil {
+		return fmt.Errorf("failed to list schemas: %w", err)
+	}
+	schemas, err := pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return fmt.Errorf("failed to list schemas: %w", err)
+	}
+
+	stmts := make([]string, 0, len(schemas)+1)
+	for _, schema := range schemas {
+		stmts = append(stmts, fmt.Sprintf("DROP SCHEMA %s CASCADE", pgx.Identifier{schema}.Sanitize()))
+	}
+	stmts = append(stmts, fmt.Sprintf("CREATE SCHEMA public AUTHORIZATION %s", pgx.Identifier{owner}.Sanitize()))
+
+	return ApplyStatements(ctx, conn, stmts)
+}
+
+// RunSQL executes a script of one or more statements in a database as a single
+// transaction. When role is set the script runs as that role.
+func (c *PostgresClient) RunSQL(ctx context.Context, dbName, role, script string) error {
+	conn, err := c.ConnectDatabase(ctx, dbName)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to begin transaction: %w", err)
+	}
+	defer tx.Rollback(ctx)
+
+	if role != "" {
+		if _, err := tx.Exec(ctx, "SET LOCAL ROLE "+pgx.Identifier{role}.Sanitize()); err != nil {
+			return fmt.Errorf("failed to set role: %w", err)
+		}
+	}
+	// Without arguments the script is sent with the simple protocol, which allows several statements
+	if _, err := tx.Exec(ctx, script); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// ListSessions returns the client sessions connected to a database
+func (c *PostgresClient) ListSessions(ctx context.Context, dbName string) ([]Session, error) {
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	rows, err := conn.Query(ctx, `
+		SELECT pid, COALESCE(usename, ''), COALESCE(host(client_addr), ''), COALESCE(state, ''),
+		       query_start, left(COALESCE(query, ''), $2)
+		FROM pg_stat_activity
+		WHERE datname = $1 AND backend_type = 'client backend' AND pid <> pg_backend_pid()
+		ORDER BY backend_start`,
+		dbName, maxSessionQueryLength)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list sessions: %w", err)
+	}
+	defer rows.Close()
+
+	var sessions []Session
+	for rows.Next() {
+		var s Session
+		if err := rows.Scan(&s.PID, &s.User, &s.ClientAddr, &s.State, &s.QueryStart, &s.Query); err != nil {
+			return nil, fmt.Errorf("failed to scan session: %w", err)
+		}
+		sessions = append(sessions, s)
+	}
+
+	return sessions, rows.Err()
+}
+
+// TerminateSessions terminates the session with the given pid on a database,
+// or every session when pid is 0. It returns the number of sessions terminated.
+func (c *PostgresClient) TerminateSessions(ctx context.Context, dbName string, pid int) (int, error) {
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	n, err := terminateBackends(ctx, conn, dbName, pid)
+	if err != nil {
+		return 0, fmt.Errorf("failed to terminate sessions: %w", err)
+	}
+	return n, nil
+}
+
+// terminateBackends terminates backends connected to dbName, limited to pid when non-zero
+func terminateBackends(ctx context.Context, conn *pgx.Conn, dbName string, pid int) (int, error) {
+	var terminated int
+	err := conn.QueryRow(ctx, `
+		SELECT count(*) FILTER (WHERE pg_terminate_backend(pid))
+		FROM pg_stat_activity
+		WHERE datname = $1 AND pid <> pg_backend_pid() AND ($2 = 0 OR pid = $2)`,
+		dbName, pid).Scan(&terminated)
+	return terminated, err
+}
+
 // DatabaseExists checks if a database exists
 func (c *PostgresClient) DatabaseExists(ctx context.Context, dbName string) (bool, error) {
 	conn, err := c.connect(ctx)
@@ -151,15 +376,56 @@ func (c *PostgresClient) ListDatabases(ctx context.Context) ([]string, error) {
 	return databases, rows.Err()
 }
 
+// DatabaseActivity is a point-in-time usage sample for a single database
+type DatabaseActivity struct {
+	Connections int   // Client sessions currently connected, other than pgmanager's
+	Xacts       int64 // Committed plus rolled back transactions since the last stats reset
+}
+
+// ActivityStats samples pg_stat_activity and pg_stat_database for every non-template
+// database. Sessions of the administrative role and of pgmanager are not counted.
+func (c *PostgresClient) ActivityStats(ctx context.Context) (map[string]DatabaseActivity, error) {
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	rows, err := conn.Query(ctx, `
+		SELECT d.datname,
+		       COALESCE(a.connections, 0),
+		       COALESCE(s.xact_commit + s.xact_rollback, 0)
+		FROM pg_database d
+		LEFT JOIN pg_stat_database s ON s.datid = d.oid
+		LEFT JOIN (
+			SELECT datid, count(*) AS connections
+			FROM pg_stat_activity
+			WHERE backend_type = 'client backend' AND pid <> pg_backend_pid()
+			  AND usename <> current_user AND application_name <> $1
+			GROUP BY datid
+		) a ON a.datid = d.oid
+		WHERE d.datistemplate = false`, ApplicationName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to query activity: %w", err)
+	}
+	defer rows.Close()
+
+	stats := make(map[string]DatabaseActivity)
+	for rows.Next() {
+		var name string
+		var a DatabaseActivity
+		if err := rows.Scan(&name, &a.Connections, &a.Xacts); err != nil {
+			return nil, fmt.Errorf("failed to scan activity: %w", err)
+		}
+		stats[name] = a
+	}
+
+	return stats, rows.Err()
+}
+
 // TestConnection tests the connection to the database
 func (c *PostgresClient) TestConnection(ctx context.Context, dbName, userName, password string) error {
-	sslMode := c.cfg.SSLMode
-	if sslMode == "" {
-		sslMode = "require"
-	}
-	connStr := fmt.Sprintf("host=%s port=%d user=%s password=%s dbname=%s sslmode=%s",
-		c.cfg.Host, c.cfg.Port, userName, password, dbName, sslMode)
-	conn, err := pgx.Connect(ctx, connStr)
+	conn, err := c.ConnectAs(ctx, dbName, userName, password)
 	if err != nil {
 		return fmt.Errorf("failed to connect: %w", err)
 	}
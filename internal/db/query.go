@@ -0,0 +1,266 @@
+package db
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"math"
+	"strconv"
+	"strings"
+	"unicode"
+
+	"github.com/jackc/pgx/v5"
+	"github.com/jackc/pgx/v5/pgconn"
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+// QueryOptions control how an ad-hoc script is run
+type QueryOptions struct {
+	ReadOnly bool // Run the script in a read-only transaction
+	MaxRows  int  // Maximum number of rows returned across all statements, 0 for no limit
+}
+
+// QueryResult is the outcome of one statement of a script
+type QueryResult struct {
+	Command      string   `json:"command"`
+	Columns      []string `json:"columns,omitempty"`
+	Rows         [][]any  `json:"rows,omitempty"`
+	RowsAffected int64    `json:"rows_affected"`
+	Truncated    bool     `json:"truncated,omitempty"` // Rows beyond MaxRows were discarded
+}
+
+// Query runs a script of one or more statements on conn and returns the result of
+// each statement that completed. Values are returned as strings, except NULLs,
+// booleans, integers, floats and JSON, which keep their type.
+//
+// ReadOnly runs the whole script in a single read-only transaction, which is
+// rolled back afterwards. Scripts that could end that transaction or make it
+// writable are rejected with ErrReadOnlyScript before anything runs.
+func Query(ctx context.Context, conn *pgx.Conn, script string, opts QueryOptions) ([]QueryResult, error) {
+	if opts.ReadOnly {
+		if err := checkReadOnly(script); err != nil {
+			return nil, err
+		}
+		if _, err := conn.Exec(ctx, "BEGIN READ ONLY"); err != nil {
+			return nil, fmt.Errorf("failed to start read-only transaction: %w", err)
+		}
+		// A failed or canceled script leaves the transaction aborted or the connection closed
+		defer conn.Exec(context.WithoutCancel(ctx), "ROLLBACK")
+	}
+
+	// The simple protocol allows several statements and returns a result for each
+	mrr := conn.PgConn().Exec(ctx, script)
+	defer mrr.Close()
+
+	var results []QueryResult
+	returned := 0
+	for mrr.NextResult() {
+		rr := mrr.ResultReader()
+		fields := rr.FieldDescriptions()
+
+		var result QueryResult
+		if len(fields) > 0 {
+			result.Rows = [][]any{}
+			for _, f := range fields {
+				result.Columns = append(result.Columns, f.Name)
+			}
+		}
+		for rr.NextRow() {
+			if opts.MaxRows > 0 && returned >= opts.MaxRows {
+				result.Truncated = true
+				continue
+			}
+			values := rr.Values()
+			row := make([]any, len(values))
+			for i, v := range values {
+				row[i] = decodeValue(fields[i].DataTypeOID, v)
+			}
+			result.Rows = append(result.Rows, row)
+			returned++
+		}
+
+		tag, err := rr.Close()
+		if err != nil {
+			return results, err
+		}
+		result.Command = tag.String()
+		result.RowsAffected = tag.RowsAffected()
+		results = append(results, result)
+	}
+
+	if err := mrr.Close(); err != nil {
+		return results, err
+	}
+	return results, nil
+}
+
+// ErrReadOnlyScript is returned for read-only scripts with statements that
+// could end the read-only transaction or make it writable
+var ErrReadOnlyScript = errors.New("statement not allowed in read-only mode")
+
+// checkReadOnly rejects transaction control and statements that change
+// transaction_read_only. Anything else that tries to write fails in the
+// transaction itself, including functions, which cannot end a transaction
+// block started by the client.
+func checkReadOnly(script string) error {
+	for _, stmt := range splitStatements(script) {
+		words := strings.FieldsFunc(strings.ToUpper(stmt), func(r rune) bool {
+			return !unicode.IsLetter(r) && !unicode.IsDigit(r) && r != '_'
+		})
+		if len(words) == 0 {
+			continue
+		}
+
+		allowed := true
+		switch words[0] {
+		case "BEGIN", "START", "COMMIT", "END", "ROLLBACK", "ABORT", "SAVEPOINT", "RELEASE":
+			allowed = false
+		case "PREPARE":
+			allowed = len(words) < 2 || words[1] != "TRANSACTION"
+		case "SET", "RESET":
+			for _, w := range words[1:] {
+				if w == "TRANSACTION" || strings.Contains(w, "READ_ONLY") {
+					allowed = false
+				}
+			}
+		}
+		if !allowed {
+			return fmt.Errorf("%w: %s", ErrReadOnlyScript, strings.Join(words[:min(len(words), 3)], " "))
+		}
+	}
+	return nil
+}
+
+// splitStatements splits a script into its statements. String literals are
+// blanked out and comments dropped, so only keywords and identifiers remain
+// to be inspected; quoted identifiers keep their text.
+func splitStatements(script string) []string {
+	var statements []string
+	var stmt strings.Builder
+	for i := 0; i < len(script); i++ {
+		c := script[i]
+		switch {
+		case c == ';':
+			statements = append(statements, stmt.String())
+			stmt.Reset()
+		case c == '-' && strings.HasPrefix(script[i:], "--"):
+			end := strings.IndexByte(script[i:], '\n')
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += end
+			}
+			stmt.WriteByte(' ')
+		case c == '/' && strings.HasPrefix(script[i:], "/*"):
+			// Block comments nest
+			depth := 0
+			for ; i < len(script); i++ {
+				if strings.HasPrefix(script[i:], "/*") {
+					depth++
+					i++
+				} else if strings.HasPrefix(script[i:], "*/") {
+					depth--
+					i++
+					if depth == 0 {
+						break
+					}
+				}
+			}
+			stmt.WriteByte(' ')
+		case c == '\'':
+			// E'...' strings may escape quotes with a backslash
+			escapes := i > 0 && (script[i-1] == 'E' || script[i-1] == 'e') && (i == 1 || !isIdentChar(script[i-2]))
+			for i++; i < len(script); i++ {
+				if escapes && script[i] == '\\' {
+					i++
+				} else if script[i] == '\'' {
+					if i+1 < len(script) && script[i+1] == '\'' {
+						i++
+						continue
+					}
+					break
+				}
+			}
+			stmt.WriteString(" '' ")
+		case c == '"':
+			end := strings.IndexByte(script[i+1:], '"')
+			if end < 0 {
+				end = len(script) - i - 1
+			}
+			// Doubled quotes inside the identifier leave harmless gaps
+			stmt.WriteString(" " + script[i+1:i+1+end] + " ")
+			i += end + 1
+		case c == '$':
+			tag, ok := dollarTag(script[i:])
+			if !ok || (i > 0 && isIdentChar(script[i-1])) {
+				stmt.WriteByte(c)
+				continue
+			}
+			end := strings.Index(script[i+len(tag):], tag)
+			if end < 0 {
+				i = len(script)
+			} else {
+				i += len(tag) + end + len(tag) - 1
+			}
+			stmt.WriteString(" '' ")
+		default:
+			stmt.WriteByte(c)
+		}
+	}
+	return append(statements, stmt.String())
+}
+
+// dollarTag returns the opening tag of a dollar-quoted string at the start of s,
+// such as $$ or $body$
+func dollarTag(s string) (string, bool) {
+	for i := 1; i < len(s); i++ {
+		c := s[i]
+		switch {
+		case c == '$':
+			return s[:i+1], true
+		case isIdentChar(c) && (i > 1 || c < '0' || c > '9'):
+		default:
+			return "", false
+		}
+	}
+	return "", false
+}
+
+// isIdentChar reports whether c may be part of an unquoted identifier
+func isIdentChar(c byte) bool {
+	return c == '_' || c == '$' || c >= 0x80 || ('a' <= c && c <= 'z') || ('A' <= c && c <= 'Z') || ('0' <= c && c <= '9')
+}
+
+// decodeValue converts a value in text format to a Go value suitable for JSON
+func decodeValue(oid uint32, v []byte) any {
+	if v == nil {
+		return nil
+	}
+	s := string(v)
+	switch oid {
+	case pgtype.BoolOID:
+		return s == "t"
+	case pgtype.Int2OID, pgtype.Int4OID, pgtype.Int8OID:
+		if n, err := strconv.ParseInt(s, 10, 64); err == nil {
+			return n
+		}
+	case pgtype.Float4OID, pgtype.Float8OID:
+		// NaN and infinities have no JSON representation
+		if f, err := strconv.ParseFloat(s, 64); err == nil && !math.IsNaN(f) && !math.IsInf(f, 0) {
+			return f
+		}
+	case pgtype.JSONOID, pgtype.JSONBOID:
+		if json.Valid(v) {
+			return json.RawMessage(s)
+		}
+	}
+	return s
+}
+
+// IsQueryError reports whether err was raised by the server while running a statement,
+// as opposed to a connection or protocol failure
+func IsQueryError(err error) bool {
+	var pgErr *pgconn.PgError
+	return errors.As(err, &pgErr)
+}
@@ -0,0 +1,82 @@
+package db
+
+import (
+	"encoding/json"
+	"errors"
+	"testing"
+
+	"github.com/jackc/pgx/v5/pgtype"
+)
+
+func TestDecodeValue(t *testing.T) {
+	tests := []struct {
+		oid  uint32
+		in   []byte
+		want string // JSON encoding of the decoded value
+	}{
+		{pgtype.TextOID, nil, `null`},
+		{pgtype.BoolOID, []byte("t"), `true`},
+		{pgtype.Int8OID, []byte("42"), `42`},
+		{pgtype.Float8OID, []byte("1.5"), `1.5`},
+		{pgtype.Float8OID, []byte("NaN"), `"NaN"`},
+		{pgtype.NumericOID, []byte("12.30"), `"12.30"`},
+		{pgtype.JSONBOID, []byte(`{"a": [1]}`), `{"a":[1]}`},
+		{pgtype.TimestamptzOID, []byte("2024-01-02 03:04:05+00"), `"2024-01-02 03:04:05+00"`},
+	}
+
+	for _, tt := range tests {
+		got, err := json.Marshal(decodeValue(tt.oid, tt.in))
+		if err != nil {
+			t.Errorf("decodeValue(%d, %q) is not encodable: %v", tt.oid, tt.in, err)
+			continue
+		}
+		if string(got) != tt.want {
+			t.Errorf("decodeValue(%d, %q) = %s, want %s", tt.oid, tt.in, got, tt.want)
+		}
+	}
+}
+
+func TestCheckReadOnly(t *testing.T) {
+	tests := []struct {
+		script string
+		ok     bool
+	}{
+		{"SELECT 1", true},
+		{"SELECT 1; SELECT 2;", true},
+		{"SELECT 'commit; begin'", true},
+		{"SELECT E'it\\'s; COMMIT'", true},
+		{"SELECT $$; COMMIT; $$, $tag$ ; END $tag$", true},
+		{"SELECT 1 -- ; COMMIT\n", true},
+		{"/* ; COMMIT /* nested */ ; COMMIT */ SELECT 1", true},
+		{"SET search_path = 'read_only'", true},
+		{"SET statement_timeout = 1000; SHOW transaction_read_only", true},
+		{"PREPARE q AS SELECT $1", true},
+		{"COMMIT", false},
+		{"SELECT 1; commit; DELETE FROM t", false},
+		{"SELECT 1;\nEND", false},
+		{"begin transaction read write", false},
+		{"START TRANSACTION", false},
+		{"ROLLBACK", false},
+		{"ABORT", false},
+		{"SAVEPOINT s", false},
+		{"PREPARE TRANSACTION 'x'", false},
+		{"SET transaction_read_only = off", false},
+		{`SET LOCAL "transaction_read_only" TO off`, false},
+		{"SET default_transaction_read_only = off", false},
+		{"SET TRANSACTION READ WRITE", false},
+		{"SET SESSION CHARACTERISTICS AS TRANSACTION READ WRITE", false},
+		{"RESET transaction_read_only", false},
+		{"/* hidden */ COMMIT", false},
+		{"SELECT 'it''s'; COMMIT", false},
+	}
+
+	for _, tt := range tests {
+		err := checkReadOnly(tt.script)
+		if tt.ok && err != nil {
+			t.Errorf("checkReadOnly(%q) = %v, want nil", tt.script, err)
+		}
+		if !tt.ok && !errors.Is(err, ErrReadOnlyScript) {
+			t.Errorf("checkReadOnly(%q) = %v, want ErrReadOnlyScript", tt.script, err)
+		}
+	}
+}
@@ -0,0 +1,585 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Schema is the set of user-defined objects in a database, read from the system catalogs
+type Schema struct {
+	Namespaces  []string     `json:"namespaces"`
+	Extensions  []Extension  `json:"extensions"`
+	Enums       []Enum       `json:"enums"`
+	Sequences   []Sequence   `json:"sequences"`
+	Tables      []Table      `json:"tables"`
+	Functions   []Function   `json:"functions"`
+	Views       []View       `json:"views"`
+	Constraints []Constraint `json:"constraints"`
+	Indexes     []Index      `json:"indexes"`
+	Triggers    []Trigger    `json:"triggers"`
+}
+
+// Extension is an installed extension
+type Extension struct {
+	Name    string `json:"name"`
+	Schema  string `json:"schema"`
+	Version string `json:"version"`
+}
+
+// Enum is an enum type and its labels in sort order
+type Enum struct {
+	Schema string   `json:"schema"`
+	Name   string   `json:"name"`
+	Labels []string `json:"labels"`
+}
+
+// Sequence is a sequence and the column that owns it, if any
+type Sequence struct {
+	Schema      string `json:"schema"`
+	Name        string `json:"name"`
+	DataType    string `json:"data_type"`
+	Start       int64  `json:"start"`
+	Increment   int64  `json:"increment"`
+	Min         int64  `json:"min"`
+	Max         int64  `json:"max"`
+	Cache       int64  `json:"cache"`
+	Cycle       bool   `json:"cycle"`
+	LastValue   *int64 `json:"last_value,omitempty"` // nil if nextval was never called
+	Identity    bool   `json:"identity"`             // Backs an identity column and is created with the table
+	OwnerTable  string `json:"owner_table,omitempty"`
+	OwnerSchema string `json:"owner_schema,omitempty"`
+	OwnerColumn string `json:"owner_column,omitempty"`
+}
+
+// Table is a table and its columns in attribute order
+type Table struct {
+	Schema      string   `json:"schema"`
+	Name        string   `json:"name"`
+	Partitioned bool     `json:"partitioned"` // Partitioned table or partition, not supported for copying
+	Columns     []Column `json:"columns"`
+}
+
+// Column is a table column
+type Column struct {
+	Name      string `json:"name"`
+	Type      string `json:"type"`
+	NotNull   bool   `json:"not_null"`
+	Default   string `json:"default,omitempty"`
+	Identity  string `json:"identity,omitempty"`  // "a" (always), "d" (by default) or empty
+	Generated string `json:"generated,omitempty"` // Expression of a stored generated column
+}
+
+// Function is a function or procedure
+type Function struct {
+	Schema     string `json:"schema"`
+	Name       string `json:"name"`
+	Arguments  string `json:"arguments"`
+	Definition string `json:"definition"`
+}
+
+// View is a view or materialized view
+type View struct {
+	Schema       string `json:"schema"`
+	Name         string `json:"name"`
+	Materialized bool   `json:"materialized"`
+	Definition   string `json:"definition"`
+}
+
+// Constraint is a table constraint other than NOT NULL
+type Constraint struct {
+	Schema     string `json:"schema"`
+	Table      string `json:"table"`
+	Name       string `json:"name"`
+	Type       string `json:"type"` // p (primary key), u (unique), c (check), f (foreign key), x (exclusion)
+	Definition string `json:"definition"`
+}
+
+// Index is an index that does not back a constraint
+type Index struct {
+	Schema     string `json:"schema"`
+	Table      string `json:"table"`
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+}
+
+// Trigger is a user-defined trigger
+type Trigger struct {
+	Schema     string `json:"schema"`
+	Table      string `json:"table"`
+	Name       string `json:"name"`
+	Definition string `json:"definition"`
+}
+
+// QualifiedName returns the quoted schema-qualified table name
+func (t Table) QualifiedName() string {
+	return pgx.Identifier{t.Schema, t.Name}.Sanitize()
+}
+
+// CopyColumns returns the quoted column list used for COPY, which excludes generated columns
+func (t Table) CopyColumns() string {
+	var cols []string
+	for _, c := range t.Columns {
+		if c.Generated == "" {
+			cols = append(cols, pgx.Identifier{c.Name}.Sanitize())
+		}
+	}
+	return strings.Join(cols, ", ")
+}
+
+// userObjects restricts a catalog query to objects outside the system schemas
+const userObjects = `n.nspname NOT IN ('pg_catalog', 'information_schema') AND n.nspname !~ '^pg_'`
+
+// notExtensionMember excludes objects that were created by an extension
+func notExtensionMember(catalog, oidExpr string) string {
+	return fmt.Sprintf(`NOT EXISTS (SELECT 1 FROM pg_depend e WHERE e.classid = '%s'::regclass AND e.objid = %s AND e.deptype = 'e')`,
+		catalog, oidExpr)
+}
+
+// ReadSchema reads the user-defined objects of the database conn is connected to
+func ReadSchema(ctx context.Context, conn *pgx.Conn) (*Schema, error) {
+	s := &Schema{}
+
+	steps := []struct {
+		name string
+		read func(context.Context, *pgx.Conn) error
+	}{
+		{"namespaces", s.readNamespaces},
+		{"extensions", s.readExtensions},
+		{"enums", s.readEnums},
+		{"sequences", s.readSequences},
+		{"tables", s.readTables},
+		{"functions", s.readFunctions},
+		{"views", s.readViews},
+		{"constraints", s.readConstraints},
+		{"indexes", s.readIndexes},
+		{"triggers", s.readTriggers},
+	}
+	for _, step := range steps {
+		if err := step.read(ctx, conn); err != nil {
+			return nil, fmt.Errorf("failed to read %s: %w", step.name, err)
+		}
+	}
+
+	return s, nil
+}
+
+func (s *Schema) readNamespaces(ctx context.Context, conn *pgx.Conn) error {
+	rows, err := conn.Query(ctx, `
+		SELECT n.nspname FROM pg_namespace n
+		WHERE `+userObjects+` AND `+notExtensionMember("pg_namespace", "n.oid")+`
+		ORDER BY 1`)
+	if err != nil {
+		return err
+	}
+	s.Namespaces, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	return err
+}
+
+func (s *Schema) readExtensions(ctx context.Context, conn *pgx.Conn) error {
+	rows, err := conn.Query(ctx, `
+		SELECT x.extname, n.nspname, x.extversion
+		FROM pg_extension x JOIN pg_namespace n ON n.oid = x.extnamespace
+		WHERE x.extname <> 'plpgsql'
+		ORDER BY 1`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var x Extension
+		if err := rows.Scan(&x.Name, &x.Schema, &x.Version); err != nil {
+			return err
+		}
+		s.Extensions = append(s.Extensions, x)
+	}
+	return rows.Err()
+}
+
+func (s *Schema) readEnums(ctx context.Context, conn *pgx.Conn) error {
+	rows, err := conn.Query(ctx, `
+		SELECT n.nspname, t.typname, array_agg(l.enumlabel::text ORDER BY l.enumsortorder)
+		FROM pg_type t
+		JOIN pg_namespace n ON n.oid = t.typnamespace
+		JOIN pg_enum l ON l.enumtypid = t.oid
+		WHERE `+userObjects+` AND `+notExtensionMember("pg_type", "t.oid")+`
+		GROUP BY n.nspname, t.typname
+		ORDER BY 1, 2`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var e Enum
+		if err := rows.Scan(&e.Schema, &e.Name, &e.Labels); err != nil {
+			return err
+		}
+		s.Enums = append(s.Enums, e)
+	}
+	return rows.Err()
+}
+
+func (s *Schema) readSequences(ctx context.Context, conn *pgx.Conn) error {
+	rows, err := conn.Query(ctx, `
+		SELECT n.nspname, c.relname, format_type(sq.seqtypid, NULL),
+		       sq.seqstart, sq.seqincrement, sq.seqmin, sq.seqmax, sq.seqcache, sq.seqcycle,
+		       pg_sequence_last_value(c.oid), COALESCE(d.deptype = 'i', false),
+		       COALESCE(tn.nspname, ''), COALESCE(t.relname, ''), COALESCE(a.attname, '')
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_sequence sq ON sq.seqrelid = c.oid
+		LEFT JOIN pg_depend d ON d.classid = 'pg_class'::regclass AND d.objid = c.oid
+		     AND d.refclassid = 'pg_class'::regclass AND d.deptype IN ('a', 'i')
+		LEFT JOIN pg_class t ON t.oid = d.refobjid
+		LEFT JOIN pg_namespace tn ON tn.oid = t.relnamespace
+		LEFT JOIN pg_attribute a ON a.attrelid = d.refobjid AND a.attnum = d.refobjsubid
+		WHERE c.relkind = 'S' AND `+userObjects+` AND `+notExtensionMember("pg_class", "c.oid")+`
+		ORDER BY 1, 2`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var q Sequence
+		if err := rows.Scan(&q.Schema, &q.Name, &q.DataType, &q.Start, &q.Increment, &q.Min, &q.Max, &q.Cache, &q.Cycle,
+			&q.LastValue, &q.Identity, &q.OwnerSchema, &q.OwnerTable, &q.OwnerColumn); err != nil {
+			return err
+		}
+		s.Sequences = append(s.Sequences, q)
+	}
+	return rows.Err()
+}
+
+func (s *Schema) readTables(ctx context.Context, conn *pgx.Conn) error {
+	rows, err := conn.Query(ctx, `
+		SELECT n.nspname, c.relname, c.relkind = 'p' OR c.relispartition,
+		       a.attname, format_type(a.atttypid, a.atttypmod), a.attnotnull,
+		       COALESCE(pg_get_expr(ad.adbin, ad.adrelid), ''), a.attidentity::text, a.attgenerated::text
+		FROM pg_class c
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		JOIN pg_attribute a ON a.attrelid = c.oid AND a.attnum > 0 AND NOT a.attisdropped
+		LEFT JOIN pg_attrdef ad ON ad.adrelid = a.attrelid AND ad.adnum = a.attnum
+		WHERE c.relkind IN ('r', 'p') AND `+userObjects+` AND `+notExtensionMember("pg_class", "c.oid")+`
+		ORDER BY n.nspname, c.relname, a.attnum`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var schema, name, def, generated string
+		var partitioned bool
+		var col Column
+		if err := rows.Scan(&schema, &name, &partitioned, &col.Name, &col.Type, &col.NotNull, &def, &col.Identity, &generated); err != nil {
+			return err
+		}
+		if generated != "" {
+			col.Generated = def
+		} else {
+			col.Default = def
+		}
+
+		if n := len(s.Tables); n == 0 || s.Tables[n-1].Schema != schema || s.Tables[n-1].Name != name {
+			s.Tables = append(s.Tables, Table{Schema: schema, Name: name, Partitioned: partitioned})
+		}
+		t := &s.Tables[len(s.Tables)-1]
+		t.Columns = append(t.Columns, col)
+	}
+	return rows.Err()
+}
+
+func (s *Schema) readFunctions(ctx context.Context, conn *pgx.Conn) error {
+	rows, err := conn.Query(ctx, `
+		SELECT n.nspname, p.proname, pg_get_function_identity_arguments(p.oid), pg_get_functiondef(p.oid)
+		FROM pg_proc p JOIN pg_namespace n ON n.oid = p.pronamespace
+		WHERE p.prokind IN ('f', 'p') AND `+userObjects+` AND `+notExtensionMember("pg_proc", "p.oid")+`
+		ORDER BY 1, 2, 3`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var f Function
+		if err := rows.Scan(&f.Schema, &f.Name, &f.Arguments, &f.Definition); err != nil {
+			return err
+		}
+		s.Functions = append(s.Functions, f)
+	}
+	return rows.Err()
+}
+
+func (s *Schema) readViews(ctx context.Context, conn *pgx.Conn) error {
+	// Ordering by oid creates views after the views they were defined on
+	rows, err := conn.Query(ctx, `
+		SELECT n.nspname, c.relname, c.relkind = 'm', pg_get_viewdef(c.oid)
+		FROM pg_class c JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE c.relkind IN ('v', 'm') AND `+userObjects+` AND `+notExtensionMember("pg_class", "c.oid")+`
+		ORDER BY c.oid`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var v View
+		if err := rows.Scan(&v.Schema, &v.Name, &v.Materialized, &v.Definition); err != nil {
+			return err
+		}
+		v.Definition = strings.TrimSuffix(strings.TrimSpace(v.Definition), ";")
+		s.Views = append(s.Views, v)
+	}
+	return rows.Err()
+}
+
+func (s *Schema) readConstraints(ctx context.Context, conn *pgx.Conn) error {
+	rows, err := conn.Query(ctx, `
+		SELECT n.nspname, t.relname, con.conname, con.contype::text, pg_get_constraintdef(con.oid)
+		FROM pg_constraint con
+		JOIN pg_class t ON t.oid = con.conrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE con.contype IN ('p', 'u', 'c', 'f', 'x') AND con.conislocal AND t.relkind IN ('r', 'p')
+		  AND `+userObjects+` AND `+notExtensionMember("pg_class", "t.oid")+`
+		ORDER BY 1, 2, 3`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var c Constraint
+		if err := rows.Scan(&c.Schema, &c.Table, &c.Name, &c.Type, &c.Definition); err != nil {
+			return err
+		}
+		s.Constraints = append(s.Constraints, c)
+	}
+	return rows.Err()
+}
+
+func (s *Schema) readIndexes(ctx context.Context, conn *pgx.Conn) error {
+	// Indexes backing primary key, unique and exclusion constraints are created with the constraint
+	rows, err := conn.Query(ctx, `
+		SELECT n.nspname, t.relname, i.relname, pg_get_indexdef(x.indexrelid)
+		FROM pg_index x
+		JOIN pg_class i ON i.oid = x.indexrelid
+		JOIN pg_class t ON t.oid = x.indrelid
+		JOIN pg_namespace n ON n.oid = t.relnamespace
+		WHERE t.relkind IN ('r', 'p', 'm') AND `+userObjects+` AND `+notExtensionMember("pg_class", "t.oid")+`
+		  AND NOT EXISTS (
+			SELECT 1 FROM pg_constraint con
+			WHERE con.conindid = x.indexrelid AND con.conrelid = x.indrelid AND con.contype IN ('p', 'u', 'x'))
+		ORDER BY 1, 2, 3`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var idx Index
+		if err := rows.Scan(&idx.Schema, &idx.Table, &idx.Name, &idx.Definition); err != nil {
+			return err
+		}
+		s.Indexes = append(s.Indexes, idx)
+	}
+	return rows.Err()
+}
+
+func (s *Schema) readTriggers(ctx context.Context, conn *pgx.Conn) error {
+	rows, err := conn.Query(ctx, `
+		SELECT n.nspname, c.relname, t.tgname, pg_get_triggerdef(t.oid)
+		FROM pg_trigger t
+		JOIN pg_class c ON c.oid = t.tgrelid
+		JOIN pg_namespace n ON n.oid = c.relnamespace
+		WHERE NOT t.tgisinternal AND `+userObjects+` AND `+notExtensionMember("pg_class", "c.oid")+`
+		ORDER BY 1, 2, 3`)
+	if err != nil {
+		return err
+	}
+	defer rows.Close()
+
+	for rows.Next() {
+		var tg Trigger
+		if err := rows.Scan(&tg.Schema, &tg.Table, &tg.Name, &tg.Definition); err != nil {
+			return err
+		}
+		s.Triggers = append(s.Triggers, tg)
+	}
+	return rows.Err()
+}
+
+// PreDataStatements returns the DDL that creates the schema objects needed before table data is loaded.
+// When owner is set, objects are created as that role so it owns them; extensions are always created
+// by the connected user, since they usually require superuser. The statements leave the session role
+// set to owner. Column defaults are set after functions are created, since they may call them.
+func (s *Schema) PreDataStatements(owner string) []string {
+	stmts := []string{"SET check_function_bodies = false"}
+	setRole := func() {
+		if owner != "" {
+			stmts = append(stmts, "SET ROLE "+pgx.Identifier{owner}.Sanitize())
+		}
+	}
+
+	setRole()
+	for _, ns := range s.Namespaces {
+		stmts = append(stmts, fmt.Sprintf("CREATE SCHEMA IF NOT EXISTS %s", pgx.Identifier{ns}.Sanitize()))
+	}
+	if owner != "" {
+		stmts = append(stmts, "RESET ROLE")
+	}
+	for _, x := range s.Extensions {
+		stmts = append(stmts, fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s WITH SCHEMA %s",
+			pgx.Identifier{x.Name}.Sanitize(), pgx.Identifier{x.Schema}.Sanitize()))
+	}
+	setRole()
+	for _, e := range s.Enums {
+		stmts = append(stmts, createEnumSQL(e))
+	}
+	for _, q := range s.Sequences {
+		if !q.Identity {
+			stmts = append(stmts, createSequenceSQL(q))
+		}
+	}
+	for _, t := range s.Tables {
+		stmts = append(stmts, createTableSQL(t))
+	}
+	for _, q := range s.Sequences {
+		if q.Identity || q.OwnerTable == "" {
+			continue
+		}
+		stmts = append(stmts, fmt.Sprintf("ALTER SEQUENCE %s OWNED BY %s",
+			pgx.Identifier{q.Schema, q.Name}.Sanitize(), pgx.Identifier{q.OwnerSchema, q.OwnerTable, q.OwnerColumn}.Sanitize()))
+	}
+	for _, f := range s.Functions {
+		stmts = append(stmts, f.Definition)
+	}
+	for _, t := range s.Tables {
+		for _, c := range t.Columns {
+			if c.Default != "" {
+				stmts = append(stmts, fmt.Sprintf("ALTER TABLE ONLY %s ALTER COLUMN %s SET DEFAULT %s",
+					t.QualifiedName(), pgx.Identifier{c.Name}.Sanitize(), c.Default))
+			}
+		}
+	}
+	for _, v := range s.Views {
+		if v.Materialized {
+			// Refreshed by PostDataStatements once the data is loaded
+			stmts = append(stmts, createViewSQL(v)+" WITH NO DATA")
+		} else {
+			stmts = append(stmts, createViewSQL(v))
+		}
+	}
+
+	return stmts
+}
+
+// PostDataStatements returns the DDL run after table data is loaded: constraints,
+// indexes, triggers and materialized view refreshes. Foreign keys come last so
+// the unique constraints they reference already exist.
+func (s *Schema) PostDataStatements() []string {
+	var stmts []string
+
+	addConstraint := func(c Constraint) {
+		stmts = append(stmts, fmt.Sprintf("ALTER TABLE ONLY %s ADD CONSTRAINT %s %s",
+			pgx.Identifier{c.Schema, c.Table}.Sanitize(), pgx.Identifier{c.Name}.Sanitize(), c.Definition))
+	}
+	for _, c := range s.Constraints {
+		if c.Type != "f" {
+			addConstraint(c)
+		}
+	}
+	for _, idx := range s.Indexes {
+		stmts = append(stmts, idx.Definition)
+	}
+	for _, c := range s.Constraints {
+		if c.Type == "f" {
+			addConstraint(c)
+		}
+	}
+	for _, tg := range s.Triggers {
+		stmts = append(stmts, tg.Definition)
+	}
+	for _, v := range s.Views {
+		if v.Materialized {
+			stmts = append(stmts, fmt.Sprintf("REFRESH MATERIALIZED VIEW %s", pgx.Identifier{v.Schema, v.Name}.Sanitize()))
+		}
+	}
+
+	return stmts
+}
+
+// SequenceValueStatements returns statements restoring each sequence's current value
+func (s *Schema) SequenceValueStatements() []string {
+	var stmts []string
+	for _, q := range s.Sequences {
+		if q.LastValue == nil {
+			continue
+		}
+		if q.Identity {
+			// Identity sequences are named by the server, so look them up through the column
+			stmts = append(stmts, fmt.Sprintf("SELECT setval(pg_get_serial_sequence(%s, %s), %d, true)",
+				quoteLiteral(pgx.Identifier{q.OwnerSchema, q.OwnerTable}.Sanitize()), quoteLiteral(q.OwnerColumn), *q.LastValue))
+			continue
+		}
+		stmts = append(stmts, fmt.Sprintf("SELECT setval(%s, %d, true)",
+			quoteLiteral(pgx.Identifier{q.Schema, q.Name}.Sanitize()), *q.LastValue))
+	}
+	return stmts
+}
+
+// createTableSQL renders CREATE TABLE for t without column defaults
+func createTableSQL(t Table) string {
+	cols := make([]string, len(t.Columns))
+	for i, c := range t.Columns {
+		cols[i] = columnSQL(c)
+	}
+	return fmt.Sprintf("CREATE TABLE %s (\n\t%s\n)", t.QualifiedName(), strings.Join(cols, ",\n\t"))
+}
+
+// columnSQL renders the definition of c without its default
+func columnSQL(c Column) string {
+	def := pgx.Identifier{c.Name}.Sanitize() + " " + c.Type
+	switch {
+	case c.Generated != "":
+		def += fmt.Sprintf(" GENERATED ALWAYS AS (%s) STORED", c.Generated)
+	case c.Identity == "a":
+		def += " GENERATED ALWAYS AS IDENTITY"
+	case c.Identity == "d":
+		def += " GENERATED BY DEFAULT AS IDENTITY"
+	}
+	if c.NotNull {
+		def += " NOT NULL"
+	}
+	return def
+}
+
+// createEnumSQL renders CREATE TYPE for e
+func createEnumSQL(e Enum) string {
+	labels := make([]string, len(e.Labels))
+	for i, l := range e.Labels {
+		labels[i] = quoteLiteral(l)
+	}
+	return fmt.Sprintf("CREATE TYPE %s AS ENUM (%s)", pgx.Identifier{e.Schema, e.Name}.Sanitize(), strings.Join(labels, ", "))
+}
+
+// createSequenceSQL renders CREATE SEQUENCE for q
+func createSequenceSQL(q Sequence) string {
+	cycle := "NO CYCLE"
+	if q.Cycle {
+		cycle = "CYCLE"
+	}
+	return fmt.Sprintf("CREATE SEQUENCE %s AS %s INCREMENT BY %d MINVALUE %d MAXVALUE %d START WITH %d CACHE %d %s",
+		pgx.Identifier{q.Schema, q.Name}.Sanitize(), q.DataType, q.Increment, q.Min, q.Max, q.Start, q.Cache, cycle)
+}
+
+// createViewSQL renders CREATE VIEW or CREATE MATERIALIZED VIEW for v
+func createViewSQL(v View) string {
+	if v.Materialized {
+		return fmt.Sprintf("CREATE MATERIALIZED VIEW %s AS %s", pgx.Identifier{v.Schema, v.Name}.Sanitize(), v.Definition)
+	}
+	return fmt.Sprintf("CREATE VIEW %s AS %s", pgx.Identifier{v.Schema, v.Name}.Sanitize(), v.Definition)
+}
@@ -0,0 +1,64 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestCreateTableSQL(t *testing.T) {
+	table := Table{
+		Schema: "public",
+		Name:   "orders",
+		Columns: []Column{
+			{Name: "id", Type: "bigint", NotNull: true, Identity: "a"},
+			{Name: "status", Type: "text", NotNull: true, Default: "'new'::text"},
+			{Name: "total", Type: "numeric(10,2)"},
+			{Name: "total_cents", Type: "bigint", Generated: "(total * (100)::numeric)"},
+		},
+	}
+
+	got := createTableSQL(table)
+	want := `CREATE TABLE "public"."orders" (
+	"id" bigint GENERATED ALWAYS AS IDENTITY NOT NULL,
+	"status" text NOT NULL,
+	"total" numeric(10,2),
+	"total_cents" bigint GENERATED ALWAYS AS ((total * (100)::numeric)) STORED
+)`
+	if got != want {
+		t.Errorf("createTableSQL() =\n%s\nwant\n%s", got, want)
+	}
+
+	if cols := table.CopyColumns(); cols != `"id", "status", "total"` {
+		t.Errorf("CopyColumns() = %s, want generated column excluded", cols)
+	}
+}
+
+func TestPreDataStatementsOrder(t *testing.T) {
+	schema := &Schema{
+		Namespaces: []string{"app"},
+		Extensions: []Extension{{Name: "pgcrypto", Schema: "public"}},
+		Tables:     []Table{{Schema: "app", Name: "users", Columns: []Column{{Name: "id", Type: "uuid", Default: "gen_random_uuid()"}}}},
+		Functions:  []Function{{Schema: "app", Name: "touch", Definition: "CREATE FUNCTION app.touch() ..."}},
+	}
+
+	stmts := schema.PreDataStatements("app_user")
+	index := func(prefix string) int {
+		for i, s := range stmts {
+			if strings.HasPrefix(s, prefix) {
+				return i
+			}
+		}
+		t.Fatalf("no statement starting with %q in %v", prefix, stmts)
+		return -1
+	}
+
+	if !(index("CREATE SCHEMA") < index("RESET ROLE") && index("RESET ROLE") < index("CREATE EXTENSION")) {
+		t.Errorf("extensions must be created without the owner role: %v", stmts)
+	}
+	if !(index("CREATE TABLE") < index("CREATE FUNCTION") && index("CREATE FUNCTION") < index("ALTER TABLE ONLY")) {
+		t.Errorf("defaults must be set after tables and functions exist: %v", stmts)
+	}
+	if last := stmts[len(stmts)-1]; strings.HasPrefix(last, "RESET ROLE") {
+		t.Errorf("statements should leave the owner role set, last = %q", last)
+	}
+}
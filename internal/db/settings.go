@@ -0,0 +1,232 @@
+package db
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// Access levels of the roles pgmanager manages for a database
+const (
+	AccessRead  = "read"
+	AccessWrite = "write"
+)
+
+// roleCommentPrefix marks the roles pgmanager manages. The full comment is
+// pgmanager:<database>:<access>.
+const roleCommentPrefix = "pgmanager:"
+
+// DatabaseSettings is the state of a database that manifests declare
+type DatabaseSettings struct {
+	ConnectionLimit  int               // -1 when unlimited
+	StatementTimeout string            // Empty when the server default applies
+	Extensions       []string          // Installed extensions other than plpgsql
+	Roles            map[string]string // Managed role name to access level
+}
+
+// DatabaseSettings reads the connection limit, statement timeout, extensions and
+// managed roles of a database
+func (c *PostgresClient) DatabaseSettings(ctx context.Context, dbName string) (*DatabaseSettings, error) {
+	conn, err := c.ConnectDatabase(ctx, dbName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	settings := &DatabaseSettings{}
+
+	var config []string
+	err = conn.QueryRow(ctx, `
+		SELECT d.datconnlimit, COALESCE(s.setconfig, '{}')
+		FROM pg_database d
+		LEFT JOIN pg_db_role_setting s ON s.setdatabase = d.oid AND s.setrole = 0
+		WHERE d.datname = $1`, dbName).Scan(&settings.ConnectionLimit, &config)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read database settings: %w", err)
+	}
+	for _, setting := range config {
+		if value, ok := strings.CutPrefix(setting, "statement_timeout="); ok {
+			settings.StatementTimeout = value
+		}
+	}
+
+	rows, err := conn.Query(ctx, "SELECT extname FROM pg_extension WHERE extname <> 'plpgsql' ORDER BY extname")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list extensions: %w", err)
+	}
+	settings.Extensions, err = pgx.CollectRows(rows, pgx.RowTo[string])
+	if err != nil {
+		return nil, fmt.Errorf("failed to list extensions: %w", err)
+	}
+
+	settings.Roles, err = managedRoles(ctx, conn, dbName)
+	if err != nil {
+		return nil, err
+	}
+
+	return settings, nil
+}
+
+// managedRoles returns the roles pgmanager manages for a database and their access level
+func managedRoles(ctx context.Context, conn *pgx.Conn, dbName string) (map[string]string, error) {
+	prefix := roleCommentPrefix + dbName + ":"
+	rows, err := conn.Query(ctx, `
+		SELECT rolname, shobj_description(oid, 'pg_authid')
+		FROM pg_roles
+		WHERE starts_with(shobj_description(oid, 'pg_authid'), $1)`, prefix)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list roles: %w", err)
+	}
+	defer rows.Close()
+
+	roles := make(map[string]string)
+	for rows.Next() {
+		var name, comment string
+		if err := rows.Scan(&name, &comment); err != nil {
+			return nil, fmt.Errorf("failed to scan role: %w", err)
+		}
+		roles[name] = strings.TrimPrefix(comment, prefix)
+	}
+	return roles, rows.Err()
+}
+
+// SetStatementTimeout sets the default statement timeout of a database, such as
+// "30000ms". An empty timeout restores the server default.
+func (c *PostgresClient) SetStatementTimeout(ctx context.Context, dbName, timeout string) error {
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	timeoutSQL := fmt.Sprintf("ALTER DATABASE %s RESET statement_timeout", pgx.Identifier{dbName}.Sanitize())
+	if timeout != "" {
+		timeoutSQL = fmt.Sprintf("ALTER DATABASE %s SET statement_timeout = %s",
+			pgx.Identifier{dbName}.Sanitize(), quoteLiteral(timeout))
+	}
+	if _, err := conn.Exec(ctx, timeoutSQL); err != nil {
+		return fmt.Errorf("failed to set statement timeout: %w", err)
+	}
+
+	return nil
+}
+
+// CreateExtension installs an extension in a database
+func (c *PostgresClient) CreateExtension(ctx context.Context, dbName, extension string) error {
+	conn, err := c.ConnectDatabase(ctx, dbName)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	extensionSQL := fmt.Sprintf("CREATE EXTENSION IF NOT EXISTS %s", pgx.Identifier{extension}.Sanitize())
+	if _, err := conn.Exec(ctx, extensionSQL); err != nil {
+		return fmt.Errorf("failed to create extension %s: %w", extension, err)
+	}
+
+	return nil
+}
+
+// CreateAccessRole creates a login role with read or write access to the public
+// schema of a database, including tables the owner creates later
+func (c *PostgresClient) CreateAccessRole(ctx context.Context, dbName, owner, role, password, access string) error {
+	conn, err := c.connect(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	createSQL := fmt.Sprintf("CREATE USER %s WITH PASSWORD %s",
+		pgx.Identifier{role}.Sanitize(), quoteLiteral(password))
+	if _, err := conn.Exec(ctx, createSQL); err != nil {
+		return fmt.Errorf("failed to create role %s: %w", role, err)
+	}
+
+	return c.SetRoleAccess(ctx, dbName, owner, role, access)
+}
+
+// SetRoleAccess replaces the privileges of a managed role in a database with
+// those of the given access level. It also restores them after the database
+// was recreated.
+func (c *PostgresClient) SetRoleAccess(ctx context.Context, dbName, owner, role, access string) error {
+	stmts, err := accessStatements(dbName, owner, role, access)
+	if err != nil {
+		return err
+	}
+
+	conn, err := c.ConnectDatabase(ctx, dbName)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	return ApplyStatements(ctx, conn, stmts)
+}
+
+// DropAccessRole drops a managed role and everything it was granted in a database
+func (c *PostgresClient) DropAccessRole(ctx context.Context, dbName, owner, role string) error {
+	conn, err := c.ConnectDatabase(ctx, dbName)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	// Objects the role created are handed to the owner rather than dropped
+	if err := ApplyStatements(ctx, conn, []string{
+		fmt.Sprintf("REASSIGN OWNED BY %s TO %s", pgx.Identifier{role}.Sanitize(), pgx.Identifier{owner}.Sanitize()),
+		fmt.Sprintf("DROP OWNED BY %s", pgx.Identifier{role}.Sanitize()),
+		fmt.Sprintf("REVOKE ALL ON DATABASE %s FROM %s", pgx.Identifier{dbName}.Sanitize(), pgx.Identifier{role}.Sanitize()),
+		fmt.Sprintf("DROP ROLE %s", pgx.Identifier{role}.Sanitize()),
+	}); err != nil {
+		return fmt.Errorf("failed to drop role %s: %w", role, err)
+	}
+
+	return nil
+}
+
+// dropManagedRoles drops the roles pgmanager manages for a database that no
+// longer exists
+func dropManagedRoles(ctx context.Context, conn *pgx.Conn, dbName string) error {
+	roles, err := managedRoles(ctx, conn, dbName)
+	if err != nil {
+		return err
+	}
+	for role := range roles {
+		if _, err := conn.Exec(ctx, "DROP ROLE IF EXISTS "+pgx.Identifier{role}.Sanitize()); err != nil {
+			return fmt.Errorf("failed to drop role %s: %w", role, err)
+		}
+	}
+	return nil
+}
+
+// accessStatements returns the statements that reset a role's privileges on the
+// public schema and grant those of an access level. They run in the database.
+func accessStatements(dbName, owner, role, access string) ([]string, error) {
+	var tables, sequences string
+	switch access {
+	case AccessRead:
+		tables, sequences = "SELECT", "SELECT"
+	case AccessWrite:
+		tables, sequences = "SELECT, INSERT, UPDATE, DELETE", "USAGE, SELECT"
+	default:
+		return nil, fmt.Errorf("invalid access '%s', must be read or write", access)
+	}
+
+	r := pgx.Identifier{role}.Sanitize()
+	o := pgx.Identifier{owner}.Sanitize()
+	return []string{
+		fmt.Sprintf("GRANT CONNECT ON DATABASE %s TO %s", pgx.Identifier{dbName}.Sanitize(), r),
+		fmt.Sprintf("REVOKE ALL ON ALL TABLES IN SCHEMA public FROM %s", r),
+		fmt.Sprintf("REVOKE ALL ON ALL SEQUENCES IN SCHEMA public FROM %s", r),
+		fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA public REVOKE ALL ON TABLES FROM %s", o, r),
+		fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA public REVOKE ALL ON SEQUENCES FROM %s", o, r),
+		fmt.Sprintf("GRANT USAGE ON SCHEMA public TO %s", r),
+		fmt.Sprintf("GRANT %s ON ALL TABLES IN SCHEMA public TO %s", tables, r),
+		fmt.Sprintf("GRANT %s ON ALL SEQUENCES IN SCHEMA public TO %s", sequences, r),
+		fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA public GRANT %s ON TABLES TO %s", o, tables, r),
+		fmt.Sprintf("ALTER DEFAULT PRIVILEGES FOR ROLE %s IN SCHEMA public GRANT %s ON SEQUENCES TO %s", o, sequences, r),
+		fmt.Sprintf("COMMENT ON ROLE %s IS %s", r, quoteLiteral(roleCommentPrefix+dbName+":"+access)),
+	}, nil
+}
@@ -0,0 +1,40 @@
+package db
+
+import (
+	"strings"
+	"testing"
+)
+
+func TestAccessStatements(t *testing.T) {
+	stmts, err := accessStatements("myapp_prod", "myapp_prod_user", "myapp_prod_etl", AccessWrite)
+	if err != nil {
+		t.Fatalf("accessStatements() error = %v", err)
+	}
+	script := strings.Join(stmts, ";\n")
+
+	for _, want := range []string{
+		`GRANT SELECT, INSERT, UPDATE, DELETE ON ALL TABLES IN SCHEMA public TO "myapp_prod_etl"`,
+		`ALTER DEFAULT PRIVILEGES FOR ROLE "myapp_prod_user" IN SCHEMA public GRANT USAGE, SELECT ON SEQUENCES TO "myapp_prod_etl"`,
+		`COMMENT ON ROLE "myapp_prod_etl" IS 'pgmanager:myapp_prod:write'`,
+	} {
+		if !strings.Contains(script, want) {
+			t.Errorf("statements do not contain %q:\n%s", want, script)
+		}
+	}
+	// Privileges of the previous access level are revoked before granting
+	if !strings.HasPrefix(stmts[1], "REVOKE ALL ON ALL TABLES") {
+		t.Errorf("second statement = %q, want a revoke", stmts[1])
+	}
+
+	stmts, err = accessStatements("myapp_prod", "myapp_prod_user", "myapp_prod_analytics", AccessRead)
+	if err != nil {
+		t.Fatalf("accessStatements() error = %v", err)
+	}
+	if script := strings.Join(stmts, ";\n"); strings.Contains(script, "INSERT") {
+		t.Errorf("read access grants writes:\n%s", script)
+	}
+
+	if _, err := accessStatements("myapp_prod", "myapp_prod_user", "myapp_prod_x", "admin"); err == nil {
+		t.Error("accessStatements() with an invalid access level should fail")
+	}
+}
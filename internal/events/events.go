@@ -0,0 +1,129 @@
+// Package events is an in-process bus of lifecycle events with a bounded log,
+// so that subscribers that reconnect can resume where they left off.
+package events
+
+import (
+	"sync"
+	"time"
+)
+
+// Buffer is how many messages a subscriber may fall behind before it is
+// dropped. A dropped subscriber resumes from the log when it subscribes again.
+const Buffer = 64
+
+// Message is a published event. IDs increase by one from the time the process
+// started in microseconds, so IDs of a restarted process are higher than those
+// of the one before, unless that published more than a million a second.
+type Message struct {
+	ID      int64
+	Event   string
+	Project string // Project the event is about, for filtering; "" for none
+	Data    []byte // JSON payload
+}
+
+// Bus fans published messages out to subscribers and keeps the latest ones
+type Bus struct {
+	mu     sync.Mutex
+	size   int
+	log    []Message // Oldest first, at most size messages
+	epoch  int64     // IDs of this process are above epoch
+	lastID int64
+	subs   map[*Subscription]struct{}
+}
+
+// NewBus creates a bus that keeps the last size messages
+func NewBus(size int) *Bus {
+	return newBus(size, time.Now().UnixMicro())
+}
+
+func newBus(size int, epoch int64) *Bus {
+	return &Bus{size: size, epoch: epoch, lastID: epoch, subs: make(map[*Subscription]struct{})}
+}
+
+// Subscription receives the messages published after it was created
+type Subscription struct {
+	bus *Bus
+	ch  chan Message
+}
+
+// C delivers messages in order. It is closed when the subscriber fell too far
+// behind or the subscription was closed.
+func (s *Subscription) C() <-chan Message {
+	return s.ch
+}
+
+// Close stops the subscription
+func (s *Subscription) Close() {
+	s.bus.mu.Lock()
+	defer s.bus.mu.Unlock()
+	s.bus.remove(s)
+}
+
+// Publish appends a message to the log and sends it to every subscriber.
+// It never blocks: subscribers that are behind are dropped.
+func (b *Bus) Publish(event, project string, data []byte) int64 {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	b.lastID++
+	msg := Message{ID: b.lastID, Event: event, Project: project, Data: data}
+	b.log = append(b.log, msg)
+	if len(b.log) > b.size {
+		b.log = append(b.log[:0:0], b.log[len(b.log)-b.size:]...)
+	}
+
+	for s := range b.subs {
+		select {
+		case s.ch <- msg:
+		default:
+			b.remove(s)
+		}
+	}
+	return msg.ID
+}
+
+// Subscribe returns a subscription to the messages published from now on
+func (b *Bus) Subscribe() *Subscription {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+	return b.add()
+}
+
+// Resume returns the logged messages after lastID and a subscription to the
+// ones that follow. complete is false when messages after lastID are no longer
+// in the log, or lastID was not published by this process, as after a
+// restart, so the subscriber missed some and should reload what it shows.
+func (b *Bus) Resume(lastID int64) (backlog []Message, sub *Subscription, complete bool) {
+	b.mu.Lock()
+	defer b.mu.Unlock()
+
+	complete = true
+	if lastID < b.epoch || lastID > b.lastID {
+		complete = false
+		lastID = b.epoch
+	}
+	for _, msg := range b.log {
+		if msg.ID > lastID {
+			backlog = append(backlog, msg)
+		}
+	}
+	if oldest := lastID + 1; oldest <= b.lastID && (len(b.log) == 0 || b.log[0].ID > oldest) {
+		complete = false
+	}
+	return backlog, b.add(), complete
+}
+
+// add creates a subscription; b.mu must be held
+func (b *Bus) add() *Subscription {
+	sub := &Subscription{bus: b, ch: make(chan Message, Buffer)}
+	b.subs[sub] = struct{}{}
+	return sub
+}
+
+// remove drops a subscription; b.mu must be held
+func (b *Bus) remove(s *Subscription) {
+	if _, ok := b.subs[s]; ok {
+		delete(b.subs, s)
+		close(s.ch)
+	}
+}
@@ -0,0 +1,88 @@
+package events
+
+import (
+	"fmt"
+	"testing"
+)
+
+func ids(messages []Message) []int64 {
+	var out []int64
+	for _, m := range messages {
+		out = append(out, m.ID)
+	}
+	return out
+}
+
+func TestPublishSubscribe(t *testing.T) {
+	bus := newBus(10, 0)
+	bus.Publish("project.created", "old", nil)
+
+	sub := bus.Subscribe()
+	defer sub.Close()
+	if id := bus.Publish("database.created", "myapp", []byte(`{}`)); id != 2 {
+		t.Errorf("Publish() = %d, want 2", id)
+	}
+
+	msg := <-sub.C()
+	if msg.ID != 2 || msg.Event != "database.created" || msg.Project != "myapp" {
+		t.Errorf("message = %+v", msg)
+	}
+	select {
+	case msg := <-sub.C():
+		t.Errorf("unexpected message %+v", msg)
+	default:
+	}
+}
+
+func TestResume(t *testing.T) {
+	bus := newBus(3, 100)
+	for i := 0; i < 5; i++ {
+		bus.Publish("database.created", fmt.Sprintf("p%d", i), nil)
+	}
+
+	tests := []struct {
+		name         string
+		lastID       int64
+		wantIDs      string
+		wantComplete bool
+	}{
+		{"within the log", 103, "[104 105]", true},
+		{"just before the log", 102, "[103 104 105]", true},
+		{"up to date", 105, "[]", true},
+		{"dropped from the log", 101, "[103 104 105]", false},
+		{"from before a restart", 99, "[103 104 105]", false},
+		{"not published yet", 109, "[103 104 105]", false},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			backlog, sub, complete := bus.Resume(tt.lastID)
+			defer sub.Close()
+			if got := fmt.Sprint(ids(backlog)); got != tt.wantIDs || complete != tt.wantComplete {
+				t.Errorf("Resume(%d) = %s, %v, want %s, %v", tt.lastID, got, complete, tt.wantIDs, tt.wantComplete)
+			}
+		})
+	}
+}
+
+func TestSlowSubscriberIsDropped(t *testing.T) {
+	bus := newBus(Buffer*2, 0)
+	slow := bus.Subscribe()
+	for i := 0; i <= Buffer; i++ {
+		bus.Publish("database.deleted", "myapp", nil)
+	}
+
+	n := 0
+	for range slow.C() {
+		n++
+	}
+	if n != Buffer {
+		t.Errorf("received %d messages before the channel closed, want %d", n, Buffer)
+	}
+	slow.Close() // Closing a dropped subscription is harmless
+
+	backlog, sub, complete := bus.Resume(int64(n))
+	defer sub.Close()
+	if len(backlog) != 1 || !complete {
+		t.Errorf("Resume() = %d messages, %v", len(backlog), complete)
+	}
+}
@@ -0,0 +1,215 @@
+// Package export renders database connection details in the formats that
+// applications and deployment tools consume: dotenv files, pgpass entries,
+// JSON, YAML, Kubernetes Secrets and docker-compose environment blocks.
+package export
+
+import (
+	"encoding/json"
+	"fmt"
+	"regexp"
+	"slices"
+	"strings"
+
+	"gopkg.in/yaml.v3"
+)
+
+// Formats lists the supported output formats
+var Formats = []string{"dotenv", "pgpass", "json", "yaml", "k8s-secret", "compose"}
+
+// Variable names, in the order they are rendered
+const (
+	VarURL      = "DATABASE_URL"
+	VarHost     = "PGHOST"
+	VarPort     = "PGPORT"
+	VarDatabase = "PGDATABASE"
+	VarUser     = "PGUSER"
+	VarPassword = "PGPASSWORD"
+	VarSSLMode  = "PGSSLMODE"
+)
+
+var variables = []string{VarURL, VarHost, VarPort, VarDatabase, VarUser, VarPassword, VarSSLMode}
+
+// nameRegex matches valid environment variable names
+var nameRegex = regexp.MustCompile(`^[A-Za-z_][A-Za-z0-9_]*$`)
+
+// Connection holds the details of a database connection
+type Connection struct {
+	Host     string
+	Port     int
+	Database string
+	User     string
+	Password string
+	SSLMode  string
+	URL      string
+}
+
+// Options control how connection details are rendered
+type Options struct {
+	Format string
+	Prefix string            // Prepended to every variable name
+	Names  map[string]string // Renames variables, keyed by their default name
+	Name   string            // Secret name for k8s-secret, service name for compose
+}
+
+// Validate checks that the format is known and every variable name is valid
+func (o *Options) Validate() error {
+	if !slices.Contains(Formats, o.Format) {
+		return fmt.Errorf("invalid format '%s', must be one of: %s", o.Format, strings.Join(Formats, ", "))
+	}
+	if o.Prefix != "" && !nameRegex.MatchString(o.Prefix) {
+		return fmt.Errorf("invalid prefix '%s'", o.Prefix)
+	}
+	for from, to := range o.Names {
+		if !slices.Contains(variables, from) {
+			return fmt.Errorf("unknown variable '%s', must be one of: %s", from, strings.Join(variables, ", "))
+		}
+		if !nameRegex.MatchString(o.Prefix + to) {
+			return fmt.Errorf("invalid variable name '%s'", o.Prefix+to)
+		}
+	}
+	return nil
+}
+
+// ParseNames parses renames given as DEFAULT=NEW pairs
+func ParseNames(pairs []string) (map[string]string, error) {
+	names := make(map[string]string, len(pairs))
+	for _, pair := range pairs {
+		from, to, ok := strings.Cut(pair, "=")
+		if !ok || from == "" || to == "" {
+			return nil, fmt.Errorf("invalid variable rename '%s', expected NAME=NEW_NAME", pair)
+		}
+		names[from] = to
+	}
+	return names, nil
+}
+
+// Variable is a rendered environment variable
+type Variable struct {
+	Name  string
+	Value string
+}
+
+// Variables returns the environment variables for c, named according to opts
+func Variables(c Connection, opts Options) []Variable {
+	values := map[string]string{
+		VarURL:      c.URL,
+		VarHost:     c.Host,
+		VarPort:     fmt.Sprint(c.Port),
+		VarDatabase: c.Database,
+		VarUser:     c.User,
+		VarPassword: c.Password,
+		VarSSLMode:  c.SSLMode,
+	}
+
+	vars := make([]Variable, len(variables))
+	for i, v := range variables {
+		name := v
+		if renamed, ok := opts.Names[v]; ok {
+			name = renamed
+		}
+		vars[i] = Variable{Name: opts.Prefix + name, Value: values[v]}
+	}
+	return vars
+}
+
+// Render renders c in the format selected by opts
+func Render(c Connection, opts Options) ([]byte, error) {
+	if err := opts.Validate(); err != nil {
+		return nil, err
+	}
+	vars := Variables(c, opts)
+
+	switch opts.Format {
+	case "dotenv":
+		var b strings.Builder
+		for _, v := range vars {
+			fmt.Fprintf(&b, "%s=%s\n", v.Name, dotenvQuote(v.Value))
+		}
+		return []byte(b.String()), nil
+
+	case "pgpass":
+		return []byte(PgpassLine(c)), nil
+
+	case "json":
+		// Written by hand to keep the variables in order
+		var b strings.Builder
+		b.WriteString("{\n")
+		for i, v := range vars {
+			name, _ := json.Marshal(v.Name)
+			value, _ := json.Marshal(v.Value)
+			fmt.Fprintf(&b, "  %s: %s", name, value)
+			if i < len(vars)-1 {
+				b.WriteString(",")
+			}
+			b.WriteString("\n")
+		}
+		b.WriteString("}\n")
+		return []byte(b.String()), nil
+
+	case "yaml":
+		return yaml.Marshal(orderedMap(vars))
+
+	case "k8s-secret":
+		name := opts.Name
+		if name == "" {
+			name = strings.ReplaceAll(c.Database, "_", "-") + "-db"
+		}
+		return yaml.Marshal(&yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			scalar("apiVersion"), scalar("v1"),
+			scalar("kind"), scalar("Secret"),
+			scalar("metadata"), {Kind: yaml.MappingNode, Content: []*yaml.Node{scalar("name"), scalar(name)}},
+			scalar("type"), scalar("Opaque"),
+			scalar("stringData"), orderedMap(vars),
+		}})
+
+	default: // compose
+		service := opts.Name
+		if service == "" {
+			service = "app"
+		}
+		return yaml.Marshal(&yaml.Node{Kind: yaml.MappingNode, Content: []*yaml.Node{
+			scalar("services"), {Kind: yaml.MappingNode, Content: []*yaml.Node{
+				scalar(service), {Kind: yaml.MappingNode, Content: []*yaml.Node{
+					scalar("environment"), orderedMap(vars),
+				}},
+			}},
+		}})
+	}
+}
+
+// orderedMap builds a YAML mapping that keeps the variables in order
+func orderedMap(vars []Variable) *yaml.Node {
+	node := &yaml.Node{Kind: yaml.MappingNode}
+	for _, v := range vars {
+		// Values are always strings, so numbers such as the port are quoted
+		node.Content = append(node.Content, scalar(v.Name), &yaml.Node{Kind: yaml.ScalarNode, Tag: "!!str", Value: v.Value, Style: yaml.DoubleQuotedStyle})
+	}
+	return node
+}
+
+func scalar(value string) *yaml.Node {
+	return &yaml.Node{Kind: yaml.ScalarNode, Value: value}
+}
+
+// dotenvSafe matches values that need no quoting in a dotenv file
+var dotenvSafe = regexp.MustCompile(`^[A-Za-z0-9_./:@?=&%+-]*$`)
+
+// dotenvQuote double-quotes a value when it contains characters that dotenv
+// parsers or shells would interpret
+func dotenvQuote(s string) string {
+	if dotenvSafe.MatchString(s) {
+		return s
+	}
+	return `"` + strings.NewReplacer(`\`, `\\`, `"`, `\"`, `$`, `\$`, "\n", `\n`).Replace(s) + `"`
+}
+
+// PgpassLine renders the pgpass file entry for c
+func PgpassLine(c Connection) string {
+	return fmt.Sprintf("%s:%d:%s:%s:%s\n", pgpassEscape(c.Host), c.Port,
+		pgpassEscape(c.Database), pgpassEscape(c.User), pgpassEscape(c.Password))
+}
+
+// pgpassEscape escapes the characters that are special in a pgpass file
+func pgpassEscape(s string) string {
+	return strings.NewReplacer(`\`, `\\`, `:`, `\:`).Replace(s)
+}
@@ -0,0 +1,159 @@
+// Package manifest reads declarative descriptions of projects and their
+// databases, as applied by pgmanager plan and pgmanager apply.
+package manifest
+
+import (
+	"bytes"
+	"fmt"
+	"os"
+	"regexp"
+	"sort"
+	"strings"
+	"time"
+
+	"gopkg.in/yaml.v3"
+)
+
+// DefaultFile is the manifest read when no file is given
+const DefaultFile = "pgmanager-projects.yaml"
+
+// validIdentRegex matches role suffixes and extension names
+var validIdentRegex = regexp.MustCompile(`^[a-z][a-z0-9_-]*$`)
+
+// Manifest declares the projects pgmanager manages and their environments
+type Manifest struct {
+	Projects map[string]Project `yaml:"projects"`
+}
+
+// Project declares the environments of a project. Each environment has one database.
+type Project struct {
+	Environments map[string]Environment `yaml:"environments"`
+}
+
+// Environment declares the database of one project environment
+type Environment struct {
+	// Server hosting the database; empty lets the placement rules decide.
+	// Only used when the database is created.
+	Server string `yaml:"server,omitempty"`
+
+	// Protected databases cannot be deleted, reset, pruned or cleaned up
+	Protected bool `yaml:"protected,omitempty"`
+
+	// TTL makes the database expire this long after it was created; zero keeps it
+	TTL time.Duration `yaml:"ttl,omitempty"`
+
+	// ConnectionLimit caps connections to the database; zero means unlimited
+	ConnectionLimit int `yaml:"connection_limit,omitempty"`
+
+	// StatementTimeout is the database's default statement_timeout; zero keeps the server default
+	StatementTimeout time.Duration `yaml:"statement_timeout,omitempty"`
+
+	// Extensions installed in the database
+	Extensions []string `yaml:"extensions,omitempty"`
+
+	// Roles maps role names to their access, read or write. The login role
+	// created on the server is named <database>_<role>.
+	Roles map[string]string `yaml:"roles,omitempty"`
+}
+
+// Load reads and validates a manifest file
+func Load(path string) (*Manifest, error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read manifest: %w", err)
+	}
+
+	m, err := Parse(data)
+	if err != nil {
+		return nil, fmt.Errorf("invalid manifest %s: %w", path, err)
+	}
+	return m, nil
+}
+
+// Parse decodes and validates a manifest. Unknown fields are rejected so that
+// typos do not silently change the plan.
+func Parse(data []byte) (*Manifest, error) {
+	var m Manifest
+	dec := yaml.NewDecoder(bytes.NewReader(data))
+	dec.KnownFields(true)
+	if err := dec.Decode(&m); err != nil {
+		return nil, err
+	}
+	if err := m.Validate(); err != nil {
+		return nil, err
+	}
+	return &m, nil
+}
+
+// Validate checks the manifest. Project names and environments are checked
+// against the same rules as the CLI by the caller.
+func (m *Manifest) Validate() error {
+	for _, name := range m.ProjectNames() {
+		p := m.Projects[name]
+		for _, env := range p.EnvNames() {
+			e := p.Environments[env]
+			if env == "pr" {
+				return fmt.Errorf("%s/%s: PR databases cannot be declared", name, env)
+			}
+			if err := e.Validate(); err != nil {
+				return fmt.Errorf("%s/%s: %w", name, env, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Validate checks an environment
+func (e *Environment) Validate() error {
+	if e.Protected && e.TTL > 0 {
+		return fmt.Errorf("a protected database cannot have a ttl")
+	}
+	if e.TTL < 0 {
+		return fmt.Errorf("ttl must not be negative")
+	}
+	if e.ConnectionLimit < 0 {
+		return fmt.Errorf("connection_limit must not be negative")
+	}
+	if e.StatementTimeout < 0 || e.StatementTimeout%time.Millisecond != 0 {
+		return fmt.Errorf("statement_timeout must be a positive number of milliseconds")
+	}
+	for _, ext := range e.Extensions {
+		if !validIdentRegex.MatchString(ext) {
+			return fmt.Errorf("invalid extension name '%s'", ext)
+		}
+	}
+	for role, access := range e.Roles {
+		if !validIdentRegex.MatchString(role) {
+			return fmt.Errorf("invalid role name '%s'", role)
+		}
+		// Roles are named <database>_<role> and owners <database>_user, so a
+		// role ending in user could be the owner of this or another database
+		if role == "user" || strings.HasSuffix(role, "_user") {
+			return fmt.Errorf("invalid role name '%s': names ending in 'user' are reserved for database owners", role)
+		}
+		if access != "read" && access != "write" {
+			return fmt.Errorf("role '%s' has invalid access '%s', must be read or write", role, access)
+		}
+	}
+	return nil
+}
+
+// ProjectNames returns the declared projects in order
+func (m *Manifest) ProjectNames() []string {
+	names := make([]string, 0, len(m.Projects))
+	for name := range m.Projects {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
+
+// EnvNames returns the declared environments of a project in order
+func (p *Project) EnvNames() []string {
+	names := make([]string, 0, len(p.Environments))
+	for name := range p.Environments {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	return names
+}
@@ -0,0 +1,92 @@
+package manifest
+
+import (
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestParse(t *testing.T) {
+	m, err := Parse([]byte(`
+projects:
+  myapp:
+    environments:
+      prod:
+        server: primary
+        protected: true
+        connection_limit: 50
+        statement_timeout: 30s
+        extensions: [pgcrypto, uuid-ossp]
+        roles:
+          analytics: read
+          etl: write
+      dev:
+        ttl: 720h
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	prod := m.Projects["myapp"].Environments["prod"]
+	if !prod.Protected || prod.Server != "primary" || prod.ConnectionLimit != 50 || prod.StatementTimeout != 30*time.Second {
+		t.Errorf("prod = %+v", prod)
+	}
+	if len(prod.Extensions) != 2 || prod.Roles["etl"] != "write" {
+		t.Errorf("prod extensions and roles = %v, %v", prod.Extensions, prod.Roles)
+	}
+	if dev := m.Projects["myapp"].Environments["dev"]; dev.TTL != 720*time.Hour {
+		t.Errorf("dev ttl = %v", dev.TTL)
+	}
+
+	p := m.Projects["myapp"]
+	if names := p.EnvNames(); strings.Join(names, ",") != "dev,prod" {
+		t.Errorf("EnvNames() = %v", names)
+	}
+}
+
+func TestParseInvalid(t *testing.T) {
+	tests := []struct {
+		name     string
+		manifest string
+	}{
+		{"unknown field", "projects:\n  myapp:\n    environments:\n      dev:\n        protect: true\n"},
+		{"pr environment", "projects:\n  myapp:\n    environments:\n      pr:\n        ttl: 72h\n"},
+		{"protected with ttl", "projects:\n  myapp:\n    environments:\n      prod:\n        protected: true\n        ttl: 72h\n"},
+		{"negative connection limit", "projects:\n  myapp:\n    environments:\n      dev:\n        connection_limit: -1\n"},
+		{"sub-millisecond timeout", "projects:\n  myapp:\n    environments:\n      dev:\n        statement_timeout: 1500us\n"},
+		{"invalid access", "projects:\n  myapp:\n    environments:\n      dev:\n        roles:\n          analytics: admin\n"},
+		{"invalid role name", "projects:\n  myapp:\n    environments:\n      dev:\n        roles:\n          Analytics: read\n"},
+		{"owner role name", "projects:\n  myapp:\n    environments:\n      dev:\n        roles:\n          user: read\n"},
+		{"other owner role name", "projects:\n  myapp:\n    environments:\n      dev:\n        roles:\n          prod_user: write\n"},
+		{"invalid extension", "projects:\n  myapp:\n    environments:\n      dev:\n        extensions: [\"pg crypto\"]\n"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Parse([]byte(tt.manifest)); err == nil {
+				t.Error("Parse() should fail")
+			}
+		})
+	}
+}
+
+func TestLoad(t *testing.T) {
+	path := filepath.Join(t.TempDir(), DefaultFile)
+	if err := os.WriteFile(path, []byte("projects:\n  myapp:\n    environments:\n      dev: {}\n"), 0600); err != nil {
+		t.Fatal(err)
+	}
+
+	m, err := Load(path)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+	if names := m.ProjectNames(); len(names) != 1 || names[0] != "myapp" {
+		t.Errorf("ProjectNames() = %v", names)
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing.yaml")); err == nil {
+		t.Error("Load() of a missing file should fail")
+	}
+}
@@ -3,26 +3,59 @@ package meta
 import (
 	"context"
 	"fmt"
+	"sort"
+	"strings"
 	"sync"
 	"time"
 )
 
 // MockStore is an in-memory implementation of Store for testing
 type MockStore struct {
-	mu        sync.RWMutex
-	projects  map[int64]*Project
-	databases map[int64]*Database
-	nextPID   int64
-	nextDBID  int64
+	mu         sync.RWMutex
+	projects   map[int64]*Project
+	databases  map[int64]*Database
+	moves      map[string]*Move
+	backups    map[int64]*Backup
+	tokens     map[int64]*Token
+	bindings   map[int64]*AccessBinding
+	audit      []AuditEvent
+	webhooks   map[int64]*Webhook
+	deliveries map[int64]*WebhookDelivery
+	inbound    map[string]time.Time // Receipt times keyed by source and delivery ID
+	jobs       map[int64]*Job
+	jobLogs    map[int64][]JobLog
+	nextPID    int64
+	nextDBID   int64
+	nextBID    int64
+	nextTID    int64
+	nextABID   int64
+	nextWHID   int64
+	nextWDID   int64
+	nextJID    int64
 }
 
 // NewMockStore creates a new mock store for testing
 func NewMockStore() *MockStore {
 	return &MockStore{
-		projects:  make(map[int64]*Project),
-		databases: make(map[int64]*Database),
-		nextPID:   1,
-		nextDBID:  1,
+		projects:   make(map[int64]*Project),
+		databases:  make(map[int64]*Database),
+		moves:      make(map[string]*Move),
+		backups:    make(map[int64]*Backup),
+		tokens:     make(map[int64]*Token),
+		bindings:   make(map[int64]*AccessBinding),
+		webhooks:   make(map[int64]*Webhook),
+		deliveries: make(map[int64]*WebhookDelivery),
+		inbound:    make(map[string]time.Time),
+		jobs:       make(map[int64]*Job),
+		jobLogs:    make(map[int64][]JobLog),
+		nextPID:    1,
+		nextDBID:   1,
+		nextBID:    1,
+		nextTID:    1,
+		nextABID:   1,
+		nextWHID:   1,
+		nextWDID:   1,
+		nextJID:    1,
 	}
 }
 
@@ -98,10 +131,15 @@ func (s *MockStore) DeleteProject(ctx context.Context, name string) ([]Database,
 			delete(s.databases, id)
 		}
 	}
+	for id, b := range s.bindings {
+		if b.ProjectID == projectID {
+			delete(s.bindings, id)
+		}
+	}
 	return deleted, nil
 }
 
-func (s *MockStore) CreateDatabase(ctx context.Context, projectID int64, name, userName, password, env string, prNumber *int, expiresAt *time.Time) (*Database, error) {
+func (s *MockStore) CreateDatabase(ctx context.Context, projectID int64, name, userName, password, env, server string, prNumber *int, expiresAt *time.Time) (*Database, error) {
 	s.mu.Lock()
 	defer s.mu.Unlock()
 
@@ -112,6 +150,7 @@ func (s *MockStore) CreateDatabase(ctx context.Context, projectID int64, name, u
 		UserName:  userName,
 		Password:  password,
 		Env:       env,
+		Server:    server,
 		PRNumber:  prNumber,
 		CreatedAt: time.Now(),
 		ExpiresAt: expiresAt,
@@ -181,6 +220,7 @@ func (s *MockStore) DeleteDatabase(ctx context.Context, name string) error {
 	for id, db := range s.databases {
 		if db.Name == name {
 			delete(s.databases, id)
+			delete(s.moves, name)
 			return nil
 		}
 	}
@@ -214,3 +254,621 @@ func (s *MockStore) GetDatabasesOlderThan(ctx context.Context, env string, older
 	}
 	return result, nil
 }
+
+func (s *MockStore) GetIdleDatabases(ctx context.Context, env string, idleFor time.Duration) ([]Database, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	cutoff := time.Now().Add(-idleFor)
+	var result []Database
+	for _, db := range s.databases {
+		lastSeen := db.CreatedAt
+		if db.LastActivityAt != nil {
+			lastSeen = *db.LastActivityAt
+		}
+		if db.Env == env && lastSeen.Before(cutoff) {
+			result = append(result, *db)
+		}
+	}
+	return result, nil
+}
+
+func (s *MockStore) UpdateDatabaseActivity(ctx context.Context, name string, lastActivityAt *time.Time, counter int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, db := range s.databases {
+		if db.Name == name {
+			db.LastActivityAt = lastActivityAt
+			db.ActivityCounter = counter
+			return nil
+		}
+	}
+	return fmt.Errorf("database not found: %s", name)
+}
+
+func (s *MockStore) UpdateDatabaseServer(ctx context.Context, name, server string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, db := range s.databases {
+		if db.Name == name {
+			db.Server = server
+			return nil
+		}
+	}
+	return fmt.Errorf("database not found: %s", name)
+}
+
+func (s *MockStore) UpdateDatabasePolicy(ctx context.Context, name string, protected bool, expiresAt *time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, db := range s.databases {
+		if db.Name == name {
+			db.Protected = protected
+			db.ExpiresAt = expiresAt
+			return nil
+		}
+	}
+	return fmt.Errorf("database not found: %s", name)
+}
+
+func (s *MockStore) SaveMove(ctx context.Context, move *Move) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	if existing, ok := s.moves[move.DatabaseName]; ok {
+		move.StartedAt = existing.StartedAt
+	} else {
+		move.StartedAt = now
+	}
+	move.UpdatedAt = now
+
+	stored := *move
+	stored.CopiedTables = append([]string(nil), move.CopiedTables...)
+	s.moves[move.DatabaseName] = &stored
+	return nil
+}
+
+func (s *MockStore) GetMove(ctx context.Context, databaseName string) (*Move, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	m, ok := s.moves[databaseName]
+	if !ok {
+		return nil, nil
+	}
+	result := *m
+	result.CopiedTables = append([]string(nil), m.CopiedTables...)
+	return &result, nil
+}
+
+func (s *MockStore) DeleteMove(ctx context.Context, databaseName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.moves, databaseName)
+	return nil
+}
+
+func (s *MockStore) CreateBackup(ctx context.Context, backup *Backup) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	backup.ID = s.nextBID
+	s.nextBID++
+	stored := *backup
+	s.backups[backup.ID] = &stored
+	return nil
+}
+
+func (s *MockStore) GetBackup(ctx context.Context, id int64) (*Backup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	b, ok := s.backups[id]
+	if !ok {
+		return nil, nil
+	}
+	result := *b
+	return &result, nil
+}
+
+func (s *MockStore) ListBackups(ctx context.Context, databaseName string) ([]Backup, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []Backup
+	for _, b := range s.backups {
+		if databaseName == "" || b.DatabaseName == databaseName {
+			result = append(result, *b)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if !result[i].CreatedAt.Equal(result[j].CreatedAt) {
+			return result[i].CreatedAt.After(result[j].CreatedAt)
+		}
+		return result[i].ID > result[j].ID
+	})
+	return result, nil
+}
+
+func (s *MockStore) DeleteBackup(ctx context.Context, id int64) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.backups[id]; !ok {
+		return fmt.Errorf("backup not found: %d", id)
+	}
+	delete(s.backups, id)
+	return nil
+}
+
+func (s *MockStore) CreateToken(ctx context.Context, token *Token) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, t := range s.tokens {
+		if t.Name == token.Name || t.Hash == token.Hash {
+			return fmt.Errorf("failed to create token: duplicate key")
+		}
+	}
+	token.ID = s.nextTID
+	token.CreatedAt = time.Now()
+	s.nextTID++
+	stored := *token
+	s.tokens[token.ID] = &stored
+	return nil
+}
+
+func (s *MockStore) GetTokenByHash(ctx context.Context, hash string) (*Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, t := range s.tokens {
+		if t.Hash == hash {
+			result := *t
+			return &result, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MockStore) ListTokens(ctx context.Context) ([]Token, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []Token
+	for _, t := range s.tokens {
+		result = append(result, *t)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func (s *MockStore) DeleteToken(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, t := range s.tokens {
+		if t.Name == name {
+			delete(s.tokens, id)
+			return nil
+		}
+	}
+	return fmt.Errorf("token not found: %s", name)
+}
+
+func (s *MockStore) UpdateTokenLastUsed(ctx context.Context, id int64, usedAt time.Time) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if t, ok := s.tokens[id]; ok {
+		t.LastUsedAt = &usedAt
+	}
+	return nil
+}
+
+func (s *MockStore) SetAccessBinding(ctx context.Context, projectID int64, subject, role string) (*AccessBinding, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	p, ok := s.projects[projectID]
+	if !ok {
+		return nil, fmt.Errorf("failed to set access binding: project %d not found", projectID)
+	}
+	for _, b := range s.bindings {
+		if b.ProjectID == projectID && b.Subject == subject {
+			b.Role = role
+			result := *b
+			return &result, nil
+		}
+	}
+
+	b := &AccessBinding{
+		ID:          s.nextABID,
+		ProjectID:   projectID,
+		ProjectName: p.Name,
+		Subject:     subject,
+		Role:        role,
+		CreatedAt:   time.Now(),
+	}
+	s.bindings[b.ID] = b
+	s.nextABID++
+	result := *b
+	return &result, nil
+}
+
+func (s *MockStore) DeleteAccessBinding(ctx context.Context, projectID int64, subject string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, b := range s.bindings {
+		if b.ProjectID == projectID && b.Subject == subject {
+			delete(s.bindings, id)
+			return nil
+		}
+	}
+	return fmt.Errorf("access binding not found: %s", subject)
+}
+
+func (s *MockStore) ListAccessBindings(ctx context.Context, projectID int64, subject string) ([]AccessBinding, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []AccessBinding
+	for _, b := range s.bindings {
+		if (projectID == 0 || b.ProjectID == projectID) && (subject == "" || b.Subject == subject) {
+			result = append(result, *b)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool {
+		if result[i].ProjectName != result[j].ProjectName {
+			return result[i].ProjectName < result[j].ProjectName
+		}
+		return result[i].Subject < result[j].Subject
+	})
+	return result, nil
+}
+
+func (s *MockStore) CreateAuditEvent(ctx context.Context, event *AuditEvent) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	event.ID = int64(len(s.audit)) + 1
+	event.CreatedAt = time.Now()
+	s.audit = append(s.audit, *event)
+	return nil
+}
+
+func (s *MockStore) ListAuditEvents(ctx context.Context, f AuditFilter) ([]AuditEvent, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []AuditEvent
+	for i := len(s.audit) - 1; i >= 0; i-- {
+		e := s.audit[i]
+		switch {
+		case f.Project != "" && e.Project != f.Project,
+			f.Actor != "" && e.Actor != f.Actor,
+			f.Action != "" && e.Action != f.Action && !strings.HasPrefix(e.Action, f.Action+"."),
+			!f.Since.IsZero() && e.CreatedAt.Before(f.Since),
+			!f.Until.IsZero() && !e.CreatedAt.Before(f.Until),
+			f.BeforeID != 0 && e.ID >= f.BeforeID:
+			continue
+		}
+		result = append(result, e)
+		if f.Limit > 0 && len(result) == f.Limit {
+			break
+		}
+	}
+	return result, nil
+}
+
+func (s *MockStore) CreateWebhook(ctx context.Context, webhook *Webhook) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for _, w := range s.webhooks {
+		if w.Name == webhook.Name {
+			return fmt.Errorf("failed to create webhook: duplicate key")
+		}
+	}
+	webhook.ID = s.nextWHID
+	webhook.CreatedAt = time.Now()
+	s.nextWHID++
+	stored := *webhook
+	s.webhooks[webhook.ID] = &stored
+	return nil
+}
+
+func (s *MockStore) GetWebhook(ctx context.Context, name string) (*Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	for _, w := range s.webhooks {
+		if w.Name == name {
+			result := *w
+			return &result, nil
+		}
+	}
+	return nil, nil
+}
+
+func (s *MockStore) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []Webhook
+	for _, w := range s.webhooks {
+		result = append(result, *w)
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].Name < result[j].Name })
+	return result, nil
+}
+
+func (s *MockStore) DeleteWebhook(ctx context.Context, name string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	for id, w := range s.webhooks {
+		if w.Name == name {
+			delete(s.webhooks, id)
+			for did, d := range s.deliveries {
+				if d.WebhookID == id {
+					delete(s.deliveries, did)
+				}
+			}
+			return nil
+		}
+	}
+	return fmt.Errorf("webhook not found: %s", name)
+}
+
+func (s *MockStore) CreateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.webhooks[delivery.WebhookID]; !ok {
+		return false, fmt.Errorf("failed to create webhook delivery: webhook %d not found", delivery.WebhookID)
+	}
+	if delivery.Key != "" {
+		for _, d := range s.deliveries {
+			if d.WebhookID == delivery.WebhookID && d.Key == delivery.Key {
+				return false, nil
+			}
+		}
+	}
+
+	now := time.Now()
+	delivery.ID = s.nextWDID
+	delivery.CreatedAt = now
+	delivery.UpdatedAt = now
+	if delivery.Status == "" {
+		delivery.Status = "pending"
+	}
+	if delivery.NextAttemptAt.IsZero() {
+		delivery.NextAttemptAt = now
+	}
+	s.nextWDID++
+	stored := *delivery
+	s.deliveries[delivery.ID] = &stored
+	return true, nil
+}
+
+func (s *MockStore) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	now := time.Now()
+	var due []*WebhookDelivery
+	for _, d := range s.deliveries {
+		if d.Status == "pending" && !d.NextAttemptAt.After(now) {
+			due = append(due, d)
+		}
+	}
+	sort.Slice(due, func(i, j int) bool { return due[i].NextAttemptAt.Before(due[j].NextAttemptAt) })
+	if len(due) > limit {
+		due = due[:limit]
+	}
+
+	result := make([]WebhookDelivery, len(due))
+	for i, d := range due {
+		d.NextAttemptAt = now.Add(lease)
+		result[i] = *d
+	}
+	return result, nil
+}
+
+func (s *MockStore) UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	d, ok := s.deliveries[delivery.ID]
+	if !ok {
+		return fmt.Errorf("webhook delivery not found: %d", delivery.ID)
+	}
+	delivery.UpdatedAt = time.Now()
+	d.Status = delivery.Status
+	d.Attempts = delivery.Attempts
+	d.NextAttemptAt = delivery.NextAttemptAt
+	d.ResponseCode = delivery.ResponseCode
+	d.Error = delivery.Error
+	d.UpdatedAt = delivery.UpdatedAt
+	return nil
+}
+
+func (s *MockStore) ListWebhookDeliveries(ctx context.Context, webhookID int64, limit int) ([]WebhookDelivery, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []WebhookDelivery
+	for _, d := range s.deliveries {
+		if d.WebhookID == webhookID {
+			result = append(result, *d)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID > result[j].ID })
+	if limit > 0 && len(result) > limit {
+		result = result[:limit]
+	}
+	return result, nil
+}
+
+func (s *MockStore) PruneWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for id, d := range s.deliveries {
+		if d.Status != "pending" && d.UpdatedAt.Before(before) {
+			delete(s.deliveries, id)
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MockStore) ClaimInboundDelivery(ctx context.Context, source, id string) (bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	key := source + "/" + id
+	if _, ok := s.inbound[key]; ok {
+		return false, nil
+	}
+	s.inbound[key] = time.Now()
+	return true, nil
+}
+
+func (s *MockStore) ReleaseInboundDelivery(ctx context.Context, source, id string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	delete(s.inbound, source+"/"+id)
+	return nil
+}
+
+func (s *MockStore) PruneInboundDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for key, receivedAt := range s.inbound {
+		if receivedAt.Before(before) {
+			delete(s.inbound, key)
+			n++
+		}
+	}
+	return n, nil
+}
+
+// Jobs are copied in and out, since workers update them while others read them
+
+func (s *MockStore) CreateJob(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	job.ID = s.nextJID
+	s.nextJID++
+	if job.Status == "" {
+		job.Status = "queued"
+	}
+	job.CreatedAt = time.Now()
+	stored := *job
+	s.jobs[job.ID] = &stored
+	return nil
+}
+
+func (s *MockStore) GetJob(ctx context.Context, id int64) (*Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	job, ok := s.jobs[id]
+	if !ok {
+		return nil, nil
+	}
+	found := *job
+	return &found, nil
+}
+
+func (s *MockStore) ListJobs(ctx context.Context, f JobFilter) ([]Job, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	var result []Job
+	for _, j := range s.jobs {
+		if (f.Project == "" || j.Project == f.Project) && (f.Status == "" || j.Status == f.Status) {
+			result = append(result, *j)
+		}
+	}
+	sort.Slice(result, func(i, j int) bool { return result[i].ID > result[j].ID })
+	if f.Limit > 0 && len(result) > f.Limit {
+		result = result[:f.Limit]
+	}
+	return result, nil
+}
+
+func (s *MockStore) UpdateJob(ctx context.Context, job *Job) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[job.ID]; !ok {
+		return fmt.Errorf("job not found: %d", job.ID)
+	}
+	stored := *job
+	s.jobs[job.ID] = &stored
+	return nil
+}
+
+func (s *MockStore) AppendJobLog(ctx context.Context, jobID int64, message string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	if _, ok := s.jobs[jobID]; !ok {
+		return fmt.Errorf("failed to log job message: job not found: %d", jobID)
+	}
+	s.jobLogs[jobID] = append(s.jobLogs[jobID], JobLog{Time: time.Now(), Message: message})
+	return nil
+}
+
+func (s *MockStore) ListJobLogs(ctx context.Context, jobID int64) ([]JobLog, error) {
+	s.mu.RLock()
+	defer s.mu.RUnlock()
+
+	return append([]JobLog(nil), s.jobLogs[jobID]...), nil
+}
+
+func (s *MockStore) InterruptJobs(ctx context.Context, reason string) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	now := time.Now()
+	for _, j := range s.jobs {
+		if j.Status == "queued" || j.Status == "running" {
+			j.Status = "failed"
+			j.Error = reason
+			j.FinishedAt = &now
+			n++
+		}
+	}
+	return n, nil
+}
+
+func (s *MockStore) PruneJobs(ctx context.Context, before time.Time) (int64, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	var n int64
+	for id, j := range s.jobs {
+		if j.FinishedAt != nil && j.FinishedAt.Before(before) {
+			delete(s.jobs, id)
+			delete(s.jobLogs, id)
+			n++
+		}
+	}
+	return n, nil
+}
@@ -9,6 +9,10 @@ import (
 	"github.com/jackc/pgx/v5/pgxpool"
 )
 
+// databaseColumns is the column list scanned by scanDatabasePg
+const databaseColumns = `id, project_id, name, user_name, password, env, server, pr_number, created_at, expires_at,
+	last_activity_at, activity_counter, protected`
+
 // PostgresStore handles PostgreSQL metadata operations
 type PostgresStore struct {
 	pool *pgxpool.Pool
@@ -62,6 +66,156 @@ func (s *PostgresStore) migrate(ctx context.Context) error {
 	CREATE INDEX IF NOT EXISTS idx_databases_project_id ON pgmanager.databases(project_id);
 	CREATE INDEX IF NOT EXISTS idx_databases_env ON pgmanager.databases(env);
 	CREATE INDEX IF NOT EXISTS idx_databases_expires_at ON pgmanager.databases(expires_at);
+
+	ALTER TABLE pgmanager.databases ADD COLUMN IF NOT EXISTS last_activity_at TIMESTAMPTZ;
+	ALTER TABLE pgmanager.databases ADD COLUMN IF NOT EXISTS activity_counter BIGINT NOT NULL DEFAULT 0;
+	ALTER TABLE pgmanager.databases ADD COLUMN IF NOT EXISTS server TEXT NOT NULL DEFAULT 'default';
+	ALTER TABLE pgmanager.databases ADD COLUMN IF NOT EXISTS protected BOOLEAN NOT NULL DEFAULT false;
+
+	CREATE TABLE IF NOT EXISTS pgmanager.moves (
+		database_name TEXT PRIMARY KEY REFERENCES pgmanager.databases(name) ON DELETE CASCADE,
+		source TEXT NOT NULL,
+		target TEXT NOT NULL,
+		phase TEXT NOT NULL,
+		copied_tables TEXT[] NOT NULL DEFAULT '{}',
+		started_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMPTZ DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS pgmanager.backups (
+		id SERIAL PRIMARY KEY,
+		database_name TEXT NOT NULL,
+		env TEXT NOT NULL,
+		target TEXT NOT NULL,
+		key TEXT NOT NULL,
+		size BIGINT NOT NULL,
+		table_count INTEGER NOT NULL,
+		row_count BIGINT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_backups_database_name ON pgmanager.backups(database_name, created_at);
+
+	CREATE TABLE IF NOT EXISTS pgmanager.tokens (
+		id SERIAL PRIMARY KEY,
+		name TEXT UNIQUE NOT NULL,
+		hash TEXT UNIQUE NOT NULL,
+		scopes TEXT[] NOT NULL,
+		projects TEXT[] NOT NULL DEFAULT '{}',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		expires_at TIMESTAMPTZ,
+		last_used_at TIMESTAMPTZ
+	);
+
+	CREATE TABLE IF NOT EXISTS pgmanager.access_bindings (
+		id SERIAL PRIMARY KEY,
+		project_id INTEGER NOT NULL REFERENCES pgmanager.projects(id) ON DELETE CASCADE,
+		subject TEXT NOT NULL,
+		role TEXT NOT NULL,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		UNIQUE (project_id, subject)
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_access_bindings_subject ON pgmanager.access_bindings(subject);
+
+	CREATE TABLE IF NOT EXISTS pgmanager.audit_events (
+		id BIGSERIAL PRIMARY KEY,
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		actor TEXT NOT NULL,
+		source TEXT NOT NULL,
+		request_id TEXT NOT NULL DEFAULT '',
+		action TEXT NOT NULL,
+		project TEXT NOT NULL DEFAULT '',
+		target TEXT NOT NULL DEFAULT '',
+		outcome TEXT NOT NULL,
+		error TEXT NOT NULL DEFAULT ''
+	);
+
+	ALTER TABLE pgmanager.audit_events ADD COLUMN IF NOT EXISTS detail TEXT NOT NULL DEFAULT '';
+
+	CREATE INDEX IF NOT EXISTS idx_audit_events_project ON pgmanager.audit_events(project, id);
+	CREATE INDEX IF NOT EXISTS idx_audit_events_created_at ON pgmanager.audit_events(created_at);
+
+	-- The audit log is append-only
+	CREATE OR REPLACE FUNCTION pgmanager.audit_events_append_only() RETURNS trigger AS $$
+	BEGIN
+		RAISE EXCEPTION 'pgmanager.audit_events is append-only';
+	END;
+	$$ LANGUAGE plpgsql;
+
+	DROP TRIGGER IF EXISTS audit_events_append_only ON pgmanager.audit_events;
+	CREATE TRIGGER audit_events_append_only BEFORE UPDATE OR DELETE ON pgmanager.audit_events
+		FOR EACH ROW EXECUTE FUNCTION pgmanager.audit_events_append_only();
+
+	DROP TRIGGER IF EXISTS audit_events_no_truncate ON pgmanager.audit_events;
+	CREATE TRIGGER audit_events_no_truncate BEFORE TRUNCATE ON pgmanager.audit_events
+		FOR EACH STATEMENT EXECUTE FUNCTION pgmanager.audit_events_append_only();
+
+	CREATE TABLE IF NOT EXISTS pgmanager.webhooks (
+		id SERIAL PRIMARY KEY,
+		name TEXT UNIQUE NOT NULL,
+		url TEXT NOT NULL,
+		secret TEXT NOT NULL,
+		events TEXT[] NOT NULL DEFAULT '{}',
+		projects TEXT[] NOT NULL DEFAULT '{}',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE TABLE IF NOT EXISTS pgmanager.webhook_deliveries (
+		id BIGSERIAL PRIMARY KEY,
+		webhook_id INTEGER NOT NULL REFERENCES pgmanager.webhooks(id) ON DELETE CASCADE,
+		event TEXT NOT NULL,
+		key TEXT NOT NULL DEFAULT '',
+		payload BYTEA NOT NULL,
+		status TEXT NOT NULL DEFAULT 'pending',
+		attempts INTEGER NOT NULL DEFAULT 0,
+		next_attempt_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		response_code INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		updated_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_webhook ON pgmanager.webhook_deliveries(webhook_id, id);
+	CREATE INDEX IF NOT EXISTS idx_webhook_deliveries_pending ON pgmanager.webhook_deliveries(next_attempt_at)
+		WHERE status = 'pending';
+	CREATE UNIQUE INDEX IF NOT EXISTS idx_webhook_deliveries_key ON pgmanager.webhook_deliveries(webhook_id, key)
+		WHERE key <> '';
+
+	CREATE TABLE IF NOT EXISTS pgmanager.inbound_deliveries (
+		source TEXT NOT NULL,
+		delivery_id TEXT NOT NULL,
+		received_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		PRIMARY KEY (source, delivery_id)
+	);
+
+	CREATE TABLE IF NOT EXISTS pgmanager.jobs (
+		id BIGSERIAL PRIMARY KEY,
+		kind TEXT NOT NULL,
+		project TEXT NOT NULL DEFAULT '',
+		target TEXT NOT NULL DEFAULT '',
+		params BYTEA,
+		status TEXT NOT NULL DEFAULT 'queued',
+		done INTEGER NOT NULL DEFAULT 0,
+		total INTEGER NOT NULL DEFAULT 0,
+		error TEXT NOT NULL DEFAULT '',
+		result BYTEA,
+		actor TEXT NOT NULL DEFAULT '',
+		created_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		started_at TIMESTAMPTZ,
+		finished_at TIMESTAMPTZ
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_jobs_status ON pgmanager.jobs(status);
+
+	CREATE TABLE IF NOT EXISTS pgmanager.job_logs (
+		id BIGSERIAL PRIMARY KEY,
+		job_id BIGINT NOT NULL REFERENCES pgmanager.jobs(id) ON DELETE CASCADE,
+		logged_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP,
+		message TEXT NOT NULL
+	);
+
+	CREATE INDEX IF NOT EXISTS idx_job_logs_job ON pgmanager.job_logs(job_id);
 	`
 
 	_, err := s.pool.Exec(ctx, schema)
@@ -158,14 +312,14 @@ func (s *PostgresStore) DeleteProject(ctx context.Context, name string) ([]Datab
 }
 
 // CreateDatabase creates a new database record
-func (s *PostgresStore) CreateDatabase(ctx context.Context, projectID int64, name, userName, password, env string, prNumber *int, expiresAt *time.Time) (*Database, error) {
+func (s *PostgresStore) CreateDatabase(ctx context.Context, projectID int64, name, userName, password, env, server string, prNumber *int, expiresAt *time.Time) (*Database, error) {
 	var id int64
 	var createdAt time.Time
 	err := s.pool.QueryRow(ctx,
-		`INSERT INTO pgmanager.databases (project_id, name, user_name, password, env, pr_number, expires_at)
-		 VALUES ($1, $2, $3, $4, $5, $6, $7)
+		`INSERT INTO pgmanager.databases (project_id, name, user_name, password, env, server, pr_number, expires_at)
+		 VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
 		 RETURNING id, created_at`,
-		projectID, name, userName, password, env, prNumber, expiresAt,
+		projectID, name, userName, password, env, server, prNumber, expiresAt,
 	).Scan(&id, &createdAt)
 	if err != nil {
 		return nil, fmt.Errorf("failed to create database: %w", err)
@@ -178,6 +332,7 @@ func (s *PostgresStore) CreateDatabase(ctx context.Context, projectID int64, nam
 		UserName:  userName,
 		Password:  password,
 		Env:       env,
+		Server:    server,
 		PRNumber:  prNumber,
 		CreatedAt: createdAt,
 		ExpiresAt: expiresAt,
@@ -186,11 +341,7 @@ func (s *PostgresStore) CreateDatabase(ctx context.Context, projectID int64, nam
 
 // GetDatabase retrieves a database by project and environment
 func (s *PostgresStore) GetDatabase(ctx context.Context, projectID int64, env string, prNumber *int) (*Database, error) {
-	var d Database
-	var expiresAt *time.Time
-	var prNum *int
-
-	query := `SELECT id, project_id, name, user_name, password, env, pr_number, created_at, expires_at
+	query := `SELECT ` + databaseColumns + `
 	          FROM pgmanager.databases WHERE project_id = $1 AND env = $2`
 	args := []interface{}{projectID, env}
 
@@ -201,9 +352,7 @@ func (s *PostgresStore) GetDatabase(ctx context.Context, projectID int64, env st
 		query += " AND pr_number IS NULL"
 	}
 
-	err := s.pool.QueryRow(ctx, query, args...).Scan(
-		&d.ID, &d.ProjectID, &d.Name, &d.UserName, &d.Password, &d.Env, &prNum, &d.CreatedAt, &expiresAt,
-	)
+	d, err := scanDatabasePg(s.pool.QueryRow(ctx, query, args...))
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
@@ -211,23 +360,16 @@ func (s *PostgresStore) GetDatabase(ctx context.Context, projectID int64, env st
 		return nil, fmt.Errorf("failed to get database: %w", err)
 	}
 
-	d.PRNumber = prNum
-	d.ExpiresAt = expiresAt
-
-	return &d, nil
+	return d, nil
 }
 
 // GetDatabaseByName retrieves a database by its full name
 func (s *PostgresStore) GetDatabaseByName(ctx context.Context, name string) (*Database, error) {
-	var d Database
-	var expiresAt *time.Time
-	var prNum *int
-
-	err := s.pool.QueryRow(ctx,
-		`SELECT id, project_id, name, user_name, password, env, pr_number, created_at, expires_at
+	d, err := scanDatabasePg(s.pool.QueryRow(ctx,
+		`SELECT `+databaseColumns+`
 		 FROM pgmanager.databases WHERE name = $1`,
 		name,
-	).Scan(&d.ID, &d.ProjectID, &d.Name, &d.UserName, &d.Password, &d.Env, &prNum, &d.CreatedAt, &expiresAt)
+	))
 	if err == pgx.ErrNoRows {
 		return nil, nil
 	}
@@ -235,16 +377,13 @@ func (s *PostgresStore) GetDatabaseByName(ctx context.Context, name string) (*Da
 		return nil, fmt.Errorf("failed to get database: %w", err)
 	}
 
-	d.PRNumber = prNum
-	d.ExpiresAt = expiresAt
-
-	return &d, nil
+	return d, nil
 }
 
 // ListDatabases returns all databases for a project
 func (s *PostgresStore) ListDatabases(ctx context.Context, projectID int64) ([]Database, error) {
 	rows, err := s.pool.Query(ctx,
-		`SELECT id, project_id, name, user_name, password, env, pr_number, created_at, expires_at
+		`SELECT `+databaseColumns+`
 		 FROM pgmanager.databases WHERE project_id = $1 ORDER BY name`,
 		projectID,
 	)
@@ -259,7 +398,7 @@ func (s *PostgresStore) ListDatabases(ctx context.Context, projectID int64) ([]D
 // ListAllDatabases returns all databases
 func (s *PostgresStore) ListAllDatabases(ctx context.Context) ([]Database, error) {
 	rows, err := s.pool.Query(ctx,
-		`SELECT id, project_id, name, user_name, password, env, pr_number, created_at, expires_at
+		`SELECT `+databaseColumns+`
 		 FROM pgmanager.databases ORDER BY name`,
 	)
 	if err != nil {
@@ -287,7 +426,7 @@ func (s *PostgresStore) DeleteDatabase(ctx context.Context, name string) error {
 // GetExpiredDatabases returns databases that have expired
 func (s *PostgresStore) GetExpiredDatabases(ctx context.Context) ([]Database, error) {
 	rows, err := s.pool.Query(ctx,
-		`SELECT id, project_id, name, user_name, password, env, pr_number, created_at, expires_at
+		`SELECT `+databaseColumns+`
 		 FROM pgmanager.databases
 		 WHERE expires_at IS NOT NULL AND expires_at < NOW()
 		 ORDER BY expires_at`,
@@ -304,7 +443,7 @@ func (s *PostgresStore) GetExpiredDatabases(ctx context.Context) ([]Database, er
 func (s *PostgresStore) GetDatabasesOlderThan(ctx context.Context, env string, olderThan time.Duration) ([]Database, error) {
 	cutoff := time.Now().Add(-olderThan)
 	rows, err := s.pool.Query(ctx,
-		`SELECT id, project_id, name, user_name, password, env, pr_number, created_at, expires_at
+		`SELECT `+databaseColumns+`
 		 FROM pgmanager.databases
 		 WHERE env = $1 AND created_at < $2
 		 ORDER BY created_at`,
@@ -318,21 +457,754 @@ func (s *PostgresStore) GetDatabasesOlderThan(ctx context.Context, env string, o
 	return scanDatabasesPg(rows)
 }
 
-func scanDatabasesPg(rows pgx.Rows) ([]Database, error) {
-	var databases []Database
+// GetIdleDatabases returns databases in env with no recorded activity since the given duration.
+// Databases that have never been seen active are measured from their creation time.
+func (s *PostgresStore) GetIdleDatabases(ctx context.Context, env string, idleFor time.Duration) ([]Database, error) {
+	cutoff := time.Now().Add(-idleFor)
+	rows, err := s.pool.Query(ctx,
+		`SELECT `+databaseColumns+`
+		 FROM pgmanager.databases
+		 WHERE env = $1 AND COALESCE(last_activity_at, created_at) < $2
+		 ORDER BY COALESCE(last_activity_at, created_at)`,
+		env, cutoff,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get idle databases: %w", err)
+	}
+	defer rows.Close()
+
+	return scanDatabasesPg(rows)
+}
+
+// UpdateDatabaseActivity records the latest activity sample for a database
+func (s *PostgresStore) UpdateDatabaseActivity(ctx context.Context, name string, lastActivityAt *time.Time, counter int64) error {
+	result, err := s.pool.Exec(ctx,
+		"UPDATE pgmanager.databases SET last_activity_at = $2, activity_counter = $3 WHERE name = $1",
+		name, lastActivityAt, counter,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update database activity: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("database not found: %s", name)
+	}
+
+	return nil
+}
+
+// UpdateDatabaseServer changes the server a database is recorded on
+func (s *PostgresStore) UpdateDatabaseServer(ctx context.Context, name, server string) error {
+	result, err := s.pool.Exec(ctx,
+		"UPDATE pgmanager.databases SET server = $2 WHERE name = $1",
+		name, server,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update database server: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("database not found: %s", name)
+	}
+
+	return nil
+}
+
+// UpdateDatabasePolicy sets the protection flag and expiry of a database
+func (s *PostgresStore) UpdateDatabasePolicy(ctx context.Context, name string, protected bool, expiresAt *time.Time) error {
+	result, err := s.pool.Exec(ctx,
+		"UPDATE pgmanager.databases SET protected = $2, expires_at = $3 WHERE name = $1",
+		name, protected, expiresAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update database policy: %w", err)
+	}
+
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("database not found: %s", name)
+	}
+
+	return nil
+}
+
+// SaveMove creates or updates the progress record of a move
+func (s *PostgresStore) SaveMove(ctx context.Context, move *Move) error {
+	copied := move.CopiedTables
+	if copied == nil {
+		copied = []string{}
+	}
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO pgmanager.moves (database_name, source, target, phase, copied_tables)
+		VALUES ($1, $2, $3, $4, $5)
+		ON CONFLICT (database_name) DO UPDATE
+		SET phase = EXCLUDED.phase, copied_tables = EXCLUDED.copied_tables, updated_at = CURRENT_TIMESTAMP
+		RETURNING started_at, updated_at`,
+		move.DatabaseName, move.Source, move.Target, move.Phase, copied,
+	).Scan(&move.StartedAt, &move.UpdatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to save move: %w", err)
+	}
+	return nil
+}
+
+// GetMove returns the in-progress move of a database, or nil if there is none
+func (s *PostgresStore) GetMove(ctx context.Context, databaseName string) (*Move, error) {
+	var m Move
+	err := s.pool.QueryRow(ctx, `
+		SELECT database_name, source, target, phase, copied_tables, started_at, updated_at
+		FROM pgmanager.moves WHERE database_name = $1`,
+		databaseName,
+	).Scan(&m.DatabaseName, &m.Source, &m.Target, &m.Phase, &m.CopiedTables, &m.StartedAt, &m.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return nil, nil
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to get move: %w", err)
+	}
+	return &m, nil
+}
+
+// DeleteMove removes the progress record of a move
+func (s *PostgresStore) DeleteMove(ctx context.Context, databaseName string) error {
+	if _, err := s.pool.Exec(ctx, "DELETE FROM pgmanager.moves WHERE database_name = $1", databaseName); err != nil {
+		return fmt.Errorf("failed to delete move: %w", err)
+	}
+	return nil
+}
+
+// CreateBackup records a backup and sets its ID
+func (s *PostgresStore) CreateBackup(ctx context.Context, backup *Backup) error {
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO pgmanager.backups (database_name, env, target, key, size, table_count, row_count, created_at)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8)
+		RETURNING id`,
+		backup.DatabaseName, backup.Env, backup.Target, backup.Key, backup.Size, backup.Tables, backup.Rows, backup.CreatedAt,
+	).Scan(&backup.ID)
+	if err != nil {
+		return fmt.Errorf("failed to create backup: %w", err)
+	}
+	return nil
+}
+
+// GetBackup retrieves a backup by ID
+func (s *PostgresStore) GetBackup(ctx context.Context, id int64) (*Backup, error) {
+	rows, err := s.pool.Query(ctx, "SELECT "+backupColumns+" FROM pgmanager.backups WHERE id = $1", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup: %w", err)
+	}
+	backups, err := scanBackupsPg(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get backup: %w", err)
+	}
+	if len(backups) == 0 {
+		return nil, nil
+	}
+	return &backups[0], nil
+}
+
+// ListBackups returns the backups of a database, newest first. An empty name lists all backups.
+func (s *PostgresStore) ListBackups(ctx context.Context, databaseName string) ([]Backup, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+backupColumns+` FROM pgmanager.backups
+		WHERE $1 = '' OR database_name = $1
+		ORDER BY created_at DESC, id DESC`,
+		databaseName,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list backups: %w", err)
+	}
+	return scanBackupsPg(rows)
+}
+
+// DeleteBackup removes a backup record
+func (s *PostgresStore) DeleteBackup(ctx context.Context, id int64) error {
+	result, err := s.pool.Exec(ctx, "DELETE FROM pgmanager.backups WHERE id = $1", id)
+	if err != nil {
+		return fmt.Errorf("failed to delete backup: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("backup not found: %d", id)
+	}
+	return nil
+}
+
+// CreateToken stores a token and sets its ID and creation time
+func (s *PostgresStore) CreateToken(ctx context.Context, token *Token) error {
+	projects := token.Projects
+	if projects == nil {
+		projects = []string{}
+	}
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO pgmanager.tokens (name, hash, scopes, projects, expires_at)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		token.Name, token.Hash, token.Scopes, projects, token.ExpiresAt,
+	).Scan(&token.ID, &token.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create token: %w", err)
+	}
+	return nil
+}
+
+// GetTokenByHash retrieves the token with the given secret hash
+func (s *PostgresStore) GetTokenByHash(ctx context.Context, hash string) (*Token, error) {
+	rows, err := s.pool.Query(ctx, "SELECT "+tokenColumns+" FROM pgmanager.tokens WHERE hash = $1", hash)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token: %w", err)
+	}
+	tokens, err := scanTokensPg(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get token: %w", err)
+	}
+	if len(tokens) == 0 {
+		return nil, nil
+	}
+	return &tokens[0], nil
+}
+
+// ListTokens returns all tokens ordered by name
+func (s *PostgresStore) ListTokens(ctx context.Context) ([]Token, error) {
+	rows, err := s.pool.Query(ctx, "SELECT "+tokenColumns+" FROM pgmanager.tokens ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list tokens: %w", err)
+	}
+	return scanTokensPg(rows)
+}
+
+// DeleteToken removes a token by name
+func (s *PostgresStore) DeleteToken(ctx context.Context, name string) error {
+	result, err := s.pool.Exec(ctx, "DELETE FROM pgmanager.tokens WHERE name = $1", name)
+	if err != nil {
+		return fmt.Errorf("failed to delete token: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("token not found: %s", name)
+	}
+	return nil
+}
+
+// UpdateTokenLastUsed records when a token was last used
+func (s *PostgresStore) UpdateTokenLastUsed(ctx context.Context, id int64, usedAt time.Time) error {
+	if _, err := s.pool.Exec(ctx, "UPDATE pgmanager.tokens SET last_used_at = $2 WHERE id = $1", id, usedAt); err != nil {
+		return fmt.Errorf("failed to update token: %w", err)
+	}
+	return nil
+}
+
+// SetAccessBinding binds a subject to a role on a project, replacing any role it had
+func (s *PostgresStore) SetAccessBinding(ctx context.Context, projectID int64, subject, role string) (*AccessBinding, error) {
+	b := &AccessBinding{ProjectID: projectID, Subject: subject, Role: role}
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO pgmanager.access_bindings (project_id, subject, role)
+		VALUES ($1, $2, $3)
+		ON CONFLICT (project_id, subject) DO UPDATE SET role = EXCLUDED.role
+		RETURNING id, created_at, (SELECT name FROM pgmanager.projects WHERE id = $1)`,
+		projectID, subject, role,
+	).Scan(&b.ID, &b.CreatedAt, &b.ProjectName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to set access binding: %w", err)
+	}
+	return b, nil
+}
+
+// DeleteAccessBinding removes the binding of a subject on a project
+func (s *PostgresStore) DeleteAccessBinding(ctx context.Context, projectID int64, subject string) error {
+	result, err := s.pool.Exec(ctx,
+		"DELETE FROM pgmanager.access_bindings WHERE project_id = $1 AND subject = $2", projectID, subject)
+	if err != nil {
+		return fmt.Errorf("failed to delete access binding: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("access binding not found: %s", subject)
+	}
+	return nil
+}
+
+// ListAccessBindings returns the bindings of a project (all projects if
+// projectID is 0) and of a subject (all subjects if subject is empty)
+func (s *PostgresStore) ListAccessBindings(ctx context.Context, projectID int64, subject string) ([]AccessBinding, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT b.id, b.project_id, p.name, b.subject, b.role, b.created_at
+		FROM pgmanager.access_bindings b
+		JOIN pgmanager.projects p ON p.id = b.project_id
+		WHERE ($1 = 0 OR b.project_id = $1) AND ($2 = '' OR b.subject = $2)
+		ORDER BY p.name, b.subject`,
+		projectID, subject,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list access bindings: %w", err)
+	}
+	defer rows.Close()
+
+	var bindings []AccessBinding
 	for rows.Next() {
-		var d Database
-		var expiresAt *time.Time
-		var prNum *int
+		var b AccessBinding
+		if err := rows.Scan(&b.ID, &b.ProjectID, &b.ProjectName, &b.Subject, &b.Role, &b.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan access binding: %w", err)
+		}
+		bindings = append(bindings, b)
+	}
+	return bindings, rows.Err()
+}
 
-		if err := rows.Scan(&d.ID, &d.ProjectID, &d.Name, &d.UserName, &d.Password, &d.Env, &prNum, &d.CreatedAt, &expiresAt); err != nil {
-			return nil, fmt.Errorf("failed to scan database: %w", err)
+// CreateAuditEvent appends an event to the audit log, setting its ID and time
+func (s *PostgresStore) CreateAuditEvent(ctx context.Context, e *AuditEvent) error {
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO pgmanager.audit_events (actor, source, request_id, action, project, target, outcome, error, detail)
+		VALUES ($1, $2, $3, $4, $5, $6, $7, $8, $9)
+		RETURNING id, created_at`,
+		e.Actor, e.Source, e.RequestID, e.Action, e.Project, e.Target, e.Outcome, e.Error, e.Detail,
+	).Scan(&e.ID, &e.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create audit event: %w", err)
+	}
+	return nil
+}
+
+// ListAuditEvents returns the events matching a filter, newest first
+func (s *PostgresStore) ListAuditEvents(ctx context.Context, f AuditFilter) ([]AuditEvent, error) {
+	var since, until *time.Time
+	if !f.Since.IsZero() {
+		since = &f.Since
+	}
+	if !f.Until.IsZero() {
+		until = &f.Until
+	}
+
+	rows, err := s.pool.Query(ctx, `
+		SELECT id, created_at, actor, source, request_id, action, project, target, outcome, error, detail
+		FROM pgmanager.audit_events
+		WHERE ($1 = '' OR project = $1)
+		  AND ($2 = '' OR actor = $2)
+		  AND ($3 = '' OR action = $3 OR action LIKE $3 || '.%')
+		  AND ($4::timestamptz IS NULL OR created_at >= $4)
+		  AND ($5::timestamptz IS NULL OR created_at < $5)
+		  AND ($6 = 0 OR id < $6)
+		ORDER BY id DESC
+		LIMIT NULLIF($7, 0)`,
+		f.Project, f.Actor, f.Action, since, until, f.BeforeID, f.Limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list audit events: %w", err)
+	}
+	defer rows.Close()
+
+	var events []AuditEvent
+	for rows.Next() {
+		var e AuditEvent
+		if err := rows.Scan(&e.ID, &e.CreatedAt, &e.Actor, &e.Source, &e.RequestID, &e.Action,
+			&e.Project, &e.Target, &e.Outcome, &e.Error, &e.Detail); err != nil {
+			return nil, fmt.Errorf("failed to scan audit event: %w", err)
+		}
+		events = append(events, e)
+	}
+	return events, rows.Err()
+}
+
+// CreateWebhook stores a webhook and sets its ID and creation time
+func (s *PostgresStore) CreateWebhook(ctx context.Context, webhook *Webhook) error {
+	events, projects := webhook.Events, webhook.Projects
+	if events == nil {
+		events = []string{}
+	}
+	if projects == nil {
+		projects = []string{}
+	}
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO pgmanager.webhooks (name, url, secret, events, projects)
+		VALUES ($1, $2, $3, $4, $5)
+		RETURNING id, created_at`,
+		webhook.Name, webhook.URL, webhook.Secret, events, projects,
+	).Scan(&webhook.ID, &webhook.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create webhook: %w", err)
+	}
+	return nil
+}
+
+// GetWebhook retrieves a webhook by name, or nil if there is none
+func (s *PostgresStore) GetWebhook(ctx context.Context, name string) (*Webhook, error) {
+	rows, err := s.pool.Query(ctx, "SELECT "+webhookColumns+" FROM pgmanager.webhooks WHERE name = $1", name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	webhooks, err := scanWebhooksPg(rows)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	if len(webhooks) == 0 {
+		return nil, nil
+	}
+	return &webhooks[0], nil
+}
+
+// ListWebhooks returns all webhooks ordered by name
+func (s *PostgresStore) ListWebhooks(ctx context.Context) ([]Webhook, error) {
+	rows, err := s.pool.Query(ctx, "SELECT "+webhookColumns+" FROM pgmanager.webhooks ORDER BY name")
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	return scanWebhooksPg(rows)
+}
+
+// DeleteWebhook removes a webhook and its deliveries by name
+func (s *PostgresStore) DeleteWebhook(ctx context.Context, name string) error {
+	result, err := s.pool.Exec(ctx, "DELETE FROM pgmanager.webhooks WHERE name = $1", name)
+	if err != nil {
+		return fmt.Errorf("failed to delete webhook: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("webhook not found: %s", name)
+	}
+	return nil
+}
+
+// CreateWebhookDelivery queues a delivery and sets its ID and times, unless
+// the webhook already has a delivery with the same key
+func (s *PostgresStore) CreateWebhookDelivery(ctx context.Context, d *WebhookDelivery) (bool, error) {
+	if d.Status == "" {
+		d.Status = "pending"
+	}
+	var nextAttemptAt *time.Time
+	if !d.NextAttemptAt.IsZero() {
+		nextAttemptAt = &d.NextAttemptAt
+	}
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO pgmanager.webhook_deliveries (webhook_id, event, key, payload, status, next_attempt_at)
+		VALUES ($1, $2, $3, $4, $5, COALESCE($6, CURRENT_TIMESTAMP))
+		ON CONFLICT (webhook_id, key) WHERE key <> '' DO NOTHING
+		RETURNING id, next_attempt_at, created_at, updated_at`,
+		d.WebhookID, d.Event, d.Key, d.Payload, d.Status, nextAttemptAt,
+	).Scan(&d.ID, &d.NextAttemptAt, &d.CreatedAt, &d.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return false, nil
+	}
+	if err != nil {
+		return false, fmt.Errorf("failed to create webhook delivery: %w", err)
+	}
+	return true, nil
+}
+
+// ClaimWebhookDeliveries returns up to limit due pending deliveries, oldest
+// first, and defers their next attempt by lease. Deliveries claimed by another
+// server are skipped.
+func (s *PostgresStore) ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error) {
+	now := time.Now()
+	rows, err := s.pool.Query(ctx, `
+		UPDATE pgmanager.webhook_deliveries SET next_attempt_at = $3
+		WHERE id IN (
+			SELECT id FROM pgmanager.webhook_deliveries
+			WHERE status = 'pending' AND next_attempt_at <= $2
+			ORDER BY next_attempt_at
+			LIMIT $1
+			FOR UPDATE SKIP LOCKED
+		)
+		RETURNING `+deliveryColumns,
+		limit, now, now.Add(lease),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to claim webhook deliveries: %w", err)
+	}
+	return scanDeliveriesPg(rows)
+}
+
+// UpdateWebhookDelivery records the outcome of a delivery attempt
+func (s *PostgresStore) UpdateWebhookDelivery(ctx context.Context, d *WebhookDelivery) error {
+	err := s.pool.QueryRow(ctx, `
+		UPDATE pgmanager.webhook_deliveries
+		SET status = $2, attempts = $3, next_attempt_at = $4, response_code = $5, error = $6, updated_at = CURRENT_TIMESTAMP
+		WHERE id = $1
+		RETURNING updated_at`,
+		d.ID, d.Status, d.Attempts, d.NextAttemptAt, d.ResponseCode, d.Error,
+	).Scan(&d.UpdatedAt)
+	if err == pgx.ErrNoRows {
+		return fmt.Errorf("webhook delivery not found: %d", d.ID)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to update webhook delivery: %w", err)
+	}
+	return nil
+}
+
+// ListWebhookDeliveries returns the deliveries of a webhook, newest first
+func (s *PostgresStore) ListWebhookDeliveries(ctx context.Context, webhookID int64, limit int) ([]WebhookDelivery, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+deliveryColumns+` FROM pgmanager.webhook_deliveries
+		WHERE webhook_id = $1
+		ORDER BY id DESC
+		LIMIT NULLIF($2, 0)`,
+		webhookID, limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list webhook deliveries: %w", err)
+	}
+	return scanDeliveriesPg(rows)
+}
+
+// PruneWebhookDeliveries removes finished deliveries last updated before a
+// time and returns how many were removed
+func (s *PostgresStore) PruneWebhookDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.pool.Exec(ctx,
+		"DELETE FROM pgmanager.webhook_deliveries WHERE status <> 'pending' AND updated_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune webhook deliveries: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// ClaimInboundDelivery records a delivery received from source and reports
+// whether it is the first time it was received
+func (s *PostgresStore) ClaimInboundDelivery(ctx context.Context, source, id string) (bool, error) {
+	result, err := s.pool.Exec(ctx, `
+		INSERT INTO pgmanager.inbound_deliveries (source, delivery_id) VALUES ($1, $2)
+		ON CONFLICT DO NOTHING`,
+		source, id,
+	)
+	if err != nil {
+		return false, fmt.Errorf("failed to claim delivery: %w", err)
+	}
+	return result.RowsAffected() == 1, nil
+}
+
+// ReleaseInboundDelivery forgets a delivery, so that it is processed again when redelivered
+func (s *PostgresStore) ReleaseInboundDelivery(ctx context.Context, source, id string) error {
+	if _, err := s.pool.Exec(ctx,
+		"DELETE FROM pgmanager.inbound_deliveries WHERE source = $1 AND delivery_id = $2", source, id); err != nil {
+		return fmt.Errorf("failed to release delivery: %w", err)
+	}
+	return nil
+}
+
+// PruneInboundDeliveries forgets deliveries received before a time and returns how many were removed
+func (s *PostgresStore) PruneInboundDeliveries(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.pool.Exec(ctx, "DELETE FROM pgmanager.inbound_deliveries WHERE received_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune deliveries: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// CreateJob stores a job and sets its ID and creation time
+func (s *PostgresStore) CreateJob(ctx context.Context, job *Job) error {
+	if job.Status == "" {
+		job.Status = "queued"
+	}
+	err := s.pool.QueryRow(ctx, `
+		INSERT INTO pgmanager.jobs (kind, project, target, params, status, total, actor)
+		VALUES ($1, $2, $3, $4, $5, $6, $7)
+		RETURNING id, created_at`,
+		job.Kind, job.Project, job.Target, job.Params, job.Status, job.Total, job.Actor,
+	).Scan(&job.ID, &job.CreatedAt)
+	if err != nil {
+		return fmt.Errorf("failed to create job: %w", err)
+	}
+	return nil
+}
+
+// GetJob returns a job, or nil if it does not exist
+func (s *PostgresStore) GetJob(ctx context.Context, id int64) (*Job, error) {
+	rows, err := s.pool.Query(ctx, "SELECT "+jobColumns+" FROM pgmanager.jobs WHERE id = $1", id)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get job: %w", err)
+	}
+	jobs, err := scanJobsPg(rows)
+	if err != nil || len(jobs) == 0 {
+		return nil, err
+	}
+	return &jobs[0], nil
+}
+
+// ListJobs returns the jobs matching a filter, newest first
+func (s *PostgresStore) ListJobs(ctx context.Context, f JobFilter) ([]Job, error) {
+	rows, err := s.pool.Query(ctx, `
+		SELECT `+jobColumns+` FROM pgmanager.jobs
+		WHERE ($1 = '' OR project = $1)
+		  AND ($2 = '' OR status = $2)
+		ORDER BY id DESC
+		LIMIT NULLIF($3, 0)`,
+		f.Project, f.Status, f.Limit,
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list jobs: %w", err)
+	}
+	return scanJobsPg(rows)
+}
+
+// UpdateJob saves the status, progress and outcome of a job
+func (s *PostgresStore) UpdateJob(ctx context.Context, job *Job) error {
+	result, err := s.pool.Exec(ctx, `
+		UPDATE pgmanager.jobs
+		SET status = $2, done = $3, total = $4, error = $5, result = $6, started_at = $7, finished_at = $8
+		WHERE id = $1`,
+		job.ID, job.Status, job.Done, job.Total, job.Error, job.Result, job.StartedAt, job.FinishedAt,
+	)
+	if err != nil {
+		return fmt.Errorf("failed to update job: %w", err)
+	}
+	if result.RowsAffected() == 0 {
+		return fmt.Errorf("job not found: %d", job.ID)
+	}
+	return nil
+}
+
+// AppendJobLog adds a line to the log of a job
+func (s *PostgresStore) AppendJobLog(ctx context.Context, jobID int64, message string) error {
+	if _, err := s.pool.Exec(ctx,
+		"INSERT INTO pgmanager.job_logs (job_id, message) VALUES ($1, $2)", jobID, message); err != nil {
+		return fmt.Errorf("failed to log job message: %w", err)
+	}
+	return nil
+}
+
+// ListJobLogs returns the log of a job, oldest first
+func (s *PostgresStore) ListJobLogs(ctx context.Context, jobID int64) ([]JobLog, error) {
+	rows, err := s.pool.Query(ctx,
+		"SELECT logged_at, message FROM pgmanager.job_logs WHERE job_id = $1 ORDER BY id", jobID)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list job logs: %w", err)
+	}
+	defer rows.Close()
+
+	var logs []JobLog
+	for rows.Next() {
+		var l JobLog
+		if err := rows.Scan(&l.Time, &l.Message); err != nil {
+			return nil, fmt.Errorf("failed to scan job log: %w", err)
+		}
+		logs = append(logs, l)
+	}
+	return logs, rows.Err()
+}
+
+// InterruptJobs fails the queued and running jobs with reason and returns how many there were
+func (s *PostgresStore) InterruptJobs(ctx context.Context, reason string) (int64, error) {
+	result, err := s.pool.Exec(ctx, `
+		UPDATE pgmanager.jobs SET status = 'failed', error = $1, finished_at = CURRENT_TIMESTAMP
+		WHERE status IN ('queued', 'running')`,
+		reason,
+	)
+	if err != nil {
+		return 0, fmt.Errorf("failed to interrupt jobs: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// PruneJobs removes jobs that finished before a time, along with their logs,
+// and returns how many were removed
+func (s *PostgresStore) PruneJobs(ctx context.Context, before time.Time) (int64, error) {
+	result, err := s.pool.Exec(ctx, "DELETE FROM pgmanager.jobs WHERE finished_at < $1", before)
+	if err != nil {
+		return 0, fmt.Errorf("failed to prune jobs: %w", err)
+	}
+	return result.RowsAffected(), nil
+}
+
+// jobColumns is the column list scanned by scanJobsPg
+const jobColumns = "id, kind, project, target, params, status, done, total, error, result, actor, created_at, started_at, finished_at"
+
+func scanJobsPg(rows pgx.Rows) ([]Job, error) {
+	defer rows.Close()
+
+	var jobs []Job
+	for rows.Next() {
+		var j Job
+		if err := rows.Scan(&j.ID, &j.Kind, &j.Project, &j.Target, &j.Params, &j.Status, &j.Done, &j.Total,
+			&j.Error, &j.Result, &j.Actor, &j.CreatedAt, &j.StartedAt, &j.FinishedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan job: %w", err)
+		}
+		jobs = append(jobs, j)
+	}
+	return jobs, rows.Err()
+}
+
+// webhookColumns is the column list scanned by scanWebhooksPg
+const webhookColumns = "id, name, url, secret, events, projects, created_at"
+
+func scanWebhooksPg(rows pgx.Rows) ([]Webhook, error) {
+	defer rows.Close()
+
+	var webhooks []Webhook
+	for rows.Next() {
+		var w Webhook
+		if err := rows.Scan(&w.ID, &w.Name, &w.URL, &w.Secret, &w.Events, &w.Projects, &w.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook: %w", err)
+		}
+		webhooks = append(webhooks, w)
+	}
+	return webhooks, rows.Err()
+}
+
+// deliveryColumns is the column list scanned by scanDeliveriesPg
+const deliveryColumns = `id, webhook_id, event, key, payload, status, attempts, next_attempt_at, response_code, error,
+	created_at, updated_at`
+
+func scanDeliveriesPg(rows pgx.Rows) ([]WebhookDelivery, error) {
+	defer rows.Close()
+
+	var deliveries []WebhookDelivery
+	for rows.Next() {
+		var d WebhookDelivery
+		if err := rows.Scan(&d.ID, &d.WebhookID, &d.Event, &d.Key, &d.Payload, &d.Status, &d.Attempts, &d.NextAttemptAt,
+			&d.ResponseCode, &d.Error, &d.CreatedAt, &d.UpdatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan webhook delivery: %w", err)
+		}
+		deliveries = append(deliveries, d)
+	}
+	return deliveries, rows.Err()
+}
+
+// tokenColumns is the column list scanned by scanTokensPg
+const tokenColumns = "id, name, hash, scopes, projects, created_at, expires_at, last_used_at"
+
+func scanTokensPg(rows pgx.Rows) ([]Token, error) {
+	defer rows.Close()
+
+	var tokens []Token
+	for rows.Next() {
+		var t Token
+		if err := rows.Scan(&t.ID, &t.Name, &t.Hash, &t.Scopes, &t.Projects, &t.CreatedAt, &t.ExpiresAt, &t.LastUsedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan token: %w", err)
 		}
+		tokens = append(tokens, t)
+	}
+	return tokens, rows.Err()
+}
+
+// backupColumns is the column list scanned by scanBackupsPg
+const backupColumns = "id, database_name, env, target, key, size, table_count, row_count, created_at"
 
-		d.PRNumber = prNum
-		d.ExpiresAt = expiresAt
+func scanBackupsPg(rows pgx.Rows) ([]Backup, error) {
+	defer rows.Close()
+
+	var backups []Backup
+	for rows.Next() {
+		var b Backup
+		if err := rows.Scan(&b.ID, &b.DatabaseName, &b.Env, &b.Target, &b.Key, &b.Size, &b.Tables, &b.Rows, &b.CreatedAt); err != nil {
+			return nil, fmt.Errorf("failed to scan backup: %w", err)
+		}
+		backups = append(backups, b)
+	}
+	return backups, rows.Err()
+}
 
-		databases = append(databases, d)
+// scanDatabasePg scans a single row selected with databaseColumns
+func scanDatabasePg(row pgx.Row) (*Database, error) {
+	var d Database
+	if err := row.Scan(&d.ID, &d.ProjectID, &d.Name, &d.UserName, &d.Password, &d.Env, &d.Server, &d.PRNumber,
+		&d.CreatedAt, &d.ExpiresAt, &d.LastActivityAt, &d.ActivityCounter, &d.Protected); err != nil {
+		return nil, err
+	}
+	return &d, nil
+}
+
+func scanDatabasesPg(rows pgx.Rows) ([]Database, error) {
+	var databases []Database
+	for rows.Next() {
+		d, err := scanDatabasePg(rows)
+		if err != nil {
+			return nil, fmt.Errorf("failed to scan database: %w", err)
+		}
+		databases = append(databases, *d)
 	}
 
 	return databases, rows.Err()
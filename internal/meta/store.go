@@ -20,9 +20,146 @@ type Database struct {
 	UserName  string
 	Password  string
 	Env       string // prod, dev, staging, pr
+	Server    string // Name of the server hosting the database
 	PRNumber  *int   // Only set for PR databases
 	CreatedAt time.Time
 	ExpiresAt *time.Time // TTL for PR databases
+	Protected bool       // Protected databases cannot be deleted or reset
+
+	LastActivityAt  *time.Time // Last time the database was seen in use, nil if never
+	ActivityCounter int64      // Transaction counter from the previous activity sample
+}
+
+// Move tracks an in-progress move of a database between servers so that a
+// failed move can be resumed or aborted
+type Move struct {
+	DatabaseName string
+	Source       string
+	Target       string
+	Phase        string   // prepare, copy, finalize, switch, cleanup
+	CopiedTables []string // Tables fully copied to the target
+	StartedAt    time.Time
+	UpdatedAt    time.Time
+}
+
+// Backup records a backup archive held by a backup target. Backups outlive the
+// database they were taken from.
+type Backup struct {
+	ID           int64
+	DatabaseName string
+	Env          string
+	Target       string // Name of the target holding the archive
+	Key          string // Location of the archive within the target
+	Size         int64
+	Tables       int
+	Rows         int64
+	CreatedAt    time.Time
+}
+
+// Token is an API token. Only a hash of the secret is stored.
+type Token struct {
+	ID         int64
+	Name       string
+	Hash       string   // Hex SHA-256 of the secret
+	Scopes     []string // read, create, delete, admin
+	Projects   []string // Projects the token is limited to; empty for all
+	CreatedAt  time.Time
+	ExpiresAt  *time.Time // nil if the token does not expire
+	LastUsedAt *time.Time // nil if never used
+}
+
+// AccessBinding grants a subject, such as a token name, a role on a project
+type AccessBinding struct {
+	ID          int64
+	ProjectID   int64
+	ProjectName string
+	Subject     string
+	Role        string // viewer, developer, maintainer, admin
+	CreatedAt   time.Time
+}
+
+// AuditEvent records a mutating operation. Events are never changed or deleted.
+type AuditEvent struct {
+	ID        int64
+	CreatedAt time.Time
+	Actor     string // Principal name, or the local user for the CLI
+	Source    string // cli, api, tui, scheduler
+	RequestID string // ID of the API request, if any
+	Action    string // Such as project.create or database.delete
+	Project   string // Project operated on, if any
+	Target    string // Database, token or other object operated on
+	Outcome   string // succeeded, failed, denied
+	Error     string // Error of failed and denied operations
+	Detail    string // Further context, such as the SQL of a query
+}
+
+// AuditFilter selects audit events. Zero fields match every event.
+type AuditFilter struct {
+	Project  string
+	Actor    string
+	Action   string // An action such as database.delete, or a prefix such as database
+	Since    time.Time
+	Until    time.Time
+	BeforeID int64 // Only events older than this one, to page through results
+	Limit    int
+}
+
+// Webhook subscribes a URL to lifecycle events
+type Webhook struct {
+	ID        int64
+	Name      string
+	URL       string
+	Secret    string   // Key of the HMAC-SHA256 signature sent with each payload
+	Events    []string // Events delivered, such as database.created; empty for all
+	Projects  []string // Projects events are delivered for; empty for all
+	CreatedAt time.Time
+}
+
+// WebhookDelivery is an event queued for, or delivered to, a webhook
+type WebhookDelivery struct {
+	ID            int64
+	WebhookID     int64
+	Event         string
+	Key           string // Identifies the event so that it is queued only once; empty for none
+	Payload       []byte // JSON body, sent as is and signed
+	Status        string // pending, succeeded, failed
+	Attempts      int
+	NextAttemptAt time.Time // When a pending delivery is attempted next
+	ResponseCode  int       // HTTP status of the last attempt, 0 if none was received
+	Error         string    // Error of the last failed attempt
+	CreatedAt     time.Time
+	UpdatedAt     time.Time
+}
+
+// Job is a long-running operation run in the background by the server
+type Job struct {
+	ID         int64
+	Kind       string // Operation, such as cleanup or backup.restore
+	Project    string // Project operated on; empty for operations on all projects
+	Target     string // Database operated on, if any
+	Params     []byte // JSON parameters of the operation
+	Status     string // queued, running, succeeded, failed, canceled
+	Done       int    // Steps done, out of Total
+	Total      int
+	Error      string
+	Result     []byte // JSON result of a succeeded job
+	Actor      string // Who started the job
+	CreatedAt  time.Time
+	StartedAt  *time.Time
+	FinishedAt *time.Time
+}
+
+// JobLog is a line logged by a job
+type JobLog struct {
+	Time    time.Time
+	Message string
+}
+
+// JobFilter selects jobs to list. Empty fields match any job.
+type JobFilter struct {
+	Project string
+	Status  string
+	Limit   int
 }
 
 // Store defines the interface for metadata storage
@@ -36,7 +173,7 @@ type Store interface {
 	DeleteProject(ctx context.Context, name string) ([]Database, error)
 
 	// Database operations
-	CreateDatabase(ctx context.Context, projectID int64, name, userName, password, env string, prNumber *int, expiresAt *time.Time) (*Database, error)
+	CreateDatabase(ctx context.Context, projectID int64, name, userName, password, env, server string, prNumber *int, expiresAt *time.Time) (*Database, error)
 	GetDatabase(ctx context.Context, projectID int64, env string, prNumber *int) (*Database, error)
 	GetDatabaseByName(ctx context.Context, name string) (*Database, error)
 	ListDatabases(ctx context.Context, projectID int64) ([]Database, error)
@@ -46,4 +183,73 @@ type Store interface {
 	// Cleanup operations
 	GetExpiredDatabases(ctx context.Context) ([]Database, error)
 	GetDatabasesOlderThan(ctx context.Context, env string, olderThan time.Duration) ([]Database, error)
+	GetIdleDatabases(ctx context.Context, env string, idleFor time.Duration) ([]Database, error)
+
+	// Activity tracking
+	UpdateDatabaseActivity(ctx context.Context, name string, lastActivityAt *time.Time, counter int64) error
+
+	// Server moves
+	UpdateDatabaseServer(ctx context.Context, name, server string) error
+
+	// Policy operations
+	UpdateDatabasePolicy(ctx context.Context, name string, protected bool, expiresAt *time.Time) error
+	SaveMove(ctx context.Context, move *Move) error
+	GetMove(ctx context.Context, databaseName string) (*Move, error)
+	DeleteMove(ctx context.Context, databaseName string) error
+
+	// Backup operations
+	CreateBackup(ctx context.Context, backup *Backup) error
+	GetBackup(ctx context.Context, id int64) (*Backup, error)
+	ListBackups(ctx context.Context, databaseName string) ([]Backup, error)
+	DeleteBackup(ctx context.Context, id int64) error
+
+	// Token operations
+	CreateToken(ctx context.Context, token *Token) error
+	GetTokenByHash(ctx context.Context, hash string) (*Token, error)
+	ListTokens(ctx context.Context) ([]Token, error)
+	DeleteToken(ctx context.Context, name string) error
+	UpdateTokenLastUsed(ctx context.Context, id int64, usedAt time.Time) error
+
+	// Access operations. Bindings are removed along with their project.
+	SetAccessBinding(ctx context.Context, projectID int64, subject, role string) (*AccessBinding, error)
+	DeleteAccessBinding(ctx context.Context, projectID int64, subject string) error
+	ListAccessBindings(ctx context.Context, projectID int64, subject string) ([]AccessBinding, error)
+
+	// Audit operations. The audit log is append-only.
+	CreateAuditEvent(ctx context.Context, event *AuditEvent) error
+	ListAuditEvents(ctx context.Context, filter AuditFilter) ([]AuditEvent, error)
+
+	// Webhook operations. Deliveries are removed along with their webhook.
+	CreateWebhook(ctx context.Context, webhook *Webhook) error
+	GetWebhook(ctx context.Context, name string) (*Webhook, error)
+	ListWebhooks(ctx context.Context) ([]Webhook, error)
+	DeleteWebhook(ctx context.Context, name string) error
+	// CreateWebhookDelivery queues a delivery. It returns false without queueing
+	// it if the webhook already has a delivery with the same non-empty key.
+	CreateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) (bool, error)
+	// ClaimWebhookDeliveries returns up to limit pending deliveries that are due
+	// and defers their next attempt by lease, so that no one else attempts them
+	ClaimWebhookDeliveries(ctx context.Context, limit int, lease time.Duration) ([]WebhookDelivery, error)
+	UpdateWebhookDelivery(ctx context.Context, delivery *WebhookDelivery) error
+	ListWebhookDeliveries(ctx context.Context, webhookID int64, limit int) ([]WebhookDelivery, error)
+	PruneWebhookDeliveries(ctx context.Context, before time.Time) (int64, error)
+
+	// Inbound delivery operations, so that each delivery of a source code host's
+	// webhook is processed once. ClaimInboundDelivery returns false if the
+	// delivery was claimed before.
+	ClaimInboundDelivery(ctx context.Context, source, id string) (bool, error)
+	ReleaseInboundDelivery(ctx context.Context, source, id string) error
+	PruneInboundDeliveries(ctx context.Context, before time.Time) (int64, error)
+
+	// Job operations. GetJob returns nil if the job does not exist, and
+	// ListJobs returns the newest first. InterruptJobs fails the queued and
+	// running jobs left by a server that stopped.
+	CreateJob(ctx context.Context, job *Job) error
+	GetJob(ctx context.Context, id int64) (*Job, error)
+	ListJobs(ctx context.Context, filter JobFilter) ([]Job, error)
+	UpdateJob(ctx context.Context, job *Job) error
+	AppendJobLog(ctx context.Context, jobID int64, message string) error
+	ListJobLogs(ctx context.Context, jobID int64) ([]JobLog, error)
+	InterruptJobs(ctx context.Context, reason string) (int64, error)
+	PruneJobs(ctx context.Context, before time.Time) (int64, error)
 }
@@ -0,0 +1,285 @@
+// Package migrate applies versioned SQL migrations to a database.
+//
+// Migrations live in a directory as pairs of files named
+// <version>_<name>.up.sql and <version>_<name>.down.sql, where version is a
+// positive integer. Down files are optional. Applied versions are recorded in
+// the public.pgmanager_migrations table of the migrated database.
+package migrate
+
+import (
+	"context"
+	"fmt"
+	"os"
+	"path/filepath"
+	"regexp"
+	"sort"
+	"strconv"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+)
+
+// fileRegex matches migration file names
+var fileRegex = regexp.MustCompile(`^(\d+)_(.+)\.(up|down)\.sql$`)
+
+// Migration is a migration found in a directory
+type Migration struct {
+	Version  int64
+	Name     string
+	UpPath   string
+	DownPath string // Empty if the migration cannot be reverted
+}
+
+// Status describes a migration and whether it has been applied. Migrations that
+// were applied but are no longer in the directory are reported with Missing set.
+type Status struct {
+	Version   int64
+	Name      string
+	AppliedAt *time.Time
+	Missing   bool
+}
+
+// Load reads the migrations in dir, sorted by version. Files that do not follow
+// the naming convention are ignored.
+func Load(dir string) ([]Migration, error) {
+	entries, err := os.ReadDir(dir)
+	if err != nil {
+		return nil, fmt.Errorf("failed to read migrations: %w", err)
+	}
+
+	byVersion := make(map[int64]*Migration)
+	for _, entry := range entries {
+		if entry.IsDir() {
+			continue
+		}
+		match := fileRegex.FindStringSubmatch(entry.Name())
+		if match == nil {
+			continue
+		}
+		version, err := strconv.ParseInt(match[1], 10, 64)
+		if err != nil || version <= 0 {
+			return nil, fmt.Errorf("invalid migration version in %s", entry.Name())
+		}
+
+		m, ok := byVersion[version]
+		if !ok {
+			m = &Migration{Version: version, Name: match[2]}
+			byVersion[version] = m
+		} else if m.Name != match[2] {
+			return nil, fmt.Errorf("migration version %d is used by both %s and %s", version, m.Name, match[2])
+		}
+
+		path := filepath.Join(dir, entry.Name())
+		if match[3] == "up" {
+			m.UpPath = path
+		} else {
+			m.DownPath = path
+		}
+	}
+
+	migrations := make([]Migration, 0, len(byVersion))
+	for _, m := range byVersion {
+		if m.UpPath == "" {
+			return nil, fmt.Errorf("migration %d_%s has no up file", m.Version, m.Name)
+		}
+		migrations = append(migrations, *m)
+	}
+	sort.Slice(migrations, func(i, j int) bool { return migrations[i].Version < migrations[j].Version })
+
+	return migrations, nil
+}
+
+// ensureTable creates the migrations table if it does not exist
+func ensureTable(ctx context.Context, conn *pgx.Conn, owner string) error {
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := setRole(ctx, tx, owner); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, `
+		CREATE TABLE IF NOT EXISTS public.pgmanager_migrations (
+			version BIGINT PRIMARY KEY,
+			name TEXT NOT NULL,
+			applied_at TIMESTAMPTZ NOT NULL DEFAULT CURRENT_TIMESTAMP
+		)`); err != nil {
+		return fmt.Errorf("failed to create migrations table: %w", err)
+	}
+
+	return tx.Commit(ctx)
+}
+
+// applied returns the applied migrations keyed by version
+func applied(ctx context.Context, conn *pgx.Conn) (map[int64]Status, error) {
+	rows, err := conn.Query(ctx, "SELECT version, name, applied_at FROM public.pgmanager_migrations")
+	if err != nil {
+		return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+	}
+	defer rows.Close()
+
+	result := make(map[int64]Status)
+	for rows.Next() {
+		var s Status
+		var appliedAt time.Time
+		if err := rows.Scan(&s.Version, &s.Name, &appliedAt); err != nil {
+			return nil, fmt.Errorf("failed to read applied migrations: %w", err)
+		}
+		s.AppliedAt = &appliedAt
+		result[s.Version] = s
+	}
+	return result, rows.Err()
+}
+
+// StatusOf reports every migration in migrations and every applied migration, sorted
+// by version. It only reads: a database without the migrations table has none applied.
+func StatusOf(ctx context.Context, conn *pgx.Conn, migrations []Migration) ([]Status, error) {
+	var exists bool
+	if err := conn.QueryRow(ctx, "SELECT to_regclass('public.pgmanager_migrations') IS NOT NULL").Scan(&exists); err != nil {
+		return nil, fmt.Errorf("failed to check migrations table: %w", err)
+	}
+	if !exists {
+		return merge(migrations, nil), nil
+	}
+
+	done, err := applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	return merge(migrations, done), nil
+}
+
+// merge combines the migrations on disk with the applied ones
+func merge(migrations []Migration, done map[int64]Status) []Status {
+	statuses := make([]Status, 0, len(migrations))
+	seen := make(map[int64]bool)
+	for _, m := range migrations {
+		s := Status{Version: m.Version, Name: m.Name}
+		if a, ok := done[m.Version]; ok {
+			s.AppliedAt = a.AppliedAt
+		}
+		statuses = append(statuses, s)
+		seen[m.Version] = true
+	}
+	for version, a := range done {
+		if !seen[version] {
+			a.Missing = true
+			statuses = append(statuses, a)
+		}
+	}
+	sort.Slice(statuses, func(i, j int) bool { return statuses[i].Version < statuses[j].Version })
+	return statuses
+}
+
+// Up applies every pending migration in version order as owner. Each migration runs
+// in its own transaction together with its version record, so a failure leaves the
+// earlier migrations applied and the failing one not. It returns the migrations applied.
+func Up(ctx context.Context, conn *pgx.Conn, owner string, migrations []Migration) ([]Migration, error) {
+	if err := ensureTable(ctx, conn, owner); err != nil {
+		return nil, err
+	}
+	done, err := applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	var result []Migration
+	for _, m := range migrations {
+		if _, ok := done[m.Version]; ok {
+			continue
+		}
+		err := run(ctx, conn, owner, m.UpPath,
+			"INSERT INTO public.pgmanager_migrations (version, name) VALUES ($1, $2)", m.Version, m.Name)
+		if err != nil {
+			return result, fmt.Errorf("migration %d_%s failed: %w", m.Version, m.Name, err)
+		}
+		result = append(result, m)
+	}
+
+	return result, nil
+}
+
+// Down reverts the most recently applied migrations, up to steps of them, newest first.
+// Every migration to revert must have a down file. It returns the migrations reverted.
+func Down(ctx context.Context, conn *pgx.Conn, owner string, migrations []Migration, steps int) ([]Migration, error) {
+	if err := ensureTable(ctx, conn, owner); err != nil {
+		return nil, err
+	}
+	done, err := applied(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+
+	byVersion := make(map[int64]Migration, len(migrations))
+	for _, m := range migrations {
+		byVersion[m.Version] = m
+	}
+
+	versions := make([]int64, 0, len(done))
+	for v := range done {
+		versions = append(versions, v)
+	}
+	sort.Slice(versions, func(i, j int) bool { return versions[i] > versions[j] })
+	if steps < len(versions) {
+		versions = versions[:steps]
+	}
+
+	var result []Migration
+	for _, v := range versions {
+		m, ok := byVersion[v]
+		if !ok {
+			return result, fmt.Errorf("applied migration %d_%s is not in the migrations directory", v, done[v].Name)
+		}
+		if m.DownPath == "" {
+			return result, fmt.Errorf("migration %d_%s has no down file", m.Version, m.Name)
+		}
+		err := run(ctx, conn, owner, m.DownPath,
+			"DELETE FROM public.pgmanager_migrations WHERE version = $1", m.Version)
+		if err != nil {
+			return result, fmt.Errorf("reverting migration %d_%s failed: %w", m.Version, m.Name, err)
+		}
+		result = append(result, m)
+	}
+
+	return result, nil
+}
+
+// run executes a migration file and a bookkeeping statement in one transaction as owner
+func run(ctx context.Context, conn *pgx.Conn, owner, path, record string, args ...any) error {
+	script, err := os.ReadFile(path)
+	if err != nil {
+		return err
+	}
+
+	tx, err := conn.Begin(ctx)
+	if err != nil {
+		return err
+	}
+	defer tx.Rollback(ctx)
+
+	if err := setRole(ctx, tx, owner); err != nil {
+		return err
+	}
+	// Without arguments the script is sent with the simple protocol, which allows several statements
+	if _, err := tx.Exec(ctx, string(script)); err != nil {
+		return err
+	}
+	if _, err := tx.Exec(ctx, record, args...); err != nil {
+		return err
+	}
+
+	return tx.Commit(ctx)
+}
+
+// setRole switches the transaction to owner so the objects it creates belong to owner
+func setRole(ctx context.Context, tx pgx.Tx, owner string) error {
+	if owner == "" {
+		return nil
+	}
+	if _, err := tx.Exec(ctx, "SET LOCAL ROLE "+pgx.Identifier{owner}.Sanitize()); err != nil {
+		return fmt.Errorf("failed to set role: %w", err)
+	}
+	return nil
+}
@@ -0,0 +1,96 @@
+package migrate
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+	"time"
+)
+
+func writeFiles(t *testing.T, names ...string) string {
+	t.Helper()
+	dir := t.TempDir()
+	for _, name := range names {
+		if err := os.WriteFile(filepath.Join(dir, name), []byte("SELECT 1;"), 0600); err != nil {
+			t.Fatalf("failed to write %s: %v", name, err)
+		}
+	}
+	return dir
+}
+
+func TestLoad(t *testing.T) {
+	dir := writeFiles(t,
+		"0002_add_email.up.sql",
+		"0001_create_users.up.sql",
+		"0001_create_users.down.sql",
+		"10_add_index.up.sql",
+		"README.md",
+	)
+
+	migrations, err := Load(dir)
+	if err != nil {
+		t.Fatalf("Load() error = %v", err)
+	}
+
+	if len(migrations) != 3 {
+		t.Fatalf("Load() returned %d migrations, want 3", len(migrations))
+	}
+	wantVersions := []int64{1, 2, 10}
+	for i, m := range migrations {
+		if m.Version != wantVersions[i] {
+			t.Errorf("migration %d version = %d, want %d", i, m.Version, wantVersions[i])
+		}
+	}
+	if migrations[0].Name != "create_users" || migrations[0].DownPath == "" {
+		t.Errorf("first migration = %+v, want create_users with a down file", migrations[0])
+	}
+	if migrations[1].DownPath != "" {
+		t.Errorf("add_email should have no down file, got %s", migrations[1].DownPath)
+	}
+}
+
+func TestLoadRejectsInvalidDirectories(t *testing.T) {
+	tests := []struct {
+		name  string
+		files []string
+	}{
+		{"duplicate version", []string{"0001_a.up.sql", "0001_b.up.sql"}},
+		{"down without up", []string{"0001_a.down.sql"}},
+		{"zero version", []string{"0_a.up.sql"}},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := Load(writeFiles(t, tt.files...)); err == nil {
+				t.Error("Load() should fail")
+			}
+		})
+	}
+
+	if _, err := Load(filepath.Join(t.TempDir(), "missing")); err == nil {
+		t.Error("Load() of a missing directory should fail")
+	}
+}
+
+func TestMerge(t *testing.T) {
+	appliedAt := time.Now()
+	migrations := []Migration{{Version: 1, Name: "a"}, {Version: 3, Name: "c"}}
+	done := map[int64]Status{
+		1: {Version: 1, Name: "a", AppliedAt: &appliedAt},
+		2: {Version: 2, Name: "b", AppliedAt: &appliedAt},
+	}
+
+	statuses := merge(migrations, done)
+	if len(statuses) != 3 {
+		t.Fatalf("merge() returned %d statuses, want 3", len(statuses))
+	}
+	if statuses[0].AppliedAt == nil || statuses[0].Missing {
+		t.Errorf("version 1 = %+v, want applied", statuses[0])
+	}
+	if !statuses[1].Missing || statuses[1].Version != 2 {
+		t.Errorf("version 2 = %+v, want applied but missing from disk", statuses[1])
+	}
+	if statuses[2].AppliedAt != nil {
+		t.Errorf("version 3 = %+v, want pending", statuses[2])
+	}
+}
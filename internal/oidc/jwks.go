@@ -0,0 +1,208 @@
+// Package oidc validates ID tokens of an OpenID Connect provider and runs the
+// authorization code flow against it, using only the standard library.
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"math/big"
+	"net/http"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// keyRefreshInterval limits how often an unknown key ID reloads the key set
+const keyRefreshInterval = time.Minute
+
+// maxDocumentSize limits the size of discovery and JWKS documents
+const maxDocumentSize = 1 << 20
+
+// jwk is a JSON Web Key; only the members of RSA and EC public keys are read
+type jwk struct {
+	Kty string `json:"kty"`
+	Kid string `json:"kid"`
+	Use string `json:"use"`
+	N   string `json:"n"`
+	E   string `json:"e"`
+	Crv string `json:"crv"`
+	X   string `json:"x"`
+	Y   string `json:"y"`
+}
+
+// ParseJWKS returns the signing keys of a JWKS document by key ID. Keys of
+// other types and encryption keys are skipped.
+func ParseJWKS(data []byte) (map[string]crypto.PublicKey, error) {
+	var doc struct {
+		Keys []jwk `json:"keys"`
+	}
+	if err := json.Unmarshal(data, &doc); err != nil {
+		return nil, fmt.Errorf("invalid JWKS: %w", err)
+	}
+
+	keys := make(map[string]crypto.PublicKey)
+	for _, k := range doc.Keys {
+		if k.Use != "" && k.Use != "sig" {
+			continue
+		}
+		key, err := k.publicKey()
+		if err != nil {
+			return nil, fmt.Errorf("invalid JWKS key '%s': %w", k.Kid, err)
+		}
+		if key != nil {
+			keys[k.Kid] = key
+		}
+	}
+	return keys, nil
+}
+
+// publicKey decodes the key, returning nil for unsupported key types
+func (k jwk) publicKey() (crypto.PublicKey, error) {
+	switch k.Kty {
+	case "RSA":
+		n, err := decodeInt(k.N)
+		if err != nil {
+			return nil, err
+		}
+		e, err := decodeInt(k.E)
+		if err != nil {
+			return nil, err
+		}
+		if !e.IsInt64() || e.Int64() > 1<<31-1 {
+			return nil, fmt.Errorf("exponent is too large")
+		}
+		return &rsa.PublicKey{N: n, E: int(e.Int64())}, nil
+
+	case "EC":
+		var curve elliptic.Curve
+		switch k.Crv {
+		case "P-256":
+			curve = elliptic.P256()
+		case "P-384":
+			curve = elliptic.P384()
+		case "P-521":
+			curve = elliptic.P521()
+		default:
+			return nil, fmt.Errorf("unsupported curve '%s'", k.Crv)
+		}
+		x, err := decodeInt(k.X)
+		if err != nil {
+			return nil, err
+		}
+		y, err := decodeInt(k.Y)
+		if err != nil {
+			return nil, err
+		}
+		if !curve.IsOnCurve(x, y) {
+			return nil, fmt.Errorf("point is not on curve %s", k.Crv)
+		}
+		return &ecdsa.PublicKey{Curve: curve, X: x, Y: y}, nil
+	}
+	return nil, nil
+}
+
+func decodeInt(s string) (*big.Int, error) {
+	b, err := base64.RawURLEncoding.DecodeString(s)
+	if err != nil || len(b) == 0 {
+		return nil, fmt.Errorf("invalid base64url integer")
+	}
+	return new(big.Int).SetBytes(b), nil
+}
+
+// KeySet holds the signing keys of an issuer, loaded from a JWKS document at a
+// URL or in a local file. Keys are loaded on first use and reloaded when a
+// token names an unknown key, so key rotation needs no restart.
+type KeySet struct {
+	source string
+	client *http.Client
+
+	mu       sync.Mutex
+	keys     map[string]crypto.PublicKey
+	loadedAt time.Time
+}
+
+// NewKeySet creates a key set loaded from source, an http(s) URL or a file path
+func NewKeySet(source string, client *http.Client) *KeySet {
+	return &KeySet{source: source, client: client}
+}
+
+// Key returns the key with the given ID. An empty ID matches the only key of
+// a set holding a single key.
+func (ks *KeySet) Key(ctx context.Context, kid string) (crypto.PublicKey, error) {
+	ks.mu.Lock()
+	defer ks.mu.Unlock()
+
+	if key := ks.lookup(kid); key != nil {
+		return key, nil
+	}
+	if ks.keys != nil && time.Since(ks.loadedAt) < keyRefreshInterval {
+		return nil, fmt.Errorf("invalid token: unknown signing key '%s'", kid)
+	}
+
+	data, err := ks.load(ctx)
+	if err != nil {
+		return nil, err
+	}
+	keys, err := ParseJWKS(data)
+	if err != nil {
+		return nil, err
+	}
+	ks.keys, ks.loadedAt = keys, time.Now()
+
+	if key := ks.lookup(kid); key != nil {
+		return key, nil
+	}
+	return nil, fmt.Errorf("invalid token: unknown signing key '%s'", kid)
+}
+
+func (ks *KeySet) lookup(kid string) crypto.PublicKey {
+	if kid == "" && len(ks.keys) == 1 {
+		for _, key := range ks.keys {
+			return key
+		}
+	}
+	return ks.keys[kid]
+}
+
+func (ks *KeySet) load(ctx context.Context) ([]byte, error) {
+	if !strings.HasPrefix(ks.source, "https://") && !strings.HasPrefix(ks.source, "http://") {
+		data, err := os.ReadFile(ks.source)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read JWKS: %w", err)
+		}
+		return data, nil
+	}
+	return fetch(ctx, ks.client, ks.source)
+}
+
+// fetch GETs a JSON document
+func fetch(ctx context.Context, client *http.Client, url string) ([]byte, error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodGet, url, nil)
+	if err != nil {
+		return nil, err
+	}
+	req.Header.Set("Accept", "application/json")
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	defer resp.Body.Close()
+
+	if resp.StatusCode != http.StatusOK {
+		return nil, fmt.Errorf("failed to fetch %s: %s", url, resp.Status)
+	}
+	data, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+	if err != nil {
+		return nil, fmt.Errorf("failed to fetch %s: %w", url, err)
+	}
+	return data, nil
+}
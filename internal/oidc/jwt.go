@@ -0,0 +1,184 @@
+package oidc
+
+import (
+	"context"
+	"crypto"
+	"crypto/ecdsa"
+	"crypto/rsa"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"math/big"
+	"slices"
+	"strings"
+	"time"
+)
+
+// clockSkew is the leeway allowed when checking token times
+const clockSkew = time.Minute
+
+// Claims are the claims of a verified token
+type Claims map[string]any
+
+// String returns a string claim, or "" if it is missing or not a string
+func (c Claims) String(name string) string {
+	s, _ := c[name].(string)
+	return s
+}
+
+// Strings returns a claim holding a string or a list of strings
+func (c Claims) Strings(name string) []string {
+	switch v := c[name].(type) {
+	case string:
+		return []string{v}
+	case []any:
+		var values []string
+		for _, item := range v {
+			if s, ok := item.(string); ok {
+				values = append(values, s)
+			}
+		}
+		return values
+	}
+	return nil
+}
+
+// Time returns a NumericDate claim
+func (c Claims) Time(name string) (time.Time, bool) {
+	switch v := c[name].(type) {
+	case float64:
+		return time.Unix(int64(v), 0), true
+	case json.Number:
+		n, err := v.Int64()
+		return time.Unix(n, 0), err == nil
+	}
+	return time.Time{}, false
+}
+
+// algorithms maps the supported JWS algorithms to their hash
+var algorithms = map[string]crypto.Hash{
+	"RS256": crypto.SHA256,
+	"RS384": crypto.SHA384,
+	"RS512": crypto.SHA512,
+	"ES256": crypto.SHA256,
+	"ES384": crypto.SHA384,
+	"ES512": crypto.SHA512,
+}
+
+// Verifier checks the signature, issuer, audience and lifetime of JWTs
+type Verifier struct {
+	keys     *KeySet
+	issuer   string
+	audience string
+	now      func() time.Time
+}
+
+// NewVerifier creates a verifier of tokens issued by issuer for audience
+func NewVerifier(keys *KeySet, issuer, audience string) *Verifier {
+	return &Verifier{keys: keys, issuer: issuer, audience: audience, now: time.Now}
+}
+
+// Verify checks a compact JWT and returns its claims. Only asymmetric
+// algorithms are accepted, so a token cannot be signed with a public key.
+func (v *Verifier) Verify(ctx context.Context, token string) (Claims, error) {
+	parts := strings.Split(token, ".")
+	if len(parts) != 3 {
+		return nil, fmt.Errorf("invalid token: malformed JWT")
+	}
+
+	var header struct {
+		Alg string `json:"alg"`
+		Kid string `json:"kid"`
+	}
+	if err := decodeSegment(parts[0], &header); err != nil {
+		return nil, fmt.Errorf("invalid token header: %w", err)
+	}
+	hash, ok := algorithms[header.Alg]
+	if !ok {
+		return nil, fmt.Errorf("invalid token: unsupported algorithm '%s'", header.Alg)
+	}
+
+	signature, err := base64.RawURLEncoding.DecodeString(parts[2])
+	if err != nil {
+		return nil, fmt.Errorf("invalid token signature: %w", err)
+	}
+	key, err := v.keys.Key(ctx, header.Kid)
+	if err != nil {
+		return nil, err
+	}
+	h := hash.New()
+	h.Write([]byte(parts[0] + "." + parts[1]))
+	if err := verifySignature(key, header.Alg, hash, h.Sum(nil), signature); err != nil {
+		return nil, err
+	}
+
+	var claims Claims
+	if err := decodeSegment(parts[1], &claims); err != nil {
+		return nil, fmt.Errorf("invalid token claims: %w", err)
+	}
+	if err := v.checkClaims(claims); err != nil {
+		return nil, err
+	}
+	return claims, nil
+}
+
+func (v *Verifier) checkClaims(claims Claims) error {
+	if iss := claims.String("iss"); iss != v.issuer {
+		return fmt.Errorf("invalid token: issued by '%s', not '%s'", iss, v.issuer)
+	}
+	if !slices.Contains(claims.Strings("aud"), v.audience) {
+		return fmt.Errorf("invalid token: not issued for '%s'", v.audience)
+	}
+
+	now := v.now()
+	exp, ok := claims.Time("exp")
+	if !ok {
+		return fmt.Errorf("invalid token: missing exp")
+	}
+	if now.After(exp.Add(clockSkew)) {
+		return fmt.Errorf("invalid token: expired at %s", exp.Format(time.RFC3339))
+	}
+	if nbf, ok := claims.Time("nbf"); ok && now.Add(clockSkew).Before(nbf) {
+		return fmt.Errorf("invalid token: not valid before %s", nbf.Format(time.RFC3339))
+	}
+	return nil
+}
+
+func verifySignature(key crypto.PublicKey, alg string, hash crypto.Hash, digest, signature []byte) error {
+	switch k := key.(type) {
+	case *rsa.PublicKey:
+		if !strings.HasPrefix(alg, "RS") {
+			break
+		}
+		if err := rsa.VerifyPKCS1v15(k, hash, digest, signature); err != nil {
+			return fmt.Errorf("invalid token: bad signature")
+		}
+		return nil
+
+	case *ecdsa.PublicKey:
+		if !strings.HasPrefix(alg, "ES") {
+			break
+		}
+		size := (k.Curve.Params().BitSize + 7) / 8
+		if len(signature) != 2*size {
+			return fmt.Errorf("invalid token: bad signature")
+		}
+		r := new(big.Int).SetBytes(signature[:size])
+		s := new(big.Int).SetBytes(signature[size:])
+		if !ecdsa.Verify(k, digest, r, s) {
+			return fmt.Errorf("invalid token: bad signature")
+		}
+		return nil
+	}
+	return fmt.Errorf("invalid token: algorithm '%s' does not match the signing key", alg)
+}
+
+func decodeSegment(segment string, v any) error {
+	data, err := base64.RawURLEncoding.DecodeString(segment)
+	if err != nil {
+		return err
+	}
+	dec := json.NewDecoder(strings.NewReader(string(data)))
+	dec.UseNumber()
+	return dec.Decode(v)
+}
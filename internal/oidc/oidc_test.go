@@ -0,0 +1,181 @@
+package oidc
+
+import (
+	"context"
+	"crypto/ecdsa"
+	"crypto/elliptic"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+	"time"
+
+	"pgmanager/internal/config"
+	"pgmanager/internal/oidc/oidctest"
+)
+
+func TestVerify(t *testing.T) {
+	iss := oidctest.NewIssuer("pgmanager", "secret")
+	defer iss.Close()
+
+	// Keys from a local file
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	if err := os.WriteFile(path, iss.JWKS(), 0600); err != nil {
+		t.Fatal(err)
+	}
+	v := NewVerifier(NewKeySet(path, http.DefaultClient), iss.URL, "pgmanager")
+	ctx := context.Background()
+
+	claims, err := v.Verify(ctx, iss.Token(map[string]any{"sub": "alice", "groups": []string{"dba", "dev"}}))
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if claims.String("sub") != "alice" || len(claims.Strings("groups")) != 2 {
+		t.Errorf("claims = %v", claims)
+	}
+
+	valid := iss.Token(map[string]any{"sub": "alice"})
+	tests := []struct {
+		name  string
+		token string
+	}{
+		{"wrong issuer", iss.Token(map[string]any{"iss": "https://evil.example.com"})},
+		{"wrong audience", iss.Token(map[string]any{"aud": "other"})},
+		{"audience list", iss.Token(map[string]any{"aud": []string{"a", "b"}})},
+		{"expired", iss.Token(map[string]any{"exp": time.Now().Add(-time.Hour).Unix()})},
+		{"no expiry", iss.Token(map[string]any{"exp": nil})},
+		{"not yet valid", iss.Token(map[string]any{"nbf": time.Now().Add(time.Hour).Unix()})},
+		{"unknown key", iss.Sign(map[string]any{"alg": "RS256", "kid": "other"}, map[string]any{"iss": iss.URL})},
+		{"alg none", unsigned(map[string]any{"alg": "none"}, map[string]any{"iss": iss.URL, "aud": "pgmanager"})},
+		{"alg HS256", iss.Sign(map[string]any{"alg": "HS256", "kid": oidctest.KeyID}, map[string]any{"iss": iss.URL})},
+		{"tampered", valid[:strings.LastIndex(valid, ".")-2] + "xx" + valid[strings.LastIndex(valid, "."):]},
+		{"malformed", "not-a-jwt"},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if _, err := v.Verify(ctx, tt.token); err == nil {
+				t.Error("Verify() should fail")
+			} else if !strings.HasPrefix(err.Error(), "invalid token") {
+				t.Errorf("error = %v, want an invalid token error", err)
+			}
+		})
+	}
+}
+
+func TestVerifyEC(t *testing.T) {
+	key, _ := ecdsa.GenerateKey(elliptic.P256(), rand.Reader)
+	jwks, _ := json.Marshal(map[string]any{"keys": []map[string]string{{
+		"kty": "EC", "kid": "ec", "crv": "P-256",
+		"x": base64.RawURLEncoding.EncodeToString(key.X.FillBytes(make([]byte, 32))),
+		"y": base64.RawURLEncoding.EncodeToString(key.Y.FillBytes(make([]byte, 32))),
+	}}})
+	path := filepath.Join(t.TempDir(), "jwks.json")
+	os.WriteFile(path, jwks, 0600)
+
+	header, _ := json.Marshal(map[string]any{"alg": "ES256", "kid": "ec"})
+	claims, _ := json.Marshal(map[string]any{"iss": "https://idp", "aud": "pgm", "exp": time.Now().Add(time.Hour).Unix()})
+	input := base64.RawURLEncoding.EncodeToString(header) + "." + base64.RawURLEncoding.EncodeToString(claims)
+	digest := sha256.Sum256([]byte(input))
+	r, s, _ := ecdsa.Sign(rand.Reader, key, digest[:])
+	signature := append(r.FillBytes(make([]byte, 32)), s.FillBytes(make([]byte, 32))...)
+	token := input + "." + base64.RawURLEncoding.EncodeToString(signature)
+
+	v := NewVerifier(NewKeySet(path, http.DefaultClient), "https://idp", "pgm")
+	if _, err := v.Verify(context.Background(), token); err != nil {
+		t.Errorf("Verify() error = %v", err)
+	}
+}
+
+func TestProviderLogin(t *testing.T) {
+	iss := oidctest.NewIssuer("pgmanager", "secret")
+	defer iss.Close()
+	iss.SetClaims(map[string]any{"sub": "42", "email": "alice@example.com", "email_verified": true, "groups": []string{"dba"}})
+
+	p := NewProvider(config.OIDCConfig{
+		Issuer:       iss.URL,
+		ClientID:     "pgmanager",
+		ClientSecret: "secret",
+		RedirectURL:  "https://pgm.example.com/auth/callback",
+	})
+	ctx := context.Background()
+
+	verifier := RandomString()
+	authURL, err := p.AuthCodeURL(ctx, "state1", "nonce1", Challenge(verifier))
+	if err != nil {
+		t.Fatalf("AuthCodeURL() error = %v", err)
+	}
+
+	// The stand-in issuer approves the login at once
+	client := &http.Client{CheckRedirect: func(*http.Request, []*http.Request) error { return http.ErrUseLastResponse }}
+	resp, err := client.Get(authURL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	resp.Body.Close()
+	callback, _ := url.Parse(resp.Header.Get("Location"))
+	if callback.Query().Get("state") != "state1" {
+		t.Fatalf("callback = %s", callback)
+	}
+
+	if _, err := p.Exchange(ctx, callback.Query().Get("code"), "wrong-verifier"); err == nil {
+		t.Error("Exchange() with the wrong PKCE verifier should fail")
+	}
+
+	resp, _ = client.Get(authURL)
+	resp.Body.Close()
+	callback, _ = url.Parse(resp.Header.Get("Location"))
+	token, err := p.Exchange(ctx, callback.Query().Get("code"), verifier)
+	if err != nil {
+		t.Fatalf("Exchange() error = %v", err)
+	}
+
+	claims, err := p.Verify(ctx, token)
+	if err != nil {
+		t.Fatalf("Verify() error = %v", err)
+	}
+	if claims.String("nonce") != "nonce1" || p.Username(claims) != "user:alice@example.com" {
+		t.Errorf("claims = %v", claims)
+	}
+	if groups := p.Groups(claims); len(groups) != 1 || groups[0] != "dba" {
+		t.Errorf("Groups() = %v", groups)
+	}
+}
+
+// unsigned builds a token with an empty signature
+func unsigned(header, claims map[string]any) string {
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	return base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c) + "."
+}
+
+func TestUsername(t *testing.T) {
+	tests := []struct {
+		name   string
+		claim  string
+		claims Claims
+		want   string
+	}{
+		{"verified e-mail", "", Claims{"sub": "42", "email": "alice@example.com", "email_verified": true}, "user:alice@example.com"},
+		{"verified as a string", "", Claims{"sub": "42", "email": "alice@example.com", "email_verified": "true"}, "user:alice@example.com"},
+		{"unverified e-mail", "", Claims{"sub": "42", "email": "alice@example.com", "email_verified": false}, "user:42"},
+		{"e-mail without verification", "", Claims{"sub": "42", "email": "alice@example.com"}, "user:42"},
+		{"configured claim", "preferred_username", Claims{"sub": "42", "preferred_username": "ci"}, "user:ci"},
+		{"no name", "preferred_username", Claims{"sub": "42"}, ""},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			p := NewProvider(config.OIDCConfig{UsernameClaim: tt.claim})
+			if got := p.Username(tt.claims); got != tt.want {
+				t.Errorf("Username() = %q, want %q", got, tt.want)
+			}
+		})
+	}
+}
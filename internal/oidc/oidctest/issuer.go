@@ -0,0 +1,227 @@
+// Package oidctest provides a stand-in OpenID Connect issuer for tests and
+// local development.
+package oidctest
+
+import (
+	"crypto"
+	"crypto/rand"
+	"crypto/rsa"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"math/big"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"sync"
+	"time"
+)
+
+// KeyID is the key ID of the issuer's signing key
+const KeyID = "oidctest"
+
+// Issuer is an OpenID Connect issuer that signs tokens with a fixed RSA key.
+// Its authorization endpoint approves every login at once, issuing an ID token
+// with the claims given to SetClaims.
+type Issuer struct {
+	*httptest.Server
+
+	ClientID     string
+	ClientSecret string
+
+	mu     sync.Mutex
+	key    *rsa.PrivateKey
+	claims map[string]any
+	codes  map[string]authorization
+}
+
+// authorization is an issued authorization code
+type authorization struct {
+	redirectURI string
+	nonce       string
+	challenge   string
+}
+
+// NewIssuer starts an issuer for a client. Close it when done.
+func NewIssuer(clientID, clientSecret string) *Issuer {
+	key, err := rsa.GenerateKey(rand.Reader, 2048)
+	if err != nil {
+		panic(err)
+	}
+
+	iss := &Issuer{
+		ClientID:     clientID,
+		ClientSecret: clientSecret,
+		key:          key,
+		claims:       map[string]any{"sub": "user", "email": "user@example.com", "email_verified": true},
+		codes:        make(map[string]authorization),
+	}
+
+	mux := http.NewServeMux()
+	mux.HandleFunc("GET /.well-known/openid-configuration", iss.handleDiscovery)
+	mux.HandleFunc("GET /jwks", iss.handleJWKS)
+	mux.HandleFunc("GET /authorize", iss.handleAuthorize)
+	mux.HandleFunc("POST /token", iss.handleToken)
+	iss.Server = httptest.NewServer(mux)
+	return iss
+}
+
+// SetClaims sets the claims of the user signing in next
+func (iss *Issuer) SetClaims(claims map[string]any) {
+	iss.mu.Lock()
+	defer iss.mu.Unlock()
+	iss.claims = claims
+}
+
+// Token signs an ID token for the client with claims added to standard ones
+// valid for an hour. Claims set to nil are removed.
+func (iss *Issuer) Token(claims map[string]any) string {
+	now := time.Now()
+	all := map[string]any{
+		"iss": iss.URL,
+		"aud": iss.ClientID,
+		"iat": now.Unix(),
+		"exp": now.Add(time.Hour).Unix(),
+	}
+	for k, v := range claims {
+		if v == nil {
+			delete(all, k)
+			continue
+		}
+		all[k] = v
+	}
+	return iss.Sign(map[string]any{"alg": "RS256", "typ": "JWT", "kid": KeyID}, all)
+}
+
+// Sign signs arbitrary header and claims with the issuer's key
+func (iss *Issuer) Sign(header, claims map[string]any) string {
+	h, _ := json.Marshal(header)
+	c, _ := json.Marshal(claims)
+	input := base64.RawURLEncoding.EncodeToString(h) + "." + base64.RawURLEncoding.EncodeToString(c)
+
+	digest := sha256.Sum256([]byte(input))
+	signature, err := rsa.SignPKCS1v15(rand.Reader, iss.key, crypto.SHA256, digest[:])
+	if err != nil {
+		panic(err)
+	}
+	return input + "." + base64.RawURLEncoding.EncodeToString(signature)
+}
+
+// JWKS returns the issuer's key set document
+func (iss *Issuer) JWKS() []byte {
+	pub := iss.key.PublicKey
+	data, _ := json.Marshal(map[string]any{
+		"keys": []map[string]string{{
+			"kty": "RSA",
+			"kid": KeyID,
+			"use": "sig",
+			"alg": "RS256",
+			"n":   base64.RawURLEncoding.EncodeToString(pub.N.Bytes()),
+			"e":   base64.RawURLEncoding.EncodeToString(big.NewInt(int64(pub.E)).Bytes()),
+		}},
+	})
+	return data
+}
+
+func (iss *Issuer) handleDiscovery(w http.ResponseWriter, r *http.Request) {
+	writeJSON(w, http.StatusOK, map[string]any{
+		"issuer":                                iss.URL,
+		"authorization_endpoint":                iss.URL + "/authorize",
+		"token_endpoint":                        iss.URL + "/token",
+		"jwks_uri":                              iss.URL + "/jwks",
+		"id_token_signing_alg_values_supported": []string{"RS256"},
+	})
+}
+
+func (iss *Issuer) handleJWKS(w http.ResponseWriter, r *http.Request) {
+	w.Header().Set("Content-Type", "application/json")
+	w.Write(iss.JWKS())
+}
+
+// handleAuthorize approves the login and redirects back with a code
+func (iss *Issuer) handleAuthorize(w http.ResponseWriter, r *http.Request) {
+	q := r.URL.Query()
+	if q.Get("client_id") != iss.ClientID || q.Get("response_type") != "code" || q.Get("redirect_uri") == "" {
+		http.Error(w, "invalid authorization request", http.StatusBadRequest)
+		return
+	}
+
+	code := randomString()
+	iss.mu.Lock()
+	iss.codes[code] = authorization{
+		redirectURI: q.Get("redirect_uri"),
+		nonce:       q.Get("nonce"),
+		challenge:   q.Get("code_challenge"),
+	}
+	iss.mu.Unlock()
+
+	redirect, err := url.Parse(q.Get("redirect_uri"))
+	if err != nil {
+		http.Error(w, "invalid redirect_uri", http.StatusBadRequest)
+		return
+	}
+	params := redirect.Query()
+	params.Set("code", code)
+	params.Set("state", q.Get("state"))
+	redirect.RawQuery = params.Encode()
+	http.Redirect(w, r, redirect.String(), http.StatusFound)
+}
+
+// handleToken redeems a code for an ID token, checking the client and PKCE
+func (iss *Issuer) handleToken(w http.ResponseWriter, r *http.Request) {
+	clientID, clientSecret, ok := r.BasicAuth()
+	if ok {
+		clientID, _ = url.QueryUnescape(clientID)
+		clientSecret, _ = url.QueryUnescape(clientSecret)
+	} else {
+		clientID, clientSecret = r.PostFormValue("client_id"), r.PostFormValue("client_secret")
+	}
+	if clientID != iss.ClientID || clientSecret != iss.ClientSecret {
+		writeJSON(w, http.StatusUnauthorized, map[string]string{"error": "invalid_client"})
+		return
+	}
+
+	code := r.PostFormValue("code")
+	iss.mu.Lock()
+	authz, found := iss.codes[code]
+	delete(iss.codes, code)
+	claims := make(map[string]any, len(iss.claims)+1)
+	for k, v := range iss.claims {
+		claims[k] = v
+	}
+	iss.mu.Unlock()
+
+	if r.PostFormValue("grant_type") != "authorization_code" || !found ||
+		r.PostFormValue("redirect_uri") != authz.redirectURI ||
+		challenge(r.PostFormValue("code_verifier")) != authz.challenge {
+		writeJSON(w, http.StatusBadRequest, map[string]string{"error": "invalid_grant"})
+		return
+	}
+
+	if authz.nonce != "" {
+		claims["nonce"] = authz.nonce
+	}
+	writeJSON(w, http.StatusOK, map[string]any{
+		"access_token": randomString(),
+		"token_type":   "Bearer",
+		"expires_in":   3600,
+		"id_token":     iss.Token(claims),
+	})
+}
+
+func writeJSON(w http.ResponseWriter, status int, v any) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(status)
+	json.NewEncoder(w).Encode(v)
+}
+
+func randomString() string {
+	b := make([]byte, 16)
+	rand.Read(b)
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+func challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
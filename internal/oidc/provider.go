@@ -0,0 +1,248 @@
+package oidc
+
+import (
+	"context"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/base64"
+	"encoding/json"
+	"fmt"
+	"io"
+	"net/http"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"pgmanager/internal/config"
+)
+
+// defaultScopes are requested at login unless api.oidc.scopes is set
+var defaultScopes = []string{"openid", "email", "profile"}
+
+// Provider is an OpenID Connect identity provider. Endpoints that are not
+// configured are discovered from the issuer's metadata on first use.
+type Provider struct {
+	cfg    config.OIDCConfig
+	client *http.Client
+
+	mu       sync.Mutex
+	verifier *Verifier
+	authURL  string
+	tokenURL string
+}
+
+// NewProvider creates a provider from api.oidc
+func NewProvider(cfg config.OIDCConfig) *Provider {
+	return &Provider{
+		cfg:      cfg,
+		client:   &http.Client{Timeout: 10 * time.Second},
+		authURL:  cfg.AuthURL,
+		tokenURL: cfg.TokenURL,
+	}
+}
+
+// UserPrefix starts the names of users, keeping them apart from token names,
+// which cannot contain a colon, where both are bound to roles
+const UserPrefix = "user:"
+
+// Username returns the name of the user a token was issued to, or "" if the
+// token names none. It is the username claim when one is configured, else the
+// e-mail address if the provider verified it, else the subject.
+func (p *Provider) Username(claims Claims) string {
+	var name string
+	switch {
+	case p.cfg.UsernameClaim != "":
+		name = claims.String(p.cfg.UsernameClaim)
+	case claims.String("email") != "" && emailVerified(claims):
+		name = claims.String("email")
+	default:
+		name = claims.String("sub")
+	}
+	if name == "" {
+		return ""
+	}
+	return UserPrefix + name
+}
+
+// emailVerified reports whether the provider verified the e-mail claim. Users
+// may be able to set unverified addresses, including other people's.
+func emailVerified(claims Claims) bool {
+	switch v := claims["email_verified"].(type) {
+	case bool:
+		return v
+	case string:
+		// Some providers send the boolean as a string
+		return v == "true"
+	}
+	return false
+}
+
+// Groups returns the groups a user belongs to
+func (p *Provider) Groups(claims Claims) []string {
+	name := p.cfg.GroupsClaim
+	if name == "" {
+		name = "groups"
+	}
+	return claims.Strings(name)
+}
+
+// Verify checks an ID token issued to pgmanager and returns its claims
+func (p *Provider) Verify(ctx context.Context, token string) (Claims, error) {
+	if err := p.discover(ctx, false); err != nil {
+		return nil, err
+	}
+	return p.verifier.Verify(ctx, token)
+}
+
+// AuthCodeURL returns the URL that starts a login. challenge is the S256 PKCE
+// challenge of the verifier later passed to Exchange.
+func (p *Provider) AuthCodeURL(ctx context.Context, state, nonce, challenge string) (string, error) {
+	if p.cfg.RedirectURL == "" {
+		return "", fmt.Errorf("api.oidc.redirect_url is not configured")
+	}
+	if err := p.discover(ctx, true); err != nil {
+		return "", err
+	}
+
+	scopes := p.cfg.Scopes
+	if len(scopes) == 0 {
+		scopes = defaultScopes
+	}
+	params := url.Values{
+		"response_type":         {"code"},
+		"client_id":             {p.cfg.ClientID},
+		"redirect_uri":          {p.cfg.RedirectURL},
+		"scope":                 {strings.Join(scopes, " ")},
+		"state":                 {state},
+		"nonce":                 {nonce},
+		"code_challenge":        {challenge},
+		"code_challenge_method": {"S256"},
+	}
+
+	sep := "?"
+	if strings.Contains(p.authURL, "?") {
+		sep = "&"
+	}
+	return p.authURL + sep + params.Encode(), nil
+}
+
+// Exchange redeems an authorization code and returns the ID token
+func (p *Provider) Exchange(ctx context.Context, code, verifier string) (string, error) {
+	if err := p.discover(ctx, true); err != nil {
+		return "", err
+	}
+
+	form := url.Values{
+		"grant_type":    {"authorization_code"},
+		"code":          {code},
+		"redirect_uri":  {p.cfg.RedirectURL},
+		"code_verifier": {verifier},
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, p.tokenURL, strings.NewReader(form.Encode()))
+	if err != nil {
+		return "", err
+	}
+	req.Header.Set("Content-Type", "application/x-www-form-urlencoded")
+	req.Header.Set("Accept", "application/json")
+	req.SetBasicAuth(url.QueryEscape(p.cfg.ClientID), url.QueryEscape(p.cfg.ClientSecret))
+
+	resp, err := p.client.Do(req)
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	defer resp.Body.Close()
+
+	body, err := io.ReadAll(io.LimitReader(resp.Body, maxDocumentSize))
+	if err != nil {
+		return "", fmt.Errorf("failed to exchange authorization code: %w", err)
+	}
+	var result struct {
+		IDToken          string `json:"id_token"`
+		Error            string `json:"error"`
+		ErrorDescription string `json:"error_description"`
+	}
+	if err := json.Unmarshal(body, &result); err != nil {
+		return "", fmt.Errorf("failed to exchange authorization code: %s", resp.Status)
+	}
+	if result.Error != "" {
+		return "", fmt.Errorf("failed to exchange authorization code: %s %s", result.Error, result.ErrorDescription)
+	}
+	if resp.StatusCode != http.StatusOK || result.IDToken == "" {
+		return "", fmt.Errorf("failed to exchange authorization code: no id_token in response (%s)", resp.Status)
+	}
+	return result.IDToken, nil
+}
+
+// discover fills in the signing keys and, if endpoints is set, the login
+// endpoints missing from the configuration using the issuer's metadata. A
+// configured JWKS is enough to verify tokens without contacting the issuer.
+func (p *Provider) discover(ctx context.Context, endpoints bool) error {
+	p.mu.Lock()
+	defer p.mu.Unlock()
+
+	missingEndpoints := endpoints && (p.authURL == "" || p.tokenURL == "")
+	if p.verifier != nil && !missingEndpoints {
+		return nil
+	}
+
+	jwks := p.cfg.JWKS
+	if (p.verifier == nil && jwks == "") || missingEndpoints {
+		data, err := fetch(ctx, p.client, strings.TrimSuffix(p.cfg.Issuer, "/")+"/.well-known/openid-configuration")
+		if err != nil {
+			return fmt.Errorf("OIDC discovery failed: %w", err)
+		}
+		var metadata struct {
+			Issuer                string `json:"issuer"`
+			AuthorizationEndpoint string `json:"authorization_endpoint"`
+			TokenEndpoint         string `json:"token_endpoint"`
+			JWKSURI               string `json:"jwks_uri"`
+		}
+		if err := json.Unmarshal(data, &metadata); err != nil {
+			return fmt.Errorf("OIDC discovery failed: %w", err)
+		}
+		if metadata.Issuer != p.cfg.Issuer {
+			return fmt.Errorf("OIDC discovery failed: metadata names issuer '%s'", metadata.Issuer)
+		}
+		if jwks == "" {
+			jwks = metadata.JWKSURI
+		}
+		if p.authURL == "" {
+			p.authURL = metadata.AuthorizationEndpoint
+		}
+		if p.tokenURL == "" {
+			p.tokenURL = metadata.TokenEndpoint
+		}
+	}
+
+	if p.verifier == nil {
+		if jwks == "" {
+			return fmt.Errorf("OIDC discovery failed: no jwks_uri")
+		}
+		audience := p.cfg.Audience
+		if audience == "" {
+			audience = p.cfg.ClientID
+		}
+		p.verifier = NewVerifier(NewKeySet(jwks, p.client), p.cfg.Issuer, audience)
+	}
+	if endpoints && (p.authURL == "" || p.tokenURL == "") {
+		return fmt.Errorf("OIDC discovery failed: no authorization or token endpoint")
+	}
+	return nil
+}
+
+// RandomString returns a random URL-safe string for states, nonces and PKCE
+// verifiers
+func RandomString() string {
+	b := make([]byte, 32)
+	if _, err := rand.Read(b); err != nil {
+		panic(err)
+	}
+	return base64.RawURLEncoding.EncodeToString(b)
+}
+
+// Challenge returns the S256 PKCE challenge of a verifier
+func Challenge(verifier string) string {
+	sum := sha256.Sum256([]byte(verifier))
+	return base64.RawURLEncoding.EncodeToString(sum[:])
+}
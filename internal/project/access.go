@@ -0,0 +1,169 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"slices"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/meta"
+)
+
+// validSubjectRegex matches subjects such as token names and the names of
+// signed-in users, e.g. user:alice@example.com
+var validSubjectRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.@+:-]{0,127}$`)
+
+// authorize checks that the caller of ctx has scope on a project. Calls
+// without a principal, such as those of the local CLI and the schedulers, are
+// always allowed.
+func authorize(ctx context.Context, scope, projectName string) error {
+	p := auth.FromContext(ctx)
+	if p == nil || p.CanOnProject(scope, projectName) {
+		return nil
+	}
+	return fmt.Errorf("%w: '%s' lacks the '%s' scope on project '%s'", auth.ErrPermissionDenied, p.Name, scope, projectName)
+}
+
+// authorizeAll checks that the caller of ctx has scope on every project, as
+// operations that span projects need
+func authorizeAll(ctx context.Context, scope string) error {
+	p := auth.FromContext(ctx)
+	if p == nil || p.CanOnAll(scope) {
+		return nil
+	}
+	return fmt.Errorf("%w: '%s' lacks the '%s' scope on every project", auth.ErrPermissionDenied, p.Name, scope)
+}
+
+// canSee reports whether the caller of ctx may list a project
+func canSee(ctx context.Context, projectName string) bool {
+	return authorize(ctx, auth.ScopeRead, projectName) == nil
+}
+
+// GrantAccess binds a subject, such as a token name, to a role on a project,
+// replacing the role it had. Granting access needs the admin role.
+func (m *Manager) GrantAccess(ctx context.Context, projectName, subject, role string) (_ *meta.AccessBinding, err error) {
+	defer func() { m.record(ctx, "access.grant", projectName, subject, err) }()
+
+	if err := auth.ValidateRole(role); err != nil {
+		return nil, err
+	}
+	if !validSubjectRegex.MatchString(subject) {
+		return nil, fmt.Errorf("invalid subject '%s'", subject)
+	}
+	if err := authorize(ctx, auth.ScopeAdmin, projectName); err != nil {
+		return nil, err
+	}
+
+	project, err := m.store.GetProject(ctx, projectName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	if project == nil {
+		return nil, fmt.Errorf("project '%s' not found", projectName)
+	}
+
+	return m.store.SetAccessBinding(ctx, project.ID, subject, role)
+}
+
+// RevokeAccess removes the role of a subject on a project
+func (m *Manager) RevokeAccess(ctx context.Context, projectName, subject string) (err error) {
+	defer func() { m.record(ctx, "access.revoke", projectName, subject, err) }()
+
+	if err := authorize(ctx, auth.ScopeAdmin, projectName); err != nil {
+		return err
+	}
+
+	project, err := m.store.GetProject(ctx, projectName)
+	if err != nil {
+		return fmt.Errorf("failed to get project: %w", err)
+	}
+	if project == nil {
+		return fmt.Errorf("project '%s' not found", projectName)
+	}
+
+	if err := m.store.DeleteAccessBinding(ctx, project.ID, subject); err != nil {
+		return fmt.Errorf("role binding of '%s' on project '%s' not found", subject, projectName)
+	}
+	return nil
+}
+
+// ListAccess returns the access bindings of a project, or of every project the
+// caller can see if projectName is empty
+func (m *Manager) ListAccess(ctx context.Context, projectName string) ([]meta.AccessBinding, error) {
+	if projectName == "" {
+		bindings, err := m.store.ListAccessBindings(ctx, 0, "")
+		if err != nil {
+			return nil, err
+		}
+		visible := bindings[:0]
+		for _, b := range bindings {
+			if canSee(ctx, b.ProjectName) {
+				visible = append(visible, b)
+			}
+		}
+		return visible, nil
+	}
+
+	if err := authorize(ctx, auth.ScopeRead, projectName); err != nil {
+		return nil, err
+	}
+
+	project, err := m.store.GetProject(ctx, projectName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	if project == nil {
+		return nil, fmt.Errorf("project '%s' not found", projectName)
+	}
+	return m.store.ListAccessBindings(ctx, project.ID, "")
+}
+
+// principalRoles returns the roles of a subject by project, or nil if it has no bindings
+func (m *Manager) principalRoles(ctx context.Context, subject string) (map[string]string, error) {
+	bindings, err := m.store.ListAccessBindings(ctx, 0, subject)
+	if err != nil {
+		return nil, err
+	}
+	if len(bindings) == 0 {
+		return nil, nil
+	}
+	roles := make(map[string]string, len(bindings))
+	for _, b := range bindings {
+		roles[b.ProjectName] = b.Role
+	}
+	return roles, nil
+}
+
+// UserPrincipal returns the principal of a user signed in with the identity
+// provider. Its role on each project is the highest of api.oidc.default_role,
+// the roles api.oidc.group_roles grant its groups and its access bindings.
+func (m *Manager) UserPrincipal(ctx context.Context, name string, groups []string) (*auth.Principal, error) {
+	oidc := m.cfg.API.OIDC
+	p := &auth.Principal{
+		Name:        name,
+		Scopes:      []string{auth.ScopeAdmin},
+		Roles:       make(map[string]string),
+		DefaultRole: oidc.DefaultRole,
+	}
+
+	for _, gr := range oidc.GroupRoles {
+		if !slices.Contains(groups, gr.Group) {
+			continue
+		}
+		if gr.Project == "" {
+			p.DefaultRole = auth.HigherRole(p.DefaultRole, gr.Role)
+		} else {
+			p.Roles[gr.Project] = auth.HigherRole(p.Roles[gr.Project], gr.Role)
+		}
+	}
+
+	roles, err := m.principalRoles(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	for project, role := range roles {
+		p.Roles[project] = auth.HigherRole(p.Roles[project], role)
+	}
+	return p, nil
+}
@@ -0,0 +1,130 @@
+package project
+
+import (
+	"context"
+	"sync"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"pgmanager/internal/db"
+)
+
+// statsDelay is how long PostgreSQL may take to report the transactions of
+// a session in pg_stat_database after it ended
+const statsDelay = 10 * time.Second
+
+// workTracker remembers which databases pgmanager itself has been working on, so
+// that the activity sampler does not take the transactions of backups, dumps,
+// migrations and the like for use by applications. Only the work of this
+// process is seen.
+type workTracker struct {
+	mu      sync.Mutex
+	active  map[string]int       // Operations in progress per database
+	ended   map[string]time.Time // When the last operation on each database ended
+	sampled time.Time            // When activity was last sampled
+}
+
+func newWorkTracker() *workTracker {
+	return &workTracker{active: make(map[string]int), ended: make(map[string]time.Time)}
+}
+
+// begin marks dbName as being worked on until end is called
+func (w *workTracker) begin(dbName string) (end func()) {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	w.active[dbName]++
+
+	var once sync.Once
+	return func() {
+		once.Do(func() {
+			w.mu.Lock()
+			defer w.mu.Unlock()
+			if w.active[dbName]--; w.active[dbName] == 0 {
+				delete(w.active, dbName)
+			}
+			w.ended[dbName] = time.Now()
+		})
+	}
+}
+
+// sample starts a new sampling round at now and returns when the previous
+// one started, or the zero time for the first
+func (w *workTracker) sample(now time.Time) time.Time {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	prev := w.sampled
+	w.sampled = now
+	for dbName, ended := range w.ended {
+		if ended.Before(prev.Add(-statsDelay)) {
+			delete(w.ended, dbName)
+		}
+	}
+	return prev
+}
+
+// workedSince reports whether dbName is being worked on, or was recently enough
+// before t that its transactions may only be reported after t
+func (w *workTracker) workedSince(dbName string, t time.Time) bool {
+	w.mu.Lock()
+	defer w.mu.Unlock()
+	ended, ok := w.ended[dbName]
+	return w.active[dbName] > 0 || (ok && !ended.Before(t.Add(-statsDelay)))
+}
+
+// trackedServer records pgmanager's own work on the databases of a server.
+// Connections count as work until they are closed. Methods that only connect
+// to the server's maintenance database are passed through.
+type trackedServer struct {
+	pgServer
+	work *workTracker
+}
+
+func (s trackedServer) ConnectDatabase(ctx context.Context, dbName string) (*pgx.Conn, error) {
+	end := s.work.begin(dbName)
+	conn, err := s.pgServer.ConnectDatabase(ctx, dbName)
+	if err != nil {
+		end()
+		return nil, err
+	}
+	go func() {
+		<-conn.PgConn().CleanupDone()
+		end()
+	}()
+	return conn, nil
+}
+
+func (s trackedServer) DropSchemas(ctx context.Context, dbName, owner string) error {
+	defer s.work.begin(dbName)()
+	return s.pgServer.DropSchemas(ctx, dbName, owner)
+}
+
+func (s trackedServer) RunSQL(ctx context.Context, dbName, role, script string) error {
+	defer s.work.begin(dbName)()
+	return s.pgServer.RunSQL(ctx, dbName, role, script)
+}
+
+func (s trackedServer) DatabaseSettings(ctx context.Context, dbName string) (*db.DatabaseSettings, error) {
+	defer s.work.begin(dbName)()
+	return s.pgServer.DatabaseSettings(ctx, dbName)
+}
+
+func (s trackedServer) CreateExtension(ctx context.Context, dbName, extension string) error {
+	defer s.work.begin(dbName)()
+	return s.pgServer.CreateExtension(ctx, dbName, extension)
+}
+
+func (s trackedServer) CreateAccessRole(ctx context.Context, dbName, owner, role, password, access string) error {
+	defer s.work.begin(dbName)()
+	return s.pgServer.CreateAccessRole(ctx, dbName, owner, role, password, access)
+}
+
+func (s trackedServer) SetRoleAccess(ctx context.Context, dbName, owner, role, access string) error {
+	defer s.work.begin(dbName)()
+	return s.pgServer.SetRoleAccess(ctx, dbName, owner, role, access)
+}
+
+func (s trackedServer) DropAccessRole(ctx context.Context, dbName, owner, role string) error {
+	defer s.work.begin(dbName)()
+	return s.pgServer.DropAccessRole(ctx, dbName, owner, role)
+}
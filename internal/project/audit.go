@@ -0,0 +1,120 @@
+package project
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"os"
+	"os/user"
+	"sync"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/meta"
+)
+
+// Outcomes of audited operations
+const (
+	OutcomeSucceeded = "succeeded"
+	OutcomeFailed    = "failed"
+	OutcomeDenied    = "denied"
+)
+
+// MaxAuditEvents limits the events returned by one ListAudit call
+const MaxAuditEvents = 1000
+
+var (
+	localUserOnce sync.Once
+	localUserName string
+)
+
+// localUser returns the name of the user running the CLI
+func localUser() string {
+	localUserOnce.Do(func() {
+		if u, err := user.Current(); err == nil && u.Username != "" {
+			localUserName = u.Username
+		} else if name := os.Getenv("USER"); name != "" {
+			localUserName = name
+		} else {
+			localUserName = "unknown"
+		}
+	})
+	return localUserName
+}
+
+// actor returns the name recorded as the caller of ctx: its principal or, for
+// calls without one, the local user or the scheduler
+func actor(ctx context.Context, origin auth.Origin) string {
+	if p := auth.FromContext(ctx); p != nil {
+		return p.Name
+	}
+	if origin.Source == auth.SourceScheduler {
+		return auth.SourceScheduler
+	}
+	return localUser()
+}
+
+// record appends an event for a mutating operation to the audit log. Recording
+// never fails the operation; errors are only reported.
+func (m *Manager) record(ctx context.Context, action, projectName, target string, err error) {
+	m.recordDetail(ctx, action, projectName, target, "", err)
+}
+
+// recordDetail records an operation like record, with further context such as
+// the SQL of a query
+func (m *Manager) recordDetail(ctx context.Context, action, projectName, target, detail string, err error) {
+	origin := auth.OriginFromContext(ctx)
+	event := &meta.AuditEvent{
+		Actor:     actor(ctx, origin),
+		Source:    origin.Source,
+		RequestID: origin.RequestID,
+		Action:    action,
+		Project:   projectName,
+		Target:    target,
+		Outcome:   OutcomeSucceeded,
+		Detail:    detail,
+	}
+	if err != nil {
+		event.Outcome = OutcomeFailed
+		if errors.Is(err, auth.ErrPermissionDenied) {
+			event.Outcome = OutcomeDenied
+		}
+		event.Error = err.Error()
+	}
+
+	// The operation's context may be canceled already, which must not lose its event
+	if err := m.store.CreateAuditEvent(context.WithoutCancel(ctx), event); err != nil {
+		fmt.Printf("Warning: failed to record %s of %s: %v\n", action, target, err)
+	}
+}
+
+// projectNames maps project IDs to names, for recording operations that
+// start from database records
+func (m *Manager) projectNames(ctx context.Context) map[int64]string {
+	names := make(map[int64]string)
+	projects, err := m.store.ListProjects(ctx)
+	if err != nil {
+		return names
+	}
+	for _, p := range projects {
+		names[p.ID] = p.Name
+	}
+	return names
+}
+
+// ListAudit returns the audit events matching a filter, newest first. Reading
+// the events of a project needs the read scope on it, and reading those of
+// every project needs it on all projects.
+func (m *Manager) ListAudit(ctx context.Context, filter meta.AuditFilter) ([]meta.AuditEvent, error) {
+	if filter.Project != "" {
+		if err := authorize(ctx, auth.ScopeRead, filter.Project); err != nil {
+			return nil, err
+		}
+	} else if err := authorizeAll(ctx, auth.ScopeRead); err != nil {
+		return nil, err
+	}
+
+	if filter.Limit <= 0 || filter.Limit > MaxAuditEvents {
+		filter.Limit = MaxAuditEvents
+	}
+	return m.store.ListAuditEvents(ctx, filter)
+}
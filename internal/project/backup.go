@@ -0,0 +1,331 @@
+package project
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io"
+	"time"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/db"
+	"pgmanager/internal/meta"
+)
+
+// errNoBackupTarget is returned by backup operations when backups are not configured
+var errNoBackupTarget = errors.New("no backup target configured (set backups.dir)")
+
+// BackupRunResult describes the outcome of a backup run
+type BackupRunResult struct {
+	Created []meta.Backup
+	Pruned  []meta.Backup
+	Failed  []BackupFailure
+}
+
+// BackupFailure reports a database that could not be backed up
+type BackupFailure struct {
+	DatabaseName string
+	Error        string
+}
+
+// BackupDatabase writes a backup of a managed database to the backup target
+func (m *Manager) BackupDatabase(ctx context.Context, projectName, env string, prNumber *int) (_ *meta.Backup, err error) {
+	defer func() { m.record(ctx, "backup.create", projectName, DatabaseName(projectName, env, prNumber), err) }()
+
+	if err := authorize(ctx, auth.ScopeCreate, projectName); err != nil {
+		return nil, err
+	}
+
+	dbRecord, err := m.findDatabase(ctx, projectName, env, prNumber)
+	if err != nil {
+		return nil, err
+	}
+	return m.backupDatabase(ctx, dbRecord)
+}
+
+// backupDatabase streams a dump of dbRecord into the backup target and records it
+func (m *Manager) backupDatabase(ctx context.Context, dbRecord *meta.Database) (*meta.Backup, error) {
+	if m.backups == nil {
+		return nil, errNoBackupTarget
+	}
+
+	// Nanoseconds keep backups taken in the same second apart; the target
+	// refuses to overwrite a key in any case
+	createdAt := time.Now().UTC()
+	key := fmt.Sprintf("%s/%s.dump.gz", dbRecord.Name, createdAt.Format("20060102T150405.000000000Z"))
+
+	type dumpResult struct {
+		stats *db.DumpStats
+		err   error
+	}
+	done := make(chan dumpResult, 1)
+	pr, pw := io.Pipe()
+	go func() {
+		stats, err := m.dumpDatabase(ctx, dbRecord, pw)
+		pw.CloseWithError(err)
+		done <- dumpResult{stats, err}
+	}()
+
+	size, err := m.backups.Write(ctx, key, pr)
+	// Unblock the dump if the target gave up early
+	pr.CloseWithError(err)
+	dump := <-done
+	if dump.err != nil {
+		_ = m.backups.Delete(ctx, key)
+		return nil, fmt.Errorf("failed to back up %s: %w", dbRecord.Name, dump.err)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("failed to back up %s: %w", dbRecord.Name, err)
+	}
+
+	record := &meta.Backup{
+		DatabaseName: dbRecord.Name,
+		Env:          dbRecord.Env,
+		Target:       m.backups.Name(),
+		Key:          key,
+		Size:         size,
+		Tables:       dump.stats.Tables,
+		Rows:         dump.stats.Rows,
+		CreatedAt:    createdAt,
+	}
+	if err := m.store.CreateBackup(ctx, record); err != nil {
+		_ = m.backups.Delete(ctx, key)
+		return nil, err
+	}
+
+	return record, nil
+}
+
+// ListBackups returns the backups of a project environment, newest first, including
+// backups of databases that have since been deleted. An empty project lists all backups.
+func (m *Manager) ListBackups(ctx context.Context, projectName, env string, prNumber *int) ([]meta.Backup, error) {
+	if projectName == "" {
+		backups, err := m.store.ListBackups(ctx, "")
+		if err != nil {
+			return nil, err
+		}
+		visible := backups[:0]
+		for _, b := range backups {
+			if CanAccessDatabase(auth.FromContext(ctx), b.DatabaseName) {
+				visible = append(visible, b)
+			}
+		}
+		return visible, nil
+	}
+	if err := authorize(ctx, auth.ScopeRead, projectName); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateEnv(env); err != nil {
+		return nil, err
+	}
+	return m.store.ListBackups(ctx, DatabaseName(projectName, env, prNumber))
+}
+
+// RestoreBackup restores a backup into a managed database, following the same rules as RestoreDatabase
+func (m *Manager) RestoreBackup(ctx context.Context, id int64, projectName, env string, prNumber *int) (_ *RestoreResult, err error) {
+	defer func() { m.record(ctx, "backup.restore", projectName, DatabaseName(projectName, env, prNumber), err) }()
+
+	if err := authorize(ctx, auth.ScopeCreate, projectName); err != nil {
+		return nil, err
+	}
+
+	b, err := m.findBackup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+
+	r, err := m.backups.Open(ctx, b.Key)
+	if err != nil {
+		return nil, err
+	}
+	defer r.Close()
+
+	return m.RestoreDatabase(ctx, projectName, env, prNumber, r)
+}
+
+// findBackup returns a backup the caller of ctx may see, stored on the configured target
+func (m *Manager) findBackup(ctx context.Context, id int64) (*meta.Backup, error) {
+	b, err := m.store.GetBackup(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if b == nil || !CanAccessDatabase(auth.FromContext(ctx), b.DatabaseName) {
+		return nil, fmt.Errorf("backup %d not found", id)
+	}
+	if m.backups == nil || m.backups.Name() != b.Target {
+		return nil, fmt.Errorf("backup %d is stored on target '%s', which is not configured", id, b.Target)
+	}
+	return b, nil
+}
+
+// RunBackups backs up the databases of every environment with a backup schedule and
+// prunes backups outside each schedule's retention policy. Unless force is set, only
+// databases without a backup since the schedule's last run time are backed up.
+// A failure to back up one database does not stop the others.
+func (m *Manager) RunBackups(ctx context.Context, force bool) (*BackupRunResult, error) {
+	if err := authorizeAll(ctx, auth.ScopeCreate); err != nil {
+		return nil, err
+	}
+
+	if err := m.checkBackupConfig(); err != nil {
+		return nil, err
+	}
+	schedules := m.cfg.Backups.Schedules
+
+	databases, err := m.store.ListAllDatabases(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list databases: %w", err)
+	}
+
+	result := &BackupRunResult{}
+	projectNames := m.projectNames(ctx)
+	now := time.Now()
+	total, done := len(schedules)*len(databases), 0
+	for _, schedule := range schedules {
+		lastRun := schedule.LastRun(now)
+		for i := range databases {
+			reportProgress(ctx, done, total)
+			done++
+			if err := ctx.Err(); err != nil {
+				return nil, err
+			}
+			dbRecord := &databases[i]
+			if dbRecord.Env != schedule.Env {
+				continue
+			}
+
+			if !force {
+				existing, err := m.store.ListBackups(ctx, dbRecord.Name)
+				if err != nil {
+					return nil, err
+				}
+				if len(existing) > 0 && !existing[0].CreatedAt.Before(lastRun) {
+					continue
+				}
+			}
+
+			b, err := m.backupDatabase(ctx, dbRecord)
+			m.record(ctx, "backup.create", projectNames[dbRecord.ProjectID], dbRecord.Name, err)
+			if err != nil {
+				logJob(ctx, "Failed to back up %s: %v", dbRecord.Name, err)
+				result.Failed = append(result.Failed, BackupFailure{DatabaseName: dbRecord.Name, Error: err.Error()})
+				continue
+			}
+			logJob(ctx, "Backed up %s to %s", dbRecord.Name, b.Key)
+			result.Created = append(result.Created, *b)
+		}
+
+		pruned, err := m.pruneBackups(ctx, schedule.Env, schedule.KeepDaily, schedule.KeepWeekly)
+		if err != nil {
+			return nil, err
+		}
+		for _, b := range pruned {
+			m.record(ctx, "backup.prune", "", b.DatabaseName, nil)
+		}
+		result.Pruned = append(result.Pruned, pruned...)
+	}
+
+	return result, nil
+}
+
+// checkBackupConfig checks that backup runs have schedules and a target
+func (m *Manager) checkBackupConfig() error {
+	if len(m.cfg.Backups.Schedules) == 0 {
+		return fmt.Errorf("no backup schedules configured")
+	}
+	if m.backups == nil {
+		return errNoBackupTarget
+	}
+	return nil
+}
+
+// RunBackupScheduler runs due backups every interval until ctx is cancelled
+func (m *Manager) RunBackupScheduler(ctx context.Context, interval time.Duration) {
+	ctx = auth.WithOrigin(ctx, auth.Origin{Source: auth.SourceScheduler})
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		result, err := m.RunBackups(ctx, false)
+		if err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		} else {
+			for _, b := range result.Created {
+				fmt.Printf("Backed up %s to %s\n", b.DatabaseName, b.Key)
+			}
+			for _, f := range result.Failed {
+				fmt.Printf("Warning: %s\n", f.Error)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// pruneBackups deletes the backups of an environment that fall outside the retention policy
+func (m *Manager) pruneBackups(ctx context.Context, env string, keepDaily, keepWeekly int) ([]meta.Backup, error) {
+	all, err := m.store.ListBackups(ctx, "")
+	if err != nil {
+		return nil, err
+	}
+
+	// Retention applies to each database separately
+	byDatabase := make(map[string][]meta.Backup)
+	for _, b := range all {
+		if b.Env == env && b.Target == m.backups.Name() {
+			byDatabase[b.DatabaseName] = append(byDatabase[b.DatabaseName], b)
+		}
+	}
+
+	var pruned []meta.Backup
+	for _, backups := range byDatabase {
+		for _, b := range expiredBackups(backups, keepDaily, keepWeekly) {
+			if err := m.backups.Delete(ctx, b.Key); err != nil {
+				return pruned, err
+			}
+			if err := m.store.DeleteBackup(ctx, b.ID); err != nil {
+				return pruned, err
+			}
+			pruned = append(pruned, b)
+		}
+	}
+
+	return pruned, nil
+}
+
+// expiredBackups returns the backups outside the retention policy. backups must be
+// sorted newest first. The newest backup of each of the keepDaily most recent days
+// and of each of the keepWeekly most recent ISO weeks is kept.
+func expiredBackups(backups []meta.Backup, keepDaily, keepWeekly int) []meta.Backup {
+	days := make(map[string]bool)
+	weeks := make(map[string]bool)
+
+	var expired []meta.Backup
+	for _, b := range backups {
+		t := b.CreatedAt.UTC()
+		keep := false
+
+		day := t.Format("2006-01-02")
+		if !days[day] && len(days) < keepDaily {
+			days[day] = true
+			keep = true
+		}
+
+		year, week := t.ISOWeek()
+		weekKey := fmt.Sprintf("%d-%02d", year, week)
+		if !weeks[weekKey] && len(weeks) < keepWeekly {
+			weeks[weekKey] = true
+			keep = true
+		}
+
+		if !keep {
+			expired = append(expired, b)
+		}
+	}
+	return expired
+}
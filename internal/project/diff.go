@@ -0,0 +1,45 @@
+package project
+
+import (
+	"context"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/db"
+)
+
+// DiffDatabases compares the schemas of two environments of a project. The
+// statements of the result turn the schema of the first into that of the second.
+func (m *Manager) DiffDatabases(ctx context.Context, projectName, fromEnv string, fromPR *int, toEnv string, toPR *int) (*db.SchemaDiff, error) {
+	if err := authorize(ctx, auth.ScopeRead, projectName); err != nil {
+		return nil, err
+	}
+
+	for _, env := range []string{fromEnv, toEnv} {
+		if err := ValidateEnv(env); err != nil {
+			return nil, err
+		}
+	}
+
+	from, err := m.databaseSchema(ctx, projectName, fromEnv, fromPR)
+	if err != nil {
+		return nil, err
+	}
+	to, err := m.databaseSchema(ctx, projectName, toEnv, toPR)
+	if err != nil {
+		return nil, err
+	}
+	return db.DiffSchemas(from, to), nil
+}
+
+// databaseSchema reads the schema of a managed database
+func (m *Manager) databaseSchema(ctx context.Context, projectName, env string, prNumber *int) (*db.Schema, error) {
+	dbRecord, err := m.findDatabase(ctx, projectName, env, prNumber)
+	if err != nil {
+		return nil, err
+	}
+	pg, err := m.client(dbRecord.Server)
+	if err != nil {
+		return nil, err
+	}
+	return readSchema(ctx, pg, dbRecord.Name)
+}
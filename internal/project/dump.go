@@ -0,0 +1,161 @@
+package project
+
+import (
+	"bufio"
+	"compress/gzip"
+	"context"
+	"fmt"
+	"io"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/db"
+	"pgmanager/internal/meta"
+)
+
+// RestoreResult describes the outcome of a restore
+type RestoreResult struct {
+	DatabaseName string
+	Source       string // Name of the database the dump was taken from
+	Created      bool   // Whether the database was created for the restore
+	Tables       int
+	Rows         int64
+}
+
+// DumpDatabase writes a gzip-compressed dump of a managed database's schema and data to w
+func (m *Manager) DumpDatabase(ctx context.Context, projectName, env string, prNumber *int, w io.Writer) (*db.DumpStats, error) {
+	if err := authorize(ctx, auth.ScopeAdmin, projectName); err != nil {
+		return nil, err
+	}
+
+	dbRecord, err := m.findDatabase(ctx, projectName, env, prNumber)
+	if err != nil {
+		return nil, err
+	}
+	return m.dumpDatabase(ctx, dbRecord, w)
+}
+
+// dumpDatabase writes a gzip-compressed dump of dbRecord to w
+func (m *Manager) dumpDatabase(ctx context.Context, dbRecord *meta.Database, w io.Writer) (*db.DumpStats, error) {
+	pg, err := m.client(dbRecord.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := pg.ConnectDatabase(ctx, dbRecord.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	gz := gzip.NewWriter(w)
+	stats, err := db.WriteDump(ctx, conn, dbRecord.Name, gz)
+	if err != nil {
+		return nil, err
+	}
+	if err := gz.Close(); err != nil {
+		return nil, fmt.Errorf("failed to write dump: %w", err)
+	}
+
+	return stats, nil
+}
+
+// RestoreDatabase loads a dump written by DumpDatabase into a managed database.
+// The dump may come from any project or environment. The database is created if
+// it does not exist yet; an existing database must not contain any tables.
+func (m *Manager) RestoreDatabase(ctx context.Context, projectName, env string, prNumber *int, r io.Reader) (_ *RestoreResult, err error) {
+	defer func() { m.record(ctx, "database.restore", projectName, DatabaseName(projectName, env, prNumber), err) }()
+
+	if err := authorize(ctx, auth.ScopeCreate, projectName); err != nil {
+		return nil, err
+	}
+
+	if err := ValidateEnv(env); err != nil {
+		return nil, err
+	}
+
+	header, br, gz, err := openDump(r)
+	if err != nil {
+		return nil, err
+	}
+	defer gz.Close()
+
+	project, err := m.store.GetProject(ctx, projectName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	if project == nil {
+		return nil, fmt.Errorf("project '%s' not found", projectName)
+	}
+
+	result := &RestoreResult{Source: header.Database}
+	dbRecord, err := m.store.GetDatabase(ctx, project.ID, env, prNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+	if dbRecord == nil {
+		// The dump brings its own schema, so the project scripts are not run
+		if _, err := m.createDatabase(ctx, projectName, env, prNumber, "", false); err != nil {
+			return nil, err
+		}
+		if dbRecord, err = m.store.GetDatabase(ctx, project.ID, env, prNumber); err != nil {
+			return nil, fmt.Errorf("failed to get database: %w", err)
+		}
+		result.Created = true
+	}
+	result.DatabaseName = dbRecord.Name
+
+	stats, err := m.restoreInto(ctx, dbRecord.Server, dbRecord.Name, dbRecord.UserName, header, br)
+	if err != nil {
+		if result.Created {
+			if discardErr := m.discardDatabase(ctx, projectName, dbRecord); discardErr != nil {
+				return nil, fmt.Errorf("%w (and failed to remove %s: %v)", err, dbRecord.Name, discardErr)
+			}
+		}
+		return nil, err
+	}
+
+	result.Tables = stats.Tables
+	result.Rows = stats.Rows
+	return result, nil
+}
+
+// openDump reads the header of a dump written by DumpDatabase. The returned
+// reader continues after the header; gz must be closed once it is read.
+func openDump(r io.Reader) (_ *db.DumpHeader, _ *bufio.Reader, gz *gzip.Reader, err error) {
+	gz, err = gzip.NewReader(r)
+	if err != nil {
+		return nil, nil, nil, fmt.Errorf("%w: not a pgmanager dump: %w", db.ErrInvalidDump, err)
+	}
+
+	br := bufio.NewReader(gz)
+	header, err := db.ReadDumpHeader(br)
+	if err != nil {
+		gz.Close()
+		return nil, nil, nil, err
+	}
+	return header, br, gz, nil
+}
+
+// restoreInto restores a dump into an existing, empty database
+func (m *Manager) restoreInto(ctx context.Context, server, dbName, owner string, header *db.DumpHeader, br *bufio.Reader) (*db.DumpStats, error) {
+	pg, err := m.client(server)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := pg.ConnectDatabase(ctx, dbName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	existing, err := db.ReadSchema(ctx, conn)
+	if err != nil {
+		return nil, err
+	}
+	if len(existing.Tables) > 0 {
+		return nil, fmt.Errorf("database %s is not empty", dbName)
+	}
+
+	return db.RestoreDump(ctx, conn, owner, header, br)
+}
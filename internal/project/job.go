@@ -0,0 +1,733 @@
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"os"
+	"sync"
+	"time"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/manifest"
+	"pgmanager/internal/meta"
+)
+
+// Kinds of jobs, named after the operations they run
+const (
+	JobCleanup       = "cleanup"
+	JobBackupRun     = "backup.run"
+	JobBackupCreate  = "backup.create"
+	JobBackupRestore = "backup.restore"
+	JobRestore       = "database.restore"
+	JobMove          = "database.move"
+	JobMigrate       = "database.migrate"
+	JobMigrateDown   = "database.migrate_down"
+	JobApply         = "manifest.apply"
+)
+
+// Statuses of jobs
+const (
+	JobQueued    = "queued"
+	JobRunning   = "running"
+	JobSucceeded = "succeeded"
+	JobFailed    = "failed"
+	JobCanceled  = "canceled"
+)
+
+const (
+	// MaxQueuedJobs limits the jobs waiting for a worker
+	MaxQueuedJobs = 100
+
+	// MaxJobs limits the jobs returned by one ListJobs call
+	MaxJobs = 1000
+
+	// jobHistory is how long finished jobs and their logs are kept
+	jobHistory = 30 * 24 * time.Hour
+
+	// jobPruneInterval is how often finished jobs are pruned
+	jobPruneInterval = time.Hour
+)
+
+var (
+	// errJobCanceled is the cause of jobs canceled by CancelJob
+	errJobCanceled = errors.New("job canceled")
+
+	// errJobsStopped is the cause of jobs interrupted by the server stopping
+	errJobsStopped = errors.New("server stopped")
+)
+
+// JobRequest describes an operation to run as a job. Which fields are used
+// depends on the kind.
+type JobRequest struct {
+	Kind       string             `json:"kind"`
+	Project    string             `json:"project,omitempty"`     // Jobs on one database
+	Env        string             `json:"env,omitempty"`         // Jobs on one database
+	PRNumber   *int               `json:"pr_number,omitempty"`   // Jobs on one database
+	BackupID   int64              `json:"backup_id,omitempty"`   // backup.restore
+	OlderThan  time.Duration      `json:"older_than,omitempty"`  // cleanup
+	Force      bool               `json:"force,omitempty"`       // backup.run
+	Steps      int                `json:"steps,omitempty"`       // database.migrate_down
+	Server     string             `json:"server,omitempty"`      // database.move: the server moved to
+	DropSource bool               `json:"drop_source,omitempty"` // database.move
+	Manifest   *manifest.Manifest `json:"manifest,omitempty"`    // manifest.apply
+	Prune      bool               `json:"prune,omitempty"`       // manifest.apply
+
+	// Dump is read by StartJob for database.restore and staged until the job runs
+	Dump io.Reader `json:"-"`
+}
+
+// JobInfo is a job with its log
+type JobInfo struct {
+	meta.Job
+	Logs []meta.JobLog
+}
+
+// JobFinished reports whether a job with status is done, successfully or not
+func JobFinished(status string) bool {
+	return status == JobSucceeded || status == JobFailed || status == JobCanceled
+}
+
+// jobPool runs queued jobs on a fixed number of workers
+type jobPool struct {
+	queue chan *queuedJob
+	dir   string // Holds the dumps staged for restore jobs
+
+	mu      sync.Mutex
+	jobs    map[int64]*queuedJob // Queued and running jobs
+	secrets map[int64][]byte     // Results with secrets, until their job's actor reads them
+}
+
+// queuedJob is a job waiting for or held by a worker
+type queuedJob struct {
+	job    *meta.Job // Owned by the worker once started
+	req    JobRequest
+	ctx    context.Context // Carries the caller's principal and origin
+	cancel context.CancelCauseFunc
+
+	dumpFile string // Staged dump of a restore job, removed once it is done
+
+	started bool // Guarded by jobPool.mu
+}
+
+// secretResult is implemented by results holding secrets, which are kept out
+// of the metadata store
+type secretResult interface {
+	// redacted returns the result without its secrets
+	redacted() any
+}
+
+// jobRun is carried in the context of a running job, so that operations can
+// report progress and log lines
+type jobRun struct {
+	m   *Manager
+	job *meta.Job
+}
+
+type jobRunKey struct{}
+
+// StartJobs starts workers that run jobs until ctx is cancelled. Jobs left
+// queued or running by a previous server are failed first, since nothing runs
+// them anymore.
+func (m *Manager) StartJobs(ctx context.Context, workers int) error {
+	if n, err := m.store.InterruptJobs(ctx, "interrupted: "+errJobsStopped.Error()); err != nil {
+		return err
+	} else if n > 0 {
+		fmt.Printf("Warning: failed %d jobs interrupted by the last shutdown\n", n)
+	}
+
+	dir, err := os.MkdirTemp("", "pgmanager-jobs-")
+	if err != nil {
+		return fmt.Errorf("failed to create job directory: %w", err)
+	}
+	pool := &jobPool{
+		queue:   make(chan *queuedJob, MaxQueuedJobs),
+		dir:     dir,
+		jobs:    make(map[int64]*queuedJob),
+		secrets: make(map[int64][]byte),
+	}
+	m.jobsMu.Lock()
+	m.jobs = pool
+	m.jobsMu.Unlock()
+
+	for i := 0; i < workers; i++ {
+		go m.runJobs(ctx, pool)
+	}
+	go func() {
+		ticker := time.NewTicker(jobPruneInterval)
+		defer ticker.Stop()
+		for {
+			if _, err := m.store.PruneJobs(ctx, time.Now().Add(-jobHistory)); err != nil && ctx.Err() == nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+			select {
+			case <-ctx.Done():
+				return
+			case <-ticker.C:
+			}
+		}
+	}()
+	go func() {
+		<-ctx.Done()
+		pool.mu.Lock()
+		defer pool.mu.Unlock()
+		for _, qj := range pool.jobs {
+			qj.cancel(errJobsStopped)
+		}
+		// Jobs still queued never run, so nothing else removes their dumps
+		if err := os.RemoveAll(pool.dir); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+	}()
+	return nil
+}
+
+// pool returns the job pool, or nil when StartJobs was not called
+func (m *Manager) pool() *jobPool {
+	m.jobsMu.Lock()
+	defer m.jobsMu.Unlock()
+	return m.jobs
+}
+
+// StartJob queues an operation to run in the background and returns its job.
+// Starting a job needs the scope the operation needs, which is checked again
+// when it runs. Jobs that could not succeed, such as ones on a database that
+// does not exist, fail here rather than when they run. Jobs only run in 'serve'.
+func (m *Manager) StartJob(ctx context.Context, req JobRequest) (_ *meta.Job, err error) {
+	if err := authorizeJob(ctx, req.Kind, req.Project); err != nil {
+		return nil, err
+	}
+	if err := validateJob(req); err != nil {
+		return nil, err
+	}
+	if err := m.checkJob(ctx, req); err != nil {
+		return nil, err
+	}
+
+	job := &meta.Job{Kind: req.Kind, Project: req.Project, Status: JobQueued, Actor: actor(ctx, auth.OriginFromContext(ctx))}
+	if req.Project != "" {
+		job.Target = DatabaseName(req.Project, req.Env, req.PRNumber)
+	}
+
+	pool := m.pool()
+	if pool == nil {
+		return nil, fmt.Errorf("no job workers are running")
+	}
+
+	qj := &queuedJob{job: job, req: req}
+	if req.Kind == JobRestore {
+		if qj.dumpFile, err = pool.stageDump(req.Dump); err != nil {
+			return nil, err
+		}
+		defer func() {
+			if err != nil {
+				qj.release()
+			}
+		}()
+	}
+
+	job.Params, err = json.Marshal(req)
+	if err != nil {
+		return nil, fmt.Errorf("failed to encode job: %w", err)
+	}
+	if err := m.store.CreateJob(ctx, job); err != nil {
+		return nil, err
+	}
+
+	// The job outlives the request that started it, but keeps its principal
+	var cancel context.CancelCauseFunc
+	qj.ctx, cancel = context.WithCancelCause(context.WithoutCancel(ctx))
+	qj.cancel = cancel
+	queued := *job
+
+	pool.mu.Lock()
+	select {
+	case pool.queue <- qj:
+		pool.jobs[job.ID] = qj
+		pool.mu.Unlock()
+		return &queued, nil
+	default:
+		pool.mu.Unlock()
+	}
+
+	cancel(nil)
+	err = fmt.Errorf("job queue is full: %d jobs are waiting", MaxQueuedJobs)
+	m.finishJob(job, JobFailed, nil, err)
+	return nil, err
+}
+
+// validateJob checks that a job request has the fields its kind needs
+func validateJob(req JobRequest) error {
+	switch req.Kind {
+	case JobCleanup, JobBackupRun, JobApply:
+		if req.Project != "" {
+			return fmt.Errorf("invalid job: %s runs on every project", req.Kind)
+		}
+		if req.Kind == JobApply && req.Manifest == nil {
+			return fmt.Errorf("invalid job: manifest.apply needs a manifest")
+		}
+		return nil
+	}
+
+	if req.Project == "" || req.Env == "" {
+		return fmt.Errorf("invalid job: %s needs a project and an environment", req.Kind)
+	}
+	switch req.Kind {
+	case JobBackupRestore:
+		if req.BackupID <= 0 {
+			return fmt.Errorf("invalid job: backup.restore needs a backup ID")
+		}
+	case JobRestore:
+		if req.Dump == nil {
+			return fmt.Errorf("invalid job: database.restore needs a dump")
+		}
+	case JobMove:
+		if req.Server == "" {
+			return fmt.Errorf("invalid job: database.move needs a target server")
+		}
+	case JobMigrateDown:
+		if req.Steps <= 0 {
+			return fmt.Errorf("steps must be positive")
+		}
+	}
+	return nil
+}
+
+// checkJob returns the error a job would fail with at once, as far as it can
+// be known before the job runs
+func (m *Manager) checkJob(ctx context.Context, req JobRequest) error {
+	switch req.Kind {
+	case JobBackupRun:
+		return m.checkBackupConfig()
+	case JobBackupCreate:
+		if _, err := m.findDatabase(ctx, req.Project, req.Env, req.PRNumber); err != nil {
+			return err
+		}
+		if m.backups == nil {
+			return errNoBackupTarget
+		}
+	case JobBackupRestore:
+		if err := ValidateEnv(req.Env); err != nil {
+			return err
+		}
+		_, err := m.findBackup(ctx, req.BackupID)
+		return err
+	case JobRestore:
+		if err := ValidateEnv(req.Env); err != nil {
+			return err
+		}
+		project, err := m.store.GetProject(ctx, req.Project)
+		if err != nil {
+			return fmt.Errorf("failed to get project: %w", err)
+		}
+		if project == nil {
+			return fmt.Errorf("project '%s' not found", req.Project)
+		}
+	case JobMove:
+		if _, err := m.findDatabase(ctx, req.Project, req.Env, req.PRNumber); err != nil {
+			return err
+		}
+		_, err := m.client(req.Server)
+		return err
+	case JobMigrate, JobMigrateDown:
+		if _, err := m.loadMigrations(req.Project, ""); err != nil {
+			return err
+		}
+		_, err := m.findDatabase(ctx, req.Project, req.Env, req.PRNumber)
+		return err
+	case JobApply:
+		return validateManifest(req.Manifest)
+	}
+	return nil
+}
+
+// stageDump copies the dump of a restore job to the pool's directory, since
+// the request that uploaded it ends before the job runs. A dump that is not
+// one is rejected.
+func (p *jobPool) stageDump(r io.Reader) (string, error) {
+	f, err := os.CreateTemp(p.dir, "restore-*.dump.gz")
+	if err != nil {
+		return "", fmt.Errorf("failed to stage dump: %w", err)
+	}
+	_, err = io.Copy(f, r)
+	if closeErr := f.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = checkDumpFile(f.Name())
+	} else {
+		err = fmt.Errorf("failed to stage dump: %w", err)
+	}
+	if err != nil {
+		os.Remove(f.Name())
+		return "", err
+	}
+	return f.Name(), nil
+}
+
+// checkDumpFile checks that a file holds a dump written by DumpDatabase
+func checkDumpFile(path string) error {
+	f, err := os.Open(path)
+	if err != nil {
+		return err
+	}
+	defer f.Close()
+
+	_, _, gz, err := openDump(f)
+	if err != nil {
+		return err
+	}
+	return gz.Close()
+}
+
+// release removes what a job kept for its run
+func (qj *queuedJob) release() {
+	if qj.dumpFile == "" {
+		return
+	}
+	if err := os.Remove(qj.dumpFile); err != nil && !errors.Is(err, os.ErrNotExist) {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// runJobs runs queued jobs one at a time until ctx is cancelled
+func (m *Manager) runJobs(ctx context.Context, pool *jobPool) {
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case qj := <-pool.queue:
+			m.runJob(pool, qj)
+		}
+	}
+}
+
+// runJob runs a queued job unless it was canceled while it waited
+func (m *Manager) runJob(pool *jobPool, qj *queuedJob) {
+	pool.mu.Lock()
+	if qj.ctx.Err() != nil {
+		// CancelJob recorded the cancellation already
+		delete(pool.jobs, qj.job.ID)
+		pool.mu.Unlock()
+		qj.release()
+		return
+	}
+	qj.started = true
+	pool.mu.Unlock()
+
+	defer func() {
+		pool.mu.Lock()
+		delete(pool.jobs, qj.job.ID)
+		pool.mu.Unlock()
+		qj.cancel(nil)
+		qj.release()
+	}()
+
+	job := qj.job
+	now := time.Now()
+	job.Status = JobRunning
+	job.StartedAt = &now
+	if err := m.store.UpdateJob(context.WithoutCancel(qj.ctx), job); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+
+	ctx := context.WithValue(qj.ctx, jobRunKey{}, &jobRun{m: m, job: job})
+	result, err := m.dispatchJob(ctx, qj)
+
+	switch {
+	case err == nil:
+		m.finishJob(job, JobSucceeded, result, nil)
+	case errors.Is(context.Cause(qj.ctx), errJobCanceled):
+		m.finishJob(job, JobCanceled, nil, errJobCanceled)
+	case errors.Is(context.Cause(qj.ctx), errJobsStopped):
+		m.finishJob(job, JobFailed, nil, fmt.Errorf("interrupted: %w", errJobsStopped))
+	default:
+		// Operations that stop part way, like apply, return what they did
+		m.finishJob(job, JobFailed, result, err)
+	}
+}
+
+// dispatchJob runs the operation of a job and returns its result
+func (m *Manager) dispatchJob(ctx context.Context, qj *queuedJob) (any, error) {
+	req := qj.req
+	switch req.Kind {
+	case JobCleanup:
+		return jobOutcome(m.Cleanup(ctx, req.OlderThan))
+	case JobBackupRun:
+		return jobOutcome(m.RunBackups(ctx, req.Force))
+	case JobBackupCreate:
+		return jobOutcome(m.BackupDatabase(ctx, req.Project, req.Env, req.PRNumber))
+	case JobBackupRestore:
+		return jobOutcome(m.RestoreBackup(ctx, req.BackupID, req.Project, req.Env, req.PRNumber))
+	case JobRestore:
+		f, err := os.Open(qj.dumpFile)
+		if err != nil {
+			return nil, err
+		}
+		defer f.Close()
+		return jobOutcome(m.RestoreDatabase(ctx, req.Project, req.Env, req.PRNumber, f))
+	case JobMove:
+		return nil, m.MoveDatabase(ctx, req.Project, req.Env, req.PRNumber, req.Server, req.DropSource, func(p MoveProgress) {
+			logJob(ctx, "%s", p)
+			if p.Phase == movePhaseCopy && p.Table != "" {
+				reportProgress(ctx, p.TablesDone, p.TablesTotal)
+			}
+		})
+	case JobMigrate:
+		applied, err := m.Migrate(ctx, req.Project, req.Env, req.PRNumber, "")
+		if err != nil && len(applied) == 0 {
+			return nil, err
+		}
+		return applied, err
+	case JobMigrateDown:
+		reverted, err := m.MigrateDown(ctx, req.Project, req.Env, req.PRNumber, "", req.Steps)
+		if err != nil && len(reverted) == 0 {
+			return nil, err
+		}
+		return reverted, err
+	case JobApply:
+		return jobOutcome(m.Apply(ctx, req.Manifest, req.Prune))
+	}
+	return nil, fmt.Errorf("invalid job kind: %s", req.Kind)
+}
+
+// jobOutcome returns the result and error of an operation, leaving out
+// results the operation did not return
+func jobOutcome[T any](result *T, err error) (any, error) {
+	if result == nil {
+		return nil, err
+	}
+	return result, err
+}
+
+// finishJob records the outcome of a job
+func (m *Manager) finishJob(job *meta.Job, status string, result any, err error) {
+	now := time.Now()
+	job.Status = status
+	job.FinishedAt = &now
+	if err != nil {
+		job.Error = err.Error()
+	}
+	if result != nil {
+		if r, ok := result.(secretResult); ok {
+			m.keepSecret(job.ID, result)
+			result = r.redacted()
+		}
+		data, merr := json.Marshal(result)
+		if merr != nil {
+			fmt.Printf("Warning: failed to encode result of job %d: %v\n", job.ID, merr)
+		}
+		job.Result = data
+	}
+	if status == JobSucceeded && job.Total > 0 {
+		job.Done = job.Total
+	}
+	if err := m.store.UpdateJob(context.Background(), job); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// GetJob returns a job and its log. Reading a job needs the read scope on its
+// project, or on every project for jobs that span projects. Its result is left
+// out for callers who could not have started it. Passwords in the result of an
+// apply are not stored; they are only returned the first time the caller who
+// started it reads it finished.
+func (m *Manager) GetJob(ctx context.Context, id int64) (*JobInfo, error) {
+	job, err := m.store.GetJob(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	if job == nil {
+		return nil, fmt.Errorf("job not found: %d", id)
+	}
+	if err := authorizeJob(ctx, "", job.Project); err != nil {
+		return nil, err
+	}
+	hideResult(ctx, job)
+	if job.Result != nil && job.Actor == actor(ctx, auth.OriginFromContext(ctx)) {
+		if data := m.takeSecret(job.ID); data != nil {
+			job.Result = data
+		}
+	}
+
+	logs, err := m.store.ListJobLogs(ctx, id)
+	if err != nil {
+		return nil, err
+	}
+	return &JobInfo{Job: *job, Logs: logs}, nil
+}
+
+// ListJobs returns the jobs matching a filter, newest first. Like ListAudit,
+// listing the jobs of every project needs the read scope on all of them.
+func (m *Manager) ListJobs(ctx context.Context, filter meta.JobFilter) ([]meta.Job, error) {
+	if filter.Project != "" {
+		if err := authorize(ctx, auth.ScopeRead, filter.Project); err != nil {
+			return nil, err
+		}
+	} else if err := authorizeAll(ctx, auth.ScopeRead); err != nil {
+		return nil, err
+	}
+
+	if filter.Limit <= 0 || filter.Limit > MaxJobs {
+		filter.Limit = MaxJobs
+	}
+	jobs, err := m.store.ListJobs(ctx, filter)
+	if err != nil {
+		return nil, err
+	}
+	for i := range jobs {
+		hideResult(ctx, &jobs[i])
+	}
+	return jobs, nil
+}
+
+// keepSecret keeps the result of a job with its secrets in memory
+func (m *Manager) keepSecret(id int64, result any) {
+	pool := m.pool()
+	if pool == nil {
+		return
+	}
+	data, err := json.Marshal(result)
+	if err != nil {
+		fmt.Printf("Warning: failed to encode result of job %d: %v\n", id, err)
+		return
+	}
+	pool.mu.Lock()
+	pool.secrets[id] = data
+	pool.mu.Unlock()
+}
+
+// takeSecret returns and forgets the result of a job kept by keepSecret
+func (m *Manager) takeSecret(id int64) []byte {
+	pool := m.pool()
+	if pool == nil {
+		return nil
+	}
+	pool.mu.Lock()
+	defer pool.mu.Unlock()
+	data := pool.secrets[id]
+	delete(pool.secrets, id)
+	return data
+}
+
+// hideResult clears the result of a job the caller of ctx could not have started
+func hideResult(ctx context.Context, job *meta.Job) {
+	if authorizeJob(ctx, job.Kind, job.Project) != nil {
+		job.Result = nil
+	}
+}
+
+// CancelJob cancels a queued or running job. Canceling needs the scope needed
+// to start the job. A running job stops at the next point its operation checks
+// for cancellation, so work it finished is kept.
+func (m *Manager) CancelJob(ctx context.Context, id int64) (err error) {
+	var projectName string
+	defer func() { m.record(ctx, "job.cancel", projectName, fmt.Sprintf("job %d", id), err) }()
+
+	job, err := m.store.GetJob(ctx, id)
+	if err != nil {
+		return err
+	}
+	if job == nil {
+		return fmt.Errorf("job not found: %d", id)
+	}
+	projectName = job.Project
+	if err := authorizeJob(ctx, job.Kind, job.Project); err != nil {
+		return err
+	}
+	if JobFinished(job.Status) {
+		return fmt.Errorf("job %d already %s", id, job.Status)
+	}
+
+	pool := m.pool()
+	if pool == nil {
+		return fmt.Errorf("no job workers are running")
+	}
+	pool.mu.Lock()
+	qj, ok := pool.jobs[id]
+	if !ok {
+		pool.mu.Unlock()
+		return fmt.Errorf("job %d is not running on this server", id)
+	}
+	qj.cancel(errJobCanceled)
+	started := qj.started
+	pool.mu.Unlock()
+
+	if !started {
+		// Its worker drops it; a running job records its own outcome
+		m.finishJob(qj.job, JobCanceled, nil, errJobCanceled)
+	}
+	return nil
+}
+
+// authorizeJob checks that the caller of ctx may start a job of kind, or read
+// jobs when kind is empty
+func authorizeJob(ctx context.Context, kind, projectName string) error {
+	scope := auth.ScopeRead
+	switch kind {
+	case "":
+	case JobCleanup, JobMigrateDown:
+		scope = auth.ScopeDelete
+	case JobBackupRun, JobBackupCreate, JobBackupRestore, JobRestore, JobMigrate:
+		scope = auth.ScopeCreate
+	case JobMove, JobApply:
+		scope = auth.ScopeAdmin
+	default:
+		return fmt.Errorf("invalid job kind: %s", kind)
+	}
+	if projectName == "" {
+		return authorizeAll(ctx, scope)
+	}
+	return authorize(ctx, scope, projectName)
+}
+
+// reportProgress records how many of the steps of the job running in ctx are
+// done. Outside jobs it does nothing.
+func reportProgress(ctx context.Context, done, total int) {
+	run, ok := ctx.Value(jobRunKey{}).(*jobRun)
+	if !ok {
+		return
+	}
+	run.job.Done, run.job.Total = done, total
+	if err := run.m.store.UpdateJob(context.WithoutCancel(ctx), run.job); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// logJob appends a line to the log of the job running in ctx. Outside jobs it
+// does nothing.
+func logJob(ctx context.Context, format string, args ...any) {
+	run, ok := ctx.Value(jobRunKey{}).(*jobRun)
+	if !ok {
+		return
+	}
+	if err := run.m.store.AppendJobLog(context.WithoutCancel(ctx), run.job.ID, fmt.Sprintf(format, args...)); err != nil {
+		fmt.Printf("Warning: %v\n", err)
+	}
+}
+
+// WaitJob polls a job every interval until it finishes or ctx is done, calling
+// onUpdate, if set, with each state read
+func WaitJob(ctx context.Context, svc Service, id int64, interval time.Duration, onUpdate func(*JobInfo)) (*JobInfo, error) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		info, err := svc.GetJob(ctx, id)
+		if err != nil {
+			return nil, err
+		}
+		if onUpdate != nil {
+			onUpdate(info)
+		}
+		if JobFinished(info.Status) {
+			return info, nil
+		}
+		select {
+		case <-ctx.Done():
+			return nil, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
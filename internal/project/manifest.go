@@ -0,0 +1,531 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"strings"
+	"time"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/db"
+	"pgmanager/internal/manifest"
+	"pgmanager/internal/meta"
+)
+
+// Plan actions
+const (
+	ActionCreate = "create"
+	ActionUpdate = "update"
+	ActionDelete = "delete"
+)
+
+// Plan is the list of changes that brings projects in line with a manifest
+type Plan struct {
+	Changes  []PlanChange
+	Warnings []string // Differences the plan leaves alone
+}
+
+// PlanChange is a single change in a plan
+type PlanChange struct {
+	Action string // create, update, delete
+	Kind   string // project, database, role, extension, setting
+	Name   string
+	Detail string
+
+	apply func(ctx context.Context, result *ApplyResult) error
+}
+
+// ApplyResult describes the changes made by Apply
+type ApplyResult struct {
+	Applied     []PlanChange
+	Credentials []Credential // Credentials of the databases and roles created
+}
+
+// redacted returns the result without passwords, which are not stored
+func (r *ApplyResult) redacted() any {
+	out := &ApplyResult{Applied: r.Applied, Credentials: make([]Credential, len(r.Credentials))}
+	for i, c := range r.Credentials {
+		out.Credentials[i] = Credential{Database: c.Database, User: c.User}
+	}
+	return out
+}
+
+// Credential holds the login of a database or role created by Apply. Role
+// passwords are not stored, so they are only ever shown here.
+type Credential struct {
+	Database   string
+	User       string
+	Password   string
+	ConnString string
+}
+
+// Empty reports whether the plan makes no changes
+func (p *Plan) Empty() bool {
+	return len(p.Changes) == 0
+}
+
+// String describes a change on one line, such as "+ database myapp_prod"
+func (c PlanChange) String() string {
+	symbol := map[string]string{ActionCreate: "+", ActionUpdate: "~", ActionDelete: "-"}[c.Action]
+	line := fmt.Sprintf("%s %s %s", symbol, c.Kind, c.Name)
+	if c.Detail != "" {
+		line += " (" + c.Detail + ")"
+	}
+	return line
+}
+
+// planner collects the changes of a plan in the order they are applied:
+// creates, then updates, then deletes
+type planner struct {
+	creates, updates, deletes []PlanChange
+	warnings                  []string
+}
+
+func (p *planner) add(change PlanChange) {
+	switch change.Action {
+	case ActionCreate:
+		p.creates = append(p.creates, change)
+	case ActionUpdate:
+		p.updates = append(p.updates, change)
+	default:
+		p.deletes = append(p.deletes, change)
+	}
+}
+
+func (p *planner) warn(format string, args ...any) {
+	p.warnings = append(p.warnings, fmt.Sprintf(format, args...))
+}
+
+func (p *planner) plan() *Plan {
+	changes := append(append(p.creates, p.updates...), p.deletes...)
+	return &Plan{Changes: changes, Warnings: p.warnings}
+}
+
+// validateManifest checks the project names and environments of a manifest
+// against the rules of the CLI
+func validateManifest(mf *manifest.Manifest) error {
+	for _, projectName := range mf.ProjectNames() {
+		if err := ValidateName(projectName); err != nil {
+			return fmt.Errorf("invalid manifest: project %s: %w", projectName, err)
+		}
+		declared := mf.Projects[projectName]
+		for _, env := range declared.EnvNames() {
+			if err := ValidateEnv(env); err != nil {
+				return fmt.Errorf("invalid manifest: project %s: %w", projectName, err)
+			}
+		}
+	}
+	return nil
+}
+
+// Plan compares a manifest with the metadata store and the servers and returns
+// the changes Apply would make. Without prune nothing is deleted; what prune
+// would delete is reported as warnings instead. PR databases are never planned.
+func (m *Manager) Plan(ctx context.Context, mf *manifest.Manifest, prune bool) (*Plan, error) {
+	if err := authorizeAll(ctx, auth.ScopeRead); err != nil {
+		return nil, err
+	}
+
+	if err := validateManifest(mf); err != nil {
+		return nil, err
+	}
+
+	p := &planner{}
+
+	for _, projectName := range mf.ProjectNames() {
+		declared := mf.Projects[projectName]
+		record, err := m.store.GetProject(ctx, projectName)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get project: %w", err)
+		}
+
+		var existing []meta.Database
+		if record == nil {
+			p.add(PlanChange{
+				Action: ActionCreate,
+				Kind:   "project",
+				Name:   projectName,
+				apply: func(ctx context.Context, _ *ApplyResult) error {
+					_, err := m.CreateProject(ctx, projectName)
+					return err
+				},
+			})
+		} else if existing, err = m.store.ListDatabases(ctx, record.ID); err != nil {
+			return nil, fmt.Errorf("failed to list databases: %w", err)
+		}
+
+		for _, env := range declared.EnvNames() {
+			var current *meta.Database
+			for i := range existing {
+				if existing[i].Env == env && existing[i].PRNumber == nil {
+					current = &existing[i]
+				}
+			}
+			if err := m.planDatabase(ctx, p, projectName, env, declared.Environments[env], current, prune); err != nil {
+				return nil, err
+			}
+		}
+
+		for _, dbRecord := range existing {
+			if dbRecord.Env == "pr" {
+				continue
+			}
+			if _, ok := declared.Environments[dbRecord.Env]; !ok {
+				m.planDatabaseDelete(p, projectName, dbRecord, prune)
+			}
+		}
+	}
+
+	projects, err := m.store.ListProjects(ctx)
+	if err != nil {
+		return nil, fmt.Errorf("failed to list projects: %w", err)
+	}
+	for _, record := range projects {
+		if _, ok := mf.Projects[record.Name]; ok {
+			continue
+		}
+		if err := m.planProjectDelete(ctx, p, record, prune); err != nil {
+			return nil, err
+		}
+	}
+
+	return p.plan(), nil
+}
+
+// planDatabase plans the changes to one declared database. current is nil when
+// the database does not exist yet.
+func (m *Manager) planDatabase(ctx context.Context, p *planner, projectName, env string, declared manifest.Environment, current *meta.Database, prune bool) error {
+	dbName := DatabaseName(projectName, env, nil)
+	server := declared.Server
+	settings := &db.DatabaseSettings{ConnectionLimit: -1}
+
+	if current == nil {
+		if server == "" {
+			server = m.cfg.PlaceDatabase(projectName, env)
+		}
+		if _, err := m.client(server); err != nil {
+			return fmt.Errorf("invalid manifest: %s: %w", dbName, err)
+		}
+		p.add(PlanChange{
+			Action: ActionCreate,
+			Kind:   "database",
+			Name:   dbName,
+			Detail: "server " + server,
+			apply: func(ctx context.Context, result *ApplyResult) error {
+				info, err := m.CreateDatabase(ctx, projectName, env, nil, server)
+				if err != nil {
+					return err
+				}
+				result.Credentials = append(result.Credentials, Credential{
+					Database:   info.DatabaseName,
+					User:       info.UserName,
+					Password:   info.Password,
+					ConnString: info.ConnString,
+				})
+				return nil
+			},
+		})
+	} else {
+		if declared.Server != "" && declared.Server != current.Server {
+			p.warn("%s is on server %s, not %s; use 'pgmanager db move' to move it", dbName, current.Server, declared.Server)
+		}
+		server = current.Server
+
+		pg, err := m.client(server)
+		if err != nil {
+			return fmt.Errorf("%s: %w", dbName, err)
+		}
+		if settings, err = pg.DatabaseSettings(ctx, dbName); err != nil {
+			return fmt.Errorf("failed to read settings of %s: %w", dbName, err)
+		}
+	}
+
+	var createdAt time.Time
+	var expiresAt *time.Time
+	protected := false
+	if current != nil {
+		createdAt, expiresAt, protected = current.CreatedAt, current.ExpiresAt, current.Protected
+	}
+	wantExpiry := declaredExpiry(declared, createdAt)
+	if declared.Protected != protected || !sameTime(wantExpiry, expiresAt) {
+		p.add(PlanChange{
+			Action: actionFor(current),
+			Kind:   "setting",
+			Name:   dbName,
+			Detail: policyDetail(declared),
+			apply: func(ctx context.Context, _ *ApplyResult) error {
+				// A database created by this apply gets its expiry from its actual creation time
+				expiry := wantExpiry
+				if current == nil && declared.TTL > 0 {
+					record, err := m.store.GetDatabaseByName(ctx, dbName)
+					if err != nil {
+						return err
+					}
+					expiry = declaredExpiry(declared, record.CreatedAt)
+				}
+				return m.store.UpdateDatabasePolicy(ctx, dbName, declared.Protected, expiry)
+			},
+		})
+	}
+
+	pg, err := m.client(server)
+	if err != nil {
+		return err
+	}
+
+	wantLimit := declared.ConnectionLimit
+	if wantLimit == 0 {
+		wantLimit = -1
+	}
+	if wantLimit != settings.ConnectionLimit {
+		detail := "connection_limit unlimited"
+		if wantLimit > 0 {
+			detail = fmt.Sprintf("connection_limit %d", wantLimit)
+		}
+		p.add(PlanChange{
+			Action: actionFor(current),
+			Kind:   "setting",
+			Name:   dbName,
+			Detail: detail,
+			apply: func(ctx context.Context, _ *ApplyResult) error {
+				return pg.SetConnectionLimit(ctx, dbName, wantLimit)
+			},
+		})
+	}
+
+	wantTimeout := ""
+	if declared.StatementTimeout > 0 {
+		wantTimeout = fmt.Sprintf("%dms", declared.StatementTimeout.Milliseconds())
+	}
+	if wantTimeout != settings.StatementTimeout {
+		detail := "statement_timeout default"
+		if wantTimeout != "" {
+			detail = "statement_timeout " + wantTimeout
+		}
+		p.add(PlanChange{
+			Action: actionFor(current),
+			Kind:   "setting",
+			Name:   dbName,
+			Detail: detail,
+			apply: func(ctx context.Context, _ *ApplyResult) error {
+				return pg.SetStatementTimeout(ctx, dbName, wantTimeout)
+			},
+		})
+	}
+
+	// Extensions are only ever added; dropping one can drop the columns that use it
+	for _, ext := range declared.Extensions {
+		if slices.Contains(settings.Extensions, ext) {
+			continue
+		}
+		p.add(PlanChange{
+			Action: ActionCreate,
+			Kind:   "extension",
+			Name:   dbName + "." + ext,
+			apply: func(ctx context.Context, _ *ApplyResult) error {
+				return pg.CreateExtension(ctx, dbName, ext)
+			},
+		})
+	}
+
+	m.planRoles(p, pg, server, dbName, declared.Roles, settings.Roles, prune)
+	return nil
+}
+
+// planRoles plans the managed roles of a database
+func (m *Manager) planRoles(p *planner, pg pgServer, server, dbName string, declared, current map[string]string, prune bool) {
+	owner := UserName(dbName)
+
+	names := make([]string, 0, len(declared))
+	for role := range declared {
+		names = append(names, role)
+	}
+	slices.Sort(names)
+
+	wanted := make(map[string]bool)
+	for _, role := range names {
+		access := declared[role]
+		roleName := dbName + "_" + role
+		wanted[roleName] = true
+
+		currentAccess, ok := current[roleName]
+		switch {
+		case !ok:
+			p.add(PlanChange{
+				Action: ActionCreate,
+				Kind:   "role",
+				Name:   roleName,
+				Detail: access,
+				apply: func(ctx context.Context, result *ApplyResult) error {
+					password := db.GeneratePassword()
+					if err := pg.CreateAccessRole(ctx, dbName, owner, roleName, password, access); err != nil {
+						return err
+					}
+					cred := Credential{Database: dbName, User: roleName, Password: password}
+					if serverCfg, err := m.cfg.Server(server); err == nil {
+						cred.ConnString = db.ConnectionString(serverCfg.Host, serverCfg.Port, dbName, roleName, password, serverCfg.SSLMode)
+					}
+					result.Credentials = append(result.Credentials, cred)
+					return nil
+				},
+			})
+		case currentAccess != access:
+			p.add(PlanChange{
+				Action: ActionUpdate,
+				Kind:   "role",
+				Name:   roleName,
+				Detail: currentAccess + " -> " + access,
+				apply: func(ctx context.Context, _ *ApplyResult) error {
+					return pg.SetRoleAccess(ctx, dbName, owner, roleName, access)
+				},
+			})
+		}
+	}
+
+	var extra []string
+	for roleName := range current {
+		if !wanted[roleName] {
+			extra = append(extra, roleName)
+		}
+	}
+	slices.Sort(extra)
+	for _, roleName := range extra {
+		if !prune {
+			p.warn("role %s is not in the manifest; use --prune to drop it", roleName)
+			continue
+		}
+		p.add(PlanChange{
+			Action: ActionDelete,
+			Kind:   "role",
+			Name:   roleName,
+			apply: func(ctx context.Context, _ *ApplyResult) error {
+				return pg.DropAccessRole(ctx, dbName, owner, roleName)
+			},
+		})
+	}
+}
+
+// planDatabaseDelete plans the deletion of a database missing from the manifest
+func (m *Manager) planDatabaseDelete(p *planner, projectName string, dbRecord meta.Database, prune bool) {
+	switch {
+	case dbRecord.Protected:
+		p.warn("%s is not in the manifest but is protected; it is kept", dbRecord.Name)
+	case !prune:
+		p.warn("%s is not in the manifest; use --prune to delete it", dbRecord.Name)
+	default:
+		p.add(PlanChange{
+			Action: ActionDelete,
+			Kind:   "database",
+			Name:   dbRecord.Name,
+			apply: func(ctx context.Context, _ *ApplyResult) error {
+				return m.DeleteDatabase(ctx, projectName, dbRecord.Env, nil)
+			},
+		})
+	}
+}
+
+// planProjectDelete plans the deletion of a project missing from the manifest,
+// along with all its databases
+func (m *Manager) planProjectDelete(ctx context.Context, p *planner, record meta.Project, prune bool) error {
+	databases, err := m.store.ListDatabases(ctx, record.ID)
+	if err != nil {
+		return fmt.Errorf("failed to list databases: %w", err)
+	}
+	for _, dbRecord := range databases {
+		if dbRecord.Protected {
+			p.warn("project %s is not in the manifest but has protected database %s; it is kept", record.Name, dbRecord.Name)
+			return nil
+		}
+	}
+	if !prune {
+		p.warn("project %s is not in the manifest; use --prune to delete it", record.Name)
+		return nil
+	}
+
+	detail := ""
+	if len(databases) > 0 {
+		names := make([]string, len(databases))
+		for i, d := range databases {
+			names[i] = d.Name
+		}
+		detail = "with " + strings.Join(names, ", ")
+	}
+	p.add(PlanChange{
+		Action: ActionDelete,
+		Kind:   "project",
+		Name:   record.Name,
+		Detail: detail,
+		apply: func(ctx context.Context, _ *ApplyResult) error {
+			return m.DeleteProject(ctx, record.Name)
+		},
+	})
+	return nil
+}
+
+// Apply makes the changes planned for a manifest. It stops at the first change
+// that fails; the result then lists the changes already made.
+func (m *Manager) Apply(ctx context.Context, mf *manifest.Manifest, prune bool) (_ *ApplyResult, err error) {
+	defer func() { m.record(ctx, "manifest.apply", "", "", err) }()
+
+	if err := authorizeAll(ctx, auth.ScopeAdmin); err != nil {
+		return nil, err
+	}
+
+	plan, err := m.Plan(ctx, mf, prune)
+	if err != nil {
+		return nil, err
+	}
+
+	result := &ApplyResult{}
+	for _, change := range plan.Changes {
+		if err := change.apply(ctx, result); err != nil {
+			return result, fmt.Errorf("failed to %s %s %s: %w", change.Action, change.Kind, change.Name, err)
+		}
+		result.Applied = append(result.Applied, change)
+	}
+
+	return result, nil
+}
+
+// actionFor returns the action of a setting change: part of creating the
+// database when it does not exist yet, an update otherwise
+func actionFor(current *meta.Database) string {
+	if current == nil {
+		return ActionCreate
+	}
+	return ActionUpdate
+}
+
+// declaredExpiry returns the expiry a TTL gives a database created at createdAt
+func declaredExpiry(declared manifest.Environment, createdAt time.Time) *time.Time {
+	if declared.TTL == 0 {
+		return nil
+	}
+	t := createdAt.Add(declared.TTL)
+	return &t
+}
+
+// sameTime compares optional times to the second, as stored in the metadata store
+func sameTime(a, b *time.Time) bool {
+	if a == nil || b == nil {
+		return a == b
+	}
+	return a.Truncate(time.Second).Equal(b.Truncate(time.Second))
+}
+
+// policyDetail describes the protection and TTL of a database
+func policyDetail(declared manifest.Environment) string {
+	var parts []string
+	if declared.Protected {
+		parts = append(parts, "protected")
+	} else {
+		parts = append(parts, "unprotected")
+	}
+	if declared.TTL > 0 {
+		parts = append(parts, "ttl "+declared.TTL.String())
+	} else {
+		parts = append(parts, "no ttl")
+	}
+	return strings.Join(parts, ", ")
+}
@@ -0,0 +1,131 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/meta"
+	"pgmanager/internal/migrate"
+)
+
+// Migrate applies the pending migrations in dir to a managed database as its owner
+// and returns the migrations applied. An empty dir uses the project's configured
+// migrations directory.
+func (m *Manager) Migrate(ctx context.Context, projectName, env string, prNumber *int, dir string) (_ []migrate.Migration, err error) {
+	defer func() { m.record(ctx, "database.migrate", projectName, DatabaseName(projectName, env, prNumber), err) }()
+
+	if err := authorize(ctx, auth.ScopeCreate, projectName); err != nil {
+		return nil, err
+	}
+
+	var applied []migrate.Migration
+	err = m.withMigrations(ctx, projectName, env, prNumber, dir, func(conn *pgx.Conn, owner string, migrations []migrate.Migration) error {
+		var err error
+		applied, err = migrate.Up(ctx, conn, owner, migrations)
+		return err
+	})
+	return applied, err
+}
+
+// MigrateDown reverts up to steps of the most recently applied migrations and returns them
+func (m *Manager) MigrateDown(ctx context.Context, projectName, env string, prNumber *int, dir string, steps int) (_ []migrate.Migration, err error) {
+	defer func() {
+		m.record(ctx, "database.migrate_down", projectName, DatabaseName(projectName, env, prNumber), err)
+	}()
+
+	if err := authorize(ctx, auth.ScopeDelete, projectName); err != nil {
+		return nil, err
+	}
+
+	if steps <= 0 {
+		return nil, fmt.Errorf("steps must be positive")
+	}
+
+	var reverted []migrate.Migration
+	err = m.withMigrations(ctx, projectName, env, prNumber, dir, func(conn *pgx.Conn, owner string, migrations []migrate.Migration) error {
+		var err error
+		reverted, err = migrate.Down(ctx, conn, owner, migrations, steps)
+		return err
+	})
+	return reverted, err
+}
+
+// MigrationStatus reports which migrations in dir have been applied to a managed database
+func (m *Manager) MigrationStatus(ctx context.Context, projectName, env string, prNumber *int, dir string) ([]migrate.Status, error) {
+	if err := authorize(ctx, auth.ScopeRead, projectName); err != nil {
+		return nil, err
+	}
+
+	var statuses []migrate.Status
+	err := m.withMigrations(ctx, projectName, env, prNumber, dir, func(conn *pgx.Conn, _ string, migrations []migrate.Migration) error {
+		var err error
+		statuses, err = migrate.StatusOf(ctx, conn, migrations)
+		return err
+	})
+	return statuses, err
+}
+
+// withMigrations loads the migrations in dir and calls fn with a connection to the database
+func (m *Manager) withMigrations(ctx context.Context, projectName, env string, prNumber *int, dir string,
+	fn func(conn *pgx.Conn, owner string, migrations []migrate.Migration) error) error {
+	migrations, err := m.loadMigrations(projectName, dir)
+	if err != nil {
+		return err
+	}
+
+	dbRecord, err := m.findDatabase(ctx, projectName, env, prNumber)
+	if err != nil {
+		return err
+	}
+	pg, err := m.client(dbRecord.Server)
+	if err != nil {
+		return err
+	}
+
+	conn, err := pg.ConnectDatabase(ctx, dbRecord.Name)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	return fn(conn, dbRecord.UserName, migrations)
+}
+
+// loadMigrations loads the migrations in dir, or in the project's configured
+// migrations directory when dir is empty
+func (m *Manager) loadMigrations(projectName, dir string) ([]migrate.Migration, error) {
+	if dir == "" {
+		dir = m.cfg.Project(projectName).Migrations
+	}
+	if dir == "" {
+		return nil, fmt.Errorf("no migrations directory given and none configured for project '%s'", projectName)
+	}
+	return migrate.Load(dir)
+}
+
+// autoMigrate applies the project's migrations to a new or reset database when
+// its environment is configured for automatic migration
+func (m *Manager) autoMigrate(ctx context.Context, projectName string, pg pgServer, dbRecord *meta.Database) error {
+	projectCfg := m.cfg.Project(projectName)
+	if projectCfg.Migrations == "" || !slices.Contains(projectCfg.AutoMigrate, dbRecord.Env) {
+		return nil
+	}
+
+	migrations, err := migrate.Load(projectCfg.Migrations)
+	if err != nil {
+		return err
+	}
+
+	conn, err := pg.ConnectDatabase(ctx, dbRecord.Name)
+	if err != nil {
+		return fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	_, err = migrate.Up(ctx, conn, dbRecord.UserName, migrations)
+	return err
+}
@@ -0,0 +1,358 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"slices"
+
+	"github.com/jackc/pgx/v5"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/config"
+	"pgmanager/internal/db"
+	"pgmanager/internal/meta"
+)
+
+// Move phases, in order. The current phase is stored in the metadata so an
+// interrupted move resumes where it stopped.
+const (
+	movePhasePrepare  = "prepare"  // Lock the source and create the target database and schema
+	movePhaseCopy     = "copy"     // Copy table data
+	movePhaseFinalize = "finalize" // Verify row counts, add constraints and indexes, restore sequences
+	movePhaseSwitch   = "switch"   // Point the metadata at the target server
+	movePhaseCleanup  = "cleanup"  // Optionally drop the source database
+)
+
+// MoveProgress reports the progress of a move
+type MoveProgress struct {
+	Phase       string
+	Table       string // Set while copying or verifying a table
+	Rows        int64  // Rows copied for Table
+	TablesDone  int
+	TablesTotal int
+
+	// Message describes the progress instead of the fields above when a
+	// client relays it from the log of a move job
+	Message string
+}
+
+// String describes the progress in one line, as logged by move jobs
+func (p MoveProgress) String() string {
+	switch {
+	case p.Message != "":
+		return p.Message
+	case p.Table == "":
+		return "Phase " + p.Phase
+	case p.Phase == movePhaseCopy:
+		return fmt.Sprintf("[%d/%d] %s: %d rows copied", p.TablesDone, p.TablesTotal, p.Table, p.Rows)
+	}
+	return fmt.Sprintf("[%d/%d] %s: %d rows verified", p.TablesDone, p.TablesTotal, p.Table, p.Rows)
+}
+
+// MoveDatabase copies a database to another server, verifies it and switches the
+// metadata to the new server. The source is locked against new connections for
+// the duration of the move. If a previous move of the same database failed, it
+// is resumed from the phase it stopped in. When dropSource is set the source
+// database is dropped once the move has switched over.
+func (m *Manager) MoveDatabase(ctx context.Context, projectName, env string, prNumber *int, target string, dropSource bool, progress func(MoveProgress)) (err error) {
+	defer func() { m.record(ctx, "database.move", projectName, DatabaseName(projectName, env, prNumber), err) }()
+
+	if err := authorize(ctx, auth.ScopeAdmin, projectName); err != nil {
+		return err
+	}
+
+	if progress == nil {
+		progress = func(MoveProgress) {}
+	}
+
+	dbRecord, err := m.findDatabase(ctx, projectName, env, prNumber)
+	if err != nil {
+		return err
+	}
+	if _, err := m.client(target); err != nil {
+		return err
+	}
+
+	move, err := m.store.GetMove(ctx, dbRecord.Name)
+	if err != nil {
+		return err
+	}
+	if move == nil {
+		if move, err = m.startMove(ctx, dbRecord, target); err != nil {
+			return err
+		}
+	} else if move.Target != target {
+		return fmt.Errorf("a move of %s to '%s' is already in progress; resume it with --to %s or abort it",
+			dbRecord.Name, move.Target, move.Target)
+	}
+
+	src, err := m.client(move.Source)
+	if err != nil {
+		return err
+	}
+	dst, err := m.client(move.Target)
+	if err != nil {
+		return err
+	}
+
+	for {
+		progress(MoveProgress{Phase: move.Phase})
+
+		switch move.Phase {
+		case movePhasePrepare:
+			err = m.movePrepare(ctx, dbRecord, src, dst)
+		case movePhaseCopy:
+			err = m.moveCopy(ctx, dbRecord, move, src, dst, progress)
+		case movePhaseFinalize:
+			err = m.moveFinalize(ctx, dbRecord, src, dst, progress)
+		case movePhaseSwitch:
+			err = m.store.UpdateDatabaseServer(ctx, dbRecord.Name, move.Target)
+		case movePhaseCleanup:
+			if dropSource {
+				if err := src.DropDatabase(ctx, dbRecord.Name, dbRecord.UserName); err != nil {
+					return fmt.Errorf("moved, but failed to drop source database: %w", err)
+				}
+			}
+			return m.store.DeleteMove(ctx, dbRecord.Name)
+		default:
+			return fmt.Errorf("unknown move phase '%s'", move.Phase)
+		}
+		if err != nil {
+			return fmt.Errorf("move failed during %s (run the move again to resume, or abort it): %w", move.Phase, err)
+		}
+
+		move.Phase = nextMovePhase(move.Phase)
+		if err := m.store.SaveMove(ctx, move); err != nil {
+			return err
+		}
+	}
+}
+
+// AbortMove abandons an in-progress move: the target database is dropped and the
+// source is unlocked. A move that has already switched servers cannot be aborted.
+func (m *Manager) AbortMove(ctx context.Context, projectName, env string, prNumber *int) (err error) {
+	defer func() {
+		m.record(ctx, "database.abort_move", projectName, DatabaseName(projectName, env, prNumber), err)
+	}()
+
+	if err := authorize(ctx, auth.ScopeAdmin, projectName); err != nil {
+		return err
+	}
+
+	dbRecord, err := m.findDatabase(ctx, projectName, env, prNumber)
+	if err != nil {
+		return err
+	}
+
+	move, err := m.store.GetMove(ctx, dbRecord.Name)
+	if err != nil {
+		return err
+	}
+	if move == nil {
+		return fmt.Errorf("no move in progress for %s", dbRecord.Name)
+	}
+	if move.Phase == movePhaseCleanup {
+		return fmt.Errorf("%s has already been switched to '%s'; run the move again to finish it", dbRecord.Name, move.Target)
+	}
+
+	src, err := m.client(move.Source)
+	if err != nil {
+		return err
+	}
+	dst, err := m.client(move.Target)
+	if err != nil {
+		return err
+	}
+
+	if err := dst.DropDatabase(ctx, dbRecord.Name, dbRecord.UserName); err != nil {
+		return fmt.Errorf("failed to drop target database: %w", err)
+	}
+	if err := src.SetConnectionLimit(ctx, dbRecord.Name, -1); err != nil {
+		return fmt.Errorf("failed to unlock source database: %w", err)
+	}
+
+	return m.store.DeleteMove(ctx, dbRecord.Name)
+}
+
+// startMove checks that a move can start and records it
+func (m *Manager) startMove(ctx context.Context, dbRecord *meta.Database, target string) (*meta.Move, error) {
+	source := dbRecord.Server
+	if source == "" {
+		source = config.DefaultServer
+	}
+	if source == target {
+		return nil, fmt.Errorf("%s is already on server '%s'", dbRecord.Name, target)
+	}
+
+	dst, err := m.client(target)
+	if err != nil {
+		return nil, err
+	}
+	exists, err := dst.DatabaseExists(ctx, dbRecord.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check target server: %w", err)
+	}
+	if exists {
+		return nil, fmt.Errorf("database %s already exists on server '%s'", dbRecord.Name, target)
+	}
+
+	move := &meta.Move{
+		DatabaseName: dbRecord.Name,
+		Source:       source,
+		Target:       target,
+		Phase:        movePhasePrepare,
+	}
+	if err := m.store.SaveMove(ctx, move); err != nil {
+		return nil, err
+	}
+	return move, nil
+}
+
+// movePrepare locks the source and creates the role, database and schema on the target.
+// A target database left behind by an interrupted prepare is recreated from scratch.
+func (m *Manager) movePrepare(ctx context.Context, dbRecord *meta.Database, src, dst pgServer) error {
+	if err := src.SetConnectionLimit(ctx, dbRecord.Name, 0); err != nil {
+		return err
+	}
+	if _, err := src.TerminateSessions(ctx, dbRecord.Name, 0); err != nil {
+		return err
+	}
+
+	schema, err := readSchema(ctx, src, dbRecord.Name)
+	if err != nil {
+		return err
+	}
+	for _, t := range schema.Tables {
+		if t.Partitioned {
+			return fmt.Errorf("partitioned table %s is not supported", t.QualifiedName())
+		}
+	}
+
+	if err := dst.DropDatabase(ctx, dbRecord.Name, dbRecord.UserName); err != nil {
+		return err
+	}
+	if err := dst.EnsureRole(ctx, dbRecord.UserName, dbRecord.Password); err != nil {
+		return err
+	}
+	if err := dst.CreateDatabase(ctx, dbRecord.Name, dbRecord.UserName, dbRecord.Password); err != nil {
+		return err
+	}
+
+	conn, err := dst.ConnectDatabase(ctx, dbRecord.Name)
+	if err != nil {
+		return fmt.Errorf("failed to connect to target: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	return db.ApplyStatements(ctx, conn, schema.PreDataStatements(dbRecord.UserName))
+}
+
+// moveCopy copies every table not yet recorded as copied. A table that was only
+// partially copied is truncated on the target and copied again.
+func (m *Manager) moveCopy(ctx context.Context, dbRecord *meta.Database, move *meta.Move, src, dst pgServer, progress func(MoveProgress)) error {
+	srcConn, err := src.ConnectDatabase(ctx, dbRecord.Name)
+	if err != nil {
+		return fmt.Errorf("failed to connect to source: %w", err)
+	}
+	defer srcConn.Close(ctx)
+
+	dstConn, err := dst.ConnectDatabase(ctx, dbRecord.Name)
+	if err != nil {
+		return fmt.Errorf("failed to connect to target: %w", err)
+	}
+	defer dstConn.Close(ctx)
+
+	schema, err := db.ReadSchema(ctx, srcConn)
+	if err != nil {
+		return err
+	}
+
+	total := len(schema.Tables)
+	for _, t := range schema.Tables {
+		name := t.QualifiedName()
+		if slices.Contains(move.CopiedTables, name) {
+			continue
+		}
+
+		if _, err := dstConn.Exec(ctx, "TRUNCATE ONLY "+name); err != nil {
+			return fmt.Errorf("failed to truncate %s on target: %w", name, err)
+		}
+		rows, err := db.CopyTable(ctx, srcConn, dstConn, t)
+		if err != nil {
+			return err
+		}
+
+		move.CopiedTables = append(move.CopiedTables, name)
+		if err := m.store.SaveMove(ctx, move); err != nil {
+			return err
+		}
+		progress(MoveProgress{Phase: movePhaseCopy, Table: name, Rows: rows, TablesDone: len(move.CopiedTables), TablesTotal: total})
+	}
+
+	return nil
+}
+
+// moveFinalize checks that every table has the same number of rows on both servers,
+// then adds constraints, indexes and triggers and restores sequence values.
+func (m *Manager) moveFinalize(ctx context.Context, dbRecord *meta.Database, src, dst pgServer, progress func(MoveProgress)) error {
+	srcConn, err := src.ConnectDatabase(ctx, dbRecord.Name)
+	if err != nil {
+		return fmt.Errorf("failed to connect to source: %w", err)
+	}
+	defer srcConn.Close(ctx)
+
+	dstConn, err := dst.ConnectDatabase(ctx, dbRecord.Name)
+	if err != nil {
+		return fmt.Errorf("failed to connect to target: %w", err)
+	}
+	defer dstConn.Close(ctx)
+
+	schema, err := db.ReadSchema(ctx, srcConn)
+	if err != nil {
+		return err
+	}
+
+	for i, t := range schema.Tables {
+		want, err := db.CountRows(ctx, srcConn, t)
+		if err != nil {
+			return err
+		}
+		got, err := db.CountRows(ctx, dstConn, t)
+		if err != nil {
+			return err
+		}
+		if got != want {
+			return fmt.Errorf("row count mismatch for %s: source has %d, target has %d", t.QualifiedName(), want, got)
+		}
+		progress(MoveProgress{Phase: movePhaseFinalize, Table: t.QualifiedName(), Rows: got, TablesDone: i + 1, TablesTotal: len(schema.Tables)})
+	}
+
+	stmts := append([]string{"SET ROLE " + pgx.Identifier{dbRecord.UserName}.Sanitize()}, schema.PostDataStatements()...)
+	stmts = append(stmts, schema.SequenceValueStatements()...)
+	return db.ApplyStatements(ctx, dstConn, stmts)
+}
+
+// readSchema reads the schema of a database on a server
+func readSchema(ctx context.Context, pg pgServer, dbName string) (*db.Schema, error) {
+	conn, err := pg.ConnectDatabase(ctx, dbName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(ctx)
+
+	return db.ReadSchema(ctx, conn)
+}
+
+// nextMovePhase returns the phase that follows phase
+func nextMovePhase(phase string) string {
+	switch phase {
+	case movePhasePrepare:
+		return movePhaseCopy
+	case movePhaseCopy:
+		return movePhaseFinalize
+	case movePhaseFinalize:
+		return movePhaseSwitch
+	default:
+		return movePhaseCleanup
+	}
+}
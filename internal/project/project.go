@@ -4,11 +4,19 @@ import (
 	"context"
 	"fmt"
 	"regexp"
+	"strconv"
 	"strings"
+	"sync"
 	"time"
 
+	"github.com/jackc/pgx/v5"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/backup"
 	"pgmanager/internal/config"
 	"pgmanager/internal/db"
+	"pgmanager/internal/events"
+	"pgmanager/internal/export"
 	"pgmanager/internal/meta"
 )
 
@@ -25,21 +33,48 @@ var (
 		"root":      true,
 		"system":    true,
 	}
-
-	// validEnvs are the allowed environment names
-	validEnvs = map[string]bool{
-		"prod":    true,
-		"dev":     true,
-		"staging": true,
-		"pr":      true,
-	}
 )
 
+// pgServer is a PostgreSQL server hosting managed databases, implemented by
+// *db.PostgresClient
+type pgServer interface {
+	ConnectDatabase(ctx context.Context, dbName string) (*pgx.Conn, error)
+	ConnectAs(ctx context.Context, dbName, userName, password string) (*pgx.Conn, error)
+	CreateDatabase(ctx context.Context, dbName, userName, password string) error
+	EnsureRole(ctx context.Context, userName, password string) error
+	SetConnectionLimit(ctx context.Context, dbName string, limit int) error
+	DropDatabase(ctx context.Context, dbName, userName string) error
+	RecreateDatabase(ctx context.Context, dbName, owner string) error
+	DropSchemas(ctx context.Context, dbName, owner string) error
+	RunSQL(ctx context.Context, dbName, role, script string) error
+	ListSessions(ctx context.Context, dbName string) ([]db.Session, error)
+	TerminateSessions(ctx context.Context, dbName string, pid int) (int, error)
+	DatabaseExists(ctx context.Context, dbName string) (bool, error)
+	ActivityStats(ctx context.Context) (map[string]db.DatabaseActivity, error)
+	DatabaseSettings(ctx context.Context, dbName string) (*db.DatabaseSettings, error)
+	SetStatementTimeout(ctx context.Context, dbName, timeout string) error
+	CreateExtension(ctx context.Context, dbName, extension string) error
+	CreateAccessRole(ctx context.Context, dbName, owner, role, password, access string) error
+	SetRoleAccess(ctx context.Context, dbName, owner, role, access string) error
+	DropAccessRole(ctx context.Context, dbName, owner, role string) error
+}
+
 // Manager handles project and database operations
 type Manager struct {
-	cfg   *config.Config
-	pg    *db.PostgresClient
-	store meta.Store
+	cfg     *config.Config
+	servers map[string]pgServer
+	store   meta.Store
+	backups backup.Target // nil when no backup target is configured
+	work    *workTracker  // Databases pgmanager itself is working on
+	bus     *events.Bus   // Lifecycle events of this process, streamed by the API
+
+	// expiryNotified holds the database.expiring notices published on the bus,
+	// as of the last scan of queueExpiryNotices
+	expiryNotified map[string]bool
+
+	// jobs runs background jobs once StartJobs is called
+	jobsMu sync.Mutex
+	jobs   *jobPool
 }
 
 // DatabaseInfo contains information about a database
@@ -50,19 +85,143 @@ type DatabaseInfo struct {
 	DatabaseName string
 	UserName     string
 	Password     string
+	Server       string
 	Host         string
 	Port         int
+	SSLMode      string
 	ConnString   string
 	CreatedAt    time.Time
 	ExpiresAt    *time.Time
+	LastActivity *time.Time
+	Protected    bool
+}
+
+// CleanupResult describes the outcome of a cleanup run
+type CleanupResult struct {
+	Deleted  []string
+	Warnings []IdleDatabase
+}
+
+// IdleDatabase is a database matched by a "warn" cleanup rule
+type IdleDatabase struct {
+	DatabaseName string
+	Env          string
+	LastActivity time.Time // Creation time if the database was never seen active
+	IdleFor      time.Duration
 }
 
 // NewManager creates a new project manager
 func NewManager(cfg *config.Config, store meta.Store) *Manager {
-	return &Manager{
-		cfg:   cfg,
-		pg:    db.NewPostgresClient(&cfg.Postgres),
-		store: store,
+	work := newWorkTracker()
+	servers := make(map[string]pgServer)
+	for _, name := range cfg.ServerNames() {
+		serverCfg, _ := cfg.Server(name)
+		servers[name] = trackedServer{db.NewPostgresClient(serverCfg), work}
+	}
+
+	m := &Manager{
+		cfg:     cfg,
+		servers: servers,
+		work:    work,
+		store:   store,
+		bus:     events.NewBus(EventLogSize),
+	}
+	if cfg.Backups.Dir != "" {
+		m.backups = backup.NewLocalTarget(cfg.Backups.Dir)
+	}
+	return m
+}
+
+// SetBackupTarget replaces the target backups are written to
+func (m *Manager) SetBackupTarget(target backup.Target) {
+	m.backups = target
+}
+
+// client returns the PostgreSQL client for a named server
+func (m *Manager) client(server string) (pgServer, error) {
+	if server == "" {
+		server = config.DefaultServer
+	}
+	pg, ok := m.servers[server]
+	if !ok {
+		return nil, fmt.Errorf("unknown server '%s'", server)
+	}
+	return pg, nil
+}
+
+// dropDatabase drops a database and its user from the server hosting it
+func (m *Manager) dropDatabase(ctx context.Context, dbRecord meta.Database) error {
+	pg, err := m.client(dbRecord.Server)
+	if err != nil {
+		return err
+	}
+	return pg.DropDatabase(ctx, dbRecord.Name, dbRecord.UserName)
+}
+
+// discardDatabase removes a database that an operation created and then failed
+// to fill. Removing it is part of that operation, so it checks no permissions
+// and records no deletion of its own.
+func (m *Manager) discardDatabase(ctx context.Context, projectName string, dbRecord *meta.Database) error {
+	// The operation may have failed because its context was canceled
+	ctx = context.WithoutCancel(ctx)
+	if err := m.dropDatabase(ctx, *dbRecord); err != nil {
+		return fmt.Errorf("failed to drop database: %w", err)
+	}
+	if err := m.store.DeleteDatabase(ctx, dbRecord.Name); err != nil {
+		return fmt.Errorf("failed to delete database metadata: %w", err)
+	}
+	m.emit(ctx, newEvent(ctx, EventDatabaseDeleted, projectName, dbRecord), "")
+	return nil
+}
+
+// checkProtected refuses destructive operations on a protected database
+func checkProtected(dbRecord *meta.Database) error {
+	if dbRecord.Protected {
+		return fmt.Errorf("database %s is protected", dbRecord.Name)
+	}
+	return nil
+}
+
+// databaseInfo builds the DatabaseInfo for a metadata record, taking the
+// connection details from the server the database lives on
+func (m *Manager) databaseInfo(projectName string, dbRecord *meta.Database) *DatabaseInfo {
+	info := &DatabaseInfo{
+		Project:      projectName,
+		Env:          dbRecord.Env,
+		PRNumber:     dbRecord.PRNumber,
+		DatabaseName: dbRecord.Name,
+		UserName:     dbRecord.UserName,
+		Password:     dbRecord.Password,
+		Server:       dbRecord.Server,
+		CreatedAt:    dbRecord.CreatedAt,
+		ExpiresAt:    dbRecord.ExpiresAt,
+		LastActivity: dbRecord.LastActivityAt,
+		Protected:    dbRecord.Protected,
+	}
+
+	if serverCfg, err := m.cfg.Server(dbRecord.Server); err == nil {
+		info.Host = serverCfg.Host
+		info.Port = serverCfg.Port
+		info.SSLMode = serverCfg.SSLMode
+		if info.SSLMode == "" {
+			info.SSLMode = "require"
+		}
+		info.ConnString = db.ConnectionString(serverCfg.Host, serverCfg.Port, dbRecord.Name, dbRecord.UserName, dbRecord.Password, serverCfg.SSLMode)
+	}
+
+	return info
+}
+
+// Connection returns the connection details for rendering with the export package
+func (i *DatabaseInfo) Connection() export.Connection {
+	return export.Connection{
+		Host:     i.Host,
+		Port:     i.Port,
+		Database: i.DatabaseName,
+		User:     i.UserName,
+		Password: i.Password,
+		SSLMode:  i.SSLMode,
+		URL:      i.ConnString,
 	}
 }
 
@@ -85,8 +244,8 @@ func ValidateName(name string) error {
 
 // ValidateEnv validates an environment name
 func ValidateEnv(env string) error {
-	if !validEnvs[env] {
-		return fmt.Errorf("invalid environment '%s', must be one of: prod, dev, staging, pr", env)
+	if !config.ValidEnv(env) {
+		return fmt.Errorf("invalid environment '%s', must be one of: %s", env, strings.Join(config.Envs, ", "))
 	}
 	return nil
 }
@@ -99,41 +258,116 @@ func DatabaseName(project, env string, prNumber *int) string {
 	return fmt.Sprintf("%s_%s", project, env)
 }
 
+// BelongsToProject reports whether a database name is one DatabaseName gives
+// a project, so that "myapp_v2_dev" does not count as a database of "myapp"
+func BelongsToProject(dbName, projectName string) bool {
+	env, ok := strings.CutPrefix(dbName, projectName+"_")
+	if !ok {
+		return false
+	}
+	if number, ok := strings.CutPrefix(env, "pr_"); ok {
+		_, err := strconv.Atoi(number)
+		return err == nil
+	}
+	return config.ValidEnv(env) && env != "pr"
+}
+
+// CanAccessDatabase reports whether a principal may work on a database, given
+// its name. A nil principal, as for the CLI, may access every database.
+func CanAccessDatabase(p *auth.Principal, dbName string) bool {
+	if p == nil || !p.Restricted() {
+		return true
+	}
+	candidates := p.Projects
+	if len(candidates) == 0 {
+		for projectName := range p.Roles {
+			candidates = append(candidates, projectName)
+		}
+	}
+	for _, projectName := range candidates {
+		if BelongsToProject(dbName, projectName) && p.CanAccessProject(projectName) {
+			return true
+		}
+	}
+	return false
+}
+
 // UserName generates the user name for a database
 func UserName(dbName string) string {
 	return dbName + "_user"
 }
 
 // CreateProject creates a new project
-func (m *Manager) CreateProject(ctx context.Context, name string) error {
+func (m *Manager) CreateProject(ctx context.Context, name string) (_ *meta.Project, err error) {
+	defer func() { m.record(ctx, "project.create", name, name, err) }()
+
+	if err := authorize(ctx, auth.ScopeCreate, name); err != nil {
+		return nil, err
+	}
+
 	if err := ValidateName(name); err != nil {
-		return err
+		return nil, err
 	}
 
 	// Check if project already exists
 	existing, err := m.store.GetProject(ctx, name)
 	if err != nil {
-		return fmt.Errorf("failed to check project: %w", err)
+		return nil, fmt.Errorf("failed to check project: %w", err)
 	}
 	if existing != nil {
-		return fmt.Errorf("project '%s' already exists", name)
+		return nil, fmt.Errorf("project '%s' already exists", name)
 	}
 
-	_, err = m.store.CreateProject(ctx, name)
+	p, err := m.store.CreateProject(ctx, name)
 	if err != nil {
-		return fmt.Errorf("failed to create project: %w", err)
+		return nil, fmt.Errorf("failed to create project: %w", err)
 	}
 
-	return nil
+	m.emit(ctx, newEvent(ctx, EventProjectCreated, name, nil), "")
+	return p, nil
 }
 
-// ListProjects returns all projects
+// ListProjects returns all projects the caller can see
 func (m *Manager) ListProjects(ctx context.Context) ([]meta.Project, error) {
-	return m.store.ListProjects(ctx)
+	projects, err := m.store.ListProjects(ctx)
+	if err != nil {
+		return nil, err
+	}
+
+	visible := projects[:0]
+	for _, p := range projects {
+		if canSee(ctx, p.Name) {
+			visible = append(visible, p)
+		}
+	}
+	return visible, nil
 }
 
-// DeleteProject deletes a project and all its databases
-func (m *Manager) DeleteProject(ctx context.Context, name string) error {
+// DeleteProject deletes a project and all its databases. Projects with a
+// protected database cannot be deleted.
+func (m *Manager) DeleteProject(ctx context.Context, name string) (err error) {
+	defer func() { m.record(ctx, "project.delete", name, name, err) }()
+
+	if err := authorize(ctx, auth.ScopeDelete, name); err != nil {
+		return err
+	}
+
+	project, err := m.store.GetProject(ctx, name)
+	if err != nil {
+		return fmt.Errorf("failed to get project: %w", err)
+	}
+	if project != nil {
+		existing, err := m.store.ListDatabases(ctx, project.ID)
+		if err != nil {
+			return fmt.Errorf("failed to list databases: %w", err)
+		}
+		for i := range existing {
+			if err := checkProtected(&existing[i]); err != nil {
+				return err
+			}
+		}
+	}
+
 	// Get all databases for this project
 	databases, err := m.store.DeleteProject(ctx, name)
 	if err != nil {
@@ -141,18 +375,33 @@ func (m *Manager) DeleteProject(ctx context.Context, name string) error {
 	}
 
 	// Drop all databases from PostgreSQL
-	for _, db := range databases {
-		if err := m.pg.DropDatabase(ctx, db.Name, db.UserName); err != nil {
+	for i, db := range databases {
+		if err := m.dropDatabase(ctx, db); err != nil {
 			// Log but continue with other databases
 			fmt.Printf("Warning: failed to drop database %s: %v\n", db.Name, err)
 		}
+		m.emit(ctx, newEvent(ctx, EventDatabaseDeleted, name, &databases[i]), "")
 	}
 
+	m.emit(ctx, newEvent(ctx, EventProjectDeleted, name, nil), "")
 	return nil
 }
 
-// CreateDatabase creates a new database for a project
-func (m *Manager) CreateDatabase(ctx context.Context, projectName, env string, prNumber *int) (*DatabaseInfo, error) {
+// CreateDatabase creates a new database for a project and runs the project's init
+// scripts, automatic migrations and seed scripts in it. The database is placed on server, or on the server chosen
+// by the placement rules when server is empty.
+func (m *Manager) CreateDatabase(ctx context.Context, projectName, env string, prNumber *int, server string) (_ *DatabaseInfo, err error) {
+	defer func() { m.record(ctx, "database.create", projectName, DatabaseName(projectName, env, prNumber), err) }()
+
+	if err := authorize(ctx, auth.ScopeCreate, projectName); err != nil {
+		return nil, err
+	}
+
+	return m.createDatabase(ctx, projectName, env, prNumber, server, true)
+}
+
+// createDatabase creates a database, running the project scripts only if initialize is set
+func (m *Manager) createDatabase(ctx context.Context, projectName, env string, prNumber *int, server string, initialize bool) (*DatabaseInfo, error) {
 	if err := ValidateEnv(env); err != nil {
 		return nil, err
 	}
@@ -179,6 +428,14 @@ func (m *Manager) CreateDatabase(ctx context.Context, projectName, env string, p
 		return nil, fmt.Errorf("database already exists for %s/%s", projectName, env)
 	}
 
+	if server == "" {
+		server = m.cfg.PlaceDatabase(projectName, env)
+	}
+	pg, err := m.client(server)
+	if err != nil {
+		return nil, err
+	}
+
 	// Generate names and password
 	dbName := DatabaseName(projectName, env, prNumber)
 	userName := UserName(dbName)
@@ -192,81 +449,56 @@ func (m *Manager) CreateDatabase(ctx context.Context, projectName, env string, p
 	}
 
 	// Create database in PostgreSQL
-	if err := m.pg.CreateDatabase(ctx, dbName, userName, password); err != nil {
+	if err := pg.CreateDatabase(ctx, dbName, userName, password); err != nil {
 		return nil, fmt.Errorf("failed to create database: %w", err)
 	}
 
 	// Store metadata
-	dbRecord, err := m.store.CreateDatabase(ctx, project.ID, dbName, userName, password, env, prNumber, expiresAt)
+	dbRecord, err := m.store.CreateDatabase(ctx, project.ID, dbName, userName, password, env, server, prNumber, expiresAt)
 	if err != nil {
 		// Try to clean up the PostgreSQL database
-		_ = m.pg.DropDatabase(ctx, dbName, userName)
+		_ = pg.DropDatabase(ctx, dbName, userName)
 		return nil, fmt.Errorf("failed to store database metadata: %w", err)
 	}
 
-	return &DatabaseInfo{
-		Project:      projectName,
-		Env:          env,
-		PRNumber:     prNumber,
-		DatabaseName: dbName,
-		UserName:     userName,
-		Password:     password,
-		Host:         m.cfg.Postgres.Host,
-		Port:         m.cfg.Postgres.Port,
-		ConnString:   db.ConnectionString(m.cfg.Postgres.Host, m.cfg.Postgres.Port, dbName, userName, password, m.cfg.Postgres.SSLMode),
-		CreatedAt:    dbRecord.CreatedAt,
-		ExpiresAt:    expiresAt,
-	}, nil
+	if initialize {
+		if err := m.runProjectScripts(ctx, projectName, pg, dbRecord); err != nil {
+			_ = pg.DropDatabase(ctx, dbName, userName)
+			_ = m.store.DeleteDatabase(ctx, dbName)
+			return nil, err
+		}
+	}
+
+	m.emit(ctx, newEvent(ctx, EventDatabaseCreated, projectName, dbRecord), "")
+	return m.databaseInfo(projectName, dbRecord), nil
 }
 
 // GetDatabase returns information about a database
 func (m *Manager) GetDatabase(ctx context.Context, projectName, env string, prNumber *int) (*DatabaseInfo, error) {
-	if err := ValidateEnv(env); err != nil {
+	if err := authorize(ctx, auth.ScopeRead, projectName); err != nil {
 		return nil, err
 	}
 
-	// Get project
-	project, err := m.store.GetProject(ctx, projectName)
+	dbRecord, err := m.findDatabase(ctx, projectName, env, prNumber)
 	if err != nil {
-		return nil, fmt.Errorf("failed to get project: %w", err)
-	}
-	if project == nil {
-		return nil, fmt.Errorf("project '%s' not found", projectName)
-	}
-
-	// Get database
-	dbRecord, err := m.store.GetDatabase(ctx, project.ID, env, prNumber)
-	if err != nil {
-		return nil, fmt.Errorf("failed to get database: %w", err)
-	}
-	if dbRecord == nil {
-		envStr := env
-		if prNumber != nil {
-			envStr = fmt.Sprintf("pr_%d", *prNumber)
-		}
-		return nil, fmt.Errorf("database not found for %s/%s", projectName, envStr)
+		return nil, err
 	}
 
-	return &DatabaseInfo{
-		Project:      projectName,
-		Env:          env,
-		PRNumber:     dbRecord.PRNumber,
-		DatabaseName: dbRecord.Name,
-		UserName:     dbRecord.UserName,
-		Password:     dbRecord.Password,
-		Host:         m.cfg.Postgres.Host,
-		Port:         m.cfg.Postgres.Port,
-		ConnString:   db.ConnectionString(m.cfg.Postgres.Host, m.cfg.Postgres.Port, dbRecord.Name, dbRecord.UserName, dbRecord.Password, m.cfg.Postgres.SSLMode),
-		CreatedAt:    dbRecord.CreatedAt,
-		ExpiresAt:    dbRecord.ExpiresAt,
-	}, nil
+	return m.databaseInfo(projectName, dbRecord), nil
 }
 
-// ListDatabases returns all databases for a project, or all databases if project is empty
+// ListDatabases returns all databases for a project, or all databases the caller
+// can see if project is empty
 func (m *Manager) ListDatabases(ctx context.Context, projectName string) ([]DatabaseInfo, error) {
 	var databases []meta.Database
 	var err error
 
+	if projectName != "" {
+		if err := authorize(ctx, auth.ScopeRead, projectName); err != nil {
+			return nil, err
+		}
+	}
+
 	if projectName == "" {
 		databases, err = m.store.ListAllDatabases(ctx)
 	} else {
@@ -299,26 +531,23 @@ func (m *Manager) ListDatabases(ctx context.Context, projectName string) ([]Data
 			projectNameStr = projectCache[dbItem.ProjectID]
 		}
 
-		result = append(result, DatabaseInfo{
-			Project:      projectNameStr,
-			Env:          dbItem.Env,
-			PRNumber:     dbItem.PRNumber,
-			DatabaseName: dbItem.Name,
-			UserName:     dbItem.UserName,
-			Password:     dbItem.Password,
-			Host:         m.cfg.Postgres.Host,
-			Port:         m.cfg.Postgres.Port,
-			ConnString:   db.ConnectionString(m.cfg.Postgres.Host, m.cfg.Postgres.Port, dbItem.Name, dbItem.UserName, dbItem.Password, m.cfg.Postgres.SSLMode),
-			CreatedAt:    dbItem.CreatedAt,
-			ExpiresAt:    dbItem.ExpiresAt,
-		})
+		if !canSee(ctx, projectNameStr) {
+			continue
+		}
+		result = append(result, *m.databaseInfo(projectNameStr, &dbItem))
 	}
 
 	return result, nil
 }
 
 // DeleteDatabase deletes a database
-func (m *Manager) DeleteDatabase(ctx context.Context, projectName, env string, prNumber *int) error {
+func (m *Manager) DeleteDatabase(ctx context.Context, projectName, env string, prNumber *int) (err error) {
+	defer func() { m.record(ctx, "database.delete", projectName, DatabaseName(projectName, env, prNumber), err) }()
+
+	if err := authorize(ctx, auth.ScopeDelete, projectName); err != nil {
+		return err
+	}
+
 	if err := ValidateEnv(env); err != nil {
 		return err
 	}
@@ -340,9 +569,12 @@ func (m *Manager) DeleteDatabase(ctx context.Context, projectName, env string, p
 	if dbRecord == nil {
 		return fmt.Errorf("database not found")
 	}
+	if err := checkProtected(dbRecord); err != nil {
+		return err
+	}
 
 	// Drop from PostgreSQL
-	if err := m.pg.DropDatabase(ctx, dbRecord.Name, dbRecord.UserName); err != nil {
+	if err := m.dropDatabase(ctx, *dbRecord); err != nil {
 		return fmt.Errorf("failed to drop database: %w", err)
 	}
 
@@ -351,12 +583,101 @@ func (m *Manager) DeleteDatabase(ctx context.Context, projectName, env string, p
 		return fmt.Errorf("failed to delete database metadata: %w", err)
 	}
 
+	m.emit(ctx, newEvent(ctx, EventDatabaseDeleted, projectName, dbRecord), "")
 	return nil
 }
 
-// Cleanup removes expired and old PR databases
-func (m *Manager) Cleanup(ctx context.Context, olderThan time.Duration) ([]string, error) {
-	var deleted []string
+// ListSessions returns the sessions connected to a managed database
+func (m *Manager) ListSessions(ctx context.Context, projectName, env string, prNumber *int) ([]db.Session, error) {
+	if err := authorize(ctx, auth.ScopeRead, projectName); err != nil {
+		return nil, err
+	}
+
+	dbRecord, err := m.findDatabase(ctx, projectName, env, prNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	pg, err := m.client(dbRecord.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	return pg.ListSessions(ctx, dbRecord.Name)
+}
+
+// KillSessions terminates the session with the given pid on a managed database,
+// or every session when pid is 0. It returns the number of sessions terminated.
+func (m *Manager) KillSessions(ctx context.Context, projectName, env string, prNumber *int, pid int) (_ int, err error) {
+	defer func() {
+		m.record(ctx, "database.kill_sessions", projectName, DatabaseName(projectName, env, prNumber), err)
+	}()
+
+	if err := authorize(ctx, auth.ScopeDelete, projectName); err != nil {
+		return 0, err
+	}
+
+	dbRecord, err := m.findDatabase(ctx, projectName, env, prNumber)
+	if err != nil {
+		return 0, err
+	}
+
+	pg, err := m.client(dbRecord.Server)
+	if err != nil {
+		return 0, err
+	}
+
+	n, err := pg.TerminateSessions(ctx, dbRecord.Name, pid)
+	if err != nil {
+		return 0, err
+	}
+	if pid != 0 && n == 0 {
+		return 0, fmt.Errorf("session %d not found on %s", pid, dbRecord.Name)
+	}
+	return n, nil
+}
+
+// findDatabase looks up the metadata record for a project environment
+func (m *Manager) findDatabase(ctx context.Context, projectName, env string, prNumber *int) (*meta.Database, error) {
+	if err := ValidateEnv(env); err != nil {
+		return nil, err
+	}
+
+	project, err := m.store.GetProject(ctx, projectName)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get project: %w", err)
+	}
+	if project == nil {
+		return nil, fmt.Errorf("project '%s' not found", projectName)
+	}
+
+	dbRecord, err := m.store.GetDatabase(ctx, project.ID, env, prNumber)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get database: %w", err)
+	}
+	if dbRecord == nil {
+		envStr := env
+		if prNumber != nil {
+			envStr = fmt.Sprintf("pr_%d", *prNumber)
+		}
+		return nil, fmt.Errorf("database not found for %s/%s", projectName, envStr)
+	}
+
+	return dbRecord, nil
+}
+
+// Cleanup removes expired and old PR databases and applies the configured idle rules.
+// PR databases that have been active within olderThan are kept regardless of age.
+func (m *Manager) Cleanup(ctx context.Context, olderThan time.Duration) (_ *CleanupResult, err error) {
+	defer func() {
+		if err != nil {
+			m.record(ctx, "cleanup", "", "", err)
+		}
+	}()
+
+	if err := authorizeAll(ctx, auth.ScopeDelete); err != nil {
+		return nil, err
+	}
 
 	// Get expired databases
 	expired, err := m.store.GetExpiredDatabases(ctx)
@@ -375,26 +696,153 @@ func (m *Manager) Cleanup(ctx context.Context, olderThan time.Duration) ([]strin
 	for _, db := range expired {
 		toDelete[db.Name] = db
 	}
+	cutoff := time.Now().Add(-olderThan)
 	for _, db := range oldPR {
+		if db.LastActivityAt != nil && db.LastActivityAt.After(cutoff) {
+			continue
+		}
 		toDelete[db.Name] = db
 	}
 
-	// Delete each database
+	// Apply idle rules
+	warned := make(map[string]IdleDatabase)
+	for _, rule := range m.cfg.Cleanup.Rules {
+		idle, err := m.store.GetIdleDatabases(ctx, rule.Env, rule.IdleFor)
+		if err != nil {
+			return nil, fmt.Errorf("failed to get idle %s databases: %w", rule.Env, err)
+		}
+		for _, db := range idle {
+			if rule.Action == "drop" {
+				toDelete[db.Name] = db
+				continue
+			}
+			lastActivity := db.CreatedAt
+			if db.LastActivityAt != nil {
+				lastActivity = *db.LastActivityAt
+			}
+			warned[db.Name] = IdleDatabase{
+				DatabaseName: db.Name,
+				Env:          db.Env,
+				LastActivity: lastActivity,
+				IdleFor:      time.Since(lastActivity).Round(time.Minute),
+			}
+		}
+	}
+
+	result := &CleanupResult{}
+	for name, w := range warned {
+		if _, ok := toDelete[name]; !ok {
+			result.Warnings = append(result.Warnings, w)
+		}
+	}
+
+	// Delete each database; protected databases are never cleaned up
+	projectNames := m.projectNames(ctx)
+	done := 0
 	for _, dbRecord := range toDelete {
-		if err := m.pg.DropDatabase(ctx, dbRecord.Name, dbRecord.UserName); err != nil {
+		reportProgress(ctx, done, len(toDelete))
+		done++
+		if err := ctx.Err(); err != nil {
+			return nil, err
+		}
+		if dbRecord.Protected {
+			continue
+		}
+		if err := m.dropDatabase(ctx, dbRecord); err != nil {
 			fmt.Printf("Warning: failed to drop database %s: %v\n", dbRecord.Name, err)
+			logJob(ctx, "Failed to drop %s: %v", dbRecord.Name, err)
+			m.record(ctx, "database.cleanup", projectNames[dbRecord.ProjectID], dbRecord.Name, err)
 			continue
 		}
 
 		if err := m.store.DeleteDatabase(ctx, dbRecord.Name); err != nil {
 			fmt.Printf("Warning: failed to delete metadata for %s: %v\n", dbRecord.Name, err)
+			logJob(ctx, "Failed to delete metadata for %s: %v", dbRecord.Name, err)
+			m.record(ctx, "database.cleanup", projectNames[dbRecord.ProjectID], dbRecord.Name, err)
 			continue
 		}
 
-		deleted = append(deleted, dbRecord.Name)
+		logJob(ctx, "Deleted %s", dbRecord.Name)
+		m.record(ctx, "database.cleanup", projectNames[dbRecord.ProjectID], dbRecord.Name, nil)
+		m.emit(ctx, newEvent(ctx, EventDatabaseDeleted, projectNames[dbRecord.ProjectID], &dbRecord), "")
+		result.Deleted = append(result.Deleted, dbRecord.Name)
 	}
 
-	return deleted, nil
+	return result, nil
+}
+
+// SampleActivity records which managed databases are currently in use, based on
+// open sessions and transaction counters reported by each server. Sessions and
+// transactions of pgmanager's own work do not count.
+func (m *Manager) SampleActivity(ctx context.Context) error {
+	now := time.Now()
+	prevSample := m.work.sample(now)
+
+	stats := make(map[string]map[string]db.DatabaseActivity)
+	for name, pg := range m.servers {
+		serverStats, err := pg.ActivityStats(ctx)
+		if err != nil {
+			// Keep sampling the other servers
+			fmt.Printf("Warning: failed to sample activity on server %s: %v\n", name, err)
+			continue
+		}
+		stats[name] = serverStats
+	}
+
+	databases, err := m.store.ListAllDatabases(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list databases: %w", err)
+	}
+
+	for _, dbRecord := range databases {
+		sample, ok := stats[dbRecord.Server][dbRecord.Name]
+		if !ok {
+			continue
+		}
+
+		ownWork := m.work.workedSince(dbRecord.Name, prevSample)
+		lastActivity := nextActivity(dbRecord, sample, ownWork, now)
+		if lastActivity == dbRecord.LastActivityAt && sample.Xacts == dbRecord.ActivityCounter {
+			continue
+		}
+		if err := m.store.UpdateDatabaseActivity(ctx, dbRecord.Name, lastActivity, sample.Xacts); err != nil {
+			return fmt.Errorf("failed to record activity for %s: %w", dbRecord.Name, err)
+		}
+	}
+
+	return nil
+}
+
+// RunActivitySampler samples database activity every interval until ctx is canceled
+func (m *Manager) RunActivitySampler(ctx context.Context, interval time.Duration) {
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	for {
+		if err := m.SampleActivity(ctx); err != nil {
+			fmt.Printf("Warning: %v\n", err)
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// nextActivity returns the last activity time for a database given a new sample.
+// Open sessions or a changed transaction counter count as activity at now. The
+// counter does not when ownWork is set, as pgmanager changed it itself, or when
+// no counter was recorded before, as on the first sample after an upgrade.
+func nextActivity(prev meta.Database, sample db.DatabaseActivity, ownWork bool, now time.Time) *time.Time {
+	if sample.Connections > 0 {
+		return &now
+	}
+	if prev.ActivityCounter != 0 && sample.Xacts != prev.ActivityCounter && !ownWork {
+		return &now
+	}
+	return prev.LastActivityAt
 }
 
 // ParseEnv parses an environment string which may include a PR number
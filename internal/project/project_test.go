@@ -1,7 +1,29 @@
 package project
 
 import (
+	"bytes"
+	"compress/gzip"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"strings"
+	"sync"
 	"testing"
+	"time"
+
+	"github.com/jackc/pgx/v5"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/config"
+	"pgmanager/internal/db"
+	"pgmanager/internal/manifest"
+	"pgmanager/internal/meta"
+	"pgmanager/internal/webhook"
 )
 
 func TestValidateName(t *testing.T) {
@@ -147,3 +169,978 @@ func TestParseEnv(t *testing.T) {
 func intPtr(i int) *int {
 	return &i
 }
+
+func TestNextActivity(t *testing.T) {
+	now := time.Now()
+	earlier := now.Add(-48 * time.Hour)
+
+	tests := []struct {
+		name    string
+		prev    meta.Database
+		sample  db.DatabaseActivity
+		ownWork bool
+		want    *time.Time
+	}{
+		{"open sessions", meta.Database{ActivityCounter: 10, LastActivityAt: &earlier}, db.DatabaseActivity{Connections: 2, Xacts: 10}, false, &now},
+		{"open sessions during own work", meta.Database{ActivityCounter: 10, LastActivityAt: &earlier}, db.DatabaseActivity{Connections: 1, Xacts: 12}, true, &now},
+		{"counter advanced", meta.Database{ActivityCounter: 10, LastActivityAt: &earlier}, db.DatabaseActivity{Xacts: 15}, false, &now},
+		{"counter advanced by own work", meta.Database{ActivityCounter: 10, LastActivityAt: &earlier}, db.DatabaseActivity{Xacts: 15}, true, &earlier},
+		{"counter reset", meta.Database{ActivityCounter: 10, LastActivityAt: &earlier}, db.DatabaseActivity{Xacts: 3}, false, &now},
+		{"no change", meta.Database{ActivityCounter: 10, LastActivityAt: &earlier}, db.DatabaseActivity{Xacts: 10}, false, &earlier},
+		{"first sample", meta.Database{LastActivityAt: &earlier}, db.DatabaseActivity{Xacts: 5000}, false, &earlier},
+		{"never active", meta.Database{}, db.DatabaseActivity{}, false, nil},
+	}
+
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			got := nextActivity(tt.prev, tt.sample, tt.ownWork, now)
+			if (got == nil) != (tt.want == nil) {
+				t.Fatalf("nextActivity() = %v, want %v", got, tt.want)
+			}
+			if got != nil && !got.Equal(*tt.want) {
+				t.Errorf("nextActivity() = %v, want %v", *got, *tt.want)
+			}
+		})
+	}
+}
+
+func TestWorkTracker(t *testing.T) {
+	w := newWorkTracker()
+	first := w.sample(time.Now())
+
+	end := w.begin("myapp_prod")
+	if !w.workedSince("myapp_prod", first) || w.workedSince("myapp_dev", first) {
+		t.Error("workedSince() should only report the database being worked on")
+	}
+	end()
+	end() // Ending twice is harmless
+	second := w.sample(time.Now())
+	if !w.workedSince("myapp_prod", second) {
+		t.Error("workedSince() should report work that just ended, as its transactions may be reported late")
+	}
+
+	w.sample(time.Now().Add(time.Hour))
+	fourth := w.sample(time.Now().Add(2 * time.Hour))
+	if w.workedSince("myapp_prod", fourth) {
+		t.Error("workedSince() should not report work that ended before the previous sample")
+	}
+}
+
+func TestCleanupWarnsIdleDatabases(t *testing.T) {
+	ctx := context.Background()
+	store := meta.NewMockStore()
+	cfg := config.Default()
+	cfg.Cleanup.Rules = []config.CleanupRule{
+		{Env: "staging", IdleFor: 30 * 24 * time.Hour, Action: "warn"},
+	}
+	mgr := NewManager(cfg, store)
+
+	p, _ := store.CreateProject(ctx, "myapp")
+	store.CreateDatabase(ctx, p.ID, "myapp_staging", "myapp_staging_user", "pw", "staging", "default", nil, nil)
+	store.CreateDatabase(ctx, p.ID, "myapp_dev", "myapp_dev_user", "pw", "dev", "default", nil, nil)
+
+	// Freshly created databases are not idle yet
+	result, err := mgr.Cleanup(ctx, 7*24*time.Hour)
+	if err != nil {
+		t.Fatalf("Cleanup() error = %v", err)
+	}
+	if len(result.Warnings) != 0 {
+		t.Errorf("warnings = %d, want 0", len(result.Warnings))
+	}
+
+	lastSeen := time.Now().Add(-45 * 24 * time.Hour)
+	store.UpdateDatabaseActivity(ctx, "myapp_staging", &lastSeen, 42)
+	store.UpdateDatabaseActivity(ctx, "myapp_dev", &lastSeen, 42)
+
+	result, err = mgr.Cleanup(ctx, 7*24*time.Hour)
+	if err != nil {
+		t.Fatalf("Cleanup() error = %v", err)
+	}
+	if len(result.Deleted) != 0 {
+		t.Errorf("deleted = %v, want none", result.Deleted)
+	}
+	if len(result.Warnings) != 1 || result.Warnings[0].DatabaseName != "myapp_staging" {
+		t.Errorf("warnings = %+v, want only myapp_staging", result.Warnings)
+	}
+}
+
+// fakeServer records the databases created and dropped on it. Connecting
+// fails, and methods it does not implement panic.
+type fakeServer struct {
+	pgServer
+	mu      sync.Mutex
+	created []string
+	dropped []string
+}
+
+func (s *fakeServer) CreateDatabase(ctx context.Context, dbName, userName, password string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.created = append(s.created, dbName)
+	return nil
+}
+
+func (s *fakeServer) DropDatabase(ctx context.Context, dbName, userName string) error {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	s.dropped = append(s.dropped, dbName)
+	return nil
+}
+
+func (s *fakeServer) ConnectDatabase(ctx context.Context, dbName string) (*pgx.Conn, error) {
+	return nil, fmt.Errorf("connection refused")
+}
+
+func TestFailedRestoreRemovesCreatedDatabase(t *testing.T) {
+	ctx := context.Background()
+	store := meta.NewMockStore()
+	mgr := NewManager(config.Default(), store)
+	server := &fakeServer{}
+	mgr.servers[config.DefaultServer] = server
+	store.CreateProject(ctx, "myapp")
+
+	var dump bytes.Buffer
+	gz := gzip.NewWriter(&dump)
+	header, _ := json.Marshal(db.DumpHeader{Format: db.DumpFormat, Version: db.DumpVersion, Database: "other_dev", Schema: &db.Schema{}})
+	gz.Write(append(header, '\n'))
+	gz.Close()
+
+	// Without the delete scope, as removing the database is part of the restore
+	creator := auth.WithPrincipal(ctx, &auth.Principal{Name: "ci", Scopes: []string{auth.ScopeRead, auth.ScopeCreate}})
+	if _, err := mgr.RestoreDatabase(creator, "myapp", "dev", nil, &dump); err == nil || !strings.Contains(err.Error(), "connection refused") {
+		t.Fatalf("RestoreDatabase() error = %v, want the connection failure", err)
+	}
+
+	if fmt.Sprint(server.created) != "[myapp_dev]" || fmt.Sprint(server.dropped) != "[myapp_dev]" {
+		t.Errorf("created %v and dropped %v, want myapp_dev both times", server.created, server.dropped)
+	}
+	if databases, _ := store.ListAllDatabases(ctx); len(databases) != 0 {
+		t.Errorf("databases after a failed restore = %+v, want none", databases)
+	}
+	if events, _ := mgr.ListAudit(ctx, meta.AuditFilter{Action: "database.delete"}); len(events) != 0 {
+		t.Errorf("audit events = %+v, want no database.delete", events)
+	}
+}
+
+func TestMoveDatabaseValidation(t *testing.T) {
+	ctx := context.Background()
+	store := meta.NewMockStore()
+	cfg := config.Default()
+	cfg.Servers = map[string]config.PostgresConfig{"replica": {Host: "replica.internal", Port: 5432}}
+	mgr := NewManager(cfg, store)
+
+	p, _ := store.CreateProject(ctx, "myapp")
+	store.CreateDatabase(ctx, p.ID, "myapp_staging", "myapp_staging_user", "pw", "staging", "default", nil, nil)
+
+	if err := mgr.MoveDatabase(ctx, "myapp", "staging", nil, "nowhere", false, nil); err == nil {
+		t.Error("MoveDatabase() to an unknown server should fail")
+	}
+	if err := mgr.MoveDatabase(ctx, "myapp", "staging", nil, "default", false, nil); err == nil {
+		t.Error("MoveDatabase() to the current server should fail")
+	}
+	if err := mgr.AbortMove(ctx, "myapp", "staging", nil); err == nil {
+		t.Error("AbortMove() without a move in progress should fail")
+	}
+
+	// A move in progress can only be resumed towards its original target
+	store.SaveMove(ctx, &meta.Move{DatabaseName: "myapp_staging", Source: "default", Target: "replica", Phase: "copy"})
+	err := mgr.MoveDatabase(ctx, "myapp", "staging", nil, "default", false, nil)
+	if err == nil || !strings.Contains(err.Error(), "already in progress") {
+		t.Errorf("MoveDatabase() with a different target error = %v, want already in progress", err)
+	}
+
+	// Once switched over, a move can no longer be aborted
+	store.SaveMove(ctx, &meta.Move{DatabaseName: "myapp_staging", Source: "default", Target: "replica", Phase: "cleanup"})
+	if err := mgr.AbortMove(ctx, "myapp", "staging", nil); err == nil {
+		t.Error("AbortMove() after switching should fail")
+	}
+}
+
+func TestExpiredBackups(t *testing.T) {
+	// Two backups a day at 02:00 and 14:00 for 60 days, newest first
+	start := time.Date(2024, 3, 31, 14, 0, 0, 0, time.UTC)
+	var backups []meta.Backup
+	for i := 0; i < 120; i++ {
+		backups = append(backups, meta.Backup{ID: int64(i + 1), CreatedAt: start.Add(-time.Duration(i) * 12 * time.Hour)})
+	}
+
+	expired := expiredBackups(backups, 7, 4)
+	kept := make(map[int64]bool)
+	for _, b := range backups {
+		kept[b.ID] = true
+	}
+	for _, b := range expired {
+		delete(kept, b.ID)
+	}
+
+	// 7 daily backups, plus the newest of the 3 weeks before the current one
+	if len(kept) != 10 {
+		t.Errorf("kept %d backups, want 10", len(kept))
+	}
+	if !kept[1] {
+		t.Error("newest backup should be kept")
+	}
+	if kept[2] {
+		t.Error("older backup of the same day should expire")
+	}
+
+	if got := expiredBackups(backups[:3], 7, 4); len(got) != 1 {
+		t.Errorf("expired %d of 3 recent backups, want only the duplicate day", len(got))
+	}
+}
+
+// memoryTarget is an in-memory backup target for tests
+type memoryTarget struct {
+	files map[string][]byte
+}
+
+func (t *memoryTarget) Name() string { return "memory" }
+
+func (t *memoryTarget) Write(ctx context.Context, key string, r io.Reader) (int64, error) {
+	data, err := io.ReadAll(r)
+	t.files[key] = data
+	return int64(len(data)), err
+}
+
+func (t *memoryTarget) Open(ctx context.Context, key string) (io.ReadCloser, error) {
+	return io.NopCloser(bytes.NewReader(t.files[key])), nil
+}
+
+func (t *memoryTarget) Delete(ctx context.Context, key string) error {
+	delete(t.files, key)
+	return nil
+}
+
+func TestPruneBackups(t *testing.T) {
+	ctx := context.Background()
+	store := meta.NewMockStore()
+	mgr := NewManager(config.Default(), store)
+	target := &memoryTarget{files: make(map[string][]byte)}
+	mgr.SetBackupTarget(target)
+
+	now := time.Now().UTC()
+	for i := 0; i < 5; i++ {
+		for _, name := range []string{"myapp_prod", "other_prod"} {
+			key := fmt.Sprintf("%s/%d.dump.gz", name, i)
+			target.files[key] = []byte("x")
+			store.CreateBackup(ctx, &meta.Backup{DatabaseName: name, Env: "prod", Target: "memory", Key: key, CreatedAt: now.AddDate(0, 0, -i)})
+		}
+	}
+	store.CreateBackup(ctx, &meta.Backup{DatabaseName: "myapp_dev", Env: "dev", Target: "memory", Key: "dev", CreatedAt: now.AddDate(0, 0, -30)})
+
+	pruned, err := mgr.pruneBackups(ctx, "prod", 2, 0)
+	if err != nil {
+		t.Fatalf("pruneBackups() error = %v", err)
+	}
+	if len(pruned) != 6 {
+		t.Errorf("pruned %d backups, want 6", len(pruned))
+	}
+	if len(target.files) != 4 {
+		t.Errorf("%d archives left on target, want 4", len(target.files))
+	}
+
+	remaining, _ := store.ListBackups(ctx, "")
+	if len(remaining) != 5 {
+		t.Errorf("%d backup records left, want 5 (dev backups are not pruned)", len(remaining))
+	}
+}
+
+func TestRunBackupsRequiresConfiguration(t *testing.T) {
+	mgr := NewManager(config.Default(), meta.NewMockStore())
+	if _, err := mgr.RunBackups(context.Background(), false); err == nil {
+		t.Error("RunBackups() without schedules should fail")
+	}
+	if _, err := mgr.BackupDatabase(context.Background(), "nope", "prod", nil); err == nil {
+		t.Error("BackupDatabase() of an unknown project should fail")
+	}
+}
+
+func TestMigrateRequiresDirectory(t *testing.T) {
+	ctx := context.Background()
+	cfg := config.Default()
+	cfg.Projects = map[string]config.ProjectConfig{"billing": {Migrations: t.TempDir() + "/missing"}}
+	mgr := NewManager(cfg, meta.NewMockStore())
+
+	if _, err := mgr.Migrate(ctx, "myapp", "dev", nil, ""); err == nil || !strings.Contains(err.Error(), "no migrations directory") {
+		t.Errorf("Migrate() without a directory error = %v", err)
+	}
+	if _, err := mgr.Migrate(ctx, "billing", "dev", nil, ""); err == nil || !strings.Contains(err.Error(), "failed to read migrations") {
+		t.Errorf("Migrate() with the configured directory error = %v, want it to be read", err)
+	}
+	if _, err := mgr.MigrateDown(ctx, "myapp", "dev", nil, t.TempDir(), 0); err == nil {
+		t.Error("MigrateDown() with zero steps should fail")
+	}
+}
+
+func TestPlanManifest(t *testing.T) {
+	ctx := context.Background()
+	store := meta.NewMockStore()
+	mgr := NewManager(config.Default(), store)
+
+	legacy, _ := store.CreateProject(ctx, "legacy")
+	store.CreateDatabase(ctx, legacy.ID, "legacy_dev", "legacy_dev_user", "pw", "dev", "default", nil, nil)
+	keep, _ := store.CreateProject(ctx, "keep")
+	store.CreateDatabase(ctx, keep.ID, "keep_prod", "keep_prod_user", "pw", "prod", "default", nil, nil)
+	store.UpdateDatabasePolicy(ctx, "keep_prod", true, nil)
+
+	mf, err := manifest.Parse([]byte(`
+projects:
+  myapp:
+    environments:
+      prod:
+        protected: true
+        connection_limit: 20
+        extensions: [pgcrypto]
+        roles:
+          analytics: read
+      dev:
+        ttl: 720h
+`))
+	if err != nil {
+		t.Fatalf("Parse() error = %v", err)
+	}
+
+	plan, err := mgr.Plan(ctx, mf, false)
+	if err != nil {
+		t.Fatalf("Plan() error = %v", err)
+	}
+	var lines []string
+	for _, c := range plan.Changes {
+		lines = append(lines, c.String())
+	}
+	want := []string{
+		"+ project myapp",
+		"+ database myapp_dev (server default)",
+		"+ setting myapp_dev (unprotected, ttl 720h0m0s)",
+		"+ database myapp_prod (server default)",
+		"+ setting myapp_prod (protected, no ttl)",
+		"+ setting myapp_prod (connection_limit 20)",
+		"+ extension myapp_prod.pgcrypto",
+		"+ role myapp_prod_analytics (read)",
+	}
+	if strings.Join(lines, "\n") != strings.Join(want, "\n") {
+		t.Errorf("Plan() changes =\n%s\nwant\n%s", strings.Join(lines, "\n"), strings.Join(want, "\n"))
+	}
+	if len(plan.Warnings) != 2 {
+		t.Errorf("Plan() warnings = %v, want the unmanaged and the protected project", plan.Warnings)
+	}
+
+	plan, err = mgr.Plan(ctx, mf, true)
+	if err != nil {
+		t.Fatalf("Plan() with prune error = %v", err)
+	}
+	last := plan.Changes[len(plan.Changes)-1]
+	if last.Action != ActionDelete || last.Name != "legacy" {
+		t.Errorf("Plan() with prune ends with %s, want the deletion of legacy", last)
+	}
+	if len(plan.Warnings) != 1 || !strings.Contains(plan.Warnings[0], "protected") {
+		t.Errorf("Plan() with prune warnings = %v, want only the protected project", plan.Warnings)
+	}
+
+	if _, err := mgr.Plan(ctx, &manifest.Manifest{Projects: map[string]manifest.Project{"x": {}}}, false); err == nil || !strings.HasPrefix(err.Error(), "invalid manifest") {
+		t.Errorf("Plan() with an invalid project name error = %v", err)
+	}
+}
+
+func TestProtectedDatabases(t *testing.T) {
+	ctx := context.Background()
+	store := meta.NewMockStore()
+	mgr := NewManager(config.Default(), store)
+
+	p, _ := store.CreateProject(ctx, "myapp")
+	store.CreateDatabase(ctx, p.ID, "myapp_prod", "myapp_prod_user", "pw", "prod", "default", nil, nil)
+	store.UpdateDatabasePolicy(ctx, "myapp_prod", true, nil)
+
+	if err := mgr.DeleteDatabase(ctx, "myapp", "prod", nil); err == nil || !strings.Contains(err.Error(), "is protected") {
+		t.Errorf("DeleteDatabase() of a protected database error = %v", err)
+	}
+	if err := mgr.ResetDatabase(ctx, "myapp", "prod", nil, ResetOptions{}); err == nil || !strings.Contains(err.Error(), "is protected") {
+		t.Errorf("ResetDatabase() of a protected database error = %v", err)
+	}
+	if err := mgr.DeleteProject(ctx, "myapp"); err == nil || !strings.Contains(err.Error(), "is protected") {
+		t.Errorf("DeleteProject() with a protected database error = %v", err)
+	}
+	if d, _ := store.GetDatabaseByName(ctx, "myapp_prod"); d == nil {
+		t.Error("protected database was removed")
+	}
+}
+
+func TestTokens(t *testing.T) {
+	ctx := context.Background()
+	store := meta.NewMockStore()
+	mgr := NewManager(config.Default(), store)
+
+	if _, _, err := mgr.CreateToken(ctx, TokenOptions{Name: "-bad", Scopes: []string{"read"}}); err == nil {
+		t.Error("CreateToken() with an invalid name succeeded")
+	}
+	if _, _, err := mgr.CreateToken(ctx, TokenOptions{Name: "ci", Scopes: []string{"write"}}); err == nil {
+		t.Error("CreateToken() with an invalid scope succeeded")
+	}
+
+	token, secret, err := mgr.CreateToken(ctx, TokenOptions{Name: "ci", Scopes: []string{"read,create"}, Projects: []string{"myapp"}})
+	if err != nil {
+		t.Fatalf("CreateToken() error = %v", err)
+	}
+	if token.Hash == secret || !strings.HasPrefix(secret, "pgm_") {
+		t.Errorf("CreateToken() secret = %q, hash = %q", secret, token.Hash)
+	}
+	if _, _, err := mgr.CreateToken(ctx, TokenOptions{Name: "ci", Scopes: []string{"read"}}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("CreateToken() of a duplicate error = %v", err)
+	}
+
+	p, err := mgr.Authenticate(ctx, secret)
+	if err != nil || p == nil {
+		t.Fatalf("Authenticate() = %v, %v", p, err)
+	}
+	if p.Name != "ci" || !p.Can("create") || p.Can("delete") || !p.CanAccessProject("myapp") || p.CanAccessProject("other") {
+		t.Errorf("Authenticate() principal = %+v", p)
+	}
+	if tokens, _ := mgr.ListTokens(ctx); len(tokens) != 1 || tokens[0].LastUsedAt == nil {
+		t.Errorf("ListTokens() = %+v, want one used token", tokens)
+	}
+	if p, _ := mgr.Authenticate(ctx, "pgm_unknown"); p != nil {
+		t.Errorf("Authenticate() of an unknown token = %+v", p)
+	}
+
+	expired := time.Now().Add(-time.Hour)
+	store.CreateToken(ctx, &meta.Token{Name: "old", Hash: auth.HashToken("pgm_old"), Scopes: []string{"read"}, ExpiresAt: &expired})
+	if p, _ := mgr.Authenticate(ctx, "pgm_old"); p != nil {
+		t.Errorf("Authenticate() of an expired token = %+v", p)
+	}
+	if err := mgr.RevokeToken(ctx, "ci"); err != nil {
+		t.Fatalf("RevokeToken() error = %v", err)
+	}
+	if p, _ := mgr.Authenticate(ctx, secret); p != nil {
+		t.Errorf("Authenticate() of a revoked token = %+v", p)
+	}
+	if err := mgr.RevokeToken(ctx, "ci"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("RevokeToken() of a missing token error = %v", err)
+	}
+}
+
+func TestBelongsToProject(t *testing.T) {
+	tests := []struct {
+		dbName  string
+		project string
+		want    bool
+	}{
+		{"myapp_prod", "myapp", true},
+		{"myapp_pr_42", "myapp", true},
+		{"myapp_v2_prod", "myapp", false},
+		{"myapp_v2_prod", "myapp_v2", true},
+		{"other_dev", "myapp", false},
+	}
+
+	for _, tt := range tests {
+		if got := BelongsToProject(tt.dbName, tt.project); got != tt.want {
+			t.Errorf("BelongsToProject(%q, %q) = %v, want %v", tt.dbName, tt.project, got, tt.want)
+		}
+	}
+}
+
+func TestAccessControl(t *testing.T) {
+	ctx := context.Background()
+	store := meta.NewMockStore()
+	mgr := NewManager(config.Default(), store)
+
+	a, _ := store.CreateProject(ctx, "app_a")
+	b, _ := store.CreateProject(ctx, "app_b")
+	store.CreateDatabase(ctx, a.ID, "app_a_dev", "app_a_dev_user", "pw", "dev", "default", nil, nil)
+	store.CreateDatabase(ctx, b.ID, "app_b_dev", "app_b_dev_user", "pw", "dev", "default", nil, nil)
+
+	if _, err := mgr.GrantAccess(ctx, "app_a", "team-a", "owner"); err == nil {
+		t.Error("GrantAccess() with an invalid role succeeded")
+	}
+	if _, err := mgr.GrantAccess(ctx, "nope", "team-a", "viewer"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("GrantAccess() on a missing project error = %v", err)
+	}
+	if _, err := mgr.GrantAccess(ctx, "app_a", "team-a", "viewer"); err != nil {
+		t.Fatalf("GrantAccess() error = %v", err)
+	}
+	binding, err := mgr.GrantAccess(ctx, "app_a", "team-a", "maintainer")
+	if err != nil || binding.Role != "maintainer" || binding.ProjectName != "app_a" {
+		t.Fatalf("GrantAccess() = %+v, %v", binding, err)
+	}
+
+	_, secret, err := mgr.CreateToken(ctx, TokenOptions{Name: "team-a", Scopes: []string{"admin"}})
+	if err != nil {
+		t.Fatal(err)
+	}
+	p, err := mgr.Authenticate(ctx, secret)
+	if err != nil || p.Roles["app_a"] != "maintainer" {
+		t.Fatalf("Authenticate() = %+v, %v", p, err)
+	}
+	teamCtx := auth.WithPrincipal(ctx, p)
+
+	if projects, _ := mgr.ListProjects(teamCtx); len(projects) != 1 || projects[0].Name != "app_a" {
+		t.Errorf("ListProjects() = %+v, want only app_a", projects)
+	}
+	if databases, _ := mgr.ListDatabases(teamCtx, ""); len(databases) != 1 || databases[0].DatabaseName != "app_a_dev" {
+		t.Errorf("ListDatabases() = %+v, want only app_a_dev", databases)
+	}
+	if _, err := mgr.ListDatabases(teamCtx, "app_b"); !errors.Is(err, auth.ErrPermissionDenied) {
+		t.Errorf("ListDatabases(app_b) error = %v", err)
+	}
+	if err := mgr.DeleteDatabase(teamCtx, "app_b", "dev", nil); !errors.Is(err, auth.ErrPermissionDenied) {
+		t.Errorf("DeleteDatabase() of another team's database error = %v", err)
+	}
+	if _, err := mgr.QueryDatabase(teamCtx, "app_a", "dev", nil, "SELECT 1", db.QueryOptions{}); !errors.Is(err, auth.ErrPermissionDenied) {
+		t.Errorf("QueryDatabase() as maintainer error = %v", err)
+	}
+	if events, _ := mgr.ListAudit(ctx, meta.AuditFilter{Action: "database.query"}); len(events) != 1 || events[0].Outcome != OutcomeDenied || events[0].Detail != "SELECT 1" {
+		t.Errorf("ListAudit(database.query) = %+v, want the denied query with its SQL", events)
+	}
+	if _, err := mgr.GrantAccess(teamCtx, "app_a", "team-b", "admin"); !errors.Is(err, auth.ErrPermissionDenied) {
+		t.Errorf("GrantAccess() as maintainer error = %v", err)
+	}
+	if _, err := mgr.CreateProject(teamCtx, "app_c"); !errors.Is(err, auth.ErrPermissionDenied) {
+		t.Errorf("CreateProject() by a bound principal error = %v", err)
+	}
+	if _, err := mgr.Cleanup(teamCtx, time.Hour); !errors.Is(err, auth.ErrPermissionDenied) {
+		t.Errorf("Cleanup() by a bound principal error = %v", err)
+	}
+
+	if bindings, _ := mgr.ListAccess(ctx, ""); len(bindings) != 1 {
+		t.Errorf("ListAccess() = %+v, want one binding", bindings)
+	}
+	if err := mgr.RevokeAccess(ctx, "app_a", "team-a"); err != nil {
+		t.Fatalf("RevokeAccess() error = %v", err)
+	}
+	if err := mgr.RevokeAccess(ctx, "app_a", "team-a"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("RevokeAccess() of a missing binding error = %v", err)
+	}
+	if p, _ := mgr.Authenticate(ctx, secret); p == nil || p.Roles != nil {
+		t.Errorf("Authenticate() after revoke = %+v, want no roles", p)
+	}
+
+	mgr.GrantAccess(ctx, "app_b", "team-a", "viewer")
+	if err := mgr.DeleteProject(ctx, "app_b"); err != nil {
+		t.Fatal(err)
+	}
+	if bindings, _ := mgr.ListAccess(ctx, ""); len(bindings) != 0 {
+		t.Errorf("ListAccess() after deleting the project = %+v", bindings)
+	}
+}
+
+func TestUserPrincipal(t *testing.T) {
+	ctx := context.Background()
+	store := meta.NewMockStore()
+	cfg := config.Default()
+	cfg.API.OIDC = config.OIDCConfig{
+		DefaultRole: "viewer",
+		GroupRoles: []config.GroupRole{
+			{Group: "team-a", Project: "app_a", Role: "developer"},
+			{Group: "leads", Role: "maintainer"},
+		},
+	}
+	mgr := NewManager(cfg, store)
+	store.CreateProject(ctx, "app_a")
+	store.CreateProject(ctx, "app_b")
+
+	p, err := mgr.UserPrincipal(ctx, "user:alice@example.com", []string{"team-a"})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if p.Role("app_a") != "developer" || p.Role("app_b") != "viewer" {
+		t.Errorf("roles = %v, default %q", p.Roles, p.DefaultRole)
+	}
+
+	p, _ = mgr.UserPrincipal(ctx, "user:bob@example.com", []string{"team-a", "leads"})
+	if p.Role("app_a") != "maintainer" || p.DefaultRole != "maintainer" {
+		t.Errorf("a group role on every project should raise project roles: %v, default %q", p.Roles, p.DefaultRole)
+	}
+
+	// Access bindings raise the role further
+	if _, err := mgr.GrantAccess(ctx, "app_b", "user:alice@example.com", "admin"); err != nil {
+		t.Fatal(err)
+	}
+	p, _ = mgr.UserPrincipal(ctx, "user:alice@example.com", nil)
+	if p.Role("app_b") != "admin" || p.Role("app_a") != "viewer" {
+		t.Errorf("roles = %v, default %q", p.Roles, p.DefaultRole)
+	}
+	if ctx := auth.WithPrincipal(ctx, p); mgr.DeleteProject(ctx, "app_a") == nil {
+		t.Error("DeleteProject() with the viewer role succeeded")
+	}
+}
+
+func TestAudit(t *testing.T) {
+	ctx := context.Background()
+	store := meta.NewMockStore()
+	mgr := NewManager(config.Default(), store)
+
+	// The local CLI acts as the current user
+	if _, err := mgr.CreateProject(ctx, "myapp"); err != nil {
+		t.Fatal(err)
+	}
+	mgr.CreateProject(ctx, "Bad-Name")
+
+	// API calls carry their principal and request ID
+	_, secret, _ := mgr.CreateToken(ctx, TokenOptions{Name: "ci", Scopes: []string{"read", "create"}})
+	p, _ := mgr.Authenticate(ctx, secret)
+	apiCtx := auth.WithOrigin(auth.WithPrincipal(ctx, p), auth.Origin{Source: auth.SourceAPI, RequestID: "req-1"})
+	if err := mgr.DeleteProject(apiCtx, "myapp"); err == nil {
+		t.Fatal("DeleteProject() without the delete scope succeeded")
+	}
+	if err := mgr.DeleteProject(ctx, "myapp"); err != nil {
+		t.Fatal(err)
+	}
+
+	events, err := mgr.ListAudit(ctx, meta.AuditFilter{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	want := []struct{ action, target, outcome, source string }{
+		{"project.delete", "myapp", OutcomeSucceeded, auth.SourceCLI},
+		{"project.delete", "myapp", OutcomeDenied, auth.SourceAPI},
+		{"token.create", "ci", OutcomeSucceeded, auth.SourceCLI},
+		{"project.create", "Bad-Name", OutcomeFailed, auth.SourceCLI},
+		{"project.create", "myapp", OutcomeSucceeded, auth.SourceCLI},
+	}
+	if len(events) != len(want) {
+		t.Fatalf("got %d events, want %d: %+v", len(events), len(want), events)
+	}
+	for i, w := range want {
+		e := events[i]
+		if e.Action != w.action || e.Target != w.target || e.Outcome != w.outcome || e.Source != w.source {
+			t.Errorf("event %d = %+v, want %+v", i, e, w)
+		}
+	}
+	if denied := events[1]; denied.Actor != "ci" || denied.RequestID != "req-1" || !strings.Contains(denied.Error, "permission denied") {
+		t.Errorf("denied event = %+v", denied)
+	}
+	if events[0].Actor == "" || events[0].Actor == "ci" {
+		t.Errorf("CLI actor = %q, want the local user", events[0].Actor)
+	}
+
+	t.Run("filters", func(t *testing.T) {
+		created, _ := mgr.ListAudit(ctx, meta.AuditFilter{Action: "project.create"})
+		if len(created) != 2 {
+			t.Errorf("project.create events = %d, want 2", len(created))
+		}
+		projectEvents, _ := mgr.ListAudit(ctx, meta.AuditFilter{Action: "project", Project: "myapp"})
+		if len(projectEvents) != 3 {
+			t.Errorf("project events of myapp = %d, want 3", len(projectEvents))
+		}
+		page, _ := mgr.ListAudit(ctx, meta.AuditFilter{Limit: 2, BeforeID: events[1].ID})
+		if len(page) != 2 || page[0].ID != events[2].ID {
+			t.Errorf("page = %+v", page)
+		}
+		future, _ := mgr.ListAudit(ctx, meta.AuditFilter{Since: time.Now().Add(time.Hour)})
+		if len(future) != 0 {
+			t.Errorf("events since an hour from now = %d", len(future))
+		}
+	})
+
+	t.Run("authorization", func(t *testing.T) {
+		store.CreateProject(ctx, "other")
+		mgr.GrantAccess(ctx, "other", "ci", "viewer")
+		p, _ := mgr.Authenticate(ctx, secret)
+		ciCtx := auth.WithPrincipal(ctx, p)
+		if _, err := mgr.ListAudit(ciCtx, meta.AuditFilter{}); err == nil {
+			t.Error("ListAudit() of every project by a bound token succeeded")
+		}
+		if _, err := mgr.ListAudit(ciCtx, meta.AuditFilter{Project: "other"}); err != nil {
+			t.Errorf("ListAudit() of a project with a role error = %v", err)
+		}
+	})
+}
+
+func TestWebhooks(t *testing.T) {
+	ctx := context.Background()
+	store := meta.NewMockStore()
+	cfg := config.Default()
+	cfg.Webhooks.MaxAttempts = 2
+	mgr := NewManager(cfg, store)
+
+	var mu sync.Mutex
+	status := http.StatusOK
+	var received []Event
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		if !webhook.Verify("s3cret", body, r.Header.Get(webhook.SignatureHeader)) {
+			t.Errorf("delivery %s is not signed", r.Header.Get(webhook.DeliveryHeader))
+		}
+		var e Event
+		json.Unmarshal(body, &e)
+		mu.Lock()
+		defer mu.Unlock()
+		received = append(received, e)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	if _, err := mgr.CreateWebhook(ctx, WebhookOptions{Name: "bot", URL: "ftp://example.com"}); err == nil {
+		t.Error("CreateWebhook() with an ftp URL succeeded")
+	}
+	if _, err := mgr.CreateWebhook(ctx, WebhookOptions{Name: "bot", URL: srv.URL, Events: []string{"database.renamed"}}); err == nil {
+		t.Error("CreateWebhook() with an unknown event succeeded")
+	}
+	if _, err := mgr.CreateWebhook(ctx, WebhookOptions{Name: "bot", URL: srv.URL, Secret: "s3cret", Projects: []string{"myapp"}}); err != nil {
+		t.Fatalf("CreateWebhook() error = %v", err)
+	}
+	if _, err := mgr.CreateWebhook(ctx, WebhookOptions{Name: "bot", URL: srv.URL}); err == nil || !strings.Contains(err.Error(), "already exists") {
+		t.Errorf("CreateWebhook() of a duplicate error = %v", err)
+	}
+	generated, _ := mgr.CreateWebhook(ctx, WebhookOptions{Name: "deploys", URL: srv.URL, Events: []string{EventProjectDeleted}})
+	if !strings.HasPrefix(generated.Secret, webhook.SecretPrefix) {
+		t.Errorf("generated secret = %q", generated.Secret)
+	}
+
+	// Events are queued for the webhooks subscribed to them and delivered by DeliverWebhooks
+	mgr.CreateProject(ctx, "myapp")
+	mgr.CreateProject(ctx, "other")
+	if n, err := mgr.DeliverWebhooks(ctx); err != nil || n != 1 {
+		t.Fatalf("DeliverWebhooks() = %d, %v, want 1 delivery", n, err)
+	}
+	if len(received) != 1 || received[0].Event != EventProjectCreated || received[0].Project != "myapp" || received[0].Actor == "" {
+		t.Fatalf("received = %+v", received)
+	}
+	if n, _ := mgr.DeliverWebhooks(ctx); n != 0 {
+		t.Errorf("DeliverWebhooks() redelivered %d events", n)
+	}
+
+	t.Run("retries", func(t *testing.T) {
+		status = http.StatusServiceUnavailable
+		expires := time.Now().Add(time.Hour)
+		p, _ := store.GetProject(ctx, "myapp")
+		store.CreateDatabase(ctx, p.ID, "myapp_pr_7", "myapp_pr_7_user", "pw", "pr", "default", intPtr(7), &expires)
+
+		// Expiry notices are queued once per expiry time
+		mgr.queueExpiryNotices(ctx)
+		mgr.queueExpiryNotices(ctx)
+		mgr.DeliverWebhooks(ctx)
+
+		w, _ := store.GetWebhook(ctx, "bot")
+		deliveries, _ := store.ListWebhookDeliveries(ctx, w.ID, 0)
+		if len(deliveries) != 2 {
+			t.Fatalf("deliveries = %+v, want 2", deliveries)
+		}
+		d := deliveries[0]
+		if d.Event != EventDatabaseExpiring || d.Status != DeliveryPending || d.Attempts != 1 || d.ResponseCode != http.StatusServiceUnavailable {
+			t.Fatalf("failed delivery = %+v", d)
+		}
+		if wait := time.Until(d.NextAttemptAt); wait < 25*time.Second || wait > webhook.MinBackoff {
+			t.Errorf("retry in %v, want %v", wait, webhook.MinBackoff)
+		}
+
+		// The last allowed attempt gives up
+		d.NextAttemptAt = time.Now()
+		store.UpdateWebhookDelivery(ctx, &d)
+		mgr.DeliverWebhooks(ctx)
+		deliveries, _ = mgr.ListWebhookDeliveries(ctx, "bot", 1)
+		if deliveries[0].Status != DeliveryFailed || deliveries[0].Attempts != 2 {
+			t.Errorf("delivery after %d attempts = %+v", cfg.Webhooks.MaxAttempts, deliveries[0])
+		}
+
+		// Extending the TTL makes a new expiry worth a notice
+		later := expires.Add(30 * time.Minute)
+		store.UpdateDatabasePolicy(ctx, "myapp_pr_7", false, &later)
+		mgr.queueExpiryNotices(ctx)
+		if deliveries, _ := mgr.ListWebhookDeliveries(ctx, "bot", 0); len(deliveries) != 3 {
+			t.Errorf("deliveries after extending the TTL = %d, want 3", len(deliveries))
+		}
+	})
+
+	t.Run("ping", func(t *testing.T) {
+		status = http.StatusAccepted
+		d, err := mgr.TestWebhook(ctx, "bot")
+		if err != nil || d.Status != DeliverySucceeded || d.ResponseCode != http.StatusAccepted {
+			t.Errorf("TestWebhook() = %+v, %v", d, err)
+		}
+		status = http.StatusNotFound
+		if d, _ := mgr.TestWebhook(ctx, "bot"); d.Status != DeliveryFailed {
+			t.Errorf("TestWebhook() of a failing endpoint = %+v", d)
+		}
+		if _, err := mgr.TestWebhook(ctx, "missing"); err == nil || !strings.Contains(err.Error(), "not found") {
+			t.Errorf("TestWebhook() of a missing webhook error = %v", err)
+		}
+	})
+
+	t.Run("authorization", func(t *testing.T) {
+		_, secret, _ := mgr.CreateToken(ctx, TokenOptions{Name: "ci", Scopes: []string{"read", "create", "delete"}})
+		p, _ := mgr.Authenticate(ctx, secret)
+		ciCtx := auth.WithPrincipal(ctx, p)
+		if _, err := mgr.ListWebhooks(ciCtx); err == nil {
+			t.Error("ListWebhooks() without the admin scope succeeded")
+		}
+		if err := mgr.DeleteWebhook(ciCtx, "bot"); err == nil {
+			t.Error("DeleteWebhook() without the admin scope succeeded")
+		}
+	})
+
+	if err := mgr.DeleteWebhook(ctx, "bot"); err != nil {
+		t.Fatalf("DeleteWebhook() error = %v", err)
+	}
+	if err := mgr.DeleteWebhook(ctx, "bot"); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("DeleteWebhook() of a missing webhook error = %v", err)
+	}
+}
+
+func TestEventBus(t *testing.T) {
+	ctx := context.Background()
+	store := meta.NewMockStore()
+	mgr := NewManager(config.Default(), store)
+	sub := mgr.Events().Subscribe()
+	defer sub.Close()
+
+	p, err := mgr.CreateProject(ctx, "myapp")
+	if err != nil {
+		t.Fatal(err)
+	}
+	msg := <-sub.C()
+	var e Event
+	if err := json.Unmarshal(msg.Data, &e); err != nil || msg.Event != EventProjectCreated || msg.Project != "myapp" || e.Project != "myapp" {
+		t.Errorf("message = %+v, event = %+v, %v", msg, e, err)
+	}
+
+	// Expiry notices are published once per expiry time, without webhooks too
+	expires := time.Now().Add(time.Hour)
+	store.CreateDatabase(ctx, p.ID, "myapp_pr_7", "myapp_pr_7_user", "pw", "pr", "default", intPtr(7), &expires)
+	mgr.queueExpiryNotices(ctx)
+	mgr.queueExpiryNotices(ctx)
+	later := expires.Add(30 * time.Minute)
+	store.UpdateDatabasePolicy(ctx, "myapp_pr_7", false, &later)
+	mgr.queueExpiryNotices(ctx)
+
+	backlog, resumed, _ := mgr.Events().Resume(msg.ID)
+	resumed.Close()
+	if len(backlog) != 2 || backlog[0].Event != EventDatabaseExpiring || backlog[1].Event != EventDatabaseExpiring {
+		t.Errorf("events after the project = %+v, want two expiry notices", backlog)
+	}
+}
+
+func TestJobs(t *testing.T) {
+	ctx := context.Background()
+	store := meta.NewMockStore()
+	mgr := NewManager(config.Default(), store)
+
+	if _, err := mgr.StartJob(ctx, JobRequest{Kind: JobCleanup}); err == nil || !strings.Contains(err.Error(), "no job workers") {
+		t.Errorf("StartJob() without workers error = %v", err)
+	}
+
+	// Jobs left running by a previous server are failed on start
+	stale := &meta.Job{Kind: JobBackupRun, Status: JobRunning}
+	store.CreateJob(ctx, stale)
+	jobsCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	if err := mgr.StartJobs(jobsCtx, 1); err != nil {
+		t.Fatal(err)
+	}
+	if info, err := mgr.GetJob(ctx, stale.ID); err != nil || info.Status != JobFailed || !strings.Contains(info.Error, "interrupted") {
+		t.Errorf("stale job = %+v, %v", info, err)
+	}
+
+	if _, err := mgr.StartJob(ctx, JobRequest{Kind: JobBackupRestore, Project: "myapp", Env: "dev"}); err == nil || !strings.Contains(err.Error(), "invalid") {
+		t.Errorf("StartJob() without a backup ID error = %v", err)
+	}
+	reader := auth.WithPrincipal(ctx, &auth.Principal{Name: "reader", Scopes: []string{auth.ScopeRead}})
+	if _, err := mgr.StartJob(reader, JobRequest{Kind: JobCleanup}); !errors.Is(err, auth.ErrPermissionDenied) {
+		t.Errorf("StartJob() with the read scope error = %v", err)
+	}
+
+	job, err := mgr.StartJob(ctx, JobRequest{Kind: JobCleanup, OlderThan: time.Hour})
+	if err != nil || job.Status != JobQueued {
+		t.Fatalf("StartJob() = %+v, %v", job, err)
+	}
+	info, err := WaitJob(ctx, mgr, job.ID, 10*time.Millisecond, nil)
+	if err != nil || info.Status != JobSucceeded || info.StartedAt == nil || info.FinishedAt == nil {
+		t.Fatalf("WaitJob() = %+v, %v", info, err)
+	}
+	var result CleanupResult
+	if err := json.Unmarshal(info.Result, &result); err != nil || len(result.Deleted) != 0 {
+		t.Errorf("result = %s, %v", info.Result, err)
+	}
+	if err := mgr.CancelJob(ctx, job.ID); err == nil || !strings.Contains(err.Error(), "already succeeded") {
+		t.Errorf("CancelJob() of a finished job error = %v", err)
+	}
+
+	if jobs, err := mgr.ListJobs(ctx, meta.JobFilter{Status: JobSucceeded}); err != nil || len(jobs) != 1 || jobs[0].ID != job.ID {
+		t.Errorf("ListJobs() = %+v, %v", jobs, err)
+	}
+	if _, err := mgr.ListJobs(auth.WithPrincipal(ctx, &auth.Principal{Name: "a", Scopes: []string{auth.ScopeRead}, Projects: []string{"a"}}), meta.JobFilter{}); err == nil {
+		t.Error("ListJobs() of every project by a restricted principal succeeded")
+	}
+
+	// Uploads that are not dumps are rejected before a job is queued
+	if _, err := mgr.CreateProject(ctx, "myapp"); err != nil {
+		t.Fatal(err)
+	}
+	_, err = mgr.StartJob(ctx, JobRequest{Kind: JobRestore, Project: "myapp", Env: "dev", Dump: strings.NewReader("not a dump")})
+	if !errors.Is(err, db.ErrInvalidDump) {
+		t.Errorf("StartJob() of a restore of a non-dump error = %v", err)
+	}
+	if staged, err := os.ReadDir(mgr.pool().dir); err != nil || len(staged) != 0 {
+		t.Errorf("staged dumps = %v, %v, want none", staged, err)
+	}
+	if _, err := mgr.StartJob(ctx, JobRequest{Kind: JobMove, Project: "myapp", Env: "dev", Server: "replica"}); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("StartJob() of a move of a missing database error = %v", err)
+	}
+}
+
+func TestJobSecrets(t *testing.T) {
+	ctx := context.Background()
+	store := meta.NewMockStore()
+	mgr := NewManager(config.Default(), store)
+	jobsCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	if err := mgr.StartJobs(jobsCtx, 0); err != nil {
+		t.Fatal(err)
+	}
+
+	job := &meta.Job{Kind: JobApply, Status: JobRunning, Actor: actor(ctx, auth.OriginFromContext(ctx))}
+	store.CreateJob(ctx, job)
+	mgr.finishJob(job, JobSucceeded, &ApplyResult{Credentials: []Credential{{User: "myapp_prod_app", Password: "s3cret"}}}, nil)
+
+	stored, _ := store.GetJob(ctx, job.ID)
+	if strings.Contains(string(stored.Result), "s3cret") || !strings.Contains(string(stored.Result), "myapp_prod_app") {
+		t.Errorf("stored result = %s, want the credentials without the password", stored.Result)
+	}
+
+	// Another caller gets the stored result, and the one who started the job the passwords, once
+	other := auth.WithPrincipal(ctx, &auth.Principal{Name: "other", Scopes: []string{auth.ScopeAdmin}})
+	if info, err := mgr.GetJob(other, job.ID); err != nil || strings.Contains(string(info.Result), "s3cret") {
+		t.Errorf("GetJob() by another admin = %s, %v", info.Result, err)
+	}
+	if info, err := mgr.GetJob(ctx, job.ID); err != nil || !strings.Contains(string(info.Result), "s3cret") {
+		t.Errorf("first GetJob() by the actor = %s, %v, want the password", info.Result, err)
+	}
+	if info, err := mgr.GetJob(ctx, job.ID); err != nil || strings.Contains(string(info.Result), "s3cret") {
+		t.Errorf("second GetJob() by the actor = %s, %v, want no password", info.Result, err)
+	}
+}
+
+func TestCancelQueuedJob(t *testing.T) {
+	ctx := context.Background()
+	store := meta.NewMockStore()
+	mgr := NewManager(config.Default(), store)
+
+	// Without workers, jobs stay queued
+	jobsCtx, stop := context.WithCancel(ctx)
+	defer stop()
+	if err := mgr.StartJobs(jobsCtx, 0); err != nil {
+		t.Fatal(err)
+	}
+	job, err := mgr.StartJob(ctx, JobRequest{Kind: JobCleanup})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	reader := auth.WithPrincipal(ctx, &auth.Principal{Name: "reader", Scopes: []string{auth.ScopeRead}})
+	if err := mgr.CancelJob(reader, job.ID); err == nil || !strings.HasPrefix(err.Error(), "permission denied") {
+		t.Errorf("CancelJob() with the read scope error = %v", err)
+	}
+	if err := mgr.CancelJob(ctx, job.ID); err != nil {
+		t.Fatalf("CancelJob() error = %v", err)
+	}
+	if info, err := mgr.GetJob(ctx, job.ID); err != nil || info.Status != JobCanceled || info.FinishedAt == nil {
+		t.Errorf("canceled job = %+v, %v", info, err)
+	}
+	if err := mgr.CancelJob(ctx, 999); err == nil || !strings.Contains(err.Error(), "not found") {
+		t.Errorf("CancelJob() of a missing job error = %v", err)
+	}
+
+	events, _ := mgr.ListAudit(ctx, meta.AuditFilter{Action: "job.cancel"})
+	if len(events) != 3 || events[1].Outcome != OutcomeSucceeded || events[2].Outcome != OutcomeDenied {
+		t.Errorf("job.cancel events = %+v", events)
+	}
+}
@@ -0,0 +1,138 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"strings"
+	"time"
+
+	"pgmanager/internal/auth"
+)
+
+// What a pull or merge request event does to its PR database
+const (
+	PRActionCreate = "create" // The request was opened or reopened
+	PRActionDelete = "delete" // The request was closed or merged
+	PRActionExtend = "extend" // The request was updated, so its database is still in use
+)
+
+// Outcomes of SyncPullRequest
+const (
+	PROutcomeCreated   = "created"
+	PROutcomeDeleted   = "deleted"
+	PROutcomeExtended  = "extended"
+	PROutcomeExists    = "exists"    // Nothing to create
+	PROutcomeAbsent    = "absent"    // Nothing to delete or extend
+	PROutcomeUnchanged = "unchanged" // The database already expires later, or never
+)
+
+// PRResult describes what SyncPullRequest did
+type PRResult struct {
+	DatabaseName string
+	Outcome      string
+	ExpiresAt    *time.Time
+}
+
+// ExtendDatabase moves the expiry of a database to ttl from now, unless it
+// already expires later. Databases without an expiry are left alone.
+func (m *Manager) ExtendDatabase(ctx context.Context, projectName, env string, prNumber *int, ttl time.Duration) (_ *DatabaseInfo, err error) {
+	defer func() { m.record(ctx, "database.extend", projectName, DatabaseName(projectName, env, prNumber), err) }()
+
+	if err := authorize(ctx, auth.ScopeCreate, projectName); err != nil {
+		return nil, err
+	}
+	if ttl <= 0 {
+		return nil, fmt.Errorf("invalid ttl: must be positive")
+	}
+
+	dbRecord, err := m.findDatabase(ctx, projectName, env, prNumber)
+	if err != nil {
+		return nil, err
+	}
+
+	expiresAt := time.Now().Add(ttl)
+	if dbRecord.ExpiresAt != nil && dbRecord.ExpiresAt.Before(expiresAt) {
+		if err := m.store.UpdateDatabasePolicy(ctx, dbRecord.Name, dbRecord.Protected, &expiresAt); err != nil {
+			return nil, fmt.Errorf("failed to update database: %w", err)
+		}
+		dbRecord.ExpiresAt = &expiresAt
+	}
+
+	return m.databaseInfo(projectName, dbRecord), nil
+}
+
+// SyncPullRequest brings the PR database of a pull or merge request in line
+// with an event about it. Events are idempotent: opening a request whose
+// database exists, or closing one without a database, changes nothing.
+func (m *Manager) SyncPullRequest(ctx context.Context, projectName string, number int, action string) (*PRResult, error) {
+	scope := auth.ScopeCreate
+	if action == PRActionDelete {
+		scope = auth.ScopeDelete
+	}
+	if err := authorize(ctx, scope, projectName); err != nil {
+		return nil, err
+	}
+
+	result := &PRResult{DatabaseName: DatabaseName(projectName, "pr", &number)}
+	existing, err := m.findDatabase(ctx, projectName, "pr", &number)
+	if err != nil && !strings.Contains(err.Error(), "database not found") {
+		return nil, err
+	}
+
+	switch action {
+	case PRActionCreate:
+		if existing != nil {
+			result.Outcome, result.ExpiresAt = PROutcomeExists, existing.ExpiresAt
+			return result, nil
+		}
+		info, err := m.CreateDatabase(ctx, projectName, "pr", &number, "")
+		if err != nil {
+			return nil, err
+		}
+		result.Outcome, result.ExpiresAt = PROutcomeCreated, info.ExpiresAt
+
+	case PRActionDelete:
+		if existing == nil {
+			result.Outcome = PROutcomeAbsent
+			return result, nil
+		}
+		if err := m.DeleteDatabase(ctx, projectName, "pr", &number); err != nil {
+			return nil, err
+		}
+		result.Outcome = PROutcomeDeleted
+
+	case PRActionExtend:
+		if existing == nil {
+			result.Outcome = PROutcomeAbsent
+			return result, nil
+		}
+		previous := existing.ExpiresAt
+		info, err := m.ExtendDatabase(ctx, projectName, "pr", &number, m.cfg.Cleanup.DefaultTTL)
+		if err != nil {
+			return nil, err
+		}
+		result.Outcome, result.ExpiresAt = PROutcomeExtended, info.ExpiresAt
+		if previous == nil || !info.ExpiresAt.After(*previous) {
+			result.Outcome = PROutcomeUnchanged
+		}
+
+	default:
+		return nil, fmt.Errorf("invalid pull request action '%s'", action)
+	}
+
+	return result, nil
+}
+
+// ClaimDelivery records a webhook delivery received from a source code host
+// and reports whether it is new, so that redelivered events are skipped
+func (m *Manager) ClaimDelivery(ctx context.Context, source, id string) (bool, error) {
+	return m.store.ClaimInboundDelivery(ctx, source, id)
+}
+
+// ReleaseDelivery forgets a claimed delivery whose processing failed, so that
+// a redelivery is processed again
+func (m *Manager) ReleaseDelivery(ctx context.Context, source, id string) {
+	if err := m.store.ReleaseInboundDelivery(context.WithoutCancel(ctx), source, id); err != nil {
+		fmt.Printf("Warning: failed to release %s delivery %s: %v\n", source, id, err)
+	}
+}
@@ -0,0 +1,51 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"strings"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/db"
+)
+
+// QueryDatabase runs an ad-hoc SQL script against a managed database, connecting
+// with the database's own credentials so the script has exactly the owner's privileges
+func (m *Manager) QueryDatabase(ctx context.Context, projectName, env string, prNumber *int, script string, opts db.QueryOptions) (_ []db.QueryResult, err error) {
+	defer func() {
+		m.recordDetail(ctx, "database.query", projectName, DatabaseName(projectName, env, prNumber), queryDetail(script, opts), err)
+	}()
+
+	if err := authorize(ctx, auth.ScopeAdmin, projectName); err != nil {
+		return nil, err
+	}
+
+	if strings.TrimSpace(script) == "" {
+		return nil, fmt.Errorf("no SQL to run")
+	}
+
+	dbRecord, err := m.findDatabase(ctx, projectName, env, prNumber)
+	if err != nil {
+		return nil, err
+	}
+	pg, err := m.client(dbRecord.Server)
+	if err != nil {
+		return nil, err
+	}
+
+	conn, err := pg.ConnectAs(ctx, dbRecord.Name, dbRecord.UserName, dbRecord.Password)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect: %w", err)
+	}
+	defer conn.Close(context.Background())
+
+	return db.Query(ctx, conn, script, opts)
+}
+
+// queryDetail describes a query for the audit log
+func queryDetail(script string, opts db.QueryOptions) string {
+	if opts.ReadOnly {
+		return "read-only: " + script
+	}
+	return script
+}
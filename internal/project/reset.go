@@ -0,0 +1,125 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"os"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/meta"
+)
+
+// ResetOptions controls how a database is reset
+type ResetOptions struct {
+	KeepDatabase bool // Drop the schemas inside the database instead of recreating it
+	SkipSeed     bool // Do not run the project's init scripts, migrations and seeds afterwards
+}
+
+// ResetDatabase empties a managed database while keeping its role and password,
+// so existing connection strings keep working. By default the database is dropped
+// and recreated, which terminates open sessions; with KeepDatabase only its
+// schemas are dropped. The project's init scripts, automatic migrations and seed
+// scripts then run again unless SkipSeed is set. Protected databases cannot be reset.
+func (m *Manager) ResetDatabase(ctx context.Context, projectName, env string, prNumber *int, opts ResetOptions) (err error) {
+	defer func() { m.record(ctx, "database.reset", projectName, DatabaseName(projectName, env, prNumber), err) }()
+
+	if err := authorize(ctx, auth.ScopeDelete, projectName); err != nil {
+		return err
+	}
+
+	dbRecord, err := m.findDatabase(ctx, projectName, env, prNumber)
+	if err != nil {
+		return err
+	}
+	if err := checkProtected(dbRecord); err != nil {
+		return err
+	}
+
+	pg, err := m.client(dbRecord.Server)
+	if err != nil {
+		return err
+	}
+
+	if opts.KeepDatabase {
+		err = pg.DropSchemas(ctx, dbRecord.Name, dbRecord.UserName)
+	} else {
+		err = m.recreateDatabase(ctx, pg, dbRecord)
+	}
+	if err != nil {
+		return fmt.Errorf("failed to reset %s: %w", dbRecord.Name, err)
+	}
+
+	if opts.SkipSeed {
+		return nil
+	}
+	return m.runProjectScripts(ctx, projectName, pg, dbRecord)
+}
+
+// recreateDatabase drops and recreates a database, then restores its connection
+// limit, statement timeout, extensions and the access of its managed roles
+func (m *Manager) recreateDatabase(ctx context.Context, pg pgServer, dbRecord *meta.Database) error {
+	settings, err := pg.DatabaseSettings(ctx, dbRecord.Name)
+	if err != nil {
+		return err
+	}
+
+	if err := pg.RecreateDatabase(ctx, dbRecord.Name, dbRecord.UserName); err != nil {
+		return err
+	}
+
+	if settings.ConnectionLimit != -1 {
+		if err := pg.SetConnectionLimit(ctx, dbRecord.Name, settings.ConnectionLimit); err != nil {
+			return err
+		}
+	}
+	if settings.StatementTimeout != "" {
+		if err := pg.SetStatementTimeout(ctx, dbRecord.Name, settings.StatementTimeout); err != nil {
+			return err
+		}
+	}
+	for _, ext := range settings.Extensions {
+		if err := pg.CreateExtension(ctx, dbRecord.Name, ext); err != nil {
+			return err
+		}
+	}
+	for role, access := range settings.Roles {
+		if err := pg.SetRoleAccess(ctx, dbRecord.Name, dbRecord.UserName, role, access); err != nil {
+			return err
+		}
+	}
+	return nil
+}
+
+// runProjectScripts runs the project's init scripts as the admin user, applies its
+// migrations if the environment is migrated automatically, then runs its seed
+// scripts as the database owner
+func (m *Manager) runProjectScripts(ctx context.Context, projectName string, pg pgServer, dbRecord *meta.Database) error {
+	projectCfg := m.cfg.Project(projectName)
+
+	run := func(path, role string) error {
+		script, err := os.ReadFile(path)
+		if err != nil {
+			return fmt.Errorf("failed to read %s: %w", path, err)
+		}
+		if err := pg.RunSQL(ctx, dbRecord.Name, role, string(script)); err != nil {
+			return fmt.Errorf("failed to run %s on %s: %w", path, dbRecord.Name, err)
+		}
+		return nil
+	}
+
+	for _, path := range projectCfg.Init {
+		if err := run(path, ""); err != nil {
+			return err
+		}
+	}
+	if err := m.autoMigrate(ctx, projectName, pg, dbRecord); err != nil {
+		return fmt.Errorf("failed to migrate %s: %w", dbRecord.Name, err)
+	}
+	for _, path := range projectCfg.Seeds {
+		if err := run(path, dbRecord.UserName); err != nil {
+			return err
+		}
+	}
+
+	return nil
+}
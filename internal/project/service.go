@@ -0,0 +1,75 @@
+package project
+
+import (
+	"context"
+	"io"
+	"time"
+
+	"pgmanager/internal/db"
+	"pgmanager/internal/manifest"
+	"pgmanager/internal/meta"
+	"pgmanager/internal/migrate"
+)
+
+// Service is the set of operations offered to the CLI and the TUI. Manager
+// implements it against PostgreSQL directly; client.Client implements it against
+// a pgmanager server, so only the server needs superuser credentials.
+type Service interface {
+	CreateProject(ctx context.Context, name string) (*meta.Project, error)
+	ListProjects(ctx context.Context) ([]meta.Project, error)
+	DeleteProject(ctx context.Context, name string) error
+
+	CreateDatabase(ctx context.Context, projectName, env string, prNumber *int, server string) (*DatabaseInfo, error)
+	GetDatabase(ctx context.Context, projectName, env string, prNumber *int) (*DatabaseInfo, error)
+	ListDatabases(ctx context.Context, projectName string) ([]DatabaseInfo, error)
+	DeleteDatabase(ctx context.Context, projectName, env string, prNumber *int) error
+	ResetDatabase(ctx context.Context, projectName, env string, prNumber *int, opts ResetOptions) error
+
+	ListSessions(ctx context.Context, projectName, env string, prNumber *int) ([]db.Session, error)
+	KillSessions(ctx context.Context, projectName, env string, prNumber *int, pid int) (int, error)
+
+	Migrate(ctx context.Context, projectName, env string, prNumber *int, dir string) ([]migrate.Migration, error)
+	MigrateDown(ctx context.Context, projectName, env string, prNumber *int, dir string, steps int) ([]migrate.Migration, error)
+	MigrationStatus(ctx context.Context, projectName, env string, prNumber *int, dir string) ([]migrate.Status, error)
+
+	DumpDatabase(ctx context.Context, projectName, env string, prNumber *int, w io.Writer) (*db.DumpStats, error)
+	RestoreDatabase(ctx context.Context, projectName, env string, prNumber *int, r io.Reader) (*RestoreResult, error)
+	DiffDatabases(ctx context.Context, projectName, fromEnv string, fromPR *int, toEnv string, toPR *int) (*db.SchemaDiff, error)
+	QueryDatabase(ctx context.Context, projectName, env string, prNumber *int, script string, opts db.QueryOptions) ([]db.QueryResult, error)
+
+	MoveDatabase(ctx context.Context, projectName, env string, prNumber *int, target string, dropSource bool, progress func(MoveProgress)) error
+	AbortMove(ctx context.Context, projectName, env string, prNumber *int) error
+
+	BackupDatabase(ctx context.Context, projectName, env string, prNumber *int) (*meta.Backup, error)
+	ListBackups(ctx context.Context, projectName, env string, prNumber *int) ([]meta.Backup, error)
+	RestoreBackup(ctx context.Context, id int64, projectName, env string, prNumber *int) (*RestoreResult, error)
+	RunBackups(ctx context.Context, force bool) (*BackupRunResult, error)
+
+	Cleanup(ctx context.Context, olderThan time.Duration) (*CleanupResult, error)
+
+	Plan(ctx context.Context, mf *manifest.Manifest, prune bool) (*Plan, error)
+	Apply(ctx context.Context, mf *manifest.Manifest, prune bool) (*ApplyResult, error)
+
+	CreateToken(ctx context.Context, opts TokenOptions) (*meta.Token, string, error)
+	ListTokens(ctx context.Context) ([]meta.Token, error)
+	RevokeToken(ctx context.Context, name string) error
+
+	GrantAccess(ctx context.Context, projectName, subject, role string) (*meta.AccessBinding, error)
+	RevokeAccess(ctx context.Context, projectName, subject string) error
+	ListAccess(ctx context.Context, projectName string) ([]meta.AccessBinding, error)
+
+	ListAudit(ctx context.Context, filter meta.AuditFilter) ([]meta.AuditEvent, error)
+
+	CreateWebhook(ctx context.Context, opts WebhookOptions) (*meta.Webhook, error)
+	ListWebhooks(ctx context.Context) ([]meta.Webhook, error)
+	DeleteWebhook(ctx context.Context, name string) error
+	TestWebhook(ctx context.Context, name string) (*meta.WebhookDelivery, error)
+	ListWebhookDeliveries(ctx context.Context, name string, limit int) ([]meta.WebhookDelivery, error)
+
+	StartJob(ctx context.Context, req JobRequest) (*meta.Job, error)
+	GetJob(ctx context.Context, id int64) (*JobInfo, error)
+	ListJobs(ctx context.Context, filter meta.JobFilter) ([]meta.Job, error)
+	CancelJob(ctx context.Context, id int64) error
+}
+
+var _ Service = (*Manager)(nil)
@@ -0,0 +1,127 @@
+package project
+
+import (
+	"context"
+	"fmt"
+	"regexp"
+	"time"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/meta"
+)
+
+// validTokenNameRegex matches token names such as "ci-github" or "alice.laptop"
+var validTokenNameRegex = regexp.MustCompile(`^[a-zA-Z0-9][a-zA-Z0-9_.-]{0,63}$`)
+
+// tokenUsageInterval limits how often the last-used time of a token is written
+const tokenUsageInterval = time.Minute
+
+// TokenOptions describes a new API token
+type TokenOptions struct {
+	Name     string
+	Scopes   []string
+	Projects []string      // Limit the token to these projects; empty for all
+	TTL      time.Duration // Zero for a token that does not expire
+}
+
+// CreateToken creates an API token and returns it along with its secret. Only
+// a hash of the secret is stored, so it cannot be shown again.
+func (m *Manager) CreateToken(ctx context.Context, opts TokenOptions) (_ *meta.Token, _ string, err error) {
+	defer func() { m.record(ctx, "token.create", "", opts.Name, err) }()
+
+	if err := authorizeAll(ctx, auth.ScopeAdmin); err != nil {
+		return nil, "", err
+	}
+
+	if !validTokenNameRegex.MatchString(opts.Name) {
+		return nil, "", fmt.Errorf("invalid token name '%s'", opts.Name)
+	}
+	scopes, err := auth.ParseScopes(opts.Scopes)
+	if err != nil {
+		return nil, "", err
+	}
+	for _, name := range opts.Projects {
+		if err := ValidateName(name); err != nil {
+			return nil, "", fmt.Errorf("invalid project '%s': %w", name, err)
+		}
+	}
+	if opts.TTL < 0 {
+		return nil, "", fmt.Errorf("invalid token ttl: must not be negative")
+	}
+
+	existing, err := m.store.ListTokens(ctx)
+	if err != nil {
+		return nil, "", fmt.Errorf("failed to list tokens: %w", err)
+	}
+	for _, t := range existing {
+		if t.Name == opts.Name {
+			return nil, "", fmt.Errorf("token '%s' already exists", opts.Name)
+		}
+	}
+
+	secret, err := auth.GenerateToken()
+	if err != nil {
+		return nil, "", err
+	}
+	token := &meta.Token{
+		Name:     opts.Name,
+		Hash:     auth.HashToken(secret),
+		Scopes:   scopes,
+		Projects: opts.Projects,
+	}
+	if opts.TTL > 0 {
+		expiresAt := time.Now().Add(opts.TTL)
+		token.ExpiresAt = &expiresAt
+	}
+	if err := m.store.CreateToken(ctx, token); err != nil {
+		return nil, "", err
+	}
+
+	return token, secret, nil
+}
+
+// ListTokens returns all API tokens
+func (m *Manager) ListTokens(ctx context.Context) ([]meta.Token, error) {
+	if err := authorizeAll(ctx, auth.ScopeAdmin); err != nil {
+		return nil, err
+	}
+
+	return m.store.ListTokens(ctx)
+}
+
+// RevokeToken deletes an API token; requests made with it fail from then on
+func (m *Manager) RevokeToken(ctx context.Context, name string) (err error) {
+	defer func() { m.record(ctx, "token.revoke", "", name, err) }()
+
+	if err := authorizeAll(ctx, auth.ScopeAdmin); err != nil {
+		return err
+	}
+
+	return m.store.DeleteToken(ctx, name)
+}
+
+// Authenticate resolves a token secret to the principal it belongs to. It
+// returns nil for unknown and expired tokens.
+func (m *Manager) Authenticate(ctx context.Context, secret string) (*auth.Principal, error) {
+	token, err := m.store.GetTokenByHash(ctx, auth.HashToken(secret))
+	if err != nil {
+		return nil, err
+	}
+	now := time.Now()
+	if token == nil || (token.ExpiresAt != nil && now.After(*token.ExpiresAt)) {
+		return nil, nil
+	}
+
+	if token.LastUsedAt == nil || now.Sub(*token.LastUsedAt) >= tokenUsageInterval {
+		if err := m.store.UpdateTokenLastUsed(ctx, token.ID, now); err != nil {
+			return nil, err
+		}
+	}
+
+	roles, err := m.principalRoles(ctx, token.Name)
+	if err != nil {
+		return nil, err
+	}
+
+	return &auth.Principal{Name: token.Name, Scopes: token.Scopes, Projects: token.Projects, Roles: roles}, nil
+}
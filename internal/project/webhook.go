@@ -0,0 +1,450 @@
+package project
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/url"
+	"slices"
+	"strings"
+	"sync"
+	"time"
+
+	"pgmanager/internal/auth"
+	"pgmanager/internal/events"
+	"pgmanager/internal/meta"
+	"pgmanager/internal/webhook"
+)
+
+// Lifecycle events delivered to webhooks and published on the event bus. There
+// is no rotated event, as credentials are only set when a database is created.
+const (
+	EventProjectCreated   = "project.created"
+	EventProjectDeleted   = "project.deleted"
+	EventDatabaseCreated  = "database.created"
+	EventDatabaseDeleted  = "database.deleted"
+	EventDatabaseExpiring = "database.expiring"
+	EventPing             = "ping" // Sent by TestWebhook only
+)
+
+// Events are the events webhooks can subscribe to
+var Events = []string{EventProjectCreated, EventProjectDeleted, EventDatabaseCreated, EventDatabaseDeleted, EventDatabaseExpiring}
+
+// Statuses of webhook deliveries
+const (
+	DeliveryPending   = "pending"
+	DeliverySucceeded = "succeeded"
+	DeliveryFailed    = "failed"
+)
+
+const (
+	// webhookBatch limits the deliveries attempted at once
+	webhookBatch = 20
+
+	// webhookLease is how long a claimed delivery is left to its attempt
+	// before it is due again, should the server stop while attempting it
+	webhookLease = 2 * webhook.Timeout
+
+	// webhookHistory is how long finished deliveries are kept
+	webhookHistory = 30 * 24 * time.Hour
+
+	// expiryScanInterval is how often databases are checked for expiry notices
+	expiryScanInterval = time.Minute
+)
+
+// EventLogSize is how many events the bus keeps for subscribers that resume
+const EventLogSize = 1000
+
+// MaxWebhookDeliveries limits the deliveries returned by one ListWebhookDeliveries call
+const MaxWebhookDeliveries = 1000
+
+// WebhookOptions describes a new webhook
+type WebhookOptions struct {
+	Name     string
+	URL      string
+	Secret   string   // Generated when empty
+	Events   []string // Empty for every event
+	Projects []string // Empty for every project
+}
+
+// Event is the JSON payload of a webhook delivery
+type Event struct {
+	Event    string         `json:"event"`
+	Time     time.Time      `json:"time"`
+	Actor    string         `json:"actor,omitempty"`
+	Project  string         `json:"project,omitempty"`
+	Database *EventDatabase `json:"database,omitempty"`
+}
+
+// EventDatabase describes the database an event is about. Credentials are
+// never sent.
+type EventDatabase struct {
+	Name      string     `json:"name"`
+	Env       string     `json:"env"`
+	PRNumber  *int       `json:"pr_number,omitempty"`
+	Server    string     `json:"server"`
+	CreatedAt time.Time  `json:"created_at"`
+	ExpiresAt *time.Time `json:"expires_at,omitempty"`
+}
+
+// newEvent builds the event of a lifecycle change made by the caller of ctx
+func newEvent(ctx context.Context, event, projectName string, dbRecord *meta.Database) *Event {
+	e := &Event{
+		Event:   event,
+		Time:    time.Now().UTC(),
+		Actor:   actor(ctx, auth.OriginFromContext(ctx)),
+		Project: projectName,
+	}
+	if dbRecord != nil {
+		e.Database = &EventDatabase{
+			Name:      dbRecord.Name,
+			Env:       dbRecord.Env,
+			PRNumber:  dbRecord.PRNumber,
+			Server:    dbRecord.Server,
+			CreatedAt: dbRecord.CreatedAt,
+			ExpiresAt: dbRecord.ExpiresAt,
+		}
+	}
+	return e
+}
+
+// subscribes reports whether a webhook receives an event
+func subscribes(w meta.Webhook, e *Event) bool {
+	if len(w.Events) > 0 && !slices.Contains(w.Events, e.Event) {
+		return false
+	}
+	return len(w.Projects) == 0 || slices.Contains(w.Projects, e.Project)
+}
+
+// Events returns the bus on which the lifecycle events of this process are
+// published
+func (m *Manager) Events() *events.Bus {
+	return m.bus
+}
+
+// emit publishes an event on the bus and queues it for webhooks. Like
+// recording, emitting never fails the operation; errors are only reported.
+func (m *Manager) emit(ctx context.Context, e *Event, key string) {
+	m.publish(e)
+	m.queueWebhooks(ctx, e, key)
+}
+
+// publish sends an event to the subscribers of the bus
+func (m *Manager) publish(e *Event) {
+	data, err := json.Marshal(e)
+	if err != nil {
+		fmt.Printf("Warning: failed to publish %s event: %v\n", e.Event, err)
+		return
+	}
+	m.bus.Publish(e.Event, e.Project, data)
+}
+
+// queueWebhooks queues an event for every webhook subscribed to it. Events
+// with a key are queued once per webhook.
+func (m *Manager) queueWebhooks(ctx context.Context, e *Event, key string) {
+	ctx = context.WithoutCancel(ctx)
+	webhooks, err := m.store.ListWebhooks(ctx)
+	if err != nil {
+		fmt.Printf("Warning: failed to queue %s event: %v\n", e.Event, err)
+		return
+	}
+
+	var payload []byte
+	for _, w := range webhooks {
+		if !subscribes(w, e) {
+			continue
+		}
+		if payload == nil {
+			if payload, err = json.Marshal(e); err != nil {
+				fmt.Printf("Warning: failed to queue %s event: %v\n", e.Event, err)
+				return
+			}
+		}
+		delivery := &meta.WebhookDelivery{WebhookID: w.ID, Event: e.Event, Key: key, Payload: payload}
+		if _, err := m.store.CreateWebhookDelivery(ctx, delivery); err != nil {
+			fmt.Printf("Warning: failed to queue %s event for webhook %s: %v\n", e.Event, w.Name, err)
+		}
+	}
+}
+
+// validateWebhookURL checks that a webhook URL is an absolute HTTP(S) URL
+func validateWebhookURL(raw string) error {
+	u, err := url.Parse(raw)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("invalid webhook url '%s': must be an http or https URL", raw)
+	}
+	return nil
+}
+
+// CreateWebhook subscribes a URL to lifecycle events. The secret signing the
+// deliveries is generated unless one is given.
+func (m *Manager) CreateWebhook(ctx context.Context, opts WebhookOptions) (_ *meta.Webhook, err error) {
+	defer func() { m.record(ctx, "webhook.create", "", opts.Name, err) }()
+
+	if err := authorizeAll(ctx, auth.ScopeAdmin); err != nil {
+		return nil, err
+	}
+
+	if !validTokenNameRegex.MatchString(opts.Name) {
+		return nil, fmt.Errorf("invalid webhook name '%s'", opts.Name)
+	}
+	if err := validateWebhookURL(opts.URL); err != nil {
+		return nil, err
+	}
+	for _, event := range opts.Events {
+		if !slices.Contains(Events, event) {
+			return nil, fmt.Errorf("invalid event '%s', must be one of: %s", event, strings.Join(Events, ", "))
+		}
+	}
+	for _, name := range opts.Projects {
+		if err := ValidateName(name); err != nil {
+			return nil, fmt.Errorf("invalid project '%s': %w", name, err)
+		}
+	}
+
+	existing, err := m.store.GetWebhook(ctx, opts.Name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to check webhook: %w", err)
+	}
+	if existing != nil {
+		return nil, fmt.Errorf("webhook '%s' already exists", opts.Name)
+	}
+
+	secret := opts.Secret
+	if secret == "" {
+		if secret, err = webhook.GenerateSecret(); err != nil {
+			return nil, err
+		}
+	}
+	w := &meta.Webhook{
+		Name:     opts.Name,
+		URL:      opts.URL,
+		Secret:   secret,
+		Events:   opts.Events,
+		Projects: opts.Projects,
+	}
+	if err := m.store.CreateWebhook(ctx, w); err != nil {
+		return nil, err
+	}
+
+	return w, nil
+}
+
+// ListWebhooks returns all webhooks
+func (m *Manager) ListWebhooks(ctx context.Context) ([]meta.Webhook, error) {
+	if err := authorizeAll(ctx, auth.ScopeAdmin); err != nil {
+		return nil, err
+	}
+
+	return m.store.ListWebhooks(ctx)
+}
+
+// DeleteWebhook removes a webhook along with its queued and past deliveries
+func (m *Manager) DeleteWebhook(ctx context.Context, name string) (err error) {
+	defer func() { m.record(ctx, "webhook.delete", "", name, err) }()
+
+	if err := authorizeAll(ctx, auth.ScopeAdmin); err != nil {
+		return err
+	}
+
+	return m.store.DeleteWebhook(ctx, name)
+}
+
+// findWebhook looks up a webhook by name
+func (m *Manager) findWebhook(ctx context.Context, name string) (*meta.Webhook, error) {
+	w, err := m.store.GetWebhook(ctx, name)
+	if err != nil {
+		return nil, fmt.Errorf("failed to get webhook: %w", err)
+	}
+	if w == nil {
+		return nil, fmt.Errorf("webhook '%s' not found", name)
+	}
+	return w, nil
+}
+
+// TestWebhook sends a ping event to a webhook right away and returns the
+// delivery, whose status tells whether the endpoint accepted it. A failed ping
+// is recorded but not retried.
+func (m *Manager) TestWebhook(ctx context.Context, name string) (_ *meta.WebhookDelivery, err error) {
+	defer func() { m.record(ctx, "webhook.test", "", name, err) }()
+
+	if err := authorizeAll(ctx, auth.ScopeAdmin); err != nil {
+		return nil, err
+	}
+
+	w, err := m.findWebhook(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+
+	payload, err := json.Marshal(newEvent(ctx, EventPing, "", nil))
+	if err != nil {
+		return nil, err
+	}
+	// The ping is attempted here, so it is queued as already claimed
+	delivery := &meta.WebhookDelivery{
+		WebhookID:     w.ID,
+		Event:         EventPing,
+		Payload:       payload,
+		NextAttemptAt: time.Now().Add(webhookLease),
+	}
+	if _, err := m.store.CreateWebhookDelivery(ctx, delivery); err != nil {
+		return nil, err
+	}
+
+	m.attempt(ctx, *w, delivery, 1)
+	return delivery, nil
+}
+
+// ListWebhookDeliveries returns the deliveries of a webhook, newest first
+func (m *Manager) ListWebhookDeliveries(ctx context.Context, name string, limit int) ([]meta.WebhookDelivery, error) {
+	if err := authorizeAll(ctx, auth.ScopeAdmin); err != nil {
+		return nil, err
+	}
+
+	w, err := m.findWebhook(ctx, name)
+	if err != nil {
+		return nil, err
+	}
+	if limit <= 0 || limit > MaxWebhookDeliveries {
+		limit = MaxWebhookDeliveries
+	}
+	return m.store.ListWebhookDeliveries(ctx, w.ID, limit)
+}
+
+// attempt sends a delivery once and records the outcome. Failed deliveries are
+// retried with exponential backoff until maxAttempts attempts have failed.
+func (m *Manager) attempt(ctx context.Context, w meta.Webhook, d *meta.WebhookDelivery, maxAttempts int) {
+	d.Attempts++
+	code, err := webhook.Send(ctx, http.DefaultClient, w.URL, w.Secret, d.Event, d.ID, d.Payload)
+	d.ResponseCode = code
+	switch {
+	case err == nil:
+		d.Status = DeliverySucceeded
+		d.Error = ""
+	case d.Attempts >= maxAttempts:
+		d.Status = DeliveryFailed
+		d.Error = err.Error()
+	default:
+		d.Error = err.Error()
+		d.NextAttemptAt = time.Now().Add(webhook.Backoff(d.Attempts))
+	}
+
+	if err := m.store.UpdateWebhookDelivery(context.WithoutCancel(ctx), d); err != nil {
+		fmt.Printf("Warning: failed to record delivery %d to webhook %s: %v\n", d.ID, w.Name, err)
+	}
+}
+
+// DeliverWebhooks attempts the queued deliveries that are due and returns how
+// many were attempted
+func (m *Manager) DeliverWebhooks(ctx context.Context) (int, error) {
+	deliveries, err := m.store.ClaimWebhookDeliveries(ctx, webhookBatch, webhookLease)
+	if err != nil || len(deliveries) == 0 {
+		return 0, err
+	}
+
+	webhooks, err := m.store.ListWebhooks(ctx)
+	if err != nil {
+		return 0, fmt.Errorf("failed to list webhooks: %w", err)
+	}
+	byID := make(map[int64]meta.Webhook, len(webhooks))
+	for _, w := range webhooks {
+		byID[w.ID] = w
+	}
+
+	var wg sync.WaitGroup
+	for i := range deliveries {
+		w, ok := byID[deliveries[i].WebhookID]
+		if !ok {
+			// Deleted since the delivery was claimed
+			continue
+		}
+		wg.Add(1)
+		go func(d *meta.WebhookDelivery) {
+			defer wg.Done()
+			m.attempt(ctx, w, d, m.cfg.Webhooks.MaxAttempts)
+		}(&deliveries[i])
+	}
+	wg.Wait()
+
+	return len(deliveries), nil
+}
+
+// queueExpiryNotices queues database.expiring for the databases that expire
+// within the configured notice, and publishes it on the bus. Each expiry time
+// is notified once, so a database whose TTL is extended is notified again.
+func (m *Manager) queueExpiryNotices(ctx context.Context) error {
+	notice := m.cfg.Webhooks.ExpiryNotice
+	if notice <= 0 {
+		return nil
+	}
+
+	databases, err := m.store.ListAllDatabases(ctx)
+	if err != nil {
+		return fmt.Errorf("failed to list databases: %w", err)
+	}
+
+	var projectNames map[int64]string
+	notified := make(map[string]bool)
+	now := time.Now()
+	for i, dbRecord := range databases {
+		if dbRecord.ExpiresAt == nil || dbRecord.Protected || dbRecord.ExpiresAt.Before(now) || dbRecord.ExpiresAt.After(now.Add(notice)) {
+			continue
+		}
+		if projectNames == nil {
+			projectNames = m.projectNames(ctx)
+		}
+		key := fmt.Sprintf("%s:%s:%d", EventDatabaseExpiring, dbRecord.Name, dbRecord.ExpiresAt.Unix())
+		e := newEvent(ctx, EventDatabaseExpiring, projectNames[dbRecord.ProjectID], &databases[i])
+		notified[key] = true
+		if !m.expiryNotified[key] {
+			m.publish(e)
+		}
+		m.queueWebhooks(ctx, e, key)
+	}
+	m.expiryNotified = notified
+	return nil
+}
+
+// RunWebhooks delivers queued webhook events every interval until ctx is
+// canceled. It also queues expiry notices and prunes old outbound and
+// inbound deliveries.
+func (m *Manager) RunWebhooks(ctx context.Context, interval time.Duration) {
+	ctx = auth.WithOrigin(ctx, auth.Origin{Source: auth.SourceScheduler})
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+
+	var lastScan time.Time
+	for {
+		if time.Since(lastScan) >= expiryScanInterval {
+			lastScan = time.Now()
+			if err := m.queueExpiryNotices(ctx); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+			if _, err := m.store.PruneWebhookDeliveries(ctx, time.Now().Add(-webhookHistory)); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+			if _, err := m.store.PruneInboundDeliveries(ctx, time.Now().Add(-webhookHistory)); err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+		}
+
+		// Keep going while deliveries are backed up
+		for {
+			n, err := m.DeliverWebhooks(ctx)
+			if err != nil {
+				fmt.Printf("Warning: %v\n", err)
+			}
+			if n < webhookBatch || ctx.Err() != nil {
+				break
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
@@ -7,6 +7,8 @@ import (
 
 	tea "github.com/charmbracelet/bubbletea"
 	"github.com/charmbracelet/lipgloss"
+	"pgmanager/internal/auth"
+	"pgmanager/internal/db"
 	"pgmanager/internal/meta"
 	"pgmanager/internal/project"
 )
@@ -34,6 +36,10 @@ var (
 
 	successStyle = lipgloss.NewStyle().
 			Foreground(lipgloss.Color("46"))
+
+	confirmStyle = lipgloss.NewStyle().
+			Foreground(lipgloss.Color("214")).
+			Bold(true)
 )
 
 type view int
@@ -42,37 +48,48 @@ const (
 	viewProjects view = iota
 	viewDatabases
 	viewDatabaseInfo
+	viewSessions
 )
 
 type model struct {
-	mgr            *project.Manager
+	mgr            project.Service
 	projects       []meta.Project
 	databases      []project.DatabaseInfo
 	selectedDB     *project.DatabaseInfo
+	sessions       []db.Session
 	cursor         int
 	currentView    view
 	currentProject string
 	err            error
 	message        string
+	confirm        string  // Question shown until y runs confirmCmd or another key cancels it
+	confirmCmd     tea.Cmd // Destructive operation awaiting confirmation
 	width          int
 	height         int
 }
 
-func initialModel(mgr *project.Manager) model {
+func initialModel(mgr project.Service) model {
 	return model{
 		mgr:         mgr,
 		currentView: viewProjects,
 	}
 }
 
+// tuiContext returns the context of an operation started from the TUI, which
+// the audit log records as its source
+func tuiContext() context.Context {
+	return auth.WithOrigin(context.Background(), auth.Origin{Source: auth.SourceTUI})
+}
+
 type projectsLoadedMsg []meta.Project
 type databasesLoadedMsg []project.DatabaseInfo
+type sessionsLoadedMsg []db.Session
 type errMsg error
 type successMsg string
 
-func loadProjects(mgr *project.Manager) tea.Cmd {
+func loadProjects(mgr project.Service) tea.Cmd {
 	return func() tea.Msg {
-		projects, err := mgr.ListProjects(context.Background())
+		projects, err := mgr.ListProjects(tuiContext())
 		if err != nil {
 			return errMsg(err)
 		}
@@ -80,9 +97,9 @@ func loadProjects(mgr *project.Manager) tea.Cmd {
 	}
 }
 
-func loadDatabases(mgr *project.Manager, projectName string) tea.Cmd {
+func loadDatabases(mgr project.Service, projectName string) tea.Cmd {
 	return func() tea.Msg {
-		databases, err := mgr.ListDatabases(context.Background(), projectName)
+		databases, err := mgr.ListDatabases(tuiContext(), projectName)
 		if err != nil {
 			return errMsg(err)
 		}
@@ -90,6 +107,27 @@ func loadDatabases(mgr *project.Manager, projectName string) tea.Cmd {
 	}
 }
 
+func loadSessions(mgr project.Service, info *project.DatabaseInfo) tea.Cmd {
+	return func() tea.Msg {
+		sessions, err := mgr.ListSessions(tuiContext(), info.Project, info.Env, info.PRNumber)
+		if err != nil {
+			return errMsg(err)
+		}
+		return sessionsLoadedMsg(sessions)
+	}
+}
+
+// killSessions terminates one session (or all when pid is 0) and reloads the list
+func killSessions(mgr project.Service, info *project.DatabaseInfo, pid int) tea.Cmd {
+	return func() tea.Msg {
+		n, err := mgr.KillSessions(tuiContext(), info.Project, info.Env, info.PRNumber, pid)
+		if err != nil {
+			return errMsg(err)
+		}
+		return successMsg(fmt.Sprintf("Terminated %d session(s)", n))
+	}
+}
+
 func (m model) Init() tea.Cmd {
 	return loadProjects(m.mgr)
 }
@@ -116,12 +154,23 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 		m.err = nil
 		return m, nil
 
+	case sessionsLoadedMsg:
+		m.sessions = msg
+		if m.cursor >= len(m.sessions) {
+			m.cursor = 0
+		}
+		m.err = nil
+		return m, nil
+
 	case errMsg:
 		m.err = msg
 		return m, nil
 
 	case successMsg:
 		m.message = string(msg)
+		if m.currentView == viewSessions {
+			return m, loadSessions(m.mgr, m.selectedDB)
+		}
 		return m, nil
 	}
 
@@ -129,6 +178,16 @@ func (m model) Update(msg tea.Msg) (tea.Model, tea.Cmd) {
 }
 
 func (m model) handleKeyPress(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
+	if m.confirm != "" {
+		cmd := m.confirmCmd
+		m.confirm, m.confirmCmd = "", nil
+		if msg.String() == "y" {
+			return m, cmd
+		}
+		m.message = "Cancelled"
+		return m, nil
+	}
+
 	switch msg.String() {
 	case "ctrl+c", "q":
 		if m.currentView == viewProjects {
@@ -157,6 +216,13 @@ func (m model) handleKeyPress(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		return m.handleEnter()
 
 	case "esc", "b":
+		if m.currentView == viewSessions {
+			m.currentView = viewDatabaseInfo
+			m.sessions = nil
+			m.message = ""
+			m.cursor = 0
+			return m, nil
+		}
 		if m.currentView == viewDatabaseInfo {
 			m.currentView = viewDatabases
 			m.selectedDB = nil
@@ -178,6 +244,32 @@ func (m model) handleKeyPress(msg tea.KeyMsg) (tea.Model, tea.Cmd) {
 		if m.currentView == viewDatabases {
 			return m, loadDatabases(m.mgr, m.currentProject)
 		}
+		if m.currentView == viewSessions {
+			return m, loadSessions(m.mgr, m.selectedDB)
+		}
+		return m, nil
+
+	case "s":
+		if m.currentView == viewDatabaseInfo {
+			m.currentView = viewSessions
+			m.cursor = 0
+			return m, loadSessions(m.mgr, m.selectedDB)
+		}
+		return m, nil
+
+	case "x":
+		if m.currentView == viewSessions && m.cursor < len(m.sessions) {
+			return m, killSessions(m.mgr, m.selectedDB, m.sessions[m.cursor].PID)
+		}
+		return m, nil
+
+	case "X":
+		// Terminating every session can cut off applications, so it is confirmed first
+		if m.currentView == viewSessions && len(m.sessions) > 0 {
+			m.confirm = fmt.Sprintf("Terminate all %d session(s) on %s? (y/n)", len(m.sessions), m.selectedDB.DatabaseName)
+			m.confirmCmd = killSessions(m.mgr, m.selectedDB, 0)
+			m.message = ""
+		}
 		return m, nil
 	}
 
@@ -210,6 +302,8 @@ func (m model) getMaxItems() int {
 		return len(m.projects)
 	case viewDatabases:
 		return len(m.databases)
+	case viewSessions:
+		return len(m.sessions)
 	}
 	return 0
 }
@@ -237,6 +331,12 @@ func (m model) View() string {
 		s.WriteString("\n\n")
 	}
 
+	// Pending confirmation
+	if m.confirm != "" {
+		s.WriteString(confirmStyle.Render(m.confirm))
+		s.WriteString("\n\n")
+	}
+
 	// Content based on view
 	switch m.currentView {
 	case viewProjects:
@@ -245,6 +345,8 @@ func (m model) View() string {
 		s.WriteString(m.renderDatabasesView())
 	case viewDatabaseInfo:
 		s.WriteString(m.renderDatabaseInfoView())
+	case viewSessions:
+		s.WriteString(m.renderSessionsView())
 	}
 
 	// Help
@@ -319,6 +421,7 @@ func (m model) renderDatabaseInfoView() string {
 	s.WriteString(fmt.Sprintf("  Database: %s\n", db.DatabaseName))
 	s.WriteString(fmt.Sprintf("  User:     %s\n", db.UserName))
 	s.WriteString(fmt.Sprintf("  Password: %s\n", db.Password))
+	s.WriteString(fmt.Sprintf("  Server:   %s\n", db.Server))
 	s.WriteString(fmt.Sprintf("  Host:     %s\n", db.Host))
 	s.WriteString(fmt.Sprintf("  Port:     %d\n", db.Port))
 	s.WriteString(fmt.Sprintf("  Created:  %s\n", db.CreatedAt.Format("2006-01-02 15:04:05")))
@@ -332,7 +435,39 @@ func (m model) renderDatabaseInfoView() string {
 	return s.String()
 }
 
+func (m model) renderSessionsView() string {
+	var s strings.Builder
+
+	s.WriteString(fmt.Sprintf("Sessions on %s:\n\n", m.selectedDB.DatabaseName))
+	if len(m.sessions) == 0 {
+		s.WriteString("No sessions connected.\n")
+		return s.String()
+	}
+
+	for i, sess := range m.sessions {
+		cursor := "  "
+		style := normalStyle
+		if i == m.cursor {
+			cursor = "> "
+			style = selectedStyle
+		}
+		query := strings.Join(strings.Fields(sess.Query), " ")
+		if len(query) > 40 {
+			query = query[:37] + "..."
+		}
+		line := fmt.Sprintf("%s%-8d %-16s %-15s %-20s %s", cursor, sess.PID, sess.User, sess.ClientAddr, sess.State, query)
+		s.WriteString(style.Render(line))
+		s.WriteString("\n")
+	}
+
+	return s.String()
+}
+
 func (m model) renderHelp() string {
+	if m.confirm != "" {
+		return helpStyle.Render("y confirm • any other key cancel")
+	}
+
 	var help string
 	switch m.currentView {
 	case viewProjects:
@@ -340,13 +475,15 @@ func (m model) renderHelp() string {
 	case viewDatabases:
 		help = "↑/k up • ↓/j down • enter view • b/esc back • r refresh • q quit"
 	case viewDatabaseInfo:
-		help = "b/esc back • q quit"
+		help = "s sessions • b/esc back • q quit"
+	case viewSessions:
+		help = "↑/k up • ↓/j down • x terminate • X terminate all • r refresh • b/esc back • q quit"
 	}
 	return helpStyle.Render(help)
 }
 
 // Run starts the TUI application
-func Run(mgr *project.Manager) error {
+func Run(mgr project.Service) error {
 	p := tea.NewProgram(initialModel(mgr), tea.WithAltScreen())
 	_, err := p.Run()
 	return err
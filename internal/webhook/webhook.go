@@ -0,0 +1,99 @@
+package webhook
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/rand"
+	"crypto/sha256"
+	"encoding/hex"
+	"fmt"
+	"io"
+	"net/http"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// Headers sent with each delivery
+const (
+	EventHeader     = "X-Pgmanager-Event"         // Event type, such as database.created
+	DeliveryHeader  = "X-Pgmanager-Delivery"      // Delivery ID, the same for every attempt
+	SignatureHeader = "X-Pgmanager-Signature-256" // sha256= and the hex HMAC-SHA256 of the body
+)
+
+// SecretPrefix starts every generated webhook secret
+const SecretPrefix = "whsec_"
+
+// Timeout limits each delivery attempt
+const Timeout = 10 * time.Second
+
+// Retry delays double from MinBackoff up to MaxBackoff
+const (
+	MinBackoff = 30 * time.Second
+	MaxBackoff = time.Hour
+)
+
+// GenerateSecret returns a new random signing secret
+func GenerateSecret() (string, error) {
+	b := make([]byte, 24)
+	if _, err := rand.Read(b); err != nil {
+		return "", fmt.Errorf("failed to generate secret: %w", err)
+	}
+	return SecretPrefix + hex.EncodeToString(b), nil
+}
+
+// Sign returns the signature of a body: "sha256=" followed by the hex
+// HMAC-SHA256 of the body keyed with the secret
+func Sign(secret string, body []byte) string {
+	mac := hmac.New(sha256.New, []byte(secret))
+	mac.Write(body)
+	return "sha256=" + hex.EncodeToString(mac.Sum(nil))
+}
+
+// Verify reports whether signature is the signature of body under secret
+func Verify(secret string, body []byte, signature string) bool {
+	if !strings.HasPrefix(signature, "sha256=") {
+		return false
+	}
+	return hmac.Equal([]byte(Sign(secret, body)), []byte(signature))
+}
+
+// Backoff returns how long to wait before retrying a delivery that has failed
+// attempts times
+func Backoff(attempts int) time.Duration {
+	d := MinBackoff
+	for i := 1; i < attempts && d < MaxBackoff; i++ {
+		d *= 2
+	}
+	return min(d, MaxBackoff)
+}
+
+// Send posts a signed JSON body to url. It returns the response status, or 0
+// if no response was received, and an error unless the status is 2xx.
+func Send(ctx context.Context, client *http.Client, url, secret, event string, id int64, body []byte) (int, error) {
+	ctx, cancel := context.WithTimeout(ctx, Timeout)
+	defer cancel()
+
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, url, bytes.NewReader(body))
+	if err != nil {
+		return 0, err
+	}
+	req.Header.Set("Content-Type", "application/json")
+	req.Header.Set("User-Agent", "pgmanager-webhook")
+	req.Header.Set(EventHeader, event)
+	req.Header.Set(DeliveryHeader, strconv.FormatInt(id, 10))
+	req.Header.Set(SignatureHeader, Sign(secret, body))
+
+	resp, err := client.Do(req)
+	if err != nil {
+		return 0, err
+	}
+	defer resp.Body.Close()
+	io.Copy(io.Discard, io.LimitReader(resp.Body, 64<<10))
+
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return resp.StatusCode, fmt.Errorf("endpoint returned %s", resp.Status)
+	}
+	return resp.StatusCode, nil
+}
@@ -0,0 +1,83 @@
+package webhook
+
+import (
+	"context"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestSign(t *testing.T) {
+	// Example from GitHub's webhook documentation, which uses the same scheme
+	got := Sign("It's a Secret to Everybody", []byte("Hello, World!"))
+	want := "sha256=757107ea0eb2509fc211221cce984b8a37570b6d7586c22c46f4379c8b043e17"
+	if got != want {
+		t.Errorf("Sign() = %s, want %s", got, want)
+	}
+
+	body := []byte(`{"event":"ping"}`)
+	if !Verify("secret", body, Sign("secret", body)) {
+		t.Error("Verify() rejected a valid signature")
+	}
+	for _, sig := range []string{Sign("other", body), strings.TrimPrefix(Sign("secret", body), "sha256="), ""} {
+		if Verify("secret", body, sig) {
+			t.Errorf("Verify() accepted %q", sig)
+		}
+	}
+}
+
+func TestBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, 30 * time.Second},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{7, 32 * time.Minute},
+		{8, time.Hour},
+		{50, time.Hour},
+	}
+	for _, tt := range tests {
+		if got := Backoff(tt.attempts); got != tt.want {
+			t.Errorf("Backoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestSend(t *testing.T) {
+	status := http.StatusNoContent
+	var got *http.Request
+	var gotBody []byte
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		got = r
+		gotBody, _ = io.ReadAll(r.Body)
+		w.WriteHeader(status)
+	}))
+	defer srv.Close()
+
+	body := []byte(`{"event":"database.created"}`)
+	code, err := Send(context.Background(), srv.Client(), srv.URL, "secret", "database.created", 42, body)
+	if err != nil || code != http.StatusNoContent {
+		t.Fatalf("Send() = %d, %v", code, err)
+	}
+	if got.Header.Get(EventHeader) != "database.created" || got.Header.Get(DeliveryHeader) != "42" {
+		t.Errorf("headers = %v", got.Header)
+	}
+	if !Verify("secret", gotBody, got.Header.Get(SignatureHeader)) {
+		t.Error("delivery is not signed")
+	}
+
+	status = http.StatusInternalServerError
+	if code, err := Send(context.Background(), srv.Client(), srv.URL, "secret", "ping", 43, body); err == nil || code != status {
+		t.Errorf("Send() = %d, %v, want a failure with status %d", code, err, status)
+	}
+
+	srv.Close()
+	if code, err := Send(context.Background(), srv.Client(), srv.URL, "secret", "ping", 44, body); err == nil || code != 0 {
+		t.Errorf("Send() to a closed server = %d, %v", code, err)
+	}
+}